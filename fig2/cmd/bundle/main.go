@@ -0,0 +1,558 @@
+// Results bundles (.sdz) for archiving runs of mdbk_small_vero_0818.go. A bundle is a zip of
+// one run folder without the video, plus manifest.json with the SHA-256 of every member.
+// Standard library only.
+//
+// Build/run:
+//
+//	go run cmd/bundle/main.go create <runFolder> -o run.sdz [-referenceGrid 24]
+//	go run cmd/bundle/main.go verify run.sdz
+//	go run cmd/bundle/main.go verify run.sdz -rerun -sim ./mdbk -source mdbk_small_vero_0818.go
+//	go run cmd/bundle/main.go extract run.sdz -d <outFolder>
+//
+// verify -rerun runs the bundled configuration again (build the simulator with -tags headless
+// to skip rendering) and compares it with the bundled results through the simulator's own
+// -baseline check; it only does so when -source hashes to the bundled source copy.
+//
+// GRID_SIZE is a constant of the simulator, so a full-size re-run can take as long as the run
+// itself. create -referenceGrid N builds the bundled source with GRID_SIZE = N and the headless
+// renderer (the go tool must be on PATH), runs the bundled configuration on that reduced grid
+// and bundles its summary and CSV under reference/. verify -rerun then rebuilds -source the same
+// way and compares the new reduced-grid run with reference/ instead of running the full grid.
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const manifestName = "manifest.json"
+
+// Folder of the reduced-grid reference run inside a bundle, and the files of the run it keeps
+// (the ones the simulator's -baseline check compares)
+const referenceFolder = "reference"
+
+var referenceFiles = []string{"summary.json", "simulation_output.csv"}
+
+// Files of a run folder that never go into a bundle (bulky and reproducible from the rest)
+var excludedExtensions = map[string]bool{".mp4": true, ".avi": true, ".partial": true}
+
+// Manifest lists every bundle member with its size and SHA-256
+type Manifest struct {
+	Format        string   `json:"format"`
+	Created       string   `json:"created"`
+	RunFolder     string   `json:"run_folder"`
+	RandomSeed    *int64   `json:"random_seed,omitempty"`
+	SourceFile    string   `json:"source_file,omitempty"`
+	SourceSHA256  string   `json:"source_sha256,omitempty"`
+	ReferenceGrid int      `json:"reference_grid,omitempty"` // GRID_SIZE of the reference/ run (0 = none)
+	Members       []Member `json:"members"`
+}
+
+// Member is one file of the bundle
+type Member struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Function to return the hex SHA-256 of data
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Function to split a subcommand's arguments into the leading positional argument and the flags,
+// so both "create <runFolder> -o x" and "create -o x <runFolder>" work
+func splitArgs(fs *flag.FlagSet, args []string) string {
+	positional := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		positional, args = args[0], args[1:]
+	}
+	fs.Parse(args)
+	if positional == "" && fs.NArg() > 0 {
+		positional = fs.Arg(0)
+	}
+	return positional
+}
+
+// Function to check that a member name stays inside the extraction folder
+func safeMemberName(name string) bool {
+	clean := filepath.ToSlash(filepath.Clean(name))
+	return name != "" && !filepath.IsAbs(name) && clean != ".." && !strings.HasPrefix(clean, "../")
+}
+
+// Function to read the seed that params.json records for the run (nil if absent)
+func paramsSeed(paramsJSON []byte) *int64 {
+	var params struct {
+		RandomSeed *int64 `json:"randomSeed"`
+	}
+	if json.Unmarshal(paramsJSON, &params) != nil {
+		return nil
+	}
+	return params.RandomSeed
+}
+
+// Function to write runFolder (without videos) and its manifest into the bundle outPath. With
+// referenceGrid > 0 the bundled configuration is also run on a GRID_SIZE = referenceGrid build
+// of the run's source copy (with the renderer headless) and its results go under reference/.
+func createBundle(runFolder, outPath string, referenceGrid int, headless string) error {
+	entries, err := ioutil.ReadDir(runFolder)
+	if err != nil {
+		return err
+	}
+	manifest := Manifest{
+		Format:    "sdz/1",
+		Created:   time.Now().UTC().Format(time.RFC3339),
+		RunFolder: filepath.Base(filepath.Clean(runFolder)),
+		Members:   []Member{},
+	}
+	contents := map[string][]byte{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || excludedExtensions[strings.ToLower(filepath.Ext(name))] || name == manifestName {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(runFolder, name))
+		if err != nil {
+			return err
+		}
+		contents[name] = data
+		manifest.Members = append(manifest.Members, Member{Name: name, Size: int64(len(data)), SHA256: sha256Hex(data)})
+		// The run folder keeps a timestamped copy of the simulator source that produced it
+		if strings.HasPrefix(name, "mdbk_") && strings.HasSuffix(name, ".go") {
+			manifest.SourceFile, manifest.SourceSHA256 = name, sha256Hex(data)
+		}
+	}
+	if _, ok := contents["summary.json"]; !ok {
+		return fmt.Errorf("%s has no summary.json; is it a finished run folder?", runFolder)
+	}
+	if params, ok := contents["params.json"]; ok {
+		manifest.RandomSeed = paramsSeed(params)
+	}
+	if referenceGrid > 0 {
+		if manifest.SourceFile == "" || manifest.RandomSeed == nil || *manifest.RandomSeed < 0 {
+			return fmt.Errorf("%s needs a source copy and a params.json with the run's seed for a reference run", runFolder)
+		}
+		reference, err := runReducedGrid(contents[manifest.SourceFile], headless, referenceGrid, contents["params.json"], "", 0)
+		if err != nil {
+			return fmt.Errorf("reference run on a %d grid: %v", referenceGrid, err)
+		}
+		manifest.ReferenceGrid = referenceGrid
+		for _, name := range referenceFiles {
+			member := referenceFolder + "/" + name
+			contents[member] = reference[name]
+			manifest.Members = append(manifest.Members, Member{Name: member, Size: int64(len(reference[name])), SHA256: sha256Hex(reference[name])})
+		}
+	}
+	sort.Slice(manifest.Members, func(a, b int) bool { return manifest.Members[a].Name < manifest.Members[b].Name })
+
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	out, err := os.Create(outPath)
+	if err != nil {
+		return err
+	}
+	zw := zip.NewWriter(out)
+	for _, member := range append([]Member{{Name: manifestName}}, manifest.Members...) {
+		data := manifestJSON
+		if member.Name != manifestName {
+			data = contents[member.Name]
+		}
+		w, err := zw.Create(member.Name)
+		if err == nil {
+			_, err = w.Write(data)
+		}
+		if err != nil {
+			out.Close()
+			return err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("📦 Bundled %d files from %s into %s\n", len(manifest.Members), runFolder, outPath)
+	return nil
+}
+
+// Function to open a bundle and return its manifest and member contents
+func readBundle(path string) (*Manifest, map[string][]byte, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer zr.Close()
+
+	contents := map[string][]byte{}
+	for _, f := range zr.File {
+		if !safeMemberName(f.Name) {
+			return nil, nil, fmt.Errorf("bundle member %q has an unsafe path", f.Name)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, nil, err
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading %s: %v", f.Name, err)
+		}
+		contents[f.Name] = data
+	}
+	manifestJSON, ok := contents[manifestName]
+	if !ok {
+		return nil, nil, fmt.Errorf("%s has no %s", path, manifestName)
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(manifestJSON, &manifest); err != nil {
+		return nil, nil, fmt.Errorf("bad %s: %v", manifestName, err)
+	}
+	return &manifest, contents, nil
+}
+
+// Function to compare the bundle contents with its manifest; returns one problem per line
+func checkIntegrity(manifest *Manifest, contents map[string][]byte) []string {
+	problems := []string{}
+	listed := map[string]bool{manifestName: true}
+	for _, member := range manifest.Members {
+		listed[member.Name] = true
+		data, ok := contents[member.Name]
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("missing member %s", member.Name))
+		case int64(len(data)) != member.Size || sha256Hex(data) != member.SHA256:
+			problems = append(problems, fmt.Sprintf("hash mismatch for %s", member.Name))
+		}
+	}
+	for name := range contents {
+		if !listed[name] {
+			problems = append(problems, fmt.Sprintf("member %s is not in the manifest", name))
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
+
+// Function to write the bundle members into folder, checking each against the manifest first
+func extractBundle(path, folder string) error {
+	manifest, contents, err := readBundle(path)
+	if err != nil {
+		return err
+	}
+	if problems := checkIntegrity(manifest, contents); len(problems) > 0 {
+		return fmt.Errorf("bundle failed verification: %s", strings.Join(problems, "; "))
+	}
+	return writeMembers(manifest, contents, folder)
+}
+
+// Function to write the bundle members into folder, creating the subfolders they are in
+func writeMembers(manifest *Manifest, contents map[string][]byte, folder string) error {
+	for _, member := range manifest.Members {
+		path := filepath.Join(folder, filepath.FromSlash(member.Name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(path, contents[member.Name], 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flags of params.json that are not passed on to a re-run: the -baseline check the re-run sets
+// itself, the batch drivers (a bundled run is one run of a batch, and -config is already merged
+// into the recorded values), checkpoint resumption and writing, and the palette file, a path
+// relative to the folder the run was started from
+var rerunSkippedFlags = map[string]bool{
+	"baseline": true, "baselineTolerance": true, "failOnDivergence": true,
+	"config": true, "resumeFrom": true, "checkpointEvery": true,
+	"replicates": true, "parallel": true, "retryFailed": true, "memoryBudgetMB": true,
+	"dipAdvantageSweep": true, "sweepReplicates": true, "sweepMode": true, "sweepN": true, "sweepRanges": true,
+	"paletteFile": true,
+}
+
+// Function to build the simulator arguments that reproduce the bundled run from its params.json,
+// with the simulator's -baseline check pointed at baselineFolder unless it is empty
+func rerunArgs(paramsJSON []byte, baselineFolder string, tolerance float64) ([]string, error) {
+	var params struct {
+		Flags map[string]string `json:"flags"`
+	}
+	if err := json.Unmarshal(paramsJSON, &params); err != nil {
+		return nil, fmt.Errorf("bad params.json: %v", err)
+	}
+	names := make([]string, 0, len(params.Flags))
+	for name := range params.Flags {
+		if rerunSkippedFlags[name] {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	args := make([]string, 0, len(names)+3)
+	for _, name := range names {
+		args = append(args, fmt.Sprintf("-%s=%s", name, params.Flags[name]))
+	}
+	if baselineFolder != "" {
+		args = append(args, "-baseline="+baselineFolder, fmt.Sprintf("-baselineTolerance=%g", tolerance), "-failOnDivergence")
+	}
+	return args, nil
+}
+
+// Pattern of the GRID_SIZE constant in the simulator source
+var gridSizePattern = regexp.MustCompile(`(?m)^(\s*GRID_SIZE\s*=\s*)\d+`)
+
+// Function to build the simulator source with GRID_SIZE = grid and the headless renderer file
+// into dir, returning the binary
+func buildReducedSimulator(source []byte, headless string, grid int, dir string) (string, error) {
+	if !gridSizePattern.Match(source) {
+		return "", fmt.Errorf("the simulator source has no GRID_SIZE constant")
+	}
+	renderer, err := ioutil.ReadFile(headless)
+	if err != nil {
+		return "", fmt.Errorf("reading the headless renderer: %v", err)
+	}
+	reduced := gridSizePattern.ReplaceAll(source, []byte(fmt.Sprintf("${1}%d", grid)))
+	// Under the original names: the run copies its source into the run folder as mdbk_*_<time>.go
+	if err := ioutil.WriteFile(filepath.Join(dir, "mdbk_small_vero_0818.go"), reduced, 0644); err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "render_headless_0818.go"), renderer, 0644); err != nil {
+		return "", err
+	}
+	binary := filepath.Join(dir, "simulator")
+	cmd := exec.Command("go", "build", "-tags", "headless", "-o", binary, "mdbk_small_vero_0818.go", "render_headless_0818.go")
+	cmd.Dir = dir
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("go build: %v\n%s", err, output)
+	}
+	return binary, nil
+}
+
+// Function to run the simulator binary sim with args in runDir; the error carries the last
+// lines of its output
+func runSimulator(sim string, args []string, runDir string) error {
+	cmd := exec.Command(sim, args...)
+	cmd.Dir = runDir
+	var output bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &output, &output
+	if err := cmd.Run(); err != nil {
+		lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+		if len(lines) > 10 {
+			lines = lines[len(lines)-10:]
+		}
+		return fmt.Errorf("re-run failed or diverged (%v):\n%s", err, strings.Join(lines, "\n"))
+	}
+	return nil
+}
+
+// Function to run the configuration of paramsJSON on a GRID_SIZE = grid build of source, with the
+// -baseline check against baselineFolder unless it is empty, and return the run's reference files
+func runReducedGrid(source []byte, headless string, grid int, paramsJSON []byte, baselineFolder string, tolerance float64) (map[string][]byte, error) {
+	work, err := ioutil.TempDir("", "sdz-reduced-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(work)
+
+	sim, err := buildReducedSimulator(source, headless, grid, work)
+	if err != nil {
+		return nil, err
+	}
+	args, err := rerunArgs(paramsJSON, baselineFolder, tolerance)
+	if err != nil {
+		return nil, err
+	}
+	runDir := filepath.Join(work, "run")
+	if err := os.MkdirAll(runDir, 0755); err != nil {
+		return nil, err
+	}
+	if err := runSimulator(sim, args, runDir); err != nil {
+		return nil, err
+	}
+	// The run writes one output folder into runDir
+	folders, err := filepath.Glob(filepath.Join(runDir, "*", "summary.json"))
+	if err != nil || len(folders) != 1 {
+		return nil, fmt.Errorf("expected one run folder with a summary.json, found %d", len(folders))
+	}
+	files := map[string][]byte{}
+	for _, name := range referenceFiles {
+		data, err := ioutil.ReadFile(filepath.Join(filepath.Dir(folders[0]), name))
+		if err != nil {
+			return nil, err
+		}
+		files[name] = data
+	}
+	return files, nil
+}
+
+// Function to re-run the bundled configuration and compare it with the bundle: with a reference/
+// run, on a GRID_SIZE = ReferenceGrid build of source against it; otherwise with the simulator
+// binary sim against the bundled summary and CSV. Returns an error if the new run diverges.
+func rerunBundle(manifest *Manifest, contents map[string][]byte, sim string, source []byte, headless string, tolerance float64) error {
+	params, ok := contents["params.json"]
+	if !ok {
+		return fmt.Errorf("bundle has no params.json to re-run")
+	}
+	work, err := ioutil.TempDir("", "sdz-rerun-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(work)
+
+	bundled := filepath.Join(work, "bundled")
+	if err := writeMembers(manifest, contents, bundled); err != nil {
+		return err
+	}
+	if manifest.ReferenceGrid > 0 {
+		_, err := runReducedGrid(source, headless, manifest.ReferenceGrid, params, filepath.Join(bundled, referenceFolder), tolerance)
+		return err
+	}
+
+	args, err := rerunArgs(params, bundled, tolerance)
+	if err != nil {
+		return err
+	}
+	simPath, err := filepath.Abs(sim)
+	if err != nil {
+		return err
+	}
+	runDir := filepath.Join(work, "rerun")
+	if err := os.MkdirAll(runDir, 0755); err != nil {
+		return err
+	}
+	return runSimulator(simPath, args, runDir)
+}
+
+// Function to verify a bundle's hashes and, with rerun, reproduce it with the simulator
+func verifyBundle(path string, rerun bool, sim, source, headless string, tolerance float64) error {
+	manifest, contents, err := readBundle(path)
+	if err != nil {
+		return err
+	}
+	if problems := checkIntegrity(manifest, contents); len(problems) > 0 {
+		for _, p := range problems {
+			fmt.Printf("❌ %s\n", p)
+		}
+		return fmt.Errorf("%d integrity problem(s) in %s", len(problems), path)
+	}
+	fmt.Printf("✅ %s: %d members match the manifest (run %s, seed %s)\n", path, len(manifest.Members), manifest.RunFolder, seedText(manifest.RandomSeed))
+
+	if !rerun {
+		return nil
+	}
+	if manifest.SourceSHA256 == "" {
+		fmt.Println("⚠️  Bundle has no simulator source copy; skipping re-run")
+		return nil
+	}
+	current, err := ioutil.ReadFile(source)
+	if err != nil {
+		return fmt.Errorf("reading -source: %v", err)
+	}
+	if sha256Hex(current) != manifest.SourceSHA256 {
+		fmt.Printf("⚠️  %s differs from the bundled %s; skipping re-run\n", source, manifest.SourceFile)
+		return nil
+	}
+	if manifest.RandomSeed == nil || *manifest.RandomSeed < 0 {
+		fmt.Println("⚠️  Bundled run used a time-based seed and cannot be reproduced; skipping re-run")
+		return nil
+	}
+	if err := rerunBundle(manifest, contents, sim, current, headless, tolerance); err != nil {
+		return err
+	}
+	if manifest.ReferenceGrid > 0 {
+		fmt.Printf("✅ Re-run on the %d grid reproduces the bundled reference within tolerance %g\n", manifest.ReferenceGrid, tolerance)
+		return nil
+	}
+	fmt.Printf("✅ Re-run reproduces the bundled results within tolerance %g\n", tolerance)
+	return nil
+}
+
+// Function to format an optional seed
+func seedText(seed *int64) string {
+	if seed == nil {
+		return "unknown"
+	}
+	return fmt.Sprintf("%d", *seed)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage:")
+	fmt.Fprintln(os.Stderr, "  bundle create <runFolder> -o run.sdz [-referenceGrid N -headless <renderer.go>]")
+	fmt.Fprintln(os.Stderr, "  bundle verify run.sdz [-rerun -sim <simulator> -source <file.go> -headless <renderer.go> -tolerance 1e-9]")
+	fmt.Fprintln(os.Stderr, "  bundle extract run.sdz -d <outFolder>")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	command, args := os.Args[1], os.Args[2:]
+	switch command {
+	case "create":
+		fs := flag.NewFlagSet("create", flag.ExitOnError)
+		out := fs.String("o", "", "Bundle file to write (default <runFolder>.sdz)")
+		referenceGrid := fs.Int("referenceGrid", 0, "Also bundle a re-run on a GRID_SIZE = N build of the run's source, for quick verification (0 = none); the grid must hold the seeded cells (options 1 and 2 seed cell 25,25)")
+		headless := fs.String("headless", "render_headless_0818.go", "Headless renderer built with the source for -referenceGrid")
+		runFolder := splitArgs(fs, args)
+		if runFolder == "" {
+			usage()
+		}
+		if *out == "" {
+			*out = filepath.Clean(runFolder) + ".sdz"
+		}
+		if err := createBundle(runFolder, *out, *referenceGrid, *headless); err != nil {
+			log.Fatalf("Failed to create bundle: %v", err)
+		}
+	case "verify":
+		fs := flag.NewFlagSet("verify", flag.ExitOnError)
+		rerun := fs.Bool("rerun", false, "Re-run the bundled configuration when -source matches the bundled source")
+		sim := fs.String("sim", "./mdbk", "Simulator binary built from -source (use -tags headless), for a bundle without a reference run")
+		source := fs.String("source", "mdbk_small_vero_0818.go", "Current simulator source, compared with the bundled copy")
+		headless := fs.String("headless", "render_headless_0818.go", "Headless renderer built with -source for a bundle with a reference run")
+		tolerance := fs.Float64("tolerance", 1e-9, "Relative tolerance for the re-run comparison")
+		bundle := splitArgs(fs, args)
+		if bundle == "" {
+			usage()
+		}
+		if err := verifyBundle(bundle, *rerun, *sim, *source, *headless, *tolerance); err != nil {
+			log.Fatalf("Verification failed: %v", err)
+		}
+	case "extract":
+		fs := flag.NewFlagSet("extract", flag.ExitOnError)
+		dir := fs.String("d", "", "Folder to extract into (default: bundle name without .sdz)")
+		bundle := splitArgs(fs, args)
+		if bundle == "" {
+			usage()
+		}
+		if *dir == "" {
+			*dir = strings.TrimSuffix(bundle, filepath.Ext(bundle))
+		}
+		if err := extractBundle(bundle, *dir); err != nil {
+			log.Fatalf("Failed to extract bundle: %v", err)
+		}
+		fmt.Printf("📂 Extracted %s into %s\n", bundle, *dir)
+	default:
+		usage()
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Function to write a run folder with the files a finished run leaves, including a video that
+// must stay out of the bundle
+func writeRunFolder(t *testing.T) string {
+	t.Helper()
+	folder := filepath.Join(t.TempDir(), "run_seed7")
+	files := map[string]string{
+		"summary.json":                     `{"final_dead_percentage": 12.5}`,
+		"params.json":                      `{"flags": {"randomSeed": "7", "rho": "0.02"}, "randomSeed": 7}`,
+		"simulation_output.csv":            "Time,dead\n0,0\n1,0.5\n",
+		"mdbk_small_vero_0818_20260101.go": "package main\n",
+		"simulation_video.mp4":             "not archived",
+		"snapshot_t25.png":                 "\x89PNG\x00binary\xff",
+	}
+	if err := os.MkdirAll(folder, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(folder, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return folder
+}
+
+// Function to write the bundle at path again with its members changed by edit. With rehash the
+// manifest hashes are recomputed, so only a re-run can tell the difference.
+func rewriteBundle(t *testing.T, path string, rehash bool, edit func(manifest *Manifest, contents map[string][]byte)) string {
+	t.Helper()
+	manifest, contents, err := readBundle(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edit(manifest, contents)
+	if rehash {
+		for k, member := range manifest.Members {
+			manifest.Members[k].Size, manifest.Members[k].SHA256 = int64(len(contents[member.Name])), sha256Hex(contents[member.Name])
+		}
+	}
+	manifestJSON, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents[manifestName] = manifestJSON
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, data := range contents {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(data)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(t.TempDir(), "tampered.sdz")
+	if err := ioutil.WriteFile(out, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestExtractRoundTripsByteIdentically(t *testing.T) {
+	folder := writeRunFolder(t)
+	bundle := filepath.Join(t.TempDir(), "run.sdz")
+	if err := createBundle(folder, bundle, 0, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyBundle(bundle, false, "", "", "", 1e-9); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(t.TempDir(), "extracted")
+	if err := extractBundle(bundle, out); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := ioutil.ReadDir(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+		original, err := ioutil.ReadFile(filepath.Join(folder, entry.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		extracted, err := ioutil.ReadFile(filepath.Join(out, entry.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(original, extracted) {
+			t.Errorf("%s differs after extraction", entry.Name())
+		}
+	}
+	want := []string{"mdbk_small_vero_0818_20260101.go", "params.json", "simulation_output.csv", "snapshot_t25.png", "summary.json"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("extracted %v, want %v (no video)", names, want)
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	folder := writeRunFolder(t)
+	bundle := filepath.Join(t.TempDir(), "run.sdz")
+	if err := createBundle(folder, bundle, 0, ""); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name string
+		edit func(manifest *Manifest, contents map[string][]byte)
+	}{
+		{"changed member", func(_ *Manifest, contents map[string][]byte) {
+			contents["simulation_output.csv"] = []byte("Time,dead\n0,0\n1,0.6\n")
+		}},
+		{"missing member", func(_ *Manifest, contents map[string][]byte) {
+			delete(contents, "params.json")
+		}},
+		{"member not in the manifest", func(_ *Manifest, contents map[string][]byte) {
+			contents["extra.csv"] = []byte("x\n")
+		}},
+		{"manifest hash edited", func(manifest *Manifest, _ map[string][]byte) {
+			manifest.Members[0].SHA256 = strings.Repeat("0", 64)
+		}},
+	}
+	for _, c := range cases {
+		tampered := rewriteBundle(t, bundle, false, c.edit)
+		if err := verifyBundle(tampered, false, "", "", "", 1e-9); err == nil {
+			t.Errorf("%s: verify passed", c.name)
+		}
+		if err := extractBundle(tampered, filepath.Join(t.TempDir(), "out")); err == nil {
+			t.Errorf("%s: extract passed", c.name)
+		}
+	}
+}
+
+func TestRerunArgsStripDriverAndCheckpointFlags(t *testing.T) {
+	params := []byte(`{"flags": {"rho": "0.02", "randomSeed": "7", "config": "study.json", "resumeFrom": "cp.gob",
+		"checkpointEvery": "5", "replicates": "10", "parallel": "4", "baseline": "old", "paletteFile": "p.json"}}`)
+	args, err := rerunArgs(params, "bundled", 1e-6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"-randomSeed=7", "-rho=0.02", "-baseline=bundled", "-baselineTolerance=1e-06", "-failOnDivergence"}
+	if !reflect.DeepEqual(args, want) {
+		t.Fatalf("rerunArgs = %v, want %v", args, want)
+	}
+	if args, _ := rerunArgs(params, "", 0); len(args) != 2 {
+		t.Fatalf("rerunArgs without a baseline = %v, want the two run flags", args)
+	}
+}
+
+func TestReducedGridRerun(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the simulator three times")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("no go tool on PATH")
+	}
+	source, err := ioutil.ReadFile(filepath.Join("..", "..", "mdbk_small_vero_0818.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	headless := filepath.Join("..", "..", "render_headless_0818.go")
+
+	// The run to archive, itself on a small grid to keep the test quick (option 2 seeds cell 25,25)
+	work := t.TempDir()
+	sim, err := buildReducedSimulator(source, headless, 36, work)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runDir := filepath.Join(work, "run")
+	os.MkdirAll(runDir, 0755)
+	if err := runSimulator(sim, []string{"-render=false", "-randomSeed=3", "-checkpointEvery=0"}, runDir); err != nil {
+		t.Fatal(err)
+	}
+	summaries, _ := filepath.Glob(filepath.Join(runDir, "*", "summary.json"))
+	if len(summaries) != 1 {
+		t.Fatalf("found %d run folders", len(summaries))
+	}
+	runFolder := filepath.Dir(summaries[0])
+
+	bundle := filepath.Join(t.TempDir(), "run.sdz")
+	if err := createBundle(runFolder, bundle, 28, headless); err != nil {
+		t.Fatal(err)
+	}
+	manifest, contents, err := readBundle(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.ReferenceGrid != 28 || contents["reference/summary.json"] == nil {
+		t.Fatalf("reference grid %d, reference members missing", manifest.ReferenceGrid)
+	}
+	// -source is the run's own source copy, so the versions match
+	current := filepath.Join(runFolder, manifest.SourceFile)
+	if err := verifyBundle(bundle, true, "", current, headless, 1e-9); err != nil {
+		t.Fatalf("unchanged bundle: %v", err)
+	}
+
+	// A reference that the code no longer reproduces, with the hashes updated to match
+	diverged := rewriteBundle(t, bundle, true, func(_ *Manifest, contents map[string][]byte) {
+		csv := string(contents["reference/simulation_output.csv"])
+		lines := strings.Split(csv, "\n")
+		fields := strings.Split(lines[len(lines)/2], ",")
+		fields[len(fields)-1] = "12345"
+		lines[len(lines)/2] = strings.Join(fields, ",")
+		contents["reference/simulation_output.csv"] = []byte(strings.Join(lines, "\n"))
+	})
+	if err := verifyBundle(diverged, true, "", current, headless, 1e-9); err == nil || !strings.Contains(err.Error(), "diverges from baseline") {
+		t.Fatalf("changed reference: %v, want a divergence", err)
+	}
+}
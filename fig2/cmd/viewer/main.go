@@ -0,0 +1,317 @@
+// Terminal viewer for per-cell snapshot CSVs (snapshot_<t>_hours.csv) written by
+// mdbk_small_vero_0818.go. No GUI dependencies, standard library only.
+//
+// Build/run:
+//
+//	go run cmd/viewer/main.go -snapshot <runFolder>/snapshot_25_hours.csv
+//	go run cmd/viewer/main.go -snapshot <file> -region 30,30,50,50
+//	go run cmd/viewer/main.go -snapshot <file> -at 38,38
+//	go run cmd/viewer/main.go -snapshot <file> -find state=INFECTED_BOTH
+package main
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var (
+	flag_snapshot = flag.String("snapshot", "", "Path to a snapshot CSV (snapshot_<t>_hours.csv, or .csv.gz from -snapshotGzip)")
+	flag_region   = flag.String("region", "", "Sub-region to render as i0,j0,i1,j1 (inclusive); empty renders the whole grid")
+	flag_at       = flag.String("at", "", "Print all per-cell fields for the cell i,j")
+	flag_find     = flag.String("find", "", "List cells matching field=value, e.g. state=INFECTED_BOTH or localDips=0")
+	flag_color    = flag.Bool("color", true, "Use ANSI colors in the map")
+)
+
+// Cell state definitions (must match mdbk_small_vero_0818.go)
+const (
+	SUSCEPTIBLE                = 0
+	INFECTED_VIRION            = 1
+	DEAD                       = 2
+	ANTIVIRAL                  = 3
+	REGROWTH                   = 4
+	INFECTED_DIP               = 5
+	INFECTED_BOTH              = 6
+	INFECTED_VIRION_CONTINUOUS = 7
+	INFECTED_DIP_CONTINUOUS    = 8
+	INFECTED_BOTH_CONTINUOUS   = 9
+	UNEXPOSED                  = 10
+)
+
+var stateNames = map[int]string{
+	SUSCEPTIBLE:                "SUSCEPTIBLE",
+	INFECTED_VIRION:            "INFECTED_VIRION",
+	DEAD:                       "DEAD",
+	ANTIVIRAL:                  "ANTIVIRAL",
+	REGROWTH:                   "REGROWTH",
+	INFECTED_DIP:               "INFECTED_DIP",
+	INFECTED_BOTH:              "INFECTED_BOTH",
+	INFECTED_VIRION_CONTINUOUS: "INFECTED_VIRION_CONTINUOUS",
+	INFECTED_DIP_CONTINUOUS:    "INFECTED_DIP_CONTINUOUS",
+	INFECTED_BOTH_CONTINUOUS:   "INFECTED_BOTH_CONTINUOUS",
+	UNEXPOSED:                  "UNEXPOSED",
+}
+
+// Map glyph and ANSI color per state (same color scheme as the "states" video)
+var stateGlyphs = map[int]struct {
+	glyph string
+	ansi  string
+}{
+	SUSCEPTIBLE:                {".", "\033[37m"},
+	INFECTED_VIRION:            {"V", "\033[31m"},
+	DEAD:                       {"#", "\033[90m"},
+	ANTIVIRAL:                  {"A", "\033[34m"},
+	REGROWTH:                   {"R", "\033[35m"},
+	INFECTED_DIP:               {"D", "\033[32m"},
+	INFECTED_BOTH:              {"B", "\033[33m"},
+	INFECTED_VIRION_CONTINUOUS: {"v", "\033[31m"},
+	INFECTED_DIP_CONTINUOUS:    {"d", "\033[32m"},
+	INFECTED_BOTH_CONTINUOUS:   {"b", "\033[33m"},
+	UNEXPOSED:                  {" ", ""},
+}
+
+const ansiReset = "\033[0m"
+
+// Snapshot holds all cells of one frame, indexed by [i][j]
+type Snapshot struct {
+	header []string
+	cells  [][][]string // cells[i][j] = raw CSV row
+	state  [][]int
+	sizeI  int
+	sizeJ  int
+}
+
+// Function to load a snapshot CSV written by saveSnapshotCSV (gzip-compressed if it ends in .gz)
+func loadSnapshot(path string) (*Snapshot, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var in io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		in = gz
+	}
+	records, err := csv.NewReader(in).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) < 2 {
+		return nil, fmt.Errorf("snapshot %s has no cells", path)
+	}
+
+	s := &Snapshot{header: records[0]}
+	col := map[string]int{}
+	for idx, name := range s.header {
+		col[name] = idx
+	}
+	for _, name := range []string{"i", "j", "state"} {
+		if _, ok := col[name]; !ok {
+			return nil, fmt.Errorf("snapshot %s is missing column %q", path, name)
+		}
+	}
+
+	// First pass: grid size
+	for _, row := range records[1:] {
+		i, _ := strconv.Atoi(row[col["i"]])
+		j, _ := strconv.Atoi(row[col["j"]])
+		if i+1 > s.sizeI {
+			s.sizeI = i + 1
+		}
+		if j+1 > s.sizeJ {
+			s.sizeJ = j + 1
+		}
+	}
+
+	s.cells = make([][][]string, s.sizeI)
+	s.state = make([][]int, s.sizeI)
+	for i := range s.cells {
+		s.cells[i] = make([][]string, s.sizeJ)
+		s.state[i] = make([]int, s.sizeJ)
+		for j := range s.state[i] {
+			s.state[i][j] = -1
+		}
+	}
+	for line, row := range records[1:] {
+		i, errI := strconv.Atoi(row[col["i"]])
+		j, errJ := strconv.Atoi(row[col["j"]])
+		st, errS := strconv.Atoi(row[col["state"]])
+		if errI != nil || errJ != nil || errS != nil || i < 0 || j < 0 {
+			return nil, fmt.Errorf("snapshot %s: bad row %d: %v", path, line+2, row)
+		}
+		s.cells[i][j] = row
+		s.state[i][j] = st
+	}
+	return s, nil
+}
+
+// Function to parse "a,b" or "a,b,c,d" into ints
+func parseInts(text string, n int) ([]int, error) {
+	parts := strings.Split(text, ",")
+	if len(parts) != n {
+		return nil, fmt.Errorf("expected %d comma-separated integers, got %q", n, text)
+	}
+	values := make([]int, n)
+	for idx, p := range parts {
+		v, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil {
+			return nil, fmt.Errorf("bad integer %q in %q", p, text)
+		}
+		values[idx] = v
+	}
+	return values, nil
+}
+
+// Function to parse -region ("i0,j0,i1,j1", corners in any order) into an inclusive window
+// inside the grid; empty selects the whole grid
+func (s *Snapshot) region(text string) (i0, j0, i1, j1 int, err error) {
+	if text == "" {
+		return 0, 0, s.sizeI - 1, s.sizeJ - 1, nil
+	}
+	region, err := parseInts(text, 4)
+	if err != nil {
+		return 0, 0, 0, 0, err
+	}
+	i0, j0, i1, j1 = region[0], region[1], region[2], region[3]
+	if i0 > i1 {
+		i0, i1 = i1, i0
+	}
+	if j0 > j1 {
+		j0, j1 = j1, j0
+	}
+	if i0 < 0 || j0 < 0 || i1 >= s.sizeI || j1 >= s.sizeJ {
+		return 0, 0, 0, 0, fmt.Errorf("region %s is outside the %dx%d grid", text, s.sizeI, s.sizeJ)
+	}
+	return i0, j0, i1, j1, nil
+}
+
+// Function to write the region [i0,i1] x [j0,j1] to w as a character map.
+// Rows are j and columns are i; odd columns sit half a row lower on the real hex lattice.
+func (s *Snapshot) render(w io.Writer, i0, j0, i1, j1 int, useColor bool) {
+	fmt.Fprintf(w, "Region i=%d..%d, j=%d..%d (grid %dx%d)\n", i0, i1, j0, j1, s.sizeI, s.sizeJ)
+	for j := j0; j <= j1; j++ {
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "%4d ", j)
+		for i := i0; i <= i1; i++ {
+			g, ok := stateGlyphs[s.state[i][j]]
+			if !ok {
+				sb.WriteString("? ")
+				continue
+			}
+			if useColor && g.ansi != "" {
+				sb.WriteString(g.ansi + g.glyph + ansiReset + " ")
+			} else {
+				sb.WriteString(g.glyph + " ")
+			}
+		}
+		fmt.Fprintln(w, sb.String())
+	}
+	fmt.Fprintln(w, "Legend: . susceptible, V/v virion, D/d DIP, B/b both (lowercase = continuous), # dead, A antiviral, R regrowth")
+}
+
+// Function to write all fields of a cell to w
+func (s *Snapshot) printCell(w io.Writer, i, j int) {
+	row := s.cells[i][j]
+	if row == nil {
+		fmt.Fprintf(w, "No data for cell (%d,%d)\n", i, j)
+		return
+	}
+	fmt.Fprintf(w, "Cell (%d,%d):\n", i, j)
+	for idx, name := range s.header {
+		value := row[idx]
+		if name == "state" || name == "previousState" {
+			if st, err := strconv.Atoi(value); err == nil {
+				if stName, ok := stateNames[st]; ok {
+					value = fmt.Sprintf("%s (%s)", value, stName)
+				}
+			}
+		}
+		fmt.Fprintf(w, "  %-24s %s\n", name, value)
+	}
+}
+
+// Function to list the cells where field == value to w; state values may be given by name
+func (s *Snapshot) find(w io.Writer, query string) error {
+	parts := strings.SplitN(query, "=", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("expected field=value, got %q", query)
+	}
+	field, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+	col := -1
+	for idx, name := range s.header {
+		if name == field {
+			col = idx
+		}
+	}
+	if col < 0 {
+		return fmt.Errorf("unknown field %q (columns: %s)", field, strings.Join(s.header, ", "))
+	}
+	if field == "state" || field == "previousState" {
+		for st, name := range stateNames {
+			if strings.EqualFold(name, value) {
+				value = strconv.Itoa(st)
+			}
+		}
+	}
+
+	count := 0
+	for i := 0; i < s.sizeI; i++ {
+		for j := 0; j < s.sizeJ; j++ {
+			row := s.cells[i][j]
+			if row != nil && row[col] == value {
+				fmt.Fprintf(w, "(%d,%d)\n", i, j)
+				count++
+			}
+		}
+	}
+	fmt.Fprintf(w, "%d cells with %s=%s\n", count, parts[0], parts[1])
+	return nil
+}
+
+func main() {
+	flag.Parse()
+	if *flag_snapshot == "" {
+		log.Fatalf("Missing -snapshot <file>")
+	}
+	snapshot, err := loadSnapshot(*flag_snapshot)
+	if err != nil {
+		log.Fatalf("Failed to load snapshot: %v", err)
+	}
+
+	if *flag_at != "" {
+		at, err := parseInts(*flag_at, 2)
+		if err != nil {
+			log.Fatalf("Bad -at: %v", err)
+		}
+		if at[0] < 0 || at[0] >= snapshot.sizeI || at[1] < 0 || at[1] >= snapshot.sizeJ {
+			log.Fatalf("Cell (%d,%d) is outside the %dx%d grid", at[0], at[1], snapshot.sizeI, snapshot.sizeJ)
+		}
+		snapshot.printCell(os.Stdout, at[0], at[1])
+		return
+	}
+
+	if *flag_find != "" {
+		if err := snapshot.find(os.Stdout, *flag_find); err != nil {
+			log.Fatalf("Bad -find: %v", err)
+		}
+		return
+	}
+
+	i0, j0, i1, j1, err := snapshot.region(*flag_region)
+	if err != nil {
+		log.Fatalf("Bad -region: %v", err)
+	}
+	snapshot.render(os.Stdout, i0, j0, i1, j1, *flag_color)
+}
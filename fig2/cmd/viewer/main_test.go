@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fixture is a 4x3 snapshot with a small plaque: (1,1) BOTH, (2,1) VIRION, (1,2) DEAD,
+// (2,2) DIP, (3,0) ANTIVIRAL and (0,2) BOTH_CONTINUOUS around susceptible cells
+const fixture = "testdata/snapshot_25_hours.csv"
+
+// Function to load the fixture snapshot
+func loadFixture(t *testing.T) *Snapshot {
+	t.Helper()
+	s, err := loadSnapshot(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestLoadSnapshotFixture(t *testing.T) {
+	s := loadFixture(t)
+	if s.sizeI != 4 || s.sizeJ != 3 {
+		t.Fatalf("grid %dx%d, want 4x3", s.sizeI, s.sizeJ)
+	}
+	want := map[[2]int]int{{1, 1}: INFECTED_BOTH, {2, 1}: INFECTED_VIRION, {1, 2}: DEAD, {2, 2}: INFECTED_DIP, {3, 0}: ANTIVIRAL, {0, 2}: INFECTED_BOTH_CONTINUOUS}
+	for i := 0; i < s.sizeI; i++ {
+		for j := 0; j < s.sizeJ; j++ {
+			state, ok := want[[2]int{i, j}]
+			if !ok {
+				state = SUSCEPTIBLE
+			}
+			if s.state[i][j] != state {
+				t.Errorf("state(%d,%d) = %d, want %d", i, j, s.state[i][j], state)
+			}
+		}
+	}
+}
+
+func TestLoadSnapshotGzipMatchesPlain(t *testing.T) {
+	plain, err := ioutil.ReadFile(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write(plain)
+	gz.Close()
+	path := filepath.Join(t.TempDir(), "snapshot_25_hours.csv.gz")
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := loadSnapshot(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var a, b bytes.Buffer
+	s.render(&a, 0, 0, 3, 2, false)
+	loadFixture(t).render(&b, 0, 0, 3, 2, false)
+	if a.String() != b.String() {
+		t.Fatalf("gzip snapshot renders\n%s\nwant\n%s", a.String(), b.String())
+	}
+}
+
+func TestLoadSnapshotRejectsBadFiles(t *testing.T) {
+	cases := map[string]string{
+		"no cells":       "i,j,state\n",
+		"missing column": "i,j,localVirions\n0,0,1\n",
+		"bad row":        "i,j,state\n0,x,1\n",
+		"negative index": "i,j,state\n-1,0,1\n",
+	}
+	for name, content := range cases {
+		path := filepath.Join(t.TempDir(), "snapshot.csv")
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadSnapshot(path); err == nil {
+			t.Errorf("%s: loaded without error", name)
+		}
+	}
+}
+
+func TestRenderRegionWindow(t *testing.T) {
+	s := loadFixture(t)
+	i0, j0, i1, j1, err := s.region("2,2,1,1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	s.render(&out, i0, j0, i1, j1, false)
+	lines := strings.Split(out.String(), "\n")
+	want := []string{
+		"Region i=1..2, j=1..2 (grid 4x3)",
+		"   1 B V ",
+		"   2 # D ",
+	}
+	for k, line := range want {
+		if lines[k] != line {
+			t.Errorf("line %d = %q, want %q", k, lines[k], line)
+		}
+	}
+
+	out.Reset()
+	s.render(&out, 1, 1, 1, 1, true)
+	if !strings.Contains(out.String(), "\033[33mB"+ansiReset) {
+		t.Errorf("colored map has no yellow B for INFECTED_BOTH:\n%q", out.String())
+	}
+}
+
+func TestRegionBounds(t *testing.T) {
+	s := loadFixture(t)
+	if i0, j0, i1, j1, err := s.region(""); err != nil || i0 != 0 || j0 != 0 || i1 != 3 || j1 != 2 {
+		t.Errorf("empty region = %d,%d,%d,%d (%v), want the whole 4x3 grid", i0, j0, i1, j1, err)
+	}
+	for _, text := range []string{"0,0,4,2", "0,-1,1,1", "0,0,1", "a,0,1,1"} {
+		if _, _, _, _, err := s.region(text); err == nil {
+			t.Errorf("region %q accepted", text)
+		}
+	}
+}
+
+func TestPrintCellNamesStates(t *testing.T) {
+	s := loadFixture(t)
+	var out bytes.Buffer
+	s.printCell(&out, 1, 2)
+	for _, want := range []string{"Cell (1,2):", "state                    2 (DEAD)", "previousState            1 (INFECTED_VIRION)", "timeSinceDead            2"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("printCell output lacks %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestFindByStateNameAndField(t *testing.T) {
+	s := loadFixture(t)
+	cases := []struct {
+		query string
+		want  string
+	}{
+		{"state=INFECTED_BOTH", "(1,1)\n1 cells with state=INFECTED_BOTH\n"},
+		{"state=infected_both_continuous", "(0,2)\n1 cells with state=infected_both_continuous\n"},
+		{"localDips=30", "(1,1)\n(2,2)\n2 cells with localDips=30\n"},
+	}
+	for _, c := range cases {
+		var out bytes.Buffer
+		if err := s.find(&out, c.query); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != c.want {
+			t.Errorf("find %q printed %q, want %q", c.query, out.String(), c.want)
+		}
+	}
+	for _, query := range []string{"state", "noSuchField=1"} {
+		if err := s.find(&bytes.Buffer{}, query); err == nil {
+			t.Errorf("find %q accepted", query)
+		}
+	}
+}
@@ -16,14 +16,17 @@ package main
 
 import (
 	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/binary"
 	"encoding/csv"
+	"encoding/gob"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-	"image"
-	"image/color"
-	"image/draw"
-	"image/jpeg"
-	"image/png"
+	"io"
 	"io/ioutil"
 	"log"
 	"math"
@@ -32,16 +35,15 @@ import (
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"runtime/debug"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"unsafe"
 
-	"github.com/icza/mjpeg"
-	"github.com/wcharczuk/go-chart/v2" // Used for plotting the graph
-	"github.com/wcharczuk/go-chart/v2/drawing"
-	"golang.org/x/image/font"
-	"golang.org/x/image/font/basicfont"
-	"golang.org/x/image/math/fixed"
+	"github.com/yimei-li/spatial-dynamics/plotprofile"
 )
 
 // Constant definitions
@@ -77,29 +79,95 @@ var (
 	flag_tau              = flag.Int("tau", 12, "TAU value (e.g., lysis time)")
 	flag_ifnBothFold      = flag.Float64("ifnBothFold", 1.0, "Fold effect for IFN stimulation")
 	flag_rho              = flag.Float64("rho", 0.026, "Infection rate constant")
-	flag_virion_half_life = flag.Float64("virion_half_life", 3.2, "Virion clearance rate (e.g., 3.2 d^-1)")
-	flag_dip_half_life    = flag.Float64("dip_half_life", 3.2, "DIP clearance rate (e.g., 3.2 d^-1)")
-	flag_ifn_half_life    = flag.Float64("ifn_half_life", 4.0, "IFN clearance rate (e.g., 3.0 d^-1)")
-	flag_option           = flag.Int("option", 2, "Option for infection initialization (e.g., 1, 2, 3)")
+	flag_virion_half_life = newHalfLifeFlag("virion_half_life", 3.2, "Virion half-life, e.g. 3.2h, 45m, 0.5d, or a clearance rate such as 4/d (bare number = hours, deprecated)")
+	flag_dip_half_life    = newHalfLifeFlag("dip_half_life", 3.2, "Mean DIP half-life, e.g. 3.2h, or a clearance rate such as 4/d (bare number = hours, deprecated)")
+	flag_ifn_half_life    = newHalfLifeFlag("ifn_half_life", 4.0, "IFN half-life, e.g. 4h, or a clearance rate such as 4/d (bare number = hours, deprecated)")
+	flag_option           = flag.Int("option", 2, "Option for infection initialization (e.g., 1, 2, 3, or 5 for the -foci list)")
 	flag_burstRadius      = flag.Int("burstRadius", 3, "Burst radius (number of neighbor circles) - Controls how far virions and DIPs spread from infected cells")
 
+	// Per-cell susceptibility: lognormal multiplier (mean 1) of the virion infection chance, sampled at initialization
+	flag_susceptibilityCV = flag.Float64("susceptibilityCV", 0.0, "Coefficient of variation of the per-cell lognormal susceptibility multiplier on RHO for virions (0 = every cell 1.0)")
+	// Per-cell RHO field: constant, or lognormal with the realized mean rescaled to RHO (alternative to -susceptibilityCV)
+	flag_rhoDistribution = flag.String("rhoDistribution", "constant", "Per-cell RHO distribution: constant, or lognormal:sigma=S (log-scale sigma; the sampled field is rescaled so its mean is exactly RHO)")
+	flag_rhoOnRegrowth   = flag.String("rhoOnRegrowth", "keep", "Per-cell RHO of a regrown cell: keep (the dead cell's value) or resample (a new draw, with the initial rescaling)")
+
+	// Grid boundary: open/absorbing drops neighbors outside the grid, periodic wraps them (torus)
+	flag_boundary = flag.String("boundary", "open", "Grid boundary: open or absorbing (neighbors outside the grid are dropped and released particles are renormalized over the in-grid cells) or periodic (indices wrap modulo GRID_SIZE)")
+
+	// Initial infection cell for options 1, 2 and 4 (-1 keeps the option's default position)
+	flag_focusX = flag.Int("focusX", -1, "Row of the initially infected cell (0..GRID_SIZE-1) for options 1, 2 and 4; -1 uses the option default")
+	flag_focusY = flag.Int("focusY", -1, "Column of the initially infected cell (0..GRID_SIZE-1) for options 1, 2 and 4; -1 uses the option default")
+
+	// Infection foci for option 5, each with its own virion and DIP load
+	flag_foci = flag.String("foci", "", "Infection foci for option 5: semicolon-separated \"x,y,v,d\" tuples (row, column, v_pfu, d_pfu), e.g. \"20,20,10,0;80,90,10,50\", or a JSON array of {\"x\",\"y\",\"v\",\"d\"} objects; DIPs spread over -dipInitRange when > 0")
+
 	// Case 4 continuous production mode parameters
 	flag_continuousMode             = flag.Bool("continuousMode", false, "Enable continuous production mode for case 4")
 	flag_continuousProductionRateV  = flag.Int("continuousProductionRateV", 50, "Virion production rate per timestep for case 4 continuous mode")
 	flag_continuousProductionRateD  = flag.Int("continuousProductionRateD", 25, "DIP production rate per timestep for case 4 continuous mode")
 	flag_continuousIncubationPeriod = flag.Int("continuousIncubationPeriod", 6, "Hours before cells start producing (case 4 continuous mode)")
 	flag_continuousLysisTime        = flag.Float64("continuousLysisTime", 20.0, "Lysis time for continuous production cells")
+	flag_continuousIncubationCV     = flag.Float64("continuousIncubationCV", 0.0, "Coefficient of variation of the per-cell incubation period (0 = same for every cell)")
+	flag_continuousLysisCV          = flag.Float64("continuousLysisCV", 0.0, "Coefficient of variation of the per-cell continuous lysis time (0 = same for every cell)")
+	flag_continuousRadius           = flag.Int("continuousRadius", -1, "Release radius (neighbor circles) for continuous production; -1 uses burstRadius")
+
+	// Infection model: bernoulli infects with probability 1-(1-p)^n per particle type, poisson draws
+	// how many particles enter the cell and infects when at least one does
+	flag_infectionModel = flag.String("infectionModel", "bernoulli", "Infection model: bernoulli (1-(1-p)^n per particle type) or poisson (Poisson(p*n) virions and Poisson(lambdaDip*p*n) DIPs enter; a type infects when >= 1 enters)")
+	flag_lambdaDip      = flag.Float64("lambdaDip", 30.0, "Poisson distribution lambda parameter for DIP infection: multiplier on the mean DIP entries under -infectionModel=poisson (1 = same mean as bernoulli, 0 = no DIP infection)")
+
+	// Burst size model: fixed keeps BURST_SIZE_V and the ratio-adjusted BURST_SIZE_D, competition splits
+	// the burst by the intracellular WT and DVG genomes the cell took up
+	flag_burstModel       = flag.String("burstModel", "fixed", "Burst size model: fixed or competition (BURST_SIZE_V*intraWT/(intraWT+c*intraDVG) virions, BURST_SIZE_D*intraDVG/(intraWT+intraDVG) DIPs)")
+	flag_burstCompetition = flag.Float64("burstCompetition", 1.0, "Competition factor c of DVG genomes in the -burstModel=competition virion burst")
+	flag_burstLog         = flag.Bool("burstLog", false, "Write bursts.csv with the intracellular WT/DVG counts and the realized virion/DIP burst of every lysis")
+
+	// Infection lineage: generation and parent release of every infection (also tracked for -videotype=generations)
+	flag_lineage = flag.Bool("lineage", false, "Write lineage.csv with the generation and attributed parent cell of every new infection, and reff_cohort.csv with the cohort R_eff")
+
+	// Media flow: released particles drift toward driftAngle (0 = increasing i, right in the frames; 90 = increasing j, down)
+	flag_driftAngle    = flag.Float64("driftAngle", 0, "Direction of particle drift in degrees (0 = toward increasing i, right in the video frames; 90 = toward increasing j, down)")
+	flag_driftStrength = flag.Float64("driftStrength", 0, "Drift bias 0-1: each receiving cell's kernel weight is multiplied by 1 + driftStrength*cos(bearing - driftAngle) (0 = isotropic)")
 
-	// DIP infection probability parameter
-	flag_lambdaDip = flag.Float64("lambdaDip", 30.0, "Poisson distribution lambda parameter for DIP infection probability")
+	// Particle distribution kernel of the burst, continuous production and partition paths
+	flag_burstKernel = flag.String("burstKernel", "auto", "Ring weight kernel for releasing particles: auto (each path's own: inverseEuclid for bursts, hexInverse15 for continuous production, legacySqrt3 for partition), inverseEuclid (1/(r+0.1)), hexInverse15 (1/r^1.5) or legacySqrt3 (1 : 1/2 : 1/sqrt3 on rings 1-3)")
+
+	// Fractional inoculum: seed floor(pfu) particles plus one more with probability frac(pfu)
+	flag_probabilisticSeed = flag.Bool("probabilisticSeed", false, "Treat fractional v_pfu_initial/d_pfu_initial as a probability of one extra particle instead of rounding")
 
 	flag_v_pfu_initial = flag.Float64("v_pfu_initial", 1.0, "Initial PFU count for virions")
 	flag_d_pfu_initial = flag.Float64("d_pfu_initial", 0.0, "Initial PFU count for DIPs")
-	flag_videotype     = flag.String("videotype", "states", "Video type: states, IFNconcentration, IFNonlyLargerThanZero, antiviralState, particles, baltes")
+	flag_videotype     = flag.String("videotype", "states", "Video type: states, IFNconcentration, IFNonlyLargerThanZero, antiviralState, particles, baltes, isochrone, generations, viralTiterLog, susceptibility")
+	flag_titerColorMax = flag.Float64("titerColorMax", 3.0, "log10(virions) at the top of the viralTiterLog colormap, fixed so frames are comparable (3 = 1000 virions)")
 	// Exposure mask (baltes-only): fraction of area treated as non-exposed (uniformly sampled)
 	flag_unexposedAreaFraction = flag.Float64("unexposedAreaFraction", 0.0, "Fraction [0-1] of area treated as non-exposed/uninfectable (baltes-only; uniform)")
+	flag_maskSeed              = flag.Int64("maskSeed", -1, "Seed of the exposure mask's own random stream (-1 derives it from -randomSeed); the mask never draws from the simulation stream")
 	// Visualization-only overlay (baltes-only): fraction of cells drawn as black, without affecting simulation state
-	flag_unexposedSetAreaFraction = flag.Float64("unexposedSetAreaFraction", 0.0, "Fraction [0-1] of cells visually overlaid as black in baltes rendering (display-only)")
+	flag_unexposedSetAreaFraction = flag.Float64("unexposedSetAreaFraction", 0.0, "Fraction [0-1] of cells visually overlaid as black in rendered frames (display-only, same cells in every frame)")
+
+	// Measurement overlay: cell-coordinate ruler along top/left edges plus a scale bar
+	flag_drawRuler   = flag.Bool("drawRuler", false, "Overlay tick marks/labels (cell units) along the top and left edges and a scale bar on rendered frames")
+	flag_cellMicrons = flag.Float64("cellMicrons", 0.0, "Cell center-to-center distance in µm for ruler/scale bar labels (0 = label in cell units only)")
+
+	// Talk overlay on the video frames: elapsed time and a round-length scale bar (µm with -cellMicrons)
+	flag_overlay = flag.Bool("overlay", false, "Draw a \"t = N h\" label and a scale bar (snapped to a round number of µm with -cellMicrons, of cells otherwise) on the video frames")
+
+	// Antialiasing: render grid frames at N x resolution and box-downsample (1 = single sample, as before)
+	flag_supersample = flag.Int("supersample", 1, "Supersampling factor N for grid frames: render at N x resolution and box-downsample (1 = off)")
+
+	// Publication export for the selected-frame PNGs only (video frames keep the fast path)
+	flag_snapshotScale = flag.Int("snapshotScale", 1, "Render the selected-frame PNGs at N x resolution (1 = same as the video frames)")
+	flag_antialias     = flag.Bool("antialias", false, "Box-downsample the -snapshotScale render back to frame size for smooth hexagon edges (needs snapshotScale >= 2)")
+	flag_cellBorders   = flag.Bool("cellBorders", false, "Draw thin cell borders on the selected-frame PNGs (readable on small grids)")
+	flag_renderFormat  = flag.String("renderFormat", "png", "Selected-frame image format: png, or svg for vector frames (one polygon per cell; -snapshotScale and -antialias do not apply)")
+
+	// Animated GIF of the video frames (shareable in issues and slides)
+	flag_gifOutput = flag.Bool("gifOutput", false, "Also write the video frames to video.gif in the output folder")
+	flag_gifDelay  = flag.Int("gifDelay", 100/FRAME_RATE, "Delay between video.gif frames in 1/100 s")
+
+	// State color palette of the states, particles and baltes videotypes and the legend
+	flag_palette     = flag.String("palette", "default", "State color palette: default, cividis or okabe-ito (colorblind-safe)")
+	flag_paletteFile = flag.String("paletteFile", "", "JSON file mapping state names or constants to hex colors, e.g. {\"INFECTED_VIRION\": \"#D55E00\", \"5\": \"#009E73\"}, applied over -palette (empty = none)")
 
 	// New experimental parameters for viral particle removal
 	flag_enableParticleRemoval = flag.Bool("enableParticleRemoval", false, "Enable removal of viral particles outside IFN range")
@@ -113,9 +181,160 @@ var (
 	// Random seed parameter
 	flag_randomSeed = flag.Int64("randomSeed", -1, "Random seed for reproducible results (-1 for random seed based on time)")
 
+	// Minimum local particles (virions + DIPs) before a cell is evaluated for infection
+	flag_minInfectiousParticles = flag.Int("minInfectiousParticles", 1, "Minimum local virions+DIPs required to attempt infection of a cell (1 = any particle)")
+
+	// IFN protection of the per-particle infection chance: exp(-ALPHA*IFN) or a saturating Hill
+	// factor 1 - IFN^n/(K^n + IFN^n). IFN is the regional (local IFN) or global per-cell
+	// concentration the infection draw sees, divided by R for virions when VStimulateIFN
+	flag_ifnResponse = flag.String("ifnResponse", "exp", "IFN protection of the infection chance: exp (RHO*exp(-ALPHA*IFN)) or hill (RHO*(1 - IFN^n/(K^n+IFN^n)), ALPHA and the per-type alphas unused)")
+	flag_ifnHillK    = flag.Float64("ifnHillK", 1.0, "Hill half-protection IFN level K, in the IFN units of the infection draw (per-cell concentration, R-normalized for virions when VStimulateIFN)")
+	flag_ifnHillN    = flag.Float64("ifnHillN", 1.0, "Hill coefficient n of -ifnResponse=hill")
+
+	// IFN sensitivity of the per-particle infection chance, per particle type (exp response)
+	flag_virionIfnAlpha = flag.Float64("virionIfnAlpha", -1, "IFN sensitivity alpha of the virion infection chance RHO*exp(-alpha*IFN) (-1 = ALPHA)")
+	flag_dipIfnAlpha    = flag.Float64("dipIfnAlpha", -1, "IFN sensitivity alpha of the DIP infection chance RHO*exp(-alpha*IFN) (-1 = ALPHA); DIPs see the IFN level undivided by R, also when R or TAU is 0")
+
+	// Which states may enter the antiviral pathway (comma-separated state names)
+	flag_antiviralEligibleStates = flag.String("antiviralEligibleStates", "SUSCEPTIBLE,REGROWTH,INFECTED_DIP,INFECTED_DIP_CONTINUOUS", "States that can become ANTIVIRAL (subset of SUSCEPTIBLE,REGROWTH,INFECTED_DIP,INFECTED_DIP_CONTINUOUS); use SUSCEPTIBLE,REGROWTH for uninfected cells only")
+
+	// Antiviral refractory model: when the commitment timer advances, and how long ANTIVIRAL lasts
+	flag_antiviralCommitModel  = flag.String("antiviralCommitModel", "legacy", "Antiviral commitment: legacy (the timer advances while the cell has any IFN) or ifnDependent (only while the IFN level of the infection draw is >= antiviralIFNThreshold)")
+	flag_antiviralIFNThreshold = flag.Float64("antiviralIFNThreshold", 0.0005, "IFN level (regional average for local IFN, globalIFNperCell for global) needed to advance the commitment timer under -antiviralCommitModel=ifnDependent")
+	flag_antiviralDuration     = flag.Float64("antiviralDuration", 0, "Mean hours a cell stays ANTIVIRAL before reverting (0 = permanent)")
+	flag_antiviralDurationStd  = flag.Float64("antiviralDurationStd", 0, "Standard deviation in hours of -antiviralDuration")
+	flag_antiviralExitState    = flag.String("antiviralExitState", "SUSCEPTIBLE", "State an ANTIVIRAL cell reverts to after -antiviralDuration: SUSCEPTIBLE or REGROWTH")
+
+	// Co-infection lysis delay: DIP co-infection of a virion-infected cell postpones its lysis
+	flag_coinfectionLysisDelay = flag.Float64("coinfectionLysisDelay", 0.0, "Hours added to the lysis threshold when an INFECTED_VIRION cell becomes INFECTED_BOTH (0 = no effect)")
+	flag_coinfectionLysisReset = flag.Bool("coinfectionLysisReset", false, "If true, restart the lysis timer when an INFECTED_VIRION cell becomes INFECTED_BOTH")
+
+	// Eclipse phase: burst-mode virion/both infected cells neither lyse nor stimulate IFN until it has passed
+	flag_eclipsePeriod = flag.Float64("eclipsePeriod", 0.0, "Mean eclipse period in hours, sampled per cell: an INFECTED_VIRION/INFECTED_BOTH cell cannot lyse or stimulate IFN until this long after infection (0 = off)")
+	flag_eclipseStd    = flag.Float64("eclipseStd", 0.0, "Standard deviation in hours of the per-cell eclipse period (normal, truncated at 0)")
+
+	// Superinfection exclusion: a freshly infected cell resists co-infection for a while
+	flag_superinfectionExclusionHours = flag.Float64("superinfectionExclusionHours", 0.0, "Hours after a cell's infection during which it cannot be co-infected (INFECTED_VIRION -> INFECTED_BOTH by DIPs, INFECTED_DIP -> INFECTED_BOTH by virions; 0 = off)")
+
+	// Immune-cell agents (e.g. macrophages): walk toward IFN and clear the infected cells they land on
+	flag_numImmuneCells = flag.Int("numImmuneCells", 0, "Number of mobile immune cells placed on random cells at the start (0 = off)")
+	flag_immuneKillProb = flag.Float64("immuneKillProb", 0.5, "Probability that an immune cell landing on an INFECTED_* cell kills it (DEAD, without a burst)")
+	flag_immuneIFNBias  = flag.Float64("immuneIFNBias", 1.0, "Chemotaxis strength: an immune cell steps to a neighbor with local IFN c with weight 1 + immuneIFNBias*c (0 = unbiased walk)")
+
+	// Particle conservation check: warn whenever released particles cannot be distributed to neighbors
+	flag_conservationCheck = flag.Bool("conservationCheck", false, "Log a mass-loss warning whenever released particles have no neighbors to go to")
+	flag_strict            = flag.Bool("strict", false, "Sum the lattice particles around every release and stop the run (exit code 6) if the change differs from the released virions/DIPs")
+
+	// Which cells of a release footprint receive particles; the shares of the others go to the eligible cells
+	flag_depositPolicy = flag.String("depositPolicy", "all", "Cells that receive released particles: all (every cell in range), live (all but DEAD) or susceptible (SUSCEPTIBLE only); skipped shares are redistributed over the eligible cells by the kernel")
+
+	// Adsorption: per-hour probability that a particle on an infected or dead cell is bound and removed without effect
+	flag_adsorptionVirion = flag.Float64("adsorptionVirion", 0.0, "Per-hour probability [0-1] that a virion on an INFECTED_*/DEAD cell is adsorbed (removed); 0 = off")
+	flag_adsorptionDIP    = flag.Float64("adsorptionDIP", 0.0, "Per-hour probability [0-1] that a DIP on an INFECTED_*/DEAD cell is adsorbed (removed); 0 = off")
+
+	// Plaque counting: whether REGROWTH cells still belong to the plaque they regrew in
+	flag_plaqueIncludeRegrowth = flag.Bool("plaqueIncludeRegrowth", false, "Count REGROWTH cells as part of a plaque (connected DEAD cells) in the plaque CSV columns and plaques.csv")
+	flag_plaquesEvery          = flag.Int("plaquesEvery", 0, "Write plaques.csv with one row per plaque (size, centroid, extent) every N frames (0 = off)")
+
+	// Regrowth of DEAD cells: a per-death timer, or division pressure from the live cells around them
+	flag_regrowthModel    = flag.String("regrowthModel", "timer", "Regrowth of DEAD cells: timer (after a Normal(REGROWTH_MEAN, REGROWTH_STD) delay drawn once per death, next to a SUSCEPTIBLE/ANTIVIRAL cell) or edgePressure (each hour with probability 1-(1-regrowthEdgeRate)^n, n = SUSCEPTIBLE/ANTIVIRAL/REGROWTH neighbors)")
+	flag_regrowthEdgeRate = flag.Float64("regrowthEdgeRate", 0.02, "Per-neighbor hourly regrowth probability [0-1] of -regrowthModel=edgePressure")
+
+	// Regrowth maturation: REGROWTH cells become SUSCEPTIBLE after a normally distributed time
+	flag_regrowthMaturationTime = flag.Float64("regrowthMaturationTime", 0, "Mean hours a cell stays REGROWTH before it matures to SUSCEPTIBLE (0 = stays REGROWTH)")
+	flag_regrowthMaturationStd  = flag.Float64("regrowthMaturationStd", 0, "Standard deviation in hours of -regrowthMaturationTime")
+
+	// Radial profile around the infection focus (state fractions, IFN and particles per hex ring)
+	flag_radialEvery = flag.Int("radialEvery", 0, "Write radial_profile.csv with one row per hex ring around the infection focus every N frames (0 = off)")
+
+	// Warm-up phase: frames before this many hours are simulated and recorded but excluded from summary endpoints
+	flag_burnIn = flag.Int("burnIn", 0, "Warm-up period in hours; earlier frames are flagged in the CSV and excluded from summary.json endpoints and the replicate aggregate")
+
+	// Same-frame infection: "forbid" makes particles released in frame t infectious from frame t+1 only
+	flag_sameFrameInfection = flag.String("sameFrameInfection", "forbid", "Whether particles released during a frame can infect in that same frame: forbid (min generation time 1 step) or allow (legacy)")
+
+	// DIP-only persistence: "persist" keeps DIP-only cells infected indefinitely (long-term DVG reservoirs)
+	flag_dipPersistence = flag.String("dipPersistence", "clear", "DIP-only infected cells: clear (recover to SUSCEPTIBLE after the DVG recovery / DIP clearance timers) or persist (never cleared; still stimulate IFN, can become BOTH or ANTIVIRAL)")
+
+	// DIP-only clearance: which clock returns a DIP-only cell to SUSCEPTIBLE. "both" runs the
+	// dipClearanceMean/Std clock and the dvgRecoveryTime clock side by side and the earlier one wins.
+	flag_dipClearanceModel = flag.String("dipClearanceModel", "both", "DIP-only clearance clock: fixedNormal (Normal(dipClearanceMean, dipClearanceStd) steps), recoveryTime (Normal(dvgRecoveryTime, dvgRecoveryTime/3) steps) or both (earlier of the two, legacy)")
+	flag_dipClearanceMean  = flag.Float64("dipClearanceMean", 2.0, "Mean steps from DIP-only infection to clearance in the fixedNormal clock")
+	flag_dipClearanceStd   = flag.Float64("dipClearanceStd", 1.0, "Standard deviation of the fixedNormal clearance clock (0 = exactly dipClearanceMean steps)")
+
+	// IFN responsiveness: fraction of cells that can become ANTIVIRAL (the rest ignore IFN for antiviral entry)
+	flag_ifnResponderFraction = flag.Float64("ifnResponderFraction", 1.0, "Fraction of cells that respond to IFN; a random 1-f of cells, fixed at initialize, never become ANTIVIRAL (1 = all respond)")
+
+	// Partition mode semantics: split every burst by k_JumpR, or send whole bursts of a k_JumpR fraction of lysing cells
+	flag_partitionSemantics = flag.String("partitionSemantics", "perBurst", "particleSpreadOption=partition: perBurst (each burst sends floor(kJumpR*burst) particles to random cells) or perCell (a kJumpR fraction of lysing cells jump their whole burst, the rest spread locally)")
+
+	// Regional IFN sum over the IFN_wave_radius mask: direct loop or row prefix sums (for validating the optimization)
+	flag_ifnComputeMethod = flag.String("ifnComputeMethod", "direct", "Regional IFN computation: direct (sum every cell in the mask) or summedarea (per-row prefix sums over the same circular mask)")
+
+	// Infection probability lookup: cache (1-p)^n for n up to this bound per distinct p within a frame
+	flag_powCacheBound = flag.Int("powCacheBound", 64, "Largest particle count n whose (1-p)^n is memoized per frame (0 = always call math.Pow); output is identical either way")
+
+	// Batch mode: skip frames, graphs, PNGs and the video, and the per-cell trace output
+	flag_render = flag.Bool("render", true, "Draw frames, the infection graph, PNGs and the video, and print per-cell trace output; false writes only the CSV, snapshot and summary outputs and the source copy")
+
+	// Goroutines for the regional IFN pass and the uninfected-cell sweep
+	flag_workers = flag.Int("workers", 0, "Goroutines computing the per-cell regional IFN averages and sweeping the uninfected cells each frame (0 = runtime.NumCPU(), 1 = serial); output is identical either way")
+
+	// Warmup-then-perturb protocol: run warmupSteps frames under the base config, then apply -perturb once
+	flag_warmupSteps = flag.Int("warmupSteps", 0, "Frames run under the base configuration before the -perturb changes are applied (0 = no protocol)")
+	flag_perturb     = flag.String("perturb", "", "Changes applied at frame warmupSteps, e.g. rho=0.05,burstSizeD=200,virion_half_life=2h,ifn_half_life=8h,injectDIPs=5000,injectVirions=100")
+
+	// Exogenous DIP doses added to the supernatant during the run
+	flag_dipDose = flag.String("dipDose", "", "Semicolon-separated DIP doses, e.g. \"t=12:count=5000:mode=uniform;t=24:count=2000:mode=hotspot:x=60:y=60:radius=5\"; uniform spreads over all cells, hotspot weights by 1/(distance+0.1) within radius; -depositPolicy applies")
+
+	// Washout / media change: removes free particles everywhere, independent of IFN
+	flag_washout = flag.String("washout", "", "Semicolon-separated washout events removing extracellular particles at the end of hour t, e.g. \"t=1:virionFraction=1.0:dipFraction=1.0\"; each cell keeps (1-fraction) of its particles, rounded stochastically")
+
+	// Time windows for particle AUC (supernatant titration analog), e.g. "0-24,24-48"
+	flag_aucWindows = flag.String("aucWindows", "", "Comma-separated hour windows start-end for the AUC of extracellular and of released virions/DIPs, e.g. 0-24,24-48 (empty = off)")
+
+	// Per-cell grid dumps (snapshot_<t>_hours.csv) only at these hours, e.g. the experimental timepoints
+	flag_dumpStatesAt  = flag.String("dumpStatesAt", "7,13,19,25", "Comma-separated hours at which to write the full per-cell grid as snapshot_<t>_hours.csv; all = every frame, empty = none")
+	flag_snapshotEvery = flag.Int("snapshotEvery", 0, "Also write a per-cell snapshot every N frames, starting at frame 0 (0 = only the -dumpStatesAt hours)")
+	flag_snapshotGzip  = flag.Bool("snapshotGzip", false, "Write snapshots gzip-compressed as snapshot_<t>_hours.csv.gz")
+
+	// Binary field dump: state, particles and IFN of every cell, one .npy record per sampled frame
+	flag_dumpField = flag.Int("dumpField", 0, "Write field.npy (np.load-able) with the state, localVirions, localDips and IFNConcentration grids every N frames, starting at frame 0 (0 = off)")
+
+	// Checkpoint/resume: full simulation state as checkpoint_<t>_hours.gob, resumable (or branched) later
+	flag_checkpointEvery = flag.Int("checkpointEvery", 0, "Write a checkpoint_<t>_hours.gob after every N frames (0 = off)")
+	flag_resumeFrom      = flag.String("resumeFrom", "", "Resume from a checkpoint file; the run continues at the frame after it with the checkpoint's seed (parameters come from the flags) and its CSVs start with the earlier rows of the run next to the checkpoint")
+
+	// DIP advantage mini-sweep: one run for each burstSizeD/burstSizeV ratio
+	flag_dipAdvantageSweep = flag.String("dipAdvantageSweep", "", "Comma-separated DIP advantages (burstSizeD/burstSizeV) to sweep at fixed burstSizeV, e.g. 0,0.5,1,2,4 (empty = single run)")
+	flag_sweepReplicates   = flag.Int("sweepReplicates", 3, "Replicates per DIP advantage value in -dipAdvantageSweep")
+
+	// Replicate driver: runs with seeds randomSeed+i and aggregate the curves
+	flag_replicates     = flag.Int("replicates", 0, "Run N replicates with seeds randomSeed+i (each in its own subfolder) and write aggregate_summary.csv (0 = single run)")
+	flag_parallel       = flag.Int("parallel", 1, "Replicates run at the same time in -replicates mode")
+	flag_retryFailed    = flag.Bool("retryFailed", false, "Run each failed replicate once more with a fresh seed (randomSeed+replicates+i) in replicate_<i>_retry")
+	flag_memoryBudgetMB = flag.Int("memoryBudgetMB", 0, "Memory budget in MB for the replicates running at once; -parallel is lowered to fit the per-replicate estimate (0 = no limit)")
+
+	// Global sweep: one run at each of sweepN Latin-hypercube points of the -sweepRanges box
+	flag_sweepMode   = flag.String("sweepMode", "", "Global parameter sweep: lhs (Latin hypercube over -sweepRanges, sampled with -randomSeed; empty = single run)")
+	flag_sweepN      = flag.Int("sweepN", 100, "Samples in -sweepMode=lhs")
+	flag_sweepRanges = flag.String("sweepRanges", "", "Comma-separated name:min:max ranges of numeric flags for -sweepMode, e.g. rho:0.01:0.1,burstSizeV:20:100")
+
+	// Scenario regression pack: paired runs checking the qualitative claims of the thesis
+
+	// Baseline comparison: diff this run's CSV and summary against an earlier run folder at the end
+	flag_baseline          = flag.String("baseline", "", "Run folder to compare against at the end of the run (writes baseline_diff.json; empty = off)")
+	flag_baselineTolerance = flag.Float64("baselineTolerance", 1e-9, "Values differ when |a-b| > tol*max(1,|a|,|b|)")
+	flag_failOnDivergence  = flag.Bool("failOnDivergence", false, "Exit with status 1 when the run diverges from -baseline")
+
 	// DIP radius parameter
 	flag_dipRadius = flag.Int("dipRadius", 10, "Absolute DIP spread radius for bursts (cells)")
 
+	// DIP burst footprint: the full disk of dipRadius, or only the rings dipInnerRadius..dipOuterRadius
+	flag_dipBurstShape  = flag.String("dipBurstShape", "disk", "DIP burst footprint: disk (rings 1..dipRadius) or annulus (rings dipInnerRadius..dipOuterRadius only)")
+	flag_dipInnerRadius = flag.Int("dipInnerRadius", 1, "Innermost ring receiving DIPs under -dipBurstShape=annulus")
+	flag_dipOuterRadius = flag.Int("dipOuterRadius", -1, "Outermost ring receiving DIPs under -dipBurstShape=annulus (-1 = dipRadius)")
+
 	// Restrict DIPs to the initial fixed hotspot only (no DIP production anywhere)
 	flag_dipRestrictToHotspot = flag.Bool("dipRestrictToHotspot", false, "If true, disable all DIP release during bursts; DIPs only exist at the initial fixed hotspot")
 
@@ -126,8 +345,121 @@ var (
 
 	// Initial DIP seeding range (case 4). If >=0, sample from mean=M with range [M - M/4, M + M/4], sd=M/8; if <0, falls back per rules
 	flag_dipInitRange = flag.Int("dipInitRange", -1, "Target initial DIPs at hotspot (case 4). Draw from [M-M/4, M+M/4] with sd=M/8; set to -1 to disable")
+
+	// Local IFN transport: instant spread over IFN_wave_radius, or explicit hex-lattice diffusion
+	flag_ifnModel          = flag.String("ifnModel", "spread", "Local IFN transport (-ifnSpreadOption=local): spread (secretion shared instantly over IFN_wave_radius, cells read the regional average) or diffusion (secretion stays on the producing cell, the field diffuses on the hex lattice with -ifnDiffusionCoeff, cells read their own concentration)")
+	flag_ifnDiffusionCoeff = flag.Float64("ifnDiffusionCoeff", 1.0, "IFN diffusion coefficient D_IFN in cell spacings^2 per hour for -ifnModel=diffusion (profile variance grows by 2*D_IFN per hour and axis)")
+
+	// Local IFN decay: once per time step, or the legacy per-cell repetition for reproducing old runs
+	flag_ifnDecay = flag.String("ifnDecay", "perStep", "Local IFN half-life decay (ifnWave): perStep (once per time step) or perCell (legacy: repeated for every traversed cell, up to GRID_SIZE^2 times per step; all runs before this option; not with -ifnModel=diffusion)")
+
+	// Parameter file: every flag can be given in a JSON object instead of on the command line
+	flag_config = flag.String("config", "", "JSON file of flag values, e.g. {\"burstSizeV\": 50, \"ifnSpreadOption\": \"local\"}; flags on the command line override it (empty = none)")
+
+	// Infection graph y-axis override
+	flag_yMax = flag.Float64("yMax", 0, "Y-axis maximum of the infection graph (0 = look up from the IFN radius/TAU/jump mode profile table, auto-scale if none matches)")
 )
 
+// HalfLife is a flag value for clearance parameters. The canonical internal value is
+// the half-life in hours. Accepted inputs:
+//
+//	"4.2h", "45m", "0.5d"  half-life with a unit
+//	"4/d", "0.2/h"         first-order clearance rate k, converted with t½ = ln2/k
+//	"3.2"                  bare number, read as hours (legacy, prints a deprecation warning)
+type HalfLife struct {
+	Name   string  // flag name, for messages
+	Raw    string  // value as given on the command line (or the default)
+	Hours  float64 // canonical half-life in hours
+	Legacy bool    // true if Raw was a bare number without a unit
+}
+
+func newHalfLifeFlag(name string, defaultHours float64, usage string) *HalfLife {
+	h := &HalfLife{Name: name, Raw: strconv.FormatFloat(defaultHours, 'f', -1, 64) + "h", Hours: defaultHours}
+	flag.Var(h, name, usage)
+	return h
+}
+
+func (h *HalfLife) String() string {
+	if h == nil {
+		return ""
+	}
+	return h.Raw
+}
+
+func (h *HalfLife) Set(text string) error {
+	hours, legacy, err := parseHalfLife(text)
+	if err != nil {
+		return err
+	}
+	h.Raw, h.Hours, h.Legacy = text, hours, legacy
+	if legacy {
+		fmt.Printf("⚠️  -%s=%s has no unit; assuming a half-life in hours (write %sh, or a rate such as 4/d)\n", h.Name, text, text)
+	}
+	return nil
+}
+
+// Function to parse a half-life or clearance rate into a half-life in hours
+func parseHalfLife(text string) (hours float64, legacy bool, err error) {
+	text = strings.TrimSpace(text)
+	if slash := strings.Index(text, "/"); slash >= 0 {
+		k, err := strconv.ParseFloat(strings.TrimSpace(text[:slash]), 64)
+		if err != nil {
+			return 0, false, fmt.Errorf("bad rate %q", text)
+		}
+		unitHours, ok := unitToHours(strings.TrimSpace(text[slash+1:]))
+		if !ok {
+			return 0, false, fmt.Errorf("unknown rate unit in %q (use /h, /m or /d)", text)
+		}
+		if k <= 0 {
+			return 0, false, fmt.Errorf("clearance rate must be positive, got %q", text)
+		}
+		return rateToHalfLifeHours(k / unitHours), false, nil
+	}
+
+	for _, suffix := range []string{"h", "m", "d"} {
+		if strings.HasSuffix(text, suffix) {
+			value, err := strconv.ParseFloat(strings.TrimSuffix(text, suffix), 64)
+			if err != nil || value < 0 {
+				return 0, false, fmt.Errorf("bad half-life %q", text)
+			}
+			unitHours, _ := unitToHours(suffix)
+			return value * unitHours, false, nil
+		}
+	}
+
+	value, err := strconv.ParseFloat(text, 64)
+	if err != nil || value < 0 {
+		return 0, false, fmt.Errorf("bad half-life %q", text)
+	}
+	return value, true, nil
+}
+
+// Function to convert a time unit suffix into hours
+func unitToHours(unit string) (float64, bool) {
+	switch unit {
+	case "m":
+		return 1.0 / 60.0, true
+	case "h":
+		return 1.0, true
+	case "d":
+		return 24.0, true
+	}
+	return 0, false
+}
+
+// Function to convert a clearance rate per hour into a half-life in hours (t½ = ln2/k)
+func rateToHalfLifeHours(kPerHour float64) float64 {
+	return math.Ln2 / kPerHour
+}
+
+// Function to convert a half-life in hours into a clearance rate per day (k = ln2/t½)
+func halfLifeToRatePerDay(hours float64) float64 {
+	if hours <= 0 {
+		return 0
+	}
+	return math.Ln2 / hours * 24.0
+}
+
 // Particle spread related
 var (
 	particleSpreadOption  string  // "celltocell", "jumprandomly", "jumpradius"
@@ -146,6 +478,9 @@ var (
 	ifnWave         bool // whether to enable IFN wave
 )
 
+// Grid boundary (-boundary): true when neighbor indices wrap modulo GRID_SIZE
+var boundaryPeriodic bool
+
 // DIP related
 var (
 	dipOption bool // true to enable DIP, false to disable DIP
@@ -173,6 +508,50 @@ var (
 	randomSeed int64 // random seed for reproducible results (-1 for time-based seed)
 )
 
+// Antiviral pathway related
+var (
+	antiviralEligible map[int]bool // states allowed to transition to ANTIVIRAL (from flag_antiviralEligibleStates)
+)
+
+// State color palette related
+var (
+	paletteOverrides map[int][3]uint8 // per-state RGB colors from flag_paletteFile, applied over flag_palette
+)
+
+// Warm-up (burn-in) related
+var (
+	burnIn int // frames with frameNum < burnIn are warm-up (TIMESTEP = 1 hour)
+)
+
+// Warmup-then-perturb protocol (from flag_warmupSteps / flag_perturb)
+var (
+	perturbFrame = -1 // frame at which the perturbation is applied (-1 = no protocol)
+	perturbation []PerturbationStep
+)
+
+// Per-cell susceptibility distribution (from flag_susceptibilityCV / flag_rhoDistribution):
+// log-scale sigma of the lognormal, and whether the field is rescaled to a realized mean of 1
+var (
+	susceptibilitySigma      float64
+	susceptibilityNormalized bool
+)
+
+// Exogenous DIP doses (from flag_dipDose)
+var dipDoses []DIPDose
+
+// Washout events (from flag_washout)
+var washouts []Washout
+
+// Particle AUC windows (from flag_aucWindows)
+var (
+	aucWindows []AUCWindow
+)
+
+// Frames whose full per-cell grid is written (from flag_dumpStatesAt)
+var (
+	dumpStatesAt map[int]bool
+)
+
 // Global variables
 var (
 	// particleSpreadOption  = "jumpradius" // options: "celltocell", "jumprandomly", "jumpradius"
@@ -258,6 +637,226 @@ const (
 	UNEXPOSED = 10
 )
 
+// State names as used on the command line and in logs
+var stateNames = map[int]string{
+	SUSCEPTIBLE:                "SUSCEPTIBLE",
+	INFECTED_VIRION:            "INFECTED_VIRION",
+	DEAD:                       "DEAD",
+	ANTIVIRAL:                  "ANTIVIRAL",
+	REGROWTH:                   "REGROWTH",
+	INFECTED_DIP:               "INFECTED_DIP",
+	INFECTED_BOTH:              "INFECTED_BOTH",
+	INFECTED_VIRION_CONTINUOUS: "INFECTED_VIRION_CONTINUOUS",
+	INFECTED_DIP_CONTINUOUS:    "INFECTED_DIP_CONTINUOUS",
+	INFECTED_BOTH_CONTINUOUS:   "INFECTED_BOTH_CONTINUOUS",
+	UNEXPOSED:                  "UNEXPOSED",
+}
+
+// Function to parse a comma-separated list of state names into a set
+func parseStateList(text string) (map[int]bool, error) {
+	states := make(map[int]bool)
+	for _, name := range strings.Split(text, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		found := false
+		for s, stateName := range stateNames {
+			if strings.EqualFold(stateName, name) {
+				states[s] = true
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown state %q", name)
+		}
+	}
+	return states, nil
+}
+
+// Function to read a -paletteFile: a JSON object whose keys are state names (as in
+// parseStateList) or state constants and whose values are "#RRGGBB" colors
+func parsePaletteFile(path string) (map[int][3]uint8, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]string
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	colors := make(map[int][3]uint8)
+	for key, value := range raw {
+		state, err := strconv.Atoi(strings.TrimSpace(key))
+		if err != nil {
+			states, parseErr := parseStateList(key)
+			if parseErr != nil || len(states) != 1 {
+				return nil, fmt.Errorf("%s: unknown state %q", path, key)
+			}
+			for s := range states {
+				state = s
+			}
+		} else if _, ok := stateNames[state]; !ok {
+			return nil, fmt.Errorf("%s: unknown state constant %d", path, state)
+		}
+		hex := strings.TrimPrefix(strings.TrimSpace(value), "#")
+		rgb, err := strconv.ParseUint(hex, 16, 32)
+		if err != nil || len(hex) != 6 {
+			return nil, fmt.Errorf("%s: %s: invalid color %q (expected #RRGGBB)", path, key, value)
+		}
+		colors[state] = [3]uint8{uint8(rgb >> 16), uint8(rgb >> 8), uint8(rgb)}
+	}
+	return colors, nil
+}
+
+// One infection focus of option 5: cell (X,Y) seeded with V virion and D DIP PFU
+type infectionFocusSpec struct {
+	X int     `json:"x"`
+	Y int     `json:"y"`
+	V float64 `json:"v"`
+	D float64 `json:"d"`
+}
+
+// Foci of option 5, parsed from -foci in Run
+var infectionFoci []infectionFocusSpec
+
+// Function to parse -foci: a JSON array of {"x","y","v","d"} objects or semicolon-separated
+// "x,y,v,d" tuples. Coordinates are checked against the grid in Run.
+func parseFoci(spec string) ([]infectionFocusSpec, error) {
+	spec = strings.TrimSpace(spec)
+	if strings.HasPrefix(spec, "[") {
+		var foci []infectionFocusSpec
+		if err := json.Unmarshal([]byte(spec), &foci); err != nil {
+			return nil, err
+		}
+		return foci, nil
+	}
+	var foci []infectionFocusSpec
+	for _, tuple := range strings.Split(spec, ";") {
+		if strings.TrimSpace(tuple) == "" {
+			continue
+		}
+		fields := strings.Split(tuple, ",")
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("focus %q: expected x,y,v,d", tuple)
+		}
+		var focus infectionFocusSpec
+		var err error
+		if focus.X, err = strconv.Atoi(strings.TrimSpace(fields[0])); err != nil {
+			return nil, fmt.Errorf("focus %q: invalid x: %v", tuple, err)
+		}
+		if focus.Y, err = strconv.Atoi(strings.TrimSpace(fields[1])); err != nil {
+			return nil, fmt.Errorf("focus %q: invalid y: %v", tuple, err)
+		}
+		if focus.V, err = strconv.ParseFloat(strings.TrimSpace(fields[2]), 64); err != nil {
+			return nil, fmt.Errorf("focus %q: invalid v: %v", tuple, err)
+		}
+		if focus.D, err = strconv.ParseFloat(strings.TrimSpace(fields[3]), 64); err != nil {
+			return nil, fmt.Errorf("focus %q: invalid d: %v", tuple, err)
+		}
+		foci = append(foci, focus)
+	}
+	return foci, nil
+}
+
+// Function to write foci back as "x,y,v,d" tuples joined by sep, for the folder name
+func formatFoci(foci []infectionFocusSpec, sep string) string {
+	parts := make([]string, len(foci))
+	for k, f := range foci {
+		parts[k] = fmt.Sprintf("%d,%d,%s,%s", f.X, f.Y,
+			strconv.FormatFloat(f.V, 'f', -1, 64), strconv.FormatFloat(f.D, 'f', -1, 64))
+	}
+	return strings.Join(parts, sep)
+}
+
+// State classification helpers. Use these instead of inline lists of states so
+// the burst and continuous variants are always handled together.
+
+// Canonical set of infected states (burst and continuous). Every infected-cell count and
+// percentage goes through isInfectedState, so a new infected state needs only an entry here
+// (and in one of the virion-only/DIP-only/both helpers below).
+var infectedStates = map[int]bool{
+	INFECTED_VIRION:            true,
+	INFECTED_DIP:               true,
+	INFECTED_BOTH:              true,
+	INFECTED_VIRION_CONTINUOUS: true,
+	INFECTED_DIP_CONTINUOUS:    true,
+	INFECTED_BOTH_CONTINUOUS:   true,
+}
+
+// Function to check whether a state is one of the infected states (burst or continuous)
+func isInfectedState(s int) bool {
+	return infectedStates[s]
+}
+
+// Function to check whether a state is virion-only infected (burst or continuous)
+func isInfectedVirionOnly(s int) bool {
+	return s == INFECTED_VIRION || s == INFECTED_VIRION_CONTINUOUS
+}
+
+// Function to check whether a state is DIP-only infected (burst or continuous)
+func isInfectedDIPOnly(s int) bool {
+	return s == INFECTED_DIP || s == INFECTED_DIP_CONTINUOUS
+}
+
+// Function to check whether a state is co-infected by virions and DIPs (burst or continuous)
+func isInfectedBoth(s int) bool {
+	return s == INFECTED_BOTH || s == INFECTED_BOTH_CONTINUOUS
+}
+
+// Function to check whether an uninfected cell can be infected (susceptible or regrown)
+func isInfectableState(s int) bool {
+	return s == SUSCEPTIBLE || s == REGROWTH
+}
+
+// Function to check whether a state is one of the continuously producing states
+func isProducingState(s int) bool {
+	return s == INFECTED_VIRION_CONTINUOUS || s == INFECTED_DIP_CONTINUOUS || s == INFECTED_BOTH_CONTINUOUS
+}
+
+// Function to check whether a cell is alive, uninfected and takes part in the dynamics
+// (UNEXPOSED cells never change state, so they are left out)
+func isAliveUninfected(s int) bool {
+	return s == SUSCEPTIBLE || s == ANTIVIRAL || s == REGROWTH
+}
+
+// Function to return the burst state of a continuous state (the state itself otherwise)
+func burstState(s int) int {
+	switch s {
+	case INFECTED_VIRION_CONTINUOUS:
+		return INFECTED_VIRION
+	case INFECTED_DIP_CONTINUOUS:
+		return INFECTED_DIP
+	case INFECTED_BOTH_CONTINUOUS:
+		return INFECTED_BOTH
+	}
+	return s
+}
+
+// Function to return what killed a cell that died from prevState: "virion", "dip" or "both"
+// for the infected states (burst or continuous), "" for a cell that was not infected
+func causeOfDeath(prevState int) string {
+	switch {
+	case isInfectedVirionOnly(prevState):
+		return "virion"
+	case isInfectedDIPOnly(prevState):
+		return "dip"
+	case isInfectedBoth(prevState):
+		return "both"
+	}
+	return ""
+}
+
+// Function to check whether a cell can change in the uninfected-cell sweep when it holds no IFN:
+// only susceptible or regrowth cells with enough infectious particles around them can be infected
+func (g *Grid) isTraversalActive(i, j int) bool {
+	return isInfectableState(g.state[i][j]) && g.infectiousVirions(i, j)+g.infectiousDIPs(i, j) >= *flag_minInfectiousParticles
+}
+
+// Whether the uninfected-cell sweep skips quiescent cells (no IFN, too few particles); tests
+// turn it off to compare with visiting every cell
+var skipQuiescentCells = true
+
 // Grid structure for storing the simulation state
 type Grid struct {
 	state                  [GRID_SIZE][GRID_SIZE]int        // State of the cells in the grid
@@ -280,24 +879,28 @@ type Grid struct {
 	neighbors9             [GRID_SIZE][GRID_SIZE][54][2]int // Neighbors at distance 9 (54 neighbors)
 	neighbors10            [GRID_SIZE][GRID_SIZE][60][2]int // Neighbors at distance 10 (60 neighbors)
 	neighborsBurstArea     [GRID_SIZE][GRID_SIZE][][2]int   // Neighbors within burst radius (configurable)
+	neighborsContinuous    [GRID_SIZE][GRID_SIZE][][2]int   // Neighbors within continuous production radius (configurable)
 	neighborsIFNArea       [GRID_SIZE][GRID_SIZE][][2]int   // Neighbors within IFN wave radius
 	stateChanged           [GRID_SIZE][GRID_SIZE]bool       // Flag to indicate if the state of a cell has changed
-	antiviralDuration      [GRID_SIZE][GRID_SIZE]int        // Duration of antiviral state
+	antiviralDuration      [GRID_SIZE][GRID_SIZE]int        // Commitment delay: hours of IFN exposure before the cell turns ANTIVIRAL
 	previousStates         [GRID_SIZE][GRID_SIZE]int        // Previous state of the cell
-	antiviralFlag          [GRID_SIZE][GRID_SIZE]bool       // Flag to indicate if the cell is in the antiviral state
-	timeSinceAntiviral     [GRID_SIZE][GRID_SIZE]int        // Time since the cell entered the antiviral state
-	antiviralCellCount     int                              // Number of cells in the antiviral state
-	totalAntiviralTime     int
-	intraWT                [GRID_SIZE][GRID_SIZE]int // IntraWT
-	intraDVG               [GRID_SIZE][GRID_SIZE]int // IntraDVG
+	antiviralFlag          [GRID_SIZE][GRID_SIZE]bool       // Flag to indicate if the cell has ever been in the antiviral state
+	timeSinceAntiviral     [GRID_SIZE][GRID_SIZE]int        // Commitment timer: hours since IFN exposure started the antiviral pathway (kept after entry)
+	timeInAntiviralState   [GRID_SIZE][GRID_SIZE]int        // Hours the cell has been ANTIVIRAL (-1 = not antiviral)
+	antiviralCellCount     int                              // Number of cells that have ever been in the antiviral state
+	totalAntiviralTime     int                              // Cell-hours spent in the antiviral state
+	intraWT                [GRID_SIZE][GRID_SIZE]int        // IntraWT
+	intraDVG               [GRID_SIZE][GRID_SIZE]int        // IntraDVG
 	// Exposure mask: true marks cells as non-exposed/uninfectable (baltes-only)
 	unexposedMask          [GRID_SIZE][GRID_SIZE]bool
 	allowJumpRandomly      [][]bool
 	totalRandomJumpVirions int                       // record total number of randomly jumping Virions
 	totalRandomJumpDIPs    int                       // record total number of randomly jumping DIPs
 	lysisThreshold         [GRID_SIZE][GRID_SIZE]int // fixed lysis time for each cell (virion/both infected)
+	eclipseThreshold       [GRID_SIZE][GRID_SIZE]int // eclipse period for each virion/both infected cell (-eclipsePeriod), -1 = not drawn
 	dipLysisThreshold      [GRID_SIZE][GRID_SIZE]int // fixed lysis time for each DIP-infected cell
 	dipClearanceThreshold  [GRID_SIZE][GRID_SIZE]int // time steps until DIP-only infected cells become susceptible
+	regrowthThreshold      [GRID_SIZE][GRID_SIZE]int // time steps after death until a DEAD cell can regrow (-regrowthModel=timer), -1 = not drawn
 	burstRadius            int                       // configurable burst radius for virus and DIP spread
 
 	// Case 4 continuous production mode fields
@@ -306,70 +909,222 @@ type Grid struct {
 	continuousProductionRateD  int                        // DIP production rate per timestep for continuous mode
 	continuousIncubationPeriod int                        // hours before cells start producing in continuous mode
 	continuousLysisTime        float64                    // lysis time for continuous production cells
+	continuousRadius           int                        // release radius for continuous production (independent of burstRadius)
 	infectionTime              [GRID_SIZE][GRID_SIZE]int  // timestep when cell was infected (for incubation)
 	isProducing                [GRID_SIZE][GRID_SIZE]bool // whether cell is actively producing
 	initOption                 int                        // case number (1,2,3,4)
 
-	// Per-cell DIP half-life (hours), sampled at initialization from N(mean=*flag_dip_half_life, std=2)
+	// Per-cell continuous-mode durations, sampled at infection (see markContinuousInfection)
+	incubationPeriodCell   [GRID_SIZE][GRID_SIZE]int     // hours before this cell starts producing
+	lysisTimeCell          [GRID_SIZE][GRID_SIZE]float64 // hours after infection at which this cell lyses
+	sampledContinuousCells int                           // number of continuous-mode infections sampled so far
+	sampledIncubationSum   float64                       // sum of sampled incubation periods (for realized mean)
+	sampledLysisTimeSum    float64                       // sum of sampled lysis times (for realized mean)
+
+	// Per-cell DIP half-life (hours), sampled at initialization from N(mean=flag_dip_half_life, std=2)
 	dipHalfLife [GRID_SIZE][GRID_SIZE]float64
+
+	// Per-cell multiplier of the virion infection chance, sampled at initialization (-susceptibilityCV
+	// or -rhoDistribution), so cell (i,j) infects with RHO*cellSusceptibility[i][j].
+	// susceptibilityScale is the rescaling applied to the draws (1/realized mean for -rhoDistribution).
+	cellSusceptibility  [GRID_SIZE][GRID_SIZE]float64
+	susceptibilityScale float64
+
+	// Frame at which each cell was first seen infected (-1 if never), used for the isochrone map
+	firstInfectionTime [GRID_SIZE][GRID_SIZE]int
+
+	// Frame at which each cell's current infection was first seen (-1 = not infected), and the
+	// co-infections blocked in the current frame by -superinfectionExclusionHours
+	infectionStartFrame    [GRID_SIZE][GRID_SIZE]int
+	suppressedCoinfections int
+
+	// Lysis events not yet written to bursts.csv (-burstLog)
+	burstEvents []burstEvent
+
+	// Infection lineage (-lineage, -videotype=generations): generation of each cell's latest
+	// infection (-1 = never infected) and the cell it was attributed to (i*GRID_SIZE+j, -1 = root),
+	// the last frame each cell released particles (-1 = never) and whether it did this frame, the
+	// cells of the latest frame with any release and the widest release radius of that frame (-1 =
+	// unknown, after a resume) and of this one, and the infections not yet written to lineage.csv
+	generation          [GRID_SIZE][GRID_SIZE]int
+	parentID            [GRID_SIZE][GRID_SIZE]int
+	lastReleaseFrame    [GRID_SIZE][GRID_SIZE]int
+	releasedNow         [GRID_SIZE][GRID_SIZE]bool
+	latestReleasers     [][2]int
+	latestReleaseRadius int
+	releaseRadiusNow    int
+	lineageEvents       []lineageEvent
+
+	// Cohort R_eff (tracked with the lineage): frame of each cell's latest infection (-1 = never
+	// infected) and, per infection frame, the infections of that frame and those attributed to them
+	lineageFrame    [GRID_SIZE][GRID_SIZE]int
+	cohortSize      []int
+	cohortOffspring []int
+
+	// First particle release that did not add up under -strict; Run stops with it after the frame
+	conservationErr error
+
+	// Mobile immune agents (-numImmuneCells) and the cells they cleared in the current frame
+	immuneCells []ImmuneCell
+	immuneKills int
+
+	// Hours left before an ANTIVIRAL cell reverts (-antiviralDuration; -1 = not drawn), and the
+	// cells that reverted in the current frame
+	antiviralRemaining [GRID_SIZE][GRID_SIZE]int
+	antiviralExits     int
+
+	// Hours left before a REGROWTH cell matures (-regrowthMaturationTime; -1 = not drawn), the
+	// cells that have been REGROWTH at a frame end, and how many there are
+	regrowthRemaining [GRID_SIZE][GRID_SIZE]int
+	everRegrown       [GRID_SIZE][GRID_SIZE]bool
+	everRegrownCount  int
+
+	// IFN received per cell, split by the producing cell's infection (IFN_SOURCE_*); with global
+	// IFN (ifnWave == false) every cell sees the shared pool, tracked in globalIFNBySource
+	ifnExposure       [GRID_SIZE][GRID_SIZE][3]float64
+	globalIFNBySource [3]float64
+	everAntiviral     [GRID_SIZE][GRID_SIZE]bool // cell has been ANTIVIRAL at a frame end
+	virionsArrived    [GRID_SIZE][GRID_SIZE]bool // extracellular virions were present on the cell at a frame end
+
+	// Memoized (1-p)^n for the infection probabilities, reset every frame
+	powCache powCache
+
+	// Row prefix sums of IFNConcentration for -ifnComputeMethod=summedarea
+	ifnRowSums ifnRowSums
+
+	// Regional IFN average of every cell for the current ifnWave traversal (-ifnDecay=perStep)
+	regionalIFNAverage [GRID_SIZE][GRID_SIZE]float64
+
+	// Cells that never enter the antiviral pathway (-ifnResponderFraction), fixed per location at initialize
+	ifnNonResponder [GRID_SIZE][GRID_SIZE]bool
+
+	// Partition mode totals: particles released by partition lyses and how many of them jumped randomly
+	partitionReleased int
+	partitionJumped   int
+
+	// Particle counts at the start of the current frame; with -sameFrameInfection=forbid only
+	// these can infect, so particles released during frame t first act in frame t+1
+	virionsAtFrameStart [GRID_SIZE][GRID_SIZE]int
+	dipsAtFrameStart    [GRID_SIZE][GRID_SIZE]int
+
+	// Particles released by bursts, continuous production and jumps during the current frame
+	// (the supernatant analog for the -aucWindows released-particle AUC)
+	releasedVirionsNow int
+	releasedDIPsNow    int
+
+	// Per-frame event counts (indexed by frameNum), used for the R_eff(t) estimate
+	newInfectionsPerFrame []int // cells that entered an infected state during the frame
+	lysisEventsPerFrame   []int // cells that died (lysed) during the frame
+
+	// Particles adsorbed by infected/dead cells in the current frame (-adsorptionVirion/-adsorptionDIP)
+	adsorbedVirions int
+	adsorbedDIPs    int
+
+	// DIPs added by -dipDose doses at the start of the current frame
+	dosedDIPs int
+
+	// Particles removed by -washout events at the end of the current frame
+	washedVirions int
+	washedDIPs    int
+
+	// Random stream of this grid, seeded once in Run; not safe for use from other goroutines.
+	// rngSource counts the draws so checkpoints can restore the stream.
+	rng       *rand.Rand
+	rngSource *countingSource
+
+	// Front tracking: cells seeded at initialization (one per particle cell for option 3) and the
+	// front radius of the previous recorded frame (-1 = no infected or dead cell yet)
+	infectionSeeds  [][2]int
+	lastFrontRadius int
+}
+
+// Function to turn an initial PFU value into a particle count. By default the value is
+// rounded; with -probabilisticSeed the fractional part is the probability of one extra
+// particle, so e.g. 0.3 PFU seeds a single particle in 30% of runs.
+func seedParticleCount(rng *rand.Rand, pfu float64) int {
+	if !*flag_probabilisticSeed || pfu <= 0 {
+		return int(math.Round(pfu))
+	}
+	whole := math.Floor(pfu)
+	count := int(whole)
+	if rng.Float64() < pfu-whole {
+		count++
+	}
+	return count
+}
+
+// Function to return the seed of the exposure mask stream: -maskSeed if set, otherwise derived from -randomSeed
+func exposureMaskSeed() int64 {
+	if *flag_maskSeed >= 0 {
+		return *flag_maskSeed
+	}
+	seed := randomSeed
+	if seed < 0 {
+		seed = time.Now().UnixNano()
+	}
+	return seed ^ 0x6d61736b // mask substream ("mask")
 }
 
 // Initialize the infection state
 func (g *Grid) initializeInfection(option int) {
-	// Set random seed - use provided seed or current time for randomness
-	if randomSeed >= 0 {
-		rand.Seed(randomSeed)
-		fmt.Printf("Using fixed random seed: %d\n", randomSeed)
-	} else {
-		seed := time.Now().UnixNano()
-		rand.Seed(seed)
-		fmt.Printf("Using time-based random seed: %d\n", seed)
+	vInit := seedParticleCount(g.rng, *flag_v_pfu_initial)
+	dInit := seedParticleCount(g.rng, *flag_d_pfu_initial)
+	if *flag_probabilisticSeed {
+		fmt.Printf("🎲 Probabilistic seeding: v_pfu_initial=%.3f -> %d virions, d_pfu_initial=%.3f -> %d DIPs\n",
+			*flag_v_pfu_initial, vInit, *flag_d_pfu_initial, dInit)
 	}
 
-	vInit := int(math.Round(*flag_v_pfu_initial))
-	dInit := int(math.Round(*flag_d_pfu_initial))
+	focus := g.infectionFocus()
+	fi, fj := focus[0], focus[1]
+	g.lastFrontRadius = -1
+	if option != 3 && option != 5 {
+		g.addInfectionSeed(fi, fj)
+	}
 
 	switch option {
 	case 1:
 		if vInit > 0 {
-			g.localVirions[25][25] = vInit
+			g.localVirions[fi][fj] = vInit
 		} else {
 			fmt.Printf("v_pfu_initial < 0: %.2f\n", *flag_v_pfu_initial)
 		}
 		if dInit > 0 {
-			g.localDips[25][25] = dInit
+			g.localDips[fi][fj] = dInit
 		} else {
 			fmt.Printf("d_pfu_initial < 0: %.2f\n", *flag_d_pfu_initial)
 		}
 	case 2:
 		if vInit > 0 && dInit > 0 {
-			g.state[25][25] = INFECTED_BOTH
+			g.state[fi][fj] = INFECTED_BOTH
 		} else if vInit > 0 {
-			g.state[25][25] = INFECTED_VIRION
+			g.state[fi][fj] = INFECTED_VIRION
 		} else if dInit > 0 {
-			g.state[25][25] = INFECTED_DIP
+			g.state[fi][fj] = INFECTED_DIP
 		}
-		g.localVirions[25][25] = vInit
-		g.localDips[25][25] = dInit
+		g.localVirions[fi][fj] = vInit
+		g.localDips[fi][fj] = dInit
 
 	case 3:
 		for k := 0; k < vInit; k++ {
-			i := rand.Intn(GRID_SIZE)
-			j := rand.Intn(GRID_SIZE)
+			i := g.rng.Intn(GRID_SIZE)
+			j := g.rng.Intn(GRID_SIZE)
 			g.localVirions[i][j]++
+			g.addInfectionSeed(i, j)
 		}
 		for k := 0; k < dInit; k++ {
-			i := rand.Intn(GRID_SIZE)
-			j := rand.Intn(GRID_SIZE)
+			i := g.rng.Intn(GRID_SIZE)
+			j := g.rng.Intn(GRID_SIZE)
 			g.localDips[i][j]++
+			g.addInfectionSeed(i, j)
 		}
 	case 4:
 		// Place virions at configurable number of positions clustered around the center
-		centerX := GRID_SIZE / 2
-		centerY := GRID_SIZE / 2
+		centerX, centerY := fi, fj
 
 		// Set state based on continuous mode
-		if g.continuousMode {
+		if *flag_probabilisticSeed && vInit == 0 {
+			fmt.Printf("🚫 Probabilistic seeding drew 0 virions: center cell (%d,%d) left uninfected\n", centerX, centerY)
+		} else if g.continuousMode {
 			g.state[centerX][centerY] = INFECTED_VIRION_CONTINUOUS
 			fmt.Printf("🌱 Initial cell set to INFECTED_VIRION_CONTINUOUS at (%d,%d)\n", centerX, centerY)
 		} else {
@@ -390,20 +1145,15 @@ func (g *Grid) initializeInfection(option int) {
 			hx, hy = *flag_dipHotspotX, *flag_dipHotspotY
 		} else {
 			// Build ring cells around center within radius r and choose randomly
-			var burstArea [][2]int
+			var ringCells [][2]int
 			for rad := 1; rad <= r; rad++ {
-				ring := generateHexRing(centerX, centerY, rad)
-				for _, nb := range ring {
-					nx, ny := nb[0], nb[1]
-					if nx >= 0 && nx < GRID_SIZE && ny >= 0 && ny < GRID_SIZE {
-						burstArea = append(burstArea, [2]int{nx, ny})
-					}
-				}
+				ringCells = append(ringCells, generateHexRing(centerX, centerY, rad)...)
 			}
+			burstArea := wrapNeighbors(ringCells, [2]int{centerX, centerY})
 			if len(burstArea) == 0 {
 				burstArea = append(burstArea, [2]int{centerX, centerY})
 			}
-			idxHot := rand.Intn(len(burstArea))
+			idxHot := g.rng.Intn(len(burstArea))
 			hx, hy = burstArea[idxHot][0], burstArea[idxHot][1]
 		}
 
@@ -413,7 +1163,7 @@ func (g *Grid) initializeInfection(option int) {
 		// 2) 初始 DIPs 数量仅由 d_pfu_initial 控制
 		centerDIPs := 0
 		if *flag_d_pfu_initial >= 0 {
-			centerDIPs = int(math.Round(*flag_d_pfu_initial))
+			centerDIPs = dInit
 		} else {
 			centerDIPs = 0
 		}
@@ -428,49 +1178,7 @@ func (g *Grid) initializeInfection(option int) {
 				fmt.Printf("🎯 Hotspot at (%d,%d): placed %d DIPs at single point (initRange=%d)\n", hx, hy, centerDIPs, initR)
 			} else {
 				// 在热点为中心、半径 initR 内按距离加权分布
-				hotArea := make([][2]int, 0, 1+6*initR*(initR+1)/2)
-				hotArea = append(hotArea, [2]int{hx, hy})
-				for rad := 1; rad <= initR; rad++ {
-					ring := generateHexRing(hx, hy, rad)
-					for _, nb := range ring {
-						nx, ny := nb[0], nb[1]
-						if nx >= 0 && nx < GRID_SIZE && ny >= 0 && ny < GRID_SIZE {
-							hotArea = append(hotArea, [2]int{nx, ny})
-						}
-					}
-				}
-				weights := make([]float64, len(hotArea))
-				totalW := 0.0
-				for idx, cell := range hotArea {
-					d := getHexDistanceBetweenPoints(hx, hy, cell[0], cell[1])
-					w := 1.0 / (float64(d) + 0.1)
-					weights[idx] = w
-					totalW += w
-				}
-				distributed := 0
-				for idx, cell := range hotArea {
-					share := int(math.Floor(float64(centerDIPs) * (weights[idx] / totalW)))
-					if share > 0 {
-						g.localDips[cell[0]][cell[1]] += share
-						distributed += share
-					}
-				}
-				left := centerDIPs - distributed
-				if left > 0 && len(hotArea) > 0 {
-					indices := make([]int, len(hotArea))
-					for i2 := range indices {
-						indices[i2] = i2
-					}
-					rand.Shuffle(len(indices), func(a, b int) { indices[a], indices[b] = indices[b], indices[a] })
-					k := 0
-					for left > 0 {
-						idx := indices[k%len(indices)]
-						cell := hotArea[idx]
-						g.localDips[cell[0]][cell[1]]++
-						left--
-						k++
-					}
-				}
+				g.spreadInitialDIPs(hx, hy, centerDIPs, initR)
 				fmt.Printf("🎯 Hotspot at (%d,%d): distributed %d DIPs within initRange=%d (distance-weighted)\n", hx, hy, centerDIPs, initR)
 			}
 		} else {
@@ -480,77 +1188,96 @@ func (g *Grid) initializeInfection(option int) {
 				initR = *flag_dipInitRange
 			}
 			// 在热点为中心、半径 initR 内按距离加权分布
-			hotArea := make([][2]int, 0)
-			hotArea = append(hotArea, [2]int{hx, hy})
-			for rad := 1; rad <= initR; rad++ {
-				ring := generateHexRing(hx, hy, rad)
-				for _, nb := range ring {
-					nx, ny := nb[0], nb[1]
-					if nx >= 0 && nx < GRID_SIZE && ny >= 0 && ny < GRID_SIZE {
-						hotArea = append(hotArea, [2]int{nx, ny})
-					}
-				}
-			}
-
-			weights := make([]float64, len(hotArea))
-			totalW := 0.0
-			for idx, cell := range hotArea {
-				d := getHexDistanceBetweenPoints(hx, hy, cell[0], cell[1])
-				w := 1.0 / (float64(d) + 0.1)
-				weights[idx] = w
-				totalW += w
-			}
-
-			distributed := 0
-			for idx, cell := range hotArea {
-				share := int(math.Floor(float64(centerDIPs) * (weights[idx] / totalW)))
-				if share > 0 {
-					g.localDips[cell[0]][cell[1]] += share
-					distributed += share
-				}
-			}
-			left := centerDIPs - distributed
-			if left > 0 && len(hotArea) > 0 {
-				indices := make([]int, len(hotArea))
-				for i2 := range indices {
-					indices[i2] = i2
-				}
-				rand.Shuffle(len(indices), func(a, b int) { indices[a], indices[b] = indices[b], indices[a] })
-				k := 0
-				for left > 0 {
-					idx := indices[k%len(indices)]
-					cell := hotArea[idx]
-					g.localDips[cell[0]][cell[1]]++
-					left--
-					k++
-				}
-			}
+			g.spreadInitialDIPs(hx, hy, centerDIPs, initR)
 		}
 
 		// 不做额外随机邻居撒点，仅热点单点放置 DIPs
 
 		// Record intracellular virus counts for continuous mode
 		if g.continuousMode {
-			g.intraWT[centerX][centerY] = 1       // Initial intracellular wild-type virus count
-			g.intraDVG[centerX][centerY] = 0      // No DVG initially
-			g.infectionTime[centerX][centerY] = 0 // Record infection time
+			g.intraWT[centerX][centerY] = 1  // Initial intracellular wild-type virus count
+			g.intraDVG[centerX][centerY] = 0 // No DVG initially
+			// Record infection time
+			g.markContinuousInfection(centerX, centerY, 0)
+		}
+
+	case 5:
+		// Each -foci entry infects its cell as in option 2, with its own virions and DIPs;
+		// with -dipInitRange > 0 the DIPs are spread around the focus instead
+		for _, f := range infectionFoci {
+			v := seedParticleCount(g.rng, f.V)
+			d := seedParticleCount(g.rng, f.D)
+			g.addInfectionSeed(f.X, f.Y)
+			if v > 0 && d > 0 {
+				g.state[f.X][f.Y] = INFECTED_BOTH
+			} else if v > 0 {
+				g.state[f.X][f.Y] = INFECTED_VIRION
+			} else if d > 0 {
+				g.state[f.X][f.Y] = INFECTED_DIP
+			}
+			g.localVirions[f.X][f.Y] += v
+			if d > 0 && *flag_dipInitRange > 0 {
+				g.spreadInitialDIPs(f.X, f.Y, d, *flag_dipInitRange)
+			} else {
+				g.localDips[f.X][f.Y] += d
+			}
+			fmt.Printf("🌱 Focus at (%d,%d): %d virions, %d DIPs\n", f.X, f.Y, v, d)
 		}
+	}
 
+	// Seeded cells count as infected at frame 0, as lineage roots
+	if lineageTracked() {
+		g.updateLineage(0)
 	}
+	g.updateInfectionStart(0)
+}
 
+// Function to distribute count initial DIPs over the hotspot (hx,hy) and the cells within
+// radius of it, weighted by 1/(distance+0.1); the rounding remainder goes to shuffled cells
+func (g *Grid) spreadInitialDIPs(hx, hy, count, radius int) {
+	var ringCells [][2]int
+	for rad := 1; rad <= radius; rad++ {
+		ringCells = append(ringCells, generateHexRing(hx, hy, rad)...)
+	}
+	hotArea := append([][2]int{{hx, hy}}, wrapNeighbors(ringCells, [2]int{hx, hy})...)
+	g.addDIPsByDistance(hx, hy, hotArea, count)
 }
 
-// Function to generate ticks dynamically
-func generateTicks(xMax float64, interval float64) []chart.Tick {
-	var ticks []chart.Tick
-	for value := 0.0; value <= xMax; value += interval {
-		label := fmt.Sprintf("%.0f", value) // Format the label as an integer
-		ticks = append(ticks, chart.Tick{
-			Value: value,
-			Label: label,
-		})
+// Function to add count DIPs over hotArea, each cell weighted by 1/(distance to (hx,hy)+0.1)
+func (g *Grid) addDIPsByDistance(hx, hy int, hotArea [][2]int, count int) {
+	weights := make([]float64, len(hotArea))
+	totalW := 0.0
+	for idx, cell := range hotArea {
+		d := getHexDistanceBetweenPoints(hx, hy, cell[0], cell[1])
+		w := 1.0 / (float64(d) + 0.1)
+		weights[idx] = w
+		totalW += w
+	}
+
+	distributed := 0
+	for idx, cell := range hotArea {
+		share := int(math.Floor(float64(count) * (weights[idx] / totalW)))
+		if share > 0 {
+			g.localDips[cell[0]][cell[1]] += share
+			distributed += share
+		}
+	}
+	left := count - distributed
+	if left > 0 && len(hotArea) > 0 {
+		indices := make([]int, len(hotArea))
+		for i2 := range indices {
+			indices[i2] = i2
+		}
+		g.rng.Shuffle(len(indices), func(a, b int) { indices[a], indices[b] = indices[b], indices[a] })
+		k := 0
+		for left > 0 {
+			idx := indices[k%len(indices)]
+			cell := hotArea[idx]
+			g.localDips[cell[0]][cell[1]]++
+			left--
+			k++
+		}
 	}
-	return ticks
 }
 
 // Initialize the grid, setting all cells to SUSCEPTIBLE
@@ -568,21 +1295,55 @@ func (g *Grid) initialize() {
 			g.previousStates[i][j] = -1
 			g.antiviralFlag[i][j] = false
 			g.timeSinceAntiviral[i][j] = -1
-			g.intraWT[i][j] = 0
-			g.intraDVG[i][j] = 0
+			g.timeInAntiviralState[i][j] = -1
+			g.antiviralRemaining[i][j] = -1
+			g.regrowthRemaining[i][j] = -1
+			g.regrowthThreshold[i][j] = -1
 			g.lysisThreshold[i][j] = -1
+			g.eclipseThreshold[i][j] = -1
 			g.dipLysisThreshold[i][j] = -1
 			g.dipClearanceThreshold[i][j] = -1
-
-			// Initialize per-cell DIP half-life from Normal(mean=*flag_dip_half_life, std=2)
+			g.firstInfectionTime[i][j] = -1
+			g.generation[i][j] = -1
+			g.parentID[i][j] = -1
+			g.lastReleaseFrame[i][j] = -1
+			g.lineageFrame[i][j] = -1
+			g.infectionStartFrame[i][j] = -1
+			g.resetContinuousState(i, j)
+
+			// Initialize per-cell DIP half-life from Normal(mean=flag_dip_half_life, std=2)
 			// Clamp to a small positive minimum to avoid division by zero or negative values
-			val := *flag_dip_half_life + 2.0*rand.NormFloat64()
+			val := flag_dip_half_life.Hours + 2.0*g.rng.NormFloat64()
 			// Round to integer hours
 			val = math.Round(val)
 			if val < 1.0 {
 				val = 1.0
 			}
 			g.dipHalfLife[i][j] = val
+
+			g.cellSusceptibility[i][j] = 1.0
+		}
+	}
+
+	// Per-cell susceptibility from a lognormal with mean 1 and log-scale sigma (from -susceptibilityCV,
+	// sigma^2 = ln(1+CV^2), or -rhoDistribution); nothing is drawn when sigma is 0. Under
+	// -rhoDistribution the field is rescaled so its realized mean is exactly 1.
+	g.susceptibilityScale = 1
+	if susceptibilitySigma > 0 {
+		sum := 0.0
+		for i := 0; i < GRID_SIZE; i++ {
+			for j := 0; j < GRID_SIZE; j++ {
+				g.cellSusceptibility[i][j] = g.sampleSusceptibility()
+				sum += g.cellSusceptibility[i][j]
+			}
+		}
+		if susceptibilityNormalized {
+			g.susceptibilityScale = float64(GRID_SIZE*GRID_SIZE) / sum
+			for i := 0; i < GRID_SIZE; i++ {
+				for j := 0; j < GRID_SIZE; j++ {
+					g.cellSusceptibility[i][j] *= g.susceptibilityScale
+				}
+			}
 		}
 	}
 
@@ -603,7 +1364,9 @@ func (g *Grid) initialize() {
 			for idx := 0; idx < totalCells; idx++ {
 				indices[idx] = idx
 			}
-			rand.Shuffle(totalCells, func(a, b int) { indices[a], indices[b] = indices[b], indices[a] })
+			// Separate stream, so toggling the mask does not shift any simulation draw
+			maskRng := rand.New(rand.NewSource(exposureMaskSeed()))
+			maskRng.Shuffle(totalCells, func(a, b int) { indices[a], indices[b] = indices[b], indices[a] })
 			for k := 0; k < target; k++ {
 				idx := indices[k]
 				i := idx / GRID_SIZE
@@ -615,17 +1378,23 @@ func (g *Grid) initialize() {
 		}
 	}
 
-	fmt.Println("Grid initialized")
-
-}
-
-// Ensure the entire canvas is initialized with uniform background color
-func fillBackground(img *image.RGBA, bgColor color.Color) {
-	for y := 0; y < img.Bounds().Dy(); y++ {
-		for x := 0; x < img.Bounds().Dx(); x++ {
-			img.Set(x, y, bgColor)
+	// Mark IFN non-responders (uniform sampling without replacement); no draws when every cell responds
+	if *flag_ifnResponderFraction < 1.0 {
+		totalCells := GRID_SIZE * GRID_SIZE
+		target := int(math.Round((1.0 - *flag_ifnResponderFraction) * float64(totalCells)))
+		indices := make([]int, totalCells)
+		for idx := 0; idx < totalCells; idx++ {
+			indices[idx] = idx
 		}
+		g.rng.Shuffle(totalCells, func(a, b int) { indices[a], indices[b] = indices[b], indices[a] })
+		for k := 0; k < target; k++ {
+			g.ifnNonResponder[indices[k]/GRID_SIZE][indices[k]%GRID_SIZE] = true
+		}
+		fmt.Printf("IFN non-responders initialized: responder fraction=%.3f, non-responder cells=%d\n", *flag_ifnResponderFraction, target)
 	}
+
+	fmt.Println("Grid initialized")
+
 }
 
 func (g *Grid) calculateDiffusionRates() (float64, float64) {
@@ -655,10 +1424,10 @@ func (g *Grid) calculateDiffusionRates() (float64, float64) {
 }
 
 // Function to get the nth figure number in the folder
-func getNextFigureNumber(outputFolder string) int {
+func getNextFigureNumber(outputFolder string) (int, error) {
 	files, err := os.ReadDir(outputFolder)
 	if err != nil {
-		log.Fatalf("Failed to read output folder: %v", err)
+		return 0, fmt.Errorf("%w: failed to read output folder: %v", ErrOutputIO, err)
 	}
 	count := 0
 	for _, file := range files {
@@ -666,7 +1435,7 @@ func getNextFigureNumber(outputFolder string) int {
 			count++
 		}
 	}
-	return count + 1 // Return the next number
+	return count + 1, nil // Return the next number
 }
 
 // Logic to determine IFN spreading type
@@ -743,55 +1512,18 @@ func generateFolderName(
 
 	folderName := fmt.Sprintf("%d_%s_%s_%s_%s_%s_%s_times%d_tau%d_ifnBothFold%.2f_grid%d_VStimulateIFN%t",
 		no, dInit, dName, vInit, vName, ifnName, cellType, timeSteps, TAU, ifnBothFold, GRID_SIZE, VStimulateIFN)
+	if option == 5 {
+		// e.g. _foci20x20x10x0-80x90x10x50
+		folderName += "_foci" + strings.ReplaceAll(formatFoci(infectionFoci, "-"), ",", "x")
+	}
 
 	return folderName
 }
 
-// Combine images into one row
-func combineImagesHorizontally(images []*image.RGBA) *image.RGBA {
-	if len(images) == 0 {
-		return nil
-	}
-
-	// Calculate the width and height of the combined image
-	totalWidth := 0
-	maxHeight := 0
-	for _, img := range images {
-		totalWidth += img.Bounds().Dx() // accumulate width
-		if img.Bounds().Dy() > maxHeight {
-			maxHeight = img.Bounds().Dy() // calculate maximum height
-		}
-	}
-
-	// Create the combined image
-	combinedImg := image.NewRGBA(image.Rect(0, 0, totalWidth, maxHeight))
-	offsetX := 0
-	for _, img := range images {
-		rect := img.Bounds()
-		draw.Draw(combinedImg, image.Rect(offsetX, 0, offsetX+rect.Dx(), rect.Dy()), img, rect.Min, draw.Src)
-		offsetX += rect.Dx()
-	}
-
-	return combinedImg
-}
-
-// Save PNG image
-func savePNGImage(img *image.RGBA, filename string) {
-	file, err := os.Create(filename)
-	if err != nil {
-		log.Fatalf("Failed to create file %s: %v", filename, err)
-	}
-	defer file.Close()
-
-	err = png.Encode(file, img)
-	if err != nil {
-		log.Fatalf("Failed to encode PNG: %v", err)
-	}
-}
-func contains(arr []int, val int) bool {
-	for _, v := range arr {
-		if v == val {
-			return true
+func contains(arr []int, val int) bool {
+	for _, v := range arr {
+		if v == val {
+			return true
 		}
 	}
 	return false
@@ -815,91 +1547,6 @@ func LogValueFormatter(v interface{}) string {
 	}
 	return "0"
 }
-func clampValues(data []float64, min, max float64) []float64 {
-	clamped := make([]float64, len(data))
-	for i, v := range data {
-		if v < min {
-			clamped[i] = min
-		} else if v > max {
-			clamped[i] = max
-		} else {
-			clamped[i] = v
-		}
-	}
-	return clamped
-}
-
-// Modified function definition
-func createInfectionGraph(frameNum int, virionOnly, dipOnly, both []float64, showLegend bool) *image.RGBA {
-	graphWidth := GRID_SIZE * CELL_SIZE * 2
-	graphHeight := 200
-
-	if frameNum < 1 {
-		log.Fatalf("Not enough data to render the graph: frameNum = %d", frameNum)
-	}
-
-	virionOnly = clampValues(virionOnly, 0.00, yMax)
-	dipOnly = clampValues(dipOnly, 0.00, yMax)
-	both = clampValues(both, 0.00, yMax)
-
-	// Dynamically set legend name
-	var series []chart.Series
-
-	series = []chart.Series{
-		chart.ContinuousSeries{
-			Name:    "Infected by Virion Only",
-			XValues: createTimeSeries(frameNum),
-			YValues: virionOnly,
-			Style:   chart.Style{StrokeColor: chart.ColorRed, StrokeWidth: 6.0},
-		},
-		chart.ContinuousSeries{
-			Name:    "Infected by DIP Only",
-			XValues: createTimeSeries(frameNum),
-			YValues: dipOnly,
-			Style:   chart.Style{StrokeColor: chart.ColorGreen, StrokeWidth: 6.0},
-		},
-		chart.ContinuousSeries{
-			Name:    "Infected by Both",
-			XValues: createTimeSeries(frameNum),
-			YValues: both,
-			Style:   chart.Style{StrokeColor: drawing.Color{R: 255, G: 165, B: 0, A: 255}, StrokeWidth: 8.0},
-		},
-	}
-
-	graph := chart.Chart{
-		Width:  459, // int(float64(GRID_SIZE*CELL_SIZE) * 1.51)
-		Height: 100,
-		XAxis: chart.XAxis{
-			Style: chart.Style{FontSize: 10.0},
-			ValueFormatter: func(v interface{}) string {
-				return fmt.Sprintf("%d", int(v.(float64)))
-			},
-			Ticks: generateTicks(xMax, ticksInterval),
-		},
-		YAxis: chart.YAxis{
-			Style: chart.Style{FontSize: 10.0},
-		},
-		Series: series,
-	}
-
-	buffer := bytes.NewBuffer([]byte{})
-	err := graph.Render(chart.PNG, buffer)
-	if err != nil {
-		log.Printf("Failed to render graph: %v", err)
-		// Return a simple colored rectangle instead of crashing
-		return image.NewRGBA(image.Rect(0, 0, 459, 100))
-	}
-
-	graphImg, _, err := image.Decode(buffer)
-	if err != nil {
-		log.Fatalf("Failed to decode graph image: %v", err)
-	}
-
-	rgbaImg := image.NewRGBA(image.Rect(0, 0, graphWidth, graphHeight))
-	draw.Draw(rgbaImg, rgbaImg.Bounds(), graphImg, image.Point{}, draw.Src)
-
-	return rgbaImg
-}
 
 // saveCurrentGoFile saves the current Go source file into the specified output folder.
 // saveCurrentGoFile saves the current Go source file with its original name and a timestamp.
@@ -942,10 +1589,10 @@ func saveCurrentGoFile(outputFolder string) {
 	log.Printf("file successfully saved in %s\n", outputFilePath)
 }
 
-func getNextFolderNumber(basePath string) int {
+func getNextFolderNumber(basePath string) (int, error) {
 	files, err := os.ReadDir(basePath)
 	if err != nil {
-		log.Fatalf("Failed to read directory %s: %v", basePath, err)
+		return 0, fmt.Errorf("%w: failed to read directory %s: %v", ErrOutputIO, basePath, err)
 	}
 
 	maxNumber := 0
@@ -959,7 +1606,7 @@ func getNextFolderNumber(basePath string) int {
 			}
 		}
 	}
-	return maxNumber + 1 // Return next available number
+	return maxNumber + 1, nil // Return next available number
 }
 
 func transformToLogScale(data []float64) []float64 {
@@ -1057,8 +1704,7 @@ func (g *Grid) calculateInfectedPercentage() float64 {
 	infectedCells := 0
 	for i := 0; i < GRID_SIZE; i++ {
 		for j := 0; j < GRID_SIZE; j++ {
-			if g.state[i][j] == INFECTED_VIRION || g.state[i][j] == INFECTED_DIP || g.state[i][j] == INFECTED_DIP_CONTINUOUS || g.state[i][j] == INFECTED_BOTH ||
-				g.state[i][j] == INFECTED_VIRION_CONTINUOUS || g.state[i][j] == INFECTED_DIP || g.state[i][j] == INFECTED_DIP_CONTINUOUS || g.state[i][j] == INFECTED_BOTH_CONTINUOUS {
+			if isInfectedState(g.state[i][j]) {
 				infectedCells++
 			}
 		}
@@ -1072,7 +1718,7 @@ func (g *Grid) calculateInfectedDIPOnlyPercentage() float64 {
 	infectedDIPOnlyCells := 0
 	for i := 0; i < GRID_SIZE; i++ {
 		for j := 0; j < GRID_SIZE; j++ {
-			if g.state[i][j] == INFECTED_DIP || g.state[i][j] == INFECTED_DIP_CONTINUOUS {
+			if isInfectedDIPOnly(g.state[i][j]) {
 				infectedDIPOnlyCells++
 			}
 		}
@@ -1086,7 +1732,7 @@ func (g *Grid) calculateInfectedBothPercentage() float64 {
 	infectedBothCells := 0
 	for i := 0; i < GRID_SIZE; i++ {
 		for j := 0; j < GRID_SIZE; j++ {
-			if g.state[i][j] == INFECTED_BOTH || g.state[i][j] == INFECTED_BOTH_CONTINUOUS {
+			if isInfectedBoth(g.state[i][j]) {
 				infectedBothCells++
 			}
 		}
@@ -1114,7 +1760,7 @@ func (g *Grid) calculateUninfectedPercentage() float64 {
 	uninfectedCells := 0
 	for i := 0; i < GRID_SIZE; i++ {
 		for j := 0; j < GRID_SIZE; j++ {
-			if g.state[i][j] == SUSCEPTIBLE || g.state[i][j] == REGROWTH {
+			if isInfectableState(g.state[i][j]) {
 				uninfectedCells++
 			}
 		}
@@ -1136,6 +1782,156 @@ func (g *Grid) calculatePlaquePercentage() float64 {
 	return (float64(plaqueCells) / float64(totalCells)) * 100
 }
 
+// Function to report whether a cell belongs to a plaque: DEAD, plus REGROWTH with -plaqueIncludeRegrowth
+func isPlaqueCell(state int) bool {
+	return state == DEAD || (*flag_plaqueIncludeRegrowth && state == REGROWTH)
+}
+
+// plaque is one connected cluster of plaque cells found by findPlaques
+type plaque struct {
+	cells       [][2]int
+	touchesEdge bool // touches the grid edge (never under -boundary=periodic, where plaques wrap instead)
+}
+
+// Function to find plaques, the connected clusters of plaque cells under the hex neighbor
+// relation. Plaques are recomputed from scratch every call, so merged plaques simply count as one.
+func (g *Grid) findPlaques() []plaque {
+	var visited [GRID_SIZE][GRID_SIZE]bool
+	var plaques []plaque
+	var stack [][2]int
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			if visited[i][j] || !isPlaqueCell(g.state[i][j]) {
+				continue
+			}
+			var p plaque
+			visited[i][j] = true
+			stack = append(stack[:0], [2]int{i, j})
+			for len(stack) > 0 {
+				cell := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				p.cells = append(p.cells, cell)
+				if !boundaryPeriodic && (cell[0] == 0 || cell[0] == GRID_SIZE-1 || cell[1] == 0 || cell[1] == GRID_SIZE-1) {
+					p.touchesEdge = true
+				}
+				for _, neighbor := range g.neighbors1[cell[0]][cell[1]] {
+					ni, nj, ok := wrapCell(neighbor[0], neighbor[1])
+					if ok && !visited[ni][nj] && isPlaqueCell(g.state[ni][nj]) {
+						visited[ni][nj] = true
+						stack = append(stack, [2]int{ni, nj})
+					}
+				}
+			}
+			plaques = append(plaques, p)
+		}
+	}
+	return plaques
+}
+
+// Function to return the cell nearest to the plaque centroid. Offsets are taken from the first
+// cell with boundaryOffset, so a plaque wrapping a periodic boundary gets a centroid inside it.
+func (p plaque) centroid() (int, int) {
+	first := p.cells[0]
+	var sumI, sumJ float64
+	for _, cell := range p.cells {
+		sumI += float64(boundaryOffset(cell[0] - first[0]))
+		sumJ += float64(boundaryOffset(cell[1] - first[1]))
+	}
+	n := float64(len(p.cells))
+	ci := first[0] + int(math.Round(sumI/n))
+	cj := first[1] + int(math.Round(sumJ/n))
+	return (ci%GRID_SIZE + GRID_SIZE) % GRID_SIZE, (cj%GRID_SIZE + GRID_SIZE) % GRID_SIZE
+}
+
+// Function to return the plaque extent: the largest hex distance of one of its cells from the
+// centroid cell (0 for a single dead cell)
+func (p plaque) extent() int {
+	ci, cj := p.centroid()
+	extent := 0
+	for _, cell := range p.cells {
+		if d := getHexDistanceBetweenPoints(ci, cj, cell[0], cell[1]); d > extent {
+			extent = d
+		}
+	}
+	return extent
+}
+
+// Function to convert a plaque size in cells to the radius of the hex disk with that many
+// cells (a disk of radius r holds 3r(r+1)+1 cells), so a single dead cell has radius 0
+func plaqueRadius(size int) float64 {
+	return (math.Sqrt(12*float64(size)-3) - 3) / 6
+}
+
+// plaqueStats summarizes the plaques of one frame for the CSV (all zero when there are none)
+type plaqueStats struct {
+	count, edgeCount   int
+	meanRadius         float64 // equivalent disk radius, over all plaques
+	meanInteriorRadius float64 // equivalent disk radius, over plaques not touching the edge
+	meanArea           float64 // cells
+	maxArea            int     // cells
+	meanExtent         float64 // max hex distance from the centroid
+}
+
+// Function to summarize plaques for the CSV
+func summarizePlaques(plaques []plaque) plaqueStats {
+	stats := plaqueStats{count: len(plaques)}
+	interior := 0
+	for _, p := range plaques {
+		size := len(p.cells)
+		r := plaqueRadius(size)
+		stats.meanRadius += r
+		stats.meanArea += float64(size)
+		if size > stats.maxArea {
+			stats.maxArea = size
+		}
+		stats.meanExtent += float64(p.extent())
+		if p.touchesEdge {
+			stats.edgeCount++
+		} else {
+			stats.meanInteriorRadius += r
+			interior++
+		}
+	}
+	if stats.count > 0 {
+		stats.meanRadius /= float64(stats.count)
+		stats.meanArea /= float64(stats.count)
+		stats.meanExtent /= float64(stats.count)
+	}
+	if interior > 0 {
+		stats.meanInteriorRadius /= float64(interior)
+	}
+	return stats
+}
+
+// Header of plaques.csv (-plaquesEvery)
+func plaquesHeader() []string {
+	return []string{"Time", "plaque", "size", "centroid_i", "centroid_j", "extent", "equivalentRadius", "touchesEdge"}
+}
+
+// Function to write one plaques.csv row per plaque at every -plaquesEvery frames
+func (g *Grid) recordPlaques(writer *atomicCSV, frameNum int) error {
+	if *flag_plaquesEvery <= 0 || frameNum%*flag_plaquesEvery != 0 {
+		return nil
+	}
+	for idx, p := range g.findPlaques() {
+		ci, cj := p.centroid()
+		row := []string{
+			strconv.Itoa(frameNum * TIMESTEP),
+			strconv.Itoa(idx),
+			strconv.Itoa(len(p.cells)),
+			strconv.Itoa(ci),
+			strconv.Itoa(cj),
+			strconv.Itoa(p.extent()),
+			strconv.FormatFloat(plaqueRadius(len(p.cells)), 'f', 6, 64),
+			strconv.FormatBool(p.touchesEdge),
+		}
+		if err := writer.WriteRow(row); err != nil {
+			return fmt.Errorf("%w: failed to write plaques CSV row at frame %d: %v", ErrOutputIO, frameNum, err)
+		}
+	}
+	return nil
+}
+
 // Function to calculate the percentage of dead cells
 func calculateDeadCellPercentage(grid [GRID_SIZE][GRID_SIZE]int) float64 {
 	totalCells := GRID_SIZE * GRID_SIZE
@@ -1155,7 +1951,7 @@ func (g *Grid) calculateVirionOnlyInfected() int {
 	virionOnlyInfected := 0
 	for i := 0; i < GRID_SIZE; i++ {
 		for j := 0; j < GRID_SIZE; j++ {
-			if g.state[i][j] == INFECTED_VIRION || g.state[i][j] == INFECTED_VIRION_CONTINUOUS {
+			if isInfectedVirionOnly(g.state[i][j]) {
 				virionOnlyInfected++
 			}
 		}
@@ -1168,7 +1964,7 @@ func (g *Grid) calculateDipOnlyInfected() int {
 	dipOnlyInfected := 0
 	for i := 0; i < GRID_SIZE; i++ {
 		for j := 0; j < GRID_SIZE; j++ {
-			if g.state[i][j] == INFECTED_DIP || g.state[i][j] == INFECTED_DIP_CONTINUOUS {
+			if isInfectedDIPOnly(g.state[i][j]) {
 				dipOnlyInfected++
 			}
 		}
@@ -1181,7 +1977,7 @@ func (g *Grid) calculateBothInfected() int {
 	bothInfected := 0
 	for i := 0; i < GRID_SIZE; i++ {
 		for j := 0; j < GRID_SIZE; j++ {
-			if g.state[i][j] == INFECTED_BOTH || g.state[i][j] == INFECTED_BOTH_CONTINUOUS {
+			if isInfectedBoth(g.state[i][j]) {
 				bothInfected++
 			}
 		}
@@ -1191,7 +1987,7 @@ func (g *Grid) calculateBothInfected() int {
 
 var precomputedRing [][2]int
 
-func precomputeRing(radius int) [][2]int {
+func precomputeRing(rng *rand.Rand, radius int) [][2]int {
 	var offsets [][2]int
 	for dx := -radius; dx <= radius; dx++ {
 		for dy := -radius; dy <= radius; dy++ {
@@ -1200,7 +1996,7 @@ func precomputeRing(radius int) [][2]int {
 			}
 		}
 	}
-	rand.Shuffle(len(offsets), func(i, j int) { offsets[i], offsets[j] = offsets[j], offsets[i] })
+	rng.Shuffle(len(offsets), func(i, j int) { offsets[i], offsets[j] = offsets[j], offsets[i] })
 	return offsets
 }
 
@@ -1222,12 +2018,21 @@ func precomputeIFNArea(radius int) [][2]int {
 
 // Calculate neighbor relationships
 func (g *Grid) initializeNeighbors() {
+	// The IFN area offsets are the same for every cell
+	var ifnAreaOffsets [][2]int
+	if ifnWave == true && !ifnRadiusCoversGrid(IFN_wave_radius) {
+		ifnAreaOffsets = precomputeIFNArea(IFN_wave_radius)
+	}
+
 	// Initialize neighbors for all cells
 	for i := 0; i < GRID_SIZE; i++ {
 		for j := 0; j < GRID_SIZE; j++ {
 			// Initialize fixed neighbor distances (1-10) using hexagonal neighbor calculation
 			for radius := 1; radius <= 10; radius++ {
 				neighbors := generateHexRing(i, j, radius)
+				if boundaryPeriodic {
+					neighbors = wrapNeighbors(neighbors, [2]int{i, j})
+				}
 
 				// Assign to appropriate neighbor array based on radius
 				switch radius {
@@ -1256,27 +2061,45 @@ func (g *Grid) initializeNeighbors() {
 
 			// Initialize burst area neighbors based on configurable radius (virus and DIP use same radius)
 			var burstAreaNeighbors [][2]int
-			for radius := 1; radius <= g.burstRadius; radius++ {
-				neighbors := generateHexRing(i, j, radius)
-				for _, neighbor := range neighbors {
-					if neighbor[0] >= 0 && neighbor[0] < GRID_SIZE && neighbor[1] >= 0 && neighbor[1] < GRID_SIZE {
-						burstAreaNeighbors = append(burstAreaNeighbors, neighbor)
-					}
+			if g.burstRadius >= gridHexDiameter {
+				warnOnce("burstRadiusCoversGrid", "burstRadius=%d covers the whole grid (diameter %d): bursts deposit over every cell", g.burstRadius, gridHexDiameter)
+				burstAreaNeighbors = allCellsExcept(i, j)
+			}
+			if burstAreaNeighbors == nil {
+				var ringCells [][2]int
+				for radius := 1; radius <= g.burstRadius; radius++ {
+					ringCells = append(ringCells, generateHexRing(i, j, radius)...)
 				}
+				burstAreaNeighbors = wrapNeighbors(ringCells, [2]int{i, j})
 			}
 			g.neighborsBurstArea[i][j] = burstAreaNeighbors
 
+			// Initialize continuous production area neighbors (separate footprint from bursts)
+			var continuousAreaNeighbors [][2]int
+			if g.continuousRadius >= gridHexDiameter {
+				warnOnce("continuousRadiusCoversGrid", "continuousRadius=%d covers the whole grid (diameter %d): continuous production deposits over every cell", g.continuousRadius, gridHexDiameter)
+				continuousAreaNeighbors = allCellsExcept(i, j)
+			}
+			if continuousAreaNeighbors == nil {
+				var ringCells [][2]int
+				for radius := 1; radius <= g.continuousRadius; radius++ {
+					ringCells = append(ringCells, generateHexRing(i, j, radius)...)
+				}
+				continuousAreaNeighbors = wrapNeighbors(ringCells, [2]int{i, j})
+			}
+			g.neighborsContinuous[i][j] = continuousAreaNeighbors
+
 			// Initialize IFN area neighbors if enabled
-			if ifnWave == true {
-				precomputedIFNArea := precomputeIFNArea(IFN_wave_radius)
-				var ifnAreaNeighbors [][2]int
-				for _, offset := range precomputedIFNArea {
-					newI, newJ := i+offset[0], j+offset[1]
-					if newI >= 0 && newI < GRID_SIZE && newJ >= 0 && newJ < GRID_SIZE {
-						ifnAreaNeighbors = append(ifnAreaNeighbors, [2]int{newI, newJ})
-					}
+			if ifnWave == true && ifnRadiusCoversGrid(IFN_wave_radius) {
+				warnOnce("ifnRadiusCoversGrid", "IFN_wave_radius=%d covers the whole grid: local IFN behaves like global", IFN_wave_radius)
+				g.neighborsIFNArea[i][j] = allCellsFrom(i, j)
+			} else if ifnWave == true {
+				areaCells := make([][2]int, len(ifnAreaOffsets))
+				for k, offset := range ifnAreaOffsets {
+					areaCells[k] = [2]int{i + offset[0], j + offset[1]}
 				}
-				g.neighborsIFNArea[i][j] = ifnAreaNeighbors
+				// The IFN area includes the producing cell itself, so nothing is excluded
+				g.neighborsIFNArea[i][j] = wrapNeighbors(areaCells, [2]int{-1, -1})
 			}
 		}
 	}
@@ -1284,24 +2107,166 @@ func (g *Grid) initializeNeighbors() {
 	fmt.Println("Neighbors initialized")
 }
 
+// Largest hex distance between two cells of the grid; any radius >= this covers every cell
+var gridHexDiameter = computeGridHexDiameter()
+
+// allCellsTwice lists every cell in row-major order, twice, so that every-cell neighbor lists
+// can share one backing array instead of holding GRID_SIZE^2 entries per cell
+var allCellsTwice = buildAllCellsTwice()
+
+// Function to compute the largest getHexDistance over all in-grid offsets
+func computeGridHexDiameter() int {
+	diameter := 0
+	for dx := -(GRID_SIZE - 1); dx < GRID_SIZE; dx++ {
+		for dy := -(GRID_SIZE - 1); dy < GRID_SIZE; dy++ {
+			if d := getHexDistance(dx, dy); d > diameter {
+				diameter = d
+			}
+		}
+	}
+	return diameter
+}
+
+func buildAllCellsTwice() [][2]int {
+	cells := make([][2]int, 0, 2*GRID_SIZE*GRID_SIZE)
+	for pass := 0; pass < 2; pass++ {
+		for i := 0; i < GRID_SIZE; i++ {
+			for j := 0; j < GRID_SIZE; j++ {
+				cells = append(cells, [2]int{i, j})
+			}
+		}
+	}
+	return cells
+}
+
+// Function to return every cell starting at (i,j), including (i,j) itself (read-only)
+func allCellsFrom(i, j int) [][2]int {
+	n := GRID_SIZE * GRID_SIZE
+	k := i*GRID_SIZE + j
+	return allCellsTwice[k : k+n : k+n]
+}
+
+// Function to return every cell except (i,j): the "all cells" fast path used instead of ring
+// enumeration when a radius covers the whole grid (read-only)
+func allCellsExcept(i, j int) [][2]int {
+	cells := allCellsFrom(i, j)
+	return cells[1:len(cells):len(cells)]
+}
+
+// Function to report whether the Euclidean IFN area of the given radius contains every cell
+func ifnRadiusCoversGrid(radius int) bool {
+	return float64(radius) >= math.Sqrt(2)*float64(GRID_SIZE-1)
+}
+
+// Function to print per-cell trace output (bursts, production, coinfection); silent with
+// -render=false so batch runs only print the per-frame summaries
+func debugf(format string, args ...interface{}) {
+	if *flag_render {
+		fmt.Printf(format, args...)
+	}
+}
+
+// Warnings already printed by warnOnce, keyed by topic
+var warnedOnce = make(map[string]bool)
+
+// Warnings raised during the current Run, returned in RunResult.Warnings
+var runWarnings []string
+
+// Function to print a warning the first time its key is seen
+func warnOnce(key, format string, args ...interface{}) {
+	if warnedOnce[key] {
+		return
+	}
+	warnedOnce[key] = true
+	runWarnings = append(runWarnings, fmt.Sprintf(format, args...))
+	fmt.Printf("⚠️  "+format+"\n", args...)
+}
+
+// Function to map (ni, nj) onto the grid under -boundary. Open reports cells outside the
+// grid as not ok; periodic wraps both indices modulo GRID_SIZE and always succeeds.
+func wrapCell(ni, nj int) (int, int, bool) {
+	if boundaryPeriodic {
+		return (ni%GRID_SIZE + GRID_SIZE) % GRID_SIZE, (nj%GRID_SIZE + GRID_SIZE) % GRID_SIZE, true
+	}
+	return ni, nj, ni >= 0 && ni < GRID_SIZE && nj >= 0 && nj < GRID_SIZE
+}
+
+// Function to map raw neighbor coordinates onto the grid, keeping their order. Open drops the
+// cells outside the grid. Periodic wraps them and drops repeats and the excluded cell, since a
+// footprint wider than half the grid wraps onto itself.
+func wrapNeighbors(cells [][2]int, exclude [2]int) [][2]int {
+	var seen map[[2]int]bool
+	if boundaryPeriodic {
+		seen = map[[2]int]bool{exclude: true}
+	}
+	wrapped := make([][2]int, 0, len(cells))
+	for _, cell := range cells {
+		ni, nj, ok := wrapCell(cell[0], cell[1])
+		if !ok {
+			continue
+		}
+		if seen != nil {
+			if seen[[2]int{ni, nj}] {
+				continue
+			}
+			seen[[2]int{ni, nj}] = true
+		}
+		wrapped = append(wrapped, [2]int{ni, nj})
+	}
+	return wrapped
+}
+
+// Function to return the shortest signed offset along one axis: d itself for an open grid,
+// the minimum image in (-GRID_SIZE/2, GRID_SIZE/2] for a periodic one. GRID_SIZE is even, so
+// wrapping keeps the row parity that getHexDistance depends on.
+func boundaryOffset(d int) int {
+	if !boundaryPeriodic {
+		return d
+	}
+	d = (d%GRID_SIZE + GRID_SIZE) % GRID_SIZE
+	if d > GRID_SIZE/2 {
+		d -= GRID_SIZE
+	}
+	return d
+}
+
 // Generate neighbors in a hexagonal ring at specified radius
 func generateHexRing(i, j, radius int) [][2]int {
-	var neighbors [][2]int
+	offsets := hexRingOffsets(radius)
+	if len(offsets) == 0 {
+		return nil
+	}
+	neighbors := make([][2]int, len(offsets))
+	for k, offset := range offsets {
+		neighbors[k] = [2]int{i + offset[0], j + offset[1]}
+	}
+	return neighbors
+}
+
+// Ring offsets by radius, filled on first use. getHexDistance only looks at the offset, so
+// every cell shares the same list (not safe for concurrent first use)
+var hexRingOffsetCache = make(map[int][][2]int)
+
+// Function to return the offsets at exactly hex distance radius, in dx-major order (read-only)
+func hexRingOffsets(radius int) [][2]int {
+	if offsets, ok := hexRingOffsetCache[radius]; ok {
+		return offsets
+	}
+	var offsets [][2]int
 	for dx := -radius; dx <= radius; dx++ {
 		for dy := -radius; dy <= radius; dy++ {
 			// Skip the center point
 			if dx == 0 && dy == 0 {
 				continue
 			}
-			// Calculate hexagonal distance
-			hexDist := getHexDistance(dx, dy)
 			// Only include neighbors at exactly the specified radius
-			if hexDist == radius {
-				neighbors = append(neighbors, [2]int{i + dx, j + dy})
+			if getHexDistance(dx, dy) == radius {
+				offsets = append(offsets, [2]int{dx, dy})
 			}
 		}
 	}
-	return neighbors
+	hexRingOffsetCache[radius] = offsets
+	return offsets
 }
 
 // Calculate hexagonal distance between two points
@@ -1317,8 +2282,8 @@ func getHexDistance(dx, dy int) int {
 
 // Calculate hexagonal distance between two points
 func getHexDistanceBetweenPoints(x1, y1, x2, y2 int) int {
-	dx := x2 - x1
-	dy := y2 - y1
+	dx := boundaryOffset(x2 - x1)
+	dy := boundaryOffset(y2 - y1)
 	return getHexDistance(dx, dy)
 }
 
@@ -1352,162 +2317,33 @@ func min(a, b int) int {
 	return b
 }
 
-// Distance-weighted burst logic - "近多远少" (closer neighbors get more particles)
-func (g *Grid) handleBurstWithConfigurableRadius(i, j int) {
-	// Use neighborsBurstArea which contains all neighbors within burstRadius
-	availableNeighbors := g.neighborsBurstArea[i][j]
-
-	if len(availableNeighbors) == 0 {
-		fmt.Printf("No available neighbors for burst at (%d,%d)\n", i, j)
-		return
-	}
-
-	// Calculate distance-based weights for each neighbor
-	// Weight formula: weight = 1 / (distance^1.5) - closer neighbors get exponentially more particles
-	neighborWeights := make([]float64, len(availableNeighbors))
-	totalWeight := 0.0
-
-	for idx, neighbor := range availableNeighbors {
-		ni, nj := neighbor[0], neighbor[1]
-		distance := getHexDistanceBetweenPoints(i, j, ni, nj)
-		if distance == 0 {
-			distance = 1 // Avoid division by zero
-		}
-		// Distance-based weight: closer = higher weight
-		weight := 1.0 / math.Pow(float64(distance), 1.5)
-		neighborWeights[idx] = weight
-		totalWeight += weight
-	}
-
-	// Determine burst sizes based on cell type and intracellular DIP content (following 0716 logic)
-	burstSizeV := BURST_SIZE_V
-	burstSizeD := 0 // Default: no DIPs
-
-	// Calculate adjusted burst size for DIPs based on local ratio (like 0716 version)
-	totalVirionsAtCell := g.localVirions[i][j]
-	totalDIPsAtCell := g.localDips[i][j]
-	adjustedBurstSizeD := 0
-
-	if totalVirionsAtCell > 0 {
-		dipVirionRatio := float64(totalDIPsAtCell) / float64(totalVirionsAtCell)
-		adjustedBurstSizeD = BURST_SIZE_D + int(float64(BURST_SIZE_D)*dipVirionRatio)
-	}
-
-	// Adjust based on cell type (following 0716 logic - always use adjustedBurstSizeD)
-	if g.state[i][j] == INFECTED_VIRION {
-		// Virion-only infected cells: release virions only, no DVG/DIP release
-		burstSizeV = BURST_SIZE_V
-		if virionBurstMode == "both" {
-			burstSizeD = adjustedBurstSizeD
-			fmt.Printf("🔍 Cell (%d,%d) is INFECTED_VIRION, mode=both, will release %d DIPs\n", i, j, burstSizeD)
-		} else {
-			burstSizeD = 0
-			fmt.Printf("🔍 Cell (%d,%d) is INFECTED_VIRION, mode=virionOnly, will release 0 DIPs\n", i, j)
-		}
-	} else if g.state[i][j] == INFECTED_BOTH {
-		// Co-infected cells: produce both virions and DIPs
-		burstSizeV = BURST_SIZE_V
-		burstSizeD = adjustedBurstSizeD
-	} else if g.state[i][j] == INFECTED_DIP || g.state[i][j] == INFECTED_DIP_CONTINUOUS {
-		// DIP-only infected cells: no production (will be cleared)
-		burstSizeV = 0
-		burstSizeD = 0
-	}
-
-	fmt.Printf("🦠 Distance-weighted burst at (%d,%d): %d virions, %d DIPs to %d neighbors (radius=%d)\n",
-		i, j, burstSizeV, burstSizeD, len(availableNeighbors), g.burstRadius)
-
-	// Distribute particles based on distance weights
-	virionsDistributed := 0
-	dipsDistributed := 0
-
-	for idx, neighbor := range availableNeighbors {
-		ni, nj := neighbor[0], neighbor[1]
-		distance := getHexDistanceBetweenPoints(i, j, ni, nj)
-
-		// Calculate weighted distribution
-		weight := neighborWeights[idx]
-		proportion := weight / totalWeight
-
-		// Distribute virions based on weight
-		virionsToAdd := int(math.Round(float64(BURST_SIZE_V) * proportion))
-		if virionsToAdd > 0 {
-			g.localVirions[ni][nj] += virionsToAdd
-			virionsDistributed += virionsToAdd
-		}
-
-		// Distribute DIPs based on weight
-		dipsToAdd := int(math.Round(float64(burstSizeD) * proportion))
-		if dipsToAdd > 0 {
-			g.localDips[ni][nj] += dipsToAdd
-			dipsDistributed += dipsToAdd
-		}
-
-		// Debug: Show distribution for close neighbors
-		if distance <= 3 {
-			fmt.Printf("  📍 Distance=%d → %d virions, %d DIPs (weight=%.3f)\n",
-				distance, virionsToAdd, dipsToAdd, weight)
-		}
-	}
-
-	// Handle any remaining particles due to rounding
-	remainingVirions := burstSizeV - virionsDistributed
-	remainingDips := burstSizeD - dipsDistributed
-
-	// Distribute remaining particles to the closest neighbors (distance=1)
-	for _, neighbor := range availableNeighbors {
-		if remainingVirions <= 0 && remainingDips <= 0 {
-			break
-		}
-		ni, nj := neighbor[0], neighbor[1]
-		distance := getHexDistanceBetweenPoints(i, j, ni, nj)
-
-		if distance == 1 { // Give remaining particles to immediate neighbors
-			if remainingVirions > 0 {
-				g.localVirions[ni][nj]++
-				remainingVirions--
-			}
-			if remainingDips > 0 {
-				g.localDips[ni][nj]++
-				remainingDips--
-			}
-		}
-	}
-
-	fmt.Printf("  💊 Distributed: %d/%d virions, %d/%d DIPs\n",
-		virionsDistributed+(burstSizeV-remainingVirions), burstSizeV,
-		dipsDistributed+(burstSizeD-remainingDips), burstSizeD)
-}
-
 // Continuous production logic for Case 4
 func (g *Grid) handleContinuousProduction(i, j, frameNum int) {
 	// Only handle continuous mode states, skip burst mode states
-	if g.state[i][j] != INFECTED_VIRION_CONTINUOUS &&
-		g.state[i][j] != INFECTED_DIP_CONTINUOUS &&
-		g.state[i][j] != INFECTED_BOTH_CONTINUOUS {
+	if !isProducingState(g.state[i][j]) {
 		return // Skip burst mode states
 	}
 
-	fmt.Printf("🔍 handleContinuousProduction called for cell (%d,%d) with state %d at frame %d\n", i, j, g.state[i][j], frameNum)
+	debugf("🔍 handleContinuousProduction called for cell (%d,%d) with state %d at frame %d\n", i, j, g.state[i][j], frameNum)
 
 	// Check if cell is mature enough to start producing
 	if !g.isProducing[i][j] {
-		if frameNum-g.infectionTime[i][j] >= g.continuousIncubationPeriod {
+		if frameNum-g.infectionTime[i][j] >= g.incubationPeriodCell[i][j] {
 			g.isProducing[i][j] = true
-			fmt.Printf("🌱 Cell (%d,%d) matured and started continuous production at frame %d\n", i, j, frameNum)
+			debugf("🌱 Cell (%d,%d) matured and started continuous production at frame %d\n", i, j, frameNum)
 		} else {
 			return // Not yet mature
 		}
 	}
 
 	// Check if it's time for lysis (if lysis time is set)
-	if g.continuousLysisTime > 0 {
-		if float64(frameNum-g.infectionTime[i][j]) >= g.continuousLysisTime {
+	if g.lysisTimeCell[i][j] > 0 {
+		if float64(frameNum-g.infectionTime[i][j]) >= g.lysisTimeCell[i][j] {
 			// Time for lysis - transition to DEAD state
 			g.state[i][j] = DEAD
 			g.stateChanged[i][j] = true
 			g.isProducing[i][j] = false
-			fmt.Printf("💀 Continuous production cell (%d,%d) lysed after %.1f hours\n", i, j, g.continuousLysisTime)
+			debugf("💀 Continuous production cell (%d,%d) lysed after %.1f hours\n", i, j, g.lysisTimeCell[i][j])
 			return
 		}
 	}
@@ -1555,11 +2391,11 @@ func (g *Grid) handleContinuousProduction(i, j, frameNum int) {
 		}
 	}
 
-	fmt.Printf("🔄 Continuous production at (%d,%d): %d virions, %d DIPs (intraWT=%d, intraDVG=%d, state=%d, frame %d)\n",
+	debugf("🔄 Continuous production at (%d,%d): %d virions, %d DIPs (intraWT=%d, intraDVG=%d, state=%d, frame %d)\n",
 		i, j, virionsToRelease, dipsToRelease, g.intraWT[i][j], g.intraDVG[i][j], g.state[i][j], frameNum)
 
-	// Use the same distance-weighted distribution as burst mode
-	g.distributeContinuousParticles(i, j, virionsToRelease, dipsToRelease)
+	// Release over the continuous production footprint
+	g.distributeParticles(i, j, virionsToRelease, dipsToRelease, g.continuousRadius, g.continuousRadius, pathKernel(kernelHexInverse15), 1)
 
 	// Update intracellular virus counts based on production (simplified replication model)
 	if g.continuousMode {
@@ -1581,2704 +2417,4579 @@ func (g *Grid) handleContinuousProduction(i, j, frameNum int) {
 	}
 }
 
-// Distribute particles using continuous production with distance weights
-func (g *Grid) distributeContinuousParticles(i, j, virions, dips int) {
-	availableNeighbors := g.neighborsBurstArea[i][j]
-
-	if len(availableNeighbors) == 0 {
-		fmt.Printf("No available neighbors for continuous production at (%d,%d)\n", i, j)
+// Function to delay lysis of an INFECTED_VIRION cell that has just been co-infected by DIPs
+func (g *Grid) applyCoinfectionLysisDelay(i, j int) {
+	delay := int(math.Round(*flag_coinfectionLysisDelay))
+	if delay <= 0 && !*flag_coinfectionLysisReset {
 		return
 	}
+	if g.lysisThreshold[i][j] == -1 {
+		g.lysisThreshold[i][j] = int(g.rng.NormFloat64()*STANDARD_LYSIS_TIME + MEAN_LYSIS_TIME)
+	}
+	if *flag_coinfectionLysisReset {
+		g.timeSinceInfectVorBoth[i][j] = 0
+	}
+	if delay > 0 {
+		g.lysisThreshold[i][j] += delay
+	}
+}
 
-	// Calculate distance-based weights (same as burst mode)
-	neighborWeights := make([]float64, len(availableNeighbors))
-	totalWeight := 0.0
+// ImmuneCell is a mobile immune agent (e.g. a macrophage) overlaid on the cell grid
+type ImmuneCell struct {
+	I, J  int // cell the agent is on
+	Kills int // infected cells this agent has cleared
+}
 
-	for idx, neighbor := range availableNeighbors {
-		ni, nj := neighbor[0], neighbor[1]
-		distance := getHexDistanceBetweenPoints(i, j, ni, nj)
-		if distance == 0 {
-			distance = 1
-		}
-		weight := 1.0 / math.Pow(float64(distance), 1.5)
-		neighborWeights[idx] = weight
-		totalWeight += weight
+// Function to place the immune cells on uniformly random cells (several may share a cell).
+// Nothing is drawn when there are none, so runs without immune cells are unchanged.
+func (g *Grid) initializeImmuneCells(n int) {
+	g.immuneCells = make([]ImmuneCell, n)
+	for k := range g.immuneCells {
+		g.immuneCells[k].I = g.rng.Intn(GRID_SIZE)
+		g.immuneCells[k].J = g.rng.Intn(GRID_SIZE)
 	}
+}
 
-	// Distribute particles based on distance weights
-	for idx, neighbor := range availableNeighbors {
-		ni, nj := neighbor[0], neighbor[1]
-		weight := neighborWeights[idx]
-		proportion := weight / totalWeight
-
-		// Distribute virions
-		virionsToAdd := int(math.Round(float64(virions) * proportion))
-		if virionsToAdd > 0 {
-			g.localVirions[ni][nj] += virionsToAdd
+// Function to move every immune cell one step of a random walk biased toward high local IFN and
+// let it clear the infected cell it lands on. The step goes to one of the hex neighbors
+// (generateHexRing radius 1), chosen with weight 1 + immuneIFNBias*IFNConcentration.
+func (g *Grid) updateImmuneCells(frameNum int) {
+	g.immuneKills = 0
+	if len(g.immuneCells) == 0 {
+		return
+	}
+	for k := range g.immuneCells {
+		agent := &g.immuneCells[k]
+		neighbors := wrapNeighbors(generateHexRing(agent.I, agent.J, 1), [2]int{agent.I, agent.J})
+		if len(neighbors) == 0 {
+			continue
+		}
+		weights := make([]float64, len(neighbors))
+		total := 0.0
+		for idx, n := range neighbors {
+			weights[idx] = 1 + *flag_immuneIFNBias*g.IFNConcentration[n[0]][n[1]]
+			total += weights[idx]
 		}
+		pick := len(neighbors) - 1
+		r := g.rng.Float64() * total
+		for idx, w := range weights {
+			if r < w {
+				pick = idx
+				break
+			}
+			r -= w
+		}
+		agent.I, agent.J = neighbors[pick][0], neighbors[pick][1]
 
-		// Distribute DIPs
-		dipsToAdd := int(math.Round(float64(dips) * proportion))
-		if dipsToAdd > 0 {
-			g.localDips[ni][nj] += dipsToAdd
+		if isInfectedState(g.state[agent.I][agent.J]) && g.rng.Float64() < *flag_immuneKillProb {
+			g.killByImmuneCell(agent.I, agent.J)
+			agent.Kills++
+			g.immuneKills++
 		}
 	}
+	fmt.Printf("🧹 Frame %d: immune cells cleared %d infected cells\n", frameNum, g.immuneKills)
 }
 
-// Handle burst or continuous production based on Case 4 mode
-func (g *Grid) handleViralProduction(i, j, frameNum int) {
-	// Check if this is Case 4 and continuous mode is enabled
-	if g.initOption == 4 && g.continuousMode {
-		// Use continuous production mode
-		fmt.Printf("🔧 handleViralProduction: Case 4 continuous mode enabled, calling handleContinuousProduction\n")
-		g.handleContinuousProduction(i, j, frameNum)
-	} else {
-		// Use traditional burst mode (all cases including Case 4 burst mode)
-		fmt.Printf("🔧 handleViralProduction: Using burst mode (initOption=%d, continuousMode=%t), calling handleCase4Burst for cell (%d,%d)\n", g.initOption, g.continuousMode, i, j)
-		g.handleCase4Burst(i, j, BURST_SIZE_V, BURST_SIZE_D, k_JumpR)
-	}
+// Function to turn an infected cell DEAD without a burst (immune clearance), resetting its infection timers
+func (g *Grid) killByImmuneCell(i, j int) {
+	g.previousStates[i][j] = g.state[i][j]
+	g.state[i][j] = DEAD
+	g.timeSinceDead[i][j] = 0
+	g.timeSinceInfectVorBoth[i][j] = -1
+	g.timeSinceInfectDIP[i][j] = -1
+	g.lysisThreshold[i][j] = -1
+	g.eclipseThreshold[i][j] = -1
+	g.dipLysisThreshold[i][j] = -1
+	g.dipClearanceThreshold[i][j] = -1
+	g.resetContinuousState(i, j)
 }
 
-// Handle Case 4 burst with 0716 logic (transplanted from 0716 version)
-func (g *Grid) handleCase4Burst(i, j, burstSizeV, burstSizeD int, kJumpR float64) {
-	// Calculate adjusted burst size for DIPs based on local ratio (like 0716 version)
-	totalVirionsAtCell := g.localVirions[i][j]
-	totalDIPsAtCell := g.localDips[i][j]
-	adjustedBurstSizeD := 0
-
-	if totalVirionsAtCell > 0 {
-		dipVirionRatio := float64(totalDIPsAtCell) / float64(totalVirionsAtCell)
-		adjustedBurstSizeD = burstSizeD + int(float64(burstSizeD)*dipVirionRatio)
-	}
+// infectionDraw is the outcome of one cell's infection draw in a time step
+type infectionDraw struct {
+	probV, probD    float64 // chance that at least one virion / DIP infects
+	byVirion, byDip bool
+	virions, dips   int // particles entering, the intracellular dose (continuousMode, -burstModel=competition)
+}
 
-	// Under hotspot restriction, prevent DIPs from virion-only bursts when no DIPs present
-	if *flag_dipRestrictToHotspot && totalDIPsAtCell == 0 && g.state[i][j] == INFECTED_VIRION {
-		adjustedBurstSizeD = 0
-	}
+// Function to draw whether the infectious virions and DIPs on (i,j) infect the cell, given
+// per-particle chances pV and pD, from rng and with (1-p)^n from pow. bernoulli: each type infects with probability 1-(1-p)^n and
+// the dose is the rounded n*P. poisson: Poisson(pV*n) virions and Poisson(lambdaDip*pD*n) DIPs
+// enter and a type infects when at least one particle entered.
+func (g *Grid) drawInfection(rng *rand.Rand, pow *powCache, pV, pD float64, i, j int) infectionDraw {
+	var d infectionDraw
+	nV, nD := g.infectiousVirions(i, j), g.infectiousDIPs(i, j)
+	if *flag_infectionModel == "poisson" {
+		meanV, meanD := pV*float64(nV), lambdaDip*pD*float64(nD)
+		d.probV, d.probD = 1-math.Exp(-meanV), 1-math.Exp(-meanD)
+		d.virions, d.dips = poissonDraw(rng, meanV), poissonDraw(rng, meanD)
+		d.byVirion, d.byDip = d.virions >= 1, d.dips >= 1
+		return d
+	}
+	d.probV = 1 - pow.pow(1-pV, nV)
+	d.byVirion = rng.Float64() <= d.probV
+	d.probD = 1 - pow.pow(1-pD, nD)
+	d.byDip = rng.Float64() <= d.probD
+	d.virions = int(math.Round(float64(nV) * d.probV))
+	d.dips = int(math.Round(float64(nD) * d.probD))
+	return d
+}
 
-	// Guard: DIP-only cells should not release any virions (and we also set DIPs to 0 here; DIP-only clears elsewhere)
-	if g.state[i][j] == INFECTED_DIP || g.state[i][j] == INFECTED_DIP_CONTINUOUS {
-		burstSizeV = 0
-		adjustedBurstSizeD = 0
-	}
+// Function to draw a Poisson(lambda) count from the grid's random stream (see poissonDraw)
+func (g *Grid) poisson(lambda float64) int {
+	return poissonDraw(g.rng, lambda)
+}
 
-	// If restricted, forbid any DIP release during bursts; else apply virion-only rule
-	if *flag_dipRestrictToHotspot {
-		// Under restriction, only virion-only bursts are blocked from releasing DIPs
-		if g.state[i][j] == INFECTED_VIRION {
-			adjustedBurstSizeD = 0
+// Function to draw a Poisson(lambda) count from rng: Knuth's product of uniforms for small
+// lambda, Hörmann's transformed rejection (PTRS) for lambda >= 10
+func poissonDraw(rng *rand.Rand, lambda float64) int {
+	if lambda <= 0 {
+		return 0
+	}
+	if lambda < 10 {
+		limit := math.Exp(-lambda)
+		k := 0
+		for p := rng.Float64(); p > limit; p *= rng.Float64() {
+			k++
 		}
-	} else {
-		// Virion-only infected cells: DIP release depends on virionBurstMode
-		if g.state[i][j] == INFECTED_VIRION {
-			if virionBurstMode == "virionOnly" {
-				adjustedBurstSizeD = 0
-			}
+		return k
+	}
+	logLambda := math.Log(lambda)
+	b := 0.931 + 2.53*math.Sqrt(lambda)
+	a := -0.059 + 0.02483*b
+	invAlpha := 1.1239 + 1.1328/(b-3.4)
+	vr := 0.9277 - 3.6224/(b-2)
+	for {
+		u := rng.Float64() - 0.5
+		v := rng.Float64()
+		us := 0.5 - math.Abs(u)
+		k := math.Floor((2*a/us+b)*u + lambda + 0.43)
+		if us >= 0.07 && v <= vr {
+			return int(k)
+		}
+		if k < 0 || (us < 0.013 && v > us) {
+			continue
+		}
+		logFactorial, _ := math.Lgamma(k + 1)
+		if math.Log(v)+math.Log(invAlpha)-math.Log(a/(us*us)+b) <= -lambda+k*logLambda-logFactorial {
+			return int(k)
 		}
 	}
+}
 
-	// Enforce VIRION-only pre-lysis cells release 0 DIPs even after state changes to DEAD
-	// Use previousStates captured right before death to infer the infection type at lysis
-	preBurstState := g.previousStates[i][j]
-	if preBurstState == INFECTED_VIRION {
-		adjustedBurstSizeD = 0
-	}
-	// NOTE: If preBurstState == INFECTED_BOTH, keep normal DIP release (burstSizeD, adjustedBurstSizeD)
-	if preBurstState == INFECTED_BOTH {
-		if burstSizeD > 0 {
-			if adjustedBurstSizeD <= 0 {
-				fmt.Printf("VIOLATION_PRE_BURST_BOTH: at (%d,%d) burstSizeD=%d adjustedBurstSizeD=%d (expected >0)\n",
-					i, j, burstSizeD, adjustedBurstSizeD)
-				// Fallback: ensure minimum DIP release equals BURST_SIZE_D when BOTH
-				adjustedBurstSizeD = burstSizeD
-			} else {
-				fmt.Printf("ASSERT_PRE_BURST_BOTH: at (%d,%d) burstSizeD=%d adjustedBurstSizeD=%d OK\n",
-					i, j, burstSizeD, adjustedBurstSizeD)
-			}
-		}
-	}
+// burstEvent is one lysis as written to bursts.csv (-burstLog)
+type burstEvent struct {
+	frame, i, j, prevState int
+	intraWT, intraDVG      int
+	burstV, burstD         int
+}
 
-	// DEBUG: log state and adjustedBurstSizeD at burst time (case 4)
-	fmt.Printf("DEBUG Burst state=%d at (%d,%d): burstSizeV=%d, adjustedBurstSizeD=%d, virionBurstMode=%s\n",
-		g.state[i][j], i, j, burstSizeV, adjustedBurstSizeD, virionBurstMode)
+// Function to report whether burst sizes follow the intracellular competition model
+func burstCompetition() bool {
+	return *flag_burstModel == "competition"
+}
 
-	// Get ALL neighbors from radius 1 to burstRadius (supports >10 via dynamic ring generation)
-	var neighbors [][2]int
-	var neighborsForDIP [][2]int
-	radius := g.burstRadius
-	radiusForDIP := *flag_dipRadius // DIP uses its own absolute radius
-	// Enforce and assert: when pre-lysis state is BOTH, use dipRadius for DIP burst radius
-	if preBurstState == INFECTED_BOTH {
-		if radiusForDIP != *flag_dipRadius {
-			radiusForDIP = *flag_dipRadius
-		}
-		fmt.Printf("ASSERT_BOTH_DIP_RADIUS: at (%d,%d) radiusD=%d dipRadiusFlag=%d\n", i, j, radiusForDIP, *flag_dipRadius)
-	}
-	if radius < 1 {
-		radius = 1
+// Function to pick the DIP burst of a release path: its ratio-adjusted value under
+// -burstModel=fixed, the competition value from lysisBurst otherwise
+func modelBurstD(fixed, competition int) int {
+	if burstCompetition() {
+		return competition
 	}
-	// Allow up to 30; >10 rings will be generated dynamically below
-	if radius > 30 {
-		radius = 30
-	}
-	if radiusForDIP < 1 {
-		radiusForDIP = 1
-	}
-	// Removed the upper limit restriction for DIP radius
+	return fixed
+}
 
-	// Collect ALL neighbors from radius 1 to the specified radius for virions (using precomputed arrays)
-	for r := 1; r <= radius; r++ {
-		switch r {
-		case 1:
-			for n := 0; n < 6; n++ {
-				neighbor := g.neighbors1[i][j][n]
-				if neighbor[0] >= 0 && neighbor[0] < GRID_SIZE && neighbor[1] >= 0 && neighbor[1] < GRID_SIZE {
-					neighbors = append(neighbors, neighbor)
-				}
-			}
-		case 2:
-			for n := 0; n < 12; n++ {
-				neighbor := g.neighbors2[i][j][n]
-				if neighbor[0] >= 0 && neighbor[0] < GRID_SIZE && neighbor[1] >= 0 && neighbor[1] < GRID_SIZE {
-					neighbors = append(neighbors, neighbor)
-				}
-			}
-		case 3:
-			for n := 0; n < 18; n++ {
-				neighbor := g.neighbors3[i][j][n]
-				if neighbor[0] >= 0 && neighbor[0] < GRID_SIZE && neighbor[1] >= 0 && neighbor[1] < GRID_SIZE {
-					neighbors = append(neighbors, neighbor)
-				}
-			}
-		case 4:
-			for n := 0; n < 24; n++ {
-				neighbor := g.neighbors4[i][j][n]
-				if neighbor[0] >= 0 && neighbor[0] < GRID_SIZE && neighbor[1] >= 0 && neighbor[1] < GRID_SIZE {
-					neighbors = append(neighbors, neighbor)
-				}
-			}
-		case 5:
-			for n := 0; n < 30; n++ {
-				neighbor := g.neighbors5[i][j][n]
-				if neighbor[0] >= 0 && neighbor[0] < GRID_SIZE && neighbor[1] >= 0 && neighbor[1] < GRID_SIZE {
-					neighbors = append(neighbors, neighbor)
-				}
-			}
-		case 6:
-			for n := 0; n < 36; n++ {
-				neighbor := g.neighbors6[i][j][n]
-				if neighbor[0] >= 0 && neighbor[0] < GRID_SIZE && neighbor[1] >= 0 && neighbor[1] < GRID_SIZE {
-					neighbors = append(neighbors, neighbor)
-				}
-			}
-		case 7:
-			for n := 0; n < 42; n++ {
-				neighbor := g.neighbors7[i][j][n]
-				if neighbor[0] >= 0 && neighbor[0] < GRID_SIZE && neighbor[1] >= 0 && neighbor[1] < GRID_SIZE {
-					neighbors = append(neighbors, neighbor)
-				}
-			}
-		case 8:
-			for n := 0; n < 48; n++ {
-				neighbor := g.neighbors8[i][j][n]
-				if neighbor[0] >= 0 && neighbor[0] < GRID_SIZE && neighbor[1] >= 0 && neighbor[1] < GRID_SIZE {
-					neighbors = append(neighbors, neighbor)
-				}
-			}
-		case 9:
-			for n := 0; n < 54; n++ {
-				neighbor := g.neighbors9[i][j][n]
-				if neighbor[0] >= 0 && neighbor[0] < GRID_SIZE && neighbor[1] >= 0 && neighbor[1] < GRID_SIZE {
-					neighbors = append(neighbors, neighbor)
-				}
-			}
-		case 10:
-			for n := 0; n < 60; n++ {
-				neighbor := g.neighbors10[i][j][n]
-				if neighbor[0] >= 0 && neighbor[0] < GRID_SIZE && neighbor[1] >= 0 && neighbor[1] < GRID_SIZE {
-					neighbors = append(neighbors, neighbor)
-				}
-			}
-		default:
-			// r > 10: dynamically generate exact ring r
-			for dx := -r; dx <= r; dx++ {
-				for dy := -r; dy <= r; dy++ {
-					if dx == 0 && dy == 0 {
-						continue
-					}
-					ni, nj := i+dx, j+dy
-					if ni >= 0 && ni < GRID_SIZE && nj >= 0 && nj < GRID_SIZE {
-						if getHexDistance(dx, dy) == r {
-							neighbors = append(neighbors, [2]int{ni, nj})
-						}
-					}
-				}
-			}
+// Function to compute the burst of cell (i,j) lysing from prevState. fixed: BURST_SIZE_V virions
+// (the DIP burst stays with each release path). competition: with W = intraWT and D = intraDVG,
+// BURST_SIZE_V*W/(W+c*D) virions and BURST_SIZE_D*D/(W+D) DIPs, counting at least one genome of
+// each type the cell is infected with (seeded cells and rounded-down bernoulli doses carry none).
+// The intracellular counts are cleared, and the burst is queued for bursts.csv under -burstLog.
+func (g *Grid) lysisBurst(i, j, prevState, frameNum int) (int, int) {
+	wt, dvg := g.intraWT[i][j], g.intraDVG[i][j]
+	burstV, burstD := BURST_SIZE_V, 0
+	if burstCompetition() {
+		if wt < 1 && (prevState == INFECTED_VIRION || prevState == INFECTED_BOTH) {
+			wt = 1
 		}
-	}
-
-	// Collect DIP neighbors within a circular radius (no sector/annular ring)
-	for r := 1; r <= radiusForDIP; r++ {
-		switch r {
-		case 1:
-			for n := 0; n < 6; n++ {
-				neighbor := g.neighbors1[i][j][n]
-				if neighbor[0] >= 0 && neighbor[0] < GRID_SIZE && neighbor[1] >= 0 && neighbor[1] < GRID_SIZE {
-					neighborsForDIP = append(neighborsForDIP, neighbor)
-				}
-			}
-		case 2:
-			for n := 0; n < 12; n++ {
-				neighbor := g.neighbors2[i][j][n]
-				if neighbor[0] >= 0 && neighbor[0] < GRID_SIZE && neighbor[1] >= 0 && neighbor[1] < GRID_SIZE {
-					neighborsForDIP = append(neighborsForDIP, neighbor)
-				}
-			}
-		case 3:
-			for n := 0; n < 18; n++ {
-				neighbor := g.neighbors3[i][j][n]
-				if neighbor[0] >= 0 && neighbor[0] < GRID_SIZE && neighbor[1] >= 0 && neighbor[1] < GRID_SIZE {
-					neighborsForDIP = append(neighborsForDIP, neighbor)
-				}
-			}
-		case 4:
-			for n := 0; n < 24; n++ {
-				neighbor := g.neighbors4[i][j][n]
-				if neighbor[0] >= 0 && neighbor[0] < GRID_SIZE && neighbor[1] >= 0 && neighbor[1] < GRID_SIZE {
-					neighborsForDIP = append(neighborsForDIP, neighbor)
-				}
-			}
-		case 5:
-			for n := 0; n < 30; n++ {
-				neighbor := g.neighbors5[i][j][n]
-				if neighbor[0] >= 0 && neighbor[0] < GRID_SIZE && neighbor[1] >= 0 && neighbor[1] < GRID_SIZE {
-					neighborsForDIP = append(neighborsForDIP, neighbor)
-				}
-			}
-		case 6:
-			for n := 0; n < 36; n++ {
-				neighbor := g.neighbors6[i][j][n]
-				if neighbor[0] >= 0 && neighbor[0] < GRID_SIZE && neighbor[1] >= 0 && neighbor[1] < GRID_SIZE {
-					neighborsForDIP = append(neighborsForDIP, neighbor)
-				}
-			}
-		case 7:
-			for n := 0; n < 42; n++ {
-				neighbor := g.neighbors7[i][j][n]
-				if neighbor[0] >= 0 && neighbor[0] < GRID_SIZE && neighbor[1] >= 0 && neighbor[1] < GRID_SIZE {
-					neighborsForDIP = append(neighborsForDIP, neighbor)
-				}
-			}
-		case 8:
-			for n := 0; n < 48; n++ {
-				neighbor := g.neighbors8[i][j][n]
-				if neighbor[0] >= 0 && neighbor[0] < GRID_SIZE && neighbor[1] >= 0 && neighbor[1] < GRID_SIZE {
-					neighborsForDIP = append(neighborsForDIP, neighbor)
-				}
-			}
-		case 9:
-			for n := 0; n < 54; n++ {
-				neighbor := g.neighbors9[i][j][n]
-				if neighbor[0] >= 0 && neighbor[0] < GRID_SIZE && neighbor[1] >= 0 && neighbor[1] < GRID_SIZE {
-					neighborsForDIP = append(neighborsForDIP, neighbor)
-				}
-			}
-		case 10:
-			for n := 0; n < 60; n++ {
-				neighbor := g.neighbors10[i][j][n]
-				if neighbor[0] >= 0 && neighbor[0] < GRID_SIZE && neighbor[1] >= 0 && neighbor[1] < GRID_SIZE {
-					neighborsForDIP = append(neighborsForDIP, neighbor)
-				}
-			}
-		default:
-			for dx := -r; dx <= r; dx++ {
-				for dy := -r; dy <= r; dy++ {
-					if dx == 0 && dy == 0 {
-						continue
-					}
-					ni, nj := i+dx, j+dy
-					if ni >= 0 && ni < GRID_SIZE && nj >= 0 && nj < GRID_SIZE {
-						if getHexDistance(dx, dy) == r {
-							neighborsForDIP = append(neighborsForDIP, [2]int{ni, nj})
-						}
-					}
-				}
-			}
+		if dvg < 1 && prevState == INFECTED_BOTH {
+			dvg = 1
 		}
+		w, d := float64(wt), float64(dvg)
+		if w+d > 0 {
+			burstV = int(math.Round(float64(BURST_SIZE_V) * w / (w + *flag_burstCompetition*d)))
+			burstD = int(math.Round(float64(BURST_SIZE_D) * d / (w + d)))
+		}
+		g.intraWT[i][j], g.intraDVG[i][j] = 0, 0
+	} else if *flag_burstLog && g.localVirions[i][j] > 0 {
+		// Logged DIP burst of the fixed model: the ratio adjustment of the release paths
+		burstD = BURST_SIZE_D + int(math.Floor(float64(BURST_SIZE_D)*float64(g.localDips[i][j])/float64(g.localVirions[i][j])))
 	}
+	if *flag_burstLog {
+		g.burstEvents = append(g.burstEvents, burstEvent{frameNum, i, j, prevState, wt, dvg, burstV, burstD})
+	}
+	return burstV, burstD
+}
 
-	fmt.Printf("Case 4 burst at [%d][%d] with radiusV=%d, radiusD=%d, using %d virion neighbors, %d DIP neighbors, burstSizeV=%d, adjustedBurstSizeD=%d\n",
-		i, j, radius, radiusForDIP, len(neighbors), len(neighborsForDIP), burstSizeV, adjustedBurstSizeD)
-
-	// Distribute virions using original radius
-	if len(neighbors) > 0 {
-		// Group neighbors by distance for weighted distribution
-		neighborsByDistance := make(map[float64][][2]int)
-		for _, neighbor := range neighbors {
-			ni, nj := neighbor[0], neighbor[1]
-			if ni >= 0 && ni < GRID_SIZE && nj >= 0 && nj < GRID_SIZE {
-				dx := float64(ni - i)
-				dy := float64(nj - j)
-				distance := math.Sqrt(dx*dx + dy*dy)
-				neighborsByDistance[distance] = append(neighborsByDistance[distance], neighbor)
-			}
-		}
+// Header of bursts.csv (-burstLog)
+func burstsHeader() []string {
+	return []string{"Time", "i", "j", "prevState", "intraWT", "intraDVG", "burstV", "burstD"}
+}
 
-		// Calculate total weight (inverse distance weighting)
-		totalWeight := 0.0
-		for distance := range neighborsByDistance {
-			weight := 1.0 / (distance + 0.1) // Closer neighbors get higher weight
-			totalWeight += weight * float64(len(neighborsByDistance[distance]))
+// Function to write the lysis events of the current frame to bursts.csv and clear them
+func (g *Grid) recordBursts(writer *atomicCSV, frameNum int) error {
+	if writer == nil {
+		return nil
+	}
+	for _, e := range g.burstEvents {
+		row := []string{
+			strconv.Itoa(e.frame * TIMESTEP),
+			strconv.Itoa(e.i),
+			strconv.Itoa(e.j),
+			strconv.Itoa(e.prevState),
+			strconv.Itoa(e.intraWT),
+			strconv.Itoa(e.intraDVG),
+			strconv.Itoa(e.burstV),
+			strconv.Itoa(e.burstD),
 		}
-
-		// Distribute virions by distance
-		virionsByDistance := make(map[float64]int)
-		for distance := range neighborsByDistance {
-			weight := 1.0 / (distance + 0.1)
-			virionsForDistance := int(math.Floor(float64(burstSizeV) *
-				(weight * float64(len(neighborsByDistance[distance]))) / totalWeight))
-			virionsByDistance[distance] = virionsForDistance
+		if err := writer.WriteRow(row); err != nil {
+			return fmt.Errorf("%w: failed to write bursts CSV row at frame %d: %v", ErrOutputIO, frameNum, err)
 		}
+	}
+	g.burstEvents = g.burstEvents[:0]
+	return nil
+}
 
-		// Distribute virions to neighbors
-		for distance, neighborsAtDistance := range neighborsByDistance {
-			virionsForThisDistance := virionsByDistance[distance]
-
-			if len(neighborsAtDistance) > 0 {
-				// Shuffle order within this ring to avoid directional bias
-				shuffled := make([][2]int, len(neighborsAtDistance))
-				copy(shuffled, neighborsAtDistance)
-				rand.Shuffle(len(shuffled), func(a, b int) { shuffled[a], shuffled[b] = shuffled[b], shuffled[a] })
-
-				virionsPerNeighbor := virionsForThisDistance / len(shuffled)
-				remainingVirions := virionsForThisDistance % len(shuffled)
-
-				for idx, neighbor := range shuffled {
-					ni, nj := neighbor[0], neighbor[1]
-					virionsToAdd := virionsPerNeighbor
-
-					if idx < remainingVirions {
-						virionsToAdd++
-					}
+// Particle types of perParticleChance
+const (
+	PARTICLE_VIRION = 0
+	PARTICLE_DIP    = 1
+)
 
-					g.localVirions[ni][nj] += virionsToAdd
-				}
-			}
-		}
+// Function to return the per-particle infection chance of particleType at IFN level localIFN (the
+// regional or global per-cell concentration of the calling branch), with the -virionIfnAlpha or
+// -dipIfnAlpha sensitivity. Both IFN branches call it, so they agree for the same level. The two
+// particle types keep the formulas the infection draws had before the alphas were split, and differ:
+//   - virions see RHO, unprotected, while R or TAU is 0 (R is 0 without VStimulateIFN), and the
+//     level divided by R otherwise, as virion-infected cells secrete R times the IFN;
+//   - DIPs see the undivided level whatever R and TAU are.
+//
+// With equal alphas the chances are equal only for R = 1 and TAU > 0, the defaults. Under
+// -ifnBothFold != 1 or without VStimulateIFN, DIP entry is the more IFN-sensitive of the two.
+func perParticleChance(particleType int, localIFN float64) float64 {
+	if particleType == PARTICLE_DIP {
+		return RHO * ifnProtection(ifnAlpha(*flag_dipIfnAlpha), localIFN)
+	}
+	if R == 0 || TAU == 0 {
+		return RHO
 	}
+	if VStimulateIFN {
+		localIFN /= float64(R)
+	}
+	return RHO * ifnProtection(ifnAlpha(*flag_virionIfnAlpha), localIFN)
+}
 
-	// Distribute DIPs to neighbors with the SAME distance-weighted strategy as virions
-	if len(neighborsForDIP) > 0 {
-		// Group DIP neighbors by distance
-		dipNeighborsByDistance := make(map[float64][][2]int)
-		for _, neighbor := range neighborsForDIP {
-			ni, nj := neighbor[0], neighbor[1]
-			if ni >= 0 && ni < GRID_SIZE && nj >= 0 && nj < GRID_SIZE {
-				dx := float64(ni - i)
-				dy := float64(nj - j)
-				distance := math.Sqrt(dx*dx + dy*dy)
-				dipNeighborsByDistance[distance] = append(dipNeighborsByDistance[distance], neighbor)
-			}
-		}
-
-		// Calculate total weight (inverse distance weighting)
-		dipTotalWeight := 0.0
-		for distance := range dipNeighborsByDistance {
-			weight := 1.0 / (distance + 0.1)
-			dipTotalWeight += weight * float64(len(dipNeighborsByDistance[distance]))
-		}
+// Function to resolve a per-particle-type IFN sensitivity flag: a negative value means ALPHA
+func ifnAlpha(flagValue float64) float64 {
+	if flagValue < 0 {
+		return ALPHA
+	}
+	return flagValue
+}
 
-		// Determine DIPs per distance bucket
-		dipsByDistance := make(map[float64]int)
-		for distance := range dipNeighborsByDistance {
-			weight := 1.0 / (distance + 0.1)
-			dipsForDistance := int(math.Floor(float64(adjustedBurstSizeD) *
-				(weight * float64(len(dipNeighborsByDistance[distance]))) / dipTotalWeight))
-			dipsByDistance[distance] = dipsForDistance
+// Function to return the factor by which IFN level ifn lowers the per-particle infection chance
+// (-ifnResponse): exp(-alpha*ifn), or 1 - ifn^n/(K^n + ifn^n), which levels off at 0 instead of
+// decaying without bound
+func ifnProtection(alpha, ifn float64) float64 {
+	if *flag_ifnResponse == "hill" {
+		if ifn <= 0 {
+			return 1
 		}
+		xn := math.Pow(ifn, *flag_ifnHillN)
+		return 1 - xn/(math.Pow(*flag_ifnHillK, *flag_ifnHillN)+xn)
+	}
+	return math.Exp(-alpha * ifn)
+}
 
-		// Distribute DIPs to neighbors within each distance bucket
-		distributedDIPs := 0
-		for distance, neighborsAtDistance := range dipNeighborsByDistance {
-			dipsForThisDistance := dipsByDistance[distance]
-			if len(neighborsAtDistance) > 0 {
-				// Shuffle order within this ring to avoid directional bias
-				shuffled := make([][2]int, len(neighborsAtDistance))
-				copy(shuffled, neighborsAtDistance)
-				rand.Shuffle(len(shuffled), func(a, b int) { shuffled[a], shuffled[b] = shuffled[b], shuffled[a] })
+// Function to draw one unscaled per-cell susceptibility from the lognormal with mean 1 and
+// log-scale sigma susceptibilitySigma
+func (g *Grid) sampleSusceptibility() float64 {
+	sigma := susceptibilitySigma
+	return math.Exp(-sigma*sigma/2 + sigma*g.rng.NormFloat64())
+}
 
-				dipsPerNeighbor := dipsForThisDistance / len(shuffled)
-				remaining := dipsForThisDistance % len(shuffled)
-				for idx, neighbor := range shuffled {
-					ni, nj := neighbor[0], neighbor[1]
-					dipsToAdd := dipsPerNeighbor
-					if idx < remaining {
-						dipsToAdd++
-					}
-					if dipsToAdd > 0 {
-						g.localDips[ni][nj] += dipsToAdd
-						distributedDIPs += dipsToAdd
-					}
-				}
-			}
-		}
+// Function to parse -rhoDistribution ("constant" or "lognormal:sigma=S") into the log-scale sigma
+func parseRhoDistribution(spec string) (float64, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "constant" {
+		return 0, nil
+	}
+	rest, ok := strings.CutPrefix(spec, "lognormal:")
+	if !ok {
+		return 0, fmt.Errorf("%q (expected constant or lognormal:sigma=S)", spec)
+	}
+	value, ok := strings.CutPrefix(strings.TrimSpace(rest), "sigma=")
+	if !ok {
+		return 0, fmt.Errorf("%q (expected lognormal:sigma=S)", spec)
+	}
+	sigma, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || sigma < 0 || math.IsNaN(sigma) || math.IsInf(sigma, 0) {
+		return 0, fmt.Errorf("%q: sigma must be a number >= 0", spec)
+	}
+	return sigma, nil
+}
 
-		// Handle rounding leftovers: if any remain, give to closest ring (distance minimum)
-		remainingDIPs := adjustedBurstSizeD - distributedDIPs
-		if remainingDIPs > 0 {
-			// find minimal distance bucket
-			minDist := math.MaxFloat64
-			for d := range dipNeighborsByDistance {
-				if d < minDist {
-					minDist = d
-				}
-			}
-			if neighborsAtMin, ok := dipNeighborsByDistance[minDist]; ok {
-				// Randomize starting index to avoid fixed-direction bias
-				start := 0
-				if len(neighborsAtMin) > 1 {
-					start = rand.Intn(len(neighborsAtMin))
-				}
-				idx := 0
-				for remainingDIPs > 0 && len(neighborsAtMin) > 0 {
-					spot := neighborsAtMin[(start+idx)%len(neighborsAtMin)]
-					ni, nj := spot[0], spot[1]
-					g.localDips[ni][nj]++
-					remainingDIPs--
-					idx++
-				}
-			}
-		}
+// Function to scale a per-particle virion infection chance by the cell's susceptibility, capped at 1
+func (g *Grid) susceptibleChance(p float64, i, j int) float64 {
+	if s := g.cellSusceptibility[i][j]; s != 1 {
+		return math.Min(p*s, 1)
 	}
-	fmt.Printf("Case 4 burst completed - distributed virions to %d neighbors, DIPs to %d neighbors\n", len(neighbors), len(neighborsForDIP))
+	return p
 }
 
-// Helper function to clear viral particles from dead cell locations
-func (g *Grid) clearParticlesFromDeadCells() {
+// Function to return the realized mean and variance of the per-cell susceptibility
+func (g *Grid) susceptibilityMoments() (mean, variance float64) {
+	n := float64(GRID_SIZE * GRID_SIZE)
 	for i := 0; i < GRID_SIZE; i++ {
 		for j := 0; j < GRID_SIZE; j++ {
-			if g.state[i][j] == DEAD {
-				// Clear all extracellular virions and DIPs from dead cell locations
-				g.localVirions[i][j] = 0
-				g.localDips[i][j] = 0
-			}
+			mean += g.cellSusceptibility[i][j]
+		}
+	}
+	mean /= n
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			d := g.cellSusceptibility[i][j] - mean
+			variance += d * d
 		}
 	}
+	return mean, variance / n
 }
 
-// Generate DIP clearance time using normal distribution (mean=2, std=1)
-func (g *Grid) generateDipClearanceTime() int {
-	// Generate time using normal distribution with mean=2, std=1
-	clearanceTime := int(rand.NormFloat64()*1.0 + 2.0)
-	// Ensure minimum clearance time of 1 hour
-	if clearanceTime < 1 {
-		clearanceTime = 1
+// Function to report whether an infected cell is still inside its superinfection exclusion
+// window (-superinfectionExclusionHours), counted from the frame its infection was first seen
+func (g *Grid) inSuperinfectionExclusion(i, j, frameNum int) bool {
+	if *flag_superinfectionExclusionHours <= 0 || g.infectionStartFrame[i][j] < 0 {
+		return false
 	}
-	return clearanceTime
+	return float64((frameNum-g.infectionStartFrame[i][j])*TIMESTEP) < *flag_superinfectionExclusionHours
 }
 
-// Handle DIP-only infected cells clearance (become susceptible after mean=2±1 hours if still DIP-only)
-func (g *Grid) handleDipOnlyClearance(frameNum int) {
-	dipOnlyClearedCount := 0
+// Function to report whether a burst-mode virion/both infected cell is still in its eclipse
+// phase (-eclipsePeriod), during which it can neither lyse nor stimulate IFN. The period is
+// drawn once per infection, like the lysis time; nothing is drawn while the option is off.
+func (g *Grid) inEclipse(i, j int) bool {
+	if *flag_eclipsePeriod <= 0 {
+		return false
+	}
+	if g.eclipseThreshold[i][j] == -1 {
+		g.eclipseThreshold[i][j] = int(g.rng.NormFloat64()**flag_eclipseStd + *flag_eclipsePeriod)
+		if g.eclipseThreshold[i][j] < 0 {
+			g.eclipseThreshold[i][j] = 0
+		}
+	}
+	return g.timeSinceInfectVorBoth[i][j] < g.eclipseThreshold[i][j]
+}
 
+// Function to check whether no cell holds any IFN
+func (g *Grid) ifnFieldEmpty() bool {
 	for i := 0; i < GRID_SIZE; i++ {
 		for j := 0; j < GRID_SIZE; j++ {
-			// Handle both burst mode (INFECTED_DIP) and continuous mode (INFECTED_DIP_CONTINUOUS)
-			if g.state[i][j] == INFECTED_DIP || g.state[i][j] == INFECTED_DIP_CONTINUOUS {
-				// Set clearance threshold if not already set
-				if g.dipClearanceThreshold[i][j] == -1 {
-					g.dipClearanceThreshold[i][j] = g.generateDipClearanceTime()
-				}
-
-				// Check if DIP clearance time has been reached
-				if g.timeSinceInfectDIP[i][j] >= g.dipClearanceThreshold[i][j] {
-					// Clear DIP-only infected cell back to susceptible
-					g.state[i][j] = SUSCEPTIBLE
-					g.timeSinceInfectDIP[i][j] = -1
-					g.dipClearanceThreshold[i][j] = -1
-					g.timeSinceSusceptible[i][j] = 0
-					g.isProducing[i][j] = false // Reset continuous production flag
-					dipOnlyClearedCount++
-				}
+			if g.IFNConcentration[i][j] != 0 {
+				return false
 			}
 		}
 	}
-
-	if dipOnlyClearedCount > 0 {
-		fmt.Printf("🔄 Frame %d: %d DIP-only infected cells cleared and became susceptible\n", frameNum, dipOnlyClearedCount)
-	}
+	return true
 }
 
-// Test function to verify that dead cells have no viral particles
-func (g *Grid) testDeadCellParticleClearance(frameNum int) {
-	deadCellsWithParticles := 0
-	totalDeadCells := 0
-
+// Function to apply one half-life decay step to the IFN field, zeroing cells that fall below
+// one cell's share; reports whether no IFN is left anywhere
+func (g *Grid) decayIFN(factorIFN float64) bool {
+	fieldZero := true
 	for i := 0; i < GRID_SIZE; i++ {
 		for j := 0; j < GRID_SIZE; j++ {
-			if g.state[i][j] == DEAD {
-				totalDeadCells++
-				if g.localVirions[i][j] > 0 || g.localDips[i][j] > 0 {
-					deadCellsWithParticles++
-					fmt.Printf("⚠️  Frame %d: Dead cell at (%d,%d) has %d virions and %d DIPs!\n",
-						frameNum, i, j, g.localVirions[i][j], g.localDips[i][j])
-				}
+			if g.IFNConcentration[i][j] == 0 {
+				continue
+			}
+			g.ifnRowSums.valid = false
+			// Update IFN amount using half-life formula
+			g.IFNConcentration[i][j] *= factorIFN
+			// Remove IFN if concentration is below threshold
+			if g.IFNConcentration[i][j] < (1.0 / (float64(GRID_SIZE) * float64(GRID_SIZE))) {
+				g.IFNConcentration[i][j] = 0
+			} else {
+				fieldZero = false
 			}
 		}
 	}
+	return fieldZero
+}
 
-	if deadCellsWithParticles == 0 && totalDeadCells > 0 {
-		fmt.Printf("✅ Frame %d: All %d dead cells have 0 viral particles (test passed)\n", frameNum, totalDeadCells)
-	} else if totalDeadCells == 0 {
-		// No dead cells to test - this is normal in early frames
-	} else {
-		fmt.Printf("❌ Frame %d: %d out of %d dead cells still have viral particles (test failed)\n",
-			frameNum, deadCellsWithParticles, totalDeadCells)
+// Function to return the six cells touching (i,j) on the rendered hex layout (odd columns i
+// shifted down half a cell, see calculateHexCenter). Unlike neighbors1 the relation is
+// symmetric, which diffusion needs to conserve mass.
+func layoutHexNeighbors(i, j int) [6][2]int {
+	shift := -1 // even column: the side neighbors sit at rows j-1 and j
+	if i&1 == 1 {
+		shift = 0
+	}
+	return [6][2]int{
+		{i, j - 1}, {i, j + 1},
+		{i - 1, j + shift}, {i - 1, j + shift + 1},
+		{i + 1, j + shift}, {i + 1, j + shift + 1},
 	}
 }
 
-// Update the state of the grid at each time step
-func (g *Grid) update(frameNum int) {
-	newGrid := g.state
-
-	if ifnWave == true {
+// Function to diffuse the IFN field over the hex lattice for dt*D (cell spacings^2): each cell
+// exchanges a*(c_neighbor - c) with each of its layoutHexNeighbors, a = 2*D*dt/3 (the hex-lattice
+// Laplacian), in substeps of at most 1/12 so the explicit scheme stays stable. Exchanges are
+// pairwise, so the total is conserved; open boundaries are no-flux.
+func (g *Grid) diffuseIFN(dDt float64) {
+	if dDt <= 0 {
+		return
+	}
+	a := 2 * dDt / 3
+	substeps := int(math.Ceil(12 * a))
+	a /= float64(substeps)
+	for step := 0; step < substeps; step++ {
+		next := g.IFNConcentration
 		for i := 0; i < GRID_SIZE; i++ {
 			for j := 0; j < GRID_SIZE; j++ {
-				g.stateChanged[i][j] = false
-
+				c := g.IFNConcentration[i][j]
+				for _, neighbor := range layoutHexNeighbors(i, j) {
+					ni, nj, ok := wrapCell(neighbor[0], neighbor[1])
+					if ok {
+						next[i][j] += a * (g.IFNConcentration[ni][nj] - c)
+					}
+				}
 			}
 		}
+		g.IFNConcentration = next
+	}
+	g.ifnRowSums.valid = false
+}
 
-		// Step 3: Update max global IFN if needed
-		if globalIFN < 0 {
-			globalIFN = -1.0
-		}
-		if globalIFN > maxGlobalIFN {
-
-			maxGlobalIFN = globalIFN
+// Function to add a release to the current frame's released-particle counts
+func (g *Grid) countRelease(virions, dips int) {
+	g.releasedVirionsNow += virions
+	g.releasedDIPsNow += dips
+}
 
-		}
-		fmt.Printf("Global IFN concentration: %.2f\n", globalIFN)
+// Function to put particles that have no neighbor to go to back onto the source cell
+func (g *Grid) depositUndistributedParticles(i, j, virions, dips int, source string) {
+	if virions <= 0 && dips <= 0 {
+		return
+	}
+	g.localVirions[i][j] += virions
+	g.localDips[i][j] += dips
+	if *flag_conservationCheck {
+		fmt.Printf("⚠️  Mass-loss warning: %s at (%d,%d) has no neighbors, kept %d virions and %d DIPs on the source cell\n",
+			source, i, j, virions, dips)
+	}
+}
 
-		// Traverse the grid
-		for i := 0; i < GRID_SIZE; i++ {
-			for j := 0; j < GRID_SIZE; j++ {
-				// Skip UNEXPOSED cells entirely (never change)
-				if g.state[i][j] == UNEXPOSED {
-					continue
-				}
-				// Only consider cells that are in the SUSCEPTIBLE or REGROWTH state
-
-				var regional_sumIFN float64
-				neighborsCount := len(g.neighborsIFNArea[i][j])
-
-				if ifn_half_life != 0 {
-					for i := 0; i < GRID_SIZE; i++ {
-						for j := 0; j < GRID_SIZE; j++ {
-							// Update IFN amount using half-life formula
-							factorIFN := math.Pow(0.5, float64(TIMESTEP)/ifn_half_life)
-							g.IFNConcentration[i][j] *= factorIFN
-							// Remove IFN if concentration is below threshold
-							if g.IFNConcentration[i][j] < (1.0 / (float64(GRID_SIZE) * float64(GRID_SIZE))) {
-								g.IFNConcentration[i][j] = 0
-							}
-						}
-					}
-				}
+// Handle burst or continuous production based on Case 4 mode; burstV and competitionD are the
+// lysis burst sizes from lysisBurst
+func (g *Grid) handleViralProduction(i, j, frameNum, burstV, competitionD int) {
+	// Check if this is Case 4 and continuous mode is enabled
+	if g.initOption == 4 && g.continuousMode {
+		// Use continuous production mode
+		debugf("🔧 handleViralProduction: Case 4 continuous mode enabled, calling handleContinuousProduction\n")
+		g.handleContinuousProduction(i, j, frameNum)
+	} else {
+		// Use traditional burst mode (all cases including Case 4 burst mode)
+		debugf("🔧 handleViralProduction: Using burst mode (initOption=%d, continuousMode=%t), calling handleCase4Burst for cell (%d,%d)\n", g.initOption, g.continuousMode, i, j)
+		g.handleCase4Burst(i, j, burstV, BURST_SIZE_D, competitionD, k_JumpR)
+	}
+}
 
-				// Sum the IFN concentration within the IFN area
-				for _, neighbor := range g.neighborsIFNArea[i][j] {
-					ni, nj := neighbor[0], neighbor[1]
+// Handle Case 4 burst with 0716 logic (transplanted from 0716 version)
+func (g *Grid) handleCase4Burst(i, j, burstSizeV, burstSizeD, competitionD int, kJumpR float64) {
+	// Calculate adjusted burst size for DIPs based on local ratio (like 0716 version)
+	totalVirionsAtCell := g.localVirions[i][j]
+	totalDIPsAtCell := g.localDips[i][j]
+	adjustedBurstSizeD := 0
 
-					regional_sumIFN += g.IFNConcentration[ni][nj]
-				}
-
-				// Calculate the average IFN concentration if there are neighbors within the radius
-				var regionalAverageIFN float64
-				if neighborsCount > 0 {
-					regionalAverageIFN = regional_sumIFN / float64(neighborsCount)
-				} else {
-					regionalAverageIFN = 0 // Default to 0 if no neighbors, though this should rarely occur
-				}
-
-				if g.state[i][j] == SUSCEPTIBLE || g.state[i][j] == REGROWTH || g.state[i][j] == INFECTED_DIP || g.state[i][j] == INFECTED_DIP_CONTINUOUS {
-					if g.IFNConcentration[i][j] > 0 && TAU > 0 {
-
-						if g.antiviralDuration[i][j] <= -1 {
-							g.antiviralDuration[i][j] = int(rand.NormFloat64()*float64(TAU)/4 + float64(TAU))
-							g.timeSinceAntiviral[i][j] = 0
-						} else if g.timeSinceAntiviral[i][j] <= int(g.antiviralDuration[i][j]) {
-							g.timeSinceAntiviral[i][j] += TIMESTEP
-						} else {
-
-							g.previousStates[i][j] = g.state[i][j]
-							newGrid[i][j] = ANTIVIRAL
-
-							g.timeSinceAntiviral[i][j] = -2
-							g.totalAntiviralTime += g.antiviralDuration[i][j]
-							if g.state[i][j] == ANTIVIRAL && !g.antiviralFlag[i][j] {
-								g.antiviralFlag[i][j] = true
-								g.antiviralCellCount++
-							}
-
-						}
-					}
-
-					if g.state[i][j] == SUSCEPTIBLE || g.state[i][j] == REGROWTH {
-						// Check if the cell is infected by virions or DIPs
-						if g.localVirions[i][j] > 0 || g.localDips[i][j] > 0 {
-							// Calculate the infection probabilities
-							if R == 0 || TAU == 0 {
-								perParticleInfectionChance_V = RHO
-							} else if VStimulateIFN == true && R > 0 { // R=1
-								perParticleInfectionChance_V = RHO * math.Exp(-ALPHA*(regionalAverageIFN/float64(R)))
-							} else if !VStimulateIFN { // usually only DIP stimulate IFN in this situlation
-								perParticleInfectionChance_V = RHO * math.Exp(-ALPHA*(regionalAverageIFN))
-							}
-							var probabilityVInfection, probabilityDInfection float64
-
-							// Virion infection probability
-							probabilityVInfection = 1 - math.Pow(1-perParticleInfectionChance_V, float64(g.localVirions[i][j]))
-							infectedByVirion := rand.Float64() <= probabilityVInfection
-
-							// DIP infection probability
-							probabilityDInfection = 1 - math.Pow(1-(RHO*math.Exp(-ALPHA*(regionalAverageIFN))), float64(g.localDips[i][j]))
-							infectedByDip := rand.Float64() <= probabilityDInfection
-
-							// Determine the infection state based on virion and DIP infection
-							if infectedByVirion && infectedByDip {
-								if g.continuousMode {
-									newGrid[i][j] = INFECTED_BOTH_CONTINUOUS
-								} else {
-									newGrid[i][j] = INFECTED_BOTH
-								}
-								g.timeSinceSusceptible[i][j] = -1
-								g.timeSinceRegrowth[i][j] = -1
-								// Record intracellular virus counts for continuous mode
-								if g.continuousMode {
-									// Calculate actual number of infecting virions and DIPs
-									infectingVirions := int(math.Round(float64(g.localVirions[i][j]) * probabilityVInfection))
-									infectingDIPs := int(math.Round(float64(g.localDips[i][j]) * probabilityDInfection))
-									if infectingVirions > 0 {
-										g.intraWT[i][j] += infectingVirions
-									}
-									if infectingDIPs > 0 {
-										g.intraDVG[i][j] += infectingDIPs
-									}
-									g.infectionTime[i][j] = frameNum
-								}
-							} else if infectedByVirion {
-								if g.continuousMode {
-									newGrid[i][j] = INFECTED_VIRION_CONTINUOUS
-								} else {
-									newGrid[i][j] = INFECTED_VIRION
-								}
-								g.timeSinceSusceptible[i][j] = -1
-								g.timeSinceRegrowth[i][j] = -1
-								// Record intracellular virus count for continuous mode
-								if g.continuousMode {
-									// Calculate actual number of infecting virions
-									infectingVirions := int(math.Round(float64(g.localVirions[i][j]) * probabilityVInfection))
-									if infectingVirions > 0 {
-										g.intraWT[i][j] += infectingVirions
-									}
-									g.infectionTime[i][j] = frameNum
-								}
-							} else if infectedByDip {
-								if g.continuousMode {
-									newGrid[i][j] = INFECTED_DIP_CONTINUOUS
-								} else {
-									newGrid[i][j] = INFECTED_DIP
-								}
-								g.timeSinceSusceptible[i][j] = -1
-								g.timeSinceRegrowth[i][j] = -1
-								// Record intracellular DVG count for continuous mode
-								if g.continuousMode {
-									// Calculate actual number of infecting DIPs
-									infectingDIPs := int(math.Round(float64(g.localDips[i][j]) * probabilityDInfection))
-									if infectingDIPs > 0 {
-										g.intraDVG[i][j] += infectingDIPs
-									}
-									g.infectionTime[i][j] = frameNum
-								}
-							}
-						}
+	if totalVirionsAtCell > 0 {
+		dipVirionRatio := float64(totalDIPsAtCell) / float64(totalVirionsAtCell)
+		adjustedBurstSizeD = burstSizeD + int(float64(burstSizeD)*dipVirionRatio)
+	}
 
-						// Mark the state as changed if the cell is infected
-						if newGrid[i][j] != g.state[i][j] {
-							g.stateChanged[i][j] = true
-						}
-					}
+	// Under hotspot restriction, prevent DIPs from virion-only bursts when no DIPs present
+	if *flag_dipRestrictToHotspot && totalDIPsAtCell == 0 && g.state[i][j] == INFECTED_VIRION {
+		adjustedBurstSizeD = 0
+	}
 
-				}
+	// Guard: DIP-only cells should not release any virions (and we also set DIPs to 0 here; DIP-only clears elsewhere)
+	if isInfectedDIPOnly(g.state[i][j]) {
+		burstSizeV = 0
+		adjustedBurstSizeD = 0
+	}
 
+	// If restricted, forbid any DIP release during bursts; else apply virion-only rule
+	if *flag_dipRestrictToHotspot {
+		// Under restriction, only virion-only bursts are blocked from releasing DIPs
+		if g.state[i][j] == INFECTED_VIRION {
+			adjustedBurstSizeD = 0
+		}
+	} else {
+		// Virion-only infected cells: DIP release depends on virionBurstMode
+		if g.state[i][j] == INFECTED_VIRION {
+			if virionBurstMode == "virionOnly" {
+				adjustedBurstSizeD = 0
 			}
 		}
+	}
 
-		// Process infected cells
-		for i := 0; i < GRID_SIZE; i++ {
-			for j := 0; j < GRID_SIZE; j++ {
-
-				var regional_sumIFN float64
-
-				// Sum the IFN concentration within the IFN area
-				for _, neighbor := range g.neighborsIFNArea[i][j] {
-					ni, nj := neighbor[0], neighbor[1]
-					regional_sumIFN += g.IFNConcentration[ni][nj]
-				}
-
-				// Note: regionalAverageIFN is not used in this section
-
-				if g.state[i][j] == INFECTED_VIRION || g.state[i][j] == INFECTED_DIP || g.state[i][j] == INFECTED_DIP_CONTINUOUS || g.state[i][j] == INFECTED_BOTH ||
-					g.state[i][j] == INFECTED_VIRION_CONTINUOUS || g.state[i][j] == INFECTED_DIP || g.state[i][j] == INFECTED_DIP_CONTINUOUS || g.state[i][j] == INFECTED_BOTH_CONTINUOUS {
-					fmt.Printf("🔍 DEBUG: Processing infected cell at (%d,%d) with state %d at frame %d\n", i, j, g.state[i][j], frameNum)
-
-					// Handle burst mode cells (lysis logic)
-					if g.state[i][j] == INFECTED_VIRION || g.state[i][j] == INFECTED_BOTH {
-						if g.lysisThreshold[i][j] == -1 {
-							g.lysisThreshold[i][j] = int(rand.NormFloat64()*STANDARD_LYSIS_TIME + MEAN_LYSIS_TIME)
-						}
-						g.timeSinceInfectVorBoth[i][j] += TIMESTEP
-						g.timeSinceInfectDIP[i][j] = -1
-
-						// Check if the cell should lyse and release virions and DIPs
-						if g.lysisThreshold[i][j] > 0 && g.timeSinceInfectVorBoth[i][j] >= g.lysisThreshold[i][j] {
-
-							// After lysis, the cell becomes DEAD and virions and DIPs are spread to neighbors
-							if g.state[i][j] == INFECTED_VIRION {
-								totalDeadFromV++ // Increase INFECTED_VIRION death count
-							} else if g.state[i][j] == INFECTED_BOTH {
-								totalDeadFromBoth++ // Increase INFECTED_BOTH death count
-							}
-
-							prevState := g.state[i][j]
-							g.previousStates[i][j] = prevState // Save the previous state before death
-							newGrid[i][j] = DEAD
-							g.state[i][j] = DEAD
-							g.timeSinceDead[i][j] = 0
-							g.timeSinceInfectVorBoth[i][j] = -1
-							g.timeSinceInfectDIP[i][j] = -1
-							g.lysisThreshold[i][j] = -1
-
-							///////////// for k_jumpR percent cells that jump reandomly
-							if par_celltocell_random == true {
-								// Calculate adjusted burst size for DIPs based on local ratio
-								totalVirionsAtCell := g.localVirions[i][j]
-								totalDIPsAtCell := g.localDips[i][j]
-								adjustedBurstSizeD := BURST_SIZE_D
-								if totalVirionsAtCell > 0 {
-									dipVirionRatio := float64(totalDIPsAtCell) / float64(totalVirionsAtCell)
-									adjustedBurstSizeD += int(float64(BURST_SIZE_D) * dipVirionRatio)
-								}
-								if prevState == INFECTED_VIRION {
-									adjustedBurstSizeD = 0
-								}
-								//  ---------------------------------------
-								// Partition mode: split particles between random jump and cell-to-cell
-								randomVirions := int(math.Floor(float64(BURST_SIZE_V) * k_JumpR))
-								virionsForLocalDiffusion := BURST_SIZE_V - randomVirions
-
-								randomDIPs := int(math.Floor(float64(adjustedBurstSizeD) * k_JumpR))
-								dipsForLocalDiffusion := adjustedBurstSizeD - randomDIPs
-
-								// Handle random jumps
-								for v := 0; v < randomVirions; v++ {
-									ni, nj := rand.Intn(GRID_SIZE), rand.Intn(GRID_SIZE)
-									g.localVirions[ni][nj]++
-									g.totalRandomJumpVirions++
-								}
-								for d := 0; d < randomDIPs; d++ {
-									ni, nj := rand.Intn(GRID_SIZE), rand.Intn(GRID_SIZE)
-									g.localDips[ni][nj]++
-									g.totalRandomJumpDIPs++
-								}
-
-								// Handle local diffusion
-								// Handle local diffusion with localVirions & localDIPs (keep original logic unchanged)
-								if virionsForLocalDiffusion > 0 || dipsForLocalDiffusion > 0 {
-									// Calculate the total number of valid neighbors
-									totalNeighbors := 0
-
-									// Count valid neighbors from neighbors1
-									for _, dir := range g.neighbors1[i][j] {
-										if dir != [2]int{-1, -1} {
-											totalNeighbors++
-										}
-									}
-									// Count valid neighbors from neighbors2
-									for _, dir := range g.neighbors2[i][j] {
-										if dir != [2]int{-1, -1} {
-											totalNeighbors++
-										}
-									}
-									// Count valid neighbors from neighbors3
-									for _, dir := range g.neighbors3[i][j] {
-										if dir != [2]int{-1, -1} {
-											totalNeighbors++
-										}
-									}
-
-									if totalNeighbors == 0 {
-										return
-									}
-
-									// Calculate the distribution based on the ratio √3 : 2√3 : 3
-									sqrt3 := math.Sqrt(3)
-									ratio1 := 1.0               // sqrt3     // Weight for neighbors1
-									ratio2 := 1.0 / 2           // 2 * sqrt3 // Weight for neighbors2
-									ratio3 := 1.0 / (3 / sqrt3) // 3.0       // Weight for neighbors3
-									totalRatio := ratio1*float64(len(g.neighbors1[i][j])) +
-										ratio2*float64(len(g.neighbors2[i][j])) +
-										ratio3*float64(len(g.neighbors3[i][j]))
-
-									// Calculate virions for each neighbor group
-									virionsForNeighbors1 := int(math.Floor(float64(virionsForLocalDiffusion) * (ratio1 * float64(len(g.neighbors1[i][j]))) / totalRatio))
-									virionsForNeighbors2 := int(math.Floor(float64(virionsForLocalDiffusion) * (ratio2 * float64(len(g.neighbors2[i][j]))) / totalRatio))
-									virionsForNeighbors3 := int(math.Floor(float64(virionsForLocalDiffusion) * (ratio3 * float64(len(g.neighbors3[i][j]))) / totalRatio))
-
-									// Calculate remaining virions
-									remainingVirions := virionsForLocalDiffusion - (virionsForNeighbors1 + virionsForNeighbors2 + virionsForNeighbors3)
-
-									// Distribute remaining virions based on ratio
-									for remainingVirions > 0 {
-										randVal := rand.Float64() * totalRatio
-										if randVal < ratio1 && len(g.neighbors1[i][j]) > 0 {
-											virionsForNeighbors1++
-										} else if randVal < (ratio1+ratio2) && len(g.neighbors2[i][j]) > 0 {
-											virionsForNeighbors2++
-										} else if len(g.neighbors3[i][j]) > 0 {
-											virionsForNeighbors3++
-										}
-										remainingVirions--
-									}
-
-									// Calculate DIPs for each neighbor group (same logic)
-									dipsForNeighbors1 := int(math.Floor(float64(dipsForLocalDiffusion) * (ratio1 * float64(len(g.neighbors1[i][j]))) / totalRatio))
-									dipsForNeighbors2 := int(math.Floor(float64(dipsForLocalDiffusion) * (ratio2 * float64(len(g.neighbors2[i][j]))) / totalRatio))
-									dipsForNeighbors3 := int(math.Floor(float64(dipsForLocalDiffusion) * (ratio3 * float64(len(g.neighbors3[i][j]))) / totalRatio))
-
-									remainingDIPs := dipsForLocalDiffusion - (dipsForNeighbors1 + dipsForNeighbors2 + dipsForNeighbors3)
-
-									for remainingDIPs > 0 {
-										randVal := rand.Float64() * totalRatio
-										if randVal < ratio1 && len(g.neighbors1[i][j]) > 0 {
-											dipsForNeighbors1++
-										} else if randVal < (ratio1+ratio2) && len(g.neighbors2[i][j]) > 0 {
-											dipsForNeighbors2++
-										} else if len(g.neighbors3[i][j]) > 0 {
-											dipsForNeighbors3++
-										}
-										remainingDIPs--
-									}
-
-									// Distribute virions to neighbors1
-									for _, dir := range g.neighbors1[i][j] {
-										ni, nj := dir[0], dir[1]
-										if dir != [2]int{-1, -1} && ni >= 0 && ni < GRID_SIZE && nj >= 0 && nj < GRID_SIZE {
-											if g.state[ni][nj] == SUSCEPTIBLE {
-												g.localVirions[ni][nj] += virionsForNeighbors1 / len(g.neighbors1[i][j])
-												g.localDips[ni][nj] += dipsForNeighbors1 / len(g.neighbors1[i][j])
-											}
-										}
-									}
-
-									// Distribute virions to neighbors2
-									for _, dir := range g.neighbors2[i][j] {
-										ni, nj := dir[0], dir[1]
-										if dir != [2]int{-1, -1} && ni >= 0 && ni < GRID_SIZE && nj >= 0 && nj < GRID_SIZE {
-											g.localVirions[ni][nj] += virionsForNeighbors2 / len(g.neighbors2[i][j])
-											g.localDips[ni][nj] += dipsForNeighbors2 / len(g.neighbors2[i][j])
-										}
-									}
-
-									// Distribute virions to neighbors3
-									for _, dir := range g.neighbors3[i][j] {
-										ni, nj := dir[0], dir[1]
-										if dir != [2]int{-1, -1} && ni >= 0 && ni < GRID_SIZE && nj >= 0 && nj < GRID_SIZE {
-											g.localVirions[ni][nj] += virionsForNeighbors3 / len(g.neighbors3[i][j])
-											g.localDips[ni][nj] += dipsForNeighbors3 / len(g.neighbors3[i][j])
-										}
-									}
-								}
-
-							} else if par_celltocell_random == false {
-								//////////////////////////////
-								fmt.Println("parition particles jump celltocell and randomly is false")
-
-								if !allowVirionJump && !allowDIPJump {
-									fmt.Println("Virion and DIP jump are both disabled, using viral production logic")
-									// Use the new viral production function (burst or continuous based on case 4 mode)
-									g.handleViralProduction(i, j, frameNum)
-									// Skip the old complex logic by jumping to the end of this condition
-									goto skipOldLogic
-
-									// Calculate the distribution of virions and DIPs to each neighbor based on the ratio √3 : 2√3 : 3
-									sqrt3 := math.Sqrt(3)
-									ratio1 := 1.0               // sqrt3     // Weight for neighbors1
-									ratio2 := 1.0 / 2           // 2 * sqrt3 // Weight for neighbors2
-									ratio3 := 1.0 / (3 / sqrt3) // 3.0 // Weight for neighbors3
-									totalRatio := ratio1*float64(len(g.neighbors1[i][j])) + ratio2*float64(len(g.neighbors2[i][j])) + ratio3*float64(len(g.neighbors3[i][j]))
-									// if infected by virion or infected by both:
-									// Calculate the number of virions and DIPs assigned to each type of neighbor
-									virionsForNeighbors1 := int(math.Floor(float64(BURST_SIZE_V) * (ratio1 * float64(len(g.neighbors1[i][j]))) / totalRatio))
-									virionsForNeighbors2 := int(math.Floor(float64(BURST_SIZE_V) * (ratio2 * float64(len(g.neighbors2[i][j]))) / totalRatio))
-									virionsForNeighbors3 := int(math.Floor(float64(BURST_SIZE_V) * (ratio3 * float64(len(g.neighbors3[i][j]))) / totalRatio))
-
-									// Calculate the remaining virions and DIPs
-									remainingVirions := BURST_SIZE_V - (virionsForNeighbors1 + virionsForNeighbors2 + virionsForNeighbors3)
-
-									// // Randomly distribute the remaining virions based on the ratio
-									for remainingVirions > 0 {
-										randVal := rand.Float64() * totalRatio
-										if randVal < ratio1 && len(g.neighbors1[i][j]) > 0 {
-											virionsForNeighbors1++
-										} else if randVal < (ratio1+ratio2) && len(g.neighbors2[i][j]) > 0 {
-											virionsForNeighbors2++
-										} else if len(g.neighbors3[i][j]) > 0 {
-											virionsForNeighbors3++
-										}
-										remainingVirions--
-									}
-									// if infected by vrion only or both:
-
-									totalVirionsAtCell := g.localVirions[i][j]
-									totalDIPsAtCell := g.localDips[i][j]
-
-									// Ensure we avoid division by zero
-									adjustedBurstSizeD := 0
-									if totalVirionsAtCell > 0 {
-										// Adjust BURST_SIZE_D based on the DIP-to-virion ratio at this cell
-										dipVirionRatio := float64(totalDIPsAtCell) / float64(totalVirionsAtCell)
-										adjustedBurstSizeD = BURST_SIZE_D + int(math.Floor(float64(BURST_SIZE_D)*dipVirionRatio))
-									}
-
-									// Distribute DIPs to neighbors based on the adjusted BURST_SIZE_D
-									dipsForNeighbors1 := int(math.Floor(float64(adjustedBurstSizeD) * (ratio1 * float64(len(g.neighbors1[i][j]))) / totalRatio))
-									dipsForNeighbors2 := int(math.Floor(float64(adjustedBurstSizeD) * (ratio2 * float64(len(g.neighbors2[i][j]))) / totalRatio))
-									dipsForNeighbors3 := int(math.Floor(float64(adjustedBurstSizeD) * (ratio3 * float64(len(g.neighbors3[i][j]))) / totalRatio))
-									remainingDips := adjustedBurstSizeD - (dipsForNeighbors1 + dipsForNeighbors2 + dipsForNeighbors3)
-
-									// Randomly distribute the remaining DIPs based on the ratio
-									for remainingDips > 0 {
-										randVal := rand.Float64() * totalRatio
-										if randVal < ratio1 && len(g.neighbors1[i][j]) > 0 {
-											dipsForNeighbors1++
-										} else if randVal < (ratio1+ratio2) && len(g.neighbors2[i][j]) > 0 {
-											dipsForNeighbors2++
-										} else if len(g.neighbors3[i][j]) > 0 {
-											dipsForNeighbors3++
-										}
-										remainingDips--
-									}
-									// Distribute virions and DIPs to neighbors1
-									for _, dir := range g.neighbors1[i][j] {
-										ni, nj := dir[0], dir[1]
-										if dir != [2]int{-1, -1} && ni >= 0 && ni < GRID_SIZE && nj >= 0 && nj < GRID_SIZE {
-											if g.state[ni][nj] == SUSCEPTIBLE {
-												g.localVirions[ni][nj] += virionsForNeighbors1 / len(g.neighbors1[i][j])
-												g.localDips[ni][nj] += dipsForNeighbors1 / len(g.neighbors1[i][j])
-											}
-										}
-									}
-
-									// Distribute virions and DIPs to neighbors2
-									for _, dir := range g.neighbors2[i][j] {
-										ni, nj := dir[0], dir[1]
-										if dir != [2]int{-1, -1} && ni >= 0 && ni < GRID_SIZE && nj >= 0 && nj < GRID_SIZE {
-											g.localVirions[ni][nj] += virionsForNeighbors2 / len(g.neighbors2[i][j])
-											g.localDips[ni][nj] += dipsForNeighbors2 / len(g.neighbors2[i][j])
-										}
-									}
-
-									// Distribute virions and DIPs to neighbors3
-									for _, dir := range g.neighbors3[i][j] {
-										ni, nj := dir[0], dir[1]
-										if dir != [2]int{-1, -1} && ni >= 0 && ni < GRID_SIZE && nj >= 0 && nj < GRID_SIZE {
-											g.localVirions[ni][nj] += virionsForNeighbors3 / len(g.neighbors3[i][j])
-											g.localDips[ni][nj] += dipsForNeighbors3 / len(g.neighbors3[i][j])
-										}
-									}
-
-								} else { // "Jump" case for either virions, DIPs, or both
-									fmt.Println("Virion and DIP jump are allowed to JUMP")
-									if allowVirionJump {
-										totalVirionsAtCell := g.localVirions[i][j]
-										totalDIPsAtCell := g.localDips[i][j]
-										adjustedBurstSizeD := 0
-										if totalVirionsAtCell > 0 {
-											dipVirionRatio := float64(totalDIPsAtCell) / float64(totalVirionsAtCell)
-											adjustedBurstSizeD = BURST_SIZE_D + int(math.Floor(float64(BURST_SIZE_D)*dipVirionRatio))
-										}
-										if jumpRandomly {
-											for v := 0; v < BURST_SIZE_V; v++ {
-												ni := rand.Intn(GRID_SIZE) // Randomly select a row
-												nj := rand.Intn(GRID_SIZE) // Randomly select a column
-
-												// Apply the virion jump
-												g.localVirions[ni][nj]++
-											}
-
-											// DIP jump randomly to any location
-											for d := 0; d < adjustedBurstSizeD; d++ {
-												ni := rand.Intn(GRID_SIZE) // Randomly select a row
-												nj := rand.Intn(GRID_SIZE) // Randomly select a column
-
-												// Apply the DIP jump
-												g.localDips[ni][nj]++
-											}
-										} else {
-
-											totalVirionsAtCell := g.localVirions[i][j]
-											totalDIPsAtCell := g.localDips[i][j]
-											adjustedBurstSizeD := 0
-											if totalVirionsAtCell > 0 {
-												dipVirionRatio := float64(totalDIPsAtCell) / float64(totalVirionsAtCell)
-												adjustedBurstSizeD = BURST_SIZE_D + int(math.Floor(float64(BURST_SIZE_D)*dipVirionRatio))
-											}
-
-											// Virion jump logic
-											virionTargets := make([]int, BURST_SIZE_V)
-											for v := 0; v < BURST_SIZE_V; v++ {
-												virionTargets[v] = rand.Intn(len(g.neighborsBurstArea[i][j]))
-											}
-
-											// Apply virion jumps
-											for _, targetIndex := range virionTargets {
-												spot := g.neighborsBurstArea[i][j][targetIndex]
-												ni, nj := spot[0], spot[1]
-
-												// Ensure the jump target is valid
-												if ni < 0 || ni >= GRID_SIZE || nj < 0 || nj >= GRID_SIZE {
-													// fmt.Printf("Skipping invalid jump target (%d, %d) from (%d, %d)\n", ni, nj, i, j)
-													continue
-												}
-
-												// Apply the virion jump
-												g.localVirions[ni][nj]++
-											}
-
-											// DIP jump logic
-											dipTargets := make([]int, adjustedBurstSizeD)
-											for d := 0; d < adjustedBurstSizeD; d++ {
-												dipTargets[d] = rand.Intn(len(g.neighborsBurstArea[i][j]))
-											}
-
-											// Apply DIP jumps
-											for _, targetIndex := range dipTargets {
-												spot := g.neighborsBurstArea[i][j][targetIndex]
-												ni, nj := spot[0], spot[1]
-
-												// Ensure the jump target is valid
-												if ni < 0 || ni >= GRID_SIZE || nj < 0 || nj >= GRID_SIZE {
-													//fmt.Printf("Skipping invalid jump target (%d, %d) from (%d, %d)\n", ni, nj, i, j)
-													continue
-												}
-
-												// Apply the DIP jump
-												g.localDips[ni][nj]++
-											}
-										}
-									}
-
-									if allowDIPJump {
-										totalVirionsAtCell := g.localVirions[i][j]
-										totalDIPsAtCell := g.localDips[i][j]
-										adjustedBurstSizeD := 0
-										if totalVirionsAtCell > 0 {
-											dipVirionRatio := float64(totalDIPsAtCell) / float64(totalVirionsAtCell)
-											adjustedBurstSizeD = BURST_SIZE_D + int(math.Floor(float64(BURST_SIZE_D)*dipVirionRatio))
-										}
-
-										if jumpRandomly {
-											go func() {
-												for d := 0; d < adjustedBurstSizeD; d++ {
-													ni := rand.Intn(GRID_SIZE)
-													nj := rand.Intn(GRID_SIZE)
-													g.localDips[ni][nj]++
-												}
-											}()
-										} else {
-											dipTargets := make([]int, adjustedBurstSizeD)
-											for d := 0; d < adjustedBurstSizeD; d++ {
-												dipTargets[d] = rand.Intn(len(g.neighborsBurstArea[i][j]))
-											}
-											go func() {
-												for _, targetIndex := range dipTargets {
-													spot := g.neighborsBurstArea[i][j][targetIndex]
-													ni, nj := spot[0], spot[1]
-													if ni >= 0 && ni < GRID_SIZE && nj >= 0 && nj < GRID_SIZE {
-														g.localDips[ni][nj]++
-													}
-												}
-											}()
-										}
-									}
-
-								}
-							}
-						}
-					}
-				skipOldLogic:
-					// Handle continuous mode cells (production logic)
-					if g.state[i][j] == INFECTED_VIRION_CONTINUOUS || g.state[i][j] == INFECTED_DIP || g.state[i][j] == INFECTED_DIP_CONTINUOUS || g.state[i][j] == INFECTED_BOTH_CONTINUOUS {
-						fmt.Printf("🚀 DEBUG: Found continuous state cell at (%d,%d) with state %d at frame %d\n", i, j, g.state[i][j], frameNum)
-						// Use continuous production logic
-						g.handleViralProduction(i, j, frameNum)
-					}
-
-					// update infected only by DIP or only by virions cells become "infected by both"
-					if g.state[i][j] == INFECTED_VIRION || g.state[i][j] == INFECTED_DIP || g.state[i][j] == INFECTED_DIP_CONTINUOUS {
-
-						if g.stateChanged[i][j] == false {
-							// Check if the cell is infected by virions or DIPs
-
-							if g.localVirions[i][j] > 0 || g.localDips[i][j] > 0 {
-								// Calculate the infection probabilities
-
-								if R == 0 || TAU == 0 {
-									perParticleInfectionChance_V = RHO
-								} else {
-									if VStimulateIFN == true { // R=1
-										perParticleInfectionChance_V = RHO * math.Exp(-ALPHA*(globalIFNperCell/float64(R)))
-									} else if VStimulateIFN == false { // usually only DIP stimulate IFN in this situlation
-										perParticleInfectionChance_V = RHO * math.Exp(-ALPHA*(globalIFNperCell))
-									}
-								}
-								var probabilityVInfection, probabilityDInfection float64
-
-								// Virion infection probability
-								probabilityVInfection = 1 - math.Pow(1-perParticleInfectionChance_V, float64(g.localVirions[i][j]))
-								infectedByVirion := rand.Float64() <= probabilityVInfection
-
-								// DIP infection probability
-								probabilityDInfection = 1 - math.Pow(1-(RHO*math.Exp(-ALPHA*(globalIFNperCell))), float64(g.localDips[i][j]))
-								infectedByDip := rand.Float64() <= probabilityDInfection
-
-								// Handle co-infection of already infected cells
-								if g.state[i][j] == INFECTED_VIRION {
-									if infectedByDip {
-										fmt.Printf("COINFECT: frame %d cell (%d,%d) VIRION->BOTH by DIP; localVirions=%d localDIPs=%d pV=%.6f pD=%.6f\n",
-											frameNum, i, j, g.localVirions[i][j], g.localDips[i][j], probabilityVInfection, probabilityDInfection)
-										newGrid[i][j] = INFECTED_BOTH // Virion + DIP = Both
-									}
-									// Otherwise keep INFECTED_VIRION state
-								} else if g.state[i][j] == INFECTED_DIP || g.state[i][j] == INFECTED_DIP_CONTINUOUS {
-									if infectedByVirion {
-										fmt.Printf("COINFECT: frame %d cell (%d,%d) DIP->BOTH by VIRION; localVirions=%d localDIPs=%d pV=%.6f pD=%.6f\n",
-											frameNum, i, j, g.localVirions[i][j], g.localDips[i][j], probabilityVInfection, probabilityDInfection)
-										newGrid[i][j] = INFECTED_BOTH // DIP + Virion = Both
-									}
-									// Otherwise keep INFECTED_DIP state
-								}
-							}
-
-						}
-
-						if g.state[i][j] == INFECTED_VIRION || g.state[i][j] == INFECTED_BOTH {
-
-							if g.timeSinceInfectVorBoth[i][j] > IFN_DELAY+int(math.Floor(rand.NormFloat64()*float64(STD_IFN_DELAY))) && TAU > 0 {
-								adjusted_DIP_IFN_stimulate := 1.0
-								// if g.intraWT[i][j] > 0 {
-								// 	dvgWtRatio := float64(g.intraDVG[i][j]) / float64(g.intraWT[i][j])
-								// 	if g.state[i][j] == INFECTED_BOTH {
-								// 		adjusted_DIP_IFN_stimulate *= dvgWtRatio * BOTH_IFN_stimulate_ratio
-								// 	}
-								// }
-								adjusted_DIP_IFN_stimulate = BOTH_IFN_stimulate_ratio
-								var totalIncreaseAmount float64
-								if VStimulateIFN == true {
-
-									if g.state[i][j] == INFECTED_VIRION {
-
-										totalIncreaseAmount = float64(R) * float64(TIMESTEP) * ifnBothFold
-									} else if g.state[i][j] == INFECTED_BOTH {
-										totalIncreaseAmount = (float64(R) + adjusted_DIP_IFN_stimulate) * float64(TIMESTEP)
-									}
-								} else if VStimulateIFN == false {
-
-									if g.state[i][j] == INFECTED_VIRION {
-
-										totalIncreaseAmount = 0.0
-									} else if g.state[i][j] == INFECTED_BOTH {
-										totalIncreaseAmount = (adjusted_DIP_IFN_stimulate) * float64(TIMESTEP)
-									}
-									fmt.Println("totalIncreaseAmount", totalIncreaseAmount)
-								}
-
-								cellCount := len(g.neighborsIFNArea[i][j])
-
-								if cellCount > 0 {
-									averageIncreaseAmount := totalIncreaseAmount / float64(cellCount)
-
-									for _, offset := range g.neighborsIFNArea[i][j] {
-										ni, nj := offset[0], offset[1]
-
-										if ni >= 0 && ni < GRID_SIZE && nj >= 0 && nj < GRID_SIZE {
-											g.IFNConcentration[ni][nj] += averageIncreaseAmount
-											globalIFN += averageIncreaseAmount
-										}
-									}
-								}
-							}
-
-						}
-
-						if g.state[i][j] == INFECTED_DIP || g.state[i][j] == INFECTED_DIP_CONTINUOUS {
-							// Set DVG recovery threshold if not already set
-							if g.dipLysisThreshold[i][j] == -1 {
-								g.dipLysisThreshold[i][j] = int(rand.NormFloat64()*STANDARD_DVG_RECOVERY_TIME + MEAN_DVG_RECOVERY_TIME)
-							}
-
-							g.timeSinceInfectDIP[i][j] += TIMESTEP
-
-							// Check if DVG-infected cell should recover (return to susceptible)
-							if g.dipLysisThreshold[i][j] > 0 && g.timeSinceInfectDIP[i][j] >= g.dipLysisThreshold[i][j] {
-								// DVG-infected cell returns to susceptible state (no particle release)
-								newGrid[i][j] = SUSCEPTIBLE
-								g.timeSinceInfectDIP[i][j] = -1
-								g.dipLysisThreshold[i][j] = -1
-								g.timeSinceSusceptible[i][j] = 0
-							} else if g.timeSinceInfectDIP[i][j] > IFN_DELAY+int(math.Floor(rand.NormFloat64()*float64(STD_IFN_DELAY))) && TAU > 0 {
-								// Continue producing IFN while infected
-								// adjusted_DIP_IFN_stimulate := float64(g.intraDVG[i][j]) * D_only_IFN_stimulate_ratio
-								adjusted_DIP_IFN_stimulate := D_only_IFN_stimulate_ratio
-								totalIncreaseAmount := adjusted_DIP_IFN_stimulate * float64(TIMESTEP)
-
-								cellCount := len(g.neighborsIFNArea[i][j])
-								if cellCount > 0 {
-									averageIncreaseAmount := totalIncreaseAmount / float64(cellCount)
-									for _, offset := range g.neighborsIFNArea[i][j] {
-										ni, nj := offset[0], offset[1]
-
-										if ni >= 0 && ni < GRID_SIZE && nj >= 0 && nj < GRID_SIZE {
-											g.IFNConcentration[ni][nj] += averageIncreaseAmount
-											globalIFN += averageIncreaseAmount
-										}
-									}
-								}
-							}
-						}
-
-					}
-
-				}
+	// Enforce VIRION-only pre-lysis cells release 0 DIPs even after state changes to DEAD
+	// Use previousStates captured right before death to infer the infection type at lysis
+	preBurstState := g.previousStates[i][j]
+	if preBurstState == INFECTED_VIRION {
+		adjustedBurstSizeD = 0
+	}
+	// NOTE: If preBurstState == INFECTED_BOTH, keep normal DIP release (burstSizeD, adjustedBurstSizeD)
+	if preBurstState == INFECTED_BOTH {
+		if burstSizeD > 0 {
+			if adjustedBurstSizeD <= 0 {
+				debugf("VIOLATION_PRE_BURST_BOTH: at (%d,%d) burstSizeD=%d adjustedBurstSizeD=%d (expected >0)\n",
+					i, j, burstSizeD, adjustedBurstSizeD)
+				// Fallback: ensure minimum DIP release equals BURST_SIZE_D when BOTH
+				adjustedBurstSizeD = burstSizeD
+			} else {
+				debugf("ASSERT_PRE_BURST_BOTH: at (%d,%d) burstSizeD=%d adjustedBurstSizeD=%d OK\n",
+					i, j, burstSizeD, adjustedBurstSizeD)
 			}
 		}
-		// Handle potentially regrowing dead cells
-		for i := 0; i < GRID_SIZE; i++ {
-			for j := 0; j < GRID_SIZE; j++ {
-				if g.state[i][j] == DEAD {
-					g.timeSinceDead[i][j] += TIMESTEP
-
-					// Check if any neighboring cells are susceptible, allowing for regrowth
-					canRegrow := false
-					neighbors := g.neighbors1[i][j]
-
-					// Iterate over the neighbors and check if any are SUSCEPTIBLE
-					for _, neighbor := range neighbors {
-						ni, nj := neighbor[0], neighbor[1]
-
-						// Ensure the neighbor indices are valid (within grid bounds)
-						if ni >= 0 && ni < GRID_SIZE && nj >= 0 && nj < GRID_SIZE {
-
-							//if g.timeSinceSusceptible[ni][nj]+g.timeSinceAntiviral[ni][nj] > int(math.Floor(rand.NormFloat64()*REGROWTH_STD+REGROWTH_MEAN)) || g.timeSinceRegrowth[ni][nj]+g.timeSinceAntiviral[ni][nj] > int(math.Floor(rand.NormFloat64()*REGROWTH_STD+REGROWTH_MEAN)) {
-							//	canRegrow = true
-							//  break
-							//}
-							if g.state[ni][nj] == SUSCEPTIBLE || g.state[ni][nj] == ANTIVIRAL {
-								canRegrow = true
-								break
-
-							}
-						}
-					}
+	}
 
-					// If the conditions are met, the cell regrows
-					if canRegrow && g.timeSinceDead[i][j] >= int(rand.NormFloat64()*REGROWTH_STD+REGROWTH_MEAN) {
-						newGrid[i][j] = REGROWTH
-						g.timeSinceRegrowth[i][j] = 0
-						g.timeSinceDead[i][j] = -1
+	adjustedBurstSizeD = modelBurstD(adjustedBurstSizeD, competitionD)
 
-					}
+	// DEBUG: log state and adjustedBurstSizeD at burst time (case 4)
+	debugf("DEBUG Burst state=%d at (%d,%d): burstSizeV=%d, adjustedBurstSizeD=%d, virionBurstMode=%s\n",
+		g.state[i][j], i, j, burstSizeV, adjustedBurstSizeD, virionBurstMode)
 
-				}
-			}
+	// Virions spread over burstRadius (rings 1 to 30), DIPs over their own absolute dipRadius
+	// (or over the rings dipInnerRadius..dipOuterRadius under -dipBurstShape=annulus)
+	radius := g.burstRadius
+	radiusForDIP := *flag_dipRadius
+	innerForDIP := 1
+	if *flag_dipBurstShape == "annulus" {
+		innerForDIP = *flag_dipInnerRadius
+		if *flag_dipOuterRadius >= 0 {
+			radiusForDIP = *flag_dipOuterRadius
 		}
+	}
+	if radius < 1 {
+		radius = 1
+	}
+	if radius > 30 {
+		radius = 30
+	}
+	if radiusForDIP < 1 {
+		radiusForDIP = 1
+	}
+	if radiusForDIP >= gridHexDiameter {
+		warnOnce("dipRadiusCoversGrid", "dipRadius=%d covers the whole grid (diameter %d): DIP bursts deposit over every cell", radiusForDIP, gridHexDiameter)
+	}
 
-		// Apply the updated grid state
-		g.state = newGrid
+	debugf("Case 4 burst at [%d][%d] with radiusV=%d, radiusD=%d..%d, burstSizeV=%d, adjustedBurstSizeD=%d\n",
+		i, j, radius, innerForDIP, radiusForDIP, burstSizeV, adjustedBurstSizeD)
+	g.distributeParticles(i, j, burstSizeV, adjustedBurstSizeD, radius, radiusForDIP, pathKernel(kernelInverseEuclid), innerForDIP)
+}
 
-		// Calculate and log the total virions and DIPs for each time step
-		totalVirions, totalDIPs := g.totalVirions(), g.totalDIPs()
-		fmt.Printf("Time step %d: Total Virions = %d, Total DIPs = %d\n", frameNum, totalVirions, totalDIPs)
+// Particle distribution kernels (-burstKernel): per-cell weight of hex ring r around the source
+const (
+	kernelInverseEuclid = "inverseEuclid" // 1/(r+0.1), the burst path
+	kernelHexInverse15  = "hexInverse15"  // 1/r^1.5, continuous production
+	kernelLegacySqrt3   = "legacySqrt3"   // 1 : 1/2 : 1/√3 on rings 1-3 (the √3 : 2√3 : 3 ratio), the partition path
+)
 
-		// Additional calculations based on simulation parameters for tracking purposes
-		regrowthCount := g.calculateRegrowthCount()
-		susceptiblePercentage := g.calculateSusceptiblePercentage()
+// Function to pick the kernel of a distribution path: its own kernel under -burstKernel=auto,
+// the -burstKernel one otherwise
+func pathKernel(own string) string {
+	if *flag_burstKernel == "auto" {
+		return own
+	}
+	return *flag_burstKernel
+}
 
-		regrowthedOrAntiviralPercentage := g.calculateRegrowthedOrAntiviralPercentage()
-		infectedPercentage := g.calculateInfectedPercentage()
-		infectedDIPOnlyPercentage := g.calculateInfectedDIPOnlyPercentage()
-		infectedBothPercentage := g.calculateInfectedBothPercentage()
-		antiviralPercentage := g.calculateAntiviralPercentage()
-		deadCellPercentage := calculateDeadCellPercentage(g.state)
-		uninfectedPercentage := g.calculateUninfectedPercentage()
-		plaquePercentage := g.calculatePlaquePercentage()
+// Function to return the per-cell weight of ring r under kernel; legacySqrt3 gives nothing
+// beyond ring 3
+func kernelWeight(kernel string, r int) float64 {
+	switch kernel {
+	case kernelHexInverse15:
+		return 1.0 / math.Pow(float64(r), 1.5)
+	case kernelLegacySqrt3:
+		switch r {
+		case 1:
+			return 1.0
+		case 2:
+			return 1.0 / 2
+		case 3:
+			return 1.0 / (3 / math.Sqrt(3))
+		}
+		return 0
+	default:
+		return 1.0 / (float64(r) + 0.1)
+	}
+}
 
-		// Log additional data as necessary
-		fmt.Printf("Regrowth Count: %d, Susceptible: %.2f%%\n", regrowthCount, susceptiblePercentage)
-		fmt.Printf("Regrowthed or Antiviral: %.2f%%, Infected: %.2f%%, DIP Only: %.2f%%, Both Infected: %.2f%%, Antiviral: %.2f%%\n",
-			regrowthedOrAntiviralPercentage, infectedPercentage, infectedDIPOnlyPercentage, infectedBothPercentage, antiviralPercentage)
-		fmt.Printf("Dead: %.2f%%, Uninfected: %.2f%%, Plaque: %.2f%%\n", deadCellPercentage, uninfectedPercentage, plaquePercentage)
+// Function to list the cells within hex distance radius of (i,j) under -boundary, using the
+// precomputed burst or continuous footprint when the radius matches one
+func (g *Grid) cellsWithinRadius(i, j, radius int) [][2]int {
+	switch {
+	case radius == g.burstRadius:
+		return g.neighborsBurstArea[i][j]
+	case radius == g.continuousRadius:
+		return g.neighborsContinuous[i][j]
+	case radius >= gridHexDiameter:
+		return allCellsExcept(i, j)
+	}
+	var ringCells [][2]int
+	for r := 1; r <= radius; r++ {
+		ringCells = append(ringCells, generateHexRing(i, j, r)...)
+	}
+	return wrapNeighbors(ringCells, [2]int{i, j})
+}
 
-		/////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
-	} else if ifnWave == false { // ifnWave == false
+// Function to keep the cells of a release footprint that may receive particles (-depositPolicy)
+func (g *Grid) depositTargets(cells [][2]int) [][2]int {
+	if *flag_depositPolicy == "all" {
+		return cells
+	}
+	kept := make([][2]int, 0, len(cells))
+	for _, cell := range cells {
+		state := g.state[cell[0]][cell[1]]
+		if state == SUSCEPTIBLE || (*flag_depositPolicy == "live" && state != DEAD) {
+			kept = append(kept, cell)
+		}
+	}
+	return kept
+}
 
-		for i := 0; i < GRID_SIZE; i++ {
-			for j := 0; j < GRID_SIZE; j++ {
-				g.stateChanged[i][j] = false
-				g.IFNConcentration[i][j] = globalIFN / float64(GRID_SIZE*GRID_SIZE)
+// Function to release nV virions over the cells within radiusV of (i,j) and nD DIPs over the
+// rings innerD..radiusD (1 = the full disk), split over the hex rings by the kernel weights
+// (see distributeByRing), which normalize over just the receiving rings.
+// Only the -depositPolicy cells receive particles. Every particle is placed; with no cell to go
+// to they stay on the source cell. Under -strict the lattice totals are checked around it.
+func (g *Grid) distributeParticles(i, j, nV, nD, radiusV, radiusD int, kernel string, innerD int) {
+	var beforeV, beforeD int
+	if *flag_strict {
+		beforeV, beforeD = g.totalVirions(), g.totalDIPs()
+		defer func() {
+			addedV, addedD := g.totalVirions()-beforeV, g.totalDIPs()-beforeD
+			if g.conservationErr == nil && (addedV != max(nV, 0, 0) || addedD != max(nD, 0, 0)) {
+				g.conservationErr = fmt.Errorf("%w: release of %d virions and %d DIPs at (%d,%d) added %d and %d to the lattice",
+					ErrConservation, nV, nD, i, j, addedV, addedD)
 			}
+		}()
+	}
+	if nV > 0 || nD > 0 {
+		g.countRelease(max(nV, 0, 0), max(nD, 0, 0))
+		g.releasedNow[i][j] = true
+		if r := max(radiusV, radiusD, 0); r > g.releaseRadiusNow {
+			g.releaseRadiusNow = r
 		}
-		if globalIFN < 0 {
-			globalIFN = -1.0
+	}
+	weight := func(r int) float64 { return kernelWeight(kernel, r) }
+	distribute := distributeByRing
+	if *flag_driftStrength > 0 {
+		distribute = func(rng *rand.Rand, rings [][][2]int, total int, weight func(r int) float64, add func(ni, nj, n int)) int {
+			return distributeWithDrift(rng, i, j, rings, total, weight, add)
 		}
-		// Step 3: Update max global IFN if needed
-		if globalIFN > maxGlobalIFN {
-
-			maxGlobalIFN = globalIFN
-
+	}
+	if nV > 0 {
+		rings := groupByHexRing(i, j, g.depositTargets(g.cellsWithinRadius(i, j, radiusV)), radiusV)
+		if distribute(g.rng, rings, nV, weight, func(ni, nj, n int) {
+			g.localVirions[ni][nj] += n
+		}) == 0 {
+			g.depositUndistributedParticles(i, j, nV, 0, "burst (virions)")
 		}
+	}
+	if nD > 0 {
+		rings := groupByHexRing(i, j, g.depositTargets(g.cellsWithinRadius(i, j, radiusD)), radiusD)
+		for r := 0; r < innerD && r < len(rings); r++ {
+			rings[r] = nil
+		}
+		if distribute(g.rng, rings, nD, weight, func(ni, nj, n int) {
+			g.localDips[ni][nj] += n
+		}) == 0 {
+			g.depositUndistributedParticles(i, j, 0, nD, "burst (DIPs)")
+		}
+	}
+}
 
-		// Traverse the grid
-		for i := 0; i < GRID_SIZE; i++ {
-			for j := 0; j < GRID_SIZE; j++ {
-				// Skip UNEXPOSED cells entirely (never change)
-				if g.state[i][j] == UNEXPOSED {
-					continue
-				}
-				// Only consider cells that are in the SUSCEPTIBLE or REGROWTH state
-
-				if g.state[i][j] == SUSCEPTIBLE || g.state[i][j] == REGROWTH || g.state[i][j] == INFECTED_DIP || g.state[i][j] == INFECTED_DIP_CONTINUOUS {
-					if g.IFNConcentration[i][j] > 0 && TAU > 0 {
-
-						if g.antiviralDuration[i][j] == -1 {
-							g.antiviralDuration[i][j] = int(math.Floor(rand.NormFloat64()*float64(TAU)/4 + float64(TAU)))
-							g.timeSinceAntiviral[i][j] = 0
-						} else if g.timeSinceAntiviral[i][j] <= int(g.antiviralDuration[i][j]) {
-							g.timeSinceAntiviral[i][j] += TIMESTEP
-						} else {
-
-							g.previousStates[i][j] = g.state[i][j]
-							newGrid[i][j] = ANTIVIRAL
-							g.timeSinceAntiviral[i][j] = -2
-							g.totalAntiviralTime += g.antiviralDuration[i][j]
-							if g.state[i][j] == ANTIVIRAL && !g.antiviralFlag[i][j] {
-								g.antiviralFlag[i][j] = true
-								g.antiviralCellCount++
-							}
-
-						}
-
-					}
-
-					if g.state[i][j] == SUSCEPTIBLE || g.state[i][j] == REGROWTH {
-						// Check if the cell is infected by virions or DIPs
-						if g.localVirions[i][j] > 0 || g.localDips[i][j] > 0 {
-							// Calculate the infection probabilities
-
-							if R == 0 || TAU == 0 {
-								perParticleInfectionChance_V = RHO
-
-							} else {
-								if VStimulateIFN == true { // R=1
-									perParticleInfectionChance_V = RHO * math.Exp(-ALPHA*(globalIFNperCell/float64(R)))
-								} else if VStimulateIFN == false { // usually only DIP stimulate IFN in this situlation
-									perParticleInfectionChance_V = RHO * math.Exp(-ALPHA*(globalIFNperCell))
-								}
-							}
-
-							var probabilityVInfection, probabilityDInfection float64
-
-							// Virion infection probability
-							probabilityVInfection = 1 - math.Pow(1-perParticleInfectionChance_V, float64(g.localVirions[i][j]))
-							infectedByVirion := rand.Float64() <= probabilityVInfection
-
-							// DIP infection probability - use same logic as virion
-							perParticleInfectionChance_D := perParticleInfectionChance_V
-							probabilityDInfection = 1 - math.Pow(1-perParticleInfectionChance_D, float64(g.localDips[i][j]))
-							infectedByDip := rand.Float64() <= probabilityDInfection
-
-							// Determine the infection state based on virion and DIP infection
-							if infectedByVirion && infectedByDip {
-								if g.continuousMode {
-									newGrid[i][j] = INFECTED_BOTH_CONTINUOUS
-								} else {
-									newGrid[i][j] = INFECTED_BOTH
-								}
-								g.timeSinceSusceptible[i][j] = -1
-								g.timeSinceRegrowth[i][j] = -1
-								// Record intracellular virus counts for continuous mode
-								if g.continuousMode {
-									// Calculate actual number of infecting virions and DIPs
-									infectingVirions := int(math.Round(float64(g.localVirions[i][j]) * probabilityVInfection))
-									infectingDIPs := int(math.Round(float64(g.localDips[i][j]) * probabilityDInfection))
-									if infectingVirions > 0 {
-										g.intraWT[i][j] += infectingVirions
-									}
-									if infectingDIPs > 0 {
-										g.intraDVG[i][j] += infectingDIPs
-									}
-									g.infectionTime[i][j] = frameNum
-								}
-							} else if infectedByVirion {
-								if g.continuousMode {
-									newGrid[i][j] = INFECTED_VIRION_CONTINUOUS
-								} else {
-									newGrid[i][j] = INFECTED_VIRION
-								}
-								g.timeSinceSusceptible[i][j] = -1
-								g.timeSinceRegrowth[i][j] = -1
-								// Record intracellular virus count for continuous mode
-								if g.continuousMode {
-									// Calculate actual number of infecting virions
-									infectingVirions := int(math.Round(float64(g.localVirions[i][j]) * probabilityVInfection))
-									if infectingVirions > 0 {
-										g.intraWT[i][j] += infectingVirions
-									}
-									g.infectionTime[i][j] = frameNum
-								}
-							} else if infectedByDip {
-								if g.continuousMode {
-									newGrid[i][j] = INFECTED_DIP_CONTINUOUS
-								} else {
-									newGrid[i][j] = INFECTED_DIP
-								}
-								g.timeSinceSusceptible[i][j] = -1
-								g.timeSinceRegrowth[i][j] = -1
-								// Record intracellular DVG count for continuous mode
-								if g.continuousMode {
-									// Calculate actual number of infecting DIPs
-									infectingDIPs := int(math.Round(float64(g.localDips[i][j]) * probabilityDInfection))
-									if infectingDIPs > 0 {
-										g.intraDVG[i][j] += infectingDIPs
-									}
-									g.infectionTime[i][j] = frameNum
-								}
-							}
-						}
-
-						// Mark the state as changed if the cell is infected
-						if newGrid[i][j] != g.state[i][j] {
-							g.stateChanged[i][j] = true
-						}
-					}
+// Function to group neighbors of (i,j) by integer hex distance: rings[r] holds the in-grid
+// cells at distance r. Iterating the slice gives a fixed ring order (unlike a map).
+func groupByHexRing(i, j int, neighbors [][2]int, maxRing int) [][][2]int {
+	if maxRing > gridHexDiameter {
+		maxRing = gridHexDiameter
+	}
+	rings := make([][][2]int, maxRing+1)
+	for _, neighbor := range neighbors {
+		ni, nj := neighbor[0], neighbor[1]
+		if ni < 0 || ni >= GRID_SIZE || nj < 0 || nj >= GRID_SIZE {
+			continue
+		}
+		r := getHexDistanceBetweenPoints(i, j, ni, nj)
+		for r >= len(rings) {
+			rings = append(rings, nil)
+		}
+		rings[r] = append(rings[r], neighbor)
+	}
+	return rings
+}
 
-				}
+// Function to split total particles over rings, ring r getting a share proportional to its cell
+// count times weight(r), then evenly (in shuffled order) within each ring. The floor of each
+// share is placed first and the leftover goes one particle each to the rings with the largest
+// fractional share (closer ring first on ties), so all of total is placed unless no ring has
+// weight. Returns the number of particles placed.
+func distributeByRing(rng *rand.Rand, rings [][][2]int, total int, weight func(r int) float64, add func(ni, nj, n int)) int {
+	shares := make([]float64, len(rings))
+	totalWeight := 0.0
+	for r, ring := range rings {
+		if len(ring) > 0 {
+			shares[r] = float64(len(ring)) * weight(r)
+			totalWeight += shares[r]
+		}
+	}
+	if totalWeight == 0 || total <= 0 {
+		return 0
+	}
 
+	counts := make([]int, len(rings))
+	var order []int
+	placed := 0
+	for r := range rings {
+		if shares[r] <= 0 {
+			continue
+		}
+		shares[r] = float64(total) * shares[r] / totalWeight
+		counts[r] = int(math.Floor(shares[r]))
+		placed += counts[r]
+		order = append(order, r)
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return shares[order[a]]-float64(counts[order[a]]) > shares[order[b]]-float64(counts[order[b]])
+	})
+	for k := 0; placed < total; k++ {
+		counts[order[k%len(order)]]++
+		placed++
+	}
+
+	for r, ring := range rings {
+		if counts[r] == 0 {
+			continue
+		}
+		// Shuffle order within this ring to avoid directional bias
+		shuffled := make([][2]int, len(ring))
+		copy(shuffled, ring)
+		rng.Shuffle(len(shuffled), func(a, b int) { shuffled[a], shuffled[b] = shuffled[b], shuffled[a] })
+
+		perNeighbor := counts[r] / len(shuffled)
+		remaining := counts[r] % len(shuffled)
+		for idx, neighbor := range shuffled {
+			n := perNeighbor
+			if idx < remaining {
+				n++
+			}
+			if n > 0 {
+				add(neighbor[0], neighbor[1], n)
 			}
 		}
+	}
+	return total
+}
 
-		// Process infected cells, no ifn wave, globally constant ifn
-		for i := 0; i < GRID_SIZE; i++ {
-			for j := 0; j < GRID_SIZE; j++ {
-				if par_celltocell_random == true {
-
-					allowRandomly := make([][]bool, GRID_SIZE)
-					for i := range allowRandomly {
-						allowRandomly[i] = make([]bool, GRID_SIZE)
-					}
-
-					// Calculate total number of cells allowed for random jumping based on k_JumpR
-					totalCells := GRID_SIZE * GRID_SIZE
-
-					randomJumpCells := int(math.Floor(float64(totalCells) * k_JumpR))
-
-					// Randomly select randomJumpCells cells and mark them as allowRandomly
-					selectedCells := make(map[[2]int]bool)
-					for len(selectedCells) < randomJumpCells {
-						ni := rand.Intn(GRID_SIZE)
-						nj := rand.Intn(GRID_SIZE)
-						selectedCells[[2]int{ni, nj}] = true
-					}
-					for pos := range selectedCells {
-						allowRandomly[pos[0]][pos[1]] = true
-					}
-
-				}
+// Function to return the bearing (radians) from cell (i,j) to (ni,nj) on the rendered hex
+// layout (column i at x = 1.5i, row j at y = sqrt3*(j + (i odd)/2)), under -boundary
+func hexBearing(i, j, ni, nj int) float64 {
+	di := boundaryOffset(ni - i)
+	dj := boundaryOffset(nj - j)
+	dx := 1.5 * float64(di)
+	dy := math.Sqrt(3) * (float64(dj) + 0.5*float64(((i+di)&1)-(i&1)))
+	return math.Atan2(dy, dx)
+}
 
-				if g.state[i][j] == INFECTED_VIRION || g.state[i][j] == INFECTED_DIP || g.state[i][j] == INFECTED_DIP_CONTINUOUS || g.state[i][j] == INFECTED_BOTH ||
-					g.state[i][j] == INFECTED_VIRION_CONTINUOUS || g.state[i][j] == INFECTED_BOTH_CONTINUOUS {
-					fmt.Printf("🔍 DEBUG ifnWave=false: Processing infected cell at (%d,%d) with state %d at frame %d\n", i, j, g.state[i][j], frameNum)
+// Function to split total particles over the cells of rings like distributeByRing, but with
+// each cell weighted by weight(r)*(1 + driftStrength*cos(bearing - driftAngle)) (-driftAngle,
+// -driftStrength). The floor of each share is placed first and the leftover goes one particle
+// each to the cells with the largest fractional share, in shuffled order on ties.
+func distributeWithDrift(rng *rand.Rand, i, j int, rings [][][2]int, total int, weight func(r int) float64, add func(ni, nj, n int)) int {
+	var cells [][2]int
+	var shares []float64
+	totalWeight := 0.0
+	angle := *flag_driftAngle * math.Pi / 180
+	for r, ring := range rings {
+		for _, cell := range ring {
+			w := weight(r) * (1 + *flag_driftStrength*math.Cos(hexBearing(i, j, cell[0], cell[1])-angle))
+			if w <= 0 {
+				continue
+			}
+			cells = append(cells, cell)
+			shares = append(shares, w)
+			totalWeight += w
+		}
+	}
+	if totalWeight == 0 || total <= 0 {
+		return 0
+	}
 
-					// update infected by V or BOTH cells become dead
-					if g.state[i][j] == INFECTED_VIRION || g.state[i][j] == INFECTED_BOTH {
+	order := rng.Perm(len(cells))
+	counts := make([]int, len(cells))
+	placed := 0
+	for k := range cells {
+		shares[k] = float64(total) * shares[k] / totalWeight
+		counts[k] = int(math.Floor(shares[k]))
+		placed += counts[k]
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return shares[order[a]]-float64(counts[order[a]]) > shares[order[b]]-float64(counts[order[b]])
+	})
+	for k := 0; placed < total; k++ {
+		counts[order[k%len(order)]]++
+		placed++
+	}
+	for k, cell := range cells {
+		if counts[k] > 0 {
+			add(cell[0], cell[1], counts[k])
+		}
+	}
+	return total
+}
 
-						if g.lysisThreshold[i][j] == -1 {
-							g.lysisThreshold[i][j] = int(rand.NormFloat64()*STANDARD_LYSIS_TIME + MEAN_LYSIS_TIME)
-						}
-						g.timeSinceInfectVorBoth[i][j] += TIMESTEP
-						g.timeSinceInfectDIP[i][j] = -1
-
-						// Check if the cell should lyse and release virions and DIPs
-						if g.timeSinceInfectVorBoth[i][j] > g.lysisThreshold[i][j] {
-							if g.state[i][j] == INFECTED_VIRION {
-								totalDeadFromV++ // Increase INFECTED_VIRION death count
-							} else if g.state[i][j] == INFECTED_BOTH {
-								totalDeadFromBoth++ // Increase INFECTED_BOTH death count
-							}
-
-							// After lysis, the cell becomes DEAD and virions and DIPs are spread to neighbors
-							g.previousStates[i][j] = g.state[i][j] // Save the previous state before death
-							newGrid[i][j] = DEAD
-							g.state[i][j] = DEAD
-							g.timeSinceDead[i][j] = 0
-							g.timeSinceInfectVorBoth[i][j] = -1
-							g.timeSinceInfectDIP[i][j] = -1
-							g.lysisThreshold[i][j] = -1
-
-							if par_celltocell_random == true {
-								// Calculate adjusted burst size for DIPs based on local ratio
-								totalVirionsAtCell := g.localVirions[i][j]
-								totalDIPsAtCell := g.localDips[i][j]
-								adjustedBurstSizeD := 0
-								if totalVirionsAtCell > 0 {
-									dipVirionRatio := float64(totalDIPsAtCell) / float64(totalVirionsAtCell)
-									adjustedBurstSizeD = BURST_SIZE_D + int(float64(BURST_SIZE_D)*dipVirionRatio)
-								}
-								//  ---------------------------------------
-								// Partition mode: split particles between random jump and cell-to-cell
-
-								randomVirions := int(math.Floor(float64(BURST_SIZE_V) * k_JumpR))
-								virionsForLocalDiffusion := BURST_SIZE_V - randomVirions
-
-								randomDIPs := int(math.Floor(float64(adjustedBurstSizeD) * k_JumpR))
-								dipsForLocalDiffusion := adjustedBurstSizeD - randomDIPs
-
-								// Handle random jumps
-								for v := 0; v < randomVirions; v++ {
-									ni, nj := rand.Intn(GRID_SIZE), rand.Intn(GRID_SIZE)
-									g.localVirions[ni][nj]++
-									g.totalRandomJumpVirions++
-								}
-								for d := 0; d < randomDIPs; d++ {
-									ni, nj := rand.Intn(GRID_SIZE), rand.Intn(GRID_SIZE)
-									g.localDips[ni][nj]++
-									g.totalRandomJumpDIPs++
-								}
-
-								// Handle local diffusion
-								// Handle local diffusion with localVirions & localDIPs (keep original logic unchanged)
-								if virionsForLocalDiffusion > 0 || dipsForLocalDiffusion > 0 {
-									// Calculate the total number of valid neighbors
-									totalNeighbors := 0
-
-									// Count valid neighbors from neighbors1
-									for _, dir := range g.neighbors1[i][j] {
-										if dir != [2]int{-1, -1} {
-											totalNeighbors++
-										}
-									}
-									// Count valid neighbors from neighbors2
-									for _, dir := range g.neighbors2[i][j] {
-										if dir != [2]int{-1, -1} {
-											totalNeighbors++
-										}
-									}
-									// Count valid neighbors from neighbors3
-									for _, dir := range g.neighbors3[i][j] {
-										if dir != [2]int{-1, -1} {
-											totalNeighbors++
-										}
-									}
-
-									if totalNeighbors == 0 {
-										return
-									}
-
-									// Calculate the distribution based on the ratio √3 : 2√3 : 3
-									sqrt3 := math.Sqrt(3)
-									ratio1 := 1.0               // sqrt3     // Weight for neighbors1
-									ratio2 := 1.0 / 2           // 2 * sqrt3 // Weight for neighbors2
-									ratio3 := 1.0 / (3 / sqrt3) // 3.0       // Weight for neighbors3
-									totalRatio := ratio1*float64(len(g.neighbors1[i][j])) +
-										ratio2*float64(len(g.neighbors2[i][j])) +
-										ratio3*float64(len(g.neighbors3[i][j]))
-
-									// Calculate virions for each neighbor group
-									virionsForNeighbors1 := int(math.Floor(float64(virionsForLocalDiffusion) * (ratio1 * float64(len(g.neighbors1[i][j]))) / totalRatio))
-									virionsForNeighbors2 := int(math.Floor(float64(virionsForLocalDiffusion) * (ratio2 * float64(len(g.neighbors2[i][j]))) / totalRatio))
-									virionsForNeighbors3 := int(math.Floor(float64(virionsForLocalDiffusion) * (ratio3 * float64(len(g.neighbors3[i][j]))) / totalRatio))
-
-									// Calculate remaining virions
-									remainingVirions := virionsForLocalDiffusion - (virionsForNeighbors1 + virionsForNeighbors2 + virionsForNeighbors3)
-
-									// Distribute remaining virions based on ratio
-									for remainingVirions > 0 {
-										randVal := rand.Float64() * totalRatio
-										if randVal < ratio1 && len(g.neighbors1[i][j]) > 0 {
-											virionsForNeighbors1++
-										} else if randVal < (ratio1+ratio2) && len(g.neighbors2[i][j]) > 0 {
-											virionsForNeighbors2++
-										} else if len(g.neighbors3[i][j]) > 0 {
-											virionsForNeighbors3++
-										}
-										remainingVirions--
-									}
-
-									// Calculate DIPs for each neighbor group (same logic)
-									dipsForNeighbors1 := int(math.Floor(float64(dipsForLocalDiffusion) * (ratio1 * float64(len(g.neighbors1[i][j]))) / totalRatio))
-									dipsForNeighbors2 := int(math.Floor(float64(dipsForLocalDiffusion) * (ratio2 * float64(len(g.neighbors2[i][j]))) / totalRatio))
-									dipsForNeighbors3 := int(math.Floor(float64(dipsForLocalDiffusion) * (ratio3 * float64(len(g.neighbors3[i][j]))) / totalRatio))
-
-									remainingDIPs := dipsForLocalDiffusion - (dipsForNeighbors1 + dipsForNeighbors2 + dipsForNeighbors3)
-
-									for remainingDIPs > 0 {
-										randVal := rand.Float64() * totalRatio
-										if randVal < ratio1 && len(g.neighbors1[i][j]) > 0 {
-											dipsForNeighbors1++
-										} else if randVal < (ratio1+ratio2) && len(g.neighbors2[i][j]) > 0 {
-											dipsForNeighbors2++
-										} else if len(g.neighbors3[i][j]) > 0 {
-											dipsForNeighbors3++
-										}
-										remainingDIPs--
-									}
-									// Distribute virions to neighbors1
-									for _, dir := range g.neighbors1[i][j] {
-										ni, nj := dir[0], dir[1]
-										if dir != [2]int{-1, -1} && ni >= 0 && ni < GRID_SIZE && nj >= 0 && nj < GRID_SIZE {
-											if g.state[ni][nj] == SUSCEPTIBLE {
-												g.localVirions[ni][nj] += virionsForNeighbors1 / len(g.neighbors1[i][j])
-												g.localDips[ni][nj] += dipsForNeighbors1 / len(g.neighbors1[i][j])
-											}
-										}
-									}
-
-									// Distribute virions to neighbors2
-									for _, dir := range g.neighbors2[i][j] {
-										ni, nj := dir[0], dir[1]
-										if dir != [2]int{-1, -1} && ni >= 0 && ni < GRID_SIZE && nj >= 0 && nj < GRID_SIZE {
-											g.localVirions[ni][nj] += virionsForNeighbors2 / len(g.neighbors2[i][j])
-											g.localDips[ni][nj] += dipsForNeighbors2 / len(g.neighbors2[i][j])
-										}
-									}
-
-									// Distribute virions to neighbors3
-									for _, dir := range g.neighbors3[i][j] {
-										ni, nj := dir[0], dir[1]
-										if dir != [2]int{-1, -1} && ni >= 0 && ni < GRID_SIZE && nj >= 0 && nj < GRID_SIZE {
-											g.localVirions[ni][nj] += virionsForNeighbors3 / len(g.neighbors3[i][j])
-											g.localDips[ni][nj] += dipsForNeighbors3 / len(g.neighbors3[i][j])
-										}
-									}
-								}
-
-							} else if par_celltocell_random == false {
-								if !allowVirionJump && !allowDIPJump {
-									fmt.Println("Virion and DIP jump are both disabled, using viral production logic (2nd location)")
-									// Use the new viral production function (burst or continuous based on case 4 mode)
-									g.handleViralProduction(i, j, frameNum)
-									// Skip the old complex logic by jumping to the end of this condition
-									goto skipOldLogic2
-
-									// Calculate the distribution of virions and DIPs to each neighbor based on the ratio √3 : 2√3 : 3
-									sqrt3 := math.Sqrt(3)
-									ratio1 := 1.0               // sqrt3     // Weight for neighbors1
-									ratio2 := 1.0 / 2           // 2 * sqrt3 // Weight for neighbors2
-									ratio3 := 1.0 / (3 / sqrt3) // 3.0 // Weight for neighbors3
-									totalRatio := ratio1*float64(len(g.neighbors1[i][j])) + ratio2*float64(len(g.neighbors2[i][j])) + ratio3*float64(len(g.neighbors3[i][j]))
-
-									// if infected by virion or infected by both:
-									// Calculate the number of virions and DIPs assigned to each type of neighbor
-									virionsForNeighbors1 := int(math.Floor(float64(BURST_SIZE_V) * (ratio1 * float64(len(g.neighbors1[i][j]))) / totalRatio))
-									virionsForNeighbors2 := int(math.Floor(float64(BURST_SIZE_V) * (ratio2 * float64(len(g.neighbors2[i][j]))) / totalRatio))
-									virionsForNeighbors3 := int(math.Floor(float64(BURST_SIZE_V) * (ratio3 * float64(len(g.neighbors3[i][j]))) / totalRatio))
-
-									// Calculate the remaining virions and DIPs
-									remainingVirions := BURST_SIZE_V - (virionsForNeighbors1 + virionsForNeighbors2 + virionsForNeighbors3)
-
-									// // Randomly distribute the remaining virions based on the ratio
-									for remainingVirions > 0 {
-										randVal := rand.Float64() * totalRatio
-										if randVal < ratio1 && len(g.neighbors1[i][j]) > 0 {
-											virionsForNeighbors1++
-										} else if randVal < (ratio1+ratio2) && len(g.neighbors2[i][j]) > 0 {
-											virionsForNeighbors2++
-										} else if len(g.neighbors3[i][j]) > 0 {
-											virionsForNeighbors3++
-										}
-										remainingVirions--
-									}
-									// if infected by vrion only or both:
-
-									totalVirionsAtCell := g.localVirions[i][j]
-									totalDIPsAtCell := g.localDips[i][j]
-
-									// Ensure we avoid division by zero
-									adjustedBurstSizeD := 0
-									if totalVirionsAtCell > 0 {
-										// Adjust BURST_SIZE_D based on the DIP-to-virion ratio at this cell
-										dipVirionRatio := float64(totalDIPsAtCell) / float64(totalVirionsAtCell)
-										adjustedBurstSizeD = BURST_SIZE_D + int(math.Floor(float64(BURST_SIZE_D)*dipVirionRatio))
-									}
-
-									// Distribute DIPs to neighbors based on the adjusted BURST_SIZE_D
-									dipsForNeighbors1 := int(math.Floor(float64(adjustedBurstSizeD) * (ratio1 * float64(len(g.neighbors1[i][j]))) / totalRatio))
-									dipsForNeighbors2 := int(math.Floor(float64(adjustedBurstSizeD) * (ratio2 * float64(len(g.neighbors2[i][j]))) / totalRatio))
-									dipsForNeighbors3 := int(math.Floor(float64(adjustedBurstSizeD) * (ratio3 * float64(len(g.neighbors3[i][j]))) / totalRatio))
-									remainingDips := adjustedBurstSizeD - (dipsForNeighbors1 + dipsForNeighbors2 + dipsForNeighbors3)
-
-									// Randomly distribute the remaining DIPs based on the ratio
-									for remainingDips > 0 {
-										randVal := rand.Float64() * totalRatio
-										if randVal < ratio1 && len(g.neighbors1[i][j]) > 0 {
-											dipsForNeighbors1++
-										} else if randVal < (ratio1+ratio2) && len(g.neighbors2[i][j]) > 0 {
-											dipsForNeighbors2++
-										} else if len(g.neighbors3[i][j]) > 0 {
-											dipsForNeighbors3++
-										}
-										remainingDips--
-									}
-									// Distribute virions and DIPs to neighbors1
-									for _, dir := range g.neighbors1[i][j] {
-										ni, nj := dir[0], dir[1]
-										if dir != [2]int{-1, -1} && ni >= 0 && ni < GRID_SIZE && nj >= 0 && nj < GRID_SIZE {
-											if g.state[ni][nj] == SUSCEPTIBLE {
-												g.localVirions[ni][nj] += virionsForNeighbors1 / len(g.neighbors1[i][j])
-												g.localDips[ni][nj] += dipsForNeighbors1 / len(g.neighbors1[i][j])
-											}
-										}
-									}
-
-									// Distribute virions and DIPs to neighbors2
-									for _, dir := range g.neighbors2[i][j] {
-										ni, nj := dir[0], dir[1]
-										if dir != [2]int{-1, -1} && ni >= 0 && ni < GRID_SIZE && nj >= 0 && nj < GRID_SIZE {
-											g.localVirions[ni][nj] += virionsForNeighbors2 / len(g.neighbors2[i][j])
-											g.localDips[ni][nj] += dipsForNeighbors2 / len(g.neighbors2[i][j])
-										}
-									}
-
-									// Distribute virions and DIPs to neighbors3
-									for _, dir := range g.neighbors3[i][j] {
-										ni, nj := dir[0], dir[1]
-										if dir != [2]int{-1, -1} && ni >= 0 && ni < GRID_SIZE && nj >= 0 && nj < GRID_SIZE {
-											g.localVirions[ni][nj] += virionsForNeighbors3 / len(g.neighbors3[i][j])
-											g.localDips[ni][nj] += dipsForNeighbors3 / len(g.neighbors3[i][j])
-										}
-									}
-
-								} else { // "Jump" case for either virions, DIPs, or both
-
-									if allowVirionJump {
-										totalVirionsAtCell := g.localVirions[i][j]
-										totalDIPsAtCell := g.localDips[i][j]
-										adjustedBurstSizeD := 0
-										if totalVirionsAtCell > 0 {
-											dipVirionRatio := float64(totalDIPsAtCell) / float64(totalVirionsAtCell)
-											adjustedBurstSizeD = BURST_SIZE_D + int(math.Floor(float64(BURST_SIZE_D)*dipVirionRatio))
-										}
-
-										if jumpRandomly {
-											for v := 0; v < BURST_SIZE_V; v++ {
-												ni := rand.Intn(GRID_SIZE) // Randomly select a row
-												nj := rand.Intn(GRID_SIZE) // Randomly select a column
-
-												// Apply the virion jump
-												g.localVirions[ni][nj]++
-											}
-
-											// DIP jump randomly to any location
-											for d := 0; d < adjustedBurstSizeD; d++ {
-												ni := rand.Intn(GRID_SIZE) // Randomly select a row
-												nj := rand.Intn(GRID_SIZE) // Randomly select a column
-
-												// Apply the DIP jump
-												g.localDips[ni][nj]++
-											}
-										} else {
-											// Virion jump logic
-											virionTargets := make([]int, BURST_SIZE_V)
-											for v := 0; v < BURST_SIZE_V; v++ {
-												virionTargets[v] = rand.Intn(len(g.neighborsBurstArea[i][j]))
-											}
-
-											// Apply virion jumps
-											for _, targetIndex := range virionTargets {
-												spot := g.neighborsBurstArea[i][j][targetIndex]
-												ni, nj := spot[0], spot[1]
-
-												// Ensure the jump target is valid
-												if ni < 0 || ni >= GRID_SIZE || nj < 0 || nj >= GRID_SIZE {
-													// fmt.Printf("Skipping invalid jump target (%d, %d) from (%d, %d)\n", ni, nj, i, j)
-													continue
-												}
-
-												// Apply the virion jump
-												g.localVirions[ni][nj]++
-											}
-
-											// DIP jump logic
-											dipTargets := make([]int, adjustedBurstSizeD)
-											for d := 0; d < adjustedBurstSizeD; d++ {
-												dipTargets[d] = rand.Intn(len(g.neighborsBurstArea[i][j]))
-											}
-
-											// Apply DIP jumps
-											for _, targetIndex := range dipTargets {
-												spot := g.neighborsBurstArea[i][j][targetIndex]
-												ni, nj := spot[0], spot[1]
-
-												// Ensure the jump target is valid
-												if ni < 0 || ni >= GRID_SIZE || nj < 0 || nj >= GRID_SIZE {
-													//fmt.Printf("Skipping invalid jump target (%d, %d) from (%d, %d)\n", ni, nj, i, j)
-													continue
-												}
-
-												// Apply the DIP jump
-												g.localDips[ni][nj]++
-											}
-										}
-									}
-
-									if allowDIPJump {
-										totalVirionsAtCell := g.localVirions[i][j]
-										totalDIPsAtCell := g.localDips[i][j]
-										adjustedBurstSizeD := 0
-										if totalVirionsAtCell > 0 {
-											dipVirionRatio := float64(totalDIPsAtCell) / float64(totalVirionsAtCell)
-											adjustedBurstSizeD = BURST_SIZE_D + int(math.Floor(float64(BURST_SIZE_D)*dipVirionRatio))
-										}
-
-										if jumpRandomly {
-											go func() {
-												for d := 0; d < adjustedBurstSizeD; d++ {
-													ni := rand.Intn(GRID_SIZE)
-													nj := rand.Intn(GRID_SIZE)
-													g.localDips[ni][nj]++
-												}
-											}()
-										} else {
-											dipTargets := make([]int, adjustedBurstSizeD)
-											for d := 0; d < adjustedBurstSizeD; d++ {
-												dipTargets[d] = rand.Intn(len(g.neighborsBurstArea[i][j]))
-											}
-											go func() {
-												for _, targetIndex := range dipTargets {
-													spot := g.neighborsBurstArea[i][j][targetIndex]
-													ni, nj := spot[0], spot[1]
-													if ni >= 0 && ni < GRID_SIZE && nj >= 0 && nj < GRID_SIZE {
-														g.localDips[ni][nj]++
-													}
-												}
-											}()
-										}
-									}
-								}
-							}
-						}
-					}
-				skipOldLogic2:
-					// Handle continuous mode cells (production logic) - ifnWave = false branch
-					if g.state[i][j] == INFECTED_VIRION_CONTINUOUS || g.state[i][j] == INFECTED_DIP || g.state[i][j] == INFECTED_DIP_CONTINUOUS || g.state[i][j] == INFECTED_BOTH_CONTINUOUS {
-						fmt.Printf("🚀 DEBUG: Found continuous state cell at (%d,%d) with state %d at frame %d (ifnWave=false branch)\n", i, j, g.state[i][j], frameNum)
-						// Use continuous production logic
-						g.handleViralProduction(i, j, frameNum)
-					}
+// Helper function to clear viral particles from dead cell locations
+func (g *Grid) clearParticlesFromDeadCells() {
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			if g.state[i][j] == DEAD {
+				// Clear all extracellular virions and DIPs from dead cell locations
+				g.localVirions[i][j] = 0
+				g.localDips[i][j] = 0
+			}
+		}
+	}
+}
 
-					// update infected only by DIP or only by virions cells become infected by both
-					if g.state[i][j] == INFECTED_VIRION || g.state[i][j] == INFECTED_DIP || g.state[i][j] == INFECTED_DIP_CONTINUOUS {
-
-						if g.stateChanged[i][j] == false {
-							// Check if the cell is infected by virions or DIPs
-
-							if g.localVirions[i][j] > 0 || g.localDips[i][j] > 0 {
-								// Calculate the infection probabilities
-
-								if R == 0 || TAU == 0 {
-									perParticleInfectionChance_V = RHO
-								} else {
-									if VStimulateIFN == true { // R=1
-										perParticleInfectionChance_V = RHO * math.Exp(-ALPHA*(globalIFNperCell/float64(R)))
-									} else if VStimulateIFN == false { // usually only DIP stimulate IFN in this situlation
-										perParticleInfectionChance_V = RHO * math.Exp(-ALPHA*(globalIFNperCell))
-									}
-								}
-								var probabilityVInfection, probabilityDInfection float64
-
-								// Virion infection probability
-								probabilityVInfection = 1 - math.Pow(1-perParticleInfectionChance_V, float64(g.localVirions[i][j]))
-								infectedByVirion := rand.Float64() <= probabilityVInfection
-
-								// DIP infection probability
-								probabilityDInfection = 1 - math.Pow(1-(RHO*math.Exp(-ALPHA*(globalIFNperCell))), float64(g.localDips[i][j]))
-								infectedByDip := rand.Float64() <= probabilityDInfection
-
-								// Handle co-infection of already infected cells
-								if g.state[i][j] == INFECTED_VIRION {
-									if infectedByDip {
-										fmt.Printf("COINFECT: frame %d cell (%d,%d) VIRION->BOTH by DIP; localVirions=%d localDIPs=%d pV=%.6f pD=%.6f\n",
-											frameNum, i, j, g.localVirions[i][j], g.localDips[i][j], probabilityVInfection, probabilityDInfection)
-										newGrid[i][j] = INFECTED_BOTH // Virion + DIP = Both
-									}
-									// Otherwise keep INFECTED_VIRION state
-								} else if g.state[i][j] == INFECTED_DIP || g.state[i][j] == INFECTED_DIP_CONTINUOUS {
-									if infectedByVirion {
-										fmt.Printf("COINFECT: frame %d cell (%d,%d) DIP->BOTH by VIRION; localVirions=%d localDIPs=%d pV=%.6f pD=%.6f\n",
-											frameNum, i, j, g.localVirions[i][j], g.localDips[i][j], probabilityVInfection, probabilityDInfection)
-										newGrid[i][j] = INFECTED_BOTH // DIP + Virion = Both
-									}
-									// Otherwise keep INFECTED_DIP state
-								}
-							}
+// Function to draw a positive duration from Normal(mean, cv*mean); cv <= 0 returns mean exactly
+func samplePositiveDuration(rng *rand.Rand, mean, cv float64) float64 {
+	if cv <= 0 || mean <= 0 {
+		return mean
+	}
+	for tries := 0; tries < 100; tries++ {
+		d := mean + cv*mean*rng.NormFloat64()
+		if d > 0 {
+			return d
+		}
+	}
+	return mean
+}
 
-						}
-						if g.state[i][j] == INFECTED_VIRION || g.state[i][j] == INFECTED_BOTH && TAU > 0 {
-
-							if VStimulateIFN == true {
-								if g.state[i][j] == INFECTED_VIRION {
-									g.IFNConcentration[i][j] += float64(R) * float64(TIMESTEP) * ifnBothFold
-								} else if g.state[i][j] == INFECTED_BOTH {
-
-									// if g.intraWT[i][j] > 0 {
-									// 	dvgWtRatio := float64(g.intraDVG[i][j]) / float64(g.intraWT[i][j])
-									// 	if g.state[i][j] == INFECTED_BOTH {
-									// 		adjusted_DIP_IFN_stimulate *= dvgWtRatio * BOTH_IFN_stimulate_ratio
-									// 	}
-									// }
-									adjusted_DIP_IFN_stimulate = BOTH_IFN_stimulate_ratio
-									g.IFNConcentration[i][j] += (float64(R) + adjusted_DIP_IFN_stimulate) * float64(TIMESTEP)
-								}
-							} else if VStimulateIFN == false {
-								if g.state[i][j] == INFECTED_VIRION {
-									// do nothing since virions do not stimulate IFN
-								} else if g.state[i][j] == INFECTED_BOTH {
-
-									// if g.intraWT[i][j] > 0 {
-									// 	dvgWtRatio := float64(g.intraDVG[i][j]) / float64(g.intraWT[i][j])
-									// 	if g.state[i][j] == INFECTED_BOTH {
-									// 		adjusted_DIP_IFN_stimulate *= dvgWtRatio * BOTH_IFN_stimulate_ratio
-									// 	}
-									// }
-
-									adjusted_DIP_IFN_stimulate = BOTH_IFN_stimulate_ratio
-
-								}
-								g.IFNConcentration[i][j] += (float64(R) + adjusted_DIP_IFN_stimulate) * float64(TIMESTEP)
-							}
-
-							globalIFN += g.IFNConcentration[i][j]
+// Function to record a continuous-mode infection and sample the cell's own incubation period and lysis time
+func (g *Grid) markContinuousInfection(i, j, frameNum int) {
+	g.sampleContinuousInfection(g.rng, i, j, frameNum)
+	g.countContinuousSample(i, j)
+}
 
-						}
+// Function to record a continuous-mode infection of (i,j) and draw its incubation period and
+// lysis time from rng, without adding them to the run's sample sums
+func (g *Grid) sampleContinuousInfection(rng *rand.Rand, i, j, frameNum int) {
+	g.infectionTime[i][j] = frameNum
+	g.incubationPeriodCell[i][j] = int(math.Round(samplePositiveDuration(rng, float64(g.continuousIncubationPeriod), *flag_continuousIncubationCV)))
+	g.lysisTimeCell[i][j] = samplePositiveDuration(rng, g.continuousLysisTime, *flag_continuousLysisCV)
+}
 
-						if g.state[i][j] == INFECTED_DIP || g.state[i][j] == INFECTED_DIP_CONTINUOUS {
-							// Set DVG recovery threshold if not already set
-							if g.dipLysisThreshold[i][j] == -1 {
-								g.dipLysisThreshold[i][j] = int(rand.NormFloat64()*STANDARD_DVG_RECOVERY_TIME + MEAN_DVG_RECOVERY_TIME)
-							}
-
-							g.timeSinceInfectDIP[i][j] += TIMESTEP
-
-							// Check if DVG-infected cell should recover (return to susceptible)
-							if g.dipLysisThreshold[i][j] > 0 && g.timeSinceInfectDIP[i][j] >= g.dipLysisThreshold[i][j] {
-								// DVG-infected cell returns to susceptible state (no particle release)
-								newGrid[i][j] = SUSCEPTIBLE
-								g.timeSinceInfectDIP[i][j] = -1
-								g.dipLysisThreshold[i][j] = -1
-								g.timeSinceSusceptible[i][j] = 0
-							} else if g.timeSinceInfectDIP[i][j] > IFN_DELAY+int(math.Floor(rand.NormFloat64()*float64(STD_IFN_DELAY))) && TAU > 0 {
-								// Continue producing IFN while infected
-								//adjusted_DIP_IFN_stimulate := float64(g.intraDVG[i][j]) * D_only_IFN_stimulate_ratio
-								adjusted_DIP_IFN_stimulate := D_only_IFN_stimulate_ratio
-								g.IFNConcentration[i][j] += (float64(R) + adjusted_DIP_IFN_stimulate) * float64(TIMESTEP)
-								globalIFN += g.IFNConcentration[i][j]
-							}
+// Function to add the sampled incubation period and lysis time of (i,j) to the run's sample sums
+func (g *Grid) countContinuousSample(i, j int) {
+	g.sampledContinuousCells++
+	g.sampledIncubationSum += float64(g.incubationPeriodCell[i][j])
+	g.sampledLysisTimeSum += g.lysisTimeCell[i][j]
+}
 
-						}
+// Function to clear a cell's continuous-mode infection record back to its initialize values, so a
+// cell returning to SUSCEPTIBLE or REGROWTH starts its next infection immature and with no
+// intracellular virus left over from the previous occupant
+func (g *Grid) resetContinuousState(i, j int) {
+	g.isProducing[i][j] = false
+	g.infectionTime[i][j] = 0
+	g.intraWT[i][j] = 0
+	g.intraDVG[i][j] = 0
+	g.incubationPeriodCell[i][j] = g.continuousIncubationPeriod
+	g.lysisTimeCell[i][j] = g.continuousLysisTime
+}
 
-					}
+// Function to draw a DIP-only cell's clearance time from Normal(dipClearanceMean, dipClearanceStd)
+func (g *Grid) generateDipClearanceTime() int {
+	clearanceTime := int(g.rng.NormFloat64()**flag_dipClearanceStd + *flag_dipClearanceMean)
+	// Ensure minimum clearance time of 1 hour
+	if clearanceTime < 1 {
+		clearanceTime = 1
+	}
+	return clearanceTime
+}
 
-				}
-			}
+// Function to pick how many particles of a partition-mode burst jump to random cells (the rest
+// spread locally). perBurst splits every burst by k_JumpR; perCell sends the whole burst of a
+// k_JumpR fraction of lysing cells and nothing from the others.
+func (g *Grid) partitionRandomJumps(burstV, burstD int) (int, int) {
+	jumpFraction := k_JumpR
+	if *flag_partitionSemantics == "perCell" {
+		jumpFraction = 0
+		if g.rng.Float64() < k_JumpR {
+			jumpFraction = 1
 		}
-		// Handle potentially regrowing dead cells
-		for i := 0; i < GRID_SIZE; i++ {
-			for j := 0; j < GRID_SIZE; j++ {
-				if g.state[i][j] == DEAD {
-					g.timeSinceDead[i][j] += TIMESTEP
-
-					// Check if any neighboring cells are susceptible, allowing for regrowth
-					canRegrow := false
-					neighbors := g.neighbors1[i][j]
-
-					// Iterate over the neighbors and check if any are SUSCEPTIBLE
-					for _, neighbor := range neighbors {
-						ni, nj := neighbor[0], neighbor[1]
-
-						// Ensure the neighbor indices are valid (within grid bounds)
-						if ni >= 0 && ni < GRID_SIZE && nj >= 0 && nj < GRID_SIZE {
+	}
+	randomVirions := int(math.Floor(float64(burstV) * jumpFraction))
+	randomDIPs := int(math.Floor(float64(burstD) * jumpFraction))
+	g.partitionReleased += burstV + burstD
+	g.partitionJumped += randomVirions + randomDIPs
+	return randomVirions, randomDIPs
+}
 
-							if g.state[ni][nj] == SUSCEPTIBLE || g.state[ni][nj] == ANTIVIRAL {
-								canRegrow = true
-								break
+// Function to return the fraction of partition-mode particles that actually jumped (-1 if none released)
+func (g *Grid) partitionJumpFraction() float64 {
+	if g.partitionReleased == 0 {
+		return -1
+	}
+	return float64(g.partitionJumped) / float64(g.partitionReleased)
+}
 
-							}
+// Function to report whether DIP-only infected cells are kept indefinitely (-dipPersistence=persist)
+func dipOnlyPersists() bool {
+	return *flag_dipPersistence == "persist"
+}
 
-						}
-					}
+// Function to report whether the dipClearanceMean/Std clock clears DIP-only cells
+func dipClearanceClockActive() bool {
+	return *flag_dipClearanceModel != "recoveryTime"
+}
 
-					// If the conditions are met, the cell regrows
-					if canRegrow && g.timeSinceDead[i][j] >= int(rand.NormFloat64()*REGROWTH_STD+REGROWTH_MEAN) {
-						newGrid[i][j] = REGROWTH
-						g.timeSinceRegrowth[i][j] = 0
-						g.timeSinceDead[i][j] = -1
+// Function to report whether the dvgRecoveryTime clock clears DIP-only cells
+func dvgRecoveryClockActive() bool {
+	return *flag_dipClearanceModel != "fixedNormal"
+}
 
-					}
+// Function to advance the antiviral commitment timer of (i,j) by one step, given the IFN level of
+// the cell's infection draw. legacy advances whenever the pathway runs (any IFN on the cell);
+// ifnDependent holds the timer while the level is below -antiviralIFNThreshold.
+func (g *Grid) advanceAntiviralCommitment(i, j int, ifn float64) {
+	if *flag_antiviralCommitModel == "ifnDependent" && ifn < *flag_antiviralIFNThreshold {
+		return
+	}
+	g.timeSinceAntiviral[i][j] += TIMESTEP
+}
 
-				}
+// Function to advance the time every ANTIVIRAL cell has spent in the state (0 on the frame it is
+// first seen), and count the cells that have ever been antiviral and the cell-hours spent so far
+func (g *Grid) updateAntiviralTime() {
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			if g.state[i][j] != ANTIVIRAL {
+				continue
+			}
+			if !g.antiviralFlag[i][j] {
+				g.antiviralFlag[i][j] = true
+				g.antiviralCellCount++
+			}
+			if g.timeInAntiviralState[i][j] < 0 {
+				g.timeInAntiviralState[i][j] = 0
+			} else {
+				g.timeInAntiviralState[i][j] += TIMESTEP
+				g.totalAntiviralTime += TIMESTEP
 			}
 		}
-		// IFN exponential decay
+	}
+}
 
-		if ifn_half_life != 0 {
-			globalIFN = globalIFN * math.Pow(0.5, float64(TIMESTEP)/ifn_half_life)
-			if globalIFN < (1.0 / (float64(GRID_SIZE) * float64(GRID_SIZE))) {
-				globalIFN = 0
+// Function to revert ANTIVIRAL cells to -antiviralExitState after a normally distributed
+// -antiviralDuration (drawn on the frame the cell turns ANTIVIRAL, at least one step). The
+// entry frame counts as the first step, so a duration of D keeps the cell ANTIVIRAL in D frames.
+// The cell leaves the antiviral pathway, so renewed IFN exposure starts a new commitment timer.
+func (g *Grid) handleAntiviralExit(frameNum int) {
+	g.antiviralExits = 0
+	if *flag_antiviralDuration <= 0 {
+		return
+	}
+	exitState := SUSCEPTIBLE
+	if *flag_antiviralExitState == "REGROWTH" {
+		exitState = REGROWTH
+	}
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			if g.state[i][j] != ANTIVIRAL {
+				continue
+			}
+			if g.antiviralRemaining[i][j] == -1 {
+				g.antiviralRemaining[i][j] = int(math.Round(g.rng.NormFloat64()**flag_antiviralDurationStd + *flag_antiviralDuration))
+				if g.antiviralRemaining[i][j] < TIMESTEP {
+					g.antiviralRemaining[i][j] = TIMESTEP
+				}
+				continue
+			}
+			g.antiviralRemaining[i][j] -= TIMESTEP
+			if g.antiviralRemaining[i][j] > 0 {
+				continue
+			}
+			g.state[i][j] = exitState
+			g.antiviralRemaining[i][j] = -1
+			g.antiviralDuration[i][j] = -1
+			g.timeSinceAntiviral[i][j] = -1
+			g.timeInAntiviralState[i][j] = -1
+			if exitState == REGROWTH {
+				g.timeSinceRegrowth[i][j] = 0
+			} else {
+				g.timeSinceSusceptible[i][j] = 0
 			}
+			g.antiviralExits++
 		}
+	}
+	if g.antiviralExits > 0 {
+		debugf("🔓 Frame %d: %d antiviral cells reverted to %s\n", frameNum, g.antiviralExits, stateNames[exitState])
+	}
+}
 
-		globalIFNperCell = globalIFN / float64(GRID_SIZE*GRID_SIZE)
-		// Apply the updated grid state
-		g.state = newGrid
-
-		// Calculate and log the total virions and DIPs for each time step
-		totalVirions, totalDIPs := g.totalVirions(), g.totalDIPs()
-		fmt.Printf("Time step %d: Total Virions = %d, Total DIPs = %d\n", frameNum, totalVirions, totalDIPs)
-
-		// Additional calculations based on simulation parameters for tracking purposes
-		regrowthCount := g.calculateRegrowthCount()
-		susceptiblePercentage := g.calculateSusceptiblePercentage()
-
-		regrowthedOrAntiviralPercentage := g.calculateRegrowthedOrAntiviralPercentage()
-		infectedPercentage := g.calculateInfectedPercentage()
-		infectedDIPOnlyPercentage := g.calculateInfectedDIPOnlyPercentage()
-		infectedBothPercentage := g.calculateInfectedBothPercentage()
-		antiviralPercentage := g.calculateAntiviralPercentage()
-		deadCellPercentage := calculateDeadCellPercentage(g.state)
-		uninfectedPercentage := g.calculateUninfectedPercentage()
-		plaquePercentage := g.calculatePlaquePercentage()
-		//virionDiffusionRate, dipDiffusionRate := g.calculateDiffusionRates()
-
-		// Log additional data as necessary
-		fmt.Printf("Regrowth Count: %d, Susceptible: %.2f%%", regrowthCount, susceptiblePercentage)
-		fmt.Printf("Regrowthed or Antiviral: %.2f%%, Infected: %.2f%%, DIP Only: %.2f%%, Both Infected: %.2f%%, Antiviral: %.2f%%\n",
-			regrowthedOrAntiviralPercentage, infectedPercentage, infectedDIPOnlyPercentage, infectedBothPercentage, antiviralPercentage)
-		fmt.Printf("Dead: %.2f%%, Uninfected: %.2f%%, Plaque: %.2f%%\n", deadCellPercentage, uninfectedPercentage, plaquePercentage)
-		//fmt.Printf("Virion Diffusion Rate: %d, DIP Diffusion Rate: %d\n", virionDiffusionRate, dipDiffusionRate)
-
+// Handle DIP-only infected cells clearance (become susceptible after dipClearanceMean±dipClearanceStd
+// steps if still DIP-only). Runs at the end of the frame, so under -dipClearanceModel=both a
+// DVG recovery due in the same frame has already happened in the update.
+func (g *Grid) handleDipOnlyClearance(frameNum int) {
+	if dipOnlyPersists() || !dipClearanceClockActive() {
+		return
 	}
+	dipOnlyClearedCount := 0
 
-	// TIMESTEP = 1 hour. If 1 hour/step, use dt = 1.0
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			// Handle both burst mode (INFECTED_DIP) and continuous mode (INFECTED_DIP_CONTINUOUS)
+			if isInfectedDIPOnly(g.state[i][j]) {
+				// Set clearance threshold if not already set
+				if g.dipClearanceThreshold[i][j] == -1 {
+					g.dipClearanceThreshold[i][j] = g.generateDipClearanceTime()
+				}
 
-	if virion_half_life != 0 {
-		for i := 0; i < GRID_SIZE; i++ {
-			for j := 0; j < GRID_SIZE; j++ {
-				// Update virus count using half-life formula
-				factorV := math.Pow(0.5, float64(TIMESTEP)/virion_half_life)
-				g.localVirions[i][j] = int(math.Floor(float64(g.localVirions[i][j])*factorV + 0.5))
-
-				// Use per-cell DIP half-life
-				hl := g.dipHalfLife[i][j]
-				if hl > 0 {
-					factorD := math.Pow(0.5, float64(TIMESTEP)/hl)
-					g.localDips[i][j] = int(math.Floor(float64(g.localDips[i][j])*factorD + 0.5))
+				// Check if DIP clearance time has been reached
+				if g.timeSinceInfectDIP[i][j] >= g.dipClearanceThreshold[i][j] {
+					// Clear DIP-only infected cell back to susceptible
+					g.state[i][j] = SUSCEPTIBLE
+					g.timeSinceInfectDIP[i][j] = -1
+					g.dipClearanceThreshold[i][j] = -1
+					g.timeSinceSusceptible[i][j] = 0
+					g.resetContinuousState(i, j)
+					dipOnlyClearedCount++
 				}
 			}
 		}
 	}
 
-	// Clear any viral particles that may have accumulated on dead cell locations
-	g.clearParticlesFromDeadCells()
+	if dipOnlyClearedCount > 0 {
+		fmt.Printf("🔄 Frame %d: %d DIP-only infected cells cleared and became susceptible\n", frameNum, dipOnlyClearedCount)
+	}
+}
 
-	// Handle DIP-only infected cells clearance (become susceptible after mean=2±1 hours if still DIP-only)
-	g.handleDipOnlyClearance(frameNum)
+// Test function to verify that dead cells have no viral particles
+func (g *Grid) testDeadCellParticleClearance(frameNum int) {
+	deadCellsWithParticles := 0
+	totalDeadCells := 0
 
-	// Test to verify dead cells have no particles (only run test every 6 hours to reduce output)
-	if frameNum%6 == 0 {
-		g.testDeadCellParticleClearance(frameNum)
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			if g.state[i][j] == DEAD {
+				totalDeadCells++
+				if g.localVirions[i][j] > 0 || g.localDips[i][j] > 0 {
+					deadCellsWithParticles++
+					fmt.Printf("⚠️  Frame %d: Dead cell at (%d,%d) has %d virions and %d DIPs!\n",
+						frameNum, i, j, g.localVirions[i][j], g.localDips[i][j])
+				}
+			}
+		}
 	}
 
+	if deadCellsWithParticles == 0 && totalDeadCells > 0 {
+		fmt.Printf("✅ Frame %d: All %d dead cells have 0 viral particles (test passed)\n", frameNum, totalDeadCells)
+	} else if totalDeadCells == 0 {
+		// No dead cells to test - this is normal in early frames
+	} else {
+		fmt.Printf("❌ Frame %d: %d out of %d dead cells still have viral particles (test failed)\n",
+			frameNum, deadCellsWithParticles, totalDeadCells)
+	}
 }
 
-// Function to record simulation data into CSV at each timestep
-// Function to record simulation data into CSV at each timestep
-func (g *Grid) recordSimulationData(writer *csv.Writer, frameNum int) {
-	totalVirions := g.totalVirions()
-	totalDIPs := g.totalDIPs()
-	deadCellPercentage := strconv.FormatFloat(calculateDeadCellPercentage(g.state), 'f', 6, 64)
-	susceptiblePercentage := strconv.FormatFloat(g.calculateSusceptiblePercentage(), 'f', 6, 64)
-	infectedPercentage := strconv.FormatFloat(g.calculateInfectedPercentage(), 'f', 6, 64)
-	infectedDIPOnlyPercentage := strconv.FormatFloat(g.calculateInfectedDIPOnlyPercentage(), 'f', 6, 64)
-	infectedBothPercentage := strconv.FormatFloat(g.calculateInfectedBothPercentage(), 'f', 6, 64)
-	antiviralPercentage := strconv.FormatFloat(g.calculateAntiviralPercentage(), 'f', 6, 64)
-	virionOnlyInfected := g.calculateVirionOnlyInfected()
-	dipOnlyInfected := g.calculateDipOnlyInfected()
-	bothInfected := g.calculateBothInfected()
-
-	// Calculate DIP advantage = burstSizeD / burstSizeV
-	dipAdvantage = float64(BURST_SIZE_D) / float64(BURST_SIZE_V)
+// Update the state of the grid at each time step
+func (g *Grid) update(frameNum int) {
+	newGrid := g.state
+	stateAtStart := g.state // snapshot for per-frame infection/lysis event counts
+	g.virionsAtFrameStart = g.localVirions
+	g.releasedVirionsNow, g.releasedDIPsNow = 0, 0
+	g.dipsAtFrameStart = g.localDips
+	g.powCache.reset(*flag_powCacheBound)
+	g.suppressedCoinfections = 0
 
-	row := []string{
-		strconv.Itoa(frameNum),
-		strconv.FormatFloat(virion_half_life, 'f', 6, 64), // Add virion clearance rate
-		strconv.FormatFloat(dip_half_life, 'f', 6, 64),    // Add DIP clearance rate
-		strconv.FormatFloat(ifn_half_life, 'f', 6, 64),    // Add IFN clearance rate
-		strconv.FormatFloat(globalIFN/float64(GRID_SIZE*GRID_SIZE), 'f', 6, 64),
-		strconv.Itoa(totalVirions),
-		strconv.Itoa(totalDIPs),
-		deadCellPercentage,
-		susceptiblePercentage,
-		infectedPercentage,
-		infectedDIPOnlyPercentage,
-		infectedBothPercentage,
-		antiviralPercentage,
-		strconv.Itoa(g.calculateRegrowthCount()),
-		strconv.FormatFloat(g.calculateSusceptiblePercentage(), 'f', 6, 64),
-		strconv.FormatFloat(g.calculateRegrowthedOrAntiviralPercentage(), 'f', 6, 64),
-		"variate, depending on radius 10 of IFN",
-		"variate, depending on radius 10 of IFN",
-		strconv.FormatFloat(RHO, 'f', 6, 64),
-		strconv.Itoa(totalVirions + totalDIPs),
-		strconv.FormatFloat(g.calculatePlaquePercentage(), 'f', 6, 64),
-		strconv.FormatFloat(float64(maxGlobalIFN), 'f', 6, 64),
-		"-1.0",
-		strconv.FormatFloat(g.calculateUninfectedPercentage(), 'f', 6, 64),
-		"0",
-		strconv.Itoa(GRID_SIZE),
-		strconv.Itoa(TIMESTEP),
-		strconv.Itoa(IFN_DELAY),
-		strconv.Itoa(STD_IFN_DELAY),
-		strconv.FormatFloat(ALPHA, 'f', 6, 64),
-		strconv.FormatFloat(RHO, 'f', 6, 64),
-		strconv.FormatFloat(float64(TAU), 'f', 6, 64),
-		strconv.Itoa(BURST_SIZE_V),
-		strconv.FormatFloat(REGROWTH_MEAN, 'f', 6, 64),
-		strconv.FormatFloat(REGROWTH_STD, 'f', 6, 64),
-		strconv.Itoa(TIME_STEPS),
-		strconv.FormatFloat(MEAN_LYSIS_TIME, 'f', 6, 64),
-		strconv.FormatFloat(STANDARD_LYSIS_TIME, 'f', 6, 64),
-		strconv.FormatFloat(float64(*flag_v_pfu_initial)/float64(GRID_SIZE*GRID_SIZE), 'f', 6, 64),
-		strconv.FormatFloat(float64(*flag_d_pfu_initial)/float64(GRID_SIZE*GRID_SIZE), 'f', 6, 64),
-		"-1.0",
-		"-1.0",
-		strconv.FormatFloat(float64(R), 'f', 6, 64),
-		strconv.Itoa(BURST_SIZE_D),
-		"-1.0",
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			g.stateChanged[i][j] = false
+		}
+	}
 
-		strconv.Itoa(option),
-		strconv.FormatFloat(*flag_v_pfu_initial, 'f', -1, 64),
-		strconv.FormatFloat(*flag_d_pfu_initial, 'f', -1, 64),
-		strconv.Itoa(virionOnlyInfected),
-		strconv.Itoa(dipOnlyInfected),
-		strconv.Itoa(bothInfected),
-		strconv.Itoa(totalDeadFromV),
-		strconv.Itoa(totalDeadFromBoth),
-		strconv.Itoa(virionDiffusionRate),
-		strconv.Itoa(dipDiffusionRate),
-		strconv.FormatFloat(k_JumpR, 'f', 6, 64),
-		strconv.Itoa(jumpRadiusV),
-		strconv.Itoa(jumpRadiusD),
-		strconv.FormatBool(jumpRandomly),
-		strconv.FormatBool(par_celltocell_random),
-		strconv.FormatBool(allowVirionJump),
-		strconv.FormatBool(allowDIPJump),
-		strconv.Itoa(IFN_wave_radius),
-		strconv.FormatBool(ifnWave),
-		strconv.FormatFloat(ifnBothFold, 'f', 6, 64),
-		strconv.FormatFloat(D_only_IFN_stimulate_ratio, 'f', 6, 64),
-		strconv.FormatFloat(BOTH_IFN_stimulate_ratio, 'f', 6, 64),
-		strconv.Itoa(g.totalRandomJumpVirions),        // New: total number of randomly jumping Virions
-		strconv.Itoa(g.totalRandomJumpDIPs),           // New: total number of randomly jumping DIPs
-		strconv.FormatFloat(dipAdvantage, 'f', 6, 64), // DIP advantage = burstSizeD / burstSizeV
+	// The IFN level each cell's draws see this step: local IFN averages the field over each cell's
+	// IFN area, global IFN gives every cell the same share of the pool. Otherwise the two models
+	// share the sweeps below and differ only in IFN secretion (secreteIFN, secreteDIPOnlyIFN), the
+	// pool decay after the sweeps, and global IFN's legacy lysis comparison (lysisDue).
+	var localIFN func(i, j int) float64
+	if ifnWave {
+		localIFN = g.prepareLocalIFN()
+	} else {
+		localIFN = g.prepareGlobalIFN()
 	}
 
-	writer.Write(row)
-	writer.Flush()
-}
-
-// Convert the grid state into an image
-func (g *Grid) gridToImage(videotype string) *image.RGBA {
-
-	imgWidth := GRID_SIZE * CELL_SIZE * 2                       // Calculate the image width
-	imgHeight := GRID_SIZE * CELL_SIZE * 2                      // Calculate the image height
-	img := image.NewRGBA(image.Rect(0, 0, imgWidth, imgHeight)) // Create a new image
-	if videotype == "states" {
-		// Define colors for different states
-		colors := map[int]color.Color{
-			SUSCEPTIBLE:     color.RGBA{0, 0, 0, 255},       // Susceptible state: black
-			INFECTED_VIRION: color.RGBA{255, 0, 0, 255},     // Infected by virion: red
-			INFECTED_DIP:    color.RGBA{0, 255, 0, 255},     // Infected by DIP: green
-			INFECTED_BOTH:   color.RGBA{255, 255, 0, 255},   // Infected by both: yellow
-			DEAD:            color.RGBA{169, 169, 169, 255}, // Dead state: gray
-			ANTIVIRAL:       color.RGBA{0, 0, 255, 255},     // Antiviral state: blue
-			REGROWTH:        color.RGBA{128, 0, 128, 255},   // Regrowth state: purple
-			UNEXPOSED:       color.RGBA{0, 0, 0, 255},       // UNEXPOSED: black (same as susceptible but frozen)
-			// Continuous mode states (use same colors as burst mode for now)
-			INFECTED_VIRION_CONTINUOUS: color.RGBA{255, 0, 0, 255},   // Infected by virion continuous: red
-			INFECTED_DIP_CONTINUOUS:    color.RGBA{0, 255, 0, 255},   // Infected by DIP continuous: green
-			INFECTED_BOTH_CONTINUOUS:   color.RGBA{255, 255, 0, 255}, // Infected by both continuous: yellow
-		}
-		fillBackground(img, color.RGBA{0, 0, 0, 255})
-		for i := 0; i < GRID_SIZE; i++ {
-			for j := 0; j < GRID_SIZE; j++ {
-				x, y := calculateHexCenter(i, j)              // Calculate the center of each hexagon
-				drawHexagon(img, x, y, colors[g.state[i][j]]) // Draw the hexagon based on the cell state
-			}
-		}
-		// Return the image
-	} else if videotype == "IFNconcentration" { // IFN concentration visualization
-		black := color.RGBA{0, 0, 0, 255} // Default color (black)
+	// Traverse the grid: antiviral commitment and primary infection
+	g.sweepUninfectedCells(&newGrid, frameNum, localIFN)
 
-		for i := 0; i < GRID_SIZE; i++ {
-			for j := 0; j < GRID_SIZE; j++ {
-				x, y := calculateHexCenter(i, j) // Calculate hexagon center coordinates
-				ifnValue := g.IFNConcentration[i][j]
-
-				var cellColor color.RGBA
-				if ifnValue <= 0 {
-					cellColor = black // IFN ≤ 0, black
-				} else if ifnValue > 0 && ifnValue <= 1 {
-					cellColor = color.RGBA{0, 0, 255, 255} // Blue
-				} else if ifnValue > 1 && ifnValue <= 2 {
-					cellColor = color.RGBA{0, 255, 0, 255} // Green
-				} else if ifnValue > 2 && ifnValue <= 5 {
-					cellColor = color.RGBA{255, 255, 0, 255} // Yellow
-				} else if ifnValue > 5 && ifnValue <= 10 {
-					cellColor = color.RGBA{255, 165, 0, 255} // Orange
-				} else {
-					cellColor = color.RGBA{255, 0, 0, 255} // Red
-				}
+	// Process infected cells: lysis, production, co-infection, IFN secretion and DIP recovery
+	g.sweepInfectedCells(&newGrid, frameNum, localIFN)
 
-				drawHexagon(img, x, y, cellColor)
+	// Handle potentially regrowing dead cells
+	g.regrowDeadCells(&newGrid)
+
+	if !ifnWave {
+		// Global IFN pool exponential decay
+		if ifn_half_life != 0 {
+			globalIFN = globalIFN * math.Pow(0.5, float64(TIMESTEP)/ifn_half_life)
+			if globalIFN < (1.0 / (float64(GRID_SIZE) * float64(GRID_SIZE))) {
+				globalIFN = 0
 			}
 		}
-	} else if videotype == "IFNonlyLargerThanZero" { // IFN concentration visualization
-		red := color.RGBA{255, 0, 0, 255} // Cells with interferon > 0
-		blue := color.RGBA{0, 0, 255, 255}
-		black := color.RGBA{0, 0, 0, 255} // Default color for all other cells
-		yellow := color.RGBA{255, 255, 0, 255}
-		green := color.RGBA{0, 255, 0, 255}
-		organge := color.RGBA{255, 165, 0, 255}
-		for i := 0; i < GRID_SIZE; i++ {
-			for j := 0; j < GRID_SIZE; j++ {
-				x, y := calculateHexCenter(i, j) // Calculate the center of each hexagon
+		globalIFNperCell = globalIFN / float64(GRID_SIZE*GRID_SIZE)
+	}
 
-				// Apply color based on the specified conditions
-				if g.timeSinceAntiviral[i][j] > g.antiviralDuration[i][j] {
-					drawHexagon(img, x, y, blue) // blue for cells in antiviral state exceeding duration
+	// Apply the updated grid state
+	g.state = newGrid
 
-				} else if g.timeSinceAntiviral[i][j] > 110 {
-					drawHexagon(img, x, y, red) //
+	// Calculate and log the total virions and DIPs for each time step
+	totalVirions, totalDIPs := g.totalVirions(), g.totalDIPs()
+	fmt.Printf("Time step %d: Total Virions = %d, Total DIPs = %d\n", frameNum, totalVirions, totalDIPs)
 
-				} else if g.timeSinceAntiviral[i][j] > 90 {
-					drawHexagon(img, x, y, organge) //
+	// Additional calculations based on simulation parameters for tracking purposes
+	regrowthCount := g.calculateRegrowthCount()
+	susceptiblePercentage := g.calculateSusceptiblePercentage()
 
-				} else if g.timeSinceAntiviral[i][j] > 70 {
-					drawHexagon(img, x, y, green) //
+	regrowthedOrAntiviralPercentage := g.calculateRegrowthedOrAntiviralPercentage()
+	infectedPercentage := g.calculateInfectedPercentage()
+	infectedDIPOnlyPercentage := g.calculateInfectedDIPOnlyPercentage()
+	infectedBothPercentage := g.calculateInfectedBothPercentage()
+	antiviralPercentage := g.calculateAntiviralPercentage()
+	deadCellPercentage := calculateDeadCellPercentage(g.state)
+	uninfectedPercentage := g.calculateUninfectedPercentage()
+	plaquePercentage := g.calculatePlaquePercentage()
 
-				} else if g.timeSinceAntiviral[i][j] > 50 {
-					drawHexagon(img, x, y, yellow) //
+	// Log additional data as necessary
+	fmt.Printf("Regrowth Count: %d, Susceptible: %.2f%%\n", regrowthCount, susceptiblePercentage)
+	fmt.Printf("Regrowthed or Antiviral: %.2f%%, Infected: %.2f%%, DIP Only: %.2f%%, Both Infected: %.2f%%, Antiviral: %.2f%%\n",
+		regrowthedOrAntiviralPercentage, infectedPercentage, infectedDIPOnlyPercentage, infectedBothPercentage, antiviralPercentage)
+	fmt.Printf("Dead: %.2f%%, Uninfected: %.2f%%, Plaque: %.2f%%\n", deadCellPercentage, uninfectedPercentage, plaquePercentage)
 
-				} else {
-					drawHexagon(img, x, y, black) // Black for all other cells
-				}
-			}
-		}
-	} else if videotype == "antiviralState" {
+	// TIMESTEP = 1 hour. If 1 hour/step, use dt = 1.0
 
-		blue := color.RGBA{0, 0, 255, 255}
-		black := color.RGBA{0, 0, 0, 255} // Default color for all other cells
+	g.decayAndAdsorbParticles()
 
-		for i := 0; i < GRID_SIZE; i++ {
-			for j := 0; j < GRID_SIZE; j++ {
-				x, y := calculateHexCenter(i, j) // Calculate the center of each hexagon
+	// Immune cells patrol and clear infected cells (their particles are cleared below like any dead cell's)
+	g.updateImmuneCells(frameNum)
 
-				// Apply color based on the specified conditions
-				if g.timeSinceAntiviral[i][j] > g.antiviralDuration[i][j] {
-					drawHexagon(img, x, y, blue) // blue for cells in antiviral state exceeding duration
-				} else {
-					drawHexagon(img, x, y, black) // Black for all other cells
-				}
-			}
-		}
-	} else if videotype == "particles" {
+	// Clear any viral particles that may have accumulated on dead cell locations
+	g.clearParticlesFromDeadCells()
 
-		fillBackground(img, color.RGBA{0, 0, 0, 255})
-		for i := 0; i < GRID_SIZE; i++ {
-			for j := 0; j < GRID_SIZE; j++ {
-				x, y := calculateHexCenter(i, j)
-
-				// Determine color based on particle presence
-				hasVirion := g.localVirions[i][j] > 0
-				hasDIP := g.localDips[i][j] > 0
-
-				var particleColor color.Color
-				switch {
-				case hasVirion && hasDIP:
-					particleColor = color.RGBA{255, 255, 0, 255} // Yellow (both present)
-				case hasVirion:
-					particleColor = color.RGBA{255, 0, 0, 255} // Red (Virion only)
-				case hasDIP:
-					particleColor = color.RGBA{0, 255, 0, 255} // Green (DIP only)
-				default:
-					particleColor = color.RGBA{0, 0, 0, 255} // Black (no particles)
-				}
+	// Handle DIP-only infected cells clearance (become susceptible after mean=2±1 hours if still DIP-only)
+	g.handleDipOnlyClearance(frameNum)
 
-				drawHexagon(img, x, y, particleColor)
+	// ANTIVIRAL cells age, and those whose -antiviralDuration has run out revert
+	g.updateAntiviralTime()
+	g.handleAntiviralExit(frameNum)
 
-				// Optional: add particle count text at hexagon center
-				//if hasVirion || hasDIP {
-				//	label := fmt.Sprintf("V:%d\nD:%d", g.localVirions[i][j], g.localDips[i][j])
-				//	addLabelCentered(img, x, y, label, color.White)
-				//}
+	// REGROWTH cells whose -regrowthMaturationTime has run out become SUSCEPTIBLE
+	g.handleRegrowthMaturation(frameNum)
 
-			}
-		}
+	// Test to verify dead cells have no particles (only run test every 6 hours to reduce output)
+	if frameNum%6 == 0 {
+		g.testDeadCellParticleClearance(frameNum)
+	}
 
-	} else if videotype == "baltes" {
-		// Define colors for different states (same as "states" videotype)
-		colors := map[int]color.Color{
-			SUSCEPTIBLE:     color.RGBA{0, 0, 0, 255},       // Susceptible state: black
-			INFECTED_VIRION: color.RGBA{255, 0, 0, 255},     // Infected by virion: red
-			INFECTED_DIP:    color.RGBA{0, 255, 0, 255},     // Infected by DIP: green
-			INFECTED_BOTH:   color.RGBA{255, 255, 0, 255},   // Infected by both: yellow
-			DEAD:            color.RGBA{169, 169, 169, 255}, // Dead state: gray
-			ANTIVIRAL:       color.RGBA{0, 0, 255, 255},     // Antiviral state: blue
-			REGROWTH:        color.RGBA{128, 0, 128, 255},   // Regrowth state: purple
-			UNEXPOSED:       color.RGBA{0, 0, 0, 255},       // UNEXPOSED: black (same as susceptible but frozen)
-			// Continuous mode states (use same colors as burst mode for now)
-			INFECTED_VIRION_CONTINUOUS: color.RGBA{255, 0, 0, 255},   // Infected by virion continuous: red
-			INFECTED_DIP_CONTINUOUS:    color.RGBA{0, 255, 0, 255},   // Infected by DIP continuous: green
-			INFECTED_BOTH_CONTINUOUS:   color.RGBA{255, 255, 0, 255}, // Infected by both continuous: yellow
-		}
+	// Attribute this frame's new infections to a parent release, then record wavefront arrival times
+	if lineageTracked() {
+		g.updateLineage(frameNum)
+	}
+	g.updateFirstInfectionTime(frameNum)
+	g.updateInfectionStart(frameNum)
+	if *flag_superinfectionExclusionHours > 0 {
+		fmt.Printf("🛡️ Frame %d: %d co-infections suppressed by superinfection exclusion\n", frameNum, g.suppressedCoinfections)
+	}
+	g.updateRescueTracking()
 
-		fillBackground(img, color.RGBA{0, 0, 0, 255})
+	// Count new infections and lysis events for the R_eff(t) estimate
+	g.countFrameEvents(stateAtStart)
+
+}
 
-		// Precompute visual-only black overlay set based on flag_unexposedSetAreaFraction
-		overlayFraction := *flag_unexposedSetAreaFraction
-		useOverlay := overlayFraction > 0.0
-		var overlayMask [][]bool
-		if useOverlay {
-			total := GRID_SIZE * GRID_SIZE
-			target := int(math.Round(overlayFraction * float64(total)))
-			if target < 0 {
-				target = 0
+// Function to count the cells that have ever been REGROWTH and mature REGROWTH cells to
+// SUSCEPTIBLE after a normally distributed -regrowthMaturationTime (drawn on the frame the cell
+// turns REGROWTH, at least one step). The entry frame counts as the first step, so a maturation
+// time of M keeps the cell REGROWTH in M frames. A cell that leaves REGROWTH otherwise draws
+// anew next time.
+func (g *Grid) handleRegrowthMaturation(frameNum int) {
+	matured := 0
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			if g.state[i][j] != REGROWTH {
+				g.regrowthRemaining[i][j] = -1
+				continue
 			}
-			if target > total {
-				target = total
+			if !g.everRegrown[i][j] {
+				g.everRegrown[i][j] = true
+				g.everRegrownCount++
 			}
-			indices := make([]int, total)
-			for idx := 0; idx < total; idx++ {
-				indices[idx] = idx
+			if *flag_regrowthMaturationTime <= 0 {
+				continue
 			}
-			rand.Shuffle(total, func(i, j int) { indices[i], indices[j] = indices[j], indices[i] })
-			overlayMask = make([][]bool, GRID_SIZE)
-			for i := 0; i < GRID_SIZE; i++ {
-				overlayMask[i] = make([]bool, GRID_SIZE)
+			if g.regrowthRemaining[i][j] == -1 {
+				g.regrowthRemaining[i][j] = int(math.Round(g.rng.NormFloat64()**flag_regrowthMaturationStd + *flag_regrowthMaturationTime))
+				if g.regrowthRemaining[i][j] < TIMESTEP {
+					g.regrowthRemaining[i][j] = TIMESTEP
+				}
+				continue
 			}
-			for k := 0; k < target; k++ {
-				idx := indices[k]
-				i := idx / GRID_SIZE
-				j := idx % GRID_SIZE
-				overlayMask[i][j] = true
+			g.regrowthRemaining[i][j] -= TIMESTEP
+			if g.regrowthRemaining[i][j] > 0 {
+				continue
 			}
+			g.state[i][j] = SUSCEPTIBLE
+			g.regrowthRemaining[i][j] = -1
+			g.timeSinceRegrowth[i][j] = -1
+			g.timeSinceSusceptible[i][j] = 0
+			matured++
 		}
+	}
+	if matured > 0 {
+		debugf("🌱 Frame %d: %d regrowth cells matured to SUSCEPTIBLE\n", frameNum, matured)
+	}
+}
 
-		for i := 0; i < GRID_SIZE; i++ {
-			for j := 0; j < GRID_SIZE; j++ {
-				x, y := calculateHexCenter(i, j) // Calculate the center of each hexagon
-
-				// Visualization-only overlay: if selected, draw black regardless of state
-				if useOverlay && overlayMask[i][j] {
-					drawHexagon(img, x, y, color.RGBA{0, 0, 0, 255})
-					continue
-				}
-
-				var cellColor color.Color
-				if g.state[i][j] == DEAD {
-					if prevColor, exists := colors[g.previousStates[i][j]]; exists {
-						cellColor = prevColor
-					} else {
-						cellColor = color.RGBA{169, 169, 169, 255}
-					}
-				} else {
-					if currColor, exists := colors[g.state[i][j]]; exists {
-						cellColor = currColor
-					} else {
-						cellColor = color.RGBA{0, 0, 0, 255}
-					}
-				}
+// Function to prepare the local (ifnWave) IFN field for this step and return the per-cell IFN
+// reader: the field decays once, then every cell's regional average is computed up front. Under
+// the legacy -ifnDecay=perCell the first read of each cell decays the whole field again, so the
+// sweep must read cells in traversal order; later reads of a cell return the same value.
+func (g *Grid) prepareLocalIFN() func(i, j int) float64 {
+	// Step 3: Update max global IFN if needed
+	if globalIFN < 0 {
+		globalIFN = -1.0
+	}
+	if globalIFN > maxGlobalIFN {
+		maxGlobalIFN = globalIFN
+	}
+	fmt.Printf("Global IFN concentration: %.2f\n", globalIFN)
 
-				drawHexagon(img, x, y, cellColor)
+	g.ifnRowSums.valid = false
+	factorIFN := math.Pow(0.5, float64(TIMESTEP)/ifn_half_life)
+	if *flag_ifnModel == "diffusion" {
+		// Decay once, diffuse one time step, then every cell reads its own concentration
+		if ifn_half_life != 0 {
+			g.decayIFN(factorIFN)
+		}
+		g.diffuseIFN(*flag_ifnDiffusionCoeff * float64(TIMESTEP))
+		g.regionalIFNAverage = g.IFNConcentration
+		return func(i, j int) float64 { return g.regionalIFNAverage[i][j] }
+	}
+	if *flag_ifnDecay != "perCell" {
+		// IFN decays once per time step, before any cell reads it. Nothing writes the field until
+		// the infected-cell sweep, so every average can be computed up front, in parallel
+		ifnFieldZero := false
+		if ifn_half_life != 0 {
+			ifnFieldZero = g.decayIFN(factorIFN)
+		}
+		g.fillRegionalIFNAverages(*flag_workers, ifnFieldZero)
+		return func(i, j int) float64 { return g.regionalIFNAverage[i][j] }
+	}
+
+	// ifnFieldZero is set once a decay pass leaves no IFN anywhere; later passes are no-ops
+	ifnFieldZero := false
+	var read [GRID_SIZE][GRID_SIZE]bool
+	return func(i, j int) float64 {
+		if !read[i][j] {
+			read[i][j] = true
+			if ifn_half_life != 0 && !ifnFieldZero {
+				ifnFieldZero = g.decayIFN(factorIFN)
 			}
+			g.regionalIFNAverage[i][j] = g.regionalIFNAverageAt(i, j)
 		}
+		return g.regionalIFNAverage[i][j]
+	}
+}
 
-	} else {
-		fmt.Println("Error: Unknown videotype provided.")
+// Function to spread the global IFN pool evenly over the grid for this step and return the
+// per-cell IFN reader, which gives every cell the pool's per-cell share
+func (g *Grid) prepareGlobalIFN() func(i, j int) float64 {
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			g.IFNConcentration[i][j] = globalIFN / float64(GRID_SIZE*GRID_SIZE)
+		}
+	}
+	if globalIFN < 0 {
+		globalIFN = -1.0
+	}
+	// Step 3: Update max global IFN if needed
+	if globalIFN > maxGlobalIFN {
+		maxGlobalIFN = globalIFN
+	}
+	return func(i, j int) float64 { return globalIFNperCell }
+}
+
+// Function to sweep the uninfected and DIP-only cells: IFN-exposed cells advance towards
+// ANTIVIRAL, and susceptible or regrowth cells with enough particles draw for infection. Each
+// cell only reads its own state, particles and IFN level and only writes its own entries, so
+// rows are striped across -workers goroutines. Every row draws from its own stream (sweepRowRNG)
+// and each goroutine keeps its own (1-p)^n cache, so the result is the same for any worker
+// count. localIFN is read once for every cell that is neither UNEXPOSED nor quiescent; under the legacy
+// -ifnDecay=perCell those reads decay the field and must come in row-major order, so the rows
+// then run serially.
+func (g *Grid) sweepUninfectedCells(newGrid *[GRID_SIZE][GRID_SIZE]int, frameNum int, localIFN func(i, j int) float64) {
+	perCellDecay := ifnWave && *flag_ifnModel != "diffusion" && *flag_ifnDecay == "perCell"
+	// A cell without IFN (no antiviral step) and without enough particles (no infection draw)
+	// draws and writes nothing, so it can be skipped; under perCell decay its localIFN read
+	// also decays the field, so only once there is no IFN left anywhere
+	skipQuiescent := skipQuiescentCells && (!perCellDecay || g.ifnFieldEmpty())
+	sweepRow := func(i int, pow *powCache) {
+		rng := g.sweepRowRNG(frameNum, i)
+		for j := 0; j < GRID_SIZE; j++ {
+			// Skip UNEXPOSED cells entirely (never change)
+			if g.state[i][j] == UNEXPOSED {
+				continue
+			}
+			if skipQuiescent && g.IFNConcentration[i][j] == 0 && !g.isTraversalActive(i, j) {
+				continue
+			}
+			ifn := localIFN(i, j)
+
+			if isInfectableState(g.state[i][j]) || isInfectedDIPOnly(g.state[i][j]) {
+				// Only states listed in -antiviralEligibleStates enter the antiviral pathway, and never on
+				// IFN non-responder cells; other cells keep their state and get no antiviral timer
+				if g.IFNConcentration[i][j] > 0 && TAU > 0 && antiviralEligible[g.state[i][j]] && !g.ifnNonResponder[i][j] {
+					if g.antiviralDuration[i][j] <= -1 {
+						g.antiviralDuration[i][j] = int(rng.NormFloat64()*float64(TAU)/4 + float64(TAU))
+						g.timeSinceAntiviral[i][j] = 0
+					} else if g.timeSinceAntiviral[i][j] <= int(g.antiviralDuration[i][j]) {
+						g.advanceAntiviralCommitment(i, j, ifn)
+					} else {
+						// Commitment complete; updateAntiviralTime does the bookkeeping from the next frame end
+						g.previousStates[i][j] = g.state[i][j]
+						newGrid[i][j] = ANTIVIRAL
+					}
+				}
+
+				if isInfectableState(g.state[i][j]) {
+					g.infectUninfectedCell(newGrid, rng, pow, i, j, ifn, frameNum)
+				}
+			}
+		}
+	}
+	workers := *flag_workers
+	if perCellDecay {
+		workers = 1
 	}
+	stripeRows(workers, func(first, step int) {
+		var pow powCache
+		pow.reset(*flag_powCacheBound)
+		for i := first; i < GRID_SIZE; i += step {
+			sweepRow(i, &pow)
+		}
+	})
 
-	return img // Return the image
+	// The continuous-mode samples are summed in row-major order, as a serial sweep would
+	if g.continuousMode {
+		for i := 0; i < GRID_SIZE; i++ {
+			for j := 0; j < GRID_SIZE; j++ {
+				if newGrid[i][j] != g.state[i][j] && isInfectedState(newGrid[i][j]) {
+					g.countContinuousSample(i, j)
+				}
+			}
+		}
+	}
 }
 
-func drawTextWithBackground(img *image.RGBA, x, y int, label string, textColor, borderColor, bgColor color.Color) {
-	face := basicfont.Face7x13
-	textWidth := len(label) * 7
-	textHeight := 13
+// Function to return the random stream of row i of the uninfected-cell sweep in frameNum. It
+// depends only on the run seed, the frame and the row, not on the worker count or on the draws
+// of the grid's own stream, so a resumed run draws the same values.
+func (g *Grid) sweepRowRNG(frameNum, i int) *rand.Rand {
+	source := splitMix64(g.rngSource.seed)
+	source = splitMix64(source.Uint64() + uint64(frameNum))
+	source = splitMix64(source.Uint64() + uint64(i))
+	return rand.New(&source)
+}
 
-	// White background box
-	bgRect := image.Rect(x-4, y-4, x+textWidth+4, y+textHeight+4)
-	draw.Draw(img, bgRect, &image.Uniform{bgColor}, image.Point{}, draw.Src)
+// splitMix64 is Steele, Lea and Flood's SplitMix64 generator, a rand.Source64 with an 8-byte state
+// that is cheap to seed (one per row and frame) and whose outputs are well mixed even for
+// consecutive seeds
+type splitMix64 uint64
+
+func (s *splitMix64) Uint64() uint64 {
+	*s += 0x9E3779B97F4A7C15
+	z := uint64(*s)
+	z = (z ^ z>>30) * 0xBF58476D1CE4E5B9
+	z = (z ^ z>>27) * 0x94D049BB133111EB
+	return z ^ z>>31
+}
 
-	// Text starting point
-	point := fixed.Point26_6{
-		X: fixed.I(x),
-		Y: fixed.I(y + textHeight),
+func (s *splitMix64) Int63() int64 { return int64(s.Uint64() >> 1) }
+
+func (s *splitMix64) Seed(seed int64) { *s = splitMix64(seed) }
+
+// Function to draw primary infection of a susceptible or regrowth cell at IFN level ifn from
+// rng, and mark the cell as changed if it was infected. The continuous-mode samples are drawn
+// here and summed by the caller.
+func (g *Grid) infectUninfectedCell(newGrid *[GRID_SIZE][GRID_SIZE]int, rng *rand.Rand, pow *powCache, i, j int, ifn float64, frameNum int) {
+	// Check if the cell is infected by virions or DIPs
+	if g.infectiousVirions(i, j)+g.infectiousDIPs(i, j) >= *flag_minInfectiousParticles {
+		// Per-particle infection chances at the cell's IFN level (a local: rows run concurrently)
+		pV := perParticleChance(PARTICLE_VIRION, ifn)
+		// Virion and DIP infection draws (-infectionModel)
+		draw := g.drawInfection(rng, pow, g.susceptibleChance(pV, i, j), perParticleChance(PARTICLE_DIP, ifn), i, j)
+		infectedByVirion, infectedByDip := draw.byVirion, draw.byDip
+
+		// Determine the infection state based on virion and DIP infection
+		if infectedByVirion && infectedByDip {
+			if g.continuousMode {
+				newGrid[i][j] = INFECTED_BOTH_CONTINUOUS
+			} else {
+				newGrid[i][j] = INFECTED_BOTH
+			}
+			g.timeSinceSusceptible[i][j] = -1
+			g.timeSinceRegrowth[i][j] = -1
+			// Record intracellular virus counts (continuous mode and -burstModel=competition)
+			if g.continuousMode || burstCompetition() {
+				g.intraWT[i][j] += draw.virions
+				g.intraDVG[i][j] += draw.dips
+			}
+			if g.continuousMode {
+				g.sampleContinuousInfection(rng, i, j, frameNum)
+			}
+		} else if infectedByVirion {
+			if g.continuousMode {
+				newGrid[i][j] = INFECTED_VIRION_CONTINUOUS
+			} else {
+				newGrid[i][j] = INFECTED_VIRION
+			}
+			g.timeSinceSusceptible[i][j] = -1
+			g.timeSinceRegrowth[i][j] = -1
+			// Record intracellular virus count (continuous mode and -burstModel=competition)
+			if g.continuousMode || burstCompetition() {
+				g.intraWT[i][j] += draw.virions
+			}
+			if g.continuousMode {
+				g.sampleContinuousInfection(rng, i, j, frameNum)
+			}
+		} else if infectedByDip {
+			if g.continuousMode {
+				newGrid[i][j] = INFECTED_DIP_CONTINUOUS
+			} else {
+				newGrid[i][j] = INFECTED_DIP
+			}
+			// Start the DIP-only clock here: a cell cleared or killed before holds -1, not 0
+			g.timeSinceInfectDIP[i][j] = 0
+			g.timeSinceSusceptible[i][j] = -1
+			g.timeSinceRegrowth[i][j] = -1
+			// Record intracellular DVG count (continuous mode and -burstModel=competition)
+			if g.continuousMode || burstCompetition() {
+				g.intraDVG[i][j] += draw.dips
+			}
+			if g.continuousMode {
+				g.sampleContinuousInfection(rng, i, j, frameNum)
+			}
+		}
 	}
-	d := &font.Drawer{
-		Dst:  img,
-		Src:  image.NewUniform(textColor),
-		Face: face,
-		Dot:  point,
+
+	// Mark the state as changed if the cell is infected
+	if newGrid[i][j] != g.state[i][j] {
+		g.stateChanged[i][j] = true
 	}
-	d.DrawString(label)
 }
 
-// addLabel draws a text label onto an image at the specified position.
-func addLabel(img *image.RGBA, x, y int, label string, col color.Color) {
-	point := fixed.Point26_6{
-		X: fixed.I(x),
-		Y: fixed.I(y),
+// Function to sweep the infected cells: lysis of INFECTED_VIRION/INFECTED_BOTH cells, continuous
+// production, co-infection of single-infected cells at the IFN level localIFN reports, IFN
+// secretion and recovery of DIP-only cells
+func (g *Grid) sweepInfectedCells(newGrid *[GRID_SIZE][GRID_SIZE]int, frameNum int, localIFN func(i, j int) float64) {
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			if !isInfectedState(g.state[i][j]) {
+				continue
+			}
+			debugf("🔍 DEBUG: Processing infected cell at (%d,%d) with state %d at frame %d\n", i, j, g.state[i][j], frameNum)
+
+			// Handle burst mode cells (lysis logic)
+			if g.state[i][j] == INFECTED_VIRION || g.state[i][j] == INFECTED_BOTH {
+				g.advanceLysis(newGrid, i, j, frameNum)
+			}
+			// Handle continuous mode cells and DIP-only cells (production logic)
+			if isProducingState(g.state[i][j]) || isInfectedDIPOnly(g.state[i][j]) {
+				debugf("🚀 DEBUG: Found continuous state cell at (%d,%d) with state %d at frame %d\n", i, j, g.state[i][j], frameNum)
+				// Use continuous production logic
+				g.handleViralProduction(i, j, frameNum, BURST_SIZE_V, 0)
+			}
+
+			// update infected only by DIP or only by virions cells become "infected by both"
+			if g.state[i][j] != INFECTED_VIRION && !isInfectedDIPOnly(g.state[i][j]) {
+				continue
+			}
+			if g.stateChanged[i][j] == false {
+				g.coinfectInfectedCell(newGrid, i, j, localIFN(i, j), frameNum)
+			}
+
+			if g.state[i][j] == INFECTED_VIRION || g.state[i][j] == INFECTED_BOTH {
+				g.secreteIFN(i, j)
+			}
+
+			if isInfectedDIPOnly(g.state[i][j]) {
+				// Set DVG recovery threshold if not already set (never under -dipClearanceModel=fixedNormal)
+				if g.dipLysisThreshold[i][j] == -1 && dvgRecoveryClockActive() {
+					g.dipLysisThreshold[i][j] = int(g.rng.NormFloat64()*STANDARD_DVG_RECOVERY_TIME + MEAN_DVG_RECOVERY_TIME)
+				}
+
+				g.timeSinceInfectDIP[i][j] += TIMESTEP
+
+				// Check if DVG-infected cell should recover (return to susceptible); never in -dipPersistence=persist
+				if !dipOnlyPersists() && g.dipLysisThreshold[i][j] > 0 && g.timeSinceInfectDIP[i][j] >= g.dipLysisThreshold[i][j] {
+					// DVG-infected cell returns to susceptible state (no particle release)
+					newGrid[i][j] = SUSCEPTIBLE
+					g.timeSinceInfectDIP[i][j] = -1
+					g.dipLysisThreshold[i][j] = -1
+					g.timeSinceSusceptible[i][j] = 0
+					g.resetContinuousState(i, j)
+				} else if g.timeSinceInfectDIP[i][j] > IFN_DELAY+int(math.Floor(g.rng.NormFloat64()*float64(STD_IFN_DELAY))) && TAU > 0 {
+					// Continue producing IFN while infected
+					g.secreteDIPOnlyIFN(i, j)
+				}
+			}
+		}
 	}
-	d := &font.Drawer{
-		Dst:  img,
-		Src:  image.NewUniform(col),
-		Face: basicfont.Face7x13, // Basic font for rendering
-		Dot:  point,
+}
+
+// Function to report whether an INFECTED_VIRION/INFECTED_BOTH cell has reached its lysis time.
+// Global IFN runs have always lysed strictly after the threshold, one step later than local IFN.
+func (g *Grid) lysisDue(i, j int) bool {
+	if !ifnWave {
+		return g.timeSinceInfectVorBoth[i][j] > g.lysisThreshold[i][j]
 	}
-	d.DrawString(label)
+	return g.lysisThreshold[i][j] > 0 && g.timeSinceInfectVorBoth[i][j] >= g.lysisThreshold[i][j]
 }
-func addStaticLegend(img *image.RGBA, startX, startY int) {
-	// Keep original colors and label definitions unchanged
-	legendItems := []string{
-		"By both", "By DIP", "By Virion",
-		"Antiviral", "Uninfected", "Plaque", "Regrowth",
+
+// Function to advance the lysis clock of an INFECTED_VIRION/INFECTED_BOTH cell and, once it is
+// due (and out of the eclipse phase), lyse it and release its virions and DIPs
+func (g *Grid) advanceLysis(newGrid *[GRID_SIZE][GRID_SIZE]int, i, j, frameNum int) {
+	if g.lysisThreshold[i][j] == -1 {
+		g.lysisThreshold[i][j] = int(g.rng.NormFloat64()*STANDARD_LYSIS_TIME + MEAN_LYSIS_TIME)
 	}
-	legendColors := map[string]color.Color{
-		"By both":    color.RGBA{255, 200, 0, 255},
-		"By DIP":     color.RGBA{0, 255, 0, 255},
-		"By Virion":  color.RGBA{255, 0, 0, 255},
-		"Antiviral":  color.RGBA{0, 102, 255, 255},
-		"Uninfected": color.RGBA{0, 0, 0, 255},
-		"Plaque":     color.RGBA{84, 110, 122, 255},
-		"Regrowth":   color.RGBA{128, 0, 128, 255},
+	g.timeSinceInfectVorBoth[i][j] += TIMESTEP
+	g.timeSinceInfectDIP[i][j] = -1
+	eclipse := g.inEclipse(i, j)
+
+	// Check if the cell should lyse and release virions and DIPs (not during the eclipse phase)
+	if !g.lysisDue(i, j) || eclipse {
+		return
 	}
 
-	// Calculate background box size (keep original logic)
-	const (
-		fontWidth   = 7
-		lineSpacing = 17
-		padding     = 4
-	)
+	// After lysis, the cell becomes DEAD and virions and DIPs are spread to neighbors
+	switch causeOfDeath(g.state[i][j]) {
+	case "virion":
+		totalDeadFromV++ // Increase INFECTED_VIRION death count
+	case "both":
+		totalDeadFromBoth++ // Increase INFECTED_BOTH death count
+	}
+
+	prevState := g.state[i][j]
+	g.previousStates[i][j] = prevState // Save the previous state before death
+	newGrid[i][j] = DEAD
+	g.state[i][j] = DEAD
+	g.timeSinceDead[i][j] = 0
+	g.timeSinceInfectVorBoth[i][j] = -1
+	g.timeSinceInfectDIP[i][j] = -1
+	g.lysisThreshold[i][j] = -1
+	g.eclipseThreshold[i][j] = -1
+
+	// Burst sizes of this lysis (-burstModel); fixed keeps BURST_SIZE_V and the ratio-adjusted DIP bursts below
+	burstV, competitionD := g.lysisBurst(i, j, prevState, frameNum)
+
+	///////////// for k_jumpR percent cells that jump reandomly
+	if par_celltocell_random == true {
+		// Calculate adjusted burst size for DIPs based on local ratio
+		totalVirionsAtCell := g.localVirions[i][j]
+		totalDIPsAtCell := g.localDips[i][j]
+		adjustedBurstSizeD := BURST_SIZE_D
+		if totalVirionsAtCell > 0 {
+			dipVirionRatio := float64(totalDIPsAtCell) / float64(totalVirionsAtCell)
+			adjustedBurstSizeD += int(float64(BURST_SIZE_D) * dipVirionRatio)
+		}
+		adjustedBurstSizeD = modelBurstD(adjustedBurstSizeD, competitionD)
+		if prevState == INFECTED_VIRION {
+			adjustedBurstSizeD = 0
+		}
+		//  ---------------------------------------
+		// Partition mode: split particles between random jump and cell-to-cell
+		randomVirions, randomDIPs := g.partitionRandomJumps(burstV, adjustedBurstSizeD)
+		virionsForLocalDiffusion := burstV - randomVirions
+		dipsForLocalDiffusion := adjustedBurstSizeD - randomDIPs
+
+		// Handle random jumps
+		g.countRelease(randomVirions, randomDIPs)
+		for v := 0; v < randomVirions; v++ {
+			ni, nj := g.rng.Intn(GRID_SIZE), g.rng.Intn(GRID_SIZE)
+			g.localVirions[ni][nj]++
+			g.totalRandomJumpVirions++
+		}
+		for d := 0; d < randomDIPs; d++ {
+			ni, nj := g.rng.Intn(GRID_SIZE), g.rng.Intn(GRID_SIZE)
+			g.localDips[ni][nj]++
+			g.totalRandomJumpDIPs++
+		}
+
+		// Cell-to-cell share: the partition path's own ring kernel over rings 1-3
+		g.distributeParticles(i, j, virionsForLocalDiffusion, dipsForLocalDiffusion, 3, 3, pathKernel(kernelLegacySqrt3), 1)
+		return
+	}
+
+	if !allowVirionJump && !allowDIPJump {
+		debugf("Virion and DIP jump are both disabled, using viral production logic\n")
+		// Use the new viral production function (burst or continuous based on case 4 mode)
+		g.handleViralProduction(i, j, frameNum, burstV, competitionD)
+		return
+	}
 
-	maxLabelLen := 0
-	for _, label := range legendItems {
-		if len(label) > maxLabelLen {
-			maxLabelLen = len(label)
+	// "Jump" case for either virions, DIPs, or both
+	debugf("Virion and DIP jump are allowed to JUMP\n")
+	// DIP burst adjusted by the cell's current DIP:virion ratio; each jump block reads it afresh,
+	// after any virion jumps that landed back on the cell
+	jumpBurstD := func() int {
+		totalVirionsAtCell := g.localVirions[i][j]
+		totalDIPsAtCell := g.localDips[i][j]
+		adjustedBurstSizeD := 0
+		if totalVirionsAtCell > 0 {
+			dipVirionRatio := float64(totalDIPsAtCell) / float64(totalVirionsAtCell)
+			adjustedBurstSizeD = BURST_SIZE_D + int(math.Floor(float64(BURST_SIZE_D)*dipVirionRatio))
 		}
+		return modelBurstD(adjustedBurstSizeD, competitionD)
 	}
 
-	bgWidth := maxLabelLen*fontWidth + 10
-	bgHeight := len(legendItems)*lineSpacing + 6
+	if allowVirionJump {
+		adjustedBurstSizeD := jumpBurstD()
+		g.countRelease(burstV, adjustedBurstSizeD)
+		if jumpRandomly {
+			for v := 0; v < burstV; v++ {
+				ni := g.rng.Intn(GRID_SIZE) // Randomly select a row
+				nj := g.rng.Intn(GRID_SIZE) // Randomly select a column
 
-	// Draw background (keep white opaque)
-	bgRect := image.Rect(
-		startX-padding,
-		startY-padding,
-		startX+bgWidth,
-		startY+bgHeight,
-	)
-	draw.Draw(img, bgRect, &image.Uniform{color.RGBA{255, 255, 255, 255}}, image.Point{}, draw.Src)
+				// Apply the virion jump
+				g.localVirions[ni][nj]++
+				g.totalRandomJumpVirions++
+			}
 
-	// Draw legend items (keep original drawing logic)
-	for i, label := range legendItems {
-		yPos := startY + i*lineSpacing
-		drawTextWithBackground(
-			img,
-			startX,
-			yPos,
-			label,
-			legendColors[label],
-			legendColors[label],
-			color.RGBA{255, 255, 255, 255},
-		)
-	}
-}
+			// DIP jump randomly to any location
+			for d := 0; d < adjustedBurstSizeD; d++ {
+				ni := g.rng.Intn(GRID_SIZE) // Randomly select a row
+				nj := g.rng.Intn(GRID_SIZE) // Randomly select a column
+
+				// Apply the DIP jump
+				g.localDips[ni][nj]++
+				g.totalRandomJumpDIPs++
+			}
+		} else {
+			// Virion jump logic
+			virionTargets := make([]int, burstV)
+			for v := 0; v < burstV; v++ {
+				virionTargets[v] = g.rng.Intn(len(g.neighborsBurstArea[i][j]))
+			}
 
-func (g *Grid) gridToImageWithGraph(frameNum int, virionOnly, dipOnly, both []float64, mode string, showLegend bool) *image.RGBA {
-	const graphHeight = 100
-	const spacing = 0
+			// Apply virion jumps
+			for _, targetIndex := range virionTargets {
+				spot := g.neighborsBurstArea[i][j][targetIndex]
+				ni, nj := spot[0], spot[1]
 
-	gridImg := g.gridToImage(videotype)
-	gridHeight := gridImg.Bounds().Dy()
+				// Ensure the jump target is valid
+				if ni < 0 || ni >= GRID_SIZE || nj < 0 || nj >= GRID_SIZE {
+					continue
+				}
 
-	imgWidth := GRID_SIZE * CELL_SIZE * 2
-	imgHeight := graphHeight + gridHeight + spacing
-	canvas := image.NewRGBA(image.Rect(0, 0, imgWidth, imgHeight))
+				// Apply the virion jump
+				g.localVirions[ni][nj]++
+			}
 
-	graphImg := createInfectionGraph(frameNum, virionOnly, dipOnly, both, showLegend)
-	draw.Draw(canvas, image.Rect(0, 0, imgWidth, graphHeight), graphImg, image.Point{}, draw.Src)
-	draw.Draw(canvas, image.Rect(0, graphHeight+spacing, imgWidth, graphHeight+gridHeight+spacing), gridImg, image.Point{}, draw.Src)
+			// DIP jump logic
+			dipTargets := make([]int, adjustedBurstSizeD)
+			for d := 0; d < adjustedBurstSizeD; d++ {
+				dipTargets[d] = g.rng.Intn(len(g.neighborsBurstArea[i][j]))
+			}
 
-	if showLegend {
-		addStaticLegend(canvas, canvas.Bounds().Dx()-183, canvas.Bounds().Dy()-183)
-	}
+			// Apply DIP jumps
+			for _, targetIndex := range dipTargets {
+				spot := g.neighborsBurstArea[i][j][targetIndex]
+				ni, nj := spot[0], spot[1]
 
-	return canvas
-}
+				// Ensure the jump target is valid
+				if ni < 0 || ni >= GRID_SIZE || nj < 0 || nj >= GRID_SIZE {
+					continue
+				}
 
-// Calculate the center of each hexagonal cell
-func calculateHexCenter(i, j int) (int, int) {
-	x := i * CELL_SIZE * 3 / 2                                                          // Calculate the x-coordinate
-	y := int(float64(j)*CELL_SIZE*math.Sqrt(3) + float64(i%2)*CELL_SIZE*math.Sqrt(3)/2) // Calculate the y-coordinate
-	return x, y                                                                         // Return the center coordinates
-}
+				// Apply the DIP jump
+				g.localDips[ni][nj]++
+			}
+		}
+	}
 
-func drawHexagon(img *image.RGBA, x, y int, c color.Color) {
-	var hex [6]image.Point
-	for i := 0; i < 6; i++ {
-		angle := math.Pi / 3 * float64(i) // Calculate the angle for each vertex of the hexagon
-		hex[i] = image.Point{
-			X: x + int(float64(CELL_SIZE)*math.Cos(angle)), // Calculate x-coordinate
-			Y: y + int(float64(CELL_SIZE)*math.Sin(angle)), // Calculate y-coordinate
+	if allowDIPJump {
+		adjustedBurstSizeD := jumpBurstD()
+		g.countRelease(0, adjustedBurstSizeD)
+		// Apply the jumps synchronously so localDips is never written while the
+		// rest of the sweep reads it
+		if jumpRandomly {
+			for d := 0; d < adjustedBurstSizeD; d++ {
+				ni, nj := g.rng.Intn(GRID_SIZE), g.rng.Intn(GRID_SIZE)
+				g.localDips[ni][nj]++
+				g.totalRandomJumpDIPs++
+			}
+		} else {
+			dipTargets := make([]int, adjustedBurstSizeD)
+			for d := 0; d < adjustedBurstSizeD; d++ {
+				dipTargets[d] = g.rng.Intn(len(g.neighborsBurstArea[i][j]))
+			}
+			for _, targetIndex := range dipTargets {
+				spot := g.neighborsBurstArea[i][j][targetIndex]
+				ni, nj := spot[0], spot[1]
+				if ni >= 0 && ni < GRID_SIZE && nj >= 0 && nj < GRID_SIZE {
+					g.localDips[ni][nj]++
+				}
+			}
 		}
 	}
-	fillHexagon(img, hex, c) // Fill the hexagon with the specified color
 }
 
-func fillHexagon(img *image.RGBA, hex [6]image.Point, c color.Color) {
-	minX, minY, maxX, maxY := hex[0].X, hex[0].Y, hex[0].X, hex[0].Y // Initialize boundary values
-	for _, p := range hex {
-		if p.X < minX {
-			minX = p.X // Update minimum x-coordinate
-		}
-		if p.Y < minY {
-			minY = p.Y // Update minimum y-coordinate
+// Function to draw co-infection of an INFECTED_VIRION cell by DIPs, or of a DIP-only cell by
+// virions, at IFN level ifn (subject to superinfection exclusion)
+func (g *Grid) coinfectInfectedCell(newGrid *[GRID_SIZE][GRID_SIZE]int, i, j int, ifn float64, frameNum int) {
+	// Check if the cell is infected by virions or DIPs
+	if g.infectiousVirions(i, j)+g.infectiousDIPs(i, j) < *flag_minInfectiousParticles {
+		return
+	}
+	// Per-particle infection chances at the cell's IFN level
+	perParticleInfectionChance_V = perParticleChance(PARTICLE_VIRION, ifn)
+	// Virion and DIP infection draws (-infectionModel)
+	draw := g.drawInfection(g.rng, &g.powCache, g.susceptibleChance(perParticleInfectionChance_V, i, j), perParticleChance(PARTICLE_DIP, ifn), i, j)
+	infectedByVirion, infectedByDip := draw.byVirion, draw.byDip
+	probabilityVInfection, probabilityDInfection := draw.probV, draw.probD
+
+	// Handle co-infection of already infected cells
+	if g.state[i][j] == INFECTED_VIRION {
+		if infectedByDip && g.inSuperinfectionExclusion(i, j, frameNum) {
+			g.suppressedCoinfections++
+		} else if infectedByDip {
+			debugf("COINFECT: frame %d cell (%d,%d) VIRION->BOTH by DIP; localVirions=%d localDIPs=%d pV=%.6f pD=%.6f\n",
+				frameNum, i, j, g.localVirions[i][j], g.localDips[i][j], probabilityVInfection, probabilityDInfection)
+			newGrid[i][j] = INFECTED_BOTH // Virion + DIP = Both
+			if burstCompetition() {
+				g.intraDVG[i][j] += draw.dips
+			}
+			g.applyCoinfectionLysisDelay(i, j)
 		}
-		if p.X > maxX {
-			maxX = p.X // Update maximum x-coordinate
+		// Otherwise keep INFECTED_VIRION state
+	} else if isInfectedDIPOnly(g.state[i][j]) {
+		if infectedByVirion && g.inSuperinfectionExclusion(i, j, frameNum) {
+			g.suppressedCoinfections++
+		} else if infectedByVirion {
+			debugf("COINFECT: frame %d cell (%d,%d) DIP->BOTH by VIRION; localVirions=%d localDIPs=%d pV=%.6f pD=%.6f\n",
+				frameNum, i, j, g.localVirions[i][j], g.localDips[i][j], probabilityVInfection, probabilityDInfection)
+			newGrid[i][j] = INFECTED_BOTH // DIP + Virion = Both
+			if burstCompetition() {
+				g.intraWT[i][j] += draw.virions
+			}
 		}
-		if p.Y > maxY {
-			maxY = p.Y // Update maximum y-coordinate
+		// Otherwise keep INFECTED_DIP state
+	}
+}
+
+// Function to let an INFECTED_VIRION or INFECTED_BOTH cell secrete IFN for one step. Local IFN
+// spreads the amount evenly over the cell's IFN area once the cell is past its IFN delay; global
+// IFN keeps its own rule, adding to the cell's share of the pool without a delay.
+func (g *Grid) secreteIFN(i, j int) {
+	if !ifnWave {
+		if (g.state[i][j] == INFECTED_VIRION || g.state[i][j] == INFECTED_BOTH && TAU > 0) && !g.inEclipse(i, j) {
+			ifnBefore := g.IFNConcentration[i][j]
+
+			if VStimulateIFN == true {
+				if g.state[i][j] == INFECTED_VIRION {
+					g.IFNConcentration[i][j] += float64(R) * float64(TIMESTEP) * ifnBothFold
+				} else if g.state[i][j] == INFECTED_BOTH {
+					adjusted_DIP_IFN_stimulate = BOTH_IFN_stimulate_ratio
+					g.IFNConcentration[i][j] += (float64(R) + adjusted_DIP_IFN_stimulate) * float64(TIMESTEP)
+				}
+			} else if VStimulateIFN == false {
+				if g.state[i][j] == INFECTED_BOTH {
+					adjusted_DIP_IFN_stimulate = BOTH_IFN_stimulate_ratio
+				}
+				g.IFNConcentration[i][j] += (float64(R) + adjusted_DIP_IFN_stimulate) * float64(TIMESTEP)
+			}
+
+			g.globalIFNBySource[ifnSourceOf(g.state[i][j])] += g.IFNConcentration[i][j] - ifnBefore
+			globalIFN += g.IFNConcentration[i][j]
 		}
+		return
 	}
-	for x := minX; x <= maxX; x++ { // Iterate through x-coordinates
-		for y := minY; y <= maxY; y++ { // Iterate through y-coordinates
-			if isPointInHexagon(image.Point{x, y}, hex) { // Check if the point is inside the hexagon
-				img.Set(x, y, c) // Set the color of the point
+
+	if g.timeSinceInfectVorBoth[i][j] > IFN_DELAY+int(math.Floor(g.rng.NormFloat64()*float64(STD_IFN_DELAY))) && TAU > 0 && !g.inEclipse(i, j) {
+		var totalIncreaseAmount float64
+		if VStimulateIFN == true {
+			if g.state[i][j] == INFECTED_VIRION {
+				totalIncreaseAmount = float64(R) * float64(TIMESTEP) * ifnBothFold
+			} else if g.state[i][j] == INFECTED_BOTH {
+				totalIncreaseAmount = (float64(R) + BOTH_IFN_stimulate_ratio) * float64(TIMESTEP)
+			}
+		} else if VStimulateIFN == false {
+			if g.state[i][j] == INFECTED_BOTH {
+				totalIncreaseAmount = BOTH_IFN_stimulate_ratio * float64(TIMESTEP)
 			}
+			debugf("totalIncreaseAmount %v\n", totalIncreaseAmount)
 		}
+		g.spreadIFN(i, j, totalIncreaseAmount)
+	}
+}
+
+// Function to let a DIP-only infected cell past its IFN delay secrete IFN for one step: spread
+// over its IFN area for local IFN, added to its share of the pool (with R) for global IFN
+func (g *Grid) secreteDIPOnlyIFN(i, j int) {
+	if !ifnWave {
+		amount := (float64(R) + D_only_IFN_stimulate_ratio) * float64(TIMESTEP)
+		g.IFNConcentration[i][j] += amount
+		g.globalIFNBySource[IFN_SOURCE_DIP] += amount
+		globalIFN += g.IFNConcentration[i][j]
+		return
 	}
+	g.spreadIFN(i, j, D_only_IFN_stimulate_ratio*float64(TIMESTEP))
 }
 
-func isPointInHexagon(p image.Point, hex [6]image.Point) bool {
-	for i := 0; i < 6; i++ {
-		j := (i + 1) % 6
-		if (hex[j].X-hex[i].X)*(p.Y-hex[i].Y)-(hex[j].Y-hex[i].Y)*(p.X-hex[i].X) < 0 {
-			return false // Return false if the point is outside the hexagon
+// Function to spread amount of IFN secreted by (i,j) evenly over its IFN area; under
+// -ifnModel=diffusion it all stays on (i,j) and diffuseIFN carries it outward
+func (g *Grid) spreadIFN(i, j int, amount float64) {
+	if *flag_ifnModel == "diffusion" {
+		g.IFNConcentration[i][j] += amount
+		g.ifnExposure[i][j][ifnSourceOf(g.state[i][j])] += amount
+		globalIFN += amount
+		g.ifnRowSums.valid = false
+		return
+	}
+	cellCount := len(g.neighborsIFNArea[i][j])
+	if cellCount == 0 {
+		return
+	}
+	averageIncreaseAmount := amount / float64(cellCount)
+	source := ifnSourceOf(g.state[i][j])
+	for _, offset := range g.neighborsIFNArea[i][j] {
+		ni, nj := offset[0], offset[1]
+		if ni >= 0 && ni < GRID_SIZE && nj >= 0 && nj < GRID_SIZE {
+			g.IFNConcentration[ni][nj] += averageIncreaseAmount
+			g.ifnExposure[ni][nj][source] += averageIncreaseAmount
+			globalIFN += averageIncreaseAmount
 		}
 	}
-	return true // Return true if the point is inside the hexagon
 }
 
-func main() {
-	flag.Parse()
-	fmt.Printf("Parsed ifnSpreadOption: %q\n", *flag_ifnSpreadOption)
-	fmt.Printf("Parsed particleSpreadOption: %q\n", *flag_particleSpreadOption)
+// Function to let DEAD cells regrow. Under -regrowthModel=timer a DEAD cell next to a susceptible
+// or antiviral cell regrows once its normally distributed delay, drawn once per death, has passed;
+// under edgePressure every dividing neighbor (SUSCEPTIBLE, ANTIVIRAL or REGROWTH) gives it a
+// -regrowthEdgeRate chance per hour, so plaques fill in from the rim.
+func (g *Grid) regrowDeadCells(newGrid *[GRID_SIZE][GRID_SIZE]int) {
+	edgePressure := *flag_regrowthModel == "edgePressure"
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			if g.state[i][j] != DEAD {
+				continue
+			}
+			g.timeSinceDead[i][j] += TIMESTEP
 
-	// Assign parsed flag values to global variables (note dereferencing)
-	BURST_SIZE_V = *flag_burstSizeV
-	BURST_SIZE_D = *flag_burstSizeD
-	MEAN_LYSIS_TIME = *flag_meanLysisTime
-	STANDARD_LYSIS_TIME = MEAN_LYSIS_TIME / 4
-	MEAN_DVG_RECOVERY_TIME = *flag_dvgRecoveryTime
-	STANDARD_DVG_RECOVERY_TIME = MEAN_DVG_RECOVERY_TIME / 3 // 3±1 hours, so std = 1
-	k_JumpR = *flag_kJumpR
-	TAU = *flag_tau
-	ifnBothFold = *flag_ifnBothFold
-	RHO = *flag_rho
-	lambdaDip = *flag_lambdaDip
-	option = *flag_option
+			regrow := false
+			if edgePressure {
+				dividing := 0
+				for _, neighbor := range g.neighbors1[i][j] {
+					ni, nj := neighbor[0], neighbor[1]
+					if ni >= 0 && ni < GRID_SIZE && nj >= 0 && nj < GRID_SIZE {
+						if isAliveUninfected(g.state[ni][nj]) {
+							dividing++
+						}
+					}
+				}
+				regrow = dividing > 0 && g.rng.Float64() < 1-math.Pow(1-*flag_regrowthEdgeRate, float64(dividing))
+			} else {
+				// Check if any neighboring cells are susceptible, allowing for regrowth
+				canRegrow := false
+				for _, neighbor := range g.neighbors1[i][j] {
+					ni, nj := neighbor[0], neighbor[1]
 
-	// Special parameter overrides for case 4
-	if option == 4 {
+					// Ensure the neighbor indices are valid (within grid bounds)
+					if ni >= 0 && ni < GRID_SIZE && nj >= 0 && nj < GRID_SIZE {
+						if g.state[ni][nj] == SUSCEPTIBLE || g.state[ni][nj] == ANTIVIRAL {
+							canRegrow = true
+							break
+						}
+					}
+				}
+				if canRegrow && g.regrowthThreshold[i][j] == -1 {
+					g.regrowthThreshold[i][j] = int(g.rng.NormFloat64()*REGROWTH_STD + REGROWTH_MEAN)
+				}
+				regrow = canRegrow && g.timeSinceDead[i][j] >= g.regrowthThreshold[i][j]
+			}
 
-		STANDARD_LYSIS_TIME = MEAN_LYSIS_TIME / 4 // Recalculate standard deviation
+			// If the conditions are met, the cell regrows
+			if regrow {
+				newGrid[i][j] = REGROWTH
+				g.timeSinceRegrowth[i][j] = 0
+				g.timeSinceDead[i][j] = -1
+				g.regrowthThreshold[i][j] = -1
+				g.resetContinuousState(i, j)
+				if *flag_rhoOnRegrowth == "resample" && susceptibilitySigma > 0 {
+					g.cellSusceptibility[i][j] = g.sampleSusceptibility() * g.susceptibilityScale
+				}
+			}
+		}
 	}
+}
 
-	virion_half_life = *flag_virion_half_life
-	dip_half_life = *flag_dip_half_life
-	ifn_half_life = *flag_ifn_half_life
+// Function to apply one TIMESTEP of particle half-life decay and, on INFECTED_*/DEAD cells,
+// adsorption (-adsorptionVirion/-adsorptionDIP); adsorbedVirions/adsorbedDIPs count this frame's removals
+func (g *Grid) decayAndAdsorbParticles() {
+	g.adsorbedVirions, g.adsorbedDIPs = 0, 0
+	adsorption := *flag_adsorptionVirion > 0 || *flag_adsorptionDIP > 0
+	if virion_half_life != 0 || adsorption {
+		for i := 0; i < GRID_SIZE; i++ {
+			for j := 0; j < GRID_SIZE; j++ {
+				if virion_half_life != 0 {
+					// Update virus count using half-life formula
+					factorV := math.Pow(0.5, float64(TIMESTEP)/virion_half_life)
+					g.localVirions[i][j] = int(math.Floor(float64(g.localVirions[i][j])*factorV + 0.5))
+
+					// Use per-cell DIP half-life
+					hl := g.dipHalfLife[i][j]
+					if hl > 0 {
+						factorD := math.Pow(0.5, float64(TIMESTEP)/hl)
+						g.localDips[i][j] = int(math.Floor(float64(g.localDips[i][j])*factorD + 0.5))
+					}
+				}
 
-	particleSpreadOption = *flag_particleSpreadOption
-	ifnSpreadOption = *flag_ifnSpreadOption
-	dipOption = *flag_dipOption
-	// Recalculate dependent parameters (note that ifnBothFold is now float64, not *float64)
-	D_only_IFN_stimulate_ratio = 5.0 * ifnBothFold
-	BOTH_IFN_stimulate_ratio = 10.0 * ifnBothFold
-	videotype = *flag_videotype
+				// Infected and dead cells bind part of the particles sitting on them
+				if adsorption && (isInfectedState(g.state[i][j]) || g.state[i][j] == DEAD) {
+					g.adsorbParticles(i, j)
+				}
+			}
+		}
+	}
+}
 
-	// Exposure mask: enforce baltes-only activation
-	if videotype != "baltes" {
-		*flag_unexposedAreaFraction = 0.0
+// Function to remove adsorbed particles at (i,j) by binomial thinning with the per-timestep adsorption probabilities
+func (g *Grid) adsorbParticles(i, j int) {
+	if *flag_adsorptionVirion > 0 && g.localVirions[i][j] > 0 {
+		removed := binomialDraw(g.rng, g.localVirions[i][j], perStepProbability(*flag_adsorptionVirion))
+		g.localVirions[i][j] -= removed
+		g.adsorbedVirions += removed
 	}
-	fmt.Printf("Exposure mask (uniform) fraction = %.3f (baltes-only)\n", *flag_unexposedAreaFraction)
+	if *flag_adsorptionDIP > 0 && g.localDips[i][j] > 0 {
+		removed := binomialDraw(g.rng, g.localDips[i][j], perStepProbability(*flag_adsorptionDIP))
+		g.localDips[i][j] -= removed
+		g.adsorbedDIPs += removed
+	}
+}
 
-	// Parse viral particle removal experiment parameters
-	enableParticleRemoval = *flag_enableParticleRemoval
-	ifnThreshold = *flag_ifnThreshold
-	removalTimepoint = *flag_removalTimepoint
-	removeVirionAndDIP = *flag_removeVirionAndDIP
+// Function to turn a per-hour probability into the probability over one TIMESTEP
+func perStepProbability(perHour float64) float64 {
+	return 1 - math.Pow(1-perHour, float64(TIMESTEP))
+}
 
-	// VIRION-only burst mode
-	virionBurstMode = *flag_virionBurstMode
-	if virionBurstMode != "both" && virionBurstMode != "virionOnly" {
-		log.Fatalf("Unknown virionBurstMode: %s (expected 'both' or 'virionOnly')", virionBurstMode)
+// Function to draw from Binomial(n, p) exactly, drawing the smaller of the two tails (p <= 0.5):
+// inversion (a sequential search up from 0) while n*p < 10, Hörmann's transformed rejection
+// (BTRS, the binomial form of the PTRS Poisson sampler in Grid.poisson) above that. Either way it
+// takes O(1 + n*p) uniforms at most, however large n is.
+func binomialDraw(rng *rand.Rand, n int, p float64) int {
+	if p <= 0 || n <= 0 {
+		return 0
+	}
+	if p >= 1 {
+		return n
+	}
+	if p > 0.5 {
+		return n - binomialDraw(rng, n, 1-p)
+	}
+	q := 1 - p
+	mean := float64(n) * p
+	if mean < 10 {
+		// P(0) = q^n, then P(k+1) = P(k) * (n-k)/(k+1) * p/q
+		prob := math.Exp(float64(n) * math.Log1p(-p))
+		u := rng.Float64()
+		k := 0
+		for u > prob && k < n {
+			u -= prob
+			prob *= float64(n-k) / float64(k+1) * p / q
+			k++
+		}
+		return k
+	}
+	spq := math.Sqrt(mean * q)
+	b := 1.15 + 2.53*spq
+	a := -0.0873 + 0.0248*b + 0.01*p
+	c := mean + 0.5
+	vr := 0.92 - 4.2/b
+	alpha := (2.83 + 5.1/b) * spq
+	lpq := math.Log(p / q)
+	m := math.Floor(float64(n+1) * p)
+	lgM, _ := math.Lgamma(m + 1)
+	lgNM, _ := math.Lgamma(float64(n) - m + 1)
+	for {
+		u := rng.Float64() - 0.5
+		v := rng.Float64()
+		us := 0.5 - math.Abs(u)
+		k := math.Floor((2*a/us+b)*u + c)
+		if k < 0 || k > float64(n) {
+			continue
+		}
+		if us >= 0.07 && v <= vr {
+			return int(k)
+		}
+		lgK, _ := math.Lgamma(k + 1)
+		lgNK, _ := math.Lgamma(float64(n) - k + 1)
+		if math.Log(v*alpha/(a/(us*us)+b)) <= lgM+lgNM-lgK-lgNK+(k-m)*lpq {
+			return int(k)
+		}
 	}
+}
 
-	// Parse random seed parameter
-	randomSeed = *flag_randomSeed
+// Function to count new infections and lysis events by comparing with the state at the start of the frame
+func (g *Grid) countFrameEvents(stateAtStart [GRID_SIZE][GRID_SIZE]int) {
+	newInfections := 0
+	lysisEvents := 0
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			before, after := stateAtStart[i][j], g.state[i][j]
+			wasInfected := isInfectedState(before) || before == DEAD
+			// A cell that went straight to DEAD within the frame was also newly infected
+			if !wasInfected && (isInfectedState(after) || after == DEAD) {
+				newInfections++
+			}
+			if before != DEAD && after == DEAD {
+				lysisEvents++
+			}
+		}
+	}
+	g.newInfectionsPerFrame = append(g.newInfectionsPerFrame, newInfections)
+	g.lysisEventsPerFrame = append(g.lysisEventsPerFrame, lysisEvents)
+}
 
-	fmt.Printf("flag_videotype = %q\n", *flag_videotype)
-	// Optional: print debug information
-	fmt.Printf("Parameters:\n  burstSizeV = %d\n  burstSizeD = %d\n  MEAN_LYSIS_TIME = %.2f\n  kJumpR = %.2f\n  TAU = %d\n  ifnBothFold = %.2f\n  RHO = %.3f\n par_celltocell_random = %v\n",
-		BURST_SIZE_V, BURST_SIZE_D, MEAN_LYSIS_TIME, k_JumpR, TAU, ifnBothFold, RHO, par_celltocell_random)
+// Function to estimate R_eff(t) as new infections this frame divided by the
+// lysis events one mean lysis time earlier. Returns false if undefined.
+func (g *Grid) crudeReff(frameNum int) (float64, bool) {
+	lag := int(math.Round(MEAN_LYSIS_TIME / float64(TIMESTEP)))
+	src := frameNum - lag
+	if src < 0 || frameNum >= len(g.newInfectionsPerFrame) || src >= len(g.lysisEventsPerFrame) {
+		return 0, false
+	}
+	if g.lysisEventsPerFrame[src] == 0 {
+		return 0, false
+	}
+	return float64(g.newInfectionsPerFrame[frameNum]) / float64(g.lysisEventsPerFrame[src]), true
+}
 
-	// Print viral particle removal experiment parameters
-	if enableParticleRemoval {
-		fmt.Printf("Viral Particle Removal Experiment Enabled:\n  ifnThreshold = %.3f\n  removalTimepoint = %d hours\n  removeVirionAndDIP = %v\n", ifnThreshold, removalTimepoint, removeVirionAndDIP)
+// Function to record the frame each cell's current infection was first seen; cleared when the
+// cell stops being infected, so a reinfection starts a new exclusion window
+func (g *Grid) updateInfectionStart(frameNum int) {
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			switch {
+			case !isInfectedState(g.state[i][j]):
+				g.infectionStartFrame[i][j] = -1
+			case g.infectionStartFrame[i][j] == -1:
+				g.infectionStartFrame[i][j] = frameNum
+			}
+		}
 	}
+}
 
-	// --- Particle Diffusion Options ---
-	particleSpreadOption = *flag_particleSpreadOption
-	if particleSpreadOption == "celltocell" {
-		jumpRadiusV = 0
-		jumpRadiusD = 0
-		jumpRandomly = false
-		// k_JumpR = 0.0
-		allowVirionJump = false
-		allowDIPJump = false
+// One infection of lineage.csv: the cell, the frame it was first seen infected, its generation,
+// the attributed parent cell (-1,-1 for a root) and the infected state (the state it lysed from
+// if it was seen DEAD)
+type lineageEvent struct {
+	Frame, I, J, Generation int
+	ParentI, ParentJ        int
+	State                   int
+}
+
+// Function to report whether infection lineage is tracked (-lineage or -videotype=generations)
+func lineageTracked() bool {
+	return *flag_lineage || videotype == "generations"
+}
+
+// Function to attribute every infection that starts this frame (an infected cell without a
+// running infection, or a cell seen DEAD before it was ever seen infected) to a parent, then
+// note this frame's releases. Infections are drawn before this frame's releases, so the parent
+// is the cell with the most recent earlier release (the previous frame's bursts and continuous
+// production whenever there were any), nearest by hex distance among those, first in row-major
+// order on ties. With no earlier release at all the infection is a root (generation 0, e.g. the
+// seeded cell); otherwise its generation is one more than the parent's latest infection, and
+// that infection's cohort gains an offspring.
+func (g *Grid) updateLineage(frameNum int) {
+	for len(g.cohortSize) <= frameNum {
+		g.cohortSize = append(g.cohortSize, 0)
+		g.cohortOffspring = append(g.cohortOffspring, 0)
+	}
+	var infected [][2]int
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			newInfection := isInfectedState(g.state[i][j]) && g.infectionStartFrame[i][j] == -1
+			lysedUnseen := g.state[i][j] == DEAD && g.firstInfectionTime[i][j] == -1
+			if !newInfection && !lysedUnseen {
+				continue
+			}
+			event := lineageEvent{Frame: frameNum, I: i, J: j, ParentI: -1, ParentJ: -1, State: g.state[i][j]}
+			if lysedUnseen {
+				event.State = g.previousStates[i][j]
+			}
+			parent := g.lineageParent(i, j)
+			g.generation[i][j] = 0
+			g.parentID[i][j] = parent
+			if parent >= 0 {
+				event.ParentI, event.ParentJ = parent/GRID_SIZE, parent%GRID_SIZE
+				g.generation[i][j] = g.generation[event.ParentI][event.ParentJ] + 1
+				g.cohortOffspring[g.lineageFrame[event.ParentI][event.ParentJ]]++
+			}
+			event.Generation = g.generation[i][j]
+			infected = append(infected, [2]int{i, j})
+			if *flag_lineage {
+				g.lineageEvents = append(g.lineageEvents, event)
+			}
+		}
+	}
+	// Set after the loop, so a parent reinfected this frame still credits its earlier cohort
+	for _, cell := range infected {
+		g.lineageFrame[cell[0]][cell[1]] = frameNum
+	}
+	g.cohortSize[frameNum] += len(infected)
+
+	var releasers [][2]int
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			if g.releasedNow[i][j] {
+				g.lastReleaseFrame[i][j] = frameNum
+				g.releasedNow[i][j] = false
+				releasers = append(releasers, [2]int{i, j})
+			}
+		}
+	}
+	if len(releasers) > 0 {
+		g.latestReleasers, g.latestReleaseRadius = releasers, g.releaseRadiusNow
+	}
+	g.releaseRadiusNow = 0
+}
+
+// Function to return the parent cell (i*GRID_SIZE+j) of an infection at (i,j), the nearest of the
+// latest frame's releasing cells and first in row-major order on ties, or -1 with none. Those
+// releases reached at most latestReleaseRadius, so when that disc is smaller than the list the
+// releasing cells in it are looked at first; any found is nearer than every cell outside it.
+func (g *Grid) lineageParent(i, j int) int {
+	best, bestDistance := -1, 0
+	consider := func(pi, pj int) {
+		if pi == i && pj == j {
+			return
+		}
+		distance, id := getHexDistanceBetweenPoints(i, j, pi, pj), pi*GRID_SIZE+pj
+		if best == -1 || distance < bestDistance || (distance == bestDistance && id < best) {
+			best, bestDistance = id, distance
+		}
+	}
+	if len(g.latestReleasers) == 0 {
+		return -1
+	}
+	if r := g.latestReleaseRadius; r >= 0 && 1+3*r*(r+1) < len(g.latestReleasers) {
+		latest := g.lastReleaseFrame[g.latestReleasers[0][0]][g.latestReleasers[0][1]]
+		for ring := 1; ring <= r; ring++ {
+			for _, offset := range hexRingOffsets(ring) {
+				if pi, pj, ok := wrapCell(i+offset[0], j+offset[1]); ok && g.lastReleaseFrame[pi][pj] == latest {
+					consider(pi, pj)
+				}
+			}
+		}
+		if best >= 0 {
+			return best
+		}
+	}
+	for _, cell := range g.latestReleasers {
+		consider(cell[0], cell[1])
+	}
+	return best
+}
+
+// Function to rebuild the latest frame's releasing cells from lastReleaseFrame after a resume.
+// The release radius of that frame is not stored, so lineageParent scans the whole list.
+func (g *Grid) restoreLatestReleasers() {
+	latest := -1
+	g.latestReleasers = nil
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			switch frame := g.lastReleaseFrame[i][j]; {
+			case frame > latest:
+				latest = frame
+				g.latestReleasers = append(g.latestReleasers[:0], [2]int{i, j})
+			case frame == latest && frame >= 0:
+				g.latestReleasers = append(g.latestReleasers, [2]int{i, j})
+			}
+		}
+	}
+	g.latestReleaseRadius, g.releaseRadiusNow = -1, 0
+}
+
+// Function to return the cohort R_eff of the infections first seen at frameNum: the infections
+// attributed to them divided by their number, and whether the cohort is complete. A cohort is
+// complete once none of its cells is still infected or released particles in the last frame, so
+// none can be credited with more infections after the run ends. Returns NaN for an empty cohort.
+func (g *Grid) cohortReff(frameNum, lastFrame int) (float64, bool) {
+	if frameNum >= len(g.cohortSize) || g.cohortSize[frameNum] == 0 {
+		return math.NaN(), false
+	}
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			if g.lineageFrame[i][j] == frameNum && (isInfectedState(g.state[i][j]) || g.lastReleaseFrame[i][j] == lastFrame) {
+				return float64(g.cohortOffspring[frameNum]) / float64(g.cohortSize[frameNum]), false
+			}
+		}
+	}
+	return float64(g.cohortOffspring[frameNum]) / float64(g.cohortSize[frameNum]), true
+}
+
+// Function to write reff_cohort.csv (-lineage) after the last frame: per infection time the
+// cohort size, its attributed infections, R_eff_cohort ("NA" for an empty cohort), whether the
+// cohort is complete, and R_eff_crude for comparison. Also sets the cohort turnover time in
+// the summary: the first complete cohort after the burn-in with R_eff below 1, following one
+// at 1 or above.
+func (g *Grid) saveCohortReffCSV(outputFolder string, lastFrame int, summary *SimulationSummary) {
+	aboveOne := false
+	rows := [][]string{{"infectionTime", "cohortSize", "secondaryInfections", "R_eff_cohort", "complete", "R_eff_crude"}}
+	for frameNum := 0; frameNum < len(g.cohortSize); frameNum++ {
+		reff, complete := g.cohortReff(frameNum, lastFrame)
+		reffCohort, reffCrude := "NA", "NA"
+		if !math.IsNaN(reff) {
+			reffCohort = strconv.FormatFloat(reff, 'f', 6, 64)
+		}
+		if crude, ok := g.crudeReff(frameNum); ok {
+			reffCrude = strconv.FormatFloat(crude, 'f', 6, 64)
+		}
+		rows = append(rows, []string{
+			strconv.Itoa(frameNum * TIMESTEP),
+			strconv.Itoa(g.cohortSize[frameNum]),
+			strconv.Itoa(g.cohortOffspring[frameNum]),
+			reffCohort,
+			strconv.FormatBool(complete),
+			reffCrude,
+		})
+		if !complete || isBurnInFrame(frameNum) || summary.ReffCohortTurnoverTime >= 0 {
+			continue
+		}
+		if reff >= 1 {
+			aboveOne = true
+		} else if aboveOne {
+			summary.ReffCohortTurnoverTime = frameNum
+		}
+	}
+
+	cohortPath := filepath.Join(outputFolder, "reff_cohort.csv")
+	file, err := os.Create(cohortPath)
+	if err != nil {
+		log.Printf("Failed to create cohort R_eff CSV: %v", err)
+		return
+	}
+	defer file.Close()
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+	if err := writer.WriteAll(rows); err != nil {
+		log.Printf("Failed to write cohort R_eff CSV: %v", err)
+		return
+	}
+	fmt.Printf("Saved cohort R_eff: %s\n", cohortPath)
+}
+
+// Header of lineage.csv (-lineage)
+func lineageHeader() []string {
+	return []string{"infectionTime", "cellX", "cellY", "generation", "parentX", "parentY", "infectionType"}
+}
+
+// Function to write the infections of the current frame to lineage.csv and clear them
+func (g *Grid) recordLineage(writer *atomicCSV, frameNum int) error {
+	if writer == nil {
+		return nil
+	}
+	for _, e := range g.lineageEvents {
+		row := []string{
+			strconv.Itoa(e.Frame * TIMESTEP),
+			strconv.Itoa(e.I),
+			strconv.Itoa(e.J),
+			strconv.Itoa(e.Generation),
+			strconv.Itoa(e.ParentI),
+			strconv.Itoa(e.ParentJ),
+			stateNames[e.State],
+		}
+		if err := writer.WriteRow(row); err != nil {
+			return fmt.Errorf("%w: failed to write lineage CSV row at frame %d: %v", ErrOutputIO, frameNum, err)
+		}
+	}
+	g.lineageEvents = g.lineageEvents[:0]
+	return nil
+}
+
+// Function to record the first frame each cell is seen infected (wavefront arrival time)
+func (g *Grid) updateFirstInfectionTime(frameNum int) {
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			if g.firstInfectionTime[i][j] != -1 {
+				continue
+			}
+			// A dead cell must have been infected, even if it lysed within this frame
+			if isInfectedState(g.state[i][j]) || g.state[i][j] == DEAD {
+				g.firstInfectionTime[i][j] = frameNum
+			}
+		}
+	}
+}
+
+// Sources of IFN, by the infection state of the producing cell
+const (
+	IFN_SOURCE_VIRION = 0
+	IFN_SOURCE_DIP    = 1
+	IFN_SOURCE_BOTH   = 2
+)
+
+var ifnSourceNames = []string{"virion", "dip", "both"}
+
+// Function to map a producing cell's state to its IFN source
+func ifnSourceOf(state int) int {
+	switch {
+	case isInfectedBoth(state):
+		return IFN_SOURCE_BOTH
+	case isInfectedDIPOnly(state):
+		return IFN_SOURCE_DIP
+	default:
+		return IFN_SOURCE_VIRION
+	}
+}
+
+// Function to return the source that dominated the IFN a cell was exposed to (-1 if none)
+func (g *Grid) dominantIFNSource(i, j int) int {
+	exposure := g.ifnExposure[i][j]
+	if !ifnWave {
+		exposure = g.globalIFNBySource
+	}
+	best := -1
+	for source, amount := range exposure {
+		if amount > 0 && (best < 0 || amount > exposure[best]) {
+			best = source
+		}
+	}
+	return best
+}
+
+// Function to name a dominant IFN source for CSV output
+func ifnSourceName(source int) string {
+	if source < 0 {
+		return "none"
+	}
+	return ifnSourceNames[source]
+}
+
+// Function to record, at the end of a frame, which cells have been ANTIVIRAL and which had virions
+// arrive while still uninfected (inputs of the DIP-rescued fraction)
+func (g *Grid) updateRescueTracking() {
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			if g.state[i][j] == ANTIVIRAL {
+				g.everAntiviral[i][j] = true
+			}
+			if g.localVirions[i][j] > 0 && g.firstInfectionTime[i][j] == -1 {
+				g.virionsArrived[i][j] = true
+			}
+		}
+	}
+}
+
+// Function to compute the DIP-rescued fraction (% of all cells): cells that became ANTIVIRAL with
+// DIP-only infected cells as the dominant IFN source, had virions arrive, and were never infected
+func (g *Grid) dipRescuedPercentage() float64 {
+	rescued := 0
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			if g.everAntiviral[i][j] && g.virionsArrived[i][j] && g.firstInfectionTime[i][j] == -1 &&
+				g.dominantIFNSource(i, j) == IFN_SOURCE_DIP {
+				rescued++
+			}
+		}
+	}
+	return float64(rescued) / float64(GRID_SIZE*GRID_SIZE) * 100
+}
+
+// Function to count cells by dominant IFN source, keyed by source name
+func (g *Grid) dominantIFNSourceCounts() map[string]int {
+	counts := make(map[string]int)
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			counts[ifnSourceName(g.dominantIFNSource(i, j))]++
+		}
+	}
+	return counts
+}
+
+// Function to count the DIP-only reservoir: cells in INFECTED_DIP or INFECTED_DIP_CONTINUOUS
+func (g *Grid) dipOnlyCellCount() int {
+	count := 0
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			if isInfectedDIPOnly(g.state[i][j]) {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// Function to compute Moran's I of the DIP-only indicator (see indicatorMoransI)
+func (g *Grid) dipOnlyMoransI() float64 {
+	return g.indicatorMoransI(isInfectedDIPOnly)
+}
+
+// Function to compute Moran's I of the infected indicator (see indicatorMoransI)
+func (g *Grid) moransI() float64 {
+	return g.indicatorMoransI(isInfectedState)
+}
+
+// Function to compute Moran's I of the indicator of a set of states over the neighbors1 hex
+// neighbors, with row-standardized weights (each cell's in-grid neighbors weigh 1/their count, so
+// edge cells with fewer neighbors are not under-weighted). UNEXPOSED cells are left out; returns 0
+// when the indicator is constant. Near +1 the cells are clustered; the hex lattice has no
+// two-coloring without same-colored neighbors, so alternating stripes give its minimum, -1/3.
+func (g *Grid) indicatorMoransI(indicator func(state int) bool) float64 {
+	var x [GRID_SIZE][GRID_SIZE]float64
+	n := 0
+	mean := 0.0
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			if g.state[i][j] == UNEXPOSED {
+				continue
+			}
+			if indicator(g.state[i][j]) {
+				x[i][j] = 1
+				mean++
+			}
+			n++
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	mean /= float64(n)
+
+	var numerator, denominator, weightSum float64
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			if g.state[i][j] == UNEXPOSED {
+				continue
+			}
+			zi := x[i][j] - mean
+			denominator += zi * zi
+			var lag float64
+			k := 0
+			for _, neighbor := range g.neighbors1[i][j] {
+				ni, nj, ok := wrapCell(neighbor[0], neighbor[1])
+				if !ok || g.state[ni][nj] == UNEXPOSED {
+					continue
+				}
+				lag += x[ni][nj] - mean
+				k++
+			}
+			if k > 0 {
+				numerator += zi * lag / float64(k)
+				weightSum++
+			}
+		}
+	}
+	if denominator == 0 || weightSum == 0 {
+		return 0
+	}
+	return float64(n) / weightSum * numerator / denominator
+}
+
+// Function to save the isochrone map (first infection frame per cell, -1 if never) as CSV
+func (g *Grid) saveIsochroneCSV(outputFolder string) {
+	isochronePath := filepath.Join(outputFolder, "isochrone.csv")
+	file, err := os.Create(isochronePath)
+	if err != nil {
+		log.Printf("Failed to create isochrone CSV: %v", err)
+		return
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+
+	if err := writer.Write([]string{"i", "j", "firstInfectionTime"}); err != nil {
+		log.Printf("Failed to write isochrone CSV header: %v", err)
+		return
+	}
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			row := []string{strconv.Itoa(i), strconv.Itoa(j), strconv.Itoa(g.firstInfectionTime[i][j])}
+			if err := writer.Write(row); err != nil {
+				log.Printf("Failed to write isochrone CSV row: %v", err)
+				return
+			}
+		}
+	}
+	fmt.Printf("Saved isochrone map: %s\n", isochronePath)
+}
+
+// Function to return the cell the infection spreads from: -focusX/-focusY when set,
+// otherwise the first -foci entry for option 5, (25,25) for options 1 and 2 and the grid
+// center for the others
+func (g *Grid) infectionFocus() [2]int {
+	if *flag_focusX >= 0 && *flag_focusY >= 0 {
+		return [2]int{*flag_focusX, *flag_focusY}
+	}
+	if g.initOption == 5 && len(infectionFoci) > 0 {
+		return [2]int{infectionFoci[0].X, infectionFoci[0].Y}
+	}
+	if g.initOption == 1 || g.initOption == 2 {
+		return [2]int{25, 25}
+	}
+	return [2]int{GRID_SIZE / 2, GRID_SIZE / 2}
+}
+
+// Function to count infected cells at each hex distance 0..gridHexDiameter from center
+func (g *Grid) ringHistogram(center [2]int) []int {
+	counts := make([]int, gridHexDiameter+1)
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			if isInfectedState(g.state[i][j]) {
+				counts[getHexDistanceBetweenPoints(center[0], center[1], i, j)]++
+			}
+		}
+	}
+	return counts
+}
+
+// Function to record a seeded cell for frontRadius, once per cell
+func (g *Grid) addInfectionSeed(i, j int) {
+	for _, seed := range g.infectionSeeds {
+		if seed == [2]int{i, j} {
+			return
+		}
+	}
+	g.infectionSeeds = append(g.infectionSeeds, [2]int{i, j})
+}
+
+// Function to return the infection front radius: the largest hex distance from the nearest
+// seeded cell at which an INFECTED_* or DEAD cell exists, or -1 if there is none
+func (g *Grid) frontRadius() int {
+	front := -1
+	if len(g.infectionSeeds) == 0 {
+		return front
+	}
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			if !isInfectedState(g.state[i][j]) && g.state[i][j] != DEAD {
+				continue
+			}
+			nearest := -1
+			for _, seed := range g.infectionSeeds {
+				d := getHexDistanceBetweenPoints(seed[0], seed[1], i, j)
+				if nearest < 0 || d < nearest {
+					nearest = d
+				}
+			}
+			if nearest > front {
+				front = nearest
+			}
+		}
+	}
+	return front
+}
+
+// Function to build the ring_histogram.csv header: Time, r0, r1, ..., r<gridHexDiameter>
+func ringHistogramHeader() []string {
+	header := []string{"Time"}
+	for r := 0; r <= gridHexDiameter; r++ {
+		header = append(header, fmt.Sprintf("r%d", r))
+	}
+	return header
+}
+
+// Function to record the ring histogram around the infection focus as one row of ring_histogram.csv
+func (g *Grid) recordRingHistogram(writer *atomicCSV, frameNum int) error {
+	row := []string{strconv.Itoa(frameNum * TIMESTEP)}
+	for _, count := range g.ringHistogram(g.infectionFocus()) {
+		row = append(row, strconv.Itoa(count))
+	}
+	if err := writer.WriteRow(row); err != nil {
+		return fmt.Errorf("%w: failed to write ring histogram CSV row: %v", ErrOutputIO, err)
+	}
+	return nil
+}
+
+// radialRing is one hex ring of the radial profile around the infection focus
+type radialRing struct {
+	radius    int
+	cells     int                        // in-bounds cells of the ring (rings are clipped by an open boundary)
+	fractions [len(radialStates)]float64 // fraction of the ring's cells in each radialStates class
+	meanIFN   float64
+	meanV     float64 // mean extracellular virions per cell
+	meanD     float64 // mean extracellular DIPs per cell
+}
+
+// State classes of the radial profile, in column order; continuous states count with their burst-mode class
+var radialStates = [...]struct {
+	name string
+	is   func(int) bool
+}{
+	{"susceptible", func(s int) bool { return s == SUSCEPTIBLE }},
+	{"infectedVirion", isInfectedVirionOnly},
+	{"infectedDIP", isInfectedDIPOnly},
+	{"infectedBoth", isInfectedBoth},
+	{"dead", func(s int) bool { return s == DEAD }},
+	{"antiviral", func(s int) bool { return s == ANTIVIRAL }},
+	{"regrowth", func(s int) bool { return s == REGROWTH }},
+	{"unexposed", func(s int) bool { return s == UNEXPOSED }},
+}
+
+// Index of the DEAD class in radialStates
+const radialDead = 4
+
+// Function to compute the radial profile around center: one entry per hex ring (generateHexRing)
+// that has in-bounds cells, with means taken over those cells only. Under -boundary=periodic a
+// wrapped ring keeps only the cells whose shortest distance to center is its radius, so every
+// cell is counted in exactly one ring.
+func (g *Grid) radialProfile(center [2]int) []radialRing {
+	var profile []radialRing
+	for radius := 0; radius <= gridHexDiameter; radius++ {
+		cells := [][2]int{center}
+		if radius > 0 {
+			cells = cells[:0]
+			for _, cell := range wrapNeighbors(generateHexRing(center[0], center[1], radius), center) {
+				if !boundaryPeriodic || getHexDistanceBetweenPoints(center[0], center[1], cell[0], cell[1]) == radius {
+					cells = append(cells, cell)
+				}
+			}
+		}
+		if len(cells) == 0 {
+			continue
+		}
+		ring := radialRing{radius: radius, cells: len(cells)}
+		for _, cell := range cells {
+			i, j := cell[0], cell[1]
+			for k, class := range radialStates {
+				if class.is(g.state[i][j]) {
+					ring.fractions[k]++
+				}
+			}
+			ring.meanIFN += g.IFNConcentration[i][j]
+			ring.meanV += float64(g.localVirions[i][j])
+			ring.meanD += float64(g.localDips[i][j])
+		}
+		n := float64(len(cells))
+		for k := range ring.fractions {
+			ring.fractions[k] /= n
+		}
+		ring.meanIFN /= n
+		ring.meanV /= n
+		ring.meanD /= n
+		profile = append(profile, ring)
+	}
+	return profile
+}
+
+// Function to return the outermost ring of the radial profile holding a DEAD cell (-1 if none)
+func deadFrontRadius(profile []radialRing) int {
+	front := -1
+	for _, ring := range profile {
+		if ring.fractions[radialDead] > 0 {
+			front = ring.radius
+		}
+	}
+	return front
+}
+
+// Function to build the radial_profile.csv header
+func radialProfileHeader() []string {
+	header := []string{"Time", "radius", "cells"}
+	for _, class := range radialStates {
+		header = append(header, class.name)
+	}
+	return append(header, "meanIFN", "meanVirions", "meanDIPs")
+}
+
+// Function to write the radial profile rows at every -radialEvery frames
+func (g *Grid) recordRadialProfile(writer *atomicCSV, frameNum int) error {
+	if *flag_radialEvery <= 0 || frameNum%*flag_radialEvery != 0 {
+		return nil
+	}
+	for _, ring := range g.radialProfile(g.infectionFocus()) {
+		row := []string{strconv.Itoa(frameNum * TIMESTEP), strconv.Itoa(ring.radius), strconv.Itoa(ring.cells)}
+		for _, fraction := range ring.fractions {
+			row = append(row, strconv.FormatFloat(fraction, 'f', 6, 64))
+		}
+		row = append(row,
+			strconv.FormatFloat(ring.meanIFN, 'f', 6, 64),
+			strconv.FormatFloat(ring.meanV, 'f', 6, 64),
+			strconv.FormatFloat(ring.meanD, 'f', 6, 64))
+		if err := writer.WriteRow(row); err != nil {
+			return fmt.Errorf("%w: failed to write radial profile CSV row at frame %d: %v", ErrOutputIO, frameNum, err)
+		}
+	}
+	return nil
+}
+
+// atomicCSV writes each CSV row with a single write call into <path>.partial,
+// and renames it to <path> only when the run finishes cleanly, so a killed run
+// never leaves a truncated simulation_output.csv behind.
+type atomicCSV struct {
+	file      *os.File
+	finalPath string
+	buf       bytes.Buffer
+	writer    *csv.Writer
+	committed bool
+}
+
+func createAtomicCSV(finalPath string) (*atomicCSV, error) {
+	file, err := os.Create(finalPath + ".partial")
+	if err != nil {
+		return nil, err
+	}
+	a := &atomicCSV{file: file, finalPath: finalPath}
+	a.writer = csv.NewWriter(&a.buf)
+	return a, nil
+}
+
+// Function to write one complete row (encoded in memory first, then one write to the file)
+func (a *atomicCSV) WriteRow(row []string) error {
+	a.buf.Reset()
+	if err := a.writer.Write(row); err != nil {
+		return err
+	}
+	a.writer.Flush()
+	if err := a.writer.Error(); err != nil {
+		return err
+	}
+	_, err := a.file.Write(a.buf.Bytes())
+	return err
+}
+
+// Function to sync and rename the finished file into place
+func (a *atomicCSV) Commit() error {
+	if a.committed {
+		return nil
+	}
+	if err := a.file.Sync(); err != nil {
+		return err
+	}
+	if err := a.file.Close(); err != nil {
+		return err
+	}
+	a.committed = true
+	return os.Rename(a.file.Name(), a.finalPath)
+}
+
+// Function to close the file without renaming (leaves <path>.partial if Commit was never called)
+func (a *atomicCSV) Close() {
+	if !a.committed {
+		a.file.Close()
+	}
+}
+
+// fieldDump streams -dumpField frames into one NumPy .npy file (format 1.0) holding a 1-D
+// structured array, one record per sampled frame with fields frame, hour, state, localVirions,
+// localDips (little-endian int32 GRID_SIZE x GRID_SIZE) and IFNConcentration (float64). Like
+// atomicCSV it writes <path>.partial, one write call per record, and renames it on Commit.
+type fieldDump struct {
+	file      *os.File
+	finalPath string
+	record    []byte
+	committed bool
+}
+
+// Function to create the .npy file for records frames and write its header
+func createFieldDump(finalPath string, records int) (*fieldDump, error) {
+	grid := fmt.Sprintf("(%d, %d)", GRID_SIZE, GRID_SIZE)
+	header := fmt.Sprintf("{'descr': [('frame', '<i4'), ('hour', '<i4'), ('state', '<i4', %s), ('localVirions', '<i4', %s), "+
+		"('localDips', '<i4', %s), ('IFNConcentration', '<f8', %s)], 'fortran_order': False, 'shape': (%d,), }",
+		grid, grid, grid, grid, records)
+	// Magic, version 1.0 and the header length take 10 bytes; pad the header so data starts 64-byte aligned
+	for (10+len(header)+1)%64 != 0 {
+		header += " "
+	}
+	header += "\n"
+
+	file, err := os.Create(finalPath + ".partial")
+	if err != nil {
+		return nil, err
+	}
+	preamble := append([]byte("\x93NUMPY\x01\x00"), 0, 0)
+	binary.LittleEndian.PutUint16(preamble[8:], uint16(len(header)))
+	if _, err := file.Write(append(preamble, header...)); err != nil {
+		file.Close()
+		return nil, err
+	}
+	cells := GRID_SIZE * GRID_SIZE
+	return &fieldDump{file: file, finalPath: finalPath, record: make([]byte, 8+3*4*cells+8*cells)}, nil
+}
+
+// Function to append frame frameNum of the grid as one record
+func (d *fieldDump) WriteFrame(g *Grid, frameNum int) error {
+	binary.LittleEndian.PutUint32(d.record[0:], uint32(frameNum))
+	binary.LittleEndian.PutUint32(d.record[4:], uint32(frameNum*TIMESTEP))
+	cells := GRID_SIZE * GRID_SIZE
+	state, virions, dips, ifn := d.record[8:], d.record[8+4*cells:], d.record[8+8*cells:], d.record[8+12*cells:]
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			k := i*GRID_SIZE + j
+			binary.LittleEndian.PutUint32(state[4*k:], uint32(int32(g.state[i][j])))
+			binary.LittleEndian.PutUint32(virions[4*k:], uint32(int32(g.localVirions[i][j])))
+			binary.LittleEndian.PutUint32(dips[4*k:], uint32(int32(g.localDips[i][j])))
+			binary.LittleEndian.PutUint64(ifn[8*k:], math.Float64bits(g.IFNConcentration[i][j]))
+		}
+	}
+	_, err := d.file.Write(d.record)
+	return err
+}
+
+// Function to sync and rename the finished file into place
+func (d *fieldDump) Commit() error {
+	if d.committed {
+		return nil
+	}
+	if err := d.file.Sync(); err != nil {
+		return err
+	}
+	if err := d.file.Close(); err != nil {
+		return err
+	}
+	d.committed = true
+	return os.Rename(d.file.Name(), d.finalPath)
+}
+
+// Function to close the file without renaming (leaves <path>.partial if Commit was never called)
+func (d *fieldDump) Close() {
+	if !d.committed {
+		d.file.Close()
+	}
+}
+
+// Function to record simulation data into CSV at each timestep
+func (g *Grid) recordSimulationData(writer *atomicCSV, frameNum int) error {
+	totalVirions := g.totalVirions()
+	totalDIPs := g.totalDIPs()
+	deadCellPercentage := strconv.FormatFloat(calculateDeadCellPercentage(g.state), 'f', 6, 64)
+	susceptiblePercentage := strconv.FormatFloat(g.calculateSusceptiblePercentage(), 'f', 6, 64)
+	infectedPercentage := strconv.FormatFloat(g.calculateInfectedPercentage(), 'f', 6, 64)
+	infectedDIPOnlyPercentage := strconv.FormatFloat(g.calculateInfectedDIPOnlyPercentage(), 'f', 6, 64)
+	infectedBothPercentage := strconv.FormatFloat(g.calculateInfectedBothPercentage(), 'f', 6, 64)
+	antiviralPercentage := strconv.FormatFloat(g.calculateAntiviralPercentage(), 'f', 6, 64)
+	virionOnlyInfected := g.calculateVirionOnlyInfected()
+	dipOnlyInfected := g.calculateDipOnlyInfected()
+	bothInfected := g.calculateBothInfected()
+
+	// Calculate DIP advantage = burstSizeD / burstSizeV
+	dipAdvantage = float64(BURST_SIZE_D) / float64(BURST_SIZE_V)
+
+	// R_eff(t) crude ratio estimate ("NA" when no lysis events one mean lysis time ago)
+	newInfections, lysisEvents, reffCrude := 0, 0, "NA"
+	if frameNum < len(g.newInfectionsPerFrame) {
+		newInfections = g.newInfectionsPerFrame[frameNum]
+		lysisEvents = g.lysisEventsPerFrame[frameNum]
+	}
+	if reff, ok := g.crudeReff(frameNum); ok {
+		reffCrude = strconv.FormatFloat(reff, 'f', 6, 64)
+	}
+
+	// Realized means of the per-cell continuous-mode durations (configured values until a cell is sampled)
+	meanIncubation := float64(g.continuousIncubationPeriod)
+	meanContinuousLysis := g.continuousLysisTime
+	if g.sampledContinuousCells > 0 {
+		meanIncubation = g.sampledIncubationSum / float64(g.sampledContinuousCells)
+		meanContinuousLysis = g.sampledLysisTimeSum / float64(g.sampledContinuousCells)
+	}
+
+	plaques := summarizePlaques(g.findPlaques())
+	susceptibilityMean, susceptibilityVar := g.susceptibilityMoments()
+
+	// Front velocity in cells per hour ("NA" until two consecutive frames have a front)
+	front, frontVelocity := g.frontRadius(), "NA"
+	if front >= 0 && g.lastFrontRadius >= 0 && frameNum > 0 {
+		frontVelocity = strconv.FormatFloat(float64(front-g.lastFrontRadius)/float64(TIMESTEP), 'f', 6, 64)
+	}
+	g.lastFrontRadius = front
+
+	row := []string{
+		strconv.Itoa(frameNum),
+		strconv.FormatFloat(virion_half_life, 'f', 6, 64), // Add virion clearance rate
+		strconv.FormatFloat(dip_half_life, 'f', 6, 64),    // Add DIP clearance rate
+		strconv.FormatFloat(ifn_half_life, 'f', 6, 64),    // Add IFN clearance rate
+		strconv.FormatFloat(globalIFN/float64(GRID_SIZE*GRID_SIZE), 'f', 6, 64),
+		strconv.Itoa(totalVirions),
+		strconv.Itoa(totalDIPs),
+		deadCellPercentage,
+		susceptiblePercentage,
+		infectedPercentage,
+		infectedDIPOnlyPercentage,
+		infectedBothPercentage,
+		antiviralPercentage,
+		strconv.Itoa(g.calculateRegrowthCount()),
+		strconv.FormatFloat(g.calculateSusceptiblePercentage(), 'f', 6, 64),
+		strconv.FormatFloat(g.calculateRegrowthedOrAntiviralPercentage(), 'f', 6, 64),
+		"variate, depending on radius 10 of IFN",
+		"variate, depending on radius 10 of IFN",
+		strconv.FormatFloat(RHO, 'f', 6, 64),
+		strconv.Itoa(totalVirions + totalDIPs),
+		strconv.FormatFloat(g.calculatePlaquePercentage(), 'f', 6, 64),
+		strconv.FormatFloat(float64(maxGlobalIFN), 'f', 6, 64),
+		"-1.0",
+		strconv.FormatFloat(g.calculateUninfectedPercentage(), 'f', 6, 64),
+		strconv.Itoa(plaques.count),
+		strconv.Itoa(GRID_SIZE),
+		strconv.Itoa(TIMESTEP),
+		strconv.Itoa(IFN_DELAY),
+		strconv.Itoa(STD_IFN_DELAY),
+		strconv.FormatFloat(ALPHA, 'f', 6, 64),
+		strconv.FormatFloat(RHO, 'f', 6, 64),
+		strconv.FormatFloat(float64(TAU), 'f', 6, 64),
+		strconv.Itoa(BURST_SIZE_V),
+		strconv.FormatFloat(REGROWTH_MEAN, 'f', 6, 64),
+		strconv.FormatFloat(REGROWTH_STD, 'f', 6, 64),
+		strconv.Itoa(TIME_STEPS),
+		strconv.FormatFloat(MEAN_LYSIS_TIME, 'f', 6, 64),
+		strconv.FormatFloat(STANDARD_LYSIS_TIME, 'f', 6, 64),
+		strconv.FormatFloat(float64(*flag_v_pfu_initial)/float64(GRID_SIZE*GRID_SIZE), 'f', 6, 64),
+		strconv.FormatFloat(float64(*flag_d_pfu_initial)/float64(GRID_SIZE*GRID_SIZE), 'f', 6, 64),
+		"-1.0",
+		"-1.0",
+		strconv.FormatFloat(float64(R), 'f', 6, 64),
+		strconv.Itoa(BURST_SIZE_D),
+		"-1.0",
+
+		strconv.Itoa(option),
+		strconv.FormatFloat(*flag_v_pfu_initial, 'f', -1, 64),
+		strconv.FormatFloat(*flag_d_pfu_initial, 'f', -1, 64),
+		strconv.Itoa(virionOnlyInfected),
+		strconv.Itoa(dipOnlyInfected),
+		strconv.Itoa(bothInfected),
+		strconv.Itoa(totalDeadFromV),
+		strconv.Itoa(totalDeadFromBoth),
+		strconv.Itoa(virionDiffusionRate),
+		strconv.Itoa(dipDiffusionRate),
+		strconv.FormatFloat(k_JumpR, 'f', 6, 64),
+		strconv.Itoa(jumpRadiusV),
+		strconv.Itoa(jumpRadiusD),
+		strconv.FormatBool(jumpRandomly),
+		strconv.FormatBool(par_celltocell_random),
+		strconv.FormatBool(allowVirionJump),
+		strconv.FormatBool(allowDIPJump),
+		strconv.Itoa(IFN_wave_radius),
+		strconv.FormatBool(ifnWave),
+		strconv.FormatFloat(ifnBothFold, 'f', 6, 64),
+		strconv.FormatFloat(D_only_IFN_stimulate_ratio, 'f', 6, 64),
+		strconv.FormatFloat(BOTH_IFN_stimulate_ratio, 'f', 6, 64),
+		strconv.Itoa(g.totalRandomJumpVirions),        // New: total number of randomly jumping Virions
+		strconv.Itoa(g.totalRandomJumpDIPs),           // New: total number of randomly jumping DIPs
+		strconv.FormatFloat(dipAdvantage, 'f', 6, 64), // DIP advantage = burstSizeD / burstSizeV
+		strconv.FormatBool(isBurnInFrame(frameNum)),   // warm-up frame, excluded from summary endpoints
+		strconv.FormatBool(isPerturbedFrame(frameNum)),
+		strconv.Itoa(newInfections),
+		strconv.Itoa(lysisEvents),
+		reffCrude,
+		strconv.FormatFloat(meanIncubation, 'f', 6, 64),
+		strconv.FormatFloat(meanContinuousLysis, 'f', 6, 64),
+		strconv.Itoa(g.adsorbedVirions),
+		strconv.Itoa(g.adsorbedDIPs),
+		strconv.Itoa(plaques.count),
+		strconv.Itoa(plaques.edgeCount),
+		strconv.FormatFloat(plaques.meanRadius, 'f', 6, 64),
+		strconv.FormatFloat(plaques.meanInteriorRadius, 'f', 6, 64),
+		strconv.Itoa(front),
+		frontVelocity,
+		strconv.FormatFloat(plaques.meanArea, 'f', 6, 64),
+		strconv.Itoa(plaques.maxArea),
+		strconv.FormatFloat(plaques.meanExtent, 'f', 6, 64),
+		strconv.FormatFloat(susceptibilityMean, 'f', 6, 64),
+		strconv.FormatFloat(susceptibilityVar, 'f', 6, 64),
+		strconv.Itoa(g.antiviralExits),
+		strconv.Itoa(g.antiviralCellCount),
+		strconv.Itoa(g.totalAntiviralTime),
+		strconv.Itoa(g.everRegrownCount),
+		strconv.FormatFloat(g.moransI(), 'f', 6, 64),
+		strconv.Itoa(g.dosedDIPs),
+		strconv.Itoa(g.washedVirions),
+		strconv.Itoa(g.washedDIPs),
+	}
+
+	if err := writer.WriteRow(row); err != nil {
+		return fmt.Errorf("%w: failed to write CSV row at frame %d: %v", ErrOutputIO, frameNum, err)
+	}
+	return nil
+}
+
+// Function to save all per-cell fields of the current frame as CSV, one row per cell (i, j);
+// gzip-compressed if snapshotPath ends in .gz
+func (g *Grid) saveSnapshotCSV(snapshotPath string) {
+	file, err := os.Create(snapshotPath)
+	if err != nil {
+		log.Printf("Failed to create snapshot CSV: %v", err)
+		return
+	}
+	defer file.Close()
+
+	var out io.Writer = file
+	if strings.HasSuffix(snapshotPath, ".gz") {
+		gz := gzip.NewWriter(file)
+		defer gz.Close()
+		out = gz
+	}
+	writer := csv.NewWriter(out)
+	defer writer.Flush()
+
+	header := []string{
+		"i", "j", "state", "localVirions", "localDips", "IFNConcentration",
+		"timeSinceInfectVorBoth", "timeSinceInfectDIP", "timeSinceDead", "timeSinceAntiviral",
+		"antiviralFlag", "previousState", "firstInfectionTime", "ifnDominantSource",
+	}
+	if err := writer.Write(header); err != nil {
+		log.Printf("Failed to write snapshot CSV header: %v", err)
+		return
+	}
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			row := []string{
+				strconv.Itoa(i),
+				strconv.Itoa(j),
+				strconv.Itoa(g.state[i][j]),
+				strconv.Itoa(g.localVirions[i][j]),
+				strconv.Itoa(g.localDips[i][j]),
+				strconv.FormatFloat(g.IFNConcentration[i][j], 'g', -1, 64),
+				strconv.Itoa(g.timeSinceInfectVorBoth[i][j]),
+				strconv.Itoa(g.timeSinceInfectDIP[i][j]),
+				strconv.Itoa(g.timeSinceDead[i][j]),
+				strconv.Itoa(g.timeSinceAntiviral[i][j]),
+				strconv.FormatBool(g.antiviralFlag[i][j]),
+				strconv.Itoa(g.previousStates[i][j]),
+				strconv.Itoa(g.firstInfectionTime[i][j]),
+				ifnSourceName(g.dominantIFNSource(i, j)),
+			}
+			if err := writer.Write(row); err != nil {
+				log.Printf("Failed to write snapshot CSV row: %v", err)
+				return
+			}
+		}
+	}
+}
+
+// GridSnapshot is a snapshot file read back by LoadSnapshot, indexed [i][j]
+type GridSnapshot struct {
+	State            [][]int
+	LocalVirions     [][]int
+	LocalDips        [][]int
+	IFNConcentration [][]float64
+}
+
+// Function to read a snapshot written by saveSnapshotCSV (.csv or .csv.gz) back into per-cell
+// matrices, so spatial statistics can be computed after a run without re-running it
+func LoadSnapshot(path string) (*GridSnapshot, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var in io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return nil, fmt.Errorf("snapshot %s: %v", path, err)
+		}
+		defer gz.Close()
+		in = gz
+	}
+	records, err := csv.NewReader(in).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("snapshot %s: %v", path, err)
+	}
+	if len(records) < 2 {
+		return nil, fmt.Errorf("snapshot %s has no cells", path)
+	}
+
+	col := make(map[string]int)
+	for idx, name := range records[0] {
+		col[name] = idx
+	}
+	for _, name := range []string{"i", "j", "state", "localVirions", "localDips", "IFNConcentration"} {
+		if _, ok := col[name]; !ok {
+			return nil, fmt.Errorf("snapshot %s is missing column %q", path, name)
+		}
+	}
+
+	// Grid size from the largest indices
+	size := 0
+	for _, row := range records[1:] {
+		for _, name := range []string{"i", "j"} {
+			if v, err := strconv.Atoi(row[col[name]]); err == nil && v+1 > size {
+				size = v + 1
+			}
+		}
+	}
+	s := &GridSnapshot{
+		State:            make([][]int, size),
+		LocalVirions:     make([][]int, size),
+		LocalDips:        make([][]int, size),
+		IFNConcentration: make([][]float64, size),
+	}
+	for i := 0; i < size; i++ {
+		s.State[i] = make([]int, size)
+		s.LocalVirions[i] = make([]int, size)
+		s.LocalDips[i] = make([]int, size)
+		s.IFNConcentration[i] = make([]float64, size)
+	}
+	for line, row := range records[1:] {
+		i, errI := strconv.Atoi(row[col["i"]])
+		j, errJ := strconv.Atoi(row[col["j"]])
+		state, errS := strconv.Atoi(row[col["state"]])
+		virions, errV := strconv.Atoi(row[col["localVirions"]])
+		dips, errD := strconv.Atoi(row[col["localDips"]])
+		ifn, errF := strconv.ParseFloat(row[col["IFNConcentration"]], 64)
+		if errI != nil || errJ != nil || errS != nil || errV != nil || errD != nil || errF != nil || i < 0 || j < 0 {
+			return nil, fmt.Errorf("snapshot %s: bad row %d: %v", path, line+2, row)
+		}
+		s.State[i][j] = state
+		s.LocalVirions[i][j] = virions
+		s.LocalDips[i][j] = dips
+		s.IFNConcentration[i][j] = ifn
+	}
+	return s, nil
+}
+
+// Function to return the extracellular virion and DIP totals of a snapshot (the "Total
+// Extracellular Virions/DIPs" columns of the matching simulation_output.csv row)
+func (s *GridSnapshot) Totals() (virions, dips int) {
+	for i := range s.LocalVirions {
+		for j := range s.LocalVirions[i] {
+			virions += s.LocalVirions[i][j]
+			dips += s.LocalDips[i][j]
+		}
+	}
+	return virions, dips
+}
+
+// countingSource wraps the grid's random source and counts the values drawn from it. A
+// checkpoint stores the seed and the count; restoring reseeds and skips that many values.
+type countingSource struct {
+	src   rand.Source64
+	seed  int64
+	draws uint64
+}
+
+func newCountingSource(seed int64) *countingSource {
+	return &countingSource{src: rand.NewSource(seed).(rand.Source64), seed: seed}
+}
+
+func (s *countingSource) Int63() int64 {
+	s.draws++
+	return s.src.Int63()
+}
+
+func (s *countingSource) Uint64() uint64 {
+	s.draws++
+	return s.src.Uint64()
+}
+
+func (s *countingSource) Seed(seed int64) {
+	s.src.Seed(seed)
+	s.seed = seed
+	s.draws = 0
+}
+
+// Function to reseed the grid's random stream and skip to the given number of draws
+func (g *Grid) restoreRNG(seed int64, draws uint64) {
+	g.rngSource = newCountingSource(seed)
+	for g.rngSource.draws < draws {
+		g.rngSource.Uint64()
+	}
+	g.rng = rand.New(g.rngSource)
+}
+
+// checkpointVersion is bumped whenever the list in checkpointState changes
+const checkpointVersion = 11
+
+// checkpointHeader is the first value of a checkpoint file
+type checkpointHeader struct {
+	Version   int
+	Frame     int // last completed frame; a resumed run continues at Frame+1
+	Seed      int64
+	Draws     uint64 // values drawn from the grid's random stream so far
+	GridSize  int
+	TimeSteps int
+}
+
+// runSeries holds the per-frame series Run keeps outside the Grid (graphs and video)
+type runSeries struct {
+	frameNumbers        []int
+	deadCellPercentages []float64
+	virionOnly          []float64
+	dipOnly             []float64
+	both                []float64
+}
+
+// Function to list everything a checkpoint carries, in file order: the Grid's dynamic fields,
+// the package-level scalars the update loop accumulates, the summary and the run's series.
+// Neighbor tables and parameters are not stored; they come from the flags of the resumed run.
+func (g *Grid) checkpointState(summary *SimulationSummary, series *runSeries) []interface{} {
+	return []interface{}{
+		&g.state, &g.localVirions, &g.localDips, &g.IFNConcentration,
+		&g.timeSinceInfectVorBoth, &g.timeSinceInfectDIP, &g.timeSinceDead, &g.timeSinceRegrowth, &g.timeSinceSusceptible,
+		&g.stateChanged, &g.antiviralDuration, &g.previousStates, &g.antiviralFlag, &g.timeSinceAntiviral, &g.timeInAntiviralState,
+		&g.antiviralCellCount, &g.totalAntiviralTime, &g.intraWT, &g.intraDVG,
+		&g.unexposedMask, &g.allowJumpRandomly, &g.totalRandomJumpVirions, &g.totalRandomJumpDIPs,
+		&g.lysisThreshold, &g.eclipseThreshold, &g.dipLysisThreshold, &g.dipClearanceThreshold, &g.regrowthThreshold,
+		&g.infectionTime, &g.isProducing, &g.incubationPeriodCell, &g.lysisTimeCell,
+		&g.sampledContinuousCells, &g.sampledIncubationSum, &g.sampledLysisTimeSum,
+		&g.dipHalfLife, &g.cellSusceptibility, &g.susceptibilityScale, &g.firstInfectionTime, &g.infectionStartFrame, &g.ifnExposure, &g.globalIFNBySource,
+		&g.everAntiviral, &g.virionsArrived, &g.ifnNonResponder, &g.partitionReleased, &g.partitionJumped,
+		&g.newInfectionsPerFrame, &g.lysisEventsPerFrame, &g.adsorbedVirions, &g.adsorbedDIPs,
+		&g.infectionSeeds, &g.lastFrontRadius, &g.immuneCells, &g.antiviralRemaining, &g.regrowthRemaining, &g.everRegrown, &g.everRegrownCount,
+		&g.generation, &g.parentID, &g.lastReleaseFrame, &g.lineageFrame, &g.cohortSize, &g.cohortOffspring,
+		&globalIFN, &maxGlobalIFN, &globalIFNperCell, &totalDeadFromV, &totalDeadFromBoth,
+		summary, &summary.reffAboveOne, &summary.virionSeries, &summary.dipSeries, &summary.releasedVirionSeries, &summary.releasedDIPSeries,
+		&series.frameNumbers, &series.deadCellPercentages, &series.virionOnly, &series.dipOnly, &series.both,
+	}
+}
+
+// Function to write a checkpoint after frameNum, so the run can be resumed with -resumeFrom.
+// The file is written next to its final name and renamed, so a crash never leaves half a checkpoint.
+func (g *Grid) saveCheckpoint(path string, frameNum int, summary *SimulationSummary, series *runSeries) error {
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	header := checkpointHeader{
+		Version:   checkpointVersion,
+		Frame:     frameNum,
+		Seed:      g.rngSource.seed,
+		Draws:     g.rngSource.draws,
+		GridSize:  GRID_SIZE,
+		TimeSteps: TIME_STEPS,
+	}
+	if err := enc.Encode(&header); err != nil {
+		return err
+	}
+	for _, value := range g.checkpointState(summary, series) {
+		if err := enc.Encode(value); err != nil {
+			return err
+		}
+	}
+	if err := os.WriteFile(path+".partial", buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".partial", path)
+}
+
+// Function to read a checkpoint header and return a decoder positioned at the state that follows
+func openCheckpoint(path string) (checkpointHeader, *gob.Decoder, error) {
+	var header checkpointHeader
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return header, nil, err
+	}
+	dec := gob.NewDecoder(bytes.NewReader(data))
+	if err := dec.Decode(&header); err != nil {
+		return header, nil, fmt.Errorf("%s is not a checkpoint: %v", path, err)
+	}
+	switch {
+	case header.Version != checkpointVersion:
+		return header, nil, fmt.Errorf("%s has checkpoint version %d, this build reads version %d", path, header.Version, checkpointVersion)
+	case header.GridSize != GRID_SIZE || header.TimeSteps != TIME_STEPS:
+		return header, nil, fmt.Errorf("%s was written with GRID_SIZE=%d TIME_STEPS=%d, this build has %d and %d",
+			path, header.GridSize, header.TimeSteps, GRID_SIZE, TIME_STEPS)
+	case header.Frame < 0 || header.Frame >= TIME_STEPS-1:
+		return header, nil, fmt.Errorf("%s is at frame %d, nothing is left to run (TIME_STEPS=%d)", path, header.Frame, TIME_STEPS)
+	}
+	return header, dec, nil
+}
+
+// Function to start a resumed run's output file with the rows before startFrame of the
+// checkpointed run, read from the file (or the .partial a killed run left) next to the checkpoint,
+// so the CSV covers the whole time course. Nothing is copied when the file is missing there or
+// was written with a different header.
+func carryOverRows(writer *atomicCSV, name string, header []string, startFrame int) error {
+	if *flag_resumeFrom == "" || writer == nil {
+		return nil
+	}
+	path := filepath.Join(filepath.Dir(*flag_resumeFrom), name)
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		path += ".partial"
+		file, err = os.Open(path)
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		fmt.Printf("⚠️ %s not found next to the checkpoint; it starts at frame %d\n", name, startFrame)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%w: failed to open %s: %v", ErrOutputIO, path, err)
+	}
+	defer file.Close()
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		// A killed run can leave a half-written last row; keep the complete ones
+		fmt.Printf("⚠️ %s: %v\n", path, err)
+	}
+	if len(records) == 0 || strings.Join(records[0], ",") != strings.Join(header, ",") {
+		fmt.Printf("⚠️ %s has a different header; it starts at frame %d\n", path, startFrame)
+		return nil
+	}
+	copied := 0
+	for _, row := range records[1:] {
+		t, err := strconv.ParseFloat(row[0], 64)
+		if err != nil || len(row) != len(header) || t >= float64(startFrame*TIMESTEP) {
+			continue
+		}
+		if err := writer.WriteRow(row); err != nil {
+			return fmt.Errorf("%w: failed to copy %s rows: %v", ErrOutputIO, name, err)
+		}
+		copied++
+	}
+	fmt.Printf("Main: Carried over %d rows of %s from the checkpointed run\n", copied, name)
+	return nil
+}
+
+// Function to overwrite the grid, globals, summary and series with the checkpoint state and
+// move the random stream to where the checkpointed run left it
+func (g *Grid) restoreCheckpoint(header checkpointHeader, dec *gob.Decoder, summary *SimulationSummary, series *runSeries) error {
+	// gob leaves zero-valued struct fields untouched on decode, so start from an empty summary
+	*summary = SimulationSummary{}
+	for _, value := range g.checkpointState(summary, series) {
+		if err := dec.Decode(value); err != nil {
+			return fmt.Errorf("failed to read checkpoint state: %v", err)
+		}
+	}
+	g.ifnRowSums.valid = false
+	g.restoreLatestReleasers()
+	g.restoreRNG(header.Seed, header.Draws)
+	return nil
+}
+
+// Function to compute a SHA-256 hash of the full grid state (state, particles and IFN).
+// Two runs with the same seed and parameters must produce the same hash.
+func (g *Grid) stateHash() string {
+	h := sha256.New()
+	buf := make([]byte, 8)
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			binary.LittleEndian.PutUint64(buf, uint64(g.state[i][j]))
+			h.Write(buf)
+			binary.LittleEndian.PutUint64(buf, uint64(g.localVirions[i][j]))
+			h.Write(buf)
+			binary.LittleEndian.PutUint64(buf, uint64(g.localDips[i][j]))
+			h.Write(buf)
+			binary.LittleEndian.PutUint64(buf, math.Float64bits(g.IFNConcentration[i][j]))
+			h.Write(buf)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// PerturbationStep is one key=value change of the warmup-then-perturb protocol
+type PerturbationStep struct {
+	Key   string
+	Raw   string
+	Value float64 // parsed value (half-lives in hours)
+}
+
+// Function to parse "rho=0.05,injectDIPs=5000" into perturbation steps, applied in order
+func parsePerturbation(text string) ([]PerturbationStep, error) {
+	var steps []PerturbationStep
+	for _, part := range strings.Split(text, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("%q is not key=value", part)
+		}
+		step := PerturbationStep{Key: strings.TrimSpace(kv[0]), Raw: strings.TrimSpace(kv[1])}
+		var err error
+		switch step.Key {
+		case "rho":
+			step.Value, err = strconv.ParseFloat(step.Raw, 64)
+		case "burstSizeV", "burstSizeD", "injectVirions", "injectDIPs":
+			var n int
+			n, err = strconv.Atoi(step.Raw)
+			step.Value = float64(n)
+		case "virion_half_life", "ifn_half_life":
+			step.Value, _, err = parseHalfLife(step.Raw)
+		default:
+			return nil, fmt.Errorf("unknown perturbation %q (use rho, burstSizeV, burstSizeD, virion_half_life, ifn_half_life, injectVirions, injectDIPs)", step.Key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("bad value in %q: %v", part, err)
+		}
+		if step.Value < 0 {
+			return nil, fmt.Errorf("%q must not be negative", part)
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// Function to set the model parameter changed by a perturbation step; false for the injection steps
+func setPerturbationParameter(step PerturbationStep) bool {
+	switch step.Key {
+	case "rho":
+		RHO = step.Value
+	case "burstSizeV":
+		BURST_SIZE_V = int(step.Value)
+	case "burstSizeD":
+		BURST_SIZE_D = int(step.Value)
+	case "virion_half_life":
+		virion_half_life = step.Value
+	case "ifn_half_life":
+		ifn_half_life = step.Value
+	default:
+		return false
+	}
+	return true
+}
+
+// Function to apply the perturbation steps; injected particles land on uniformly random cells
+func (g *Grid) applyPerturbation(frameNum int, steps []PerturbationStep) {
+	fmt.Printf("🧪 Perturbation at frame %d (after %d warm-up frames)\n", frameNum, frameNum)
+	for _, step := range steps {
+		switch {
+		case setPerturbationParameter(step):
+		case step.Key == "injectVirions":
+			for k := 0; k < int(step.Value); k++ {
+				g.localVirions[g.rng.Intn(GRID_SIZE)][g.rng.Intn(GRID_SIZE)]++
+			}
+		case step.Key == "injectDIPs":
+			for k := 0; k < int(step.Value); k++ {
+				g.localDips[g.rng.Intn(GRID_SIZE)][g.rng.Intn(GRID_SIZE)]++
+			}
+		}
+		fmt.Printf("   %s = %s\n", step.Key, step.Raw)
+	}
+}
+
+// DIPDose is one exogenous DIP addition of -dipDose: Count DIPs added at frame Frame, spread
+// uniformly or around the hotspot (X,Y) within Radius
+type DIPDose struct {
+	Frame  int
+	Count  int
+	Mode   string // uniform or hotspot
+	X, Y   int
+	Radius int
+}
+
+// Function to parse "t=12:count=5000:mode=uniform;t=24:count=2000:mode=hotspot:x=60:y=60:radius=5"
+// into DIP doses. The grid bounds and the frame range are checked in Run.
+func parseDIPDoses(text string) ([]DIPDose, error) {
+	var doses []DIPDose
+	for _, entry := range strings.Split(text, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		dose := DIPDose{Frame: -1, Count: -1, Mode: "uniform", X: -1, Y: -1}
+		for _, part := range strings.Split(entry, ":") {
+			kv := strings.SplitN(part, "=", 2)
+			if len(kv) != 2 {
+				return nil, fmt.Errorf("dose %q: %q is not key=value", entry, part)
+			}
+			key, value := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+			if key == "mode" {
+				if value != "uniform" && value != "hotspot" {
+					return nil, fmt.Errorf("dose %q: invalid mode %q (expected uniform or hotspot)", entry, value)
+				}
+				dose.Mode = value
+				continue
+			}
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("dose %q: bad value in %q: %v", entry, part, err)
+			}
+			switch key {
+			case "t":
+				dose.Frame = n
+			case "count":
+				dose.Count = n
+			case "x":
+				dose.X = n
+			case "y":
+				dose.Y = n
+			case "radius":
+				dose.Radius = n
+			default:
+				return nil, fmt.Errorf("dose %q: unknown key %q (use t, count, mode, x, y, radius)", entry, key)
+			}
+		}
+		if dose.Frame < 0 || dose.Count < 0 {
+			return nil, fmt.Errorf("dose %q: needs t >= 0 and count >= 0", entry)
+		}
+		if dose.Radius < 0 {
+			return nil, fmt.Errorf("dose %q: radius must be >= 0", entry)
+		}
+		doses = append(doses, dose)
+	}
+	return doses, nil
+}
+
+// Function to add the -dipDose doses of this frame to localDips, before the frame's update.
+// Only -depositPolicy cells receive DIPs (all cells of the footprint if none is eligible).
+func (g *Grid) applyDIPDoses(frameNum int) {
+	g.dosedDIPs = 0
+	for _, dose := range dipDoses {
+		if dose.Frame != frameNum || dose.Count == 0 {
+			continue
+		}
+		if dose.Mode == "hotspot" {
+			area := append([][2]int{{dose.X, dose.Y}}, g.cellsWithinRadius(dose.X, dose.Y, dose.Radius)...)
+			if targets := g.depositTargets(area); len(targets) > 0 {
+				area = targets
+			}
+			g.addDIPsByDistance(dose.X, dose.Y, area, dose.Count)
+		} else {
+			var area [][2]int
+			for i := 0; i < GRID_SIZE; i++ {
+				for j := 0; j < GRID_SIZE; j++ {
+					area = append(area, [2]int{i, j})
+				}
+			}
+			if targets := g.depositTargets(area); len(targets) > 0 {
+				area = targets
+			}
+			for k := 0; k < dose.Count; k++ {
+				cell := area[g.rng.Intn(len(area))]
+				g.localDips[cell[0]][cell[1]]++
+			}
+		}
+		g.dosedDIPs += dose.Count
+		fmt.Printf("💉 DIP dose at frame %d: %d DIPs (%s)\n", frameNum, dose.Count, dose.Mode)
+	}
+}
+
+// Washout is one media change of -washout: at the end of frame Frame each cell loses
+// VirionFraction of its virions and DIPFraction of its DIPs
+type Washout struct {
+	Frame          int
+	VirionFraction float64
+	DIPFraction    float64
+}
+
+// Function to parse "t=1:virionFraction=1.0:dipFraction=1.0;..." into washout events
+func parseWashouts(text string) ([]Washout, error) {
+	var events []Washout
+	for _, entry := range strings.Split(text, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		event := Washout{Frame: -1}
+		for _, part := range strings.Split(entry, ":") {
+			kv := strings.SplitN(part, "=", 2)
+			if len(kv) != 2 {
+				return nil, fmt.Errorf("washout %q: %q is not key=value", entry, part)
+			}
+			key, value := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+			var err error
+			switch key {
+			case "t":
+				event.Frame, err = strconv.Atoi(value)
+			case "virionFraction":
+				event.VirionFraction, err = strconv.ParseFloat(value, 64)
+			case "dipFraction":
+				event.DIPFraction, err = strconv.ParseFloat(value, 64)
+			default:
+				return nil, fmt.Errorf("washout %q: unknown key %q (use t, virionFraction, dipFraction)", entry, key)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("washout %q: bad value in %q: %v", entry, part, err)
+			}
+		}
+		if event.Frame < 0 {
+			return nil, fmt.Errorf("washout %q: needs t >= 0", entry)
+		}
+		if event.VirionFraction < 0 || event.VirionFraction > 1 || event.DIPFraction < 0 || event.DIPFraction > 1 {
+			return nil, fmt.Errorf("washout %q: fractions must be in [0,1]", entry)
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// Function to keep (1-fraction) of n particles, rounding the fractional part stochastically
+func washoutKeep(rng *rand.Rand, n int, fraction float64) int {
+	if n <= 0 || fraction <= 0 {
+		return n
+	}
+	expected := float64(n) * (1 - fraction)
+	keep := int(math.Floor(expected))
+	if rng.Float64() < expected-float64(keep) {
+		keep++
+	}
+	return keep
+}
+
+// Function to apply the -washout events of this frame to every cell's free virions and DIPs,
+// after the frame's update. Events at the same frame compose; cell states are not touched.
+func (g *Grid) applyWashouts(frameNum int) {
+	g.washedVirions, g.washedDIPs = 0, 0
+	for _, event := range washouts {
+		if event.Frame != frameNum {
+			continue
+		}
+		for i := 0; i < GRID_SIZE; i++ {
+			for j := 0; j < GRID_SIZE; j++ {
+				v := washoutKeep(g.rng, g.localVirions[i][j], event.VirionFraction)
+				d := washoutKeep(g.rng, g.localDips[i][j], event.DIPFraction)
+				g.washedVirions += g.localVirions[i][j] - v
+				g.washedDIPs += g.localDips[i][j] - d
+				g.localVirions[i][j], g.localDips[i][j] = v, d
+			}
+		}
+		fmt.Printf("🚿 Washout at frame %d: virionFraction=%g, dipFraction=%g\n", frameNum, event.VirionFraction, event.DIPFraction)
+	}
+}
+
+// powCache memoizes math.Pow(base, n) for small integer n, one table per distinct base. The
+// cached values are the math.Pow results themselves, so lookups are exactly equal to recomputing.
+type powCache struct {
+	bound  int
+	tables map[float64][]float64
+}
+
+// Function to clear the cache at the start of a frame (bases change with the IFN field)
+func (c *powCache) reset(bound int) {
+	c.bound = bound
+	if c.tables == nil || len(c.tables) > 0 {
+		c.tables = make(map[float64][]float64)
+	}
+}
+
+// Function to return base^n, from the table when n <= bound. Non-finite bases bypass the
+// table: NaN never equals itself as a map key, so every NaN lookup would add a new entry.
+func (c *powCache) pow(base float64, n int) float64 {
+	if n < 0 || n > c.bound || c.tables == nil || math.IsNaN(base) || math.IsInf(base, 0) {
+		return math.Pow(base, float64(n))
+	}
+	table := c.tables[base]
+	for len(table) <= n {
+		table = append(table, math.NaN()) // not computed yet
+	}
+	c.tables[base] = table
+	if math.IsNaN(table[n]) {
+		table[n] = math.Pow(base, float64(n))
+	}
+	return table[n]
+}
+
+// ifnRowSums holds per-row prefix sums of the IFN field, so the regional sum over the circular
+// IFN_wave_radius mask costs one subtraction per mask row instead of one addition per cell.
+// Callers set valid = false whenever IFNConcentration changes.
+type ifnRowSums struct {
+	valid  bool
+	rows   [][3]int                          // mask rows {di, djMin, djMax} of precomputeIFNArea(IFN_wave_radius)
+	prefix [GRID_SIZE][GRID_SIZE + 1]float64 // prefix[i][k] = sum of IFNConcentration[i][0..k-1]
+}
+
+// Function to group the circular IFN mask into rows of contiguous dj offsets
+func ifnMaskRows(radius int) [][3]int {
+	byRow := make(map[int][2]int)
+	for _, offset := range precomputeIFNArea(radius) {
+		span, ok := byRow[offset[0]]
+		if !ok {
+			span = [2]int{offset[1], offset[1]}
+		}
+		if offset[1] < span[0] {
+			span[0] = offset[1]
+		}
+		if offset[1] > span[1] {
+			span[1] = offset[1]
+		}
+		byRow[offset[0]] = span
+	}
+	rows := make([][3]int, 0, len(byRow))
+	for di := -radius; di <= radius; di++ {
+		if span, ok := byRow[di]; ok {
+			rows = append(rows, [3]int{di, span[0], span[1]})
+		}
+	}
+	return rows
+}
+
+// Function to report whether a periodic IFN mask is wider than the grid, so that some cells
+// would fall in it twice; the deduplicated direct sum is used instead of summedarea then
+func ifnMaskWrapsOntoItself() bool {
+	return boundaryPeriodic && 2*IFN_wave_radius+1 > GRID_SIZE
+}
+
+// Function to (re)build the summedarea row prefix sums if the IFN field changed since the last build
+func (g *Grid) prepareIFNRowSums() {
+	s := &g.ifnRowSums
+	if s.rows == nil {
+		s.rows = ifnMaskRows(IFN_wave_radius)
+	}
+	if !s.valid {
+		for ri := 0; ri < GRID_SIZE; ri++ {
+			for rj := 0; rj < GRID_SIZE; rj++ {
+				s.prefix[ri][rj+1] = s.prefix[ri][rj] + g.IFNConcentration[ri][rj]
+			}
+		}
+		s.valid = true
+	}
+}
+
+// Function to return the average IFN concentration over the IFN area of (i,j)
+func (g *Grid) regionalIFNAverageAt(i, j int) float64 {
+	neighborsCount := len(g.neighborsIFNArea[i][j])
+	if neighborsCount == 0 {
+		return 0 // Default to 0 if no neighbors, though this should rarely occur
+	}
+	return g.regionalIFNSum(i, j) / float64(neighborsCount)
+}
+
+// Function to fill g.regionalIFNAverage for every cell, rows striped across workers goroutines
+// (0 = runtime.NumCPU()). Each cell only reads the IFN field, which nothing writes while this
+// runs, and its sum is taken in the same order as the serial pass, so the result is identical
+// for any worker count. The prefix sums are built before the workers start and only read by them.
+func (g *Grid) fillRegionalIFNAverages(workers int, fieldZero bool) {
+	if fieldZero {
+		g.regionalIFNAverage = [GRID_SIZE][GRID_SIZE]float64{}
+		return
+	}
+	if *flag_ifnComputeMethod != "direct" && !ifnMaskWrapsOntoItself() {
+		g.prepareIFNRowSums()
+	}
+	fillRows := func(first, step int) {
+		for i := first; i < GRID_SIZE; i += step {
+			for j := 0; j < GRID_SIZE; j++ {
+				if g.state[i][j] != UNEXPOSED {
+					g.regionalIFNAverage[i][j] = g.regionalIFNAverageAt(i, j)
+				}
+			}
+		}
+	}
+	stripeRows(workers, fillRows)
+}
+
+// Function to run rows(first, step) on workers goroutines (0 = runtime.NumCPU(), at most one per
+// row), each taking every step-th row from first, and wait for all of them. One worker runs
+// rows(0, 1) on the calling goroutine.
+func stripeRows(workers int, rows func(first, step int)) {
+	if workers == 0 {
+		workers = runtime.NumCPU()
+	}
+	if workers > GRID_SIZE {
+		workers = GRID_SIZE
+	}
+	if workers <= 1 {
+		rows(0, 1)
+		return
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(first int) {
+			defer wg.Done()
+			rows(first, workers)
+		}(w)
+	}
+	wg.Wait()
+}
+
+// Function to return the IFN summed over the IFN area of (i,j), using -ifnComputeMethod.
+// Both methods sum the same cells; summedarea differs from direct only by floating-point rounding.
+func (g *Grid) regionalIFNSum(i, j int) float64 {
+	if *flag_ifnComputeMethod == "direct" || ifnMaskWrapsOntoItself() {
+		sum := 0.0
+		for _, neighbor := range g.neighborsIFNArea[i][j] {
+			sum += g.IFNConcentration[neighbor[0]][neighbor[1]]
+		}
+		return sum
+	}
+
+	s := &g.ifnRowSums
+	g.prepareIFNRowSums()
+
+	sum := 0.0
+	for _, row := range s.rows {
+		if boundaryPeriodic {
+			// Split the wrapped span at the right edge; ifnMaskWrapsOntoItself rules out overlap
+			ri, lo, _ := wrapCell(i+row[0], j+row[1])
+			hi := lo + row[2] - row[1]
+			if hi < GRID_SIZE {
+				sum += s.prefix[ri][hi+1] - s.prefix[ri][lo]
+			} else {
+				sum += s.prefix[ri][GRID_SIZE] - s.prefix[ri][lo] + s.prefix[ri][hi-GRID_SIZE+1]
+			}
+			continue
+		}
+		ri := i + row[0]
+		if ri < 0 || ri >= GRID_SIZE {
+			continue
+		}
+		lo, hi := j+row[1], min(j+row[2], GRID_SIZE-1)
+		if lo < 0 {
+			lo = 0
+		}
+		if lo <= hi {
+			sum += s.prefix[ri][hi+1] - s.prefix[ri][lo]
+		}
+	}
+	return sum
+}
+
+// Function to return the virions at (i,j) that may infect this frame. With
+// -sameFrameInfection=forbid, particles deposited earlier in the same frame's scan are not
+// eligible: the count is capped at the frame-start population (removals are taken from the
+// newly deposited particles first). With allow, every particle present is eligible (legacy).
+func (g *Grid) infectiousVirions(i, j int) int {
+	if *flag_sameFrameInfection == "forbid" && g.virionsAtFrameStart[i][j] < g.localVirions[i][j] {
+		return g.virionsAtFrameStart[i][j]
+	}
+	return g.localVirions[i][j]
+}
+
+// Function to return the DIPs at (i,j) that may infect this frame (see infectiousVirions)
+func (g *Grid) infectiousDIPs(i, j int) int {
+	if *flag_sameFrameInfection == "forbid" && g.dipsAtFrameStart[i][j] < g.localDips[i][j] {
+		return g.dipsAtFrameStart[i][j]
+	}
+	return g.localDips[i][j]
+}
+
+// Function to check whether a frame is at or after the protocol's perturbation
+func isPerturbedFrame(frameNum int) bool {
+	return perturbFrame >= 0 && frameNum >= perturbFrame
+}
+
+// Function to check whether a frame falls inside the warm-up (burn-in) period
+func isBurnInFrame(frameNum int) bool {
+	return frameNum < burnIn
+}
+
+// SimulationSummary holds end-of-run endpoints written to summary.json.
+// Warm-up frames (frameNum < burnIn) are not included in any endpoint.
+type SimulationSummary struct {
+	BurnInHours             int         `json:"burn_in_hours"`
+	TimeSteps               int         `json:"time_steps"`
+	FramesIncluded          int         `json:"frames_included"`
+	PeakInfectedPercentage  float64     `json:"peak_infected_percentage"`
+	PeakInfectedTime        int         `json:"peak_infected_time"`
+	MaxAntiviralPercentage  float64     `json:"max_antiviral_percentage"`
+	MaxGlobalIFNPerCell     float64     `json:"max_global_ifn_per_cell"`
+	FinalDeadPercentage     float64     `json:"final_dead_percentage"`
+	FinalInfectedPercentage float64     `json:"final_infected_percentage"`
+	FinalPlaquePercentage   float64     `json:"final_plaque_percentage"`
+	FinalTotalVirions       int         `json:"final_total_virions"` // extracellular virions at the last frame
+	PeakDIPOnlyPercentage   float64     `json:"peak_dip_only_percentage"`
+	PerturbationTime        int         `json:"perturbation_time"`         // frame the -perturb changes were applied (-1 if none)
+	ReffTurnoverTime        int         `json:"reff_turnover_time"`        // first frame R_eff_crude drops below 1 (-1 if never)
+	ReffCohortTurnoverTime  int         `json:"reff_cohort_turnover_time"` // same for the complete cohorts' R_eff_cohort (-1 if never or without -lineage)
+	StateHash               string      `json:"state_hash"`                // SHA-256 of the final grid state (reproducibility check)
+	AUCWindows              []AUCWindow `json:"auc_windows,omitempty"`
+
+	DIPRescuedPercentage float64        `json:"dip_rescued_percentage"`    // % of cells made ANTIVIRAL by DIP-dominated IFN, reached by virions, never infected
+	IFNDominantSource    map[string]int `json:"ifn_dominant_source_cells"` // final cell counts by dominant IFN source
+
+	FinalDIPOnlyCells      int     `json:"final_dip_only_cells"`      // DIP-only reservoir size at the last frame
+	FinalDIPOnlyPercentage float64 `json:"final_dip_only_percentage"` // same, as % of all cells
+	FinalDIPOnlyMoransI    float64 `json:"final_dip_only_morans_i"`   // spatial clustering of the reservoir (0 = random, >0 = clustered)
+
+	PartitionJumpFraction float64 `json:"partition_jump_fraction"` // fraction of partition-mode burst particles that jumped randomly (-1 if none)
+
+	DeadFrontRadius int `json:"dead_front_radius"` // outermost hex ring around the infection focus holding a DEAD cell at the last frame (-1 if none)
+
+	reffAboveOne bool      // R_eff_crude has been >= 1 at some included frame
+	virionSeries []float64 // total extracellular virions per frame (all frames, for AUC windows)
+	dipSeries    []float64 // total extracellular DIPs per frame (all frames, for AUC windows)
+
+	releasedVirionSeries []float64 // virions released during each frame (all frames, for AUC windows)
+	releasedDIPSeries    []float64 // DIPs released during each frame (all frames, for AUC windows)
+}
+
+// AUCWindow is the trapezoidal time-integral of extracellular particles over [Start, End] hours
+type AUCWindow struct {
+	Start     int     `json:"start_hour"`
+	End       int     `json:"end_hour"`
+	VirionAUC float64 `json:"virion_auc"` // virion-hours
+	DIPAUC    float64 `json:"dip_auc"`    // DIP-hours
+
+	// Same integral of the particles released per frame: the particles shed over the window,
+	// the closer analog of supernatant collected over it
+	ReleasedVirionAUC float64 `json:"released_virion_auc"`
+	ReleasedDIPAUC    float64 `json:"released_dip_auc"`
+}
+
+// Function to parse "0-24,24-48" into AUC windows. Both ends are inclusive frame times,
+// so adjacent windows share their boundary frame (as the trapezoid rule requires).
+func parseAUCWindows(text string) ([]AUCWindow, error) {
+	var windows []AUCWindow
+	for _, part := range strings.Split(text, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		bounds := strings.Split(part, "-")
+		if len(bounds) != 2 {
+			return nil, fmt.Errorf("window %q is not start-end", part)
+		}
+		start, err1 := strconv.Atoi(strings.TrimSpace(bounds[0]))
+		end, err2 := strconv.Atoi(strings.TrimSpace(bounds[1]))
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("window %q has non-integer hours", part)
+		}
+		if start < 0 || end <= start {
+			return nil, fmt.Errorf("window %q must satisfy 0 <= start < end", part)
+		}
+		if end/TIMESTEP >= TIME_STEPS {
+			return nil, fmt.Errorf("window %q ends after the last frame (%d)", part, TIME_STEPS-1)
+		}
+		if start/TIMESTEP < burnIn {
+			return nil, fmt.Errorf("window %q starts inside the burn-in period (%d h)", part, burnIn*TIMESTEP)
+		}
+		windows = append(windows, AUCWindow{Start: start, End: end})
+	}
+	return windows, nil
+}
+
+// Function to parse the -dumpStatesAt hours into the set of frames to dump ("all" = every frame)
+func parseDumpStatesAt(text string) (map[int]bool, error) {
+	frames := make(map[int]bool)
+	if strings.TrimSpace(text) == "all" {
+		for frame := 0; frame < TIME_STEPS; frame++ {
+			frames[frame] = true
+		}
+		return frames, nil
+	}
+	for _, part := range strings.Split(text, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		hour, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, fmt.Errorf("hour %q is not an integer", part)
+		}
+		if hour < 0 || hour%TIMESTEP != 0 || hour/TIMESTEP >= TIME_STEPS {
+			return nil, fmt.Errorf("hour %d is not a frame of this run (0..%d)", hour, (TIME_STEPS-1)*TIMESTEP)
+		}
+		frames[hour/TIMESTEP] = true
+	}
+	return frames, nil
+}
+
+// Function to integrate a per-frame series over [start, end] hours with the trapezoid rule
+func trapezoidAUC(series []float64, start, end int) float64 {
+	area := 0.0
+	for t := start / TIMESTEP; t < end/TIMESTEP && t+1 < len(series); t++ {
+		area += 0.5 * (series[t] + series[t+1]) * float64(TIMESTEP)
+	}
+	return area
+}
+
+func newSimulationSummary() *SimulationSummary {
+	return &SimulationSummary{
+		BurnInHours:            burnIn * TIMESTEP,
+		TimeSteps:              TIME_STEPS,
+		PeakInfectedTime:       -1,
+		ReffTurnoverTime:       -1,
+		ReffCohortTurnoverTime: -1,
+		PerturbationTime:       perturbFrame,
+	}
+}
+
+// Function to fold the current frame into the summary endpoints (warm-up frames are skipped)
+func (s *SimulationSummary) observe(g *Grid, frameNum int) {
+	s.virionSeries = append(s.virionSeries, float64(g.totalVirions()))
+	s.dipSeries = append(s.dipSeries, float64(g.totalDIPs()))
+	s.releasedVirionSeries = append(s.releasedVirionSeries, float64(g.releasedVirionsNow))
+	s.releasedDIPSeries = append(s.releasedDIPSeries, float64(g.releasedDIPsNow))
+
+	if isBurnInFrame(frameNum) {
+		return
+	}
+	s.FramesIncluded++
+
+	infected := g.calculateInfectedPercentage()
+	if s.PeakInfectedTime < 0 || infected > s.PeakInfectedPercentage {
+		s.PeakInfectedPercentage = infected
+		s.PeakInfectedTime = frameNum
+	}
+	if dipOnly := g.calculateInfectedDIPOnlyPercentage(); dipOnly > s.PeakDIPOnlyPercentage {
+		s.PeakDIPOnlyPercentage = dipOnly
+	}
+	if antiviral := g.calculateAntiviralPercentage(); antiviral > s.MaxAntiviralPercentage {
+		s.MaxAntiviralPercentage = antiviral
+	}
+	if ifnPerCell := globalIFN / float64(GRID_SIZE*GRID_SIZE); ifnPerCell > s.MaxGlobalIFNPerCell {
+		s.MaxGlobalIFNPerCell = ifnPerCell
+	}
+	s.FinalDeadPercentage = calculateDeadCellPercentage(g.state)
+	s.FinalInfectedPercentage = infected
+	s.FinalPlaquePercentage = g.calculatePlaquePercentage()
+	s.FinalTotalVirions = g.totalVirions()
+
+	// Epidemic turnover: first time R_eff drops below 1 after having been >= 1
+	if reff, ok := g.crudeReff(frameNum); ok && s.ReffTurnoverTime < 0 {
+		if reff >= 1 {
+			s.reffAboveOne = true
+		} else if s.reffAboveOne {
+			s.ReffTurnoverTime = frameNum
+		}
+	}
+}
+
+// Function to compute the particle AUC for each configured window and write windows.csv
+func (s *SimulationSummary) computeAUCWindows(outputFolder string) {
+	if len(aucWindows) == 0 {
+		return
+	}
+	s.AUCWindows = make([]AUCWindow, len(aucWindows))
+	for idx, w := range aucWindows {
+		w.VirionAUC = trapezoidAUC(s.virionSeries, w.Start, w.End)
+		w.DIPAUC = trapezoidAUC(s.dipSeries, w.Start, w.End)
+		w.ReleasedVirionAUC = trapezoidAUC(s.releasedVirionSeries, w.Start, w.End)
+		w.ReleasedDIPAUC = trapezoidAUC(s.releasedDIPSeries, w.Start, w.End)
+		s.AUCWindows[idx] = w
+	}
+
+	windowsPath := filepath.Join(outputFolder, "windows.csv")
+	file, err := os.Create(windowsPath)
+	if err != nil {
+		log.Printf("Failed to create windows CSV: %v", err)
+		return
+	}
+	defer file.Close()
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+	writer.Write([]string{"start_hour", "end_hour", "virion_auc", "dip_auc", "released_virion_auc", "released_dip_auc"})
+	for _, w := range s.AUCWindows {
+		writer.Write([]string{
+			strconv.Itoa(w.Start),
+			strconv.Itoa(w.End),
+			strconv.FormatFloat(w.VirionAUC, 'f', 6, 64),
+			strconv.FormatFloat(w.DIPAUC, 'f', 6, 64),
+			strconv.FormatFloat(w.ReleasedVirionAUC, 'f', 6, 64),
+			strconv.FormatFloat(w.ReleasedDIPAUC, 'f', 6, 64),
+		})
+	}
+}
+
+// Function to write the summary endpoints to summary.json in the output folder
+func (s *SimulationSummary) save(outputFolder string) {
+	summaryPath := filepath.Join(outputFolder, "summary.json")
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		log.Printf("Failed to encode summary: %v", err)
+		return
+	}
+	if err := ioutil.WriteFile(summaryPath, data, 0644); err != nil {
+		log.Printf("Failed to write summary: %v", err)
+		return
+	}
+	fmt.Printf("Saved summary: %s\n", summaryPath)
+}
+
+// Errors returned by Run; main maps each to a process exit code
+var (
+	ErrInvalidConfig = errors.New("invalid configuration")
+	ErrOutputIO      = errors.New("output I/O failed")
+	ErrRenderFailure = errors.New("rendering failed")
+	ErrDiverged      = errors.New("run diverges from baseline")
+	ErrCrashed       = errors.New("simulation panicked")
+	ErrConservation  = errors.New("particle conservation violated")
+)
+
+// Config maps flag names to values, in the same layout as the "flags" object of params.json.
+// Flags missing from the map take their default value.
+type Config map[string]string
+
+// RunOptions controls where and how much a Run writes, independent of the simulation parameters
+type RunOptions struct {
+	OutputRoot string // directory the numbered run folder is created in ("./" if empty)
+	SkipPlots  bool   // skip the comparison plots written after the run
+}
+
+// RunResult describes a finished Run
+type RunResult struct {
+	OutputFolder string
+	Summary      SimulationSummary
+	Warnings     []string
+	Baseline     *BaselineDiff // nil unless -baseline was set
+}
+
+// Function to build a Config from the flags set on the command line
+func configFromFlags() Config {
+	cfg := make(Config)
+	flag.Visit(func(f *flag.Flag) {
+		cfg[f.Name] = f.Value.String()
+	})
+	return cfg
+}
+
+// Function to read a -config JSON file into a Config. Values may be strings, numbers or
+// booleans; keys that are not flags are skipped and reported as warnings.
+func loadConfigFile(path string) (Config, []string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: cannot read config file: %v", ErrInvalidConfig, err)
+	}
+	defer file.Close()
+	decoder := json.NewDecoder(file)
+	decoder.UseNumber() // keep numbers as written, e.g. 1e-9 or 50
+	var raw map[string]interface{}
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, nil, fmt.Errorf("%w: cannot parse config file %s: %v", ErrInvalidConfig, path, err)
+	}
+
+	cfg := make(Config)
+	var warnings []string
+	for name, value := range raw {
+		if name == "config" || flag.Lookup(name) == nil {
+			warnings = append(warnings, fmt.Sprintf("config file %s: unknown key %q ignored", path, name))
+			continue
+		}
+		switch v := value.(type) {
+		case string:
+			cfg[name] = v
+		case json.Number:
+			cfg[name] = v.String()
+		case bool:
+			cfg[name] = strconv.FormatBool(v)
+		default:
+			return nil, nil, fmt.Errorf("%w: config file %s: %q must be a string, number or boolean", ErrInvalidConfig, path, name)
+		}
+	}
+	sort.Strings(warnings)
+	return cfg, warnings, nil
+}
+
+// Function to set every flag from cfg, resetting flags missing from cfg to their default
+func applyConfig(cfg Config) error {
+	for name := range cfg {
+		if flag.Lookup(name) == nil {
+			return fmt.Errorf("%w: unknown flag %q", ErrInvalidConfig, name)
+		}
+	}
+	var err error
+	flag.VisitAll(func(f *flag.Flag) {
+		// go test registers its own test.* flags on the same flag set
+		if err != nil || strings.HasPrefix(f.Name, "test.") {
+			return
+		}
+		value, ok := cfg[f.Name]
+		if !ok {
+			value = f.DefValue
+		}
+		if value == f.Value.String() {
+			return
+		}
+		if setErr := f.Value.Set(value); setErr != nil {
+			err = fmt.Errorf("%w: -%s=%s: %v", ErrInvalidConfig, f.Name, value, setErr)
+		}
+	})
+	return err
+}
+
+// Function to reset the package-level state a previous Run leaves behind: the run totals, the
+// global IFN and the parameters that only some flag values assign (noIFN zeroes ALPHA and the
+// IFN delays, -warmupSteps sets the perturbation frame, partition sets par_celltocell_random)
+func resetRunState() {
+	totalDeadFromV, totalDeadFromBoth = 0, 0
+	globalIFN, maxGlobalIFN, globalIFNperCell = -1.0, -1.0, 0.0
+	adjusted_DIP_IFN_stimulate, perParticleInfectionChance_V, dipAdvantage = 0, 0, 0
+	ALPHA, IFN_DELAY, STD_IFN_DELAY = 1.0, 5, 1
+	perturbFrame, perturbation = -1, nil
+	par_celltocell_random = false
+}
+
+// Function to run one simulation with the given configuration. Run reads and writes the
+// package-level simulation state, so calls must not overlap.
+func Run(cfg Config, opts RunOptions) (result RunResult, err error) {
+	if err := applyConfig(cfg); err != nil {
+		return result, err
+	}
+	resetRunState()
+	runWarnings = nil
+	warnedOnce = make(map[string]bool)
+	for _, h := range []*HalfLife{flag_virion_half_life, flag_dip_half_life, flag_ifn_half_life} {
+		if h.Legacy {
+			runWarnings = append(runWarnings, fmt.Sprintf("-%s=%s has no unit; assumed hours", h.Name, h.Raw))
+		}
+	}
+	defer func() { result.Warnings = runWarnings }()
+
+	fmt.Printf("Parsed ifnSpreadOption: %q\n", *flag_ifnSpreadOption)
+	fmt.Printf("Parsed particleSpreadOption: %q\n", *flag_particleSpreadOption)
+
+	// Assign parsed flag values to global variables (note dereferencing)
+	BURST_SIZE_V = *flag_burstSizeV
+	BURST_SIZE_D = *flag_burstSizeD
+	MEAN_LYSIS_TIME = *flag_meanLysisTime
+	STANDARD_LYSIS_TIME = MEAN_LYSIS_TIME / 4
+	MEAN_DVG_RECOVERY_TIME = *flag_dvgRecoveryTime
+	STANDARD_DVG_RECOVERY_TIME = MEAN_DVG_RECOVERY_TIME / 3 // 3±1 hours, so std = 1
+	k_JumpR = *flag_kJumpR
+	TAU = *flag_tau
+	ifnBothFold = *flag_ifnBothFold
+	RHO = *flag_rho
+	lambdaDip = *flag_lambdaDip
+	option = *flag_option
+
+	// Special parameter overrides for case 4
+	if option == 4 {
+
+		STANDARD_LYSIS_TIME = MEAN_LYSIS_TIME / 4 // Recalculate standard deviation
+	}
+
+	virion_half_life = flag_virion_half_life.Hours
+	dip_half_life = flag_dip_half_life.Hours
+	ifn_half_life = flag_ifn_half_life.Hours
+
+	particleSpreadOption = *flag_particleSpreadOption
+	ifnSpreadOption = *flag_ifnSpreadOption
+	dipOption = *flag_dipOption
+	// Recalculate dependent parameters (note that ifnBothFold is now float64, not *float64)
+	D_only_IFN_stimulate_ratio = 5.0 * ifnBothFold
+	BOTH_IFN_stimulate_ratio = 10.0 * ifnBothFold
+	videotype = *flag_videotype
+	if *flag_supersample < 1 || *flag_supersample > 8 {
+		return result, fmt.Errorf("%w: supersample must be between 1 and 8, got %d", ErrInvalidConfig, *flag_supersample)
+	}
+	if *flag_snapshotScale < 1 || *flag_snapshotScale > 8 {
+		return result, fmt.Errorf("%w: snapshotScale must be between 1 and 8, got %d", ErrInvalidConfig, *flag_snapshotScale)
+	}
+	if *flag_ifnResponderFraction < 0 || *flag_ifnResponderFraction > 1 {
+		return result, fmt.Errorf("%w: ifnResponderFraction must be between 0 and 1, got %g", ErrInvalidConfig, *flag_ifnResponderFraction)
+	}
+	if *flag_adsorptionVirion < 0 || *flag_adsorptionVirion > 1 || *flag_adsorptionDIP < 0 || *flag_adsorptionDIP > 1 {
+		return result, fmt.Errorf("%w: adsorptionVirion and adsorptionDIP must be between 0 and 1, got %g and %g", ErrInvalidConfig, *flag_adsorptionVirion, *flag_adsorptionDIP)
+	}
+	if *flag_renderFormat != "png" && *flag_renderFormat != "svg" {
+		return result, fmt.Errorf("%w: invalid renderFormat: %q (expected png or svg)", ErrInvalidConfig, *flag_renderFormat)
+	}
+	if *flag_palette != "default" && *flag_palette != "cividis" && *flag_palette != "okabe-ito" {
+		return result, fmt.Errorf("%w: invalid palette: %q (expected default, cividis or okabe-ito)", ErrInvalidConfig, *flag_palette)
+	}
+	paletteOverrides = nil
+	if *flag_paletteFile != "" {
+		overrides, parseErr := parsePaletteFile(*flag_paletteFile)
+		if parseErr != nil {
+			return result, fmt.Errorf("%w: invalid paletteFile: %v", ErrInvalidConfig, parseErr)
+		}
+		paletteOverrides = overrides
+	}
+	if *flag_titerColorMax <= 0 {
+		return result, fmt.Errorf("%w: titerColorMax must be > 0, got %g", ErrInvalidConfig, *flag_titerColorMax)
+	}
+	if *flag_gifDelay < 1 {
+		return result, fmt.Errorf("%w: gifDelay must be >= 1, got %d", ErrInvalidConfig, *flag_gifDelay)
+	}
+	if *flag_antialias && *flag_snapshotScale < 2 {
+		return result, fmt.Errorf("%w: antialias needs -snapshotScale >= 2", ErrInvalidConfig)
+	}
+	if *flag_cellMicrons < 0 {
+		return result, fmt.Errorf("%w: cellMicrons must be >= 0, got %g", ErrInvalidConfig, *flag_cellMicrons)
+	}
+
+	// Exposure mask: enforce baltes-only activation
+	if videotype != "baltes" {
+		*flag_unexposedAreaFraction = 0.0
+	}
+	fmt.Printf("Exposure mask (uniform) fraction = %.3f (baltes-only)\n", *flag_unexposedAreaFraction)
+
+	// Parse viral particle removal experiment parameters
+	enableParticleRemoval = *flag_enableParticleRemoval
+	ifnThreshold = *flag_ifnThreshold
+	removalTimepoint = *flag_removalTimepoint
+	removeVirionAndDIP = *flag_removeVirionAndDIP
+
+	// VIRION-only burst mode
+	virionBurstMode = *flag_virionBurstMode
+	if virionBurstMode != "both" && virionBurstMode != "virionOnly" {
+		return result, fmt.Errorf("%w: unknown virionBurstMode: %s (expected 'both' or 'virionOnly')", ErrInvalidConfig, virionBurstMode)
+	}
+
+	// Parse random seed parameter
+	randomSeed = *flag_randomSeed
+
+	// States allowed to become ANTIVIRAL
+	if *flag_antiviralCommitModel != "legacy" && *flag_antiviralCommitModel != "ifnDependent" {
+		return result, fmt.Errorf("%w: invalid antiviralCommitModel: %q (expected legacy or ifnDependent)", ErrInvalidConfig, *flag_antiviralCommitModel)
+	}
+	if *flag_antiviralIFNThreshold < 0 || *flag_antiviralDuration < 0 || *flag_antiviralDurationStd < 0 {
+		return result, fmt.Errorf("%w: antiviralIFNThreshold, antiviralDuration and antiviralDurationStd must be >= 0, got %g, %g and %g",
+			ErrInvalidConfig, *flag_antiviralIFNThreshold, *flag_antiviralDuration, *flag_antiviralDurationStd)
+	}
+	if *flag_regrowthModel != "timer" && *flag_regrowthModel != "edgePressure" {
+		return result, fmt.Errorf("%w: invalid regrowthModel: %q (expected timer or edgePressure)", ErrInvalidConfig, *flag_regrowthModel)
+	}
+	if *flag_regrowthEdgeRate < 0 || *flag_regrowthEdgeRate > 1 {
+		return result, fmt.Errorf("%w: regrowthEdgeRate must be between 0 and 1, got %g", ErrInvalidConfig, *flag_regrowthEdgeRate)
+	}
+	if *flag_regrowthMaturationTime < 0 || *flag_regrowthMaturationStd < 0 {
+		return result, fmt.Errorf("%w: regrowthMaturationTime and regrowthMaturationStd must be >= 0, got %g and %g",
+			ErrInvalidConfig, *flag_regrowthMaturationTime, *flag_regrowthMaturationStd)
+	}
+	if *flag_antiviralExitState != "SUSCEPTIBLE" && *flag_antiviralExitState != "REGROWTH" {
+		return result, fmt.Errorf("%w: invalid antiviralExitState: %q (expected SUSCEPTIBLE or REGROWTH)", ErrInvalidConfig, *flag_antiviralExitState)
+	}
+	eligible, parseErr := parseStateList(*flag_antiviralEligibleStates)
+	if parseErr != nil {
+		return result, fmt.Errorf("%w: invalid antiviralEligibleStates: %v", ErrInvalidConfig, parseErr)
+	}
+	antiviralEligible = eligible
+	for s := range antiviralEligible {
+		if !isInfectableState(s) && !isInfectedDIPOnly(s) {
+			return result, fmt.Errorf("%w: invalid antiviralEligibleStates: %s cannot become ANTIVIRAL", ErrInvalidConfig, stateNames[s])
+		}
+	}
+
+	// Warm-up period (hours == frames since TIMESTEP = 1)
+	burnIn = *flag_burnIn / TIMESTEP
+	if burnIn < 0 || burnIn >= TIME_STEPS {
+		return result, fmt.Errorf("%w: invalid burnIn: %d (expected 0 <= burnIn < TIME_STEPS=%d)", ErrInvalidConfig, *flag_burnIn, TIME_STEPS)
+	}
+
+	// AUC windows (validated against TIME_STEPS and burnIn)
+	windows, parseErr := parseAUCWindows(*flag_aucWindows)
+	if parseErr != nil {
+		return result, fmt.Errorf("%w: invalid aucWindows: %v", ErrInvalidConfig, parseErr)
+	}
+	aucWindows = windows
+
+	// Grid dump hours (validated against TIME_STEPS)
+	dumpFrames, parseErr := parseDumpStatesAt(*flag_dumpStatesAt)
+	if parseErr != nil {
+		return result, fmt.Errorf("%w: invalid dumpStatesAt: %v", ErrInvalidConfig, parseErr)
+	}
+	if *flag_snapshotEvery < 0 {
+		return result, fmt.Errorf("%w: snapshotEvery must be >= 0, got %d", ErrInvalidConfig, *flag_snapshotEvery)
+	}
+	for frame := 0; *flag_snapshotEvery > 0 && frame < TIME_STEPS; frame += *flag_snapshotEvery {
+		dumpFrames[frame] = true
+	}
+	dumpStatesAt = dumpFrames
+	if *flag_dumpField < 0 {
+		return result, fmt.Errorf("%w: dumpField must be >= 0, got %d", ErrInvalidConfig, *flag_dumpField)
+	}
+	if *flag_plaquesEvery < 0 || *flag_radialEvery < 0 {
+		return result, fmt.Errorf("%w: plaquesEvery and radialEvery must be >= 0, got %d and %d", ErrInvalidConfig, *flag_plaquesEvery, *flag_radialEvery)
+	}
+	if *flag_checkpointEvery < 0 {
+		return result, fmt.Errorf("%w: checkpointEvery must be >= 0, got %d", ErrInvalidConfig, *flag_checkpointEvery)
+	}
+
+	if *flag_eclipsePeriod < 0 || *flag_eclipseStd < 0 {
+		return result, fmt.Errorf("%w: eclipsePeriod and eclipseStd must be >= 0, got %g and %g", ErrInvalidConfig, *flag_eclipsePeriod, *flag_eclipseStd)
+	}
+	if *flag_infectionModel != "bernoulli" && *flag_infectionModel != "poisson" {
+		return result, fmt.Errorf("%w: invalid infectionModel: %q (expected bernoulli or poisson)", ErrInvalidConfig, *flag_infectionModel)
+	}
+	if *flag_lambdaDip < 0 {
+		return result, fmt.Errorf("%w: lambdaDip must be >= 0, got %g", ErrInvalidConfig, *flag_lambdaDip)
+	}
+	if *flag_depositPolicy != "all" && *flag_depositPolicy != "live" && *flag_depositPolicy != "susceptible" {
+		return result, fmt.Errorf("%w: invalid depositPolicy: %q (expected all, live or susceptible)", ErrInvalidConfig, *flag_depositPolicy)
+	}
+	if *flag_ifnResponse != "exp" && *flag_ifnResponse != "hill" {
+		return result, fmt.Errorf("%w: invalid ifnResponse: %q (expected exp or hill)", ErrInvalidConfig, *flag_ifnResponse)
+	}
+	if *flag_ifnHillK <= 0 || *flag_ifnHillN <= 0 {
+		return result, fmt.Errorf("%w: ifnHillK and ifnHillN must be > 0, got %g and %g", ErrInvalidConfig, *flag_ifnHillK, *flag_ifnHillN)
+	}
+	if *flag_burstModel != "fixed" && *flag_burstModel != "competition" {
+		return result, fmt.Errorf("%w: invalid burstModel: %q (expected fixed or competition)", ErrInvalidConfig, *flag_burstModel)
+	}
+	if *flag_burstCompetition < 0 {
+		return result, fmt.Errorf("%w: burstCompetition must be >= 0, got %g", ErrInvalidConfig, *flag_burstCompetition)
+	}
+	switch *flag_burstKernel {
+	case "auto", kernelInverseEuclid, kernelHexInverse15, kernelLegacySqrt3:
+	default:
+		return result, fmt.Errorf("%w: invalid burstKernel: %q (expected auto, inverseEuclid, hexInverse15 or legacySqrt3)", ErrInvalidConfig, *flag_burstKernel)
+	}
+	if *flag_dipBurstShape != "disk" && *flag_dipBurstShape != "annulus" {
+		return result, fmt.Errorf("%w: invalid dipBurstShape: %q (expected disk or annulus)", ErrInvalidConfig, *flag_dipBurstShape)
+	}
+	if *flag_dipBurstShape == "annulus" {
+		outer := *flag_dipOuterRadius
+		if outer < 0 {
+			outer = *flag_dipRadius
+		}
+		if *flag_dipInnerRadius < 1 || *flag_dipInnerRadius > outer {
+			return result, fmt.Errorf("%w: invalid DIP annulus: dipInnerRadius=%d, outer radius %d (expected 1 <= inner <= outer)", ErrInvalidConfig, *flag_dipInnerRadius, outer)
+		}
+	}
+	if *flag_driftStrength < 0 || *flag_driftStrength > 1 || math.IsNaN(*flag_driftStrength) {
+		return result, fmt.Errorf("%w: driftStrength must be in [0,1], got %g", ErrInvalidConfig, *flag_driftStrength)
+	}
+	if burstCompetition() && *flag_continuousMode {
+		return result, fmt.Errorf("%w: -burstModel=competition applies to burst lysis and cannot be combined with -continuousMode", ErrInvalidConfig)
+	}
+	if *flag_numImmuneCells < 0 || *flag_immuneIFNBias < 0 {
+		return result, fmt.Errorf("%w: numImmuneCells and immuneIFNBias must be >= 0, got %d and %g", ErrInvalidConfig, *flag_numImmuneCells, *flag_immuneIFNBias)
+	}
+	if *flag_immuneKillProb < 0 || *flag_immuneKillProb > 1 {
+		return result, fmt.Errorf("%w: immuneKillProb must be in [0, 1], got %g", ErrInvalidConfig, *flag_immuneKillProb)
+	}
+	if *flag_susceptibilityCV < 0 {
+		return result, fmt.Errorf("%w: susceptibilityCV must be >= 0, got %g", ErrInvalidConfig, *flag_susceptibilityCV)
+	}
+	rhoSigma, parseErr := parseRhoDistribution(*flag_rhoDistribution)
+	if parseErr != nil {
+		return result, fmt.Errorf("%w: invalid rhoDistribution: %v", ErrInvalidConfig, parseErr)
+	}
+	if rhoSigma > 0 && *flag_susceptibilityCV > 0 {
+		return result, fmt.Errorf("%w: -rhoDistribution and -susceptibilityCV both set a per-cell RHO field; use one", ErrInvalidConfig)
+	}
+	if *flag_rhoOnRegrowth != "keep" && *flag_rhoOnRegrowth != "resample" {
+		return result, fmt.Errorf("%w: invalid rhoOnRegrowth: %q (expected keep or resample)", ErrInvalidConfig, *flag_rhoOnRegrowth)
+	}
+	susceptibilitySigma, susceptibilityNormalized = rhoSigma, rhoSigma > 0
+	if cv := *flag_susceptibilityCV; cv > 0 {
+		susceptibilitySigma = math.Sqrt(math.Log(1 + cv*cv))
+	}
+	if *flag_superinfectionExclusionHours < 0 {
+		return result, fmt.Errorf("%w: superinfectionExclusionHours must be >= 0, got %g", ErrInvalidConfig, *flag_superinfectionExclusionHours)
+	}
+	if *flag_workers < 0 {
+		return result, fmt.Errorf("%w: workers must be >= 0, got %d", ErrInvalidConfig, *flag_workers)
+	}
+	if *flag_powCacheBound < 0 {
+		return result, fmt.Errorf("%w: powCacheBound must be >= 0, got %d", ErrInvalidConfig, *flag_powCacheBound)
+	}
+	if *flag_ifnModel != "spread" && *flag_ifnModel != "diffusion" {
+		return result, fmt.Errorf("%w: invalid ifnModel: %q (expected spread or diffusion)", ErrInvalidConfig, *flag_ifnModel)
+	}
+	if *flag_ifnModel == "diffusion" && *flag_ifnSpreadOption != "local" {
+		return result, fmt.Errorf("%w: -ifnModel=diffusion needs -ifnSpreadOption=local, got %q", ErrInvalidConfig, *flag_ifnSpreadOption)
+	}
+	if *flag_ifnDiffusionCoeff < 0 || math.IsNaN(*flag_ifnDiffusionCoeff) || math.IsInf(*flag_ifnDiffusionCoeff, 0) {
+		return result, fmt.Errorf("%w: ifnDiffusionCoeff must be finite and >= 0, got %g", ErrInvalidConfig, *flag_ifnDiffusionCoeff)
+	}
+	if *flag_ifnDecay != "perStep" && *flag_ifnDecay != "perCell" {
+		return result, fmt.Errorf("%w: invalid ifnDecay: %q (expected perStep or perCell)", ErrInvalidConfig, *flag_ifnDecay)
+	}
+	// perCell only reproduces runs from before -ifnModel; diffusion decays the field once per step
+	if *flag_ifnDecay == "perCell" && *flag_ifnModel == "diffusion" {
+		return result, fmt.Errorf("%w: -ifnDecay=perCell cannot be combined with -ifnModel=diffusion", ErrInvalidConfig)
+	}
+	if *flag_sameFrameInfection != "forbid" && *flag_sameFrameInfection != "allow" {
+		return result, fmt.Errorf("%w: invalid sameFrameInfection: %q (expected forbid or allow)", ErrInvalidConfig, *flag_sameFrameInfection)
+	}
+	if *flag_dipPersistence != "clear" && *flag_dipPersistence != "persist" {
+		return result, fmt.Errorf("%w: invalid dipPersistence: %q (expected clear or persist)", ErrInvalidConfig, *flag_dipPersistence)
+	}
+	if *flag_dipClearanceModel != "both" && *flag_dipClearanceModel != "fixedNormal" && *flag_dipClearanceModel != "recoveryTime" {
+		return result, fmt.Errorf("%w: invalid dipClearanceModel: %q (expected both, fixedNormal or recoveryTime)", ErrInvalidConfig, *flag_dipClearanceModel)
+	}
+	if *flag_dipClearanceStd < 0 {
+		return result, fmt.Errorf("%w: dipClearanceStd must be >= 0, got %g", ErrInvalidConfig, *flag_dipClearanceStd)
+	}
+	if *flag_boundary != "open" && *flag_boundary != "absorbing" && *flag_boundary != "periodic" {
+		return result, fmt.Errorf("%w: invalid boundary: %q (expected open, absorbing or periodic)", ErrInvalidConfig, *flag_boundary)
+	}
+	if (*flag_focusX >= 0) != (*flag_focusY >= 0) || *flag_focusX >= GRID_SIZE || *flag_focusY >= GRID_SIZE {
+		return result, fmt.Errorf("%w: invalid focusX/focusY: %d,%d (expected both -1 or both in 0..%d)", ErrInvalidConfig, *flag_focusX, *flag_focusY, GRID_SIZE-1)
+	}
+	infectionFoci = nil
+	if *flag_option == 5 {
+		foci, err := parseFoci(*flag_foci)
+		if err != nil {
+			return result, fmt.Errorf("%w: invalid foci: %v", ErrInvalidConfig, err)
+		}
+		if len(foci) == 0 {
+			return result, fmt.Errorf("%w: option 5 needs at least one focus in -foci", ErrInvalidConfig)
+		}
+		for _, f := range foci {
+			if f.X < 0 || f.X >= GRID_SIZE || f.Y < 0 || f.Y >= GRID_SIZE {
+				return result, fmt.Errorf("%w: focus %d,%d outside the grid (expected 0..%d)", ErrInvalidConfig, f.X, f.Y, GRID_SIZE-1)
+			}
+			if f.V < 0 || f.D < 0 {
+				return result, fmt.Errorf("%w: focus %d,%d: v and d must be >= 0, got %g and %g", ErrInvalidConfig, f.X, f.Y, f.V, f.D)
+			}
+			if f.V == 0 && f.D == 0 {
+				return result, fmt.Errorf("%w: focus %d,%d seeds nothing (v and d are both 0)", ErrInvalidConfig, f.X, f.Y)
+			}
+		}
+		infectionFoci = foci
+	}
+	if *flag_yMax < 0 || math.IsNaN(*flag_yMax) {
+		return result, fmt.Errorf("%w: invalid yMax: %g (expected > 0, or 0 for the profile table)", ErrInvalidConfig, *flag_yMax)
+	}
+	boundaryPeriodic = *flag_boundary == "periodic"
+	if *flag_ifnComputeMethod != "direct" && *flag_ifnComputeMethod != "summedarea" {
+		return result, fmt.Errorf("%w: invalid ifnComputeMethod: %q (expected direct or summedarea)", ErrInvalidConfig, *flag_ifnComputeMethod)
+	}
+
+	doses, parseErr := parseDIPDoses(*flag_dipDose)
+	if parseErr != nil {
+		return result, fmt.Errorf("%w: invalid dipDose: %v", ErrInvalidConfig, parseErr)
+	}
+	for _, dose := range doses {
+		if dose.Frame >= TIME_STEPS {
+			return result, fmt.Errorf("%w: dipDose at t=%d is past the last frame %d", ErrInvalidConfig, dose.Frame, TIME_STEPS-1)
+		}
+		if dose.Mode == "hotspot" && (dose.X < 0 || dose.X >= GRID_SIZE || dose.Y < 0 || dose.Y >= GRID_SIZE) {
+			return result, fmt.Errorf("%w: dipDose hotspot %d,%d outside the grid (expected 0..%d)", ErrInvalidConfig, dose.X, dose.Y, GRID_SIZE-1)
+		}
+	}
+	dipDoses = doses
+	events, parseErr := parseWashouts(*flag_washout)
+	if parseErr != nil {
+		return result, fmt.Errorf("%w: invalid washout: %v", ErrInvalidConfig, parseErr)
+	}
+	for _, event := range events {
+		if event.Frame >= TIME_STEPS {
+			return result, fmt.Errorf("%w: washout at t=%d is past the last frame %d", ErrInvalidConfig, event.Frame, TIME_STEPS-1)
+		}
+	}
+	washouts = events
+
+	// Warmup-then-perturb protocol
+	steps, parseErr := parsePerturbation(*flag_perturb)
+	if parseErr != nil {
+		return result, fmt.Errorf("%w: invalid perturb: %v", ErrInvalidConfig, parseErr)
+	}
+	if *flag_warmupSteps < 0 || *flag_warmupSteps >= TIME_STEPS {
+		return result, fmt.Errorf("%w: invalid warmupSteps: %d (expected 0 <= warmupSteps < TIME_STEPS=%d)", ErrInvalidConfig, *flag_warmupSteps, TIME_STEPS)
+	}
+	if len(steps) > 0 && *flag_warmupSteps == 0 {
+		return result, fmt.Errorf("%w: -perturb needs -warmupSteps > 0", ErrInvalidConfig)
+	}
+	if *flag_warmupSteps > 0 {
+		perturbFrame = *flag_warmupSteps
+		perturbation = steps
+	}
+
+	fmt.Printf("flag_videotype = %q\n", *flag_videotype)
+	// Optional: print debug information
+	fmt.Printf("Parameters:\n  burstSizeV = %d\n  burstSizeD = %d\n  MEAN_LYSIS_TIME = %.2f\n  kJumpR = %.2f\n  TAU = %d\n  ifnBothFold = %.2f\n  RHO = %.3f\n par_celltocell_random = %v\n",
+		BURST_SIZE_V, BURST_SIZE_D, MEAN_LYSIS_TIME, k_JumpR, TAU, ifnBothFold, RHO, par_celltocell_random)
+
+	// Print viral particle removal experiment parameters
+	if enableParticleRemoval {
+		fmt.Printf("Viral Particle Removal Experiment Enabled:\n  ifnThreshold = %.3f\n  removalTimepoint = %d hours\n  removeVirionAndDIP = %v\n", ifnThreshold, removalTimepoint, removeVirionAndDIP)
+	}
+
+	// --- Particle Diffusion Options ---
+	particleSpreadOption = *flag_particleSpreadOption
+	if particleSpreadOption == "celltocell" {
+		jumpRadiusV = 0
+		jumpRadiusD = 0
+		jumpRandomly = false
+		// k_JumpR = 0.0
+		allowVirionJump = false
+		allowDIPJump = false
 		fmt.Println("flag main celltocell")
 	} else if particleSpreadOption == "jumprandomly" {
 		jumpRadiusV = 0
@@ -4305,436 +7016,1734 @@ func main() {
 		allowDIPJump = true    // Need to enable jumping
 		fmt.Println("DEBUG: par_celltocell_random set to", par_celltocell_random)
 
-		k_JumpR = *flag_kJumpR
-	} else {
-		log.Fatalf("Unknown particleSpreadOption: %s", particleSpreadOption)
+		k_JumpR = *flag_kJumpR
+		if k_JumpR < 0 || k_JumpR > 1 {
+			return result, fmt.Errorf("%w: invalid kJumpR: %.3f (expected 0 <= kJumpR <= 1 in partition mode)", ErrInvalidConfig, k_JumpR)
+		}
+		if *flag_partitionSemantics != "perBurst" && *flag_partitionSemantics != "perCell" {
+			return result, fmt.Errorf("%w: invalid partitionSemantics: %q (expected perBurst or perCell)", ErrInvalidConfig, *flag_partitionSemantics)
+		}
+		if *flag_partitionSemantics == "perBurst" {
+			// floor(kJumpR*burst) is what actually jumps; small bursts can round it far from kJumpR
+			effectiveV := math.Floor(float64(BURST_SIZE_V)*k_JumpR) / math.Max(float64(BURST_SIZE_V), 1)
+			fmt.Printf("  partition perBurst: kJumpR=%.3f, effective virion jump fraction per burst=%.3f\n", k_JumpR, effectiveV)
+			if k_JumpR > 0 && effectiveV == 0 {
+				warnOnce("partitionRounding", "partition: kJumpR=%.3f x burstSizeV=%d rounds down to 0, no virions will jump randomly", k_JumpR, BURST_SIZE_V)
+			}
+		}
+	} else {
+		return result, fmt.Errorf("%w: unknown particleSpreadOption: %s", ErrInvalidConfig, particleSpreadOption)
+	}
+	fmt.Println("\nParticle spread option settings:")
+	fmt.Printf("  particleSpreadOption: %s\n", particleSpreadOption)
+	fmt.Printf("  jumpRadiusV: %d, jumpRadiusD: %d, jumpRandomly: %v, k_JumpR: %.2f\n",
+		jumpRadiusV, jumpRadiusD, jumpRandomly, k_JumpR)
+
+	// --- IFN Propagation Options ---
+	ifnSpreadOption = *flag_ifnSpreadOption
+
+	switch ifnSpreadOption {
+
+	case "global":
+		IFN_wave_radius = 0
+		ifnWave = false
+		fmt.Printf("hello: ifnSpreadOption set to: %s, IFN_wave_radius: %d\n", ifnSpreadOption, IFN_wave_radius)
+
+	case "local":
+		IFN_wave_radius = 10
+		ifnWave = true
+		fmt.Printf("ummmm: ifnSpreadOption set to: %s, IFN_wave_radius: %d\n", ifnSpreadOption, IFN_wave_radius)
+
+	case "noIFN":
+		IFN_wave_radius = 0
+		// Disable IFN: set IFN-related parameters to zero
+		ifnBothFold = 0.0
+		// Additionally in the model, R, ALPHA, IFN_DELAY, STD_IFN_DELAY, tau, etc. can be set to zero
+		ifnWave = false
+		ALPHA = 0.0
+		IFN_DELAY = 0
+		STD_IFN_DELAY = 0
+		TAU = 0
+		ifn_half_life = 0.0
+	default:
+		return result, fmt.Errorf("%w: unknown ifnSpreadOption: %s", ErrInvalidConfig, ifnSpreadOption)
+
+	}
+	fmt.Println("\nIFN spread option settings:")
+	fmt.Printf("  ifnSpreadOption: %s, IFN_wave_radius: %d, ifnBothFold: %.2f\n",
+		ifnSpreadOption, IFN_wave_radius, ifnBothFold)
+	fmt.Printf("flag_ifnSpreadOption = %q\n", *flag_ifnSpreadOption)
+	// --- DIP Options ---
+	dipOption = *flag_dipOption
+	if dipOption {
+		BURST_SIZE_D = *flag_burstSizeD
+		// Keep D_only_IFN_stimulate_ratio default value
+	} else {
+		BURST_SIZE_D = 0
+		D_only_IFN_stimulate_ratio = 0.0
+	}
+	fmt.Println("\nDIP option settings:")
+	fmt.Printf("  dipOption: %v, BURST_SIZE_D: %d, D_only_IFN_stimulate_ratio: %.2f, BOTH_IFN_stimulate_ratio: %.2f\n",
+		dipOption, BURST_SIZE_D, D_only_IFN_stimulate_ratio, BOTH_IFN_stimulate_ratio)
+
+	// Simulation code can be integrated here later, this example only shows parameter setup
+	fmt.Println("\nSimulation initialization complete.")
+	var grid Grid
+
+	// Set burst radius from flag
+	grid.burstRadius = *flag_burstRadius
+
+	// Set Case 4 continuous production parameters
+	grid.continuousMode = *flag_continuousMode
+	grid.continuousProductionRateV = *flag_continuousProductionRateV
+	grid.continuousProductionRateD = *flag_continuousProductionRateD
+	grid.continuousIncubationPeriod = *flag_continuousIncubationPeriod
+	grid.continuousLysisTime = *flag_continuousLysisTime
+	grid.continuousRadius = *flag_continuousRadius
+	if grid.continuousRadius < 0 {
+		grid.continuousRadius = grid.burstRadius // Default: same footprint as bursts
+	}
+	grid.initOption = *flag_option
+
+	// A resumed run takes its seed from the checkpoint and initializes as the original run did,
+	// so everything derived from the random stream at start-up matches before the state is restored
+	var resumeHeader checkpointHeader
+	var resumeDecoder *gob.Decoder
+	startFrame := 0
+	if *flag_resumeFrom != "" {
+		header, dec, err := openCheckpoint(*flag_resumeFrom)
+		if err != nil {
+			return result, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+		}
+		resumeHeader, resumeDecoder = header, dec
+		startFrame = header.Frame + 1
+	}
+
+	// Seed the grid's random stream once - use provided seed or current time for randomness.
+	// Every stochastic draw of the simulation comes from grid.rng.
+	switch {
+	case resumeDecoder != nil:
+		grid.restoreRNG(resumeHeader.Seed, 0)
+		fmt.Printf("Main: Resuming from %s at frame %d with seed %d\n", *flag_resumeFrom, startFrame, resumeHeader.Seed)
+	case randomSeed >= 0:
+		grid.restoreRNG(randomSeed, 0)
+		fmt.Printf("Main: Using fixed random seed: %d\n", randomSeed)
+	default:
+		seed := time.Now().UnixNano()
+		grid.restoreRNG(seed, 0)
+		fmt.Printf("Main: Using time-based random seed: %d\n", seed)
+	}
+	// Dynamically set the value of R
+	if VStimulateIFN {
+		R = int(1 * ifnBothFold)
+	} else {
+		R = 0
+	}
+	grid.initialize()                // Initialize the grid
+	grid.initializeNeighbors()       // Initialize the neighbors
+	grid.initializeInfection(option) // Initialize the infection state
+	grid.initializeImmuneCells(*flag_numImmuneCells)
+
+	switch {
+	case TIME_STEPS > 1000:
+		ticksInterval = 500.0
+	case TIME_STEPS == 145:
+		ticksInterval = 24.0
+	case TIME_STEPS > 500:
+		ticksInterval = 100.0
+	case TIME_STEPS > 100:
+		ticksInterval = 50.0
+	case TIME_STEPS%24 == 0:
+		ticksInterval = 24.0
+	default:
+		ticksInterval = 100.0
+	}
+
+	// Infection-graph y-axis limit: -yMax if given, else the plot profile table (-1 = auto-scale)
+	yMax = plotprofile.YMax(IFN_wave_radius, TAU, jumpRandomly, jumpRadiusV, jumpRadiusD)
+	if *flag_yMax > 0 {
+		yMax = *flag_yMax
+	}
+
+	outputRoot := opts.OutputRoot
+	if outputRoot == "" {
+		outputRoot = "./"
+	}
+	folderNumber, err := getNextFolderNumber(outputRoot)
+	if err != nil {
+		return result, err
+	}
+
+	// Call generateFolderName function to generate folder name
+	outputFolder := generateFolderName(
+		folderNumber, // Current folder number
+		jumpRandomly, // DIP random jumping logic
+		jumpRadiusD,  // DIP jump radius
+		jumpRadiusV,  // Virion jump radius
+		BURST_SIZE_D, // DIP burst size
+		BURST_SIZE_V, // Virion burst size
+		//V_PFU_INITIAL,   // Virion initial value
+		//D_PFU_INITIAL,   // DIP initial value
+		IFN_wave_radius, // IFN wave radius
+		TAU,             // TAU value
+		TIME_STEPS,      // Time steps
+	)
+
+	outputFolder = filepath.Join(outputRoot, outputFolder)
+	result.OutputFolder = outputFolder
+
+	// Create folder
+	err = os.MkdirAll(outputFolder, os.ModePerm)
+	if err != nil {
+		return result, fmt.Errorf("%w: failed to create folder: %v", ErrOutputIO, err)
+	}
+	// Record a crash in the run folder so batch scripts can tell failed replicates apart
+	defer func() {
+		if r := recover(); r != nil {
+			recordRunFailure(outputFolder, r)
+			err = fmt.Errorf("%w: %v", ErrCrashed, r)
+		}
+	}()
+
+	saveCurrentGoFile(outputFolder)
+	saveParamsJSON(outputFolder)
+	saveConfigUsedJSON(outputFolder)
+	csvFilePath := filepath.Join(outputFolder, "simulation_output.csv")
+	videoFilePath := filepath.Join(outputFolder, "video.mp4")
+
+	// Open a CSV file to record the infected states over time.
+	// Rows go to simulation_output.csv.partial and the file is renamed into place on a clean finish.
+	writer, err := createAtomicCSV(csvFilePath)
+	if err != nil {
+		return result, fmt.Errorf("%w: failed to create CSV file: %v", ErrOutputIO, err)
+	}
+	defer writer.Close()
+
+	// Write the CSV headers
+	headers := []string{
+		"Time", "virion_half_life", "dip_half_life", "ifn_half_life", "Global IFN Concentration Per Cell", "Total Extracellular Virions",
+		"Total Extracellular DIPs", "Percentage Dead Cells", "Percentage Susceptible Cells",
+		"Percentage Infected Cells", "Percentage Infected DIP-only Cells",
+		"Percentage Infected Both Cells", "Percentage Antiviral Cells",
+		"Regrowth Count",
+		"Percentage Susceptible and Antiviral (Real Susceptible cells without regrowthed ones) Cells",
+		"Percentage Regrowthed or Regrowthed and Antiviral Cells",
+		"Probability Virion Infection", "Probability DIP Infection",
+		"Per Particle Infection Chance RHO", "Total Local Particles",
+		"Plaque Percentage", "max_global_IFN", "time_all_cells_uninfected",
+		"Percentage Uninfected Cells", "num_plaques", "GRID_SIZE", "TIMESTEP",
+		"IFN_DELAY", "STD_IFN_DELAY", "ALPHA", "RHO", "TAU", "BURST_SIZE_V",
+		"REGROWTH_MEAN", "REGROWTH_STD", "TIME_STEPS", "MEAN_LYSIS_TIME",
+		"STANDARD_LYSIS_TIME", "init_v_pfu_per_cell", "init_d_pfu_per_cell",
+		"MEAN_ANTI_TIME_Per_Cell", "STD_ANTI_TIME", "R", "BURST_SIZE_D", "H",
+		"option", "d_pfu_initial", "v_pfu_initial", "virionOnlyInfected", "dipOnlyInfected",
+		"bothInfected", "totalDeadFromV", "totalDeadFromBoth", "virionDiffusionRate", "dipDiffusionRate", "k_JumpR",
+		"jumpRadiusV", "jumpRadiusD", "jumpRandomly", "par_celltocell_random",
+		"allowVirionJump", "allowDIPJump", "IFN_wave_radius", "ifnWave",
+		"ifnBothFold", "D_only_IFN_stimulate_ratio", "BOTH_IFN_stimulate_ratio",
+		"totalRandomJumpVirions", "totalRandomJumpDIPs", "dipAdvantage", "burnIn", "perturbed",
+		"newInfections", "lysisEvents", "R_eff_crude",
+		"meanRealizedIncubation", "meanRealizedContinuousLysisTime",
+		"adsorbedVirions", "adsorbedDIPs",
+		"plaqueCount", "edgePlaqueCount", "meanPlaqueRadius", "meanInteriorPlaqueRadius",
+		"frontRadius", "frontVelocity",
+		"meanPlaqueArea", "maxPlaqueArea", "meanPlaqueExtent",
+		"susceptibilityMean", "susceptibilityVar", "antiviralExits",
+		"antiviralCellCount", "totalAntiviralTime", "everRegrown",
+		"moransI", "dosedDIPs", "washedVirions", "washedDIPs",
+	}
+
+	err = writer.WriteRow(headers)
+	if err != nil {
+		return result, fmt.Errorf("%w: failed to write CSV headers: %v", ErrOutputIO, err)
+	}
+	if err := carryOverRows(writer, "simulation_output.csv", headers, startFrame); err != nil {
+		return result, err
+	}
+
+	// Ring histogram: infected cells per hex distance from the infection focus, one row per frame
+	ringWriter, err := createAtomicCSV(filepath.Join(outputFolder, "ring_histogram.csv"))
+	if err != nil {
+		return result, fmt.Errorf("%w: failed to create ring histogram CSV: %v", ErrOutputIO, err)
+	}
+	defer ringWriter.Close()
+	if err := ringWriter.WriteRow(ringHistogramHeader()); err != nil {
+		return result, fmt.Errorf("%w: failed to write ring histogram CSV header: %v", ErrOutputIO, err)
+	}
+	if err := carryOverRows(ringWriter, "ring_histogram.csv", ringHistogramHeader(), startFrame); err != nil {
+		return result, err
+	}
+
+	// Per-plaque detail (-plaquesEvery): one row per plaque at every sampled frame
+	var plaqueWriter *atomicCSV
+	if *flag_plaquesEvery > 0 {
+		plaqueWriter, err = createAtomicCSV(filepath.Join(outputFolder, "plaques.csv"))
+		if err != nil {
+			return result, fmt.Errorf("%w: failed to create plaques CSV: %v", ErrOutputIO, err)
+		}
+		defer plaqueWriter.Close()
+		if err := plaqueWriter.WriteRow(plaquesHeader()); err != nil {
+			return result, fmt.Errorf("%w: failed to write plaques CSV header: %v", ErrOutputIO, err)
+		}
+		if err := carryOverRows(plaqueWriter, "plaques.csv", plaquesHeader(), startFrame); err != nil {
+			return result, err
+		}
+	}
+
+	// Radial profile around the infection focus (-radialEvery)
+	var radialWriter *atomicCSV
+	if *flag_radialEvery > 0 {
+		radialWriter, err = createAtomicCSV(filepath.Join(outputFolder, "radial_profile.csv"))
+		if err != nil {
+			return result, fmt.Errorf("%w: failed to create radial profile CSV: %v", ErrOutputIO, err)
+		}
+		defer radialWriter.Close()
+		if err := radialWriter.WriteRow(radialProfileHeader()); err != nil {
+			return result, fmt.Errorf("%w: failed to write radial profile CSV header: %v", ErrOutputIO, err)
+		}
+		if err := carryOverRows(radialWriter, "radial_profile.csv", radialProfileHeader(), startFrame); err != nil {
+			return result, err
+		}
+	}
+
+	// Per-lysis burst log (-burstLog)
+	var burstWriter *atomicCSV
+	if *flag_burstLog {
+		burstWriter, err = createAtomicCSV(filepath.Join(outputFolder, "bursts.csv"))
+		if err != nil {
+			return result, fmt.Errorf("%w: failed to create bursts CSV: %v", ErrOutputIO, err)
+		}
+		defer burstWriter.Close()
+		if err := burstWriter.WriteRow(burstsHeader()); err != nil {
+			return result, fmt.Errorf("%w: failed to write bursts CSV header: %v", ErrOutputIO, err)
+		}
+		if err := carryOverRows(burstWriter, "bursts.csv", burstsHeader(), startFrame); err != nil {
+			return result, err
+		}
+	}
+
+	// Infection lineage (-lineage)
+	var lineageWriter *atomicCSV
+	if *flag_lineage {
+		lineageWriter, err = createAtomicCSV(filepath.Join(outputFolder, "lineage.csv"))
+		if err != nil {
+			return result, fmt.Errorf("%w: failed to create lineage CSV: %v", ErrOutputIO, err)
+		}
+		defer lineageWriter.Close()
+		if err := lineageWriter.WriteRow(lineageHeader()); err != nil {
+			return result, fmt.Errorf("%w: failed to write lineage CSV header: %v", ErrOutputIO, err)
+		}
+		if err := carryOverRows(lineageWriter, "lineage.csv", lineageHeader(), startFrame); err != nil {
+			return result, err
+		}
+	}
+
+	// Binary field dump (-dumpField): one field.npy record per sampled frame of this run
+	var fieldWriter *fieldDump
+	if *flag_dumpField > 0 {
+		records := 0
+		for frame := startFrame; frame < TIME_STEPS; frame++ {
+			if frame%*flag_dumpField == 0 {
+				records++
+			}
+		}
+		fieldWriter, err = createFieldDump(filepath.Join(outputFolder, "field.npy"), records)
+		if err != nil {
+			return result, fmt.Errorf("%w: failed to create field dump: %v", ErrOutputIO, err)
+		}
+		defer fieldWriter.Close()
+	}
+
+	// Create the frame renderer (video + PNGs; a no-op in headless builds and with -render=false)
+	var renderer FrameRenderer = noRenderer{}
+	if *flag_render {
+		renderer = newFrameRenderer()
+	}
+	if err := renderer.Start(videoFilePath); err != nil {
+		return result, fmt.Errorf("%w: failed to create MJPEG writer: %v", ErrRenderFailure, err)
+	}
+	defer renderer.Close() // Ensure the writer is closed when the program ends
+
+	var frameNumbers []int            // Slice to store frame numbers
+	var deadCellPercentages []float64 // Slice to store dead cell percentages
+	virionOnly := make([]float64, TIME_STEPS)
+	dipOnly := make([]float64, TIME_STEPS)
+	both := make([]float64, TIME_STEPS)
+	// Ensure the first frame has valid values
+	virionOnly[0] = 0.0
+	dipOnly[0] = 0.0
+	both[0] = 0.0
+	// Output image save directory
+
+	summary := newSimulationSummary()
+
+	if resumeDecoder != nil {
+		series := runSeries{}
+		if err := grid.restoreCheckpoint(resumeHeader, resumeDecoder, summary, &series); err != nil {
+			return result, fmt.Errorf("%w: %s: %v", ErrInvalidConfig, *flag_resumeFrom, err)
+		}
+		frameNumbers, deadCellPercentages = series.frameNumbers, series.deadCellPercentages
+		virionOnly, dipOnly, both = series.virionOnly, series.dipOnly, series.both
+		// Parameter changes of a perturbation that already happened still apply
+		if perturbFrame >= 0 && perturbFrame < startFrame {
+			for _, step := range perturbation {
+				setPerturbationParameter(step)
+			}
+		}
+	}
+
+	selectedTimePoints := []int{7, 13, 19, 25} // Time points for saving simulation images
+
+	for frameNum := startFrame; frameNum < TIME_STEPS; frameNum++ {
+
+		// Warmup-then-perturb protocol: switch configuration once the warm-up frames are done
+		if frameNum == perturbFrame {
+			grid.applyPerturbation(frameNum, perturbation)
+		}
+		grid.applyDIPDoses(frameNum)
+
+		grid.update(frameNum) // Update the grid state
+		if grid.conservationErr != nil {
+			return result, grid.conservationErr
+		}
+
+		// Experimental viral particle removal (if enabled)
+		grid.removeViralParticlesOutsideIFNRange(frameNum)
+
+		// Washout / media change (-washout)
+		grid.applyWashouts(frameNum)
+
+		// Call the function to record infected state counts at the specific frames
+		if err := grid.recordSimulationData(writer, frameNum); err != nil {
+			return result, err
+		}
+		if err := grid.recordRingHistogram(ringWriter, frameNum); err != nil {
+			return result, err
+		}
+		if err := grid.recordPlaques(plaqueWriter, frameNum); err != nil {
+			return result, err
+		}
+		if err := grid.recordRadialProfile(radialWriter, frameNum); err != nil {
+			return result, err
+		}
+		if err := grid.recordBursts(burstWriter, frameNum); err != nil {
+			return result, err
+		}
+		if err := grid.recordLineage(lineageWriter, frameNum); err != nil {
+			return result, err
+		}
+		if fieldWriter != nil && frameNum%*flag_dumpField == 0 {
+			if err := fieldWriter.WriteFrame(&grid, frameNum); err != nil {
+				return result, fmt.Errorf("%w: failed to write field dump at frame %d: %v", ErrOutputIO, frameNum, err)
+			}
+		}
+		summary.observe(&grid, frameNum)
+
+		// Calculate and record the percentage of dead cells, excluding regrowth cells
+		deadCellsPercentage := calculateDeadCellPercentage(grid.state)
+		frameNumbers = append(frameNumbers, frameNum)                          // Record the current frame number
+		deadCellPercentages = append(deadCellPercentages, deadCellsPercentage) // Record the percentage of dead cells
+
+		// Calculate infection percentages
+		virionOnly[frameNum] = float64(grid.calculateVirionOnlyInfected()) / float64(GRID_SIZE*GRID_SIZE) * 100
+		dipOnly[frameNum] = float64(grid.calculateDipOnlyInfected()) / float64(GRID_SIZE*GRID_SIZE) * 100
+		both[frameNum] = float64(grid.calculateBothInfected()) / float64(GRID_SIZE*GRID_SIZE) * 100
+
+		// Check if current frame is at one of the selected time points
+		for _, timePoint := range selectedTimePoints {
+			if frameNum == timePoint {
+				fmt.Printf("DEBUG: Saving simulation frame at frameNum=%d, timePoint=%d\n", frameNum, timePoint)
+				// Save individual frame image as simulation result
+				if err := renderer.SelectedFrame(&grid, timePoint, outputFolder); err != nil {
+					return result, fmt.Errorf("%w: %v", ErrRenderFailure, err)
+				}
+			}
+		}
+
+		// Save the full per-cell grid at the -dumpStatesAt hours and every -snapshotEvery frames
+		// (readable by cmd/viewer and LoadSnapshot)
+		if dumpStatesAt[frameNum] {
+			snapshotName := fmt.Sprintf("snapshot_%d_hours.csv", frameNum*TIMESTEP)
+			if *flag_snapshotGzip {
+				snapshotName += ".gz"
+			}
+			grid.saveSnapshotCSV(filepath.Join(outputFolder, snapshotName))
+		}
+
+		if *flag_checkpointEvery > 0 && (frameNum+1)%*flag_checkpointEvery == 0 && frameNum < TIME_STEPS-1 {
+			series := runSeries{frameNumbers, deadCellPercentages, virionOnly, dipOnly, both}
+			checkpointPath := filepath.Join(outputFolder, fmt.Sprintf("checkpoint_%d_hours.gob", frameNum*TIMESTEP))
+			if err := grid.saveCheckpoint(checkpointPath, frameNum, summary, &series); err != nil {
+				return result, fmt.Errorf("%w: failed to write checkpoint: %v", ErrOutputIO, err)
+			}
+		}
+
+		// Log `y` values before feeding them to the graph
+		log.Printf("Frame %d: Virion Only: %.2f%%, DIP Only: %.2f%%, Both: %.2f%%", frameNum, virionOnly[frameNum], dipOnly[frameNum], both[frameNum])
+
+		// Add the video frame (grid + infection graph) and refresh the combined selected-frames image
+		if err := renderer.Frame(&grid, frameNum, virionOnly[:frameNum+1], dipOnly[:frameNum+1], both[:frameNum+1], outputFolder); err != nil {
+			return result, fmt.Errorf("%w: failed to render frame: %v", ErrRenderFailure, err)
+		}
+	}
+	log.Println("Video and graph saved successfully.") // Print a success message
+	if err := writer.Commit(); err != nil {
+		return result, fmt.Errorf("%w: failed to finalize CSV file: %v", ErrOutputIO, err)
+	}
+	if err := ringWriter.Commit(); err != nil {
+		return result, fmt.Errorf("%w: failed to finalize ring histogram CSV: %v", ErrOutputIO, err)
+	}
+	if plaqueWriter != nil {
+		if err := plaqueWriter.Commit(); err != nil {
+			return result, fmt.Errorf("%w: failed to finalize plaques CSV: %v", ErrOutputIO, err)
+		}
+	}
+	if radialWriter != nil {
+		if err := radialWriter.Commit(); err != nil {
+			return result, fmt.Errorf("%w: failed to finalize radial profile CSV: %v", ErrOutputIO, err)
+		}
+	}
+	if burstWriter != nil {
+		if err := burstWriter.Commit(); err != nil {
+			return result, fmt.Errorf("%w: failed to finalize bursts CSV: %v", ErrOutputIO, err)
+		}
+	}
+	if lineageWriter != nil {
+		if err := lineageWriter.Commit(); err != nil {
+			return result, fmt.Errorf("%w: failed to finalize lineage CSV: %v", ErrOutputIO, err)
+		}
+	}
+	if fieldWriter != nil {
+		if err := fieldWriter.Commit(); err != nil {
+			return result, fmt.Errorf("%w: failed to finalize field dump: %v", ErrOutputIO, err)
+		}
+	}
+	grid.saveIsochroneCSV(outputFolder)
+	if *flag_lineage {
+		grid.saveCohortReffCSV(outputFolder, TIME_STEPS-1, summary)
+	}
+	summary.StateHash = grid.stateHash()
+	summary.DIPRescuedPercentage = grid.dipRescuedPercentage()
+	summary.IFNDominantSource = grid.dominantIFNSourceCounts()
+	summary.FinalDIPOnlyCells = grid.dipOnlyCellCount()
+	summary.FinalDIPOnlyPercentage = float64(summary.FinalDIPOnlyCells) / float64(GRID_SIZE*GRID_SIZE) * 100
+	summary.FinalDIPOnlyMoransI = grid.dipOnlyMoransI()
+	summary.PartitionJumpFraction = grid.partitionJumpFraction()
+	summary.DeadFrontRadius = deadFrontRadius(grid.radialProfile(grid.infectionFocus()))
+	summary.computeAUCWindows(outputFolder)
+	summary.save(outputFolder)
+	result.Summary = *summary
+	fmt.Println("ifnWave is ", ifnWave)
+
+	// Generate comparison plots including composite_4x2_comparison.png
+	if !opts.SkipPlots {
+		generateComparisonPlots(outputFolder)
+	}
+
+	if *flag_baseline != "" {
+		diff, err := compareWithBaseline(*flag_baseline, outputFolder, *flag_baselineTolerance)
+		if err != nil {
+			return result, fmt.Errorf("%w: failed to compare with baseline: %v", ErrOutputIO, err)
+		}
+		result.Baseline = &diff
+		if diff.Diverged && *flag_failOnDivergence {
+			return result, fmt.Errorf("%w %s (first frame %d)", ErrDiverged, *flag_baseline, diff.FirstDivergentFrame)
+		}
+	}
+	return result, nil
+}
+
+// Function to map an error returned by Run to the process exit code
+func exitCode(err error) int {
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, ErrDiverged):
+		return 1
+	case errors.Is(err, ErrCrashed):
+		return 2
+	case errors.Is(err, ErrInvalidConfig):
+		return 3
+	case errors.Is(err, ErrOutputIO):
+		return 4
+	case errors.Is(err, ErrRenderFailure):
+		return 5
+	case errors.Is(err, ErrConservation):
+		return 6
+	default:
+		return 1
+	}
+}
+
+func main() {
+	flag.Parse()
+
+	// Parameters from -config, overridden by anything given on the command line
+	cfg := configFromFlags()
+	if *flag_config != "" {
+		fileCfg, warnings, err := loadConfigFile(*flag_config)
+		if err != nil {
+			log.Printf("❌ %v", err)
+			os.Exit(exitCode(err))
+		}
+		for _, w := range warnings {
+			fmt.Printf("⚠️  %s\n", w)
+		}
+		for name, value := range cfg {
+			fileCfg[name] = value
+		}
+		// Keep -config absolute so config_used.json points at the file from any run folder
+		if abs, err := filepath.Abs(*flag_config); err == nil {
+			fileCfg["config"] = abs
+		}
+		cfg = fileCfg
+		if err := applyConfig(cfg); err != nil {
+			log.Printf("❌ %v", err)
+			os.Exit(exitCode(err))
+		}
+	}
+
+	// DIP advantage sweep runs its simulations and exits
+	if *flag_dipAdvantageSweep != "" {
+		if err := runDipAdvantageSweep(cfg, *flag_dipAdvantageSweep, *flag_sweepReplicates); err != nil {
+			log.Printf("❌ %v", err)
+			os.Exit(exitCode(err))
+		}
+		return
+	}
+
+	// Latin-hypercube sweep runs its simulations and exits
+	if *flag_sweepMode != "" {
+		if err := runLHSSweep(cfg, *flag_sweepMode, *flag_sweepN, *flag_sweepRanges); err != nil {
+			log.Printf("❌ %v", err)
+			os.Exit(exitCode(err))
+		}
+		return
+	}
+
+	// Replicate driver runs its simulations and exits
+	if *flag_replicates > 0 {
+		if err := runReplicates(cfg, *flag_replicates, *flag_parallel); err != nil {
+			log.Printf("❌ %v", err)
+			os.Exit(exitCode(err))
+		}
+		return
+	}
+
+	if _, err := Run(cfg, RunOptions{OutputRoot: "./"}); err != nil {
+		log.Printf("❌ %v", err)
+		os.Exit(exitCode(err))
+	}
+}
+
+// FrameRenderer draws the images and video of a run. The simulation only talks to rendering
+// through this interface: render_0818.go implements it with image/chart/mjpeg, and a headless
+// build (go build -tags headless) swaps in the no-op renderer from render_headless_0818.go.
+type FrameRenderer interface {
+	// Start opens the video file
+	Start(videoFilePath string) error
+	// SelectedFrame saves simulation_<t>_hours.png (.svg under -renderFormat=svg) and keeps the image for the combined strip
+	SelectedFrame(g *Grid, timePoint int, outputFolder string) error
+	// Frame appends frame frameNum to the video and updates selected_frames_combined.png
+	Frame(g *Grid, frameNum int, virionOnly, dipOnly, both []float64, outputFolder string) error
+	// Close finalizes the video
+	Close()
+}
+
+// noRenderer is the FrameRenderer for -render=false and headless builds; every method is a no-op
+type noRenderer struct{}
+
+func (noRenderer) Start(videoFilePath string) error { return nil }
+
+func (noRenderer) SelectedFrame(g *Grid, timePoint int, outputFolder string) error {
+	return nil
+}
+
+func (noRenderer) Frame(g *Grid, frameNum int, virionOnly, dipOnly, both []float64, outputFolder string) error {
+	return nil
+}
+
+func (noRenderer) Close() {}
+
+// Function to save all flag values, plus raw and canonical clearance parameters, to params.json
+func saveParamsJSON(outputFolder string) {
+	flags := make(map[string]string)
+	flag.VisitAll(func(f *flag.Flag) {
+		flags[f.Name] = f.Value.String()
+	})
+
+	type unitEntry struct {
+		Raw                 string  `json:"raw"`
+		HalfLifeHours       float64 `json:"half_life_hours"`
+		ClearanceRatePerDay float64 `json:"clearance_rate_per_day"`
+		Legacy              bool    `json:"legacy_bare_number"`
+	}
+	units := make(map[string]unitEntry)
+	for _, h := range []*HalfLife{flag_virion_half_life, flag_dip_half_life, flag_ifn_half_life} {
+		units[h.Name] = unitEntry{h.Raw, h.Hours, halfLifeToRatePerDay(h.Hours), h.Legacy}
+	}
+
+	params := map[string]interface{}{
+		"flags":      flags,
+		"units":      units,
+		"randomSeed": randomSeed,
+	}
+	if infectionFoci != nil {
+		params["foci"] = infectionFoci
+	}
+	data, err := json.MarshalIndent(params, "", "  ")
+	if err != nil {
+		log.Printf("Failed to encode params: %v", err)
+		return
+	}
+	if err := ioutil.WriteFile(filepath.Join(outputFolder, "params.json"), data, 0644); err != nil {
+		log.Printf("Failed to write params.json: %v", err)
+	}
+}
+
+// Function to save the effective value of every flag to config_used.json, a flat object that
+// -config accepts, so the run can be repeated or diffed against another parameter set
+func saveConfigUsedJSON(outputFolder string) {
+	values := make(map[string]string)
+	flag.VisitAll(func(f *flag.Flag) {
+		if f.Name != "config" {
+			values[f.Name] = f.Value.String()
+		}
+	})
+	data, err := json.MarshalIndent(values, "", "  ")
+	if err != nil {
+		log.Printf("Failed to encode config: %v", err)
+		return
+	}
+	if err := ioutil.WriteFile(filepath.Join(outputFolder, "config_used.json"), data, 0644); err != nil {
+		log.Printf("Failed to write config_used.json: %v", err)
+	}
+}
+
+// Function to save a panic message and stack trace to failure.txt in the run folder
+func recordRunFailure(outputFolder string, r interface{}) {
+	failurePath := filepath.Join(outputFolder, "failure.txt")
+	report := fmt.Sprintf("panic: %v\nrandomSeed: %d\n\n%s", r, randomSeed, debug.Stack())
+	if err := ioutil.WriteFile(failurePath, []byte(report), 0644); err != nil {
+		log.Printf("Failed to write failure report: %v", err)
+	}
+	fmt.Printf("❌ Simulation failed: %v (details in %s)\n", r, failurePath)
+}
+
+// Function to remove viral particles outside IFN range at specified timepoint (72 hours)
+func (g *Grid) removeViralParticlesOutsideIFNRange(frameNum int) {
+	// Check if this is the removal timepoint (72 hours)
+	if !enableParticleRemoval || frameNum != removalTimepoint {
+		return // IFN范围判定逻辑只在指定时间点（默认72小时）执行
 	}
-	fmt.Println("\nParticle spread option settings:")
-	fmt.Printf("  particleSpreadOption: %s\n", particleSpreadOption)
-	fmt.Printf("  jumpRadiusV: %d, jumpRadiusD: %d, jumpRandomly: %v, k_JumpR: %.2f\n",
-		jumpRadiusV, jumpRadiusD, jumpRandomly, k_JumpR)
 
-	// --- IFN Propagation Options ---
-	ifnSpreadOption = *flag_ifnSpreadOption
+	// 只有在达到移除时间点时才打印这条消息和执行IFN范围判定
+	fmt.Printf("=== Executing viral particle removal at Frame %d (%d hours) ===\n", frameNum, removalTimepoint)
 
-	switch ifnSpreadOption {
+	removedVirions := 0
+	removedDIPs := 0
+	totalCellsProcessed := 0
 
-	case "global":
-		IFN_wave_radius = 0
-		ifnWave = false
-		fmt.Printf("hello: ifnSpreadOption set to: %s, IFN_wave_radius: %d\n", ifnSpreadOption, IFN_wave_radius)
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			// Check if there are any viral particles in this cell
+			if g.localVirions[i][j] > 0 || g.localDips[i][j] > 0 {
+				// Calculate local IFN concentration
+				localIFN := 0.0
+				if ifnWave && len(g.neighborsIFNArea[i][j]) > 0 {
+					var regionalSumIFN float64
+					neighborsCount := len(g.neighborsIFNArea[i][j])
+					for _, neighbor := range g.neighborsIFNArea[i][j] {
+						ni, nj := neighbor[0], neighbor[1]
+						regionalSumIFN += g.IFNConcentration[ni][nj]
+					}
+					localIFN = regionalSumIFN / float64(neighborsCount)
+				}
 
-	case "local":
-		IFN_wave_radius = 10
-		ifnWave = true
-		fmt.Printf("ummmm: ifnSpreadOption set to: %s, IFN_wave_radius: %d\n", ifnSpreadOption, IFN_wave_radius)
+				// If IFN concentration is below threshold (outside IFN range), remove viral particles
+				if localIFN < ifnThreshold {
+					// Count particles to be removed
+					removedVirions += g.localVirions[i][j]
+					if removeVirionAndDIP {
+						removedDIPs += g.localDips[i][j]
+					}
 
-	case "noIFN":
-		IFN_wave_radius = 0
-		// Disable IFN: set IFN-related parameters to zero
-		ifnBothFold = 0.0
-		// Additionally in the model, R, ALPHA, IFN_DELAY, STD_IFN_DELAY, tau, etc. can be set to zero
-		ifnWave = false
-		ALPHA = 0.0
-		IFN_DELAY = 0
-		STD_IFN_DELAY = 0
-		TAU = 0
-		ifn_half_life = 0.0
-	default:
-		log.Fatalf("Unknown ifnSpreadOption: %s", ifnSpreadOption)
-		fmt.Printf("ifnSpreadOption set to: %s, IFN_wave_radius: %d\n", ifnSpreadOption, IFN_wave_radius)
+					// Remove viral particles (but keep cell state unchanged)
+					g.localVirions[i][j] = 0
+					if removeVirionAndDIP {
+						g.localDips[i][j] = 0
+					}
 
+					totalCellsProcessed++
+				}
+			}
+		}
 	}
-	fmt.Println("\nIFN spread option settings:")
-	fmt.Printf("  ifnSpreadOption: %s, IFN_wave_radius: %d, ifnBothFold: %.2f\n",
-		ifnSpreadOption, IFN_wave_radius, ifnBothFold)
-	fmt.Printf("flag_ifnSpreadOption = %q\n", *flag_ifnSpreadOption)
-	// --- DIP Options ---
-	dipOption = *flag_dipOption
-	if dipOption {
-		BURST_SIZE_D = *flag_burstSizeD
-		// Keep D_only_IFN_stimulate_ratio default value
-	} else {
-		BURST_SIZE_D = 0
-		D_only_IFN_stimulate_ratio = 0.0
+
+	fmt.Printf("=== Frame %d (%dh): Viral Particle Removal Results ===\n", frameNum, removalTimepoint)
+	fmt.Printf("    Removed Virions: %d\n", removedVirions)
+	fmt.Printf("    Removed DIPs: %d\n", removedDIPs)
+	fmt.Printf("    Cells processed (outside IFN range): %d\n", totalCellsProcessed)
+	fmt.Printf("    IFN threshold used: %.3f\n", ifnThreshold)
+	fmt.Printf("=== End of viral particle removal ===\n")
+}
+
+// Function to generate comparison plots (log and linear scale)
+func generateComparisonPlots(outputFolder string) {
+	// Check if simulation_output.csv exists
+	simulationCSVPath := filepath.Join(outputFolder, "simulation_output.csv")
+	if _, err := os.Stat(simulationCSVPath); os.IsNotExist(err) {
+		fmt.Printf("⚠️  Cannot create comparison plots. Missing simulation_output.csv\n")
+		return
 	}
-	fmt.Println("\nDIP option settings:")
-	fmt.Printf("  dipOption: %v, BURST_SIZE_D: %d, D_only_IFN_stimulate_ratio: %.2f, BOTH_IFN_stimulate_ratio: %.2f\n",
-		dipOption, BURST_SIZE_D, D_only_IFN_stimulate_ratio, BOTH_IFN_stimulate_ratio)
 
-	// Simulation code can be integrated here later, this example only shows parameter setup
-	fmt.Println("\nSimulation initialization complete.")
-	var grid Grid
+	// Check if infection_counts_by_time.csv exists in current directory
+	experimentalCSVPath := "infection_counts_by_time.csv"
+	if _, err := os.Stat(experimentalCSVPath); os.IsNotExist(err) {
+		fmt.Printf("⚠️  Cannot create comparison plots. Missing infection_counts_by_time.csv\n")
+		return
+	}
 
-	// Set burst radius from flag
-	grid.burstRadius = *flag_burstRadius
+	// Run the Python script to generate comparison plots
+	// The script reads simulation_output.csv from the output folder and infection_counts_by_time.csv from current directory
+	cmd := exec.Command("python3", "create_comparison_plot.py", outputFolder)
+	cmd.Dir = "." // Run from current directory so it can find infection_counts_by_time.csv
 
-	// Set Case 4 continuous production parameters
-	grid.continuousMode = *flag_continuousMode
-	grid.continuousProductionRateV = *flag_continuousProductionRateV
-	grid.continuousProductionRateD = *flag_continuousProductionRateD
-	grid.continuousIncubationPeriod = *flag_continuousIncubationPeriod
-	grid.continuousLysisTime = *flag_continuousLysisTime
-	grid.initOption = *flag_option
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		fmt.Printf("❌ Error running comparison plot script: %v\n", err)
+		fmt.Printf("Output: %s\n", string(output))
+		return
+	}
 
-	// Set random seed - use provided seed or current time for randomness
-	if randomSeed >= 0 {
-		rand.Seed(randomSeed)
-		fmt.Printf("Main: Using fixed random seed: %d\n", randomSeed)
-	} else {
-		seed := time.Now().UnixNano()
-		rand.Seed(seed)
-		fmt.Printf("Main: Using time-based random seed: %d\n", seed)
+	fmt.Printf("✅ Successfully generated comparison plots:\n")
+	fmt.Printf("   - comparison_plot_log.png\n")
+	fmt.Printf("   - comparison_plot_linear.png\n")
+	fmt.Printf("   - comparison_plot_log.pdf\n")
+	fmt.Printf("   - comparison_plot_linear.pdf\n")
+	fmt.Printf("   - composite_4x2_comparison.png\n")
+}
+
+// Function to run a DIP advantage sweep: for each advantage a, run a simulation with
+// burstSizeD = round(a * burstSizeV) and sweepReplicates seeds, then collect each run's
+// summary.json into dip_advantage_sweep.csv. Runs are sequential, in this process.
+func runDipAdvantageSweep(cfg Config, advantageList string, replicates int) error {
+	var advantages []float64
+	for _, part := range strings.Split(advantageList, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		a, err := strconv.ParseFloat(part, 64)
+		if err != nil || a < 0 {
+			return fmt.Errorf("%w: invalid dipAdvantageSweep value %q", ErrInvalidConfig, part)
+		}
+		advantages = append(advantages, a)
 	}
-	// Dynamically set the value of R
-	if VStimulateIFN {
-		R = int(1 * ifnBothFold)
-	} else {
-		R = 0
+	if len(advantages) == 0 || replicates < 1 {
+		return fmt.Errorf("%w: dipAdvantageSweep needs at least one advantage and sweepReplicates >= 1", ErrInvalidConfig)
 	}
-	grid.initialize()                // Initialize the grid
-	grid.initializeNeighbors()       // Initialize the neighbors
-	grid.initializeInfection(option) // Initialize the infection state
 
-	switch {
-	case TIME_STEPS > 1000:
-		ticksInterval = 500.0
-	case TIME_STEPS == 145:
-		ticksInterval = 24.0
-	case TIME_STEPS > 500:
-		ticksInterval = 100.0
-	case TIME_STEPS > 100:
-		ticksInterval = 50.0
-	case TIME_STEPS%24 == 0:
-		ticksInterval = 24.0
-	default:
-		ticksInterval = 100.0
+	batch, err := newRunBatch(cfg, "dip_advantage_sweep", "burstSizeD")
+	if err != nil {
+		return err
 	}
 
-	// Switch statement with conditional cases
-	// Switch statement with conditional cases
-	switch {
-	case IFN_wave_radius == 0 && TAU == 12 && jumpRandomly == true:
-		yMax = 0.2
-	case IFN_wave_radius == 0 && TAU == 12 && jumpRandomly == true:
-		yMax = 1.0
-	case IFN_wave_radius == 0 && TAU == 12 && jumpRandomly == true:
-		yMax = 0.03
-	case IFN_wave_radius == 0 && TAU == 12 && jumpRandomly == true:
-		yMax = 1.5
-	case IFN_wave_radius == 10 && TAU == 12 && jumpRandomly == true:
-		yMax = 20.0
-	case IFN_wave_radius == 10 && TAU == 12 && jumpRandomly == true:
-		yMax = 0.1
-	case IFN_wave_radius == 0 && jumpRadiusV == 0 && jumpRadiusD == 0 && TAU == 12:
-		yMax = 0.3
-	case IFN_wave_radius == 0 && jumpRadiusV == 5 && jumpRadiusD == 0 && TAU == 12:
-		yMax = 1.0
-	case IFN_wave_radius == 0 && jumpRadiusV == 0 && jumpRadiusD == 5 && TAU == 12:
-		yMax = 0.03
-	case IFN_wave_radius == 0 && jumpRadiusV == 5 && jumpRadiusD == 5 && TAU == 12:
-		yMax = 0.1
-	case IFN_wave_radius == 10 && jumpRadiusV == 5 && jumpRadiusD == 5 && TAU == 12:
-		yMax = 0.2
-	case IFN_wave_radius == 0 && jumpRadiusV == 0 && jumpRadiusD == 0 && TAU == 24:
-		yMax = 0.3
-	case IFN_wave_radius == 0 && jumpRadiusV == 5 && jumpRadiusD == 5 && TAU == 24:
-		yMax = 1.5
-	case IFN_wave_radius == 10 && jumpRadiusV == 5 && jumpRadiusD == 5 && TAU == 24:
-		yMax = 0.2
-
-	case IFN_wave_radius == 0 && jumpRadiusV == 0 && jumpRadiusD == 0:
-		yMax = 0.3
-	case IFN_wave_radius == 0 && jumpRadiusV == 5 && jumpRadiusD == 5:
-		yMax = 1.5
-	case IFN_wave_radius == 10 && jumpRadiusV == 5 && jumpRadiusD == 5:
-		yMax = 35.0
-
-	default:
-		yMax = -1.0 // Default value in case no conditions are met
+	out, err := createAtomicCSV(filepath.Join(batch.folder, "dip_advantage_sweep.csv"))
+	if err != nil {
+		return fmt.Errorf("%w: failed to create sweep CSV: %v", ErrOutputIO, err)
+	}
+	defer out.Close()
+	out.WriteRow([]string{
+		"dipAdvantage", "burstSizeV", "burstSizeD", "replicate", "randomSeed", "status",
+		"final_dead_percentage", "final_infected_percentage", "final_plaque_percentage",
+		"peak_infected_percentage", "peak_infected_time", "max_antiviral_percentage",
+	})
+
+	for _, a := range advantages {
+		burstSizeD := int(math.Round(a * float64(*flag_burstSizeV)))
+		for rep := 0; rep < replicates; rep++ {
+			seed := batch.baseSeed + int64(rep)
+			fmt.Printf("Sweep: dipAdvantage=%g burstSizeD=%d replicate=%d seed=%d\n", a, burstSizeD, rep, seed)
+			summary, runErr := batch.run(fmt.Sprintf("adv_%g_rep_%d", a, rep), seed, "-burstSizeD="+strconv.Itoa(burstSizeD))
+
+			row := []string{
+				strconv.FormatFloat(a, 'f', -1, 64), strconv.Itoa(*flag_burstSizeV), strconv.Itoa(burstSizeD),
+				strconv.Itoa(rep), strconv.FormatInt(seed, 10),
+			}
+			if runErr != nil {
+				fmt.Printf("⚠️  Sweep run adv_%g_rep_%d failed: %v\n", a, rep, runErr)
+				row = append(row, "failed", "", "", "", "", "", "")
+			} else {
+				row = append(row, "ok",
+					strconv.FormatFloat(summary.FinalDeadPercentage, 'f', 6, 64),
+					strconv.FormatFloat(summary.FinalInfectedPercentage, 'f', 6, 64),
+					strconv.FormatFloat(summary.FinalPlaquePercentage, 'f', 6, 64),
+					strconv.FormatFloat(summary.PeakInfectedPercentage, 'f', 6, 64),
+					strconv.Itoa(summary.PeakInfectedTime),
+					strconv.FormatFloat(summary.MaxAntiviralPercentage, 'f', 6, 64),
+				)
+			}
+			if err := out.WriteRow(row); err != nil {
+				return fmt.Errorf("%w: failed to write sweep CSV: %v", ErrOutputIO, err)
+			}
+		}
 	}
 
-	folderNumber := getNextFolderNumber("./")
+	if err := out.Commit(); err != nil {
+		return fmt.Errorf("%w: failed to finalize sweep CSV: %v", ErrOutputIO, err)
+	}
+	fmt.Printf("✅ DIP advantage sweep saved to %s\n", filepath.Join(batch.folder, "dip_advantage_sweep.csv"))
+	return nil
+}
 
-	// Call generateFolderName function to generate folder name
-	outputFolder := generateFolderName(
-		folderNumber, // Current folder number
-		jumpRandomly, // DIP random jumping logic
-		jumpRadiusD,  // DIP jump radius
-		jumpRadiusV,  // Virion jump radius
-		BURST_SIZE_D, // DIP burst size
-		BURST_SIZE_V, // Virion burst size
-		//V_PFU_INITIAL,   // Virion initial value
-		//D_PFU_INITIAL,   // DIP initial value
-		IFN_wave_radius, // IFN wave radius
-		TAU,             // TAU value
-		TIME_STEPS,      // Time steps
-	)
+// replicateColumns are the simulation_output.csv columns aggregated by -replicates, as
+// aggregate_summary.csv prefix and CSV header
+var replicateColumns = [][2]string{
+	{"infected_pct", "Percentage Infected Cells"},
+	{"dead_pct", "Percentage Dead Cells"},
+	{"total_virions", "Total Extracellular Virions"},
+	{"total_dips", "Total Extracellular DIPs"},
+	{"dip_only_pct", "Percentage Infected DIP-only Cells"},
+	{"both_pct", "Percentage Infected Both Cells"},
+}
 
-	// Create folder
-	os.Mkdir(outputFolder, os.ModePerm)
+// Function to run replicates simulations with seeds baseSeed+i, at most parallel at a time,
+// each in replicate_<i> under one replicates folder, then write aggregate_summary.csv over the
+// replicates that finished. A failed replicate does not stop the batch; with -retryFailed it
+// runs once more with seed baseSeed+replicates+i.
+func runReplicates(cfg Config, replicates, parallel int) error {
+	if parallel < 1 {
+		return fmt.Errorf("%w: parallel must be >= 1", ErrInvalidConfig)
+	}
+	if *flag_memoryBudgetMB < 0 {
+		return fmt.Errorf("%w: memoryBudgetMB must be >= 0", ErrInvalidConfig)
+	}
+	if *flag_memoryBudgetMB > 0 {
+		perRun := estimateRunMemoryMB()
+		fit := replicateConcurrency(parallel, *flag_memoryBudgetMB, perRun)
+		if float64(*flag_memoryBudgetMB) < perRun {
+			fmt.Printf("⚠️  One replicate needs about %.0f MB, over the %d MB budget; running one at a time\n", perRun, *flag_memoryBudgetMB)
+		} else if fit < parallel {
+			fmt.Printf("Memory budget %d MB fits %d replicates of about %.0f MB; running %d at a time instead of %d\n",
+				*flag_memoryBudgetMB, fit, perRun, fit, parallel)
+		}
+		parallel = fit
+	}
 
-	err := os.MkdirAll(outputFolder, os.ModePerm)
+	batch, err := newRunBatch(cfg, "replicates")
 	if err != nil {
-		log.Fatalf("Failed to create folder: %v", err)
+		return err
+	}
+
+	// One replicate at a time runs in this process; overlapping ones each need a process
+	runOne := batch.run
+	if parallel > 1 {
+		runOne = batch.runProcess
+	}
+	runDirs := make([]string, replicates)
+	runErrs := make([]error, replicates)
+	runAll := func(reps []int, retry bool) {
+		jobs := make(chan int)
+		var wg sync.WaitGroup
+		for w := 0; w < parallel; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for rep := range jobs {
+					seed := batch.baseSeed + int64(rep)
+					name := fmt.Sprintf("replicate_%03d", rep)
+					if retry {
+						seed += int64(replicates)
+						name += "_retry"
+					}
+					runDirs[rep] = filepath.Join(batch.folder, name)
+					fmt.Printf("Replicate %d: seed=%d\n", rep, seed)
+					_, runErrs[rep] = runOne(name, seed)
+				}
+			}()
+		}
+		for _, rep := range reps {
+			jobs <- rep
+		}
+		close(jobs)
+		wg.Wait()
 	}
-	saveCurrentGoFile(outputFolder)
-	csvFilePath := filepath.Join(outputFolder, "simulation_output.csv")
-	videoFilePath := filepath.Join(outputFolder, "video.mp4")
+	all := make([]int, replicates)
+	for rep := range all {
+		all[rep] = rep
+	}
+	runAll(all, false)
 
-	// Open a CSV file to record the infected states over time
-	file, err := os.Create(csvFilePath)
-	if err != nil {
-		log.Fatalf("Failed to create CSV file: %v", err)
+	if *flag_retryFailed {
+		var failed []int
+		for rep, runErr := range runErrs {
+			if runErr != nil {
+				fmt.Printf("⚠️  Replicate %s failed: %v; retrying with a new seed\n", runDirs[rep], runErr)
+				failed = append(failed, rep)
+			}
+		}
+		runAll(failed, true)
 	}
-	defer file.Close()
 
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
+	// Each replicate's run folder sits one level below its replicate_<i> folder
+	var runFolders []string
+	for rep, runErr := range runErrs {
+		if runErr != nil {
+			fmt.Printf("⚠️  Replicate %s failed: %v\n", runDirs[rep], runErr)
+			continue
+		}
+		matches, _ := filepath.Glob(filepath.Join(runDirs[rep], "*", "simulation_output.csv"))
+		if len(matches) != 1 {
+			fmt.Printf("⚠️  Replicate %s: found %d simulation_output.csv files\n", runDirs[rep], len(matches))
+			continue
+		}
+		runFolders = append(runFolders, filepath.Dir(matches[0]))
+	}
+	if len(runFolders) == 0 {
+		return fmt.Errorf("all %d replicates failed", replicates)
+	}
 
-	// Write the CSV headers
-	headers := []string{
-		"Time", "virion_half_life", "dip_half_life", "ifn_half_life", "Global IFN Concentration Per Cell", "Total Extracellular Virions",
-		"Total Extracellular DIPs", "Percentage Dead Cells", "Percentage Susceptible Cells",
-		"Percentage Infected Cells", "Percentage Infected DIP-only Cells",
-		"Percentage Infected Both Cells", "Percentage Antiviral Cells",
-		"Regrowth Count",
-		"Percentage Susceptible and Antiviral (Real Susceptible cells without regrowthed ones) Cells",
-		"Percentage Regrowthed or Regrowthed and Antiviral Cells",
-		"Probability Virion Infection", "Probability DIP Infection",
-		"Per Particle Infection Chance RHO", "Total Local Particles",
-		"Plaque Percentage", "max_global_IFN", "time_all_cells_uninfected",
-		"Percentage Uninfected Cells", "num_plaques", "GRID_SIZE", "TIMESTEP",
-		"IFN_DELAY", "STD_IFN_DELAY", "ALPHA", "RHO", "TAU", "BURST_SIZE_V",
-		"REGROWTH_MEAN", "REGROWTH_STD", "TIME_STEPS", "MEAN_LYSIS_TIME",
-		"STANDARD_LYSIS_TIME", "init_v_pfu_per_cell", "init_d_pfu_per_cell",
-		"MEAN_ANTI_TIME_Per_Cell", "STD_ANTI_TIME", "R", "BURST_SIZE_D", "H",
-		"option", "d_pfu_initial", "v_pfu_initial", "virionOnlyInfected", "dipOnlyInfected",
-		"bothInfected", "totalDeadFromV", "totalDeadFromBoth", "virionDiffusionRate", "dipDiffusionRate", "k_JumpR",
-		"jumpRadiusV", "jumpRadiusD", "jumpRandomly", "par_celltocell_random",
-		"allowVirionJump", "allowDIPJump", "IFN_wave_radius", "ifnWave",
-		"ifnBothFold", "D_only_IFN_stimulate_ratio", "BOTH_IFN_stimulate_ratio",
-		"totalRandomJumpVirions", "totalRandomJumpDIPs", "dipAdvantage",
+	aggregatePath := filepath.Join(batch.folder, "aggregate_summary.csv")
+	if err := aggregateReplicates(runFolders, replicates-len(runFolders), aggregatePath); err != nil {
+		return err
+	}
+	fmt.Printf("✅ %d/%d replicates aggregated into %s\n", len(runFolders), replicates, aggregatePath)
+	return nil
+}
+
+// renderMemoryMB is a rough allowance for the renderer's canvases, chart and video encoder
+const renderMemoryMB = 32
+
+// Function to estimate the memory in MB one run with the current flags needs: the Grid with its
+// fixed neighbor tables, the per-cell burst, continuous-release and IFN neighbor lists, and the
+// renderer when -render is on
+func estimateRunMemoryMB() float64 {
+	// Hexagonal disc of radius r, capped at the grid
+	disc := func(r int) int {
+		if r < 0 {
+			r = 0
+		}
+		return int(math.Min(float64(1+3*r*(r+1)), GRID_SIZE*GRID_SIZE))
+	}
+	continuousRadius := *flag_continuousRadius
+	if continuousRadius < 0 {
+		continuousRadius = *flag_burstRadius
+	}
+	ifnRadius := 0
+	if *flag_ifnSpreadOption == "local" {
+		ifnRadius = 10
+	}
+	bytes := float64(unsafe.Sizeof(Grid{}))
+	lists := disc(*flag_burstRadius) + disc(continuousRadius) + disc(ifnRadius)
+	bytes += float64(GRID_SIZE*GRID_SIZE*lists) * float64(unsafe.Sizeof([2]int{}))
+	mb := bytes / (1 << 20)
+	if *flag_render {
+		mb += renderMemoryMB
+	}
+	return mb
+}
+
+// Function to return how many replicates of perRunMB fit in budgetMB at once, at most parallel
+// and at least one
+func replicateConcurrency(parallel, budgetMB int, perRunMB float64) int {
+	fit := int(float64(budgetMB) / perRunMB)
+	if fit < 1 {
+		fit = 1
+	}
+	if fit > parallel {
+		fit = parallel
+	}
+	return fit
+}
+
+// Function to write per-timestep mean, sample standard deviation (n-1) and 2.5/97.5 percentiles
+// (linear interpolation between order statistics) of replicateColumns across run folders, with
+// the number of replicates that failed and are left out. Warm-up frames (-burnIn) are left out too.
+func aggregateReplicates(runFolders []string, failed int, outPath string) error {
+	// values[row][column] holds one value per replicate
+	var times []string
+	var values [][][]float64
+	for _, runFolder := range runFolders {
+		header, rows, err := loadOutputCSV(runFolder)
+		if err != nil {
+			return err
+		}
+		index := make(map[string]int, len(header))
+		for i, name := range header {
+			index[name] = i
+		}
+		for _, col := range replicateColumns {
+			if _, ok := index[col[1]]; !ok {
+				return fmt.Errorf("%s: simulation_output.csv has no %q column", runFolder, col[1])
+			}
+		}
+		if burnInColumn, ok := index["burnIn"]; ok {
+			kept := rows[:0]
+			for _, row := range rows {
+				if row[burnInColumn] != "true" {
+					kept = append(kept, row)
+				}
+			}
+			rows = kept
+		}
+		if times == nil {
+			for _, row := range rows {
+				times = append(times, row[index["Time"]])
+				values = append(values, make([][]float64, len(replicateColumns)))
+			}
+		}
+		if len(rows) != len(times) {
+			return fmt.Errorf("%s: %d rows, expected %d like the other replicates", runFolder, len(rows), len(times))
+		}
+		for r, row := range rows {
+			for c, col := range replicateColumns {
+				v, err := strconv.ParseFloat(row[index[col[1]]], 64)
+				if err != nil {
+					return fmt.Errorf("%s: bad %q value %q", runFolder, col[1], row[index[col[1]]])
+				}
+				values[r][c] = append(values[r][c], v)
+			}
+		}
 	}
 
-	err = writer.Write(headers)
+	out, err := createAtomicCSV(outPath)
 	if err != nil {
-		log.Fatalf("Failed to write CSV headers: %v", err)
+		return fmt.Errorf("%w: failed to create aggregate CSV: %v", ErrOutputIO, err)
+	}
+	defer out.Close()
+	header := []string{"Time", "replicates", "failed"}
+	for _, col := range replicateColumns {
+		header = append(header, col[0]+"_mean", col[0]+"_sd", col[0]+"_p2.5", col[0]+"_p97.5")
+	}
+	out.WriteRow(header)
+	format := func(v float64) string { return strconv.FormatFloat(v, 'f', 6, 64) }
+	for r, t := range times {
+		row := []string{t, strconv.Itoa(len(runFolders)), strconv.Itoa(failed)}
+		for c := range replicateColumns {
+			xs := append([]float64(nil), values[r][c]...)
+			sort.Float64s(xs)
+			mean, sd := sampleMeanSD(xs)
+			row = append(row, format(mean), format(sd), format(percentile(xs, 2.5)), format(percentile(xs, 97.5)))
+		}
+		if err := out.WriteRow(row); err != nil {
+			return fmt.Errorf("%w: failed to write aggregate CSV: %v", ErrOutputIO, err)
+		}
 	}
-
-	// Create an MJPEG video writer
-	videoWriter, err := mjpeg.New(videoFilePath, int32(GRID_SIZE*CELL_SIZE*2), int32(GRID_SIZE*CELL_SIZE*2), int32(FRAME_RATE))
-	if err != nil {
-		log.Fatalf("Failed to create MJPEG writer: %v", err) // Handle the error if the writer fails to create
+	if err := out.Commit(); err != nil {
+		return fmt.Errorf("%w: failed to finalize aggregate CSV: %v", ErrOutputIO, err)
 	}
-	defer videoWriter.Close() // Ensure the writer is closed when the program ends
-
-	var buf bytes.Buffer                       // Buffer for JPEG encoding
-	jpegOptions := &jpeg.Options{Quality: 100} // JPEG encoding options, quality set to 75
-
-	var frameNumbers []int            // Slice to store frame numbers
-	var deadCellPercentages []float64 // Slice to store dead cell percentages
-	virionOnly := make([]float64, TIME_STEPS)
-	dipOnly := make([]float64, TIME_STEPS)
-	both := make([]float64, TIME_STEPS)
-	// Ensure the first frame has valid values
-	virionOnly[0] = 0.0
-	dipOnly[0] = 0.0
-	both[0] = 0.0
-	// Output image save directory
-
-	var extractedImages []*image.RGBA          // Store selected frame images
-	selectedTimePoints := []int{7, 13, 19, 25} // Time points for saving simulation images
-
-	for frameNum := 0; frameNum < TIME_STEPS; frameNum++ {
-
-		grid.update(frameNum) // Update the grid state
-
-		// Experimental viral particle removal (if enabled)
-		grid.removeViralParticlesOutsideIFNRange(frameNum)
+	return nil
+}
 
-		// Call the function to record infected state counts at the specific frames
-		grid.recordSimulationData(writer, frameNum)
+// Function to return the mean and sample standard deviation (n-1; 0 for a single value)
+func sampleMeanSD(xs []float64) (float64, float64) {
+	mean := 0.0
+	for _, x := range xs {
+		mean += x
+	}
+	mean /= float64(len(xs))
+	if len(xs) < 2 {
+		return mean, 0
+	}
+	ss := 0.0
+	for _, x := range xs {
+		ss += (x - mean) * (x - mean)
+	}
+	return mean, math.Sqrt(ss / float64(len(xs)-1))
+}
 
-		// Calculate and record the percentage of dead cells, excluding regrowth cells
-		deadCellsPercentage := calculateDeadCellPercentage(grid.state)
-		frameNumbers = append(frameNumbers, frameNum)                          // Record the current frame number
-		deadCellPercentages = append(deadCellPercentages, deadCellsPercentage) // Record the percentage of dead cells
+// Function to return the p-th percentile (0-100) of sorted values, interpolating linearly
+// between the two nearest order statistics
+func percentile(sorted []float64, p float64) float64 {
+	pos := p / 100 * float64(len(sorted)-1)
+	lo := int(math.Floor(pos))
+	if lo+1 >= len(sorted) {
+		return sorted[len(sorted)-1]
+	}
+	return sorted[lo] + (pos-float64(lo))*(sorted[lo+1]-sorted[lo])
+}
 
-		// Calculate infection percentages
-		virionOnly[frameNum] = float64(grid.calculateVirionOnlyInfected()) / float64(GRID_SIZE*GRID_SIZE) * 100
-		dipOnly[frameNum] = float64(grid.calculateDipOnlyInfected()) / float64(GRID_SIZE*GRID_SIZE) * 100
-		both[frameNum] = float64(grid.calculateBothInfected()) / float64(GRID_SIZE*GRID_SIZE) * 100
+// sweepRange is one swept flag of -sweepRanges; integer flags get rounded samples
+type sweepRange struct {
+	name     string
+	min, max float64
+	integer  bool
+}
 
-		// Check if current frame is at one of the selected time points
-		for _, timePoint := range selectedTimePoints {
-			if frameNum == timePoint {
-				fmt.Printf("DEBUG: Saving simulation frame at frameNum=%d, timePoint=%d\n", frameNum, timePoint)
-				// Create simulation result image
-				img := grid.gridToImage(videotype)
-				extractedImages = append(extractedImages, img)
+// Function to parse -sweepRanges (name:min:max,...) against the registered flags
+func parseSweepRanges(text string) ([]sweepRange, error) {
+	var ranges []sweepRange
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(text, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		fields := strings.Split(part, ":")
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("range %q is not name:min:max", part)
+		}
+		r := sweepRange{name: strings.TrimSpace(fields[0])}
+		f := flag.Lookup(r.name)
+		if f == nil {
+			return nil, fmt.Errorf("range %q: no flag named %s", part, r.name)
+		}
+		switch r.name {
+		case "sweepMode", "sweepN", "sweepRanges", "replicates", "parallel", "randomSeed":
+			return nil, fmt.Errorf("range %q: %s is controlled by the sweep", part, r.name)
+		}
+		if seen[r.name] {
+			return nil, fmt.Errorf("range %q: %s given twice", part, r.name)
+		}
+		seen[r.name] = true
+		// Half-life flags have no Getter and take a bare number of hours
+		if getter, ok := f.Value.(flag.Getter); ok {
+			switch getter.Get().(type) {
+			case int, int64:
+				r.integer = true
+			case float64:
+			default:
+				return nil, fmt.Errorf("range %q: %s is not a numeric flag", part, r.name)
+			}
+		}
+		var err1, err2 error
+		r.min, err1 = strconv.ParseFloat(strings.TrimSpace(fields[1]), 64)
+		r.max, err2 = strconv.ParseFloat(strings.TrimSpace(fields[2]), 64)
+		if err1 != nil || err2 != nil || r.max < r.min {
+			return nil, fmt.Errorf("range %q needs numeric min <= max", part)
+		}
+		ranges = append(ranges, r)
+	}
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("no ranges given")
+	}
+	return ranges, nil
+}
 
-				// Save individual frame image as simulation result
-				individualFrameName := fmt.Sprintf("simulation_%d_hours.png", timePoint)
-				savePNGImage(img, filepath.Join(outputFolder, individualFrameName))
-				fmt.Printf("Saved simulation result frame: %s\n", individualFrameName)
+// Function to draw an n-point Latin-hypercube design: each range is cut into n equal strata,
+// every stratum is used exactly once per range, and the pairing of strata across ranges is a
+// random permutation. design[k][d] is the flag value of range d in sample k.
+func latinHypercube(ranges []sweepRange, n int, rng *rand.Rand) [][]string {
+	design := make([][]string, n)
+	for k := range design {
+		design[k] = make([]string, len(ranges))
+	}
+	for d, r := range ranges {
+		perm := rng.Perm(n)
+		for k := 0; k < n; k++ {
+			v := r.min + (float64(perm[k])+rng.Float64())/float64(n)*(r.max-r.min)
+			if r.integer {
+				design[k][d] = strconv.Itoa(int(math.Round(v)))
+			} else {
+				design[k][d] = strconv.FormatFloat(v, 'g', -1, 64)
 			}
 		}
+	}
+	return design
+}
 
-		if frameNum > 1 {
-			if frameNum%24 == 0 { // Save every 10 frames
+// Function to run a Latin-hypercube sweep: sweepN samples of the -sweepRanges box drawn with
+// -randomSeed, each run -replicates times (once if 0) with seeds randomSeed+i, so every sample
+// sees the same seeds. One row per sample goes to lhs_sweep.csv with the replicate means of the
+// end-of-run metrics. Runs are sequential, in this process.
+func runLHSSweep(cfg Config, mode string, n int, rangesText string) error {
+	if mode != "lhs" {
+		return fmt.Errorf("%w: invalid sweepMode %q (expected lhs)", ErrInvalidConfig, mode)
+	}
+	if n < 1 {
+		return fmt.Errorf("%w: sweepN must be >= 1", ErrInvalidConfig)
+	}
+	ranges, err := parseSweepRanges(rangesText)
+	if err != nil {
+		return fmt.Errorf("%w: invalid sweepRanges: %v", ErrInvalidConfig, err)
+	}
+	replicates := *flag_replicates
+	if replicates < 1 {
+		replicates = 1
+	}
 
-				img := grid.gridToImageWithGraph(frameNum, virionOnly[:frameNum+1], dipOnly[:frameNum+1], both[:frameNum+1], videotype, false)
+	var swept []string
+	for _, r := range ranges {
+		swept = append(swept, r.name)
+	}
+	batch, err := newRunBatch(cfg, "lhs_sweep", swept...)
+	if err != nil {
+		return err
+	}
+	design := latinHypercube(ranges, n, rand.New(rand.NewSource(batch.baseSeed)))
 
-				extractedImages = append(extractedImages, img)
+	out, err := createAtomicCSV(filepath.Join(batch.folder, "lhs_sweep.csv"))
+	if err != nil {
+		return fmt.Errorf("%w: failed to create sweep CSV: %v", ErrOutputIO, err)
+	}
+	defer out.Close()
+	header := []string{"sample"}
+	for _, r := range ranges {
+		header = append(header, r.name)
+	}
+	header = append(header, "baseSeed", "replicates_ok",
+		"final_infected_percentage", "final_plaque_percentage", "final_total_virions")
+	out.WriteRow(header)
+
+	for k, values := range design {
+		var infected, plaque, virions []float64
+		for rep := 0; rep < replicates; rep++ {
+			seed := batch.baseSeed + int64(rep)
+			var args []string
+			for d, r := range ranges {
+				args = append(args, "-"+r.name+"="+values[d])
+			}
+			name := fmt.Sprintf("sample_%04d_rep_%d", k, rep)
+			fmt.Printf("LHS sweep: sample %d/%d %v replicate=%d seed=%d\n", k+1, n, values, rep, seed)
+			summary, runErr := batch.run(name, seed, args...)
+			if runErr != nil {
+				fmt.Printf("⚠️  Sweep run %s failed: %v\n", name, runErr)
+				continue
 			}
+			infected = append(infected, summary.FinalInfectedPercentage)
+			plaque = append(plaque, summary.FinalPlaquePercentage)
+			virions = append(virions, float64(summary.FinalTotalVirions))
 		}
 
-		// Log `y` values before feeding them to the graph
-		log.Printf("Frame %d: Virion Only: %.2f%%, DIP Only: %.2f%%, Both: %.2f%%", frameNum, virionOnly[frameNum], dipOnly[frameNum], both[frameNum])
-		// Generate the graph only if there are at least two frames of data
-		var img *image.RGBA
-		if frameNum > 0 {
-			img = grid.gridToImageWithGraph(frameNum, virionOnly[:frameNum+1], dipOnly[:frameNum+1], both[:frameNum+1], videotype, true)
+		row := append([]string{strconv.Itoa(k)}, values...)
+		row = append(row, strconv.FormatInt(batch.baseSeed, 10), strconv.Itoa(len(infected)))
+		if len(infected) == 0 {
+			row = append(row, "", "", "")
 		} else {
-			// For the first frame, only render the grid without the graph
-			img = grid.gridToImage(videotype)
-		}
-
-		// Encode the image to JPEG format
-		err = jpeg.Encode(&buf, img, jpegOptions)
-		if err != nil {
-			log.Fatalf("Failed to encode image: %v", err)
+			for _, xs := range [][]float64{infected, plaque, virions} {
+				m, _ := sampleMeanSD(xs)
+				row = append(row, strconv.FormatFloat(m, 'f', 6, 64))
+			}
 		}
-
-		// Add the frame to the video
-		err = videoWriter.AddFrame(buf.Bytes())
-		if err != nil {
-			log.Fatalf("Failed to add frame: %v", err)
+		if err := out.WriteRow(row); err != nil {
+			return fmt.Errorf("%w: failed to write sweep CSV: %v", ErrOutputIO, err)
 		}
-		buf.Reset() // Reset the buffer for the next frame
+	}
 
-		if len(extractedImages) > 0 {
-			combinedImage := combineImagesHorizontally(extractedImages)
+	if err := out.Commit(); err != nil {
+		return fmt.Errorf("%w: failed to finalize sweep CSV: %v", ErrOutputIO, err)
+	}
+	fmt.Printf("✅ LHS sweep saved to %s\n", filepath.Join(batch.folder, "lhs_sweep.csv"))
+	return nil
+}
 
-			showLegend := false // ⬅️ Change here: control whether to add legend
+// runBatch is the scaffolding shared by the drivers that run many simulations (-replicates,
+// -dipAdvantageSweep and -sweepMode): one timestamped folder holding a
+// subfolder per run, the configuration passed on to every run and the base seed
+type runBatch struct {
+	folder    string
+	driverCfg Config // the driver's own configuration, restored after every in-process run
+	baseCfg   Config // driverCfg minus the driver flags and the ones the driver sets per run
+	baseSeed  int64  // -randomSeed, or a time-based seed when it is negative
+}
 
-			if showLegend {
-				legendWidth := 180
-				legendHeight := 80
-				legendX := combinedImage.Bounds().Dx() - legendWidth - 20
-				legendY := 20
+// batchDriverFlags select a driver or configure one, so they are never passed on to the runs.
+// -config is left out too: its values are already merged into the driver's configuration.
+var batchDriverFlags = map[string]bool{
+	"replicates": true, "parallel": true, "dipAdvantageSweep": true, "sweepReplicates": true,
+	"retryFailed": true, "memoryBudgetMB": true, "sweepMode": true, "sweepN": true, "sweepRanges": true,
+	"randomSeed": true, "config": true,
+}
 
-				draw.Draw(combinedImage,
-					image.Rect(legendX-5, legendY-5, legendX+legendWidth+5, legendY+legendHeight+5),
-					&image.Uniform{color.RGBA{255, 255, 255, 200}},
-					image.Point{}, draw.Over)
+// Function to start a batch in a new <prefix>_<timestamp> folder. The flags in controlled are
+// set per run by the driver and are left out of the configuration passed on.
+func newRunBatch(cfg Config, prefix string, controlled ...string) (*runBatch, error) {
+	skip := make(map[string]bool, len(controlled))
+	for _, name := range controlled {
+		skip[name] = true
+	}
+	batch := &runBatch{driverCfg: cfg, baseCfg: make(Config), baseSeed: *flag_randomSeed}
+	for name, value := range cfg {
+		if !batchDriverFlags[name] && !skip[name] {
+			batch.baseCfg[name] = value
+		}
+	}
+	if batch.baseSeed < 0 {
+		batch.baseSeed = time.Now().UnixNano() % 1000000007
+	}
 
-				addStaticLegend(combinedImage, legendX, legendY)
-			}
+	batch.folder = fmt.Sprintf("%s_%s", prefix, time.Now().Format("20060102_150405"))
+	if err := os.MkdirAll(batch.folder, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("%w: failed to create %s folder: %v", ErrOutputIO, prefix, err)
+	}
+	return batch, nil
+}
 
-			savePNGImage(combinedImage, filepath.Join(outputFolder, "selected_frames_combined.png"))
+// Function to build the configuration of one run: the base configuration, the extra
+// -name=value flags and the seed
+func (b *runBatch) runConfig(seed int64, args []string) (Config, error) {
+	cfg := make(Config, len(b.baseCfg)+len(args)+1)
+	for name, value := range b.baseCfg {
+		cfg[name] = value
+	}
+	for _, arg := range args {
+		name, value, ok := strings.Cut(strings.TrimPrefix(arg, "-"), "=")
+		if !ok {
+			return nil, fmt.Errorf("%w: batch flag %q is not -name=value", ErrInvalidConfig, arg)
 		}
+		cfg[name] = value
 	}
-	log.Println("Video and graph saved successfully.") // Print a success message
-	fmt.Println("ifnWave is ", ifnWave)
+	cfg["randomSeed"] = strconv.FormatInt(seed, 10)
+	return cfg, nil
+}
 
-	// Generate comparison plots including composite_4x2_comparison.png
-	generateComparisonPlots(outputFolder)
+// runSimulation is the entry point batch runs call in-process; tests replace it to inject failures
+var runSimulation = Run
+
+// Function to run one simulation of the batch in-process, in the subfolder name with the given
+// seed and extra flags on top of the base configuration, and return its summary. The run's
+// console output goes to run.log in the subfolder. A panic is recorded in failure.txt in the
+// subfolder and returned as ErrCrashed, so one failed run does not end the batch.
+func (b *runBatch) run(name string, seed int64, args ...string) (summary SimulationSummary, err error) {
+	runDir := filepath.Join(b.folder, name)
+	if err := os.MkdirAll(runDir, os.ModePerm); err != nil {
+		return SimulationSummary{}, fmt.Errorf("%w: failed to create run folder: %v", ErrOutputIO, err)
+	}
+	cfg, err := b.runConfig(seed, args)
+	if err != nil {
+		return SimulationSummary{}, err
+	}
+	logFile, err := os.Create(filepath.Join(runDir, "run.log"))
+	if err != nil {
+		return SimulationSummary{}, fmt.Errorf("%w: failed to create run log: %v", ErrOutputIO, err)
+	}
+	defer logFile.Close()
+
+	stdout := os.Stdout
+	os.Stdout = logFile
+	log.SetOutput(logFile)
+	defer func() {
+		// Run recovers its own panics once its run folder exists; this catches the rest
+		if r := recover(); r != nil {
+			recordRunFailure(runDir, r)
+			err = fmt.Errorf("%w: %v", ErrCrashed, r)
+		}
+		os.Stdout = stdout
+		log.SetOutput(os.Stderr)
+		// Run leaves the flags at the run's values; the driver reads its own
+		if applyErr := applyConfig(b.driverCfg); applyErr != nil && err == nil {
+			err = applyErr
+		}
+	}()
+	result, err := runSimulation(cfg, RunOptions{OutputRoot: runDir})
+	return result.Summary, err
 }
 
-// Function to remove viral particles outside IFN range at specified timepoint (72 hours)
-func (g *Grid) removeViralParticlesOutsideIFNRange(frameNum int) {
-	// Check if this is the removal timepoint (72 hours)
-	if !enableParticleRemoval || frameNum != removalTimepoint {
-		return // IFN范围判定逻辑只在指定时间点（默认72小时）执行
+// Function to run one simulation of the batch as a child process of this binary, like run.
+// Run keeps its state in package variables, so runs that overlap (-parallel > 1) need their
+// own process.
+func (b *runBatch) runProcess(name string, seed int64, args ...string) (SimulationSummary, error) {
+	runDir := filepath.Join(b.folder, name)
+	if err := os.MkdirAll(runDir, os.ModePerm); err != nil {
+		return SimulationSummary{}, fmt.Errorf("%w: failed to create run folder: %v", ErrOutputIO, err)
+	}
+	cfg, err := b.runConfig(seed, args)
+	if err != nil {
+		return SimulationSummary{}, err
 	}
+	executable, err := os.Executable()
+	if err != nil {
+		return SimulationSummary{}, fmt.Errorf("cannot locate simulator binary: %v", err)
+	}
+	names := make([]string, 0, len(cfg))
+	for name := range cfg {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	runArgs := make([]string, 0, len(names))
+	for _, name := range names {
+		runArgs = append(runArgs, "-"+name+"="+cfg[name])
+	}
+	return runChildSimulation(executable, runDir, runArgs)
+}
 
-	// 只有在达到移除时间点时才打印这条消息和执行IFN范围判定
-	fmt.Printf("=== Executing viral particle removal at Frame %d (%d hours) ===\n", frameNum, removalTimepoint)
+// Function to run this binary once in runDir with args and read back its summary.json
+func runChildSimulation(executable, runDir string, args []string) (SimulationSummary, error) {
+	var summary SimulationSummary
+	cmd := exec.Command(executable, args...)
+	cmd.Dir = runDir
+	logFile, err := os.Create(filepath.Join(runDir, "run.log"))
+	if err != nil {
+		return summary, err
+	}
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	runErr := cmd.Run()
+	logFile.Close()
+	if runErr != nil {
+		return summary, runErr
+	}
 
-	removedVirions := 0
-	removedDIPs := 0
-	totalCellsProcessed := 0
+	matches, _ := filepath.Glob(filepath.Join(runDir, "*", "summary.json"))
+	if len(matches) != 1 {
+		return summary, fmt.Errorf("found %d summary.json files", len(matches))
+	}
+	data, err := ioutil.ReadFile(matches[0])
+	if err != nil {
+		return summary, err
+	}
+	err = json.Unmarshal(data, &summary)
+	return summary, err
+}
 
-	for i := 0; i < GRID_SIZE; i++ {
-		for j := 0; j < GRID_SIZE; j++ {
-			// Check if there are any viral particles in this cell
-			if g.localVirions[i][j] > 0 || g.localDips[i][j] > 0 {
-				// Calculate local IFN concentration
-				localIFN := 0.0
-				if ifnWave && len(g.neighborsIFNArea[i][j]) > 0 {
-					var regionalSumIFN float64
-					neighborsCount := len(g.neighborsIFNArea[i][j])
-					for _, neighbor := range g.neighborsIFNArea[i][j] {
-						ni, nj := neighbor[0], neighbor[1]
-						regionalSumIFN += g.IFNConcentration[ni][nj]
-					}
-					localIFN = regionalSumIFN / float64(neighborsCount)
-				}
+// BaselineDiff is written to baseline_diff.json by -baseline
+type BaselineDiff struct {
+	Baseline            string         `json:"baseline"`
+	Tolerance           float64        `json:"tolerance"`
+	Diverged            bool           `json:"diverged"`
+	FirstDivergentFrame int            `json:"first_divergent_frame"` // earliest divergent CSV frame (-1 if none)
+	Endpoints           []EndpointDiff `json:"endpoints"`             // summary.json metrics that differ
+	Curves              []CurveDiff    `json:"curves"`                // simulation_output.csv columns that differ
+	MissingInRun        []string       `json:"missing_in_run"`        // metrics/columns only in the baseline
+	MissingInBaseline   []string       `json:"missing_in_baseline"`   // metrics/columns only in this run
+}
 
-				// If IFN concentration is below threshold (outside IFN range), remove viral particles
-				if localIFN < ifnThreshold {
-					// Count particles to be removed
-					removedVirions += g.localVirions[i][j]
-					if removeVirionAndDIP {
-						removedDIPs += g.localDips[i][j]
-					}
+// EndpointDiff is one differing summary.json metric (nested values flattened to dotted keys)
+type EndpointDiff struct {
+	Metric   string  `json:"metric"`
+	Baseline string  `json:"baseline"`
+	Run      string  `json:"run"`
+	Delta    float64 `json:"delta"` // run - baseline (0 for non-numeric values)
+}
 
-					// Remove viral particles (but keep cell state unchanged)
-					g.localVirions[i][j] = 0
-					if removeVirionAndDIP {
-						g.localDips[i][j] = 0
-					}
+// CurveDiff is one simulation_output.csv column that diverges from the baseline
+type CurveDiff struct {
+	Column              string  `json:"column"`
+	FirstDivergentFrame int     `json:"first_divergent_frame"`
+	MaxAbsDiff          float64 `json:"max_abs_diff"`
+	FinalBaseline       string  `json:"final_baseline"`
+	FinalRun            string  `json:"final_run"`
+}
 
-					totalCellsProcessed++
-				}
+// Function to report whether two values differ beyond the baseline tolerance
+func valuesDiverge(a, b, tol float64) bool {
+	return math.Abs(a-b) > tol*math.Max(1, math.Max(math.Abs(a), math.Abs(b)))
+}
+
+// Function to flatten summary.json into dotted keys with their values formatted as strings
+func flattenSummary(prefix string, value interface{}, out map[string]string) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			name := key
+			if prefix != "" {
+				name = prefix + "." + key
 			}
+			flattenSummary(name, child, out)
+		}
+	case []interface{}:
+		for idx, child := range v {
+			flattenSummary(fmt.Sprintf("%s[%d]", prefix, idx), child, out)
 		}
+	case float64:
+		out[prefix] = strconv.FormatFloat(v, 'g', -1, 64)
+	default:
+		out[prefix] = fmt.Sprint(v)
 	}
+}
 
-	fmt.Printf("=== Frame %d (%dh): Viral Particle Removal Results ===\n", frameNum, removalTimepoint)
-	fmt.Printf("    Removed Virions: %d\n", removedVirions)
-	fmt.Printf("    Removed DIPs: %d\n", removedDIPs)
-	fmt.Printf("    Cells processed (outside IFN range): %d\n", totalCellsProcessed)
-	fmt.Printf("    IFN threshold used: %.3f\n", ifnThreshold)
-	fmt.Printf("=== End of viral particle removal ===\n")
+// Function to load a run folder's summary.json as flattened metrics
+func loadSummaryMetrics(runFolder string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(runFolder, "summary.json"))
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("bad summary.json in %s: %v", runFolder, err)
+	}
+	metrics := make(map[string]string)
+	flattenSummary("", raw, metrics)
+	return metrics, nil
 }
 
-// Function to generate comparison plots (log and linear scale)
-func generateComparisonPlots(outputFolder string) {
-	// Check if simulation_output.csv exists
-	simulationCSVPath := filepath.Join(outputFolder, "simulation_output.csv")
-	if _, err := os.Stat(simulationCSVPath); os.IsNotExist(err) {
-		fmt.Printf("⚠️  Cannot create comparison plots. Missing simulation_output.csv\n")
-		return
+// Function to load a run folder's simulation_output.csv as header plus rows
+func loadOutputCSV(runFolder string) ([]string, [][]string, error) {
+	file, err := os.Open(filepath.Join(runFolder, "simulation_output.csv"))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		return nil, nil, fmt.Errorf("bad simulation_output.csv in %s: %v", runFolder, err)
 	}
+	if len(records) == 0 {
+		return nil, nil, fmt.Errorf("empty simulation_output.csv in %s", runFolder)
+	}
+	return records[0], records[1:], nil
+}
 
-	// Check if infection_counts_by_time.csv exists in current directory
-	experimentalCSVPath := "infection_counts_by_time.csv"
-	if _, err := os.Stat(experimentalCSVPath); os.IsNotExist(err) {
-		fmt.Printf("⚠️  Cannot create comparison plots. Missing infection_counts_by_time.csv\n")
-		return
+// Function to compare two CSV or summary values; numbers (and booleans) within tol are equal,
+// anything else must match exactly. Returns whether they differ and run - baseline when numeric.
+func compareValues(baseline, run string, tol float64) (bool, float64) {
+	parse := func(s string) (float64, bool) {
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f, true
+		}
+		if b, err := strconv.ParseBool(s); err == nil {
+			if b {
+				return 1, true
+			}
+			return 0, true
+		}
+		return 0, false
 	}
+	a, okA := parse(baseline)
+	b, okB := parse(run)
+	if okA && okB {
+		return valuesDiverge(a, b, tol), b - a
+	}
+	return baseline != run, 0
+}
 
-	// Run the Python script to generate comparison plots
-	// The script reads simulation_output.csv from the output folder and infection_counts_by_time.csv from current directory
-	cmd := exec.Command("python3", "create_comparison_plot.py", outputFolder)
-	cmd.Dir = "." // Run from current directory so it can find infection_counts_by_time.csv
+// Function to compare this run's CSV and summary with a baseline run folder, print a table of
+// differences and write baseline_diff.json into outputFolder
+func compareWithBaseline(baselineFolder, outputFolder string, tol float64) (BaselineDiff, error) {
+	diff := BaselineDiff{Baseline: baselineFolder, Tolerance: tol, FirstDivergentFrame: -1,
+		Endpoints: []EndpointDiff{}, Curves: []CurveDiff{}, MissingInRun: []string{}, MissingInBaseline: []string{}}
 
-	output, err := cmd.CombinedOutput()
+	// Endpoints from summary.json
+	baseMetrics, err := loadSummaryMetrics(baselineFolder)
 	if err != nil {
-		fmt.Printf("❌ Error running comparison plot script: %v\n", err)
-		fmt.Printf("Output: %s\n", string(output))
-		return
+		return diff, err
+	}
+	runMetrics, err := loadSummaryMetrics(outputFolder)
+	if err != nil {
+		return diff, err
+	}
+	for metric, baseValue := range baseMetrics {
+		runValue, ok := runMetrics[metric]
+		if !ok {
+			diff.MissingInRun = append(diff.MissingInRun, "summary:"+metric)
+			continue
+		}
+		if differs, delta := compareValues(baseValue, runValue, tol); differs {
+			diff.Endpoints = append(diff.Endpoints, EndpointDiff{Metric: metric, Baseline: baseValue, Run: runValue, Delta: delta})
+		}
+	}
+	for metric := range runMetrics {
+		if _, ok := baseMetrics[metric]; !ok {
+			diff.MissingInBaseline = append(diff.MissingInBaseline, "summary:"+metric)
+		}
 	}
 
-	fmt.Printf("✅ Successfully generated comparison plots:\n")
-	fmt.Printf("   - comparison_plot_log.png\n")
-	fmt.Printf("   - comparison_plot_linear.png\n")
-	fmt.Printf("   - comparison_plot_log.pdf\n")
-	fmt.Printf("   - comparison_plot_linear.pdf\n")
-	fmt.Printf("   - composite_4x2_comparison.png\n")
+	// Curves from simulation_output.csv, matched by column name and row (frame)
+	baseHeader, baseRows, err := loadOutputCSV(baselineFolder)
+	if err != nil {
+		return diff, err
+	}
+	runHeader, runRows, err := loadOutputCSV(outputFolder)
+	if err != nil {
+		return diff, err
+	}
+	runCol := make(map[string]int)
+	for idx, name := range runHeader {
+		runCol[name] = idx
+	}
+	baseCol := make(map[string]int)
+	for idx, name := range baseHeader {
+		baseCol[name] = idx
+		if _, ok := runCol[name]; !ok {
+			diff.MissingInRun = append(diff.MissingInRun, "csv:"+name)
+		}
+	}
+	for _, name := range runHeader {
+		if _, ok := baseCol[name]; !ok {
+			diff.MissingInBaseline = append(diff.MissingInBaseline, "csv:"+name)
+		}
+	}
+
+	frames := len(baseRows)
+	if len(runRows) < frames {
+		frames = len(runRows)
+	}
+	if len(baseRows) != len(runRows) {
+		// The shorter run ends where the longer one continues
+		diff.FirstDivergentFrame = frames
+	}
+	for _, name := range baseHeader {
+		ri, ok := runCol[name]
+		if !ok {
+			continue
+		}
+		bi := baseCol[name]
+		curve := CurveDiff{Column: name, FirstDivergentFrame: -1}
+		for frame := 0; frame < frames; frame++ {
+			if bi >= len(baseRows[frame]) || ri >= len(runRows[frame]) {
+				continue
+			}
+			differs, delta := compareValues(baseRows[frame][bi], runRows[frame][ri], tol)
+			if !differs {
+				continue
+			}
+			if curve.FirstDivergentFrame == -1 {
+				curve.FirstDivergentFrame = frame
+			}
+			curve.MaxAbsDiff = math.Max(curve.MaxAbsDiff, math.Abs(delta))
+		}
+		if curve.FirstDivergentFrame == -1 {
+			continue
+		}
+		if frames > 0 {
+			curve.FinalBaseline = baseRows[frames-1][bi]
+			curve.FinalRun = runRows[frames-1][ri]
+		}
+		diff.Curves = append(diff.Curves, curve)
+		if diff.FirstDivergentFrame == -1 || curve.FirstDivergentFrame < diff.FirstDivergentFrame {
+			diff.FirstDivergentFrame = curve.FirstDivergentFrame
+		}
+	}
+
+	sort.Slice(diff.Endpoints, func(a, b int) bool { return diff.Endpoints[a].Metric < diff.Endpoints[b].Metric })
+	sort.Slice(diff.Curves, func(a, b int) bool {
+		if diff.Curves[a].FirstDivergentFrame != diff.Curves[b].FirstDivergentFrame {
+			return diff.Curves[a].FirstDivergentFrame < diff.Curves[b].FirstDivergentFrame
+		}
+		return diff.Curves[a].Column < diff.Curves[b].Column
+	})
+	sort.Strings(diff.MissingInRun)
+	sort.Strings(diff.MissingInBaseline)
+	diff.Diverged = len(diff.Endpoints) > 0 || diff.FirstDivergentFrame != -1
+
+	// Compact table on stdout
+	fmt.Printf("\n📏 Baseline comparison against %s (tolerance %g)\n", baselineFolder, tol)
+	if !diff.Diverged {
+		fmt.Println("  ✅ No differences in summary endpoints or CSV curves")
+	}
+	if len(diff.Endpoints) > 0 {
+		fmt.Printf("  %-40s %20s %20s %14s\n", "endpoint", "baseline", "run", "delta")
+		for _, e := range diff.Endpoints {
+			fmt.Printf("  %-40s %20s %20s %14.6g\n", e.Metric, e.Baseline, e.Run, e.Delta)
+		}
+	}
+	if len(diff.Curves) > 0 {
+		fmt.Printf("  %-40s %12s %14s %16s %16s\n", "curve", "first frame", "max |diff|", "final baseline", "final run")
+		for _, c := range diff.Curves {
+			fmt.Printf("  %-40s %12d %14.6g %16s %16s\n", c.Column, c.FirstDivergentFrame, c.MaxAbsDiff, c.FinalBaseline, c.FinalRun)
+		}
+	}
+	if len(baseRows) != len(runRows) {
+		fmt.Printf("  ⚠️ Frame count differs: baseline %d, run %d\n", len(baseRows), len(runRows))
+	}
+	for _, m := range diff.MissingInRun {
+		fmt.Printf("  ⚠️ Missing in this run: %s\n", m)
+	}
+	for _, m := range diff.MissingInBaseline {
+		fmt.Printf("  ⚠️ Missing in baseline: %s\n", m)
+	}
+
+	data, err := json.MarshalIndent(diff, "", "  ")
+	if err != nil {
+		return diff, err
+	}
+	diffPath := filepath.Join(outputFolder, "baseline_diff.json")
+	if err := ioutil.WriteFile(diffPath, data, 0644); err != nil {
+		return diff, err
+	}
+	fmt.Printf("Saved baseline comparison: %s\n", diffPath)
+	return diff, nil
 }
 
 // Find the nearest unmasked cell to (i,j); returns the input if already unmasked
@@ -4745,13 +8754,9 @@ func (g *Grid) findNearestUnmasked(i, j int) (int, int) {
 		}
 	}
 	for rad := 1; rad < GRID_SIZE; rad++ {
-		ring := generateHexRing(i, j, rad)
-		for _, nb := range ring {
-			nx, ny := nb[0], nb[1]
-			if nx >= 0 && nx < GRID_SIZE && ny >= 0 && ny < GRID_SIZE {
-				if !g.unexposedMask[nx][ny] {
-					return nx, ny
-				}
+		for _, nb := range wrapNeighbors(generateHexRing(i, j, rad), [2]int{i, j}) {
+			if !g.unexposedMask[nb[0]][nb[1]] {
+				return nb[0], nb[1]
 			}
 		}
 	}
@@ -0,0 +1,2821 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Function to run one headless simulation in a fresh temporary folder
+func runForTest(t *testing.T, cfg Config) (RunResult, error) {
+	t.Helper()
+	full := Config{"render": "false"}
+	for name, value := range cfg {
+		full[name] = value
+	}
+	return Run(full, RunOptions{OutputRoot: t.TempDir(), SkipPlots: true})
+}
+
+func TestRunFailurePaths(t *testing.T) {
+	notADir := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(notADir, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name string
+		cfg  Config
+		opts RunOptions
+		want error
+	}{
+		{"unknown flag", Config{"noSuchFlag": "1"}, RunOptions{}, ErrInvalidConfig},
+		{"bad flag value", Config{"rho": "abc"}, RunOptions{}, ErrInvalidConfig},
+		{"invalid boundary", Config{"boundary": "klein"}, RunOptions{}, ErrInvalidConfig},
+		{"burn-in past the run", Config{"burnIn": "26"}, RunOptions{}, ErrInvalidConfig},
+		{"unknown ifnSpreadOption", Config{"ifnSpreadOption": "everywhere"}, RunOptions{}, ErrInvalidConfig},
+		{"infinite diffusion coefficient", Config{"ifnModel": "diffusion", "ifnDiffusionCoeff": "+Inf"}, RunOptions{}, ErrInvalidConfig},
+		{"perCell decay under diffusion", Config{"ifnModel": "diffusion", "ifnDecay": "perCell"}, RunOptions{}, ErrInvalidConfig},
+		{"empty focus", Config{"option": "5", "foci": "20,20,10,0;40,40,0,0"}, RunOptions{}, ErrInvalidConfig},
+		{"output root is a file", Config{"render": "false"}, RunOptions{OutputRoot: notADir}, ErrOutputIO},
+		{"missing baseline", Config{"render": "false", "baseline": filepath.Join(t.TempDir(), "missing")}, RunOptions{}, ErrOutputIO},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			opts := c.opts
+			if opts.OutputRoot == "" {
+				opts.OutputRoot = t.TempDir()
+			}
+			_, err := Run(c.cfg, opts)
+			if !errors.Is(err, c.want) {
+				t.Fatalf("Run error = %v, want %v", err, c.want)
+			}
+		})
+	}
+}
+
+func TestRunDoesNotLeakStateBetweenRuns(t *testing.T) {
+	first, err := runForTest(t, Config{"randomSeed": "7"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// noIFN zeroes ALPHA and the IFN delays, and the run totals accumulate in package variables
+	if _, err := runForTest(t, Config{"randomSeed": "8", "ifnSpreadOption": "noIFN", "rho": "0.5"}); err != nil {
+		t.Fatal(err)
+	}
+	again, err := runForTest(t, Config{"randomSeed": "7"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Summary.StateHash != again.Summary.StateHash {
+		t.Fatalf("same seed after another run: state hash %s, want %s", again.Summary.StateHash, first.Summary.StateHash)
+	}
+	a, err := os.ReadFile(filepath.Join(first.OutputFolder, "simulation_output.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filepath.Join(again.OutputFolder, "simulation_output.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(a) != string(b) {
+		t.Fatal("same seed after another run: simulation_output.csv differs")
+	}
+}
+
+// Function to run -replicates=3 from a fresh working folder with the replicate seeded seed+1
+// panicking, and return the batch folder and its aggregate_summary.csv rows
+func runReplicatesWithPanic(t *testing.T, cfg Config) (string, [][]string) {
+	t.Helper()
+	t.Chdir(t.TempDir())
+	t.Cleanup(func() { runSimulation = Run })
+	runSimulation = func(cfg Config, opts RunOptions) (RunResult, error) {
+		if cfg["randomSeed"] == "101" {
+			panic("injected failure")
+		}
+		return Run(cfg, opts)
+	}
+	cfg["render"], cfg["randomSeed"] = "false", "100"
+	if err := applyConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := runReplicates(cfg, 3, 1); err != nil {
+		t.Fatal(err)
+	}
+	folders, _ := filepath.Glob("replicates_*")
+	if len(folders) != 1 {
+		t.Fatalf("found %d replicates folders, want 1", len(folders))
+	}
+	f, err := os.Open(filepath.Join(folders[0], "aggregate_summary.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return folders[0], rows
+}
+
+func TestReplicatesSurviveAPanickingRun(t *testing.T) {
+	folder, rows := runReplicatesWithPanic(t, Config{})
+	if _, err := os.Stat(filepath.Join(folder, "replicate_001", "failure.txt")); err != nil {
+		t.Fatalf("failure not recorded: %v", err)
+	}
+	if rows[0][1] != "replicates" || rows[0][2] != "failed" {
+		t.Fatalf("aggregate header %v", rows[0][:3])
+	}
+	for _, row := range rows[1:] {
+		if row[1] != "2" || row[2] != "1" {
+			t.Fatalf("time %s: %s replicates, %s failed; want 2 and 1", row[0], row[1], row[2])
+		}
+	}
+}
+
+func TestReplicatesRetryFailedWithNewSeed(t *testing.T) {
+	folder, rows := runReplicatesWithPanic(t, Config{"retryFailed": "true"})
+	if _, err := os.Stat(filepath.Join(folder, "replicate_001_retry", "run.log")); err != nil {
+		t.Fatalf("failed replicate not retried: %v", err)
+	}
+	if row := rows[len(rows)-1]; row[1] != "3" || row[2] != "0" {
+		t.Fatalf("%s replicates, %s failed; want 3 and 0", row[1], row[2])
+	}
+}
+
+func TestReplicateConcurrencyFitsBudget(t *testing.T) {
+	cases := []struct {
+		parallel, budgetMB int
+		perRunMB           float64
+		want               int
+	}{
+		{8, 1000, 300, 3},
+		{2, 1000, 300, 2},
+		{8, 100, 300, 1},
+	}
+	for _, c := range cases {
+		if got := replicateConcurrency(c.parallel, c.budgetMB, c.perRunMB); got != c.want {
+			t.Errorf("replicateConcurrency(%d, %d, %g) = %d, want %d", c.parallel, c.budgetMB, c.perRunMB, got, c.want)
+		}
+	}
+	if mb := estimateRunMemoryMB(); mb <= 0 || math.IsNaN(mb) {
+		t.Errorf("estimateRunMemoryMB() = %g", mb)
+	}
+}
+
+// Function to return an initialized grid with a seeded random stream, with the flags in cfg
+// applied on top of the defaults for the test
+func newTestGrid(t *testing.T, cfg Config) *Grid {
+	t.Helper()
+	if err := applyConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { applyConfig(Config{}) })
+	g := new(Grid)
+	g.restoreRNG(1, 0)
+	g.initialize()
+	return g
+}
+
+func TestAntiviralDurationCountsTheEntryFrame(t *testing.T) {
+	for _, duration := range []int{1, 2, 5} {
+		g := newTestGrid(t, Config{"antiviralDuration": strconv.Itoa(duration), "antiviralDurationStd": "0"})
+		g.state[10][10] = ANTIVIRAL // turned ANTIVIRAL in frame 0's update
+		visible := 0
+		for frame := 0; frame < duration+3 && g.state[10][10] == ANTIVIRAL; frame++ {
+			g.handleAntiviralExit(frame)
+			if g.state[10][10] == ANTIVIRAL {
+				visible++
+			}
+		}
+		if visible != duration {
+			t.Errorf("antiviralDuration=%d: ANTIVIRAL in %d frames, want %d", duration, visible, duration)
+		}
+	}
+}
+
+func TestAntiviralCountMatchesFinalAntiviralCells(t *testing.T) {
+	// Virions scattered over the whole grid, so IFN is high everywhere; antiviral cells never revert
+	result, err := runForTest(t, Config{"option": "3", "v_pfu_initial": "20", "randomSeed": "7"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, rows, err := loadOutputCSV(result.OutputFolder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	column := make(map[string]int, len(header))
+	for c, name := range header {
+		column[name] = c
+	}
+	previous := []string(nil)
+	for _, row := range rows {
+		// Each frame adds one hour per cell that was already ANTIVIRAL
+		if previous != nil {
+			added := atoiForTest(t, row[column["totalAntiviralTime"]]) - atoiForTest(t, previous[column["totalAntiviralTime"]])
+			if want := atoiForTest(t, previous[column["antiviralCellCount"]]); added != want {
+				t.Fatalf("t=%s: totalAntiviralTime grew by %d, want %d", row[0], added, want)
+			}
+		}
+		previous = row
+	}
+	last := rows[len(rows)-1]
+	percentage, err := strconv.ParseFloat(last[column["Percentage Antiviral Cells"]], 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := atoiForTest(t, last[column["antiviralCellCount"]])
+	if antiviral := int(math.Round(percentage * GRID_SIZE * GRID_SIZE / 100)); count == 0 || count != antiviral {
+		t.Fatalf("antiviralCellCount = %d with %d ANTIVIRAL cells at the end, want a positive count equal to it", count, antiviral)
+	}
+}
+
+// Function to parse an integer CSV field
+func atoiForTest(t *testing.T, field string) int {
+	t.Helper()
+	n, err := strconv.Atoi(field)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestRegrowthMaturesAfterMaturationTime(t *testing.T) {
+	g := newTestGrid(t, Config{"regrowthMaturationTime": "5", "regrowthMaturationStd": "0"})
+	g.state[10][10] = REGROWTH // a dead cell regrew in frame 30's update, with no virus around
+	for frame := 30; frame <= 36; frame++ {
+		g.handleRegrowthMaturation(frame)
+		want := REGROWTH
+		if frame >= 35 {
+			want = SUSCEPTIBLE
+		}
+		if g.state[10][10] != want {
+			t.Fatalf("frame %d: state %s, want %s", frame, stateNames[g.state[10][10]], stateNames[want])
+		}
+	}
+	if g.everRegrownCount != 1 {
+		t.Fatalf("everRegrownCount = %d, want 1", g.everRegrownCount)
+	}
+}
+
+func TestRegrowthDelayIsDrawnOncePerDeath(t *testing.T) {
+	g := newTestGrid(t, Config{"regrowthModel": "timer"})
+	g.initializeNeighbors()
+	// Isolated DEAD cells, each surrounded by SUSCEPTIBLE cells, all dying at frame 0
+	var dead [][2]int
+	for i := 1; i < GRID_SIZE; i += 3 {
+		for j := 1; j < GRID_SIZE; j += 3 {
+			g.state[i][j] = DEAD
+			g.timeSinceDead[i][j] = 0
+			dead = append(dead, [2]int{i, j})
+		}
+	}
+	var delays []float64
+	for frame := 1; frame <= 3*int(REGROWTH_MEAN) && len(delays) < len(dead); frame++ {
+		newGrid := g.state
+		g.regrowDeadCells(&newGrid)
+		for _, cell := range dead {
+			if g.state[cell[0]][cell[1]] == DEAD && newGrid[cell[0]][cell[1]] == REGROWTH {
+				delays = append(delays, float64(frame))
+			}
+		}
+		g.state = newGrid
+	}
+	if len(delays) != len(dead) {
+		t.Fatalf("%d of %d DEAD cells regrew", len(delays), len(dead))
+	}
+	mean, variance := 0.0, 0.0
+	for _, d := range delays {
+		mean += d
+	}
+	mean /= float64(len(delays))
+	for _, d := range delays {
+		variance += (d - mean) * (d - mean)
+	}
+	std := math.Sqrt(variance / float64(len(delays)-1))
+	// The delay is the truncated Normal(REGROWTH_MEAN, REGROWTH_STD) draw, so its mean sits about half
+	// an hour below REGROWTH_MEAN. Redrawing every hour would give the minimum over the hours instead,
+	// with a mean several hours early and a much smaller spread.
+	if math.Abs(mean-(REGROWTH_MEAN-0.5)) > 1 || math.Abs(std-REGROWTH_STD) > 1 {
+		t.Fatalf("regrowth delay mean %.2f, std %.2f over %d cells, want about %.1f and %.1f", mean, std, len(delays), REGROWTH_MEAN-0.5, REGROWTH_STD)
+	}
+}
+
+func TestEdgePressureFillsPlaquesFromTheRim(t *testing.T) {
+	g := newTestGrid(t, Config{"regrowthModel": "edgePressure", "regrowthEdgeRate": "0.1"})
+	g.initializeNeighbors()
+	const radius = 8
+	center := [2]int{GRID_SIZE / 2, GRID_SIZE / 2}
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			if getHexDistanceBetweenPoints(center[0], center[1], i, j) <= radius {
+				g.state[i][j] = DEAD
+				g.timeSinceDead[i][j] = 0
+			}
+		}
+	}
+	for frame := 0; frame < 12; frame++ {
+		newGrid := g.state
+		g.regrowDeadCells(&newGrid)
+		g.state = newGrid
+	}
+	// The DEAD fraction of the radial profile falls from the core to the rim
+	profile := g.radialProfile(center)
+	inner, outer := profile[1].fractions[radialDead], profile[radius].fractions[radialDead]
+	if inner != 1 || outer > 0.5 {
+		t.Fatalf("DEAD fraction %.2f at ring 1 and %.2f at ring %d, want 1 at the core and at most 0.5 at the rim", inner, outer, radius)
+	}
+	for k := 1; k <= radius; k++ {
+		if profile[k].fractions[radialDead] > profile[k-1].fractions[radialDead] {
+			t.Errorf("ring %d is more DEAD (%.2f) than ring %d (%.2f)", k, profile[k].fractions[radialDead], k-1, profile[k-1].fractions[radialDead])
+		}
+	}
+}
+
+// Function to return the virions and DIPs on the whole lattice
+func latticeParticles(g *Grid) (int, int) {
+	virions, dips := 0, 0
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			virions += g.localVirions[i][j]
+			dips += g.localDips[i][j]
+		}
+	}
+	return virions, dips
+}
+
+func TestDIPDoseAddsExactlyTheDose(t *testing.T) {
+	g := newTestGrid(t, Config{"depositPolicy": "live"})
+	g.initializeNeighbors()
+	saved := dipDoses
+	t.Cleanup(func() { dipDoses = saved })
+	doses, err := parseDIPDoses("t=10:count=1000:mode=uniform;t=12:count=500:mode=hotspot:x=30:y=30:radius=4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dipDoses = doses
+	// A dead patch under the hotspot: -depositPolicy=live keeps its DIPs off it
+	for _, cell := range append([][2]int{{30, 30}}, g.cellsWithinRadius(30, 30, 2)...) {
+		g.state[cell[0]][cell[1]] = DEAD
+	}
+
+	_, before := latticeParticles(g)
+	g.applyDIPDoses(9)
+	if _, after := latticeParticles(g); after != before || g.dosedDIPs != 0 {
+		t.Fatalf("frame 9: DIPs %d -> %d, dosed %d; want no dose", before, after, g.dosedDIPs)
+	}
+	g.applyDIPDoses(10)
+	if _, after := latticeParticles(g); after != before+1000 || g.dosedDIPs != 1000 {
+		t.Fatalf("frame 10: DIPs %d -> %d, dosed %d; want exactly 1000 more", before, after, g.dosedDIPs)
+	}
+	g.applyDIPDoses(12)
+	if _, after := latticeParticles(g); after != before+1500 || g.dosedDIPs != 500 {
+		t.Fatalf("frame 12: DIPs %d -> %d, dosed %d; want 500 more", before+1000, after, g.dosedDIPs)
+	}
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			if g.state[i][j] == DEAD && g.localDips[i][j] != 0 {
+				t.Fatalf("DEAD cell (%d,%d) received %d DIPs", i, j, g.localDips[i][j])
+			}
+		}
+	}
+}
+
+func TestWashoutClearsParticlesNotStates(t *testing.T) {
+	g := newTestGrid(t, Config{})
+	saved := washouts
+	t.Cleanup(func() { washouts = saved })
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			g.localVirions[i][j], g.localDips[i][j] = (i+j)%7, (i*j)%5
+		}
+	}
+	g.state[20][20], g.state[20][21], g.state[21][20] = INFECTED_VIRION, INFECTED_BOTH, INFECTED_DIP
+	states := g.state
+
+	// Two half washouts at t=1 compose to about a quarter kept; a full one at t=2 clears everything
+	events, err := parseWashouts("t=1:virionFraction=0.5:dipFraction=0.5;t=1:virionFraction=0.5:dipFraction=0.5;t=2:virionFraction=1.0:dipFraction=1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	washouts = events
+	virions, dips := latticeParticles(g)
+	g.applyWashouts(1)
+	afterV, afterD := latticeParticles(g)
+	if math.Abs(float64(afterV)-float64(virions)/4) > 0.05*float64(virions) || math.Abs(float64(afterD)-float64(dips)/4) > 0.05*float64(dips) {
+		t.Fatalf("t=1: %d of %d virions and %d of %d DIPs kept, want about a quarter", afterV, virions, afterD, dips)
+	}
+	if g.washedVirions != virions-afterV || g.washedDIPs != dips-afterD {
+		t.Fatalf("t=1: washed %d virions and %d DIPs, want %d and %d", g.washedVirions, g.washedDIPs, virions-afterV, dips-afterD)
+	}
+	g.applyWashouts(2)
+	if v, d := latticeParticles(g); v != 0 || d != 0 {
+		t.Fatalf("t=2: %d virions and %d DIPs left after a full washout", v, d)
+	}
+	if g.state != states {
+		t.Fatal("washout changed cell states")
+	}
+}
+
+func TestBurstPlacesEveryParticle(t *testing.T) {
+	// The ring kernels of the burst and partition paths (the legacy 1 : 1/2 : 1/√3 one over 6+12+18 cells)
+	for _, kernel := range []string{"auto", kernelLegacySqrt3} {
+		g := newTestGrid(t, Config{"burstKernel": kernel})
+		g.initializeNeighbors()
+		g.burstRadius = 3
+		const i, j = GRID_SIZE / 2, GRID_SIZE / 2
+		g.state[i][j], g.previousStates[i][j] = INFECTED_BOTH, INFECTED_BOTH
+		g.localVirions[i][j], g.localDips[i][j] = 20, 10
+		wantD := 100 + int(100*10.0/20.0) // burstSizeD scaled up by the DIP:virion ratio on the cell
+
+		virionsBefore, dipsBefore := latticeParticles(g)
+		g.handleCase4Burst(i, j, 50, 100, 0, 0)
+		virions, dips := latticeParticles(g)
+		if virions-virionsBefore != 50 || dips-dipsBefore != wantD {
+			t.Errorf("burstKernel=%s: burst added %d virions and %d DIPs, want 50 and %d",
+				kernel, virions-virionsBefore, dips-dipsBefore, wantD)
+		}
+	}
+}
+
+// Function to set up a grid with 100 virions and 100 DIPs on every cell around an infected plaque
+// core of the given radius (DEAD at the center), with particle decay switched off
+func newAdsorptionGrid(t *testing.T, cfg Config, core int) (*Grid, [2]int) {
+	t.Helper()
+	g := newTestGrid(t, cfg)
+	saved := virion_half_life
+	virion_half_life = 0
+	t.Cleanup(func() { virion_half_life = saved })
+	center := [2]int{GRID_SIZE / 2, GRID_SIZE / 2}
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			g.state[i][j] = SUSCEPTIBLE
+			if getHexDistanceBetweenPoints(center[0], center[1], i, j) <= core {
+				g.state[i][j] = INFECTED_BOTH
+			}
+			g.localVirions[i][j], g.localDips[i][j] = 100, 100
+		}
+	}
+	g.state[center[0]][center[1]] = DEAD
+	return g, center
+}
+
+func TestAdsorptionHollowsThePlaqueCore(t *testing.T) {
+	const core = 5
+	g, center := newAdsorptionGrid(t, Config{"adsorptionVirion": "0.9", "adsorptionDIP": "0.5"}, core)
+	for frame := 0; frame < 3; frame++ {
+		g.decayAndAdsorbParticles()
+	}
+	for _, ring := range g.radialProfile(center) {
+		if ring.radius > 2*core {
+			break
+		}
+		// 100 * 0.1^3 virions and 100 * 0.5^3 DIPs are expected to stay on the core
+		if ring.radius <= core && (ring.meanV > 1 || ring.meanD < 6 || ring.meanD > 20) {
+			t.Errorf("core ring %d: %.2f virions and %.2f DIPs per cell, want ~0.1 and ~12.5", ring.radius, ring.meanV, ring.meanD)
+		}
+		if ring.radius > core && (ring.meanV != 100 || ring.meanD != 100) {
+			t.Errorf("ring %d outside the core: %.2f virions and %.2f DIPs per cell, want 100", ring.radius, ring.meanV, ring.meanD)
+		}
+	}
+}
+
+func TestAdsorptionConservesParticles(t *testing.T) {
+	g, _ := newAdsorptionGrid(t, Config{"adsorptionVirion": "0.3", "adsorptionDIP": "0.7"}, 8)
+	virions, dips := g.totalVirions(), g.totalDIPs()
+	for frame := 0; frame < 4; frame++ {
+		g.decayAndAdsorbParticles()
+		if g.adsorbedVirions == 0 || g.adsorbedDIPs == 0 {
+			t.Fatalf("frame %d: adsorbed %d virions and %d DIPs, want both > 0", frame, g.adsorbedVirions, g.adsorbedDIPs)
+		}
+		virions, dips = virions-g.adsorbedVirions, dips-g.adsorbedDIPs
+		if got := g.totalVirions(); got != virions {
+			t.Fatalf("frame %d: %d virions on the lattice, want %d", frame, got, virions)
+		}
+		if got := g.totalDIPs(); got != dips {
+			t.Fatalf("frame %d: %d DIPs on the lattice, want %d", frame, got, dips)
+		}
+	}
+
+	// A whole run under -strict with strong adsorption still balances every release
+	if _, err := runForTest(t, Config{"adsorptionVirion": "0.9", "adsorptionDIP": "0.9", "d_pfu_initial": "50", "strict": "true"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBinomialDrawMoments(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	const draws = 200000
+	// Inversion (n*p < 10), transformed rejection, the p > 0.5 mirror and a large n
+	cases := []struct {
+		n int
+		p float64
+	}{
+		{20, 0.3}, {5000, 0.001}, {200, 0.2}, {1000, 0.9}, {2000000, 0.05},
+	}
+	for _, c := range cases {
+		sum, sumSq := 0.0, 0.0
+		for d := 0; d < draws; d++ {
+			k := binomialDraw(rng, c.n, c.p)
+			if k < 0 || k > c.n {
+				t.Fatalf("Binomial(%d, %g) drew %d", c.n, c.p, k)
+			}
+			sum += float64(k)
+			sumSq += float64(k) * float64(k)
+		}
+		mean := sum / draws
+		variance := sumSq/draws - mean*mean
+		wantMean := float64(c.n) * c.p
+		wantVar := wantMean * (1 - c.p)
+		// Five standard errors of the sample mean and (for a near-normal count) of the sample variance
+		if math.Abs(mean-wantMean) > 5*math.Sqrt(wantVar/draws) {
+			t.Errorf("Binomial(%d, %g): mean %.4f, want %.4f", c.n, c.p, mean, wantMean)
+		}
+		if math.Abs(variance-wantVar) > 5*wantVar*math.Sqrt(2.0/draws)+0.01 {
+			t.Errorf("Binomial(%d, %g): variance %.4f, want %.4f", c.n, c.p, variance, wantVar)
+		}
+	}
+}
+
+func TestBinomialDrawMatchesPMF(t *testing.T) {
+	rng := rand.New(rand.NewSource(4))
+	const draws = 400000
+	// Inversion (mean 3) and transformed rejection (mean 14)
+	for _, c := range []struct {
+		n int
+		p float64
+	}{{30, 0.1}, {40, 0.35}} {
+		counts := make([]float64, c.n+1)
+		for d := 0; d < draws; d++ {
+			counts[binomialDraw(rng, c.n, c.p)]++
+		}
+		// Chi-square over the bins with an expected count of at least 20
+		chi2, bins := 0.0, 0
+		lgN, _ := math.Lgamma(float64(c.n) + 1)
+		for k := 0; k <= c.n; k++ {
+			lgK, _ := math.Lgamma(float64(k) + 1)
+			lgNK, _ := math.Lgamma(float64(c.n-k) + 1)
+			expected := draws * math.Exp(lgN-lgK-lgNK+float64(k)*math.Log(c.p)+float64(c.n-k)*math.Log(1-c.p))
+			if expected < 20 {
+				continue
+			}
+			chi2 += (counts[k] - expected) * (counts[k] - expected) / expected
+			bins++
+		}
+		// The 99.9th percentile of chi-square with bins-1 degrees of freedom is below 2*bins+10 here
+		if chi2 > float64(2*bins+10) {
+			t.Errorf("Binomial(%d, %g): chi-square %.1f over %d bins", c.n, c.p, chi2, bins)
+		}
+	}
+}
+
+func TestPowCacheSkipsNonFiniteBases(t *testing.T) {
+	var c powCache
+	c.reset(64)
+	for k := 0; k < 100; k++ {
+		if got := c.pow(math.NaN(), 3); !math.IsNaN(got) {
+			t.Fatalf("pow(NaN, 3) = %g", got)
+		}
+		c.pow(math.Inf(1), 2)
+	}
+	if len(c.tables) != 0 {
+		t.Fatalf("non-finite bases left %d tables", len(c.tables))
+	}
+	if got := c.pow(0.5, 3); got != 0.125 || len(c.tables) != 1 {
+		t.Fatalf("pow(0.5, 3) = %g with %d tables, want 0.125 with 1", got, len(c.tables))
+	}
+}
+
+func TestSummedAreaMatchesDirectIFNSum(t *testing.T) {
+	radius, wave, periodic := IFN_wave_radius, ifnWave, boundaryPeriodic
+	t.Cleanup(func() { IFN_wave_radius, ifnWave, boundaryPeriodic = radius, wave, periodic })
+	IFN_wave_radius, ifnWave = 10, true
+
+	for _, periodic := range []bool{false, true} {
+		boundaryPeriodic = periodic
+		g := newTestGrid(t, Config{})
+		g.initializeNeighbors()
+		// A field spanning many orders of magnitude, the worst case for prefix-sum cancellation
+		total := 0.0
+		for i := 0; i < GRID_SIZE; i++ {
+			for j := 0; j < GRID_SIZE; j++ {
+				g.IFNConcentration[i][j] = math.Exp(20 * (g.rng.Float64() - 0.5))
+				total += g.IFNConcentration[i][j]
+			}
+		}
+
+		for i := 0; i < GRID_SIZE; i++ {
+			for j := 0; j < GRID_SIZE; j++ {
+				*flag_ifnComputeMethod = "direct"
+				direct := g.regionalIFNSum(i, j)
+				*flag_ifnComputeMethod = "summedarea"
+				summed := g.regionalIFNSum(i, j)
+				// Each of the 21 mask rows is a difference of two row prefixes, each within a few
+				// ulps of the grid total
+				if math.Abs(summed-direct) > 21*4*total*0x1p-52 {
+					t.Fatalf("periodic=%t (%d,%d): summedarea %.17g, direct %.17g", periodic, i, j, summed, direct)
+				}
+			}
+		}
+	}
+}
+
+func TestMoransIPatterns(t *testing.T) {
+	cases := []struct {
+		name     string
+		infected func(i, j int) bool
+		min, max float64
+	}{
+		// The hex lattice cannot be two-colored without same-colored neighbors: a checkerboard of the
+		// offset coordinates or alternating rows sit at its minimum, about -1/3 (edges move it slightly)
+		{"checkerboard", func(i, j int) bool { return (i+j)%2 == 0 }, -0.36, -0.31},
+		{"alternating rows", func(i, j int) bool { return i%2 == 0 }, -0.36, -0.31},
+		// Two half-grid blocks: only the cells along the border have unlike neighbors
+		{"block", func(i, j int) bool { return i < GRID_SIZE/2 }, 0.95, 1},
+	}
+	for _, c := range cases {
+		g := newTestGrid(t, Config{})
+		g.initializeNeighbors()
+		for i := 0; i < GRID_SIZE; i++ {
+			for j := 0; j < GRID_SIZE; j++ {
+				if c.infected(i, j) {
+					g.state[i][j] = INFECTED_DIP
+				}
+			}
+		}
+		infected, dipOnly := g.moransI(), g.dipOnlyMoransI()
+		if infected < c.min || infected > c.max {
+			t.Errorf("%s: Moran's I %.4f, want between %g and %g", c.name, infected, c.min, c.max)
+		}
+		// DIP-only cells are infected cells, so both indicators are the same here
+		if dipOnly != infected {
+			t.Errorf("%s: DIP-only Moran's I %.6f differs from the infected one %.6f", c.name, dipOnly, infected)
+		}
+	}
+}
+
+func TestDiffuseIFNConservesMass(t *testing.T) {
+	periodic := boundaryPeriodic
+	t.Cleanup(func() { boundaryPeriodic = periodic })
+	for _, boundaryPeriodic = range []bool{false, true} {
+		g := newTestGrid(t, Config{})
+		total := 0.0
+		for i := 0; i < GRID_SIZE; i++ {
+			for j := 0; j < GRID_SIZE; j++ {
+				g.IFNConcentration[i][j] = g.rng.Float64()
+				total += g.IFNConcentration[i][j]
+			}
+		}
+		g.diffuseIFN(25)
+		after := 0.0
+		for i := 0; i < GRID_SIZE; i++ {
+			for j := 0; j < GRID_SIZE; j++ {
+				after += g.IFNConcentration[i][j]
+			}
+		}
+		if math.Abs(after-total) > 1e-9*total {
+			t.Errorf("periodic=%t: total IFN %.12g after diffusion, want %.12g", boundaryPeriodic, after, total)
+		}
+	}
+}
+
+func TestDiffuseIFNGaussianWidth(t *testing.T) {
+	g := newTestGrid(t, Config{})
+	const c = GRID_SIZE / 2
+	g.IFNConcentration[c][c] = 1
+	// D*t = 10: the variance of a point source grows by 2*D*t along each axis
+	g.diffuseIFN(10)
+
+	// Cell centers of the layout: columns sqrt(3)/2 apart, odd columns half a row down
+	var mass, mx, my, mxx, myy float64
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			w := g.IFNConcentration[i][j]
+			x := float64(i-c) * math.Sqrt(3) / 2
+			y := float64(j-c) + 0.5*float64(i&1)
+			mass += w
+			mx += w * x
+			my += w * y
+			mxx += w * x * x
+			myy += w * y * y
+		}
+	}
+	mx, my = mx/mass, my/mass
+	varX, varY := mxx/mass-mx*mx, myy/mass-my*my
+	if math.Abs(mx) > 1e-9 || math.Abs(my) > 1e-9 {
+		t.Errorf("center of mass moved to (%g, %g)", mx, my)
+	}
+	// The explicit scheme adds exactly 2*D*dt per substep away from the edges (sigma ~4.5 cells here)
+	if math.Abs(varX-20) > 1e-6 || math.Abs(varY-20) > 1e-6 {
+		t.Errorf("variance (%.6f, %.6f), want 20 along both axes", varX, varY)
+	}
+}
+
+func TestTwoFociGiveTwoPlaques(t *testing.T) {
+	result, err := runForTest(t, Config{
+		"option": "5", "foci": "20,20,50,0;55,55,50,0", "randomSeed": "1",
+		"ifnSpreadOption": "noIFN", "burstRadius": "1", "rho": "0.9",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(filepath.Join(result.OutputFolder, "simulation_output.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	column := -1
+	for c, name := range rows[0] {
+		if name == "plaqueCount" {
+			column = c
+		}
+	}
+	if last := rows[len(rows)-1]; last[0] != "25" || last[column] != "2" {
+		t.Fatalf("t=%s: %s plaques, want 2 at t=25", last[0], last[column])
+	}
+
+	var params struct {
+		Foci []infectionFocusSpec `json:"foci"`
+	}
+	data, err := os.ReadFile(filepath.Join(result.OutputFolder, "params.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &params); err != nil {
+		t.Fatal(err)
+	}
+	if want := []infectionFocusSpec{{20, 20, 50, 0}, {55, 55, 50, 0}}; !reflect.DeepEqual(params.Foci, want) {
+		t.Fatalf("params.json foci %v, want %v", params.Foci, want)
+	}
+}
+
+func TestLineageParentMatchesFullScan(t *testing.T) {
+	for _, periodic := range []bool{false, true} {
+		t.Run(fmt.Sprintf("periodic=%t", periodic), func(t *testing.T) {
+			saved := boundaryPeriodic
+			t.Cleanup(func() { boundaryPeriodic = saved })
+			boundaryPeriodic = periodic
+			g := newTestGrid(t, Config{})
+			g.initializeNeighbors()
+			// Dense releases within radius 2 (the disc is searched first), then sparse ones (the list is)
+			for frame, fraction := range []float64{0.3, 0.3, 0.002} {
+				for i := 0; i < GRID_SIZE; i++ {
+					for j := 0; j < GRID_SIZE; j++ {
+						g.releasedNow[i][j] = g.rng.Float64() < fraction
+					}
+				}
+				g.releaseRadiusNow = 2
+				g.updateLineage(frame)
+
+				for _, restored := range []bool{false, true} {
+					if restored {
+						g.restoreLatestReleasers()
+					}
+					for i := 0; i < GRID_SIZE; i++ {
+						for j := 0; j < GRID_SIZE; j++ {
+							if got, want := g.lineageParent(i, j), scanLineageParent(g, i, j); got != want {
+								t.Fatalf("frame %d, restored=%t (%d,%d): parent %d, want %d", frame, restored, i, j, got, want)
+							}
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+// Function to find the lineage parent of (i,j) by scanning every cell for the most recent,
+// then nearest, release
+func scanLineageParent(g *Grid, i, j int) int {
+	parent, bestFrame, bestDistance := -1, -1, 0
+	for pi := 0; pi < GRID_SIZE; pi++ {
+		for pj := 0; pj < GRID_SIZE; pj++ {
+			released := g.lastReleaseFrame[pi][pj]
+			if released < 0 || (pi == i && pj == j) {
+				continue
+			}
+			distance := getHexDistanceBetweenPoints(i, j, pi, pj)
+			if parent == -1 || released > bestFrame || (released == bestFrame && distance < bestDistance) {
+				parent, bestFrame, bestDistance = pi*GRID_SIZE+pj, released, distance
+			}
+		}
+	}
+	return parent
+}
+
+func BenchmarkUpdateLineage(b *testing.B) {
+	if err := applyConfig(Config{}); err != nil {
+		b.Fatal(err)
+	}
+	g := new(Grid)
+	g.restoreRNG(1, 0)
+	g.initialize()
+	g.initializeNeighbors()
+	// A plaque front: a ring of releasing cells and a ring of new infections just outside it
+	const c = GRID_SIZE / 2
+	for _, cell := range generateHexRing(c, c, 15) {
+		g.releasedNow[cell[0]][cell[1]] = true
+	}
+	g.releaseRadiusNow = 3
+	g.updateLineage(0)
+	front := generateHexRing(c, c, 17)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for _, cell := range front {
+			g.state[cell[0]][cell[1]], g.infectionStartFrame[cell[0]][cell[1]] = INFECTED_VIRION, -1
+		}
+		g.updateLineage(1)
+	}
+}
+
+func TestUninfectedSweepIndependentOfWorkers(t *testing.T) {
+	cases := []Config{
+		{"randomSeed": "5"},
+		{"randomSeed": "5", "infectionModel": "poisson", "d_pfu_initial": "50"},
+		{"randomSeed": "5", "continuousMode": "true"},
+		{"randomSeed": "5", "ifnDecay": "perCell"},
+	}
+	for _, cfg := range cases {
+		var outputs []string
+		for _, workers := range []string{"1", "4"} {
+			cfg["workers"] = workers
+			result, err := runForTest(t, cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(filepath.Join(result.OutputFolder, "simulation_output.csv"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			outputs = append(outputs, string(data))
+		}
+		if outputs[0] != outputs[1] {
+			t.Errorf("%v: simulation_output.csv differs between 1 and 4 workers", cfg)
+		}
+	}
+}
+
+func BenchmarkSweepUninfectedCells(b *testing.B) {
+	for _, workers := range []int{1, 2, 4} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			if err := applyConfig(Config{"workers": strconv.Itoa(workers), "ifnComputeMethod": "direct"}); err != nil {
+				b.Fatal(err)
+			}
+			g := new(Grid)
+			g.restoreRNG(1, 0)
+			g.initialize()
+			g.initializeNeighbors()
+			// Particles and IFN on every cell, so every cell draws for infection and antiviral state
+			for i := 0; i < GRID_SIZE; i++ {
+				for j := 0; j < GRID_SIZE; j++ {
+					g.localVirions[i][j], g.localDips[i][j] = 1+g.rng.Intn(20), g.rng.Intn(20)
+					g.IFNConcentration[i][j] = g.rng.Float64()
+				}
+			}
+			localIFN := g.prepareLocalIFN()
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				newGrid := g.state
+				g.sweepUninfectedCells(&newGrid, 1, localIFN)
+			}
+		})
+	}
+}
+
+// Function to read a run's simulation_output.csv without the column named drop
+func outputRowsWithout(t *testing.T, folder, drop string) [][]string {
+	t.Helper()
+	header, rows, err := loadOutputCSV(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	column := -1
+	for c, name := range header {
+		if name == drop {
+			column = c
+		}
+	}
+	if column < 0 {
+		t.Fatalf("simulation_output.csv has no %q column", drop)
+	}
+	kept := [][]string{}
+	for _, row := range append([][]string{header}, rows...) {
+		kept = append(kept, append(append([]string{}, row[:column]...), row[column+1:]...))
+	}
+	return kept
+}
+
+func TestBurnInChangesEndpointsNotDynamics(t *testing.T) {
+	full, err := runForTest(t, Config{"randomSeed": "7"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	warm, err := runForTest(t, Config{"randomSeed": "7", "burnIn": "10"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Same dynamics and rows: only the burnIn flag column differs
+	if full.Summary.StateHash != warm.Summary.StateHash {
+		t.Fatal("burnIn changed the final state")
+	}
+	if !reflect.DeepEqual(outputRowsWithout(t, full.OutputFolder, "burnIn"), outputRowsWithout(t, warm.OutputFolder, "burnIn")) {
+		t.Fatal("burnIn changed simulation_output.csv beyond the burnIn column")
+	}
+
+	// Endpoints: ten fewer frames, peaks taken from frame 10 on, the final frame unchanged
+	if full.Summary.FramesIncluded != TIME_STEPS || warm.Summary.FramesIncluded != TIME_STEPS-10 {
+		t.Errorf("frames included %d and %d, want %d and %d", full.Summary.FramesIncluded, warm.Summary.FramesIncluded, TIME_STEPS, TIME_STEPS-10)
+	}
+	if warm.Summary.PeakInfectedTime < 10 || warm.Summary.PeakInfectedPercentage > full.Summary.PeakInfectedPercentage {
+		t.Errorf("burn-in peak %.2f%% at frame %d, full-run peak %.2f%%",
+			warm.Summary.PeakInfectedPercentage, warm.Summary.PeakInfectedTime, full.Summary.PeakInfectedPercentage)
+	}
+	if warm.Summary.FinalDeadPercentage != full.Summary.FinalDeadPercentage {
+		t.Errorf("final dead %.4f%%, want %.4f%% as without burn-in", warm.Summary.FinalDeadPercentage, full.Summary.FinalDeadPercentage)
+	}
+}
+
+func TestReplicateAggregateSkipsBurnIn(t *testing.T) {
+	_, rows := runReplicatesWithPanic(t, Config{"burnIn": "10"})
+	if len(rows)-1 != TIME_STEPS-10 || rows[1][0] != "10" {
+		t.Fatalf("aggregate has %d rows starting at t=%s, want %d from t=10", len(rows)-1, rows[1][0], TIME_STEPS-10)
+	}
+}
+
+func TestCohortReffOnAttributedRun(t *testing.T) {
+	saved := burnIn
+	t.Cleanup(func() { burnIn = saved })
+	burnIn = 0
+	g := newTestGrid(t, Config{"lineage": "true"})
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			g.state[i][j] = SUSCEPTIBLE
+			g.infectionStartFrame[i][j], g.firstInfectionTime[i][j], g.lineageFrame[i][j] = -1, -1, -1
+			g.lastReleaseFrame[i][j], g.releasedNow[i][j] = -1, false
+		}
+	}
+	g.latestReleasers, g.cohortSize, g.cohortOffspring = nil, nil, nil
+
+	// The root infects three cells; two of them release, each infecting the two cells next to it
+	root := [2]int{40, 40}
+	middle := [][2]int{{10, 10}, {10, 60}, {60, 20}}
+	leaves := [][2]int{{10, 11}, {11, 10}, {10, 61}, {11, 60}}
+	frames := []struct{ infect, release, lyse [][2]int }{
+		{infect: [][2]int{root}, release: [][2]int{root}},
+		{infect: middle, release: middle[:2], lyse: [][2]int{root}},
+		{infect: leaves, lyse: middle},
+		{lyse: leaves},
+	}
+	for frame, f := range frames {
+		for _, c := range f.infect {
+			g.state[c[0]][c[1]] = INFECTED_VIRION
+		}
+		for _, c := range f.lyse {
+			g.state[c[0]][c[1]] = DEAD
+		}
+		for _, c := range f.release {
+			g.releasedNow[c[0]][c[1]] = true
+		}
+		g.releaseRadiusNow = 1
+		g.updateLineage(frame)
+		g.updateFirstInfectionTime(frame)
+		g.updateInfectionStart(frame)
+	}
+
+	lastFrame := len(frames) - 1
+	for frame, want := range []float64{3, 4.0 / 3, 0} {
+		if reff, complete := g.cohortReff(frame, lastFrame); reff != want || !complete {
+			t.Errorf("cohort %d: R_eff %v (complete %t), want %v and complete", frame, reff, complete, want)
+		}
+	}
+	if reff, _ := g.cohortReff(lastFrame, lastFrame); !math.IsNaN(reff) {
+		t.Errorf("empty cohort: R_eff %v, want NaN", reff)
+	}
+	summary := newSimulationSummary()
+	g.saveCohortReffCSV(t.TempDir(), lastFrame, summary)
+	if summary.ReffCohortTurnoverTime != 2 {
+		t.Errorf("cohort turnover at frame %d, want 2", summary.ReffCohortTurnoverTime)
+	}
+
+	// A leaf still infected at the end leaves its cohort open
+	g.state[10][11] = INFECTED_VIRION
+	if _, complete := g.cohortReff(2, lastFrame); complete {
+		t.Error("cohort with a cell still infected reported complete")
+	}
+}
+
+// Function to list the constants declared in the const block holding SUSCEPTIBLE, read from the
+// source, so a state added there shows up here without anyone updating the test
+func declaredStateConstants(t *testing.T) []string {
+	t.Helper()
+	file, err := parser.ParseFile(token.NewFileSet(), "mdbk_small_vero_0818.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.CONST {
+			continue
+		}
+		var names []string
+		for _, spec := range gen.Specs {
+			for _, name := range spec.(*ast.ValueSpec).Names {
+				names = append(names, name.Name)
+			}
+		}
+		for _, name := range names {
+			if name == "SUSCEPTIBLE" {
+				return names
+			}
+		}
+	}
+	t.Fatal("no const block declares SUSCEPTIBLE")
+	return nil
+}
+
+func TestStateClassifiersCoverEveryState(t *testing.T) {
+	if declared := declaredStateConstants(t); len(declared) != len(stateNames) {
+		t.Fatalf("%d state constants declared (%v) but %d in stateNames: name the new state and classify it below",
+			len(declared), declared, len(stateNames))
+	}
+	for state, name := range stateNames {
+		// Every state belongs to exactly one class
+		var class string
+		switch state {
+		case INFECTED_VIRION, INFECTED_VIRION_CONTINUOUS:
+			class = "virion"
+		case INFECTED_DIP, INFECTED_DIP_CONTINUOUS:
+			class = "dip"
+		case INFECTED_BOTH, INFECTED_BOTH_CONTINUOUS:
+			class = "both"
+		case SUSCEPTIBLE, ANTIVIRAL, REGROWTH:
+			class = "alive"
+		case DEAD:
+			class = "dead"
+		case UNEXPOSED:
+			class = "unexposed"
+		default:
+			t.Fatalf("%s is not classified: add it to the switch and to the helpers it belongs to", name)
+		}
+
+		infected := class == "virion" || class == "dip" || class == "both"
+		checks := []struct {
+			helper    string
+			got, want bool
+		}{
+			{"isInfectedState", isInfectedState(state), infected},
+			{"isInfectedVirionOnly", isInfectedVirionOnly(state), class == "virion"},
+			{"isInfectedDIPOnly", isInfectedDIPOnly(state), class == "dip"},
+			{"isInfectedBoth", isInfectedBoth(state), class == "both"},
+			{"isAliveUninfected", isAliveUninfected(state), class == "alive"},
+			{"isInfectableState", isInfectableState(state), state == SUSCEPTIBLE || state == REGROWTH},
+			{"isProducingState", isProducingState(state), infected && burstState(state) != state},
+		}
+		for _, c := range checks {
+			if c.got != c.want {
+				t.Errorf("%s(%s) = %t, want %t", c.helper, name, c.got, c.want)
+			}
+		}
+		if cause := causeOfDeath(state); (infected && cause != class) || (!infected && cause != "") {
+			t.Errorf("causeOfDeath(%s) = %q", name, cause)
+		}
+		if b := burstState(state); isProducingState(b) || (infected && causeOfDeath(b) != class) || (!infected && b != state) {
+			t.Errorf("burstState(%s) = %s", name, stateNames[b])
+		}
+	}
+}
+
+func TestTrapezoidAUCMatchesClosedForm(t *testing.T) {
+	linear := make([]float64, TIME_STEPS)
+	for frame := range linear {
+		linear[frame] = 3 + 2*float64(frame*TIMESTEP) // exact under the trapezoid rule
+	}
+	// ∫ 3+2t dt from a to b = 3(b-a) + b²-a²
+	for _, w := range [][2]int{{0, 24}, {0, 10}, {10, 24}, {5, 6}} {
+		a, b := float64(w[0]), float64(w[1])
+		if got, want := trapezoidAUC(linear, w[0], w[1]), 3*(b-a)+b*b-a*a; math.Abs(got-want) > 1e-9 {
+			t.Errorf("window %d-%d: AUC %v, want %v", w[0], w[1], got, want)
+		}
+	}
+	// Adjacent windows share their boundary frame, so they add up to the joined window
+	if got, want := trapezoidAUC(linear, 0, 10)+trapezoidAUC(linear, 10, 24), trapezoidAUC(linear, 0, 24); got != want {
+		t.Errorf("0-10 plus 10-24 = %v, want 0-24 = %v", got, want)
+	}
+	// A pulse at one frame: half of it falls into each window that has the frame as an end
+	pulse := make([]float64, TIME_STEPS)
+	pulse[10] = 4
+	if left, right := trapezoidAUC(pulse, 0, 10), trapezoidAUC(pulse, 10, 24); left != 2 || right != 2 {
+		t.Errorf("pulse at hour 10 splits %v / %v, want 2 / 2", left, right)
+	}
+}
+
+func TestParseAUCWindowsBounds(t *testing.T) {
+	saved := burnIn
+	t.Cleanup(func() { burnIn = saved })
+	burnIn = 2
+	if windows, err := parseAUCWindows(" 2-12, 12-25 "); err != nil || len(windows) != 2 || windows[1] != (AUCWindow{Start: 12, End: 25}) {
+		t.Fatalf("parseAUCWindows = %v, %v", windows, err)
+	}
+	for _, text := range []string{"0-12", "12-12", "12-5", "2-26", "2", "a-5"} {
+		if _, err := parseAUCWindows(text); err == nil {
+			t.Errorf("%q accepted", text)
+		}
+	}
+}
+
+func TestReleasedParticleAUC(t *testing.T) {
+	result, err := runForTest(t, Config{"randomSeed": "3", "aucWindows": "0-12,12-25"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	windows := result.Summary.AUCWindows
+	if len(windows) != 2 || windows[0].ReleasedVirionAUC+windows[1].ReleasedVirionAUC == 0 {
+		t.Fatalf("AUC windows %+v, want released virions", windows)
+	}
+	// With fixed bursts every frame releases whole bursts, all of them virions
+	series := result.Summary.releasedVirionSeries
+	for frame, released := range series {
+		if int(released)%BURST_SIZE_V != 0 {
+			t.Errorf("frame %d released %v virions, not a multiple of %d", frame, released, BURST_SIZE_V)
+		}
+	}
+	if got, want := windows[1].ReleasedVirionAUC, trapezoidAUC(series, 12, 25); got != want {
+		t.Errorf("released virion AUC 12-25 = %v, want %v", got, want)
+	}
+}
+
+// Function to list the cells within radius of (i,j) by enumerating every ring, as the general
+// path does for radii below the grid diameter
+func ringFootprint(i, j, radius int) [][2]int {
+	var ringCells [][2]int
+	for r := 1; r <= radius; r++ {
+		ringCells = append(ringCells, generateHexRing(i, j, r)...)
+	}
+	return wrapNeighbors(ringCells, [2]int{i, j})
+}
+
+func TestWholeGridFootprintMatchesRings(t *testing.T) {
+	g := newTestGrid(t, Config{})
+	g.initializeNeighbors()
+	for _, cell := range [][2]int{{0, 0}, {GRID_SIZE / 2, GRID_SIZE / 3}, {GRID_SIZE - 1, 5}} {
+		i, j := cell[0], cell[1]
+		fast := g.cellsWithinRadius(i, j, gridHexDiameter+50)
+		general := ringFootprint(i, j, gridHexDiameter)
+		if len(fast) != GRID_SIZE*GRID_SIZE-1 || len(general) != len(fast) {
+			t.Fatalf("(%d,%d): %d cells on the fast path, %d by rings, want %d", i, j, len(fast), len(general), GRID_SIZE*GRID_SIZE-1)
+		}
+
+		// Same cells per ring, so the same ring weights; the same draws then put the same
+		// number of particles in each ring
+		fastRings := groupByHexRing(i, j, fast, gridHexDiameter+50)
+		generalRings := groupByHexRing(i, j, general, gridHexDiameter)
+		deposited := func(rings [][][2]int) ([]int, int) {
+			perRing, total := make([]int, gridHexDiameter+1), 0
+			distributeByRing(rand.New(rand.NewSource(3)), rings, 5000, func(r int) float64 { return kernelWeight(kernelInverseEuclid, r) }, func(ni, nj, n int) {
+				perRing[getHexDistanceBetweenPoints(i, j, ni, nj)] += n
+				total += n
+			})
+			return perRing, total
+		}
+		for r := 0; r <= gridHexDiameter; r++ {
+			if !reflect.DeepEqual(cellSet(fastRings[r]), cellSet(generalRings[r])) {
+				t.Fatalf("(%d,%d) ring %d: fast path and rings hold different cells", i, j, r)
+			}
+		}
+		fastPerRing, fastTotal := deposited(fastRings)
+		generalPerRing, generalTotal := deposited(generalRings)
+		if fastTotal != 5000 || generalTotal != 5000 || !reflect.DeepEqual(fastPerRing, generalPerRing) {
+			t.Errorf("(%d,%d): deposited %d and %d, per ring %v vs %v", i, j, fastTotal, generalTotal, fastPerRing, generalPerRing)
+		}
+	}
+}
+
+// Function to turn a cell list into a set
+func cellSet(cells [][2]int) map[[2]int]bool {
+	set := make(map[[2]int]bool, len(cells))
+	for _, cell := range cells {
+		set[cell] = true
+	}
+	return set
+}
+
+func BenchmarkWholeGridFootprint(b *testing.B) {
+	if err := applyConfig(Config{}); err != nil {
+		b.Fatal(err)
+	}
+	g := new(Grid)
+	g.restoreRNG(1, 0)
+	g.initialize()
+	g.initializeNeighbors()
+	weight := func(r int) float64 { return kernelWeight(kernelInverseEuclid, r) }
+	footprints := map[string]func(i, j int) [][2]int{
+		"rings":    func(i, j int) [][2]int { return ringFootprint(i, j, gridHexDiameter) },
+		"allCells": func(i, j int) [][2]int { return g.cellsWithinRadius(i, j, gridHexDiameter) },
+	}
+	for _, name := range []string{"rings", "allCells"} {
+		footprint := footprints[name]
+		b.Run(name, func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				rings := groupByHexRing(GRID_SIZE/2, GRID_SIZE/2, footprint(GRID_SIZE/2, GRID_SIZE/2), gridHexDiameter)
+				distributeByRing(g.rng, rings, 1000, weight, func(ni, nj, count int) {})
+			}
+		})
+	}
+}
+
+func TestWholeGridRadiusWarnsOnce(t *testing.T) {
+	result, err := runForTest(t, Config{"randomSeed": "2", "burstRadius": "150"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := 0
+	for _, warning := range result.Warnings {
+		if strings.HasPrefix(warning, "burstRadius=150 covers the whole grid") {
+			count++
+		}
+	}
+	if count != 1 {
+		t.Errorf("whole-grid burstRadius warned %d times in %v, want once", count, result.Warnings)
+	}
+}
+
+// Function to count the infections and co-infections of frames t >= 1 in cells that held none of
+// the infecting particles at the end of frame t-1, i.e. by particles released during frame t.
+// Primary infections are drawn before any release of the frame, so only co-infections of cells
+// scanned after a burst can do this.
+func sameFrameInfections(t *testing.T, cfg Config) int {
+	t.Helper()
+	cfg["dumpStatesAt"] = "all"
+	result, err := runForTest(t, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshots := make([]*GridSnapshot, TIME_STEPS)
+	for frame := range snapshots {
+		if snapshots[frame], err = LoadSnapshot(filepath.Join(result.OutputFolder, fmt.Sprintf("snapshot_%d_hours.csv", frame*TIMESTEP))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	count := 0
+	for frame := 1; frame < TIME_STEPS; frame++ {
+		before, after := snapshots[frame-1], snapshots[frame]
+		for i := 0; i < GRID_SIZE; i++ {
+			for j := 0; j < GRID_SIZE; j++ {
+				from, to := before.State[i][j], after.State[i][j]
+				infected := isInfectedState(to) || to == DEAD
+				switch {
+				case isAliveUninfected(from) && infected && before.LocalVirions[i][j]+before.LocalDips[i][j] == 0,
+					isInfectedVirionOnly(from) && isInfectedBoth(to) && before.LocalDips[i][j] == 0,
+					isInfectedDIPOnly(from) && isInfectedBoth(to) && before.LocalVirions[i][j] == 0:
+					count++
+				}
+			}
+		}
+	}
+	return count
+}
+
+func TestForbidSameFrameInfection(t *testing.T) {
+	cfg := Config{"randomSeed": "1", "rho": "0.5", "d_pfu_initial": "50"}
+	if n := sameFrameInfections(t, cfg); n != 0 {
+		t.Errorf("forbid: %d cells infected without particles at the start of their frame", n)
+	}
+	// The check can see the artifact: allow lets bursts co-infect within their own frame
+	cfg["sameFrameInfection"] = "allow"
+	if n := sameFrameInfections(t, cfg); n == 0 {
+		t.Error("allow: no same-frame infections, so the forbid check proves nothing")
+	}
+}
+
+func TestQuiescentSkipMatchesFullSweep(t *testing.T) {
+	cases := []Config{
+		{"randomSeed": "6"},
+		{"randomSeed": "6", "ifnDecay": "perCell"},
+		{"randomSeed": "6", "ifnSpreadOption": "global"},
+		{"randomSeed": "6", "continuousMode": "true", "minInfectiousParticles": "3"},
+	}
+	t.Cleanup(func() { skipQuiescentCells = true })
+	for _, cfg := range cases {
+		var outputs []string
+		for _, skip := range []bool{true, false} {
+			skipQuiescentCells = skip
+			result, err := runForTest(t, cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(filepath.Join(result.OutputFolder, "simulation_output.csv"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			outputs = append(outputs, string(data))
+		}
+		if outputs[0] != outputs[1] {
+			t.Errorf("%v: skipping quiescent cells changed simulation_output.csv", cfg)
+		}
+	}
+}
+
+func BenchmarkSweepQuiescentGrid(b *testing.B) {
+	for _, skip := range []bool{true, false} {
+		b.Run(fmt.Sprintf("skip=%t", skip), func(b *testing.B) {
+			if err := applyConfig(Config{"ifnDecay": "perCell", "ifnComputeMethod": "direct"}); err != nil {
+				b.Fatal(err)
+			}
+			saved := skipQuiescentCells
+			defer func() { skipQuiescentCells = saved }()
+			skipQuiescentCells = skip
+			g := new(Grid)
+			g.restoreRNG(1, 0)
+			g.initialize()
+			g.initializeNeighbors()
+			// One small plaque: particles around the center, no IFN anywhere
+			g.IFNConcentration = [GRID_SIZE][GRID_SIZE]float64{}
+			for _, cell := range g.cellsWithinRadius(GRID_SIZE/2, GRID_SIZE/2, 3) {
+				g.localVirions[cell[0]][cell[1]] = 5
+			}
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				localIFN := g.prepareLocalIFN()
+				newGrid := g.state
+				g.sweepUninfectedCells(&newGrid, 1, localIFN)
+			}
+		})
+	}
+}
+
+func BenchmarkDrawInfectionPowCache(b *testing.B) {
+	for _, bound := range []int{0, 64} {
+		b.Run(fmt.Sprintf("powCacheBound=%d", bound), func(b *testing.B) {
+			g := new(Grid)
+			g.restoreRNG(1, 0)
+			for i := 0; i < GRID_SIZE; i++ {
+				for j := 0; j < GRID_SIZE; j++ {
+					g.localVirions[i][j], g.localDips[i][j] = 1+g.rng.Intn(20), g.rng.Intn(20)
+				}
+			}
+			// A few distinct chances, as in a frame where most cells see the same IFN level
+			chances := []float64{0.02, 0.015, 0.01}
+			var pow powCache
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				pow.reset(bound)
+				for i := 0; i < GRID_SIZE; i++ {
+					for j := 0; j < GRID_SIZE; j++ {
+						p := chances[(i+j)%len(chances)]
+						g.drawInfection(g.rng, &pow, p, p, i, j)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestRhoSigmaZeroMatchesHomogeneous(t *testing.T) {
+	var outputs []string
+	var hashes []string
+	for _, distribution := range []string{"constant", "lognormal:sigma=0"} {
+		result, err := runForTest(t, Config{"rhoDistribution": distribution, "randomSeed": "7", "option": "3", "v_pfu_initial": "20"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(filepath.Join(result.OutputFolder, "simulation_output.csv"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		outputs = append(outputs, string(data))
+		hashes = append(hashes, result.Summary.StateHash)
+	}
+	if outputs[0] != outputs[1] || hashes[0] != hashes[1] {
+		t.Fatalf("sigma=0 differs from the homogeneous run (state hashes %s and %s)", hashes[0], hashes[1])
+	}
+}
+
+// Function to return the mean and standard deviation of the hours until each cell of a grid with
+// RHO field sigma is first infected, with 3 virions on every cell and a per-particle chance of 0.05
+func timeToFirstInfection(t *testing.T, sigma float64) (float64, float64) {
+	t.Helper()
+	savedSigma, savedNormalized := susceptibilitySigma, susceptibilityNormalized
+	t.Cleanup(func() { susceptibilitySigma, susceptibilityNormalized = savedSigma, savedNormalized })
+	susceptibilitySigma, susceptibilityNormalized = sigma, sigma > 0
+	g := newTestGrid(t, Config{})
+	var pow powCache
+	pow.reset(64)
+	var times []float64
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			g.localVirions[i][j], g.virionsAtFrameStart[i][j] = 3, 3
+			hours := 1
+			for ; hours < 1000 && !g.drawInfection(g.rng, &pow, g.susceptibleChance(0.05, i, j), 0, i, j).byVirion; hours++ {
+			}
+			times = append(times, float64(hours))
+		}
+	}
+	mean, variance := 0.0, 0.0
+	for _, hours := range times {
+		mean += hours
+	}
+	mean /= float64(len(times))
+	for _, hours := range times {
+		variance += (hours - mean) * (hours - mean)
+	}
+	return mean, math.Sqrt(variance / float64(len(times)-1))
+}
+
+func TestRhoSigmaBroadensTimeToFirstInfection(t *testing.T) {
+	_, homogeneous := timeToFirstInfection(t, 0)
+	_, heterogeneous := timeToFirstInfection(t, 1)
+	// Every cell is one replicate: with a common RHO the hours are geometric (sd ~6.5 here);
+	// lognormal RHO mixes slow and fast cells
+	if homogeneous < 5 || homogeneous > 8 || heterogeneous < 1.5*homogeneous {
+		t.Fatalf("time-to-first-infection sd %.2f h at sigma=1, %.2f h at sigma=0; want a clearly broader spread", heterogeneous, homogeneous)
+	}
+}
+
+func TestLineageTreeRootsAtTheSeededCell(t *testing.T) {
+	result, err := runForTest(t, Config{"lineage": "true", "randomSeed": "7", "rho": "0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(filepath.Join(result.OutputFolder, "lineage.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	rows, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	type node struct {
+		time, generation int
+		parent           [2]int
+	}
+	nodes := make(map[[2]int]node)
+	var roots [][2]int
+	for _, row := range rows[1:] {
+		field := make([]int, 6)
+		for k := range field {
+			field[k] = atoiForTest(t, row[k])
+		}
+		cell := [2]int{field[1], field[2]}
+		if _, seen := nodes[cell]; seen {
+			t.Fatalf("cell %v infected twice", cell)
+		}
+		nodes[cell] = node{field[0], field[3], [2]int{field[4], field[5]}}
+		if field[4] == -1 {
+			roots = append(roots, cell)
+		}
+	}
+	// Option 2 seeds one cell at (25,25); the epidemic has to spread past it for a tree
+	if len(roots) != 1 || roots[0] != [2]int{25, 25} || nodes[roots[0]].generation != 0 || len(nodes) < 20 {
+		t.Fatalf("roots %v in %d infections, want the single seeded cell (25,25) at generation 0", roots, len(nodes))
+	}
+	for cell, n := range nodes {
+		if cell == roots[0] {
+			continue
+		}
+		parent, ok := nodes[n.parent]
+		if !ok || parent.time > n.time || n.generation != parent.generation+1 {
+			t.Fatalf("cell %v (t=%d, generation %d): parent %v is not an earlier infection one generation up", cell, n.time, n.generation, n.parent)
+		}
+	}
+}
+
+// Function to infect a 10x10 block of continuous-mode cells at frame 0 and return the number of
+// producing cells in each of frames frames (the production rate in units of one cell's rate)
+func continuousCohortProduction(t *testing.T, cv string, frames int) []int {
+	t.Helper()
+	g := newTestGrid(t, Config{"render": "false", "continuousMode": "true", "continuousIncubationCV": cv, "continuousLysisCV": cv})
+	g.continuousMode = true
+	g.continuousIncubationPeriod, g.continuousLysisTime = 6, 16
+	g.continuousProductionRateV, g.continuousProductionRateD = 1, 0
+	for i := 30; i < 40; i++ {
+		for j := 30; j < 40; j++ {
+			g.state[i][j] = INFECTED_VIRION_CONTINUOUS
+			g.intraWT[i][j] = 1
+			g.markContinuousInfection(i, j, 0)
+		}
+	}
+	producing := make([]int, frames)
+	for frame := 0; frame < frames; frame++ {
+		for i := 30; i < 40; i++ {
+			for j := 30; j < 40; j++ {
+				g.handleContinuousProduction(i, j, frame)
+				if g.isProducing[i][j] && g.state[i][j] == INFECTED_VIRION_CONTINUOUS {
+					producing[frame]++
+				}
+			}
+		}
+	}
+	return producing
+}
+
+// Function to return the simulation_output.csv of a run folder as text
+func outputCSVForTest(t *testing.T, folder string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(folder, "simulation_output.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestContinuousCVZeroKeepsTheSynchronizedCohort(t *testing.T) {
+	// With both CVs at 0 every cell gets the global incubation period and lysis time, as before
+	// the per-cell sampling: the cohort produces from hour 6 until it lyses at hour 16
+	producing := continuousCohortProduction(t, "0", 20)
+	for frame, n := range producing {
+		want := 0
+		if frame >= 6 && frame < 16 {
+			want = 100
+		}
+		if n != want {
+			t.Errorf("frame %d: %d producing cells, want %d", frame, n, want)
+		}
+	}
+
+	// ... and draws no random numbers, so seeded runs keep their streams
+	g := newTestGrid(t, Config{})
+	before := g.rngSource.draws
+	for k := 0; k < 100; k++ {
+		if d := samplePositiveDuration(g.rng, 6, 0); d != 6 {
+			t.Fatalf("samplePositiveDuration(6, cv 0) = %g", d)
+		}
+	}
+	if g.rngSource.draws != before {
+		t.Errorf("cv 0 drew %d random numbers", g.rngSource.draws-before)
+	}
+
+	plain, err := runForTest(t, Config{"randomSeed": "3", "option": "4", "continuousMode": "true"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	zero, err := runForTest(t, Config{"randomSeed": "3", "option": "4", "continuousMode": "true", "continuousIncubationCV": "0", "continuousLysisCV": "0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if outputCSVForTest(t, plain.OutputFolder) != outputCSVForTest(t, zero.OutputFolder) {
+		t.Error("explicit CV 0 changed simulation_output.csv")
+	}
+}
+
+func TestContinuousCVSmoothsProduction(t *testing.T) {
+	// Frame-to-frame jumps of the cohort's production: one step up and one step down of the
+	// whole cohort when synchronized, spread over several frames with per-cell durations
+	jumps := func(series []int) (largest, squares float64) {
+		for k := 1; k < len(series); k++ {
+			d := float64(series[k] - series[k-1])
+			largest = math.Max(largest, math.Abs(d))
+			squares += d * d
+		}
+		return largest, squares
+	}
+	syncLargest, syncSquares := jumps(continuousCohortProduction(t, "0", 30))
+	cvLargest, cvSquares := jumps(continuousCohortProduction(t, "0.3", 30))
+	if syncLargest != 100 {
+		t.Fatalf("synchronized cohort: largest jump %g, want the whole cohort (100)", syncLargest)
+	}
+	// Measured: largest jump 21 and squared jumps 2129 at CV 0.3, against 100 and 20000
+	if cvLargest > syncLargest/3 {
+		t.Errorf("CV 0.3: largest frame-to-frame jump %g, want at most a third of the synchronized %g", cvLargest, syncLargest)
+	}
+	if cvSquares > syncSquares/5 {
+		t.Errorf("CV 0.3: sum of squared jumps %g, want at most a fifth of the synchronized %g", cvSquares, syncSquares)
+	}
+}
+
+func TestSusceptibilityCVZeroKeepsUniformCells(t *testing.T) {
+	g := newTestGrid(t, Config{"susceptibilityCV": "0"})
+	if g.rngSource.draws != newTestGrid(t, Config{}).rngSource.draws {
+		t.Error("susceptibilityCV 0 drew random numbers at initialization")
+	}
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			if g.cellSusceptibility[i][j] != 1 {
+				t.Fatalf("cellSusceptibility(%d,%d) = %g, want 1", i, j, g.cellSusceptibility[i][j])
+			}
+		}
+	}
+	plain, err := runForTest(t, Config{"randomSeed": "3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	zero, err := runForTest(t, Config{"randomSeed": "3", "susceptibilityCV": "0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if outputCSVForTest(t, plain.OutputFolder) != outputCSVForTest(t, zero.OutputFolder) {
+		t.Error("explicit susceptibilityCV 0 changed simulation_output.csv")
+	}
+}
+
+func TestParseHalfLifeUnits(t *testing.T) {
+	cases := []struct {
+		text  string
+		hours float64
+	}{
+		{"4.2h", 4.2},
+		{"45m", 0.75},
+		{"0.5d", 12},
+		{" 3h ", 3},
+		{"0h", 0},
+	}
+	for _, c := range cases {
+		hours, legacy, err := parseHalfLife(c.text)
+		if err != nil || legacy || math.Abs(hours-c.hours) > 1e-12 {
+			t.Errorf("parseHalfLife(%q) = %g, %v, %v; want %g hours", c.text, hours, legacy, err, c.hours)
+		}
+	}
+}
+
+func TestParseHalfLifeRateUsesLn2OverK(t *testing.T) {
+	cases := []struct {
+		text  string
+		hours float64
+	}{
+		{"4/d", math.Ln2 / 4 * 24},
+		{"0.2/h", math.Ln2 / 0.2},
+		{"0.01/m", math.Ln2 / 0.6},
+		{"1 / h", math.Ln2},
+	}
+	for _, c := range cases {
+		hours, legacy, err := parseHalfLife(c.text)
+		if err != nil || legacy || math.Abs(hours-c.hours) > 1e-12 {
+			t.Errorf("parseHalfLife(%q) = %g, %v, %v; want %g hours", c.text, hours, legacy, err, c.hours)
+		}
+	}
+	// k = ln2/t½ and t½ = ln2/k are inverses
+	for _, hours := range []float64{0.5, 3.2, 24} {
+		if back := rateToHalfLifeHours(halfLifeToRatePerDay(hours) / 24); math.Abs(back-hours) > 1e-12 {
+			t.Errorf("half-life %g h -> rate -> %g h", hours, back)
+		}
+	}
+	if k := halfLifeToRatePerDay(0); k != 0 {
+		t.Errorf("halfLifeToRatePerDay(0) = %g, want 0", k)
+	}
+}
+
+func TestParseHalfLifeLegacyBareNumber(t *testing.T) {
+	hours, legacy, err := parseHalfLife("3.2")
+	if err != nil || !legacy || hours != 3.2 {
+		t.Fatalf("parseHalfLife(3.2) = %g, %v, %v; want 3.2 hours, legacy", hours, legacy, err)
+	}
+
+	h := &HalfLife{Name: "virionHalfLife", Raw: "3.2h", Hours: 3.2}
+	if err := h.Set("5"); err != nil {
+		t.Fatal(err)
+	}
+	if !h.Legacy || h.Hours != 5 || h.String() != "5" {
+		t.Errorf("Set(5) gave %+v, want legacy 5 hours printed as 5", *h)
+	}
+	if err := h.Set("1d"); err != nil {
+		t.Fatal(err)
+	}
+	if h.Legacy || h.Hours != 24 || h.String() != "1d" {
+		t.Errorf("Set(1d) gave %+v, want 24 hours without the legacy mark", *h)
+	}
+}
+
+func TestParseHalfLifeRejectsBadInput(t *testing.T) {
+	for _, text := range []string{"", "abc", "-2h", "-1", "4/y", "0/d", "-3/h", "x/h", "h"} {
+		if hours, _, err := parseHalfLife(text); err == nil {
+			t.Errorf("parseHalfLife(%q) = %g, want an error", text, hours)
+		}
+	}
+	h := &HalfLife{Name: "dipHalfLife", Raw: "2h", Hours: 2}
+	if err := h.Set("soon"); err == nil || h.Raw != "2h" || h.Hours != 2 {
+		t.Errorf("Set(soon) = %v and left %+v, want an error and the old value", err, *h)
+	}
+}
+
+func TestLegacyHalfLifeRunsLikeHours(t *testing.T) {
+	legacy, err := runForTest(t, Config{"randomSeed": "2", "virion_half_life": "3.2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hours, err := runForTest(t, Config{"randomSeed": "2", "virion_half_life": "3.2h"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if outputCSVForTest(t, legacy.OutputFolder) != outputCSVForTest(t, hours.OutputFolder) {
+		t.Error("virion_half_life=3.2 and 3.2h give different outputs")
+	}
+	want := "-virion_half_life=3.2 has no unit; assumed hours"
+	if !reflect.DeepEqual(legacy.Warnings, []string{want}) || len(hours.Warnings) != 0 {
+		t.Errorf("warnings %v and %v, want only %q on the bare number", legacy.Warnings, hours.Warnings, want)
+	}
+}
+
+// Function to fill the local IFN field with level everywhere and prepare it for one step under
+// the given -ifnDecay with a 4 h IFN half-life, reading every cell in row-major order
+func localIFNAfterOneStep(t *testing.T, decay string, level float64) *Grid {
+	t.Helper()
+	g := newTestGrid(t, Config{"ifnDecay": decay, "ifn_half_life": "4h"})
+	halfLife, radius, wave := ifn_half_life, IFN_wave_radius, ifnWave
+	t.Cleanup(func() { ifn_half_life, IFN_wave_radius, ifnWave = halfLife, radius, wave })
+	ifn_half_life, IFN_wave_radius, ifnWave = flag_ifn_half_life.Hours, 10, true
+	g.initializeNeighbors()
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			g.IFNConcentration[i][j] = level
+		}
+	}
+	localIFN := g.prepareLocalIFN()
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			localIFN(i, j)
+		}
+	}
+	return g
+}
+
+func TestLocalIFNDecaysByQuarterPowerOfHalfPerStep(t *testing.T) {
+	want := math.Pow(0.5, 1.0/4.0) // TIMESTEP = 1 h, half-life 4 h
+	if math.Abs(want-0.8408964152537145) > 1e-15 {
+		t.Fatalf("0.5^(1/4) = %.16f", want)
+	}
+	g := localIFNAfterOneStep(t, "perStep", 1)
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			if got := g.IFNConcentration[i][j]; math.Abs(got-want) > 1e-12 {
+				t.Fatalf("IFN at (%d,%d) = %.12f after one step, want 0.5^(1/4) = %.12f", i, j, got, want)
+			}
+			if got := g.regionalIFNAverage[i][j]; g.state[i][j] != UNEXPOSED && math.Abs(got-want) > 1e-12 {
+				t.Fatalf("cell (%d,%d) read %.12f, want the decayed field %.12f", i, j, got, want)
+			}
+		}
+	}
+
+	// The legacy perCell decay applies the factor again for every cell read, so a field of
+	// 1 falls below the 1/GRID_SIZE^2 cut-off long before the sweep ends
+	legacy := localIFNAfterOneStep(t, "perCell", 1)
+	if got := legacy.IFNConcentration[GRID_SIZE-1][GRID_SIZE-1]; got != 0 {
+		t.Errorf("perCell decay left IFN %g after a full sweep, want 0", got)
+	}
+}
+
+func TestOneCellPerStateGivesExactPercentages(t *testing.T) {
+	g := newTestGrid(t, Config{})
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			g.state[i][j] = UNEXPOSED // counted by none of the percentages
+		}
+	}
+	k := 0
+	for state := range stateNames {
+		if state != UNEXPOSED {
+			g.state[k%GRID_SIZE][k/GRID_SIZE] = state
+			k++
+		}
+	}
+
+	percent := func(cells int) float64 { return (float64(cells) / float64(GRID_SIZE*GRID_SIZE)) * 100 }
+	checks := []struct {
+		name      string
+		got, want float64
+	}{
+		{"susceptible", g.calculateSusceptiblePercentage(), percent(1)},
+		{"regrowth or antiviral", g.calculateRegrowthedOrAntiviralPercentage(), percent(2)},
+		{"infected", g.calculateInfectedPercentage(), percent(6)},
+		{"DIP-only", g.calculateInfectedDIPOnlyPercentage(), percent(2)},
+		{"both", g.calculateInfectedBothPercentage(), percent(2)},
+		{"antiviral", g.calculateAntiviralPercentage(), percent(1)},
+		{"uninfected", g.calculateUninfectedPercentage(), percent(2)},
+		{"plaque", g.calculatePlaquePercentage(), percent(1)},
+		{"dead", calculateDeadCellPercentage(g.state), percent(1)},
+		{"virion-only cells", float64(g.calculateVirionOnlyInfected()), 2},
+		{"DIP-only cells", float64(g.calculateDipOnlyInfected()), 2},
+		{"both cells", float64(g.calculateBothInfected()), 2},
+	}
+	for _, c := range checks {
+		if c.got != c.want {
+			t.Errorf("%s = %v, want %v", c.name, c.got, c.want)
+		}
+	}
+}
+
+func TestHexRingOffsetsMatchTheDirectEnumeration(t *testing.T) {
+	for radius := 1; radius <= 10; radius++ {
+		var want [][2]int
+		for dx := -radius; dx <= radius; dx++ {
+			for dy := -radius; dy <= radius; dy++ {
+				if (dx != 0 || dy != 0) && getHexDistance(dx, dy) == radius {
+					want = append(want, [2]int{dx, dy})
+				}
+			}
+		}
+		if got := generateHexRing(5, 7, radius); len(got) != len(want) {
+			t.Fatalf("ring %d has %d cells, want %d", radius, len(got), len(want))
+		} else {
+			for k := range want {
+				if got[k] != [2]int{5 + want[k][0], 7 + want[k][1]} {
+					t.Fatalf("ring %d cell %d = %v, want %v", radius, k, got[k], want[k])
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkInitializeNeighbors(b *testing.B) {
+	radius, wave, periodic := IFN_wave_radius, ifnWave, boundaryPeriodic
+	defer func() { IFN_wave_radius, ifnWave, boundaryPeriodic = radius, wave, periodic }()
+	for _, periodic := range []bool{false, true} {
+		b.Run(fmt.Sprintf("periodic=%t", periodic), func(b *testing.B) {
+			if err := applyConfig(Config{}); err != nil {
+				b.Fatal(err)
+			}
+			IFN_wave_radius, ifnWave, boundaryPeriodic = 10, true, periodic
+			g := new(Grid)
+			g.restoreRNG(1, 0)
+			g.initialize()
+			g.burstRadius, g.continuousRadius = 6, 6
+			b.ReportAllocs()
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				g.initializeNeighbors()
+			}
+		})
+	}
+}
+
+// Function to set up a grid with a co-infected cell at the center about to burst over burstRadius 6
+func newBurstGrid(tb testing.TB) (*Grid, int, int) {
+	tb.Helper()
+	if err := applyConfig(Config{"render": "false"}); err != nil {
+		tb.Fatal(err)
+	}
+	g := new(Grid)
+	g.restoreRNG(1, 0)
+	g.initialize()
+	g.burstRadius = 6
+	g.initializeNeighbors()
+	const i, j = GRID_SIZE / 2, GRID_SIZE / 2
+	g.state[i][j], g.previousStates[i][j] = INFECTED_BOTH, INFECTED_BOTH
+	g.localVirions[i][j], g.localDips[i][j] = 20, 10
+	return g, i, j
+}
+
+func TestBurstDepositionIsReproducible(t *testing.T) {
+	t.Cleanup(func() { applyConfig(Config{}) })
+	first, i, j := newBurstGrid(t)
+	first.handleCase4Burst(i, j, 500, 1000, 0, 0)
+	again, _, _ := newBurstGrid(t)
+	again.handleCase4Burst(i, j, 500, 1000, 0, 0)
+	if first.localVirions != again.localVirions || first.localDips != again.localDips {
+		t.Error("the same burst from the same RNG state deposited particles differently")
+	}
+}
+
+func BenchmarkHandleCase4Burst(b *testing.B) {
+	defer applyConfig(Config{})
+	g, i, j := newBurstGrid(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		g.handleCase4Burst(i, j, 500, 1000, 0, 0)
+	}
+}
+
+func TestPartitionPerBurstSplitsEveryBurst(t *testing.T) {
+	g := newTestGrid(t, Config{"partitionSemantics": "perBurst"})
+	saved := k_JumpR
+	t.Cleanup(func() { k_JumpR = saved })
+	k_JumpR = 0.3
+	before := g.rngSource.draws
+	for _, burst := range []int{0, 1, 9, 10, 333, 1000} {
+		v, d := g.partitionRandomJumps(burst, 2*burst)
+		if v != burst*3/10 || d != 2*burst*3/10 {
+			t.Errorf("burst %d/%d: %d virions and %d DIPs jump, want %d and %d", burst, 2*burst, v, d, burst*3/10, 2*burst*3/10)
+		}
+	}
+	if draws := g.rngSource.draws - before; draws != 0 {
+		t.Errorf("perBurst drew %d random numbers, want none", draws)
+	}
+}
+
+func TestPartitionPerCellSendsWholeBursts(t *testing.T) {
+	g := newTestGrid(t, Config{"partitionSemantics": "perCell"})
+	saved := k_JumpR
+	t.Cleanup(func() { k_JumpR = saved })
+	k_JumpR = 0.3
+	const bursts, burstV, burstD = 20000, 100, 150
+	jumped := 0
+	for n := 0; n < bursts; n++ {
+		v, d := g.partitionRandomJumps(burstV, burstD)
+		switch {
+		case v == burstV && d == burstD:
+			jumped++
+		case v != 0 || d != 0:
+			t.Fatalf("perCell split a burst: %d virions and %d DIPs jump out of %d and %d", v, d, burstV, burstD)
+		}
+	}
+	// Binomial(20000, 0.3): standard deviation 65 bursts; 5 sigma keeps the test from flaking
+	sd := math.Sqrt(bursts * 0.3 * 0.7)
+	if math.Abs(float64(jumped)-bursts*0.3) > 5*sd {
+		t.Errorf("%d of %d bursts jumped, want %.0f ± %.0f", jumped, bursts, bursts*0.3, 5*sd)
+	}
+	// The effective fraction matches the per-burst split in expectation
+	if f := g.partitionJumpFraction(); math.Abs(f-0.3) > 5*sd/bursts {
+		t.Errorf("partition jump fraction %.4f, want 0.3", f)
+	}
+}
+
+func TestPartitionJumpFractionInSummary(t *testing.T) {
+	cfg := Config{"randomSeed": "1", "particleSpreadOption": "partition", "ifnSpreadOption": "global", "kJumpR": "0.3", "v_pfu_initial": "30", "burstSizeV": "50", "burstSizeD": "100"}
+	result, err := runForTest(t, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// burstSizeV and burstSizeD split exactly at 0.3, but DIP bursts are scaled by the cell's
+	// DIP:virion ratio and may round down by one particle each
+	if f := result.Summary.PartitionJumpFraction; f < 0.29 || f > 0.3 {
+		t.Errorf("perBurst partition_jump_fraction %.4f, want 0.3", f)
+	}
+	cfg["partitionSemantics"] = "perCell"
+	result, err = runForTest(t, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f := result.Summary.PartitionJumpFraction; f < 0 || f > 1 {
+		t.Errorf("perCell partition_jump_fraction %.4f, want a fraction of released particles", f)
+	}
+}
+
+func BenchmarkPartitionRun(b *testing.B) {
+	for _, semantics := range []string{"perBurst", "perCell"} {
+		b.Run(semantics, func(b *testing.B) {
+			cfg := Config{"render": "false", "randomSeed": "1", "particleSpreadOption": "partition", "ifnSpreadOption": "global",
+				"kJumpR": "0.3", "v_pfu_initial": "30", "partitionSemantics": semantics}
+			for n := 0; n < b.N; n++ {
+				if _, err := Run(cfg, RunOptions{OutputRoot: b.TempDir(), SkipPlots: true}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestBaselineSelfComparisonHasNoDifferences(t *testing.T) {
+	first, err := runForTest(t, Config{"randomSeed": "4"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := runForTest(t, Config{"randomSeed": "4", "baseline": first.OutputFolder, "failOnDivergence": "true"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff := again.Baseline
+	if diff == nil || diff.Diverged || diff.FirstDivergentFrame != -1 || len(diff.Endpoints) != 0 || len(diff.Curves) != 0 ||
+		len(diff.MissingInRun) != 0 || len(diff.MissingInBaseline) != 0 {
+		t.Fatalf("same seed against its own baseline: %+v, want no differences", diff)
+	}
+	written, err := os.ReadFile(filepath.Join(again.OutputFolder, "baseline_diff.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved BaselineDiff
+	if err := json.Unmarshal(written, &saved); err != nil || !reflect.DeepEqual(saved, *diff) {
+		t.Errorf("baseline_diff.json = %s (%v), want %+v", written, err, *diff)
+	}
+}
+
+func TestBaselineReportsAPerturbedFixture(t *testing.T) {
+	result, err := runForTest(t, Config{"randomSeed": "4"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The fixture is a copy of the run with one CSV value (frame 7) and one endpoint changed
+	fixture := t.TempDir()
+	header, rows, err := loadOutputCSV(result.OutputFolder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	column := -1
+	for idx, name := range header {
+		if name == "Total Extracellular Virions" {
+			column = idx
+		}
+	}
+	if column == -1 {
+		t.Fatalf("no Total Extracellular Virions column in %v", header)
+	}
+	value, err := strconv.ParseFloat(rows[7][column], 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows[7][column] = strconv.FormatFloat(value+5, 'f', -1, 64)
+	out, err := os.Create(filepath.Join(fixture, "simulation_output.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := csv.NewWriter(out)
+	w.WriteAll(append([][]string{header}, rows...))
+	out.Close()
+	var summary map[string]interface{}
+	data, err := os.ReadFile(filepath.Join(result.OutputFolder, "summary.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &summary); err != nil {
+		t.Fatal(err)
+	}
+	summary["final_dead_percentage"] = summary["final_dead_percentage"].(float64) + 1
+	data, _ = json.Marshal(summary)
+	if err := os.WriteFile(filepath.Join(fixture, "summary.json"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	diff, err := compareWithBaseline(fixture, result.OutputFolder, 1e-9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !diff.Diverged || diff.FirstDivergentFrame != 7 {
+		t.Fatalf("diverged %t at frame %d, want true at frame 7", diff.Diverged, diff.FirstDivergentFrame)
+	}
+	if len(diff.Curves) != 1 || diff.Curves[0].Column != "Total Extracellular Virions" || diff.Curves[0].FirstDivergentFrame != 7 || diff.Curves[0].MaxAbsDiff != 5 {
+		t.Errorf("curves %+v, want Total Extracellular Virions off by 5 from frame 7", diff.Curves)
+	}
+	if len(diff.Endpoints) != 1 || diff.Endpoints[0].Metric != "final_dead_percentage" || math.Abs(diff.Endpoints[0].Delta+1) > 1e-9 {
+		t.Errorf("endpoints %+v, want final_dead_percentage 1 lower in the run", diff.Endpoints)
+	}
+
+	_, err = runForTest(t, Config{"randomSeed": "4", "baseline": fixture, "failOnDivergence": "true"})
+	if !errors.Is(err, ErrDiverged) {
+		t.Errorf("run against the perturbed fixture returned %v, want ErrDiverged", err)
+	}
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	g := newTestGrid(t, Config{})
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			g.state[i][j] = g.rng.Intn(INFECTED_BOTH_CONTINUOUS + 1)
+			g.localVirions[i][j], g.localDips[i][j] = g.rng.Intn(1000), g.rng.Intn(1000)
+			g.IFNConcentration[i][j] = g.rng.ExpFloat64() / 3
+		}
+	}
+	dir := t.TempDir()
+	for _, name := range []string{"snapshot_0_hours.csv", "snapshot_0_hours.csv.gz"} {
+		path := filepath.Join(dir, name)
+		g.saveSnapshotCSV(path)
+		s, err := LoadSnapshot(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(s.State) != GRID_SIZE {
+			t.Fatalf("%s: %d rows, want %d", name, len(s.State), GRID_SIZE)
+		}
+		for i := 0; i < GRID_SIZE; i++ {
+			for j := 0; j < GRID_SIZE; j++ {
+				if s.State[i][j] != g.state[i][j] || s.LocalVirions[i][j] != g.localVirions[i][j] ||
+					s.LocalDips[i][j] != g.localDips[i][j] || s.IFNConcentration[i][j] != g.IFNConcentration[i][j] {
+					t.Fatalf("%s: cell (%d,%d) reloaded as %d/%d/%d/%v, want %d/%d/%d/%v", name, i, j,
+						s.State[i][j], s.LocalVirions[i][j], s.LocalDips[i][j], s.IFNConcentration[i][j],
+						g.state[i][j], g.localVirions[i][j], g.localDips[i][j], g.IFNConcentration[i][j])
+				}
+			}
+		}
+		virions, dips := latticeParticles(g)
+		if v, d := s.Totals(); v != virions || d != dips {
+			t.Errorf("%s: totals %d virions and %d DIPs, want %d and %d", name, v, d, virions, dips)
+		}
+	}
+}
+
+func TestSnapshotTotalsMatchOutputCSV(t *testing.T) {
+	result, err := runForTest(t, Config{"randomSeed": "5", "option": "4", "snapshotEvery": "2", "snapshotGzip": "true"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, rows, err := loadOutputCSV(result.OutputFolder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	col := make(map[string]int)
+	for idx, name := range header {
+		col[name] = idx
+	}
+	checked := 0
+	for _, row := range rows {
+		hours := atoiForTest(t, row[col["Time"]])
+		path := filepath.Join(result.OutputFolder, fmt.Sprintf("snapshot_%d_hours.csv.gz", hours))
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		s, err := LoadSnapshot(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		virions, dips := s.Totals()
+		if strconv.Itoa(virions) != row[col["Total Extracellular Virions"]] || strconv.Itoa(dips) != row[col["Total Extracellular DIPs"]] {
+			t.Errorf("%d h: snapshot totals %d virions and %d DIPs, simulation_output.csv has %s and %s", hours,
+				virions, dips, row[col["Total Extracellular Virions"]], row[col["Total Extracellular DIPs"]])
+		}
+		checked++
+	}
+	if checked < TIME_STEPS/2 {
+		t.Errorf("compared %d snapshots, want one every 2 frames", checked)
+	}
+}
+
+// Function to copy the checkpoint after frame into a fresh folder with the rows of
+// simulation_output.csv a run killed right after it would have left (as the .partial file)
+func interruptedRunFolder(t *testing.T, folder string, frame int) string {
+	t.Helper()
+	dir := t.TempDir()
+	name := fmt.Sprintf("checkpoint_%d_hours.gob", frame*TIMESTEP)
+	data, err := os.ReadFile(filepath.Join(folder, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitAfter(outputCSVForTest(t, folder), "\n")
+	partial := strings.Join(lines[:frame+2], "") // header and frames 0..frame
+	if err := os.WriteFile(filepath.Join(dir, "simulation_output.csv.partial"), []byte(partial), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, name)
+}
+
+func TestResumedRunMatchesUninterruptedRun(t *testing.T) {
+	for _, cfg := range []Config{
+		{"randomSeed": "3"},
+		{"randomSeed": "3", "d_pfu_initial": "3000", "ifnSpreadOption": "global"},
+		{"randomSeed": "3", "option": "4", "continuousMode": "true"},
+	} {
+		full := Config{"checkpointEvery": "5"}
+		for name, value := range cfg {
+			full[name] = value
+		}
+		uninterrupted, err := runForTest(t, full)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := outputCSVForTest(t, uninterrupted.OutputFolder)
+		for _, frame := range []int{4, 19} {
+			resume := Config{"resumeFrom": interruptedRunFolder(t, uninterrupted.OutputFolder, frame)}
+			for name, value := range cfg {
+				resume[name] = value
+			}
+			// The random stream comes from the checkpoint, so a different -randomSeed changes nothing
+			resume["randomSeed"] = "99"
+			resumed, err := runForTest(t, resume)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := outputCSVForTest(t, resumed.OutputFolder); got != want {
+				t.Errorf("%v resumed after frame %d: simulation_output.csv differs from the uninterrupted run", cfg, frame)
+			}
+			if resumed.Summary.StateHash != uninterrupted.Summary.StateHash {
+				t.Errorf("%v resumed after frame %d: state hash %s, want %s", cfg, frame, resumed.Summary.StateHash, uninterrupted.Summary.StateHash)
+			}
+		}
+	}
+}
+
+func TestResumeCarriesOverOnlyCompleteEarlierRows(t *testing.T) {
+	cfg := Config{"randomSeed": "3", "checkpointEvery": "5"}
+	uninterrupted, err := runForTest(t, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.SplitAfter(outputCSVForTest(t, uninterrupted.OutputFolder), "\n")
+
+	// A killed run left frames 0..9 and half of frame 10; only frames 0..9 are copied
+	checkpoint := interruptedRunFolder(t, uninterrupted.OutputFolder, 9)
+	partial := filepath.Join(filepath.Dir(checkpoint), "simulation_output.csv.partial")
+	half := want[11][:len(want[11])/2]
+	data, err := os.ReadFile(partial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(partial, append(data, half...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	resumed, err := runForTest(t, Config{"randomSeed": "3", "resumeFrom": checkpoint})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := outputCSVForTest(t, resumed.OutputFolder); got != strings.Join(want, "") {
+		t.Error("resumed CSV differs from the uninterrupted run after a half-written row")
+	}
+
+	// Without the earlier CSV next to the checkpoint the resumed CSV starts at frame 10
+	if err := os.Remove(partial); err != nil {
+		t.Fatal(err)
+	}
+	resumed, err = runForTest(t, Config{"randomSeed": "3", "resumeFrom": checkpoint})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := outputCSVForTest(t, resumed.OutputFolder); got != want[0]+strings.Join(want[11:], "") {
+		t.Error("resumed CSV without the earlier rows is not the header and frames 10 on")
+	}
+}
+
+// Function to return the mean and the standard error of the mean of values
+func meanAndStandardError(values []float64) (float64, float64) {
+	mean := 0.0
+	for _, v := range values {
+		mean += v
+	}
+	mean /= float64(len(values))
+	variance := 0.0
+	for _, v := range values {
+		variance += (v - mean) * (v - mean)
+	}
+	variance /= float64(len(values) - 1)
+	return mean, math.Sqrt(variance / float64(len(values)))
+}
+
+// Function to return the final dead percentage of seeds 1..seeds for a plaque seeded at
+// (focus, focus) under -boundary=boundary (option 4, no IFN, burstRadius 6)
+func seededPlaqueDeadPercentages(t *testing.T, boundary string, focus, seeds int) []float64 {
+	t.Helper()
+	var dead []float64
+	for seed := 1; seed <= seeds; seed++ {
+		result, err := runForTest(t, Config{"randomSeed": strconv.Itoa(seed), "option": "4", "ifnSpreadOption": "noIFN",
+			"burstRadius": "6", "rho": "0.9", "burstSizeV": "300", "boundary": boundary,
+			"focusX": strconv.Itoa(focus), "focusY": strconv.Itoa(focus)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		dead = append(dead, result.Summary.FinalDeadPercentage)
+	}
+	return dead
+}
+
+// Function to return the per-seed differences a[k] - b[k]
+func pairedDifferences(a, b []float64) []float64 {
+	diff := make([]float64, len(a))
+	for k := range a {
+		diff[k] = a[k] - b[k]
+	}
+	return diff
+}
+
+// TestPeriodicCornerMatchesCenter seeds a plaque at the corner and at the center of a periodic
+// grid with the same 50 seeds. The paired difference of the final dead percentage must lie
+// within ±0.05 points (about 6% of the plaque) with three standard errors to spare. Measured:
+// corner 0.875, center 0.870, difference 0.005 ± 0.007. An absorbing corner, which loses three
+// quarters of its neighborhood, checks over 20 seeds that the test tells them apart (-0.62 ± 0.15).
+func TestPeriodicCornerMatchesCenter(t *testing.T) {
+	if testing.Short() {
+		t.Skip("120 runs")
+	}
+	const seeds, margin = 50, 0.05
+	center := seededPlaqueDeadPercentages(t, "periodic", 38, seeds)
+	corner := seededPlaqueDeadPercentages(t, "periodic", 0, seeds)
+	diff, se := meanAndStandardError(pairedDifferences(corner, center))
+	if math.Abs(diff)+3*se > margin {
+		t.Errorf("periodic corner - center = %.3f ± %.3f points over %d seeds, want within ±%.2f", diff, se, seeds, margin)
+	}
+
+	absorbing := seededPlaqueDeadPercentages(t, "absorbing", 0, 20)
+	diff, se = meanAndStandardError(pairedDifferences(absorbing, center[:20]))
+	if diff+3*se > -margin {
+		t.Errorf("absorbing corner - center = %.3f ± %.3f points, want clearly below -%.2f", diff, se, margin)
+	}
+}
+
+func TestDeadFrontRadiusOfAHandBuiltPlaque(t *testing.T) {
+	g := newTestGrid(t, Config{})
+	center := [2]int{GRID_SIZE / 2, GRID_SIZE / 2}
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			g.state[i][j] = SUSCEPTIBLE
+			if getHexDistanceBetweenPoints(center[0], center[1], i, j) <= 4 {
+				g.state[i][j] = DEAD
+			}
+		}
+	}
+	if front := deadFrontRadius(g.radialProfile(center)); front != 4 {
+		t.Errorf("dead disc of radius 4: front %d, want 4", front)
+	}
+	g.state[center[0]+7][center[1]] = DEAD
+	if front := deadFrontRadius(g.radialProfile(center)); front != 7 {
+		t.Errorf("stray dead cell at ring 7: front %d, want 7", front)
+	}
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			g.state[i][j] = SUSCEPTIBLE
+		}
+	}
+	if front := deadFrontRadius(g.radialProfile(center)); front != -1 {
+		t.Errorf("no dead cells: front %d, want -1", front)
+	}
+}
+
+func TestDeadFrontRadiusAcrossSeeds(t *testing.T) {
+	const seeds = 10
+	var fronts []int
+	for seed := 1; seed <= seeds; seed++ {
+		result, err := runForTest(t, Config{"randomSeed": strconv.Itoa(seed), "particleSpreadOption": "celltocell", "dumpStatesAt": "25"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The outermost DEAD cell around the option 2 seed cell (25,25) in the last snapshot
+		s, err := LoadSnapshot(filepath.Join(result.OutputFolder, "snapshot_25_hours.csv"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := -1
+		for i := range s.State {
+			for j := range s.State[i] {
+				if d := getHexDistanceBetweenPoints(25, 25, i, j); s.State[i][j] == DEAD && d > want {
+					want = d
+				}
+			}
+		}
+		if result.Summary.DeadFrontRadius != want {
+			t.Errorf("seed %d: dead_front_radius %d, the snapshot's outermost DEAD cell is at ring %d", seed, result.Summary.DeadFrontRadius, want)
+		}
+		fronts = append(fronts, result.Summary.DeadFrontRadius)
+	}
+	// Seeds 1-10 give rings 1-3: every front lies within one ring of the median
+	sorted := append([]int(nil), fronts...)
+	sort.Ints(sorted)
+	median := sorted[(seeds-1)/2]
+	for k, front := range fronts {
+		if front < median-1 || front > median+1 {
+			t.Errorf("seed %d: dead front at ring %d, more than one ring from the median %d (%v)", k+1, front, median, fronts)
+		}
+	}
+}
+
+// Function to read the state of every cell at every hour from the snapshots of a -dumpStatesAt=all run
+func stateHistory(t *testing.T, folder string) [][][]int {
+	t.Helper()
+	history := make([][][]int, TIME_STEPS)
+	for hour := range history {
+		s, err := LoadSnapshot(filepath.Join(folder, fmt.Sprintf("snapshot_%d_hours.csv", hour)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		history[hour] = s.State
+	}
+	return history
+}
+
+// TestFixedDIPClearanceClearsAtExactlyFiveSteps follows every DIP-only episode through the
+// snapshots: with -dipClearanceStd=0 each cleared cell is SUSCEPTIBLE again exactly five frames
+// after it was infected, including cells infected a second time.
+func TestFixedDIPClearanceClearsAtExactlyFiveSteps(t *testing.T) {
+	result, err := runForTest(t, Config{"randomSeed": "7", "option": "3", "v_pfu_initial": "300", "d_pfu_initial": "3000",
+		"dipClearanceModel": "fixedNormal", "dipClearanceMean": "5", "dipClearanceStd": "0", "dumpStatesAt": "all"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	history := stateHistory(t, result.OutputFolder)
+	cleared := 0
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			start := -1
+			for hour := 0; hour < TIME_STEPS; hour++ {
+				state := history[hour][i][j]
+				switch {
+				case isInfectedDIPOnly(state) && start == -1:
+					start = hour
+				case !isInfectedDIPOnly(state) && start >= 0:
+					if state == SUSCEPTIBLE {
+						cleared++
+						if hour-start != 5 {
+							t.Errorf("cell (%d,%d) DIP-only from %d h to %d h, want 5 frames", i, j, start, hour)
+						}
+					}
+					start = -1
+				}
+				if start >= 0 && hour-start >= 5 {
+					t.Fatalf("cell (%d,%d) still DIP-only at %d h, infected at %d h", i, j, hour, start)
+				}
+			}
+		}
+	}
+	if cleared == 0 {
+		t.Fatal("no DIP-only cell was cleared")
+	}
+}
+
+// TestPoissonLambdaDipScalesDIPEntry draws -infectionModel=poisson infection on a grid with 3
+// virions and 3 DIPs on every cell: with a large lambdaDip nearly every virion-infected cell is
+// co-infected, with lambdaDip=0 no DIP enters any cell.
+func TestPoissonLambdaDipScalesDIPEntry(t *testing.T) {
+	saved := lambdaDip
+	t.Cleanup(func() { lambdaDip = saved })
+	g := newTestGrid(t, Config{"infectionModel": "poisson"})
+	var pow powCache
+	pow.reset(64)
+	for _, lambda := range []float64{100, 0} {
+		lambdaDip = lambda
+		byVirion, both := 0, 0
+		for i := 0; i < GRID_SIZE; i++ {
+			for j := 0; j < GRID_SIZE; j++ {
+				g.localVirions[i][j], g.localDips[i][j] = 3, 3
+				g.virionsAtFrameStart[i][j], g.dipsAtFrameStart[i][j] = 3, 3
+				d := g.drawInfection(g.rng, &pow, 0.1, 0.1, i, j)
+				if lambda == 0 && (d.byDip || d.dips != 0 || d.probD != 0) {
+					t.Fatalf("lambdaDip=0: cell (%d,%d) drew %d DIPs (P=%g)", i, j, d.dips, d.probD)
+				}
+				if d.byVirion {
+					byVirion++
+					if d.byDip {
+						both++
+					}
+				}
+			}
+		}
+		if byVirion < 500 {
+			t.Fatalf("lambdaDip=%g: only %d cells infected by virions", lambda, byVirion)
+		}
+		if fraction := float64(both) / float64(byVirion); lambda > 0 && fraction < 0.99 {
+			t.Errorf("lambdaDip=%g: %d of %d virion-infected cells co-infected, want nearly all", lambda, both, byVirion)
+		}
+	}
+}
+
+// TestCompetitionBurstShrinksWithDVG lyses a co-infected cell holding 100 times more DVG than WT
+// genomes and a virion-only cell under -burstModel=competition: the first releases fewer virions
+func TestCompetitionBurstShrinksWithDVG(t *testing.T) {
+	savedV, savedD := BURST_SIZE_V, BURST_SIZE_D
+	t.Cleanup(func() { BURST_SIZE_V, BURST_SIZE_D = savedV, savedD })
+	BURST_SIZE_V, BURST_SIZE_D = 50, 100
+	g := newTestGrid(t, Config{"burstModel": "competition", "burstLog": "true"})
+	g.intraWT[1][1], g.intraDVG[1][1] = 10, 1000
+	g.intraWT[2][2], g.intraDVG[2][2] = 10, 0
+	dvgV, dvgD := g.lysisBurst(1, 1, INFECTED_BOTH, 3)
+	wtV, wtD := g.lysisBurst(2, 2, INFECTED_VIRION, 3)
+	if wtV != BURST_SIZE_V || wtD != 0 {
+		t.Errorf("intraDVG=0 burst %d virions, %d DIPs, want %d and 0", wtV, wtD, BURST_SIZE_V)
+	}
+	if dvgV >= wtV || dvgD <= 0 {
+		t.Errorf("intraDVG=1000, intraWT=10 burst %d virions, %d DIPs; intraDVG=0 burst %d virions", dvgV, dvgD, wtV)
+	}
+	if g.intraWT[1][1]+g.intraDVG[1][1]+g.intraWT[2][2] != 0 {
+		t.Error("lysis left intracellular genomes behind")
+	}
+	want := []burstEvent{{3, 1, 1, INFECTED_BOTH, 10, 1000, dvgV, dvgD}, {3, 2, 2, INFECTED_VIRION, 10, 0, wtV, wtD}}
+	if !reflect.DeepEqual(g.burstEvents, want) {
+		t.Errorf("burst log %v, want %v", g.burstEvents, want)
+	}
+}
+
+// TestCompetitionBurstsInRun checks bursts.csv of a -burstModel=competition run with DIPs: the
+// lyses with more DVG than WT genomes release fewer virions on average than those without DVG
+// genomes. Poisson entry lets more than one genome of a type enter a cell.
+func TestCompetitionBurstsInRun(t *testing.T) {
+	result, err := runForTest(t, Config{"randomSeed": "7", "option": "3", "v_pfu_initial": "300", "d_pfu_initial": "3000",
+		"burstModel": "competition", "burstLog": "true", "infectionModel": "poisson"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(filepath.Join(result.OutputFolder, "bursts.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dvgDominated, dvgFree []float64
+	for _, row := range records[1:] {
+		wt, dvg, burstV := atoiForTest(t, row[4]), atoiForTest(t, row[5]), atoiForTest(t, row[6])
+		switch {
+		case dvg == 0:
+			dvgFree = append(dvgFree, float64(burstV))
+		case dvg > wt:
+			dvgDominated = append(dvgDominated, float64(burstV))
+		}
+	}
+	if len(dvgDominated) < 10 || len(dvgFree) < 10 {
+		t.Fatalf("%d DVG-dominated and %d DVG-free lyses, want at least 10 of each", len(dvgDominated), len(dvgFree))
+	}
+	dominated, _ := meanAndStandardError(dvgDominated)
+	free, _ := meanAndStandardError(dvgFree)
+	if dominated >= free {
+		t.Errorf("DVG-dominated lyses release %.1f virions on average, DVG-free ones %.1f", dominated, free)
+	}
+}
+
+// TestPersistKeepsDIPOnlyCellsSecretingIFN follows one DIP-only cell with no particles around it
+// under global IFN for 48 frames: -dipPersistence=persist never clears it and, once past the IFN
+// delay, it adds (R + D_only_IFN_stimulate_ratio) * TIMESTEP to the DIP share of the pool every
+// frame. Under clear it is SUSCEPTIBLE again within the DVG recovery time.
+func TestPersistKeepsDIPOnlyCellsSecretingIFN(t *testing.T) {
+	savedWave, savedTau, savedR := ifnWave, TAU, R
+	savedMean, savedStd := MEAN_DVG_RECOVERY_TIME, STANDARD_DVG_RECOVERY_TIME
+	t.Cleanup(func() {
+		ifnWave, TAU, R = savedWave, savedTau, savedR
+		MEAN_DVG_RECOVERY_TIME, STANDARD_DVG_RECOVERY_TIME = savedMean, savedStd
+	})
+	ifnWave, TAU, R = false, 12, 1
+	MEAN_DVG_RECOVERY_TIME, STANDARD_DVG_RECOVERY_TIME = 3, 1
+	noIFN := func(i, j int) float64 { return 0 }
+	for _, persistence := range []string{"persist", "clear"} {
+		g := newTestGrid(t, Config{"dipPersistence": persistence})
+		g.state[10][10] = INFECTED_DIP
+		rate := (float64(R) + D_only_IFN_stimulate_ratio) * float64(TIMESTEP)
+		for frame := 1; frame <= 48; frame++ {
+			before := g.globalIFNBySource[IFN_SOURCE_DIP]
+			newGrid := g.state
+			g.sweepInfectedCells(&newGrid, frame, noIFN)
+			g.state = newGrid
+			g.handleDipOnlyClearance(frame)
+			if persistence == "clear" {
+				if g.state[10][10] == SUSCEPTIBLE {
+					break
+				}
+				if float64(frame*TIMESTEP) > MEAN_DVG_RECOVERY_TIME+5*STANDARD_DVG_RECOVERY_TIME {
+					t.Fatalf("clear: still %d at %d h", g.state[10][10], frame*TIMESTEP)
+				}
+				continue
+			}
+			if g.state[10][10] != INFECTED_DIP {
+				t.Fatalf("persist: DIP-only cell became %d at %d h", g.state[10][10], frame*TIMESTEP)
+			}
+			// The IFN delay is IFN_DELAY + STD_IFN_DELAY * N(0,1), drawn every frame
+			if added := g.globalIFNBySource[IFN_SOURCE_DIP] - before; frame*TIMESTEP > 3*IFN_DELAY && added != rate {
+				t.Fatalf("persist: %g IFN added at %d h, want %g", added, frame*TIMESTEP, rate)
+			}
+		}
+	}
+}
+
+// TestPersistRunKeepsEveryDIPOnlyCell runs a DIPs-only plaque with no cell allowed to leave
+// DIP-only for ANTIVIRAL: under persist no DIP-only cell ever changes state (there are no
+// virions to co-infect it), under clear cells return to SUSCEPTIBLE
+func TestPersistRunKeepsEveryDIPOnlyCell(t *testing.T) {
+	for _, persistence := range []string{"persist", "clear"} {
+		result, err := runForTest(t, Config{"randomSeed": "7", "option": "3", "v_pfu_initial": "0", "d_pfu_initial": "3000",
+			"antiviralEligibleStates": "SUSCEPTIBLE,REGROWTH", "dipPersistence": persistence, "dumpStatesAt": "all"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		history := stateHistory(t, result.OutputFolder)
+		dipOnly, left := 0, 0
+		for i := 0; i < GRID_SIZE; i++ {
+			for j := 0; j < GRID_SIZE; j++ {
+				for hour := 1; hour < TIME_STEPS; hour++ {
+					if isInfectedDIPOnly(history[hour-1][i][j]) && !isInfectedDIPOnly(history[hour][i][j]) {
+						left++
+						if persistence == "persist" {
+							t.Errorf("persist: cell (%d,%d) left DIP-only for %d at %d h", i, j, history[hour][i][j], hour)
+						}
+					}
+				}
+				if isInfectedDIPOnly(history[TIME_STEPS-1][i][j]) {
+					dipOnly++
+				}
+			}
+		}
+		if dipOnly == 0 {
+			t.Errorf("%s: no DIP-only cell at the end", persistence)
+		}
+		if persistence == "clear" && left == 0 {
+			t.Error("clear: no DIP-only cell was cleared")
+		}
+	}
+}
+
+// TestRandomDIPJumpsConserveMass lyses nine co-infected cells in one infected-cell sweep under
+// -particleSpreadOption=jumprandomly: the lattice gains exactly the DIPs the sweep released and
+// counted in totalRandomJumpDIPs. The jumps used to run in goroutines racing with the sweep; run
+// it under go test -race.
+func TestRandomDIPJumpsConserveMass(t *testing.T) {
+	savedRandomly, savedV, savedD, savedPartition := jumpRandomly, allowVirionJump, allowDIPJump, par_celltocell_random
+	savedBurstV, savedBurstD := BURST_SIZE_V, BURST_SIZE_D
+	t.Cleanup(func() {
+		jumpRandomly, allowVirionJump, allowDIPJump, par_celltocell_random = savedRandomly, savedV, savedD, savedPartition
+		BURST_SIZE_V, BURST_SIZE_D = savedBurstV, savedBurstD
+	})
+	jumpRandomly, allowVirionJump, allowDIPJump, par_celltocell_random = true, true, true, false
+	BURST_SIZE_V, BURST_SIZE_D = 50, 100
+	g := newTestGrid(t, Config{"particleSpreadOption": "jumprandomly"})
+	for i := 20; i < 50; i += 10 {
+		for j := 20; j < 50; j += 10 {
+			g.state[i][j] = INFECTED_BOTH
+			g.lysisThreshold[i][j], g.timeSinceInfectVorBoth[i][j] = 1, 5
+			g.localVirions[i][j], g.localDips[i][j] = 4, 8
+		}
+	}
+	_, dipsBefore := latticeParticles(g)
+	newGrid := g.state
+	g.sweepInfectedCells(&newGrid, 1, func(i, j int) float64 { return 0 })
+	_, dips := latticeParticles(g)
+	if g.releasedDIPsNow == 0 {
+		t.Fatal("no DIPs released")
+	}
+	if dips-dipsBefore != g.releasedDIPsNow || g.totalRandomJumpDIPs != g.releasedDIPsNow {
+		t.Errorf("released %d DIPs, %d jumped, the lattice gained %d", g.releasedDIPsNow, g.totalRandomJumpDIPs, dips-dipsBefore)
+	}
+	for i := 20; i < 50; i += 10 {
+		for j := 20; j < 50; j += 10 {
+			if newGrid[i][j] != DEAD {
+				t.Fatalf("cell (%d,%d) did not lyse", i, j)
+			}
+		}
+	}
+}
+
+func TestIFNResponseExpKeepsTheExponential(t *testing.T) {
+	savedRho := RHO
+	t.Cleanup(func() { RHO = savedRho })
+	RHO = 0.02
+	newTestGrid(t, Config{"ifnResponse": "exp", "dipIfnAlpha": "1.5"})
+	for _, ifn := range []float64{0, 0.1, 1, 10, 100} {
+		if got, want := perParticleChance(PARTICLE_DIP, ifn), RHO*math.Exp(-1.5*ifn); got != want {
+			t.Errorf("IFN %g: chance %g, want RHO*exp(-ALPHA*IFN) = %g", ifn, got, want)
+		}
+	}
+}
+
+// TestHillProtectionLevelsOff checks -ifnResponse=hill: no protection without IFN, half at K,
+// steeper around K for a larger n, and a factor that decreases towards 0 without reaching it
+func TestHillProtectionLevelsOff(t *testing.T) {
+	newTestGrid(t, Config{"ifnResponse": "hill", "ifnHillK": "2", "ifnHillN": "1"})
+	if p := ifnProtection(5, 0); p != 1 {
+		t.Errorf("protection %g without IFN, want 1", p)
+	}
+	if p := ifnProtection(5, 2); math.Abs(p-0.5) > 1e-12 {
+		t.Errorf("protection %g at IFN = K, want 0.5", p)
+	}
+	// The alpha is unused: 1 - 8/(2+8) at IFN 8
+	if p := ifnProtection(100, 8); math.Abs(p-0.2) > 1e-12 {
+		t.Errorf("protection %g at IFN 8, want 0.2", p)
+	}
+	previous := 1.0
+	for ifn := 0.5; ifn <= 1e6; ifn *= 2 {
+		p := ifnProtection(5, ifn)
+		if p >= previous || p <= 0 {
+			t.Fatalf("protection %g at IFN %g after %g: want decreasing and > 0", p, ifn, previous)
+		}
+		previous = p
+	}
+
+	newTestGrid(t, Config{"ifnResponse": "hill", "ifnHillK": "2", "ifnHillN": "4"})
+	if below, above := ifnProtection(5, 1), ifnProtection(5, 4); below <= 1-1.0/3 || above >= 1.0/3 {
+		t.Errorf("n=4: protection %g at K/2 and %g at 2K, want steeper than n=1 (2/3 and 1/3)", below, above)
+	}
+}
+
+// TestPerParticleChanceAgreesAcrossIFNBranches sweeps the same grid under uniform IFN once with the
+// local (ifnWave) and once with the global IFN reader, with equal virion and DIP alphas: both
+// readers give every cell the same level, virion and DIP chances are equal (R = 1), and the
+// sweeps infect and commit the same cells.
+func TestPerParticleChanceAgreesAcrossIFNBranches(t *testing.T) {
+	savedWave, savedTau, savedR, savedRho, savedAlpha := ifnWave, TAU, R, RHO, ALPHA
+	savedHalfLife, savedRadius := ifn_half_life, IFN_wave_radius
+	savedGlobal, savedPerCell, savedMax := globalIFN, globalIFNperCell, maxGlobalIFN
+	t.Cleanup(func() {
+		ifnWave, TAU, R, RHO, ALPHA = savedWave, savedTau, savedR, savedRho, savedAlpha
+		ifn_half_life, IFN_wave_radius = savedHalfLife, savedRadius
+		globalIFN, globalIFNperCell, maxGlobalIFN = savedGlobal, savedPerCell, savedMax
+	})
+	TAU, R, RHO, ALPHA = 12, 1, 0.05, 1.5
+	ifn_half_life, IFN_wave_radius = 0, 10
+	const level = 0.4
+
+	var sweeps [2][GRID_SIZE][GRID_SIZE]int
+	var timers [2][GRID_SIZE][GRID_SIZE]int
+	for b, wave := range []bool{true, false} {
+		ifnWave = wave
+		g := newTestGrid(t, Config{"virionIfnAlpha": "1.5", "dipIfnAlpha": "1.5"})
+		g.initializeNeighbors()
+		for i := 0; i < GRID_SIZE; i++ {
+			for j := 0; j < GRID_SIZE; j++ {
+				g.IFNConcentration[i][j] = level
+				g.localVirions[i][j], g.localDips[i][j] = (i+j)%4, (i*j)%4
+				g.virionsAtFrameStart[i][j], g.dipsAtFrameStart[i][j] = g.localVirions[i][j], g.localDips[i][j]
+			}
+		}
+		var localIFN func(i, j int) float64
+		if wave {
+			localIFN = g.prepareLocalIFN()
+		} else {
+			globalIFN, globalIFNperCell = level*GRID_SIZE*GRID_SIZE, level
+			localIFN = g.prepareGlobalIFN()
+		}
+		for i := 0; i < GRID_SIZE; i++ {
+			for j := 0; j < GRID_SIZE; j++ {
+				ifn := localIFN(i, j)
+				if math.Abs(ifn-level) > 1e-9 {
+					t.Fatalf("ifnWave=%t: cell (%d,%d) sees IFN %g, want %g", wave, i, j, ifn, level)
+				}
+				if v, d := perParticleChance(PARTICLE_VIRION, ifn), perParticleChance(PARTICLE_DIP, ifn); v != d {
+					t.Fatalf("ifnWave=%t: virion chance %g, DIP chance %g at equal alphas", wave, v, d)
+				}
+			}
+		}
+		sweeps[b] = g.state
+		g.sweepUninfectedCells(&sweeps[b], 1, localIFN)
+		timers[b] = g.antiviralDuration
+	}
+	infected := 0
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			if sweeps[0][i][j] != sweeps[1][i][j] || timers[0][i][j] != timers[1][i][j] {
+				t.Fatalf("cell (%d,%d): local IFN gives state %d (antiviral timer %d), global IFN %d (%d)",
+					i, j, sweeps[0][i][j], timers[0][i][j], sweeps[1][i][j], timers[1][i][j])
+			}
+			if isInfectedState(sweeps[0][i][j]) {
+				infected++
+			}
+		}
+	}
+	if infected == 0 {
+		t.Fatal("the sweeps infected no cell")
+	}
+}
+
+// TestPerParticleChanceDiffersOutsideRIsOne pins the documented differences between the particle
+// types at equal alphas: virions see the level divided by R, and RHO without IFN protection while
+// R or TAU is 0
+func TestPerParticleChanceDiffersOutsideRIsOne(t *testing.T) {
+	savedTau, savedR, savedRho, savedAlpha, savedStimulate := TAU, R, RHO, ALPHA, VStimulateIFN
+	t.Cleanup(func() { TAU, R, RHO, ALPHA, VStimulateIFN = savedTau, savedR, savedRho, savedAlpha, savedStimulate })
+	TAU, RHO, ALPHA, VStimulateIFN = 12, 0.05, 1.5, true
+	newTestGrid(t, Config{})
+	const level = 0.4
+	dip := RHO * math.Exp(-ALPHA*level)
+	for _, c := range []struct {
+		r, tau int
+		virion float64
+	}{
+		{1, 12, dip},
+		{2, 12, RHO * math.Exp(-ALPHA*level/2)},
+		{0, 12, RHO},
+		{1, 0, RHO},
+	} {
+		R, TAU = c.r, c.tau
+		if v, d := perParticleChance(PARTICLE_VIRION, level), perParticleChance(PARTICLE_DIP, level); math.Abs(v-c.virion) > 1e-15 || d != dip {
+			t.Errorf("R=%d TAU=%d: virion chance %g, DIP chance %g; want %g and %g", c.r, c.tau, v, d, c.virion, dip)
+		}
+	}
+}
+
+// Function to give every cell of an otherwise empty grid an IFN pulse of 1 at frame 0, run 40
+// frames of the uninfected-cell sweep with local IFN (2 h half-life) under the antiviral commit
+// model and return the number of cells that became ANTIVIRAL
+func antiviralCellsAfterIFNPulse(t *testing.T, model string) int {
+	t.Helper()
+	savedWave, savedTau, savedHalfLife, savedRadius, savedEligible := ifnWave, TAU, ifn_half_life, IFN_wave_radius, antiviralEligible
+	t.Cleanup(func() {
+		ifnWave, TAU, ifn_half_life, IFN_wave_radius, antiviralEligible = savedWave, savedTau, savedHalfLife, savedRadius, savedEligible
+	})
+	ifnWave, TAU, ifn_half_life, IFN_wave_radius = true, 12, 2, 10
+	antiviralEligible = map[int]bool{SUSCEPTIBLE: true}
+	g := newTestGrid(t, Config{"antiviralCommitModel": model, "antiviralIFNThreshold": "0.5"})
+	g.initializeNeighbors()
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			g.IFNConcentration[i][j] = 1
+		}
+	}
+	antiviral := 0
+	for frame := 1; frame <= 40; frame++ {
+		localIFN := g.prepareLocalIFN()
+		newGrid := g.state
+		g.sweepUninfectedCells(&newGrid, frame, localIFN)
+		for i := 0; i < GRID_SIZE; i++ {
+			for j := 0; j < GRID_SIZE; j++ {
+				if newGrid[i][j] == ANTIVIRAL && g.state[i][j] != ANTIVIRAL {
+					antiviral++
+				}
+			}
+		}
+		g.state = newGrid
+	}
+	return antiviral
+}
+
+// TestIFNDependentCommitmentNeedsLastingIFN checks the -antiviralCommitModel models on a single
+// IFN pulse that stays above 0.5 for two frames and on the grid for about 25: the legacy timer
+// runs while any IFN is left and commits nearly every cell, the ifnDependent one stops below the
+// threshold and commits almost none
+func TestIFNDependentCommitmentNeedsLastingIFN(t *testing.T) {
+	cells := GRID_SIZE * GRID_SIZE
+	if legacy := antiviralCellsAfterIFNPulse(t, "legacy"); legacy < cells*9/10 {
+		t.Errorf("legacy: %d of %d cells became ANTIVIRAL, want nearly all", legacy, cells)
+	}
+	if dependent := antiviralCellsAfterIFNPulse(t, "ifnDependent"); dependent > cells/100 {
+		t.Errorf("ifnDependent: %d of %d cells became ANTIVIRAL, want almost none", dependent, cells)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/csv"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestMain runs the simulator's own main in the child processes of TestUpdatePathsRegression,
+// so every golden run starts from a fresh process like the recorded ones did
+func TestMain(m *testing.M) {
+	if os.Getenv("SIM_REGRESSION_CHILD") == "1" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// regressionColumns are the simulation_output.csv columns compared against testdata/regression
+var regressionColumns = []string{
+	"Time", "Percentage Infected Cells", "Percentage Dead Cells", "Percentage Susceptible Cells",
+	"Percentage Antiviral Cells", "Percentage Infected DIP-only Cells", "Percentage Infected Both Cells",
+	"Total Extracellular Virions", "Total Extracellular DIPs",
+}
+
+// regressionRuns cover both IFN update paths (local and global) with every particle spread
+// option, with and without DIPs, -ifnDecay=perCell and -continuousMode
+var regressionRuns = []struct {
+	name  string
+	flags string
+}{
+	{"local_virions", "-option=3 -v_pfu_initial=300"},
+	{"local_dips", "-option=3 -v_pfu_initial=300 -d_pfu_initial=3000"},
+	{"local_dips_percell", "-option=3 -v_pfu_initial=300 -d_pfu_initial=3000 -ifnDecay=perCell"},
+	{"local_dips_coinfection_alpha", "-option=3 -v_pfu_initial=300 -d_pfu_initial=3000 -dipIfnAlpha=500"},
+	{"local_jumprandomly", "-option=3 -v_pfu_initial=300 -d_pfu_initial=3000 -particleSpreadOption=jumprandomly"},
+	{"local_jumpradius", "-option=3 -v_pfu_initial=300 -d_pfu_initial=3000 -particleSpreadOption=jumpradius"},
+	{"local_partition", "-option=3 -v_pfu_initial=300 -d_pfu_initial=3000 -particleSpreadOption=partition"},
+	{"local_continuous", "-option=4 -continuousMode"},
+	{"global_virions", "-option=3 -v_pfu_initial=300 -ifnSpreadOption=global"},
+	{"global_dips", "-option=3 -v_pfu_initial=300 -d_pfu_initial=3000 -ifnSpreadOption=global"},
+	{"global_jumprandomly", "-option=3 -v_pfu_initial=300 -d_pfu_initial=3000 -ifnSpreadOption=global -particleSpreadOption=jumprandomly"},
+	{"global_partition", "-option=3 -v_pfu_initial=300 -d_pfu_initial=3000 -ifnSpreadOption=global -particleSpreadOption=partition"},
+	{"global_continuous", "-option=4 -continuousMode -ifnSpreadOption=global"},
+}
+
+// Function to run the simulator once in a child process with flags and return regressionColumns
+// of its simulation_output.csv as CSV text
+func regressionOutput(t *testing.T, flags string) string {
+	t.Helper()
+	dir := t.TempDir()
+	args := append([]string{"-render=false", "-randomSeed=11"}, strings.Fields(flags)...)
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "SIM_REGRESSION_CHILD=1")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("simulation failed: %v\n%s", err, out)
+	}
+	matches, _ := filepath.Glob(filepath.Join(dir, "*", "simulation_output.csv"))
+	if len(matches) != 1 {
+		t.Fatalf("found %d simulation_output.csv files", len(matches))
+	}
+	f, err := os.Open(matches[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := make(map[string]int, len(rows[0]))
+	for i, name := range rows[0] {
+		index[name] = i
+	}
+	var b strings.Builder
+	w := csv.NewWriter(&b)
+	w.Write(regressionColumns)
+	for _, row := range rows[1:] {
+		out := make([]string, len(regressionColumns))
+		for c, name := range regressionColumns {
+			i, ok := index[name]
+			if !ok {
+				t.Fatalf("simulation_output.csv has no %q column", name)
+			}
+			out[c] = row[i]
+		}
+		w.Write(out)
+	}
+	w.Flush()
+	return b.String()
+}
+
+// TestUpdatePathsRegression compares fixed-seed runs with the curves in testdata/regression. The
+// files were first recorded with the separate local and global IFN update paths, before they
+// were shared; a commit that changes the dynamics on purpose rewrites them with
+// UPDATE_REGRESSION=1 go test -run UpdatePathsRegression.
+func TestUpdatePathsRegression(t *testing.T) {
+	update := os.Getenv("UPDATE_REGRESSION") == "1"
+	for _, run := range regressionRuns {
+		t.Run(run.name, func(t *testing.T) {
+			got := regressionOutput(t, run.flags)
+			golden := filepath.Join("testdata", "regression", run.name+".csv")
+			if update {
+				if err := os.MkdirAll(filepath.Dir(golden), os.ModePerm); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(golden, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != string(want) {
+				gotLines, wantLines := strings.Split(got, "\n"), strings.Split(string(want), "\n")
+				for i := range wantLines {
+					if i >= len(gotLines) || gotLines[i] != wantLines[i] {
+						t.Fatalf("%s differs from %s at line %d:\n got  %s\n want %s", run.flags, golden, i+1, gotLines[min(i, len(gotLines)-1)], wantLines[i])
+					}
+				}
+				t.Fatalf("%s: %d lines, want %d", run.flags, len(gotLines), len(wantLines))
+			}
+		})
+	}
+}
@@ -0,0 +1,1177 @@
+//go:build !headless
+
+// Rendering for mdbk_small_vero_0818.go: grid frames, infection graph, MJPEG video and PNGs.
+// This is the only file that imports image/chart/video packages; build with -tags headless to
+// leave it out (see render_headless_0818.go).
+//
+// Build/run (both files are needed now):
+//
+//	go build -o sim mdbk_small_vero_0818.go render_0818.go
+//	go build -tags headless -o sim mdbk_small_vero_0818.go render_headless_0818.go
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/icza/mjpeg"
+	"github.com/wcharczuk/go-chart/v2" // Used for plotting the graph
+	"github.com/wcharczuk/go-chart/v2/drawing"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// videoRenderer is the FrameRenderer used by normal builds
+type videoRenderer struct {
+	videoWriter     mjpeg.AviWriter
+	buf             bytes.Buffer  // Buffer for JPEG encoding
+	jpegOptions     *jpeg.Options // JPEG encoding options
+	extractedImages []*image.RGBA // Store selected frame images
+	snapshotCanvas  *image.RGBA   // -snapshotScale drawing surface, allocated once and reused
+	animation       *gif.GIF      // -gifOutput frames, written to video.gif after the last frame
+	gifPalette      color.Palette // state colors first, then web-safe colors for the graph
+}
+
+func newFrameRenderer() FrameRenderer {
+	return &videoRenderer{jpegOptions: &jpeg.Options{Quality: 100}}
+}
+
+func (v *videoRenderer) Start(videoFilePath string) error {
+	overlayMask = buildOverlayMask(*flag_unexposedSetAreaFraction)
+	stateColors = buildStateColors(*flag_palette, paletteOverrides)
+
+	videoWriter, err := mjpeg.New(videoFilePath, int32(GRID_SIZE*CELL_SIZE*2), int32(GRID_SIZE*CELL_SIZE*2), int32(FRAME_RATE))
+	if err != nil {
+		return err
+	}
+	v.videoWriter = videoWriter
+
+	if *flag_gifOutput {
+		v.animation = &gif.GIF{}
+		v.gifPalette = buildGIFPalette()
+	}
+	return nil
+}
+
+// Function to build the GIF palette: the state, immune-cell and overlay colors exactly, so frames
+// quantized without dithering keep every state its own color, then the 216 web-safe colors for
+// the infection graph (at most 256 in total)
+func buildGIFPalette() color.Palette {
+	var p color.Palette
+	seen := make(map[color.RGBA]bool)
+	add := func(c color.Color) {
+		rgba := color.RGBAModel.Convert(c).(color.RGBA)
+		if !seen[rgba] && len(p) < 256 {
+			seen[rgba] = true
+			p = append(p, rgba)
+		}
+	}
+	add(color.RGBA{0, 0, 0, 255})
+	add(color.RGBA{255, 255, 255, 255})
+	for state := SUSCEPTIBLE; state <= UNEXPOSED; state++ {
+		if c, ok := stateColors[state]; ok {
+			add(c)
+		}
+	}
+	add(immuneCellColor)
+	for _, c := range palette.WebSafe {
+		add(c)
+	}
+	return p
+}
+
+// Function to append a frame to the -gifOutput animation, mapped to the GIF palette without dithering
+func (v *videoRenderer) addGIFFrame(img *image.RGBA) {
+	paletted := image.NewPaletted(img.Bounds(), v.gifPalette)
+	draw.Draw(paletted, paletted.Bounds(), img, img.Bounds().Min, draw.Src)
+	v.animation.Image = append(v.animation.Image, paletted)
+	v.animation.Delay = append(v.animation.Delay, *flag_gifDelay)
+	if w := img.Bounds().Dx(); w > v.animation.Config.Width {
+		v.animation.Config.Width = w
+	}
+	if h := img.Bounds().Dy(); h > v.animation.Config.Height {
+		v.animation.Config.Height = h
+	}
+}
+
+// Function to write the -gifOutput animation to outputFolder/video.gif
+func (v *videoRenderer) saveGIF(outputFolder string) error {
+	filename := filepath.Join(outputFolder, "video.gif")
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %v", filename, err)
+	}
+	defer file.Close()
+
+	v.animation.Config.ColorModel = v.gifPalette
+	if err := gif.EncodeAll(file, v.animation); err != nil {
+		return fmt.Errorf("failed to encode GIF %s: %v", filename, err)
+	}
+	fmt.Printf("Saved animation: %s\n", filename)
+	return nil
+}
+
+func (v *videoRenderer) SelectedFrame(g *Grid, timePoint int, outputFolder string) error {
+	// Create simulation result image
+	img := g.gridToImage(videotype)
+	v.extractedImages = append(v.extractedImages, img)
+
+	// Vector frame (-renderFormat=svg) instead of the PNG
+	if *flag_renderFormat == "svg" {
+		individualFrameName := fmt.Sprintf("simulation_%d_hours.svg", timePoint)
+		if err := g.svgFrame(videotype, timePoint, filepath.Base(outputFolder), filepath.Join(outputFolder, individualFrameName)); err != nil {
+			return err
+		}
+		fmt.Printf("Saved simulation result frame: %s\n", individualFrameName)
+		return nil
+	}
+
+	// High-quality render for the PNG only (-snapshotScale, -antialias, -cellBorders)
+	pngImg := img
+	if *flag_snapshotScale > 1 || *flag_cellBorders {
+		if v.snapshotCanvas == nil {
+			size := GRID_SIZE * CELL_SIZE * 2 * *flag_snapshotScale
+			v.snapshotCanvas = image.NewRGBA(image.Rect(0, 0, size, size))
+		}
+		pngImg = g.gridToImageAt(videotype, *flag_snapshotScale, *flag_antialias, *flag_cellBorders, v.snapshotCanvas)
+	}
+
+	// Save individual frame image as simulation result
+	individualFrameName := fmt.Sprintf("simulation_%d_hours.png", timePoint)
+	if err := savePNGImage(pngImg, filepath.Join(outputFolder, individualFrameName)); err != nil {
+		return err
+	}
+	fmt.Printf("Saved simulation result frame: %s\n", individualFrameName)
+	return nil
+}
+
+func (v *videoRenderer) Frame(g *Grid, frameNum int, virionOnly, dipOnly, both []float64, outputFolder string) error {
+	if frameNum > 1 {
+		if frameNum%24 == 0 { // Save every 10 frames
+
+			img, err := g.gridToImageWithGraph(frameNum, virionOnly, dipOnly, both, videotype, false)
+			if err != nil {
+				return err
+			}
+
+			v.extractedImages = append(v.extractedImages, img)
+		}
+	}
+
+	// Generate the graph only if there are at least two frames of data
+	var img *image.RGBA
+	if frameNum > 0 {
+		var err error
+		if img, err = g.gridToImageWithGraph(frameNum, virionOnly, dipOnly, both, videotype, true); err != nil {
+			return err
+		}
+	} else {
+		// For the first frame, only render the grid without the graph
+		img = g.gridToImage(videotype)
+		if *flag_overlay {
+			drawFrameOverlay(img, img.Bounds(), frameNum)
+		}
+	}
+
+	// Encode the image to JPEG format
+	if err := jpeg.Encode(&v.buf, img, v.jpegOptions); err != nil {
+		return fmt.Errorf("failed to encode image: %v", err)
+	}
+
+	// Add the frame to the video
+	if err := v.videoWriter.AddFrame(v.buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to add frame: %v", err)
+	}
+	v.buf.Reset() // Reset the buffer for the next frame
+
+	// Same frame into the GIF animation, written out after the last frame
+	if v.animation != nil {
+		v.addGIFFrame(img)
+		if frameNum == TIME_STEPS-1 {
+			if err := v.saveGIF(outputFolder); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(v.extractedImages) > 0 {
+		combinedImage := combineImagesHorizontally(v.extractedImages)
+
+		showLegend := false // ⬅️ Change here: control whether to add legend
+
+		if showLegend {
+			legendWidth := 180
+			legendHeight := 80
+			legendX := combinedImage.Bounds().Dx() - legendWidth - 20
+			legendY := 20
+
+			draw.Draw(combinedImage,
+				image.Rect(legendX-5, legendY-5, legendX+legendWidth+5, legendY+legendHeight+5),
+				&image.Uniform{color.RGBA{255, 255, 255, 200}},
+				image.Point{}, draw.Over)
+
+			addStaticLegend(combinedImage, legendX, legendY)
+		}
+
+		if err := savePNGImage(combinedImage, filepath.Join(outputFolder, "selected_frames_combined.png")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (v *videoRenderer) Close() {
+	if v.videoWriter != nil {
+		v.videoWriter.Close()
+		v.videoWriter = nil
+	}
+}
+
+// Function to generate ticks dynamically
+func generateTicks(xMax float64, interval float64) []chart.Tick {
+	var ticks []chart.Tick
+	for value := 0.0; value <= xMax; value += interval {
+		label := fmt.Sprintf("%.0f", value) // Format the label as an integer
+		ticks = append(ticks, chart.Tick{
+			Value: value,
+			Label: label,
+		})
+	}
+	return ticks
+}
+
+// Ensure the entire canvas is initialized with uniform background color
+func fillBackground(img *image.RGBA, bgColor color.Color) {
+	for y := 0; y < img.Bounds().Dy(); y++ {
+		for x := 0; x < img.Bounds().Dx(); x++ {
+			img.Set(x, y, bgColor)
+		}
+	}
+}
+
+// Combine images into one row
+func combineImagesHorizontally(images []*image.RGBA) *image.RGBA {
+	if len(images) == 0 {
+		return nil
+	}
+
+	// Calculate the width and height of the combined image
+	totalWidth := 0
+	maxHeight := 0
+	for _, img := range images {
+		totalWidth += img.Bounds().Dx() // accumulate width
+		if img.Bounds().Dy() > maxHeight {
+			maxHeight = img.Bounds().Dy() // calculate maximum height
+		}
+	}
+
+	// Create the combined image
+	combinedImg := image.NewRGBA(image.Rect(0, 0, totalWidth, maxHeight))
+	offsetX := 0
+	for _, img := range images {
+		rect := img.Bounds()
+		draw.Draw(combinedImg, image.Rect(offsetX, 0, offsetX+rect.Dx(), rect.Dy()), img, rect.Min, draw.Src)
+		offsetX += rect.Dx()
+	}
+
+	return combinedImg
+}
+
+// Save PNG image
+func savePNGImage(img *image.RGBA, filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %v", filename, err)
+	}
+	defer file.Close()
+
+	if err := png.Encode(file, img); err != nil {
+		return fmt.Errorf("failed to encode PNG %s: %v", filename, err)
+	}
+	return nil
+}
+
+func clampValues(data []float64, min, max float64) []float64 {
+	clamped := make([]float64, len(data))
+	for i, v := range data {
+		if v < min {
+			clamped[i] = min
+		} else if v > max {
+			clamped[i] = max
+		} else {
+			clamped[i] = v
+		}
+	}
+	return clamped
+}
+
+// Modified function definition
+func createInfectionGraph(frameNum int, virionOnly, dipOnly, both []float64, showLegend bool) (*image.RGBA, error) {
+	graphWidth := GRID_SIZE * CELL_SIZE * 2
+	graphHeight := 200
+
+	if frameNum < 1 {
+		return nil, fmt.Errorf("not enough data to render the graph: frameNum = %d", frameNum)
+	}
+
+	// yMax <= 0 means no plot profile matched: leave the axis to auto-scale
+	if yMax > 0 {
+		virionOnly = clampValues(virionOnly, 0.00, yMax)
+		dipOnly = clampValues(dipOnly, 0.00, yMax)
+		both = clampValues(both, 0.00, yMax)
+	}
+
+	// Dynamically set legend name
+	var series []chart.Series
+
+	series = []chart.Series{
+		chart.ContinuousSeries{
+			Name:    "Infected by Virion Only",
+			XValues: createTimeSeries(frameNum),
+			YValues: virionOnly,
+			Style:   chart.Style{StrokeColor: chart.ColorRed, StrokeWidth: 6.0},
+		},
+		chart.ContinuousSeries{
+			Name:    "Infected by DIP Only",
+			XValues: createTimeSeries(frameNum),
+			YValues: dipOnly,
+			Style:   chart.Style{StrokeColor: chart.ColorGreen, StrokeWidth: 6.0},
+		},
+		chart.ContinuousSeries{
+			Name:    "Infected by Both",
+			XValues: createTimeSeries(frameNum),
+			YValues: both,
+			Style:   chart.Style{StrokeColor: drawing.Color{R: 255, G: 165, B: 0, A: 255}, StrokeWidth: 8.0},
+		},
+	}
+
+	graph := chart.Chart{
+		Width:  459, // int(float64(GRID_SIZE*CELL_SIZE) * 1.51)
+		Height: 100,
+		XAxis: chart.XAxis{
+			Style: chart.Style{FontSize: 10.0},
+			ValueFormatter: func(v interface{}) string {
+				return fmt.Sprintf("%d", int(v.(float64)))
+			},
+			Ticks: generateTicks(xMax, ticksInterval),
+		},
+		YAxis: chart.YAxis{
+			Style: chart.Style{FontSize: 10.0},
+		},
+		Series: series,
+	}
+
+	buffer := bytes.NewBuffer([]byte{})
+	err := graph.Render(chart.PNG, buffer)
+	if err != nil {
+		log.Printf("Failed to render graph: %v", err)
+		// Return a simple colored rectangle instead of crashing
+		return image.NewRGBA(image.Rect(0, 0, 459, 100)), nil
+	}
+
+	graphImg, _, err := image.Decode(buffer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode graph image: %v", err)
+	}
+
+	rgbaImg := image.NewRGBA(image.Rect(0, 0, graphWidth, graphHeight))
+	draw.Draw(rgbaImg, rgbaImg.Bounds(), graphImg, image.Point{}, draw.Src)
+
+	return rgbaImg, nil
+}
+
+// Convert the grid state into an image
+func (g *Grid) gridToImage(videotype string) *image.RGBA {
+	return g.gridToImageAt(videotype, *flag_supersample, true, false, nil)
+}
+
+// Function to render the grid with the hexagons drawn at scale x resolution. With downsample the
+// result is box-filtered back to frame size, otherwise it is returned at scale x size. A canvas
+// of the scale x size is cleared and drawn on instead of allocating a new image.
+func (g *Grid) gridToImageAt(videotype string, scale int, downsample, borders bool, canvas *image.RGBA) *image.RGBA {
+	// Supersampling: draw at renderScale x resolution, downsample before returning
+	renderScale = scale
+	if renderScale < 1 {
+		renderScale = 1
+	}
+	scale = renderScale
+
+	imgWidth := GRID_SIZE * CELL_SIZE * 2 * scale  // Calculate the image width
+	imgHeight := GRID_SIZE * CELL_SIZE * 2 * scale // Calculate the image height
+	var img *image.RGBA
+	if canvas != nil && canvas.Bounds().Dx() == imgWidth && canvas.Bounds().Dy() == imgHeight {
+		img = canvas
+		draw.Draw(img, img.Bounds(), image.Transparent, image.Point{}, draw.Src)
+	} else {
+		img = image.NewRGBA(image.Rect(0, 0, imgWidth, imgHeight)) // Create a new image
+	}
+	cellColors, background, ok := g.cellColors(videotype)
+	if !ok {
+		fmt.Println("Error: Unknown videotype provided.")
+	} else {
+		if background {
+			fillBackground(img, color.RGBA{0, 0, 0, 255})
+		}
+		for i := 0; i < GRID_SIZE; i++ {
+			for j := 0; j < GRID_SIZE; j++ {
+				x, y := calculateHexCenter(i, j)         // Calculate the center of each hexagon
+				drawHexagon(img, x, y, cellColors[i][j]) // Draw the hexagon in the videotype's color
+			}
+		}
+		if videotype == "viralTiterLog" {
+			drawTiterColorbar(img, scale)
+		}
+		// Immune cells (-numImmuneCells) are drawn over the cell they are on: cyan
+		if videotype == "states" {
+			for _, agent := range g.immuneCells {
+				x, y := calculateHexCenter(agent.I, agent.J)
+				drawHexagon(img, x, y, immuneCellColor)
+			}
+		}
+	}
+
+	// Visualization-only overlay (-unexposedSetAreaFraction): selected cells drawn black in every videotype
+	if overlayMask != nil {
+		for i := 0; i < GRID_SIZE; i++ {
+			for j := 0; j < GRID_SIZE; j++ {
+				if overlayMask[i][j] {
+					x, y := calculateHexCenter(i, j)
+					drawHexagon(img, x, y, color.RGBA{0, 0, 0, 255})
+				}
+			}
+		}
+	}
+
+	if borders {
+		borderColor := color.RGBA{40, 40, 40, 255}
+		for i := 0; i < GRID_SIZE; i++ {
+			for j := 0; j < GRID_SIZE; j++ {
+				x, y := calculateHexCenter(i, j)
+				drawHexagonBorder(img, x, y, borderColor)
+			}
+		}
+	}
+
+	renderScale = 1
+	if scale > 1 && downsample {
+		img = downsampleBox(img, scale)
+		scale = 1
+	}
+
+	if *flag_drawRuler {
+		renderScale = scale
+		drawRuler(img)
+		renderScale = 1
+	}
+
+	return img // Return the image
+}
+
+func drawTextWithBackground(img *image.RGBA, x, y int, label string, textColor, borderColor, bgColor color.Color) {
+	face := basicfont.Face7x13
+	textWidth := len(label) * 7
+	textHeight := 13
+
+	// White background box
+	bgRect := image.Rect(x-4, y-4, x+textWidth+4, y+textHeight+4)
+	draw.Draw(img, bgRect, &image.Uniform{bgColor}, image.Point{}, draw.Src)
+
+	// Text starting point
+	point := fixed.Point26_6{
+		X: fixed.I(x),
+		Y: fixed.I(y + textHeight),
+	}
+	d := &font.Drawer{
+		Dst:  img,
+		Src:  image.NewUniform(textColor),
+		Face: face,
+		Dot:  point,
+	}
+	d.DrawString(label)
+}
+
+// addLabel draws a text label onto an image at the specified position.
+func addLabel(img *image.RGBA, x, y int, label string, col color.Color) {
+	point := fixed.Point26_6{
+		X: fixed.I(x),
+		Y: fixed.I(y),
+	}
+	d := &font.Drawer{
+		Dst:  img,
+		Src:  image.NewUniform(col),
+		Face: basicfont.Face7x13, // Basic font for rendering
+		Dot:  point,
+	}
+	d.DrawString(label)
+}
+
+// Function to draw a measurement ruler: ticks every 10 cells along the top (i) and left (j)
+// edges and a 10-cell scale bar in the bottom-right corner. One cell is the center-to-center
+// distance, CELL_SIZE*sqrt(3) pixels; with -cellMicrons the labels are also given in µm.
+func drawRuler(img *image.RGBA) {
+	const tickEvery = 10
+	rulerColor := color.RGBA{255, 255, 255, 255}
+	bounds := img.Bounds()
+	cellPixels := float64(CELL_SIZE*renderScale) * math.Sqrt(3)
+
+	fillRect := func(x0, y0, x1, y1 int) {
+		draw.Draw(img, image.Rect(x0, y0, x1, y1).Intersect(bounds), &image.Uniform{rulerColor}, image.Point{}, draw.Src)
+	}
+
+	// Top edge: column index i (x = 1.5*CELL_SIZE per column)
+	for i := 0; i < GRID_SIZE; i += tickEvery {
+		x, _ := calculateHexCenter(i, 0)
+		fillRect(x, 0, x+1, 6)
+		addLabel(img, x+2, 16, strconv.Itoa(i), rulerColor)
+	}
+	// Left edge: row index j
+	for j := tickEvery; j < GRID_SIZE; j += tickEvery {
+		_, y := calculateHexCenter(0, j)
+		fillRect(0, y, 6, y+1)
+		addLabel(img, 8, y+4, strconv.Itoa(j), rulerColor)
+	}
+
+	// Scale bar of known length (10 cells) in the bottom-right corner
+	barLength := int(math.Round(tickEvery * cellPixels))
+	x1 := bounds.Max.X - 10
+	x0 := x1 - barLength
+	y := bounds.Max.Y - 12
+	fillRect(x0, y, x1, y+3)
+	fillRect(x0, y-4, x0+1, y+7)
+	fillRect(x1-1, y-4, x1, y+7)
+	label := fmt.Sprintf("%d cells", tickEvery)
+	if *flag_cellMicrons > 0 {
+		micronsPerCell := *flag_cellMicrons
+		label = fmt.Sprintf("%d cells = %g um", tickEvery, float64(tickEvery)*micronsPerCell)
+	}
+	addLabel(img, x0, y-6, label, rulerColor)
+}
+
+// Function to draw the -overlay annotations inside the grid area of a frame: "t = N h" in the
+// top-right corner and, in the bottom-left corner, a scale bar snapped to a round length (µm
+// with -cellMicrons, cells otherwise). Text and bar are black or white, whichever contrasts with
+// the cells underneath.
+func drawFrameOverlay(img *image.RGBA, area image.Rectangle, frameNum int) {
+	const margin = 8
+	label := fmt.Sprintf("t = %d h", frameNum*TIMESTEP)
+	labelWidth := len(label) * 7
+	x, y := area.Max.X-labelWidth-margin, area.Min.Y+margin
+	textColor, bgColor := overlayColors(img, image.Rect(x-4, y-4, x+labelWidth+4, y+17))
+	drawTextWithBackground(img, x, y, label, textColor, textColor, bgColor)
+
+	// Longest 1/2/5 x 10^k length (µm, or cells without -cellMicrons) no wider than a quarter of the grid
+	cellPixels := float64(CELL_SIZE) * math.Sqrt(3)
+	unitPixels, unit := cellPixels, "cells"
+	if *flag_cellMicrons > 0 {
+		unitPixels, unit = cellPixels / *flag_cellMicrons, "um"
+	}
+	maxLength := float64(area.Dx()) / 4 / unitPixels
+	length := math.Pow(10, math.Floor(math.Log10(maxLength)))
+	for _, step := range []float64{5, 2} {
+		if length*step <= maxLength {
+			length *= step
+			break
+		}
+	}
+	barPixels := int(math.Round(length * unitPixels))
+	barLabel := fmt.Sprintf("%g %s", length, unit)
+	boxWidth := barPixels
+	if w := len(barLabel) * 7; w > boxWidth {
+		boxWidth = w
+	}
+	x0, y0 := area.Min.X+margin, area.Max.Y-margin-4
+	box := image.Rect(x0-4, y0-21, x0+boxWidth+4, y0+8)
+	barColor, barBg := overlayColors(img, box)
+	draw.Draw(img, box, &image.Uniform{barBg}, image.Point{}, draw.Src)
+	drawTextWithBackground(img, x0, y0-17, barLabel, barColor, barColor, barBg)
+	draw.Draw(img, image.Rect(x0, y0, x0+barPixels, y0+4), &image.Uniform{barColor}, image.Point{}, draw.Src)
+}
+
+// Function to pick the overlay text color (and box color) for a region of img: black on white over
+// light cells, white on black over dark ones
+func overlayColors(img *image.RGBA, region image.Rectangle) (text, background color.Color) {
+	region = region.Intersect(img.Bounds())
+	var sum float64
+	n := 0
+	for y := region.Min.Y; y < region.Max.Y; y++ {
+		for x := region.Min.X; x < region.Max.X; x++ {
+			c := img.RGBAAt(x, y)
+			sum += 0.299*float64(c.R) + 0.587*float64(c.G) + 0.114*float64(c.B)
+			n++
+		}
+	}
+	if n > 0 && sum/float64(n) > 128 {
+		return color.RGBA{0, 0, 0, 255}, color.RGBA{255, 255, 255, 255}
+	}
+	return color.RGBA{255, 255, 255, 255}, color.RGBA{0, 0, 0, 255}
+}
+
+func addStaticLegend(img *image.RGBA, startX, startY int) {
+	// Keep original colors and label definitions unchanged
+	legendItems := []string{
+		"By both", "By DIP", "By Virion",
+		"Antiviral", "Uninfected", "Plaque", "Regrowth",
+	}
+	if *flag_numImmuneCells > 0 {
+		legendItems = append(legendItems, "Immune cell")
+	}
+	legendColors := map[string]color.Color{
+		"By both":     color.RGBA{255, 200, 0, 255},
+		"By DIP":      color.RGBA{0, 255, 0, 255},
+		"By Virion":   color.RGBA{255, 0, 0, 255},
+		"Antiviral":   color.RGBA{0, 102, 255, 255},
+		"Uninfected":  color.RGBA{0, 0, 0, 255},
+		"Plaque":      color.RGBA{84, 110, 122, 255},
+		"Regrowth":    color.RGBA{128, 0, 128, 255},
+		"Immune cell": color.RGBA{0, 255, 255, 255},
+	}
+	// Other palettes (and -paletteFile entries) color the legend like the cells
+	for label, state := range legendStates {
+		if _, overridden := paletteOverrides[state]; overridden || *flag_palette != "default" {
+			legendColors[label] = stateColors[state]
+		}
+	}
+
+	// Calculate background box size (keep original logic)
+	const (
+		fontWidth   = 7
+		lineSpacing = 17
+		padding     = 4
+	)
+
+	maxLabelLen := 0
+	for _, label := range legendItems {
+		if len(label) > maxLabelLen {
+			maxLabelLen = len(label)
+		}
+	}
+
+	bgWidth := maxLabelLen*fontWidth + 10
+	bgHeight := len(legendItems)*lineSpacing + 6
+
+	// Draw background (keep white opaque)
+	bgRect := image.Rect(
+		startX-padding,
+		startY-padding,
+		startX+bgWidth,
+		startY+bgHeight,
+	)
+	draw.Draw(img, bgRect, &image.Uniform{color.RGBA{255, 255, 255, 255}}, image.Point{}, draw.Src)
+
+	// Draw legend items (keep original drawing logic)
+	for i, label := range legendItems {
+		yPos := startY + i*lineSpacing
+		drawTextWithBackground(
+			img,
+			startX,
+			yPos,
+			label,
+			legendColors[label],
+			legendColors[label],
+			color.RGBA{255, 255, 255, 255},
+		)
+	}
+}
+
+func (g *Grid) gridToImageWithGraph(frameNum int, virionOnly, dipOnly, both []float64, mode string, showLegend bool) (*image.RGBA, error) {
+	const graphHeight = 100
+	const spacing = 0
+
+	gridImg := g.gridToImage(videotype)
+	gridHeight := gridImg.Bounds().Dy()
+
+	imgWidth := GRID_SIZE * CELL_SIZE * 2
+	imgHeight := graphHeight + gridHeight + spacing
+	canvas := image.NewRGBA(image.Rect(0, 0, imgWidth, imgHeight))
+
+	graphImg, err := createInfectionGraph(frameNum, virionOnly, dipOnly, both, showLegend)
+	if err != nil {
+		return nil, err
+	}
+	draw.Draw(canvas, image.Rect(0, 0, imgWidth, graphHeight), graphImg, image.Point{}, draw.Src)
+	draw.Draw(canvas, image.Rect(0, graphHeight+spacing, imgWidth, graphHeight+gridHeight+spacing), gridImg, image.Point{}, draw.Src)
+
+	if *flag_overlay {
+		drawFrameOverlay(canvas, image.Rect(0, graphHeight+spacing, imgWidth, graphHeight+gridHeight+spacing), frameNum)
+	}
+
+	if showLegend {
+		addStaticLegend(canvas, canvas.Bounds().Dx()-183, canvas.Bounds().Dy()-183)
+	}
+
+	return canvas, nil
+}
+
+// Pixel scale of the hexagon geometry; gridToImage raises it while drawing a supersampled frame
+var renderScale = 1
+
+// Cells drawn black by the visual-only overlay (nil = off); built once per run in Start
+var overlayMask [][]bool
+
+// Function to pick round(fraction*N²) overlay cells uniformly without replacement. It uses its own
+// RNG seeded from the run seed, so the overlay is the same in every frame and never consumes
+// simulation random numbers (results do not depend on the overlay or the videotype).
+func buildOverlayMask(fraction float64) [][]bool {
+	total := GRID_SIZE * GRID_SIZE
+	target := int(math.Round(fraction * float64(total)))
+	if target <= 0 {
+		return nil
+	}
+	if target > total {
+		target = total
+	}
+
+	seed := randomSeed
+	if seed < 0 {
+		seed = time.Now().UnixNano()
+	}
+	rng := rand.New(rand.NewSource(seed ^ 0x6f7665726c6179)) // render substream ("overlay")
+	indices := rng.Perm(total)
+
+	mask := make([][]bool, GRID_SIZE)
+	for i := range mask {
+		mask[i] = make([]bool, GRID_SIZE)
+	}
+	for _, idx := range indices[:target] {
+		mask[idx/GRID_SIZE][idx%GRID_SIZE] = true
+	}
+	return mask
+}
+
+// Colors of the cell states in the "states", "particles" and "baltes" videotypes and the legend,
+// set from -palette and -paletteFile in Start
+var stateColors = defaultStateColors
+
+// State whose color each addStaticLegend entry shows under a non-default palette
+var legendStates = map[string]int{
+	"By both":    INFECTED_BOTH,
+	"By DIP":     INFECTED_DIP,
+	"By Virion":  INFECTED_VIRION,
+	"Antiviral":  ANTIVIRAL,
+	"Uninfected": SUSCEPTIBLE,
+	"Plaque":     DEAD,
+	"Regrowth":   REGROWTH,
+}
+
+// Function to build the state colors of palette with the -paletteFile overrides applied on top.
+// Continuous states take the color of their burst-mode state unless overridden themselves.
+func buildStateColors(palette string, overrides map[int][3]uint8) map[int]color.Color {
+	colors := make(map[int]color.Color, len(defaultStateColors))
+	for state, c := range defaultStateColors {
+		colors[state] = c
+	}
+	if base, ok := paletteColors[palette]; ok {
+		for state, c := range base {
+			colors[state] = c
+		}
+		for state := range stateNames {
+			if isProducingState(state) {
+				colors[state] = base[burstState(state)]
+			}
+		}
+	}
+	for state, rgb := range overrides {
+		colors[state] = color.RGBA{rgb[0], rgb[1], rgb[2], 255}
+	}
+	return colors
+}
+
+// Colorblind-safe alternatives to defaultStateColors (burst-mode states; see buildStateColors)
+var paletteColors = map[string]map[int]color.Color{
+	// The cividis colormap at sixths above black (SUSCEPTIBLE), so neighboring shades are as far
+	// apart as six states allow: virion bright yellow, DIP dark blue, both in between. States
+	// that meet in plaques (DIP-only and antiviral at the front, dead and regrowth in the core)
+	// sit two steps apart.
+	"cividis": {
+		SUSCEPTIBLE:     color.RGBA{0, 0, 0, 255},
+		INFECTED_VIRION: color.RGBA{254, 232, 56, 255},  // cividis 6/6
+		INFECTED_BOTH:   color.RGBA{212, 194, 100, 255}, // cividis 5/6
+		REGROWTH:        color.RGBA{166, 157, 117, 255}, // cividis 4/6
+		ANTIVIRAL:       color.RGBA{125, 124, 118, 255}, // cividis 3/6
+		DEAD:            color.RGBA{87, 93, 109, 255},   // cividis 2/6
+		INFECTED_DIP:    color.RGBA{39, 63, 110, 255},   // cividis 1/6
+		UNEXPOSED:       color.RGBA{0, 0, 0, 255},
+	},
+	// Okabe-Ito qualitative palette
+	"okabe-ito": {
+		SUSCEPTIBLE:     color.RGBA{0, 0, 0, 255},
+		INFECTED_VIRION: color.RGBA{213, 94, 0, 255},    // vermillion
+		INFECTED_DIP:    color.RGBA{0, 158, 115, 255},   // bluish green
+		INFECTED_BOTH:   color.RGBA{240, 228, 66, 255},  // yellow
+		DEAD:            color.RGBA{153, 153, 153, 255}, // gray
+		ANTIVIRAL:       color.RGBA{0, 114, 178, 255},   // blue
+		REGROWTH:        color.RGBA{204, 121, 167, 255}, // reddish purple
+		UNEXPOSED:       color.RGBA{0, 0, 0, 255},
+	},
+}
+
+// Colors of the cell states under -palette=default
+var defaultStateColors = map[int]color.Color{
+	SUSCEPTIBLE:     color.RGBA{0, 0, 0, 255},       // Susceptible state: black
+	INFECTED_VIRION: color.RGBA{255, 0, 0, 255},     // Infected by virion: red
+	INFECTED_DIP:    color.RGBA{0, 255, 0, 255},     // Infected by DIP: green
+	INFECTED_BOTH:   color.RGBA{255, 255, 0, 255},   // Infected by both: yellow
+	DEAD:            color.RGBA{169, 169, 169, 255}, // Dead state: gray
+	ANTIVIRAL:       color.RGBA{0, 0, 255, 255},     // Antiviral state: blue
+	REGROWTH:        color.RGBA{128, 0, 128, 255},   // Regrowth state: purple
+	UNEXPOSED:       color.RGBA{0, 0, 0, 255},       // UNEXPOSED: black (same as susceptible but frozen)
+	// Continuous mode states (use same colors as burst mode for now)
+	INFECTED_VIRION_CONTINUOUS: color.RGBA{255, 0, 0, 255},   // Infected by virion continuous: red
+	INFECTED_DIP_CONTINUOUS:    color.RGBA{0, 255, 0, 255},   // Infected by DIP continuous: green
+	INFECTED_BOTH_CONTINUOUS:   color.RGBA{255, 255, 0, 255}, // Infected by both continuous: yellow
+}
+
+// Anchor colors of the viridis colormap at 0, 0.25, 0.5, 0.75 and 1
+var viridisAnchors = [5][3]float64{
+	{68, 1, 84},
+	{59, 82, 139},
+	{33, 145, 140},
+	{94, 201, 98},
+	{253, 231, 37},
+}
+
+// Function to map frac (clamped to [0,1]) to viridis, interpolating linearly between the anchors
+func viridis(frac float64) color.Color {
+	frac = math.Max(0, math.Min(1, frac))
+	pos := frac * float64(len(viridisAnchors)-1)
+	k := int(math.Min(pos, float64(len(viridisAnchors)-2)))
+	t := pos - float64(k)
+	var rgb [3]uint8
+	for c := 0; c < 3; c++ {
+		rgb[c] = uint8(math.Round(viridisAnchors[k][c]*(1-t) + viridisAnchors[k+1][c]*t))
+	}
+	return color.RGBA{rgb[0], rgb[1], rgb[2], 255}
+}
+
+// Function to draw the "viralTiterLog" colorbar in the bottom-left corner of a frame drawn at
+// scale x resolution: the viridis ramp from 1 virion to 10^titerColorMax, labelled at both ends
+func drawTiterColorbar(img *image.RGBA, scale int) {
+	const barWidth, barHeight, margin = 100, 8, 10
+	white := color.RGBA{255, 255, 255, 255}
+	x0 := margin * scale
+	y0 := img.Bounds().Max.Y - (margin+barHeight+20)*scale
+	for x := 0; x < barWidth*scale; x++ {
+		c := viridis(float64(x) / float64(barWidth*scale-1))
+		draw.Draw(img, image.Rect(x0+x, y0, x0+x+1, y0+barHeight*scale), &image.Uniform{c}, image.Point{}, draw.Src)
+	}
+	black := color.RGBA{0, 0, 0, 255}
+	labelY := y0 + barHeight*scale + 4
+	drawTextWithBackground(img, x0, labelY, "1", white, white, black)
+	maxLabel := fmt.Sprintf("1e%g", *flag_titerColorMax)
+	drawTextWithBackground(img, x0+barWidth*scale-len(maxLabel)*7, labelY, maxLabel, white, white, black)
+	addLabel(img, x0, y0-4, "virions/cell", white)
+}
+
+// Colors of infection generations 0, 1, 2, ... in the "generations" videotype (Okabe-Ito, repeating)
+var generationColors = []color.Color{
+	color.RGBA{230, 159, 0, 255},   // orange
+	color.RGBA{86, 180, 233, 255},  // sky blue
+	color.RGBA{0, 158, 115, 255},   // bluish green
+	color.RGBA{240, 228, 66, 255},  // yellow
+	color.RGBA{0, 114, 178, 255},   // blue
+	color.RGBA{213, 94, 0, 255},    // vermillion
+	color.RGBA{204, 121, 167, 255}, // reddish purple
+}
+
+// Color of the cells an immune cell is on ("states" videotype)
+var immuneCellColor = color.RGBA{0, 255, 255, 255}
+
+// Function to compute the color of every cell for videotype, shared by the raster and SVG
+// renderers. background reports whether the videotype fills the canvas black first; ok is
+// false for an unknown videotype.
+func (g *Grid) cellColors(videotype string) (colors [GRID_SIZE][GRID_SIZE]color.Color, background, ok bool) {
+	black := color.RGBA{0, 0, 0, 255} // Default color for all other cells
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			var cellColor color.Color
+			switch videotype {
+			case "states":
+				cellColor = stateColors[g.state[i][j]]
+			case "IFNconcentration": // IFN concentration visualization
+				ifnValue := g.IFNConcentration[i][j]
+				if ifnValue <= 0 {
+					cellColor = black // IFN ≤ 0, black
+				} else if ifnValue > 0 && ifnValue <= 1 {
+					cellColor = color.RGBA{0, 0, 255, 255} // Blue
+				} else if ifnValue > 1 && ifnValue <= 2 {
+					cellColor = color.RGBA{0, 255, 0, 255} // Green
+				} else if ifnValue > 2 && ifnValue <= 5 {
+					cellColor = color.RGBA{255, 255, 0, 255} // Yellow
+				} else if ifnValue > 5 && ifnValue <= 10 {
+					cellColor = color.RGBA{255, 165, 0, 255} // Orange
+				} else {
+					cellColor = color.RGBA{255, 0, 0, 255} // Red
+				}
+			case "IFNonlyLargerThanZero": // Antiviral timer visualization
+				if g.timeSinceAntiviral[i][j] > g.antiviralDuration[i][j] {
+					cellColor = color.RGBA{0, 0, 255, 255} // blue for cells in antiviral state exceeding duration
+				} else if g.timeSinceAntiviral[i][j] > 110 {
+					cellColor = color.RGBA{255, 0, 0, 255} // red
+				} else if g.timeSinceAntiviral[i][j] > 90 {
+					cellColor = color.RGBA{255, 165, 0, 255} // orange
+				} else if g.timeSinceAntiviral[i][j] > 70 {
+					cellColor = color.RGBA{0, 255, 0, 255} // green
+				} else if g.timeSinceAntiviral[i][j] > 50 {
+					cellColor = color.RGBA{255, 255, 0, 255} // yellow
+				} else {
+					cellColor = black
+				}
+			case "antiviralState":
+				if g.timeSinceAntiviral[i][j] > g.antiviralDuration[i][j] {
+					cellColor = color.RGBA{0, 0, 255, 255} // blue for cells in antiviral state exceeding duration
+				} else {
+					cellColor = black
+				}
+			case "particles":
+				// Determine color based on particle presence
+				hasVirion := g.localVirions[i][j] > 0
+				hasDIP := g.localDips[i][j] > 0
+				switch {
+				case hasVirion && hasDIP:
+					cellColor = stateColors[INFECTED_BOTH] // Both present (default yellow)
+				case hasVirion:
+					cellColor = stateColors[INFECTED_VIRION] // Virion only (default red)
+				case hasDIP:
+					cellColor = stateColors[INFECTED_DIP] // DIP only (default green)
+				default:
+					cellColor = black // Black (no particles)
+				}
+			case "baltes":
+				// Dead cells keep the color of the state they lysed from
+				var exists bool
+				if g.state[i][j] == DEAD {
+					if cellColor, exists = stateColors[g.previousStates[i][j]]; !exists {
+						cellColor = color.RGBA{169, 169, 169, 255}
+					}
+				} else if cellColor, exists = stateColors[g.state[i][j]]; !exists {
+					cellColor = black
+				}
+			case "viralTiterLog":
+				// log10(virions) on viridis, 1 virion at the bottom and saturating at -titerColorMax,
+				// so the colorbar's "1" and "1e<max>" labels are the true ends; no virions: black
+				if n := g.localVirions[i][j]; n <= 0 {
+					cellColor = black
+				} else {
+					cellColor = viridis(math.Log10(float64(n)) / *flag_titerColorMax)
+				}
+			case "susceptibility":
+				// Per-cell RHO multiplier on viridis: 0 dark, 1 (the mean, RHO) mid, >= 2 yellow
+				cellColor = viridis(g.cellSusceptibility[i][j] / 2)
+			case "generations":
+				// Generation of the cell's latest infection (-lineage rule), cycling through the
+				// palette; never-infected cells black
+				if gen := g.generation[i][j]; gen < 0 {
+					cellColor = black
+				} else {
+					cellColor = generationColors[gen%len(generationColors)]
+				}
+			case "isochrone":
+				// Wavefront arrival time heatmap: blue (early) -> red (late), black if never infected
+				t := g.firstInfectionTime[i][j]
+				if t < 0 {
+					cellColor = black // Never infected: black
+				} else {
+					frac := float64(t) / float64(TIME_STEPS)
+					if frac > 1 {
+						frac = 1
+					}
+					cellColor = color.RGBA{uint8(255 * frac), 0, uint8(255 * (1 - frac)), 255}
+				}
+			default:
+				return colors, false, false
+			}
+			colors[i][j] = cellColor
+		}
+	}
+	background = videotype != "IFNconcentration" && videotype != "IFNonlyLargerThanZero" && videotype != "antiviralState"
+	return colors, background, true
+}
+
+// Function to write the grid as an SVG file, one <polygon> per cell in the same colors and
+// layout as the raster frames, followed by the immune cells and the -unexposedSetAreaFraction
+// overlay. The <title> names the frame and the run.
+func (g *Grid) svgFrame(videotype string, timePoint int, title, filename string) error {
+	cellColors, background, ok := g.cellColors(videotype)
+	if !ok {
+		return fmt.Errorf("unknown videotype %q", videotype)
+	}
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %v", filename, err)
+	}
+	defer file.Close()
+	w := bufio.NewWriter(file)
+
+	size := GRID_SIZE * CELL_SIZE * 2
+	fmt.Fprintf(w, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" viewBox=\"0 0 %d %d\">\n", size, size, size, size)
+	fmt.Fprintf(w, "<title>%s</title>\n", html.EscapeString(fmt.Sprintf("Frame %d h: %s", timePoint, title)))
+	if background {
+		fmt.Fprintf(w, "<rect width=\"%d\" height=\"%d\" fill=\"#000000\"/>\n", size, size)
+	}
+	stroke := ""
+	if *flag_cellBorders {
+		stroke = ` stroke="#282828" stroke-width="0.5"`
+	}
+	// Centers come from calculateHexCenter at svgPrecision x scale, so the integer rounding that
+	// the raster frames need does not open hairline gaps between the vector rows
+	const svgPrecision = 100
+	polygon := func(i, j int, c color.Color) {
+		renderScale = svgPrecision
+		xi, yi := calculateHexCenter(i, j)
+		renderScale = 1
+		x, y := float64(xi)/svgPrecision, float64(yi)/svgPrecision
+		r, gr, b, _ := c.RGBA()
+		fmt.Fprintf(w, "<polygon points=\"")
+		for k := 0; k < 6; k++ {
+			angle := math.Pi / 3 * float64(k)
+			if k > 0 {
+				fmt.Fprint(w, " ")
+			}
+			fmt.Fprintf(w, "%.2f,%.2f", x+float64(CELL_SIZE)*math.Cos(angle), y+float64(CELL_SIZE)*math.Sin(angle))
+		}
+		fmt.Fprintf(w, "\" fill=\"#%02x%02x%02x\"%s/>\n", r>>8, gr>>8, b>>8, stroke)
+	}
+
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			polygon(i, j, cellColors[i][j])
+		}
+	}
+	if videotype == "states" {
+		for _, agent := range g.immuneCells {
+			polygon(agent.I, agent.J, immuneCellColor)
+		}
+	}
+	if overlayMask != nil {
+		for i := 0; i < GRID_SIZE; i++ {
+			for j := 0; j < GRID_SIZE; j++ {
+				if overlayMask[i][j] {
+					polygon(i, j, color.RGBA{0, 0, 0, 255})
+				}
+			}
+		}
+	}
+	fmt.Fprintln(w, "</svg>")
+
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to write SVG %s: %v", filename, err)
+	}
+	return nil
+}
+
+// Calculate the center of each hexagonal cell
+func calculateHexCenter(i, j int) (int, int) {
+	cellSize := CELL_SIZE * renderScale
+	x := i * cellSize * 3 / 2                                                                           // Calculate the x-coordinate
+	y := int(float64(j)*float64(cellSize)*math.Sqrt(3) + float64(i%2)*float64(cellSize)*math.Sqrt(3)/2) // Calculate the y-coordinate
+	return x, y                                                                                         // Return the center coordinates
+}
+
+func drawHexagon(img *image.RGBA, x, y int, c color.Color) {
+	cellSize := float64(CELL_SIZE * renderScale)
+	var hex [6]image.Point
+	for i := 0; i < 6; i++ {
+		angle := math.Pi / 3 * float64(i) // Calculate the angle for each vertex of the hexagon
+		hex[i] = image.Point{
+			X: x + int(cellSize*math.Cos(angle)), // Calculate x-coordinate
+			Y: y + int(cellSize*math.Sin(angle)), // Calculate y-coordinate
+		}
+	}
+	fillHexagon(img, hex, c) // Fill the hexagon with the specified color
+}
+
+// Function to outline a hexagon with edges renderScale pixels wide (about 1 pixel after downsampling)
+func drawHexagonBorder(img *image.RGBA, x, y int, c color.Color) {
+	cellSize := float64(CELL_SIZE * renderScale)
+	width := renderScale
+	src := &image.Uniform{c}
+	for i := 0; i < 6; i++ {
+		a0, a1 := math.Pi/3*float64(i), math.Pi/3*float64(i+1)
+		x0, y0 := float64(x)+cellSize*math.Cos(a0), float64(y)+cellSize*math.Sin(a0)
+		x1, y1 := float64(x)+cellSize*math.Cos(a1), float64(y)+cellSize*math.Sin(a1)
+		steps := int(math.Ceil(math.Max(math.Abs(x1-x0), math.Abs(y1-y0))))
+		for s := 0; s <= steps; s++ {
+			t := float64(s) / math.Max(float64(steps), 1)
+			px := int(math.Round(x0+(x1-x0)*t)) - width/2
+			py := int(math.Round(y0+(y1-y0)*t)) - width/2
+			draw.Draw(img, image.Rect(px, py, px+width, py+width), src, image.Point{}, draw.Src)
+		}
+	}
+}
+
+// Function to shrink an image by an integer factor, averaging each factor x factor block
+func downsampleBox(src *image.RGBA, factor int) *image.RGBA {
+	bounds := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, bounds.Dx()/factor, bounds.Dy()/factor))
+	n := uint32(factor * factor)
+	for y := 0; y < dst.Bounds().Dy(); y++ {
+		for x := 0; x < dst.Bounds().Dx(); x++ {
+			var sr, sg, sb, sa uint32
+			for dy := 0; dy < factor; dy++ {
+				offset := src.PixOffset(bounds.Min.X+x*factor, bounds.Min.Y+y*factor+dy)
+				for dx := 0; dx < factor; dx++ {
+					p := src.Pix[offset+4*dx : offset+4*dx+4]
+					sr += uint32(p[0])
+					sg += uint32(p[1])
+					sb += uint32(p[2])
+					sa += uint32(p[3])
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{uint8(sr / n), uint8(sg / n), uint8(sb / n), uint8(sa / n)})
+		}
+	}
+	return dst
+}
+
+func fillHexagon(img *image.RGBA, hex [6]image.Point, c color.Color) {
+	minX, minY, maxX, maxY := hex[0].X, hex[0].Y, hex[0].X, hex[0].Y // Initialize boundary values
+	for _, p := range hex {
+		if p.X < minX {
+			minX = p.X // Update minimum x-coordinate
+		}
+		if p.Y < minY {
+			minY = p.Y // Update minimum y-coordinate
+		}
+		if p.X > maxX {
+			maxX = p.X // Update maximum x-coordinate
+		}
+		if p.Y > maxY {
+			maxY = p.Y // Update maximum y-coordinate
+		}
+	}
+	for x := minX; x <= maxX; x++ { // Iterate through x-coordinates
+		for y := minY; y <= maxY; y++ { // Iterate through y-coordinates
+			if isPointInHexagon(image.Point{x, y}, hex) { // Check if the point is inside the hexagon
+				img.Set(x, y, c) // Set the color of the point
+			}
+		}
+	}
+}
+
+func isPointInHexagon(p image.Point, hex [6]image.Point) bool {
+	for i := 0; i < 6; i++ {
+		j := (i + 1) % 6
+		if (hex[j].X-hex[i].X)*(p.Y-hex[i].Y)-(hex[j].Y-hex[i].Y)*(p.X-hex[i].X) < 0 {
+			return false // Return false if the point is outside the hexagon
+		}
+	}
+	return true // Return true if the point is inside the hexagon
+}
@@ -0,0 +1,237 @@
+//go:build !headless
+
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Function to set up a grid showing every state in a fixed pattern, with particles on the cells
+func newRenderGrid(t *testing.T) *Grid {
+	t.Helper()
+	g := newTestGrid(t, Config{})
+	states := []int{SUSCEPTIBLE, INFECTED_VIRION, INFECTED_DIP, INFECTED_BOTH, DEAD, ANTIVIRAL, REGROWTH,
+		INFECTED_VIRION_CONTINUOUS, INFECTED_DIP_CONTINUOUS, INFECTED_BOTH_CONTINUOUS}
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			g.state[i][j] = states[(i/4+3*(j/4))%len(states)]
+			g.localVirions[i][j], g.localDips[i][j] = (i*j)%50, (i+j)%30
+		}
+	}
+	return g
+}
+
+// Function to read a PNG into an RGBA image
+func readPNG(t *testing.T, path string) *image.RGBA {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	decoded, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := image.NewRGBA(decoded.Bounds())
+	draw.Draw(img, img.Bounds(), decoded, decoded.Bounds().Min, draw.Src)
+	return img
+}
+
+// TestGridImageGoldens compares rendered frames with the PNGs in testdata/render, pixel by pixel.
+// The frames leave out the ruler, whose text depends on the font package. A commit that changes
+// the rendering on purpose rewrites them with UPDATE_RENDER=1 go test -run GridImageGoldens.
+func TestGridImageGoldens(t *testing.T) {
+	update := os.Getenv("UPDATE_RENDER") == "1"
+	cases := []struct {
+		name       string
+		videotype  string
+		scale      int
+		downsample bool
+		borders    bool
+	}{
+		{"states", "states", 1, true, false},
+		{"states_x4_antialias_borders", "states", 4, true, true},
+		{"states_x2", "states", 2, false, false},
+		{"particles", "particles", 1, true, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			g := newRenderGrid(t)
+			img := g.gridToImageAt(c.videotype, c.scale, c.downsample, c.borders, nil)
+			size := GRID_SIZE * CELL_SIZE * 2
+			if !c.downsample {
+				size *= c.scale
+			}
+			if img.Bounds() != image.Rect(0, 0, size, size) {
+				t.Fatalf("frame bounds %v, want %dx%d", img.Bounds(), size, size)
+			}
+			golden := filepath.Join("testdata", "render", c.name+".png")
+			if update {
+				if err := os.MkdirAll(filepath.Dir(golden), os.ModePerm); err != nil {
+					t.Fatal(err)
+				}
+				if err := savePNGImage(img, golden); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want := readPNG(t, golden)
+			if want.Bounds() != img.Bounds() {
+				t.Fatalf("frame bounds %v, %s has %v", img.Bounds(), golden, want.Bounds())
+			}
+			for y := 0; y < size; y++ {
+				for x := 0; x < size; x++ {
+					if got, w := img.RGBAAt(x, y), want.RGBAAt(x, y); got != w {
+						t.Fatalf("pixel (%d,%d) = %v, %s has %v", x, y, got, golden, w)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestCanvasReuseMatchesFreshFrame(t *testing.T) {
+	g := newRenderGrid(t)
+	canvas := image.NewRGBA(image.Rect(0, 0, GRID_SIZE*CELL_SIZE*2*4, GRID_SIZE*CELL_SIZE*2*4))
+	draw.Draw(canvas, canvas.Bounds(), &image.Uniform{color.RGBA{1, 2, 3, 255}}, image.Point{}, draw.Src)
+	reused := g.gridToImageAt("states", 4, false, true, canvas)
+	fresh := g.gridToImageAt("states", 4, false, true, nil)
+	if reused != canvas {
+		t.Fatal("a canvas of the right size was not drawn on")
+	}
+	for k := range fresh.Pix {
+		if reused.Pix[k] != fresh.Pix[k] {
+			t.Fatalf("reused canvas differs from a fresh frame at byte %d", k)
+		}
+	}
+}
+
+func TestOverlayMaskIsFixedPerSeed(t *testing.T) {
+	saved := randomSeed
+	t.Cleanup(func() { randomSeed = saved })
+	randomSeed = 7
+
+	if mask := buildOverlayMask(0); mask != nil {
+		t.Error("fraction 0 built an overlay")
+	}
+	mask := buildOverlayMask(0.3)
+	cells := 0
+	for i := range mask {
+		for j := range mask[i] {
+			if mask[i][j] {
+				cells++
+			}
+		}
+	}
+	if want := int(math.Round(0.3 * GRID_SIZE * GRID_SIZE)); cells != want {
+		t.Errorf("overlay has %d cells, want %d", cells, want)
+	}
+	again := buildOverlayMask(0.3)
+	for i := range mask {
+		for j := range mask[i] {
+			if mask[i][j] != again[i][j] {
+				t.Fatalf("seed 7 built two different overlays (cell %d,%d)", i, j)
+			}
+		}
+	}
+}
+
+func TestOverlayIsTheSameInEveryFrame(t *testing.T) {
+	saved, savedMask := randomSeed, overlayMask
+	t.Cleanup(func() { randomSeed, overlayMask = saved, savedMask })
+	randomSeed = 7
+	overlayMask = buildOverlayMask(0.3)
+
+	// Two frames with different states, none of them drawn black
+	g := newTestGrid(t, Config{})
+	black := color.RGBA{0, 0, 0, 255}
+	for frame, state := range []int{DEAD, ANTIVIRAL} {
+		for i := 0; i < GRID_SIZE; i++ {
+			for j := 0; j < GRID_SIZE; j++ {
+				g.state[i][j] = state
+			}
+		}
+		img := g.gridToImageAt("states", 1, true, false, nil)
+		for i := 1; i < GRID_SIZE-1; i++ {
+			for j := 1; j < GRID_SIZE-1; j++ {
+				x, y := calculateHexCenter(i, j)
+				if isBlack := img.RGBAAt(x, y) == black; isBlack != overlayMask[i][j] {
+					t.Fatalf("frame %d: cell (%d,%d) black %t, overlay %t", frame, i, j, isBlack, overlayMask[i][j])
+				}
+			}
+		}
+	}
+}
+
+func TestOverlayLeavesOutputsUnchanged(t *testing.T) {
+	var want, wantHash string
+	for _, cfg := range []Config{
+		{"randomSeed": "7", "render": "true"},
+		{"randomSeed": "7", "render": "true", "unexposedSetAreaFraction": "0.3"},
+		{"randomSeed": "7", "render": "true", "unexposedSetAreaFraction": "0.3", "videotype": "baltes"},
+	} {
+		result, err := runForTest(t, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		output := outputCSVForTest(t, result.OutputFolder)
+		if want == "" {
+			want, wantHash = output, result.Summary.StateHash
+			continue
+		}
+		if output != want || result.Summary.StateHash != wantHash {
+			t.Errorf("%v: simulation_output.csv or state hash differs from the run without the overlay", cfg)
+		}
+	}
+}
+
+func TestRenderLeavesOutputsUnchanged(t *testing.T) {
+	for _, option := range []string{"3", "4"} {
+		cfg := Config{"randomSeed": "7", "option": option}
+		headless, err := runForTest(t, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg["render"] = "true"
+		rendered, err := runForTest(t, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if outputCSVForTest(t, rendered.OutputFolder) != outputCSVForTest(t, headless.OutputFolder) {
+			t.Errorf("option %s: simulation_output.csv differs between -render=true and -render=false", option)
+		}
+		if rendered.Summary.StateHash != headless.Summary.StateHash {
+			t.Errorf("option %s: state hash %s with rendering, %s without", option, rendered.Summary.StateHash, headless.Summary.StateHash)
+		}
+		pngs, _ := filepath.Glob(filepath.Join(headless.OutputFolder, "*.png"))
+		videos, _ := filepath.Glob(filepath.Join(headless.OutputFolder, "*.avi"))
+		if len(pngs)+len(videos) != 0 {
+			t.Errorf("option %s: -render=false wrote %v %v", option, pngs, videos)
+		}
+		if pngs, _ := filepath.Glob(filepath.Join(rendered.OutputFolder, "*.png")); len(pngs) == 0 {
+			t.Errorf("option %s: -render=true wrote no PNGs", option)
+		}
+	}
+}
+
+func BenchmarkRunRender(b *testing.B) {
+	for _, render := range []bool{false, true} {
+		b.Run(fmt.Sprintf("render=%t", render), func(b *testing.B) {
+			cfg := Config{"randomSeed": "7", "render": fmt.Sprint(render)}
+			for n := 0; n < b.N; n++ {
+				if _, err := Run(cfg, RunOptions{OutputRoot: b.TempDir(), SkipPlots: true}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
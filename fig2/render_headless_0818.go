@@ -0,0 +1,12 @@
+//go:build headless
+
+// Headless rendering for mdbk_small_vero_0818.go: no images, graphs or video, and no image/chart
+// dependencies. CSV, snapshot and summary outputs are unchanged.
+//
+//	go build -tags headless -o sim mdbk_small_vero_0818.go render_headless_0818.go
+package main
+
+// Headless builds always use the no-op renderer, as if -render=false
+func newFrameRenderer() FrameRenderer {
+	return noRenderer{}
+}
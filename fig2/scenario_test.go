@@ -0,0 +1,157 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+)
+
+// The scenario tests check the model's qualitative claims with paired runs: both arms use the
+// same seeds 1..n, so the claim is judged on the paired difference and its standard error. They
+// run hundreds of simulations and are skipped under -short. Corner-vs-center on a periodic grid
+// and the dead-cell front are covered by TestPeriodicCornerMatchesCenter and
+// TestDeadFrontRadiusAcrossSeeds.
+
+// scenarioIssue is where the claims the model does not reproduce are tracked
+const scenarioIssue = "yimei-li/spatial-dynamics#synth-713~2"
+
+// Function to return the summaries of seeds 1..seeds for one arm
+func seededSummaries(t *testing.T, cfg Config, seeds int) []SimulationSummary {
+	t.Helper()
+	var summaries []SimulationSummary
+	for seed := 1; seed <= seeds; seed++ {
+		run := Config{"randomSeed": strconv.Itoa(seed)}
+		for name, value := range cfg {
+			run[name] = value
+		}
+		result, err := runForTest(t, run)
+		if err != nil {
+			t.Fatal(err)
+		}
+		summaries = append(summaries, result.Summary)
+	}
+	return summaries
+}
+
+// Function to pick one metric out of every summary
+func summaryValues(summaries []SimulationSummary, metric func(SimulationSummary) float64) []float64 {
+	values := make([]float64, len(summaries))
+	for k, s := range summaries {
+		values[k] = metric(s)
+	}
+	return values
+}
+
+func finalPlaque(s SimulationSummary) float64 { return s.FinalPlaquePercentage }
+
+// TestDIPsReducePlaqueSize seeds 300 virion PFU on many cells (-option=3) with and without 3000
+// DIP PFU over the same 60 seeds. The control also sets -burstSizeD=0 so it never makes DIPs.
+// DIPs must shrink the final plaque with the paired difference three standard errors below zero.
+// Measured: 2.14% with DIPs, 2.27% without, difference -0.131 ± 0.040 points.
+func TestDIPsReducePlaqueSize(t *testing.T) {
+	if testing.Short() {
+		t.Skip("120 runs")
+	}
+	const seeds = 60
+	base := Config{"option": "3", "v_pfu_initial": "300", "virionBurstMode": "both", "ifnSpreadOption": "local"}
+	withDIPs, withoutDIPs := Config{"d_pfu_initial": "3000"}, Config{"d_pfu_initial": "0", "burstSizeD": "0"}
+	for name, value := range base {
+		withDIPs[name], withoutDIPs[name] = value, value
+	}
+	treatment := summaryValues(seededSummaries(t, withDIPs, seeds), finalPlaque)
+	control := summaryValues(seededSummaries(t, withoutDIPs, seeds), finalPlaque)
+	diff, se := meanAndStandardError(pairedDifferences(treatment, control))
+	if diff+3*se >= 0 {
+		t.Errorf("DIPs do not reduce final plaque size: with - without DIPs = %.3f ± %.3f points over %d seeds, want below 0 by 3 SE",
+			diff, se, seeds)
+	}
+}
+
+// TestVeroDestroysMostOfTheMonolayer runs a high infection rate without IFN (vero, -rho=0.5) on
+// 10 seeds. More than 60% of the cells must be dead, three standard errors below the mean.
+// Measured over 30 seeds: mean 71.4%, standard deviation 1.3, lowest 68.6%.
+func TestVeroDestroysMostOfTheMonolayer(t *testing.T) {
+	if testing.Short() {
+		t.Skip("10 runs")
+	}
+	const seeds, threshold = 10, 60.0
+	dead := summaryValues(seededSummaries(t, Config{"option": "3", "v_pfu_initial": "2000", "ifnSpreadOption": "noIFN", "rho": "0.5"}, seeds),
+		func(s SimulationSummary) float64 { return s.FinalDeadPercentage })
+	mean, se := meanAndStandardError(dead)
+	if mean-3*se < threshold {
+		t.Errorf("without IFN %.1f%% ± %.1f of the monolayer is dead over %d seeds, want above %.0f%% by 3 SE", mean, se, seeds, threshold)
+	}
+}
+
+// TestSameSeedReproducesRandomJumps runs random DIP and virion jumps twice with each of three seeds.
+// Both runs must leave the same final grid and write the same simulation_output.csv.
+func TestSameSeedReproducesRandomJumps(t *testing.T) {
+	if testing.Short() {
+		t.Skip("6 runs")
+	}
+	for seed := 1; seed <= 3; seed++ {
+		cfg := Config{"randomSeed": strconv.Itoa(seed), "option": "4", "particleSpreadOption": "jumprandomly"}
+		first, err := runForTest(t, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		second, err := runForTest(t, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if first.Summary.StateHash != second.Summary.StateHash {
+			t.Errorf("seed %d: state hash %s, then %s", seed, first.Summary.StateHash, second.Summary.StateHash)
+		}
+		if outputCSVForTest(t, first.OutputFolder) != outputCSVForTest(t, second.OutputFolder) {
+			t.Errorf("seed %d: simulation_output.csv differs between two runs", seed)
+		}
+	}
+}
+
+// Function to report a claim the model is known to contradict: skipped while the paired
+// difference still has the wrong sign, and failed once it holds so the expected failure is
+// removed. The claim holds when the paired difference is three standard errors below zero.
+func expectClaimToFail(t *testing.T, claim string, diff, se float64, seeds int) {
+	t.Helper()
+	if diff+3*se < 0 {
+		t.Errorf("%q now holds (%.4f ± %.4f over %d seeds): remove the expected failure (%s)", claim, diff, se, seeds, scenarioIssue)
+		return
+	}
+	t.Skipf("expected failure, %s: %q does not hold, paired difference %.4f ± %.4f over %d seeds", scenarioIssue, claim, diff, se, seeds)
+}
+
+// TestLocalIFNGivesSmallerPlaquesThanGlobal is the claim that local IFN, which protects the cells
+// around a plaque first, leaves smaller plaques than IFN spread evenly over the grid. The model
+// does the opposite with the default parameters: over 30 seeds local 0.050% vs global 0.038%,
+// difference +0.013 ± 0.005 points. The test is an expected failure until that is resolved.
+func TestLocalIFNGivesSmallerPlaquesThanGlobal(t *testing.T) {
+	if testing.Short() {
+		t.Skip("60 runs")
+	}
+	const seeds = 30
+	local := summaryValues(seededSummaries(t, Config{"ifnSpreadOption": "local"}, seeds), finalPlaque)
+	global := summaryValues(seededSummaries(t, Config{"ifnSpreadOption": "global"}, seeds), finalPlaque)
+	diff, se := meanAndStandardError(pairedDifferences(local, global))
+	expectClaimToFail(t, "Local IFN gives smaller plaques than global IFN", diff, se, seeds)
+}
+
+// TestVirionOnlyBurstsGiveFewerDIPOnlyCells is the claim that -virionBurstMode=virionOnly, where
+// lysing cells release virions alone, gives fewer DIP-only cells than -virionBurstMode=both. The
+// peak DIP-only percentage is identical for every seed (0.230% over 10 seeds): cells infected by
+// virions alone carry no DIPs, so the burst mode never changes what they release. The test is an
+// expected failure until that is resolved.
+func TestVirionOnlyBurstsGiveFewerDIPOnlyCells(t *testing.T) {
+	if testing.Short() {
+		t.Skip("20 runs")
+	}
+	const seeds = 10
+	peak := func(s SimulationSummary) float64 { return s.PeakDIPOnlyPercentage }
+	base := Config{"d_pfu_initial": "1"}
+	virionOnly, both := Config{"virionBurstMode": "virionOnly"}, Config{"virionBurstMode": "both"}
+	for name, value := range base {
+		virionOnly[name], both[name] = value, value
+	}
+	diff, se := meanAndStandardError(pairedDifferences(
+		summaryValues(seededSummaries(t, virionOnly, seeds), peak),
+		summaryValues(seededSummaries(t, both, seeds), peak)))
+	expectClaimToFail(t, "virionOnly bursts give fewer DIP-only cells than both", diff, se, seeds)
+}
@@ -0,0 +1,118 @@
+//go:build linux || darwin
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// TestMain runs the simulator's own main when the test binary is started as the fit or as one of
+// its replicates (the fit runs os.Executable() for every replicate)
+func TestMain(m *testing.M) {
+	if os.Getenv("FIG3_FIT_CHILD") == "1" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// Function to start a quickTest fit of testdata/fit_data.csv in its own process group, so an
+// interruption can kill the replicates it has running too
+func startFit(t *testing.T, outDir string, extra ...string) (*exec.Cmd, *bytes.Buffer) {
+	t.Helper()
+	self, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := filepath.Abs(filepath.Join("testdata", "fit_data.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := append([]string{"-fitMode", "-quickTest", "-dataCSV=" + data, "-outDir=" + outDir,
+		"-replicates=1", "-bootstrapN=0", "-fitMaxIters=4"}, extra...)
+	cmd := exec.Command(self, args...)
+	cmd.Dir = filepath.Dir(outDir)
+	cmd.Env = append(os.Environ(), "FIG3_FIT_CHILD=1")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	var out bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &out
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	return cmd, &out
+}
+
+// Function to read the last completed iteration from outDir/fit_state.json, or -1 before the first save
+func savedIteration(outDir string) int {
+	bs, err := os.ReadFile(filepath.Join(outDir, "fit_state.json"))
+	if err != nil {
+		return -1
+	}
+	var st struct {
+		Iter int `json:"iter"`
+	}
+	if json.Unmarshal(bs, &st) != nil {
+		return -1
+	}
+	return st.Iter
+}
+
+// TestResumedFitMatchesUninterruptedFit runs a 4-iteration quickTest fit to the end, then kills
+// the same fit and its replicates once fit_state.json records iteration 2 and finishes it with
+// -resumeFit. The resumed fit must end in the same fit_state.json (simplex, best parameters, SSE
+// and trace) and write the same fit_trace.csv and simulation_bands.csv as the uninterrupted one.
+func TestResumedFitMatchesUninterruptedFit(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs about 50 simulations")
+	}
+	whole := filepath.Join(t.TempDir(), "fit")
+	cmd, out := startFit(t, whole)
+	if err := cmd.Wait(); err != nil {
+		t.Fatalf("uninterrupted fit: %v\n%s", err, out)
+	}
+
+	interrupted := filepath.Join(t.TempDir(), "fit")
+	cmd, out = startFit(t, interrupted)
+	deadline := time.Now().Add(5 * time.Minute)
+	for savedIteration(interrupted) < 2 {
+		if time.Now().After(deadline) {
+			syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+			t.Fatalf("fit saved no iteration 2 in 5 minutes\n%s", out)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	cmd.Wait()
+	if iter := savedIteration(interrupted); iter >= 4 {
+		t.Fatalf("fit finished iteration %d before it was interrupted", iter)
+	}
+
+	cmd, out = startFit(t, interrupted, "-resumeFit="+interrupted)
+	if err := cmd.Wait(); err != nil {
+		t.Fatalf("resumed fit: %v\n%s", err, out)
+	}
+	if !bytes.Contains(out.Bytes(), []byte("[fitMode] Resuming from")) {
+		t.Fatalf("-resumeFit started a new fit:\n%s", out)
+	}
+
+	for _, name := range []string{"fit_state.json", filepath.Join("quick", "fit_trace.csv"), filepath.Join("quick", "simulation_bands.csv")} {
+		want, err := os.ReadFile(filepath.Join(whole, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(filepath.Join(interrupted, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s of the resumed fit differs from the uninterrupted fit:\n%s\nwant\n%s", name, got, want)
+		}
+	}
+}
@@ -16,7 +16,9 @@ package main
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/csv"
+	"encoding/hex"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -33,16 +35,12 @@ import (
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
-	"github.com/icza/mjpeg"
-	"github.com/wcharczuk/go-chart/v2" // Used for plotting the graph
-	"github.com/wcharczuk/go-chart/v2/drawing"
-	"golang.org/x/image/font"
-	"golang.org/x/image/font/basicfont"
-	"golang.org/x/image/math/fixed"
+	"github.com/yimei-li/spatial-dynamics/plotprofile"
 )
 
 // Constant definitions
@@ -109,13 +107,16 @@ var (
 
 	// Random seed parameter
 	flag_randomSeed = flag.Int64("randomSeed", -1, "Random seed for reproducible results (-1 for random seed based on time)")
+
+	// Infection graph y-axis limit
+	flag_yMax = flag.Float64("yMax", 0, "Y-axis maximum of the infection graph (0 = look up from the IFN radius/TAU/jump mode profile table, auto-scale if none matches)")
 )
 
 // Fitting pipeline flags
 var (
 	flag_fitMode     = flag.Bool("fitMode", false, "If true, run parameter fitting pipeline instead of normal simulation")
 	flag_dataCSV     = flag.String("dataCSV", "", "Path to experimental data CSV (required in fitMode)")
-	flag_metrics     = flag.String("metrics", "infected_pct,plaque_pct", "Comma-separated metrics to match (e.g., infected_pct,plaque_pct)")
+	flag_metrics     = flag.String("metrics", "infected_pct,plaque_pct", "Comma-separated metrics to match (e.g., infected_pct,plaque_pct; virion_auc and dip_auc integrate the extracellular particles since the previous -times entry)")
 	flag_times       = flag.String("times", "7,13,19,25", "Comma-separated timepoints (hours) to compare, e.g., 7,13,19,25")
 	flag_replicates  = flag.Int("replicates", 30, "Number of stochastic replicates per objective evaluation")
 	flag_baseSeed    = flag.Int("baseSeed", 12345, "Base seed; replicate i uses baseSeed + i")
@@ -124,6 +125,12 @@ var (
 	flag_fitMaxIters = flag.Int("fitMaxIters", 300, "Optimizer maximum iterations")
 	flag_fitTol      = flag.Float64("fitTol", 1e-4, "Optimizer tolerance for convergence (delta SSE)")
 	flag_quickTest   = flag.Bool("quickTest", false, "If true, run lightweight quick test configuration")
+	flag_resumeFit   = flag.String("resumeFit", "", "Resume the fit saved in this outDir (fit_state.json) after its last completed iteration")
+	flag_burnIn      = flag.Int("burnIn", 0, "Warm-up hours the data does not describe; -times inside it are rejected")
+
+	// Optimizer used by the fit: neldermead over (rho, burstSizeV, meanLysisTime), or the older
+	// coordinate pattern search over (burstSizeV, burstSizeD, meanLysisTime, burstRadius)
+	flag_fitOptimizer = flag.String("fitOptimizer", "neldermead", "Fit optimizer: neldermead or pattern")
 )
 
 // Particle spread related
@@ -458,19 +465,6 @@ func (g *Grid) initializeInfection(option int) {
 
 }
 
-// Function to generate ticks dynamically
-func generateTicks(xMax float64, interval float64) []chart.Tick {
-	var ticks []chart.Tick
-	for value := 0.0; value <= xMax; value += interval {
-		label := fmt.Sprintf("%.0f", value) // Format the label as an integer
-		ticks = append(ticks, chart.Tick{
-			Value: value,
-			Label: label,
-		})
-	}
-	return ticks
-}
-
 // Initialize the grid, setting all cells to SUSCEPTIBLE
 func (g *Grid) initialize() {
 	for i := 0; i < GRID_SIZE; i++ {
@@ -498,6 +492,7 @@ func (g *Grid) initialize() {
 	fmt.Println("Grid initialized")
 
 }
+
 // Ensure the entire canvas is initialized with uniform background color
 func fillBackground(img *image.RGBA, bgColor color.Color) {
 	for y := 0; y < img.Bounds().Dy(); y++ {
@@ -708,78 +703,6 @@ func clampValues(data []float64, min, max float64) []float64 {
 	return clamped
 }
 
-// Modified function definition
-func createInfectionGraph(frameNum int, virionOnly, dipOnly, both []float64, showLegend bool) *image.RGBA {
-	graphWidth := GRID_SIZE * CELL_SIZE * 2
-	graphHeight := 200
-
-	if frameNum < 1 {
-		log.Fatalf("Not enough data to render the graph: frameNum = %d", frameNum)
-	}
-
-	virionOnly = clampValues(virionOnly, 0.00, yMax)
-	dipOnly = clampValues(dipOnly, 0.00, yMax)
-	both = clampValues(both, 0.00, yMax)
-
-	// Dynamically set legend name
-	var series []chart.Series
-
-	series = []chart.Series{
-		chart.ContinuousSeries{
-			Name:    "Infected by Virion Only",
-			XValues: createTimeSeries(frameNum),
-			YValues: virionOnly,
-			Style:   chart.Style{StrokeColor: chart.ColorRed, StrokeWidth: 6.0},
-		},
-		chart.ContinuousSeries{
-			Name:    "Infected by DIP Only",
-			XValues: createTimeSeries(frameNum),
-			YValues: dipOnly,
-			Style:   chart.Style{StrokeColor: chart.ColorGreen, StrokeWidth: 6.0},
-		},
-		chart.ContinuousSeries{
-			Name:    "Infected by Both",
-			XValues: createTimeSeries(frameNum),
-			YValues: both,
-			Style:   chart.Style{StrokeColor: drawing.Color{R: 255, G: 165, B: 0, A: 255}, StrokeWidth: 8.0},
-		},
-	}
-
-	graph := chart.Chart{
-		Width:  459, // int(float64(GRID_SIZE*CELL_SIZE) * 1.51)
-		Height: 100,
-		XAxis: chart.XAxis{
-			Style: chart.Style{FontSize: 10.0},
-			ValueFormatter: func(v interface{}) string {
-				return fmt.Sprintf("%d", int(v.(float64)))
-			},
-			Ticks: generateTicks(xMax, ticksInterval),
-		},
-		YAxis: chart.YAxis{
-			Style: chart.Style{FontSize: 10.0},
-		},
-		Series: series,
-	}
-
-	buffer := bytes.NewBuffer([]byte{})
-	err := graph.Render(chart.PNG, buffer)
-	if err != nil {
-		log.Printf("Failed to render graph: %v", err)
-		// Return a simple colored rectangle instead of crashing
-		return image.NewRGBA(image.Rect(0, 0, 459, 100))
-	}
-
-	graphImg, _, err := image.Decode(buffer)
-	if err != nil {
-		log.Fatalf("Failed to decode graph image: %v", err)
-	}
-
-	rgbaImg := image.NewRGBA(image.Rect(0, 0, graphWidth, graphHeight))
-	draw.Draw(rgbaImg, rgbaImg.Bounds(), graphImg, image.Point{}, draw.Src)
-
-	return rgbaImg
-}
-
 // saveCurrentGoFile saves the current Go source file into the specified output folder.
 // saveCurrentGoFile saves the current Go source file with its original name and a timestamp.
 func saveCurrentGoFile(outputFolder string) {
@@ -937,7 +860,7 @@ func (g *Grid) calculateInfectedPercentage() float64 {
 	for i := 0; i < GRID_SIZE; i++ {
 		for j := 0; j < GRID_SIZE; j++ {
 			if g.state[i][j] == INFECTED_VIRION || g.state[i][j] == INFECTED_DIP || g.state[i][j] == INFECTED_DIP_CONTINUOUS || g.state[i][j] == INFECTED_BOTH ||
-				g.state[i][j] == INFECTED_VIRION_CONTINUOUS || g.state[i][j] == INFECTED_DIP || g.state[i][j] == INFECTED_DIP_CONTINUOUS || g.state[i][j] == INFECTED_BOTH_CONTINUOUS {
+				g.state[i][j] == INFECTED_VIRION_CONTINUOUS || g.state[i][j] == INFECTED_BOTH_CONTINUOUS {
 				infectedCells++
 			}
 		}
@@ -986,6 +909,7 @@ func (g *Grid) calculateAntiviralPercentage() float64 {
 	}
 	return (float64(antiviralCells) / float64(totalCells)) * 100
 }
+
 // Function to calculate the percentage of uninfected cells (susceptible and regrowth cells)
 func (g *Grid) calculateUninfectedPercentage() float64 {
 	totalCells := GRID_SIZE * GRID_SIZE
@@ -999,6 +923,7 @@ func (g *Grid) calculateUninfectedPercentage() float64 {
 	}
 	return (float64(uninfectedCells) / float64(totalCells)) * 100
 }
+
 // Function to calculate plaque percentage (for simplicity, counting dead cells as plaques)
 func (g *Grid) calculatePlaquePercentage() float64 {
 	totalCells := GRID_SIZE * GRID_SIZE
@@ -1457,6 +1382,7 @@ func (g *Grid) handleContinuousProduction(i, j, frameNum int) {
 		}
 	}
 }
+
 // Distribute particles using continuous production with distance weights
 func (g *Grid) distributeContinuousParticles(i, j, virions, dips int) {
 	availableNeighbors := g.neighborsBurstArea[i][j]
@@ -1941,6 +1867,7 @@ func (g *Grid) handleDipOnlyClearance(frameNum int) {
 		fmt.Printf("🔄 Frame %d: %d DIP-only infected cells cleared and became susceptible\n", frameNum, dipOnlyClearedCount)
 	}
 }
+
 // Test function to verify that dead cells have no viral particles
 func (g *Grid) testDeadCellParticleClearance(frameNum int) {
 	deadCellsWithParticles := 0
@@ -2158,7 +2085,7 @@ func (g *Grid) update(frameNum int) {
 				// Note: regionalAverageIFN is not used in this section
 
 				if g.state[i][j] == INFECTED_VIRION || g.state[i][j] == INFECTED_DIP || g.state[i][j] == INFECTED_DIP_CONTINUOUS || g.state[i][j] == INFECTED_BOTH ||
-					g.state[i][j] == INFECTED_VIRION_CONTINUOUS || g.state[i][j] == INFECTED_DIP || g.state[i][j] == INFECTED_DIP_CONTINUOUS || g.state[i][j] == INFECTED_BOTH_CONTINUOUS {
+					g.state[i][j] == INFECTED_VIRION_CONTINUOUS || g.state[i][j] == INFECTED_BOTH_CONTINUOUS {
 					fmt.Printf("🔍 DEBUG: Processing infected cell at (%d,%d) with state %d at frame %d\n", i, j, g.state[i][j], frameNum)
 
 					// Handle burst mode cells (lysis logic)
@@ -2334,6 +2261,8 @@ func (g *Grid) update(frameNum int) {
 									// Old complex diffusion logic remains below if needed
 								}
 							}
+						}
+					}
 				}
 			}
 		}
@@ -2747,7 +2676,7 @@ func (g *Grid) update(frameNum int) {
 					}
 
 					// Handle continuous mode cells (production logic) - ifnWave = false branch
-					if g.state[i][j] == INFECTED_VIRION_CONTINUOUS || g.state[i][j] == INFECTED_DIP || g.state[i][j] == INFECTED_DIP_CONTINUOUS || g.state[i][j] == INFECTED_BOTH_CONTINUOUS {
+					if g.state[i][j] == INFECTED_VIRION_CONTINUOUS || g.state[i][j] == INFECTED_BOTH_CONTINUOUS {
 						fmt.Printf("🚀 DEBUG: Found continuous state cell at (%d,%d) with state %d at frame %d (ifnWave=false branch)\n", i, j, g.state[i][j], frameNum)
 						// Use continuous production logic
 						g.handleViralProduction(i, j, frameNum)
@@ -2957,7 +2886,7 @@ func (g *Grid) update(frameNum int) {
 }
 
 // Function to record simulation data into CSV at each timestep
-func (g *Grid) recordSimulationDataTEMP(writer *csv.Writer, frameNum int) {
+func (g *Grid) recordSimulationData(writer *csv.Writer, frameNum int) {
 	// Aggregate counts and percentages
 	totalVirions := g.totalVirions()
 	totalDIPs := g.totalDIPs()
@@ -3196,43 +3125,6 @@ func (g *Grid) gridToImage(videotype string) *image.RGBA {
 	return img // Return the image
 }
 
-func drawTextWithBackground(img *image.RGBA, x, y int, label string, textColor, borderColor, bgColor color.Color) {
-	face := basicfont.Face7x13
-	textWidth := len(label) * 7
-	textHeight := 13
-
-	// White background box
-	bgRect := image.Rect(x-4, y-4, x+textWidth+4, y+textHeight+4)
-	draw.Draw(img, bgRect, &image.Uniform{bgColor}, image.Point{}, draw.Src)
-
-	// Text starting point
-	point := fixed.Point26_6{
-		X: fixed.I(x),
-		Y: fixed.I(y + textHeight),
-	}
-	d := &font.Drawer{
-		Dst:  img,
-		Src:  image.NewUniform(textColor),
-		Face: face,
-		Dot:  point,
-	}
-	d.DrawString(label)
-}
-
-// addLabel draws a text label onto an image at the specified position.
-func addLabel(img *image.RGBA, x, y int, label string, col color.Color) {
-	point := fixed.Point26_6{
-		X: fixed.I(x),
-		Y: fixed.I(y),
-	}
-	d := &font.Drawer{
-		Dst:  img,
-		Src:  image.NewUniform(col),
-		Face: basicfont.Face7x13, // Basic font for rendering
-		Dot:  point,
-	}
-	d.DrawString(label)
-}
 func addStaticLegend(img *image.RGBA, startX, startY int) {
 	// Keep original colors and label definitions unchanged
 	legendItems := []string{
@@ -3365,6 +3257,14 @@ func isPointInHexagon(p image.Point, hex [6]image.Point) bool {
 	}
 	return true // Return true if the point is inside the hexagon
 }
+
+// videoWriter receives one JPEG per frame; render_0818.go writes them to an MJPEG AVI and the
+// headless build drops them
+type videoWriter interface {
+	AddFrame(jpegData []byte) error
+	Close() error
+}
+
 func main() {
 	flag.Parse()
 
@@ -3574,47 +3474,13 @@ func main() {
 		ticksInterval = 100.0
 	}
 
-	// Switch statement with conditional cases
-	// Switch statement with conditional cases
-	switch {
-	case IFN_wave_radius == 0 && TAU == 12 && jumpRandomly == true:
-		yMax = 0.2
-	case IFN_wave_radius == 0 && TAU == 12 && jumpRandomly == true:
-		yMax = 1.0
-	case IFN_wave_radius == 0 && TAU == 12 && jumpRandomly == true:
-		yMax = 0.03
-	case IFN_wave_radius == 0 && TAU == 12 && jumpRandomly == true:
-		yMax = 1.5
-	case IFN_wave_radius == 10 && TAU == 12 && jumpRandomly == true:
-		yMax = 20.0
-	case IFN_wave_radius == 10 && TAU == 12 && jumpRandomly == true:
-		yMax = 0.1
-	case IFN_wave_radius == 0 && jumpRadiusV == 0 && jumpRadiusD == 0 && TAU == 12:
-		yMax = 0.3
-	case IFN_wave_radius == 0 && jumpRadiusV == 5 && jumpRadiusD == 0 && TAU == 12:
-		yMax = 1.0
-	case IFN_wave_radius == 0 && jumpRadiusV == 0 && jumpRadiusD == 5 && TAU == 12:
-		yMax = 0.03
-	case IFN_wave_radius == 0 && jumpRadiusV == 5 && jumpRadiusD == 5 && TAU == 12:
-		yMax = 0.1
-	case IFN_wave_radius == 10 && jumpRadiusV == 5 && jumpRadiusD == 5 && TAU == 12:
-		yMax = 0.2
-	case IFN_wave_radius == 0 && jumpRadiusV == 0 && jumpRadiusD == 0 && TAU == 24:
-		yMax = 0.3
-	case IFN_wave_radius == 0 && jumpRadiusV == 5 && jumpRadiusD == 5 && TAU == 24:
-		yMax = 1.5
-	case IFN_wave_radius == 10 && jumpRadiusV == 5 && jumpRadiusD == 5 && TAU == 24:
-		yMax = 0.2
-
-	case IFN_wave_radius == 0 && jumpRadiusV == 0 && jumpRadiusD == 0:
-		yMax = 0.3
-	case IFN_wave_radius == 0 && jumpRadiusV == 5 && jumpRadiusD == 5:
-		yMax = 1.5
-	case IFN_wave_radius == 10 && jumpRadiusV == 5 && jumpRadiusD == 5:
-		yMax = 35.0
-
-	default:
-		yMax = -1.0 // Default value in case no conditions are met
+	// Infection-graph y-axis limit: -yMax if given, else the plot profile table (-1 = auto-scale)
+	if *flag_yMax < 0 || math.IsNaN(*flag_yMax) {
+		log.Fatalf("Invalid yMax: %g (expected > 0, or 0 for the profile table)", *flag_yMax)
+	}
+	yMax = plotprofile.YMax(IFN_wave_radius, TAU, jumpRandomly, jumpRadiusV, jumpRadiusD)
+	if *flag_yMax > 0 {
+		yMax = *flag_yMax
 	}
 
 	folderNumber := getNextFolderNumber("./")
@@ -3686,7 +3552,7 @@ func main() {
 	}
 
 	// Create an MJPEG video writer
-	videoWriter, err := mjpeg.New(videoFilePath, int32(GRID_SIZE*CELL_SIZE*2), int32(GRID_SIZE*CELL_SIZE*2), int32(FRAME_RATE))
+	videoWriter, err := newVideoWriter(videoFilePath, GRID_SIZE*CELL_SIZE*2, GRID_SIZE*CELL_SIZE*2, FRAME_RATE)
 	if err != nil {
 		log.Fatalf("Failed to create MJPEG writer: %v", err) // Handle the error if the writer fails to create
 	}
@@ -3717,7 +3583,7 @@ func main() {
 		grid.removeViralParticlesOutsideIFNRange(frameNum)
 
 		// Call the function to record infected state counts at the specific frames
-		// grid.recordSimulationData(writer, frameNum)
+		grid.recordSimulationData(writer, frameNum)
 
 		// Calculate and record the percentage of dead cells, excluding regrowth cells
 		deadCellsPercentage := calculateDeadCellPercentage(grid.state)
@@ -3805,6 +3671,7 @@ func main() {
 	// Generate comparison plots including composite_4x2_comparison.png
 	generateComparisonPlots(outputFolder)
 }
+
 // runFitPipeline is a scaffold to keep build green until full implementation.
 func runFitPipeline() {
 	// Quick test overrides
@@ -3824,6 +3691,12 @@ func runFitPipeline() {
 	if strings.TrimSpace(*flag_dataCSV) == "" {
 		log.Fatalf("fitMode requires -dataCSV path")
 	}
+	if *flag_fitOptimizer != "neldermead" && *flag_fitOptimizer != "pattern" {
+		log.Fatalf("Invalid -fitOptimizer %q (want neldermead or pattern)", *flag_fitOptimizer)
+	}
+	if *flag_resumeFit != "" {
+		*flag_outDir = *flag_resumeFit
+	}
 
 	// Parse metrics
 	metricNames := []string{}
@@ -3849,6 +3722,9 @@ func runFitPipeline() {
 		if err != nil {
 			log.Fatalf("Invalid time '%s' in -times: %v", ts, err)
 		}
+		if v < *flag_burnIn {
+			log.Fatalf("Time %d in -times falls inside the %d h -burnIn", v, *flag_burnIn)
+		}
 		reqTimes = append(reqTimes, v)
 	}
 	if len(reqTimes) == 0 {
@@ -3866,6 +3742,13 @@ func runFitPipeline() {
 	if err != nil {
 		log.Fatalf("Failed to read data CSV %q: %v", *flag_dataCSV, err)
 	}
+	// Hash of the data CSV, so a resumed fit can check it is fitting the same data
+	dataBytes, err := os.ReadFile(*flag_dataCSV)
+	if err != nil {
+		log.Fatalf("Failed to read data CSV %q: %v", *flag_dataCSV, err)
+	}
+	dataSum := sha256.Sum256(dataBytes)
+	dataHash := hex.EncodeToString(dataSum[:])
 	if len(records) < 2 {
 		log.Fatalf("Data CSV %q has no data rows", *flag_dataCSV)
 	}
@@ -3915,8 +3798,8 @@ func runFitPipeline() {
 		}
 	}
 
-	fmt.Printf("[fitMode] Config: metrics=%v times=%v replicates=%d bootN=%d maxIters=%d tol=%g outDir=%s baseSeed=%d\n",
-		metricNames, reqTimes, *flag_replicates, *flag_bootstrapN, *flag_fitMaxIters, *flag_fitTol, *flag_outDir, *flag_baseSeed)
+	fmt.Printf("[fitMode] Config: optimizer=%s metrics=%v times=%v replicates=%d bootN=%d maxIters=%d tol=%g outDir=%s baseSeed=%d\n",
+		*flag_fitOptimizer, metricNames, reqTimes, *flag_replicates, *flag_bootstrapN, *flag_fitMaxIters, *flag_fitTol, *flag_outDir, *flag_baseSeed)
 	fmt.Printf("[fitMode] Data loaded: %d unique times, %d metrics.\n", len(dataByTime), len(metricNames))
 
 	// Build data table (metric -> time -> value)
@@ -3930,24 +3813,37 @@ func runFitPipeline() {
 
 	// Define parameter structure
 	type FitParams struct {
-		BurstSizeV    int
-		BurstSizeD    int
-		MeanLysisTime float64
-		BurstRadius   int
+		BurstSizeV    int     `json:"burst_size_v"`
+		BurstSizeD    int     `json:"burst_size_d"`
+		MeanLysisTime float64 `json:"mean_lysis_time"`
+		BurstRadius   int     `json:"burst_radius"`
+		Rho           float64 `json:"rho"`
 	}
 
-	// Bounds per user request (rho not fitted)
+	// Bounds per user request (rho is only fitted by neldermead)
 	type boundsSpec struct {
-		Vmin, Vmax, Vstep int
-		Dmin, Dmax, Dstep int
-		Lmin, Lmax, Lstep float64
-		Rmin, Rmax, Rstep int
+		Vmin  int     `json:"v_min"`
+		Vmax  int     `json:"v_max"`
+		Vstep int     `json:"v_step"`
+		Dmin  int     `json:"d_min"`
+		Dmax  int     `json:"d_max"`
+		Dstep int     `json:"d_step"`
+		Lmin  float64 `json:"l_min"`
+		Lmax  float64 `json:"l_max"`
+		Lstep float64 `json:"l_step"`
+		Rmin  int     `json:"r_min"`
+		Rmax  int     `json:"r_max"`
+		Rstep int     `json:"r_step"`
+		Pmin  float64 `json:"p_min"`
+		Pmax  float64 `json:"p_max"`
+		Pstep float64 `json:"p_step"`
 	}
 	b := boundsSpec{
 		Vmin: 100, Vmax: 2000, Vstep: 50,
 		Dmin: 100, Dmax: 500, Dstep: 10,
 		Lmin: 4, Lmax: 24, Lstep: 1,
 		Rmin: 2, Rmax: 30, Rstep: 1,
+		Pmin: 0.001, Pmax: 0.2, Pstep: 0.005,
 	}
 	if *flag_quickTest {
 		b.Vstep = 200
@@ -3961,7 +3857,14 @@ func runFitPipeline() {
 		BurstSizeD:    *flag_burstSizeD,
 		MeanLysisTime: *flag_meanLysisTime,
 		BurstRadius:   *flag_burstRadius,
+		Rho:           *flag_rho,
 	}
+	// The flag defaults can lie outside the box (burstSizeV defaults to 50); start from the nearest admissible point
+	curr.BurstSizeV = clampInt(curr.BurstSizeV, b.Vmin, b.Vmax)
+	curr.BurstSizeD = clampInt(curr.BurstSizeD, b.Dmin, b.Dmax)
+	curr.MeanLysisTime = clampFloat(curr.MeanLysisTime, b.Lmin, b.Lmax)
+	curr.BurstRadius = clampInt(curr.BurstRadius, b.Rmin, b.Rmax)
+	curr.Rho = clampFloat(curr.Rho, b.Pmin, b.Pmax)
 
 	// Cache for objective evaluations
 	type Stats struct{ Mean, SD, P2p5, P97p5 float64 }
@@ -3980,9 +3883,26 @@ func runFitPipeline() {
 		}
 	}
 
+	// Append-only log of every objective evaluation (kept across resumed runs)
+	_ = os.MkdirAll(*flag_outDir, 0755)
+	evalTracePath := filepath.Join(*flag_outDir, "fit_evaluations.csv")
+	evalTrace, err := os.OpenFile(evalTracePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Fatalf("Failed to open %s: %v", evalTracePath, err)
+	}
+	defer evalTrace.Close()
+	if info, err := evalTrace.Stat(); err == nil && info.Size() == 0 {
+		_, _ = evalTrace.WriteString("BurstSizeV,BurstSizeD,MeanLysisTime,BurstRadius,Rho,SSE,wall_seconds,cached\n")
+	}
+	logEval := func(p FitParams, sse float64, start time.Time, cached bool) {
+		_, _ = evalTrace.WriteString(fmt.Sprintf("%d,%d,%.3f,%d,%.6f,%.6f,%.3f,%t\n",
+			p.BurstSizeV, p.BurstSizeD, p.MeanLysisTime, p.BurstRadius, p.Rho, sse, time.Since(start).Seconds(), cached))
+	}
+
 	// Evaluate one parameter set with replicates and return replicate stats and SSE
 	eval := func(p FitParams) (RepStats, float64, error) {
-		key := fmt.Sprintf("V=%d|D=%d|L=%.3f|R=%d", p.BurstSizeV, p.BurstSizeD, p.MeanLysisTime, p.BurstRadius)
+		start := time.Now()
+		key := fmt.Sprintf("V=%d|D=%d|L=%.3f|R=%d|P=%.6f", p.BurstSizeV, p.BurstSizeD, p.MeanLysisTime, p.BurstRadius, p.Rho)
 		if rs, ok := cache[key]; ok {
 			// compute SSE from cached stats
 			sse := 0.0
@@ -3992,6 +3912,7 @@ func runFitPipeline() {
 					sse += (mean - data[m][t]) * (mean - data[m][t])
 				}
 			}
+			logEval(p, sse, start, true)
 			return rs, sse, nil
 		}
 
@@ -4012,7 +3933,11 @@ func runFitPipeline() {
 		baseDir := filepath.Join(*flag_outDir, modeDir)
 		_ = os.MkdirAll(baseDir, 0755)
 
-		self := os.Args[0]
+		// Children run in their own replicate folders, so a relative os.Args[0] would not resolve
+		self, err := os.Executable()
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to locate executable: %v", err)
+		}
 		for i := 0; i < *flag_replicates; i++ {
 			repDir := filepath.Join(baseDir, fmt.Sprintf("rep_%04d", i))
 			_ = os.MkdirAll(repDir, 0755)
@@ -4021,6 +3946,7 @@ func runFitPipeline() {
 				fmt.Sprintf("-burstSizeD=%d", p.BurstSizeD),
 				fmt.Sprintf("-meanLysisTime=%.6f", p.MeanLysisTime),
 				fmt.Sprintf("-burstRadius=%d", p.BurstRadius),
+				fmt.Sprintf("-rho=%.6f", p.Rho),
 				"-fitMode=false",
 				"-particleSpreadOption=celltocell",
 				"-ifnSpreadOption=noIFN",
@@ -4070,41 +3996,178 @@ func runFitPipeline() {
 				sse += (rs[m][t].Mean - data[m][t]) * (rs[m][t].Mean - data[m][t])
 			}
 		}
+		logEval(p, sse, start, false)
 		return rs, sse, nil
 	}
 
 	// Simple coordinate pattern search (derivative-free)
 	type traceRow struct {
-		Iter int
-		SSE  float64
-		V    int
-		D    int
-		L    float64
-		R    int
+		Iter int     `json:"iter"`
+		SSE  float64 `json:"sse"`
+		V    int     `json:"burst_size_v"`
+		D    int     `json:"burst_size_d"`
+		L    float64 `json:"mean_lysis_time"`
+		R    int     `json:"burst_radius"`
+		P    float64 `json:"rho"`
+	}
+
+	// Optimizer state saved to outDir/fit_state.json after every iteration, for -resumeFit
+	type fitState struct {
+		DataCSVHash    string      `json:"data_csv_sha256"`
+		Bounds         boundsSpec  `json:"bounds"`
+		Metrics        []string    `json:"metrics"`
+		Times          []int       `json:"times"`
+		ReplicateSeeds []int       `json:"replicate_seeds"` // replicate i runs with -randomSeed=ReplicateSeeds[i]
+		Iter           int         `json:"iter"`            // last completed iteration
+		Converged      bool        `json:"converged"`
+		Curr           FitParams   `json:"curr"`
+		BestSSE        float64     `json:"best_sse"`
+		StepV          int         `json:"step_v"`
+		StepD          int         `json:"step_d"`
+		StepL          float64     `json:"step_l"`
+		StepR          float64     `json:"step_r"`
+		Trace          []traceRow  `json:"trace"`
+		Optimizer      string      `json:"optimizer"`
+		Simplex        [][]float64 `json:"simplex"` // neldermead vertices as (rho, burstSizeV, meanLysisTime)
+		SimplexSSE     []float64   `json:"simplex_sse"`
+	}
+	replicateSeeds := make([]int, *flag_replicates)
+	for i := range replicateSeeds {
+		replicateSeeds[i] = *flag_baseSeed + i
+	}
+	statePath := filepath.Join(*flag_outDir, "fit_state.json")
+	saveState := func(st fitState) {
+		bs, err := json.MarshalIndent(st, "", "  ")
+		if err != nil {
+			log.Fatalf("Failed to encode fit state: %v", err)
+		}
+		// Write then rename, so an interrupted save never leaves a truncated state behind
+		if err := os.WriteFile(statePath+".tmp", bs, 0644); err != nil {
+			log.Fatalf("Failed to save fit state: %v", err)
+		}
+		if err := os.Rename(statePath+".tmp", statePath); err != nil {
+			log.Fatalf("Failed to save fit state: %v", err)
+		}
 	}
+
 	trace := []traceRow{}
-	_, bestSSE, err := eval(curr)
-	if err != nil {
-		log.Fatalf("initial evaluation failed: %v", err)
-	}
-	trace = append(trace, traceRow{Iter: 0, SSE: bestSSE, V: curr.BurstSizeV, D: curr.BurstSizeD, L: curr.MeanLysisTime, R: curr.BurstRadius})
+	var bestSSE float64
 	stepV, stepD := b.Vstep, b.Dstep
 	stepL, stepR := b.Lstep, float64(b.Rstep)
+	startIter := 1
+	converged := false
+	var simplex [][]float64
+	var simplexSSE []float64
 
-	for iter := 1; iter <= *flag_fitMaxIters; iter++ {
+	if *flag_resumeFit != "" {
+		bs, err := os.ReadFile(statePath)
+		if err != nil {
+			log.Fatalf("Failed to read fit state for -resumeFit: %v", err)
+		}
+		var st fitState
+		if err := json.Unmarshal(bs, &st); err != nil {
+			log.Fatalf("Failed to parse %s: %v", statePath, err)
+		}
+		if st.DataCSVHash == "" {
+			log.Fatalf("Cannot resume: %s predates the tagged fit state format; restart the fit", statePath)
+		}
+		if st.DataCSVHash != dataHash {
+			log.Fatalf("Cannot resume: %s does not match the data CSV the fit was started with", *flag_dataCSV)
+		}
+		if st.Bounds != b {
+			log.Fatalf("Cannot resume: parameter box %+v differs from the saved box %+v (check -quickTest)", b, st.Bounds)
+		}
+		if fmt.Sprint(st.Metrics, st.Times, st.ReplicateSeeds) != fmt.Sprint(metricNames, reqTimes, replicateSeeds) {
+			log.Fatalf("Cannot resume: -metrics, -times, -replicates or -baseSeed differ from the saved fit")
+		}
+		if st.Optimizer != *flag_fitOptimizer {
+			log.Fatalf("Cannot resume: the saved fit used -fitOptimizer=%s", st.Optimizer)
+		}
+		curr, bestSSE, trace = st.Curr, st.BestSSE, st.Trace
+		simplex, simplexSSE = st.Simplex, st.SimplexSSE
+		stepV, stepD, stepL, stepR = st.StepV, st.StepD, st.StepL, st.StepR
+		startIter = st.Iter + 1
+		converged = st.Converged
+		fmt.Printf("[fitMode] Resuming from %s after iteration %d (SSE=%.6f)\n", statePath, st.Iter, bestSSE)
+	} else {
+		_, bestSSE, err = eval(curr)
+		if err != nil {
+			log.Fatalf("initial evaluation failed: %v", err)
+		}
+		trace = append(trace, traceRow{Iter: 0, SSE: bestSSE, V: curr.BurstSizeV, D: curr.BurstSizeD, L: curr.MeanLysisTime, R: curr.BurstRadius, P: curr.Rho})
+	}
+
+	// Nelder–Mead works on the continuous vector (rho, burstSizeV, meanLysisTime); vertices are
+	// projected into the box and burstSizeV rounded only when they are evaluated
+	toFitParams := func(x []float64) FitParams {
+		p := curr
+		p.Rho = clampFloat(x[0], b.Pmin, b.Pmax)
+		p.BurstSizeV = clampInt(int(math.Round(x[1])), b.Vmin, b.Vmax)
+		p.MeanLysisTime = clampFloat(x[2], b.Lmin, b.Lmax)
+		return p
+	}
+	objective := func(x []float64) float64 {
+		_, sse, err := eval(toFitParams(x))
+		if err != nil {
+			// Keep the state JSON-encodable: failed vertices are just very bad ones
+			return math.MaxFloat64
+		}
+		return sse
+	}
+	if *flag_fitOptimizer == "neldermead" && len(simplex) == 0 {
+		x0 := []float64{curr.Rho, float64(curr.BurstSizeV), curr.MeanLysisTime}
+		steps := []float64{b.Pstep, 4 * float64(b.Vstep), 2 * b.Lstep}
+		simplex = [][]float64{x0}
+		simplexSSE = []float64{bestSSE}
+		for k := range x0 {
+			x := append([]float64(nil), x0...)
+			x[k] += steps[k]
+			// Step inward when the start sits on the upper bound
+			if toFitParams(x) == toFitParams(x0) {
+				x[k] = x0[k] - steps[k]
+			}
+			simplex = append(simplex, x)
+			simplexSSE = append(simplexSSE, objective(x))
+		}
+		sortSimplex(simplex, simplexSSE)
+	}
+	currentState := func(iter int) fitState {
+		return fitState{
+			DataCSVHash: dataHash, Bounds: b, Metrics: metricNames, Times: reqTimes, ReplicateSeeds: replicateSeeds,
+			Iter: iter, Converged: converged, Curr: curr, BestSSE: bestSSE,
+			StepV: stepV, StepD: stepD, StepL: stepL, StepR: stepR, Trace: trace,
+			Optimizer: *flag_fitOptimizer, Simplex: simplex, SimplexSSE: simplexSSE,
+		}
+	}
+	if startIter == 1 {
+		saveState(currentState(0))
+	}
+
+	for iter := startIter; iter <= *flag_fitMaxIters && !converged && *flag_fitOptimizer == "neldermead"; iter++ {
+		nelderMeadStep(simplex, simplexSSE, objective)
+		curr, bestSSE = toFitParams(simplex[0]), simplexSSE[0]
+		// Converged once every vertex scores within fitTol of the best one
+		if simplexSSE[len(simplexSSE)-1]-simplexSSE[0] < *flag_fitTol {
+			converged = true
+		}
+		trace = append(trace, traceRow{Iter: iter, SSE: bestSSE, V: curr.BurstSizeV, D: curr.BurstSizeD, L: curr.MeanLysisTime, R: curr.BurstRadius, P: curr.Rho})
+		saveState(currentState(iter))
+	}
+
+	for iter := startIter; iter <= *flag_fitMaxIters && !converged && *flag_fitOptimizer == "pattern"; iter++ {
 		improved := false
 		bestLocal := curr
 		bestLocalSSE := bestSSE
 		// Generate neighbors in each dimension (+/- step)
 		cands := []FitParams{
-			{clampInt(curr.BurstSizeV-stepV, b.Vmin, b.Vmax), curr.BurstSizeD, curr.MeanLysisTime, curr.BurstRadius},
-			{clampInt(curr.BurstSizeV+stepV, b.Vmin, b.Vmax), curr.BurstSizeD, curr.MeanLysisTime, curr.BurstRadius},
-			{curr.BurstSizeV, clampInt(curr.BurstSizeD-stepD, b.Dmin, b.Dmax), curr.MeanLysisTime, curr.BurstRadius},
-			{curr.BurstSizeV, clampInt(curr.BurstSizeD+stepD, b.Dmin, b.Dmax), curr.MeanLysisTime, curr.BurstRadius},
-			{curr.BurstSizeV, curr.BurstSizeD, clampFloat(curr.MeanLysisTime-stepL, b.Lmin, b.Lmax), curr.BurstRadius},
-			{curr.BurstSizeV, curr.BurstSizeD, clampFloat(curr.MeanLysisTime+stepL, b.Lmin, b.Lmax), curr.BurstRadius},
-			{curr.BurstSizeV, curr.BurstSizeD, curr.MeanLysisTime, clampInt(curr.BurstRadius-int(stepR), b.Rmin, b.Rmax)},
-			{curr.BurstSizeV, curr.BurstSizeD, curr.MeanLysisTime, clampInt(curr.BurstRadius+int(stepR), b.Rmin, b.Rmax)},
+			{clampInt(curr.BurstSizeV-stepV, b.Vmin, b.Vmax), curr.BurstSizeD, curr.MeanLysisTime, curr.BurstRadius, curr.Rho},
+			{clampInt(curr.BurstSizeV+stepV, b.Vmin, b.Vmax), curr.BurstSizeD, curr.MeanLysisTime, curr.BurstRadius, curr.Rho},
+			{curr.BurstSizeV, clampInt(curr.BurstSizeD-stepD, b.Dmin, b.Dmax), curr.MeanLysisTime, curr.BurstRadius, curr.Rho},
+			{curr.BurstSizeV, clampInt(curr.BurstSizeD+stepD, b.Dmin, b.Dmax), curr.MeanLysisTime, curr.BurstRadius, curr.Rho},
+			{curr.BurstSizeV, curr.BurstSizeD, clampFloat(curr.MeanLysisTime-stepL, b.Lmin, b.Lmax), curr.BurstRadius, curr.Rho},
+			{curr.BurstSizeV, curr.BurstSizeD, clampFloat(curr.MeanLysisTime+stepL, b.Lmin, b.Lmax), curr.BurstRadius, curr.Rho},
+			{curr.BurstSizeV, curr.BurstSizeD, curr.MeanLysisTime, clampInt(curr.BurstRadius-int(stepR), b.Rmin, b.Rmax), curr.Rho},
+			{curr.BurstSizeV, curr.BurstSizeD, curr.MeanLysisTime, clampInt(curr.BurstRadius+int(stepR), b.Rmin, b.Rmax), curr.Rho},
 		}
 		for _, c := range cands {
 			_, sse, err := eval(c)
@@ -4130,7 +4193,9 @@ func runFitPipeline() {
 		if !improved {
 			// Reduce steps; stop if minimal
 			if stepV <= 50 && stepD <= 10 && stepL <= 1 && int(stepR) <= 1 {
-				trace = append(trace, traceRow{Iter: iter, SSE: bestSSE, V: curr.BurstSizeV, D: curr.BurstSizeD, L: curr.MeanLysisTime, R: curr.BurstRadius})
+				trace = append(trace, traceRow{Iter: iter, SSE: bestSSE, V: curr.BurstSizeV, D: curr.BurstSizeD, L: curr.MeanLysisTime, R: curr.BurstRadius, P: curr.Rho})
+				converged = true
+				saveState(currentState(iter))
 				break
 			}
 			if stepV > 50 {
@@ -4158,7 +4223,8 @@ func runFitPipeline() {
 				}
 			}
 		}
-		trace = append(trace, traceRow{Iter: iter, SSE: bestSSE, V: curr.BurstSizeV, D: curr.BurstSizeD, L: curr.MeanLysisTime, R: curr.BurstRadius})
+		trace = append(trace, traceRow{Iter: iter, SSE: bestSSE, V: curr.BurstSizeV, D: curr.BurstSizeD, L: curr.MeanLysisTime, R: curr.BurstRadius, P: curr.Rho})
+		saveState(currentState(iter))
 	}
 
 	// Final evaluation at best
@@ -4166,7 +4232,7 @@ func runFitPipeline() {
 	if err != nil {
 		log.Fatalf("final eval failed: %v", err)
 	}
-	fmt.Printf("[fitMode] Best params: V=%d D=%d L=%.2f R=%d | SSE=%.6f\n", curr.BurstSizeV, curr.BurstSizeD, curr.MeanLysisTime, curr.BurstRadius, bestSSE)
+	fmt.Printf("[fitMode] Best params: rho=%.4f V=%d D=%d L=%.2f R=%d | SSE=%.6f\n", curr.Rho, curr.BurstSizeV, curr.BurstSizeD, curr.MeanLysisTime, curr.BurstRadius, bestSSE)
 
 	// Confidence intervals
 	// 1) Hessian/Fisher via finite-diff Jacobian
@@ -4272,6 +4338,7 @@ func runFitPipeline() {
 			bld.WriteString(fmt.Sprintf("burstSizeD,%d,%.3f,%.3f,,\n", curr.BurstSizeD, hessCI[1][0], hessCI[1][1]))
 			bld.WriteString(fmt.Sprintf("meanLysisTime,%.3f,%.3f,%.3f,,\n", curr.MeanLysisTime, hessCI[2][0], hessCI[2][1]))
 			bld.WriteString(fmt.Sprintf("burstRadius,%d,%.3f,%.3f,,\n", curr.BurstRadius, hessCI[3][0], hessCI[3][1]))
+			bld.WriteString(fmt.Sprintf("rho,%.6f,,,,\n", curr.Rho))
 			_ = os.WriteFile(filepath.Join(outDir, "fit_parameters_with_CI.csv"), []byte(bld.String()), 0644)
 		}
 	}
@@ -4283,12 +4350,12 @@ func runFitPipeline() {
 	}
 	outDir := filepath.Join(*flag_outDir, modeDir)
 	_ = os.MkdirAll(outDir, 0755)
-	// fit_trace.csv
+	// fit_trace.csv (best point per iteration; every evaluation is in <outDir>/fit_evaluations.csv)
 	{
 		var bld strings.Builder
-		bld.WriteString("iteration,SSE,BurstSizeV,BurstSizeD,MeanLysisTime,BurstRadius\n")
+		bld.WriteString("iteration,SSE,BurstSizeV,BurstSizeD,MeanLysisTime,BurstRadius,Rho\n")
 		for _, r := range trace {
-			bld.WriteString(fmt.Sprintf("%d,%.6f,%d,%d,%.3f,%d\n", r.Iter, r.SSE, r.V, r.D, r.L, r.R))
+			bld.WriteString(fmt.Sprintf("%d,%.6f,%d,%d,%.3f,%d,%.6f\n", r.Iter, r.SSE, r.V, r.D, r.L, r.R, r.P))
 		}
 		_ = os.WriteFile(filepath.Join(outDir, "fit_trace.csv"), []byte(bld.String()), 0644)
 	}
@@ -4320,9 +4387,16 @@ func runFitPipeline() {
 
 	// Bootstrap CIs (resample observation set and refit)
 	{
-		type Obs struct{ M string; T int }
+		type Obs struct {
+			M string
+			T int
+		}
 		allObs := []Obs{}
-		for _, m := range metricNames { for _, t := range reqTimes { allObs = append(allObs, Obs{M:m, T:t}) } }
+		for _, m := range metricNames {
+			for _, t := range reqTimes {
+				allObs = append(allObs, Obs{M: m, T: t})
+			}
+		}
 		computeSSEOnObs := func(rs RepStats, obs []Obs) float64 {
 			s := 0.0
 			for _, o := range obs {
@@ -4337,25 +4411,29 @@ func runFitPipeline() {
 			stepV, stepD := b.Vstep, b.Dstep
 			stepL, stepR := b.Lstep, float64(b.Rstep)
 			bestRS, _, err := eval(currP)
-			if err != nil { return currP, nil, math.Inf(1) }
+			if err != nil {
+				return currP, nil, math.Inf(1)
+			}
 			bestS := computeSSEOnObs(bestRS, obs)
 			for iter := 0; iter < maxIters; iter++ {
 				improved := false
 				bestLocal := currP
 				bestLocalS := bestS
 				cands := []FitParams{
-					{clampInt(currP.BurstSizeV-stepV, b.Vmin, b.Vmax), currP.BurstSizeD, currP.MeanLysisTime, currP.BurstRadius},
-					{clampInt(currP.BurstSizeV+stepV, b.Vmin, b.Vmax), currP.BurstSizeD, currP.MeanLysisTime, currP.BurstRadius},
-					{currP.BurstSizeV, clampInt(currP.BurstSizeD-stepD, b.Dmin, b.Dmax), currP.MeanLysisTime, currP.BurstRadius},
-					{currP.BurstSizeV, clampInt(currP.BurstSizeD+stepD, b.Dmin, b.Dmax), currP.MeanLysisTime, currP.BurstRadius},
-					{currP.BurstSizeV, currP.BurstSizeD, clampFloat(currP.MeanLysisTime-stepL, b.Lmin, b.Lmax), currP.BurstRadius},
-					{currP.BurstSizeV, currP.BurstSizeD, clampFloat(currP.MeanLysisTime+stepL, b.Lmin, b.Lmax), currP.BurstRadius},
-					{currP.BurstSizeV, currP.BurstSizeD, currP.MeanLysisTime, clampInt(currP.BurstRadius-int(stepR), b.Rmin, b.Rmax)},
-					{currP.BurstSizeV, currP.BurstSizeD, currP.MeanLysisTime, clampInt(currP.BurstRadius+int(stepR), b.Rmin, b.Rmax)},
+					{clampInt(currP.BurstSizeV-stepV, b.Vmin, b.Vmax), currP.BurstSizeD, currP.MeanLysisTime, currP.BurstRadius, currP.Rho},
+					{clampInt(currP.BurstSizeV+stepV, b.Vmin, b.Vmax), currP.BurstSizeD, currP.MeanLysisTime, currP.BurstRadius, currP.Rho},
+					{currP.BurstSizeV, clampInt(currP.BurstSizeD-stepD, b.Dmin, b.Dmax), currP.MeanLysisTime, currP.BurstRadius, currP.Rho},
+					{currP.BurstSizeV, clampInt(currP.BurstSizeD+stepD, b.Dmin, b.Dmax), currP.MeanLysisTime, currP.BurstRadius, currP.Rho},
+					{currP.BurstSizeV, currP.BurstSizeD, clampFloat(currP.MeanLysisTime-stepL, b.Lmin, b.Lmax), currP.BurstRadius, currP.Rho},
+					{currP.BurstSizeV, currP.BurstSizeD, clampFloat(currP.MeanLysisTime+stepL, b.Lmin, b.Lmax), currP.BurstRadius, currP.Rho},
+					{currP.BurstSizeV, currP.BurstSizeD, currP.MeanLysisTime, clampInt(currP.BurstRadius-int(stepR), b.Rmin, b.Rmax), currP.Rho},
+					{currP.BurstSizeV, currP.BurstSizeD, currP.MeanLysisTime, clampInt(currP.BurstRadius+int(stepR), b.Rmin, b.Rmax), currP.Rho},
 				}
 				for _, c := range cands {
 					rs, _, err := eval(c)
-					if err != nil { continue }
+					if err != nil {
+						continue
+					}
 					s := computeSSEOnObs(rs, obs)
 					if s+1e-12 < bestLocalS {
 						bestLocalS = s
@@ -4363,29 +4441,65 @@ func runFitPipeline() {
 					}
 				}
 				if bestLocalS+1e-12 < bestS {
-					if math.Abs(bestS-bestLocalS) < *flag_fitTol { bestS = bestLocalS; currP = bestLocal; improved = false } else { bestS = bestLocalS; currP = bestLocal; improved = true }
+					if math.Abs(bestS-bestLocalS) < *flag_fitTol {
+						bestS = bestLocalS
+						currP = bestLocal
+						improved = false
+					} else {
+						bestS = bestLocalS
+						currP = bestLocal
+						improved = true
+					}
 				}
 				if !improved {
-					if stepV <= 50 && stepD <= 10 && stepL <= 1 && int(stepR) <= 1 { break }
-					if stepV > 50 { stepV/=2; if stepV < 50 { stepV = 50 } }
-					if stepD > 10 { stepD/=2; if stepD < 10 { stepD = 10 } }
-					if stepL > 1 { stepL/=2; if stepL < 1 { stepL = 1 } }
-					if int(stepR) > 1 { stepR/=2; if int(stepR) < 1 { stepR = 1 } }
+					if stepV <= 50 && stepD <= 10 && stepL <= 1 && int(stepR) <= 1 {
+						break
+					}
+					if stepV > 50 {
+						stepV /= 2
+						if stepV < 50 {
+							stepV = 50
+						}
+					}
+					if stepD > 10 {
+						stepD /= 2
+						if stepD < 10 {
+							stepD = 10
+						}
+					}
+					if stepL > 1 {
+						stepL /= 2
+						if stepL < 1 {
+							stepL = 1
+						}
+					}
+					if int(stepR) > 1 {
+						stepR /= 2
+						if int(stepR) < 1 {
+							stepR = 1
+						}
+					}
 				}
 			}
 			rs, _, err := eval(currP)
-			if err != nil { return currP, nil, math.Inf(1) }
+			if err != nil {
+				return currP, nil, math.Inf(1)
+			}
 			return currP, rs, computeSSEOnObs(rs, obs)
 		}
 		// Bootstrap loop
 		bootMax := *flag_fitMaxIters
-		if *flag_quickTest && bootMax > 50 { bootMax = 50 }
+		if *flag_quickTest && bootMax > 50 {
+			bootMax = 50
+		}
 		rng := rand.New(rand.NewSource(int64(*flag_baseSeed + 99991)))
 		bsV, bsD, bsL, bsR := make([]float64, 0, *flag_bootstrapN), make([]float64, 0, *flag_bootstrapN), make([]float64, 0, *flag_bootstrapN), make([]float64, 0, *flag_bootstrapN)
 		for biter := 0; biter < *flag_bootstrapN; biter++ {
 			// resample obs with replacement
 			obs := make([]Obs, len(allObs))
-			for i := range obs { obs[i] = allObs[rng.Intn(len(allObs))] }
+			for i := range obs {
+				obs[i] = allObs[rng.Intn(len(allObs))]
+			}
 			bp, _, _ := fitWithObs(curr, obs, bootMax)
 			bsV = append(bsV, float64(bp.BurstSizeV))
 			bsD = append(bsD, float64(bp.BurstSizeD))
@@ -4396,46 +4510,108 @@ func runFitPipeline() {
 		{
 			buildResidual := func(p FitParams) ([]float64, float64) {
 				rs, sse, err := eval(p)
-				if err != nil { log.Fatalf("residual eval failed: %v", err) }
+				if err != nil {
+					log.Fatalf("residual eval failed: %v", err)
+				}
 				vec := make([]float64, 0, len(metricNames)*len(reqTimes))
-				for _, m := range metricNames { for _, t := range reqTimes { vec = append(vec, rs[m][t].Mean-data[m][t]) } }
+				for _, m := range metricNames {
+					for _, t := range reqTimes {
+						vec = append(vec, rs[m][t].Mean-data[m][t])
+					}
+				}
 				return vec, sse
 			}
 			r0, rss := buildResidual(curr)
-			n := float64(len(r0)); pdim := 4.0; sigma2 := 0.0
-			if n>pdim { sigma2 = rss/(n-pdim) }
-			J := make([][]float64, len(r0)); for i := range J { J[i] = make([]float64, 4) }
+			n := float64(len(r0))
+			pdim := 4.0
+			sigma2 := 0.0
+			if n > pdim {
+				sigma2 = rss / (n - pdim)
+			}
+			J := make([][]float64, len(r0))
+			for i := range J {
+				J[i] = make([]float64, 4)
+			}
 			epsV := math.Max(1.0, 0.01*float64(curr.BurstSizeV))
 			epsD := math.Max(1.0, 0.01*float64(curr.BurstSizeD))
 			epsL := math.Max(0.01, 0.01*curr.MeanLysisTime)
 			epsR := math.Max(1.0, 0.01*float64(curr.BurstRadius))
-			pV := curr; pV.BurstSizeV = clampInt(curr.BurstSizeV+int(math.Round(epsV)), b.Vmin, b.Vmax); rV,_ := buildResidual(pV); for i := range r0 { J[i][0] = (rV[i]-r0[i])/float64(pV.BurstSizeV-curr.BurstSizeV) }
-			pD := curr; pD.BurstSizeD = clampInt(curr.BurstSizeD+int(math.Round(epsD)), b.Dmin, b.Dmax); rD,_ := buildResidual(pD); for i := range r0 { J[i][1] = (rD[i]-r0[i])/float64(pD.BurstSizeD-curr.BurstSizeD) }
-			pL := curr; pL.MeanLysisTime = clampFloat(curr.MeanLysisTime+epsL, b.Lmin, b.Lmax); rL,_ := buildResidual(pL); for i := range r0 { J[i][2] = (rL[i]-r0[i])/(pL.MeanLysisTime-curr.MeanLysisTime) }
-			pR := curr; pR.BurstRadius = clampInt(curr.BurstRadius+int(math.Round(epsR)), b.Rmin, b.Rmax); rR,_ := buildResidual(pR); for i := range r0 { J[i][3] = (rR[i]-r0[i])/float64(pR.BurstRadius-curr.BurstRadius) }
-			JTJ := make([][]float64, 4); for i := 0; i < 4; i++ { JTJ[i] = make([]float64, 4) }
-			for i := 0; i < 4; i++ { for j := 0; j < 4; j++ { sum:=0.0; for k:=0;k<len(r0);k++{ sum += J[k][i]*J[k][j] } ; JTJ[i][j] = sum } }
+			pV := curr
+			pV.BurstSizeV = clampInt(curr.BurstSizeV+int(math.Round(epsV)), b.Vmin, b.Vmax)
+			rV, _ := buildResidual(pV)
+			for i := range r0 {
+				J[i][0] = (rV[i] - r0[i]) / float64(pV.BurstSizeV-curr.BurstSizeV)
+			}
+			pD := curr
+			pD.BurstSizeD = clampInt(curr.BurstSizeD+int(math.Round(epsD)), b.Dmin, b.Dmax)
+			rD, _ := buildResidual(pD)
+			for i := range r0 {
+				J[i][1] = (rD[i] - r0[i]) / float64(pD.BurstSizeD-curr.BurstSizeD)
+			}
+			pL := curr
+			pL.MeanLysisTime = clampFloat(curr.MeanLysisTime+epsL, b.Lmin, b.Lmax)
+			rL, _ := buildResidual(pL)
+			for i := range r0 {
+				J[i][2] = (rL[i] - r0[i]) / (pL.MeanLysisTime - curr.MeanLysisTime)
+			}
+			pR := curr
+			pR.BurstRadius = clampInt(curr.BurstRadius+int(math.Round(epsR)), b.Rmin, b.Rmax)
+			rR, _ := buildResidual(pR)
+			for i := range r0 {
+				J[i][3] = (rR[i] - r0[i]) / float64(pR.BurstRadius-curr.BurstRadius)
+			}
+			JTJ := make([][]float64, 4)
+			for i := 0; i < 4; i++ {
+				JTJ[i] = make([]float64, 4)
+			}
+			for i := 0; i < 4; i++ {
+				for j := 0; j < 4; j++ {
+					sum := 0.0
+					for k := 0; k < len(r0); k++ {
+						sum += J[k][i] * J[k][j]
+					}
+					JTJ[i][j] = sum
+				}
+			}
 			inv, ok := invertMatrix(JTJ)
 			if ok {
-				vars := []float64{inv[0][0]*sigma2, inv[1][1]*sigma2, inv[2][2]*sigma2, inv[3][3]*sigma2}
+				vars := []float64{inv[0][0] * sigma2, inv[1][1] * sigma2, inv[2][2] * sigma2, inv[3][3] * sigma2}
 				// Compute bootstrap percentiles
 				q := func(xs []float64, p float64) float64 { return quantile(xs, p) }
-				modeDir := "full"; if *flag_quickTest { modeDir = "quick" }
-				outDir := filepath.Join(*flag_outDir, modeDir); _ = os.MkdirAll(outDir, 0755)
+				modeDir := "full"
+				if *flag_quickTest {
+					modeDir = "quick"
+				}
+				outDir := filepath.Join(*flag_outDir, modeDir)
+				_ = os.MkdirAll(outDir, 0755)
 				var bld strings.Builder
 				bld.WriteString("parameter,best_fit_value,hessian_ci_low,hessian_ci_high,bootstrap_ci_low,bootstrap_ci_high\n")
 				// burstSizeV
-				seV := 0.0; if vars[0] > 0 { seV = math.Sqrt(vars[0]) }
-				bld.WriteString(fmt.Sprintf("burstSizeV,%d,%.3f,%.3f,%.3f,%.3f\n", curr.BurstSizeV, float64(curr.BurstSizeV)-1.96*seV, float64(curr.BurstSizeV)+1.96*seV, q(bsV,0.025), q(bsV,0.975)))
+				seV := 0.0
+				if vars[0] > 0 {
+					seV = math.Sqrt(vars[0])
+				}
+				bld.WriteString(fmt.Sprintf("burstSizeV,%d,%.3f,%.3f,%.3f,%.3f\n", curr.BurstSizeV, float64(curr.BurstSizeV)-1.96*seV, float64(curr.BurstSizeV)+1.96*seV, q(bsV, 0.025), q(bsV, 0.975)))
 				// burstSizeD
-				seD := 0.0; if vars[1] > 0 { seD = math.Sqrt(vars[1]) }
-				bld.WriteString(fmt.Sprintf("burstSizeD,%d,%.3f,%.3f,%.3f,%.3f\n", curr.BurstSizeD, float64(curr.BurstSizeD)-1.96*seD, float64(curr.BurstSizeD)+1.96*seD, q(bsD,0.025), q(bsD,0.975)))
+				seD := 0.0
+				if vars[1] > 0 {
+					seD = math.Sqrt(vars[1])
+				}
+				bld.WriteString(fmt.Sprintf("burstSizeD,%d,%.3f,%.3f,%.3f,%.3f\n", curr.BurstSizeD, float64(curr.BurstSizeD)-1.96*seD, float64(curr.BurstSizeD)+1.96*seD, q(bsD, 0.025), q(bsD, 0.975)))
 				// meanLysisTime
-				seL := 0.0; if vars[2] > 0 { seL = math.Sqrt(vars[2]) }
-				bld.WriteString(fmt.Sprintf("meanLysisTime,%.3f,%.3f,%.3f,%.3f,%.3f\n", curr.MeanLysisTime, curr.MeanLysisTime-1.96*seL, curr.MeanLysisTime+1.96*seL, q(bsL,0.025), q(bsL,0.975)))
+				seL := 0.0
+				if vars[2] > 0 {
+					seL = math.Sqrt(vars[2])
+				}
+				bld.WriteString(fmt.Sprintf("meanLysisTime,%.3f,%.3f,%.3f,%.3f,%.3f\n", curr.MeanLysisTime, curr.MeanLysisTime-1.96*seL, curr.MeanLysisTime+1.96*seL, q(bsL, 0.025), q(bsL, 0.975)))
 				// burstRadius
-				seR := 0.0; if vars[3] > 0 { seR = math.Sqrt(vars[3]) }
-				bld.WriteString(fmt.Sprintf("burstRadius,%d,%.3f,%.3f,%.3f,%.3f\n", curr.BurstRadius, float64(curr.BurstRadius)-1.96*seR, float64(curr.BurstRadius)+1.96*seR, q(bsR,0.025), q(bsR,0.975)))
+				seR := 0.0
+				if vars[3] > 0 {
+					seR = math.Sqrt(vars[3])
+				}
+				bld.WriteString(fmt.Sprintf("burstRadius,%d,%.3f,%.3f,%.3f,%.3f\n", curr.BurstRadius, float64(curr.BurstRadius)-1.96*seR, float64(curr.BurstRadius)+1.96*seR, q(bsR, 0.025), q(bsR, 0.975)))
+				// rho is held at its best fit by the bootstrap refits, so it has no CI
+				bld.WriteString(fmt.Sprintf("rho,%.6f,,,,\n", curr.Rho))
 				_ = os.WriteFile(filepath.Join(outDir, "fit_parameters_with_CI.csv"), []byte(bld.String()), 0644)
 			}
 		}
@@ -4444,12 +4620,14 @@ func runFitPipeline() {
 	// config echo
 	cfg := map[string]any{
 		"quickTest":   *flag_quickTest,
+		"optimizer":   *flag_fitOptimizer,
 		"replicates":  *flag_replicates,
 		"bootstrapN":  *flag_bootstrapN,
 		"fitMaxIters": *flag_fitMaxIters,
 		"fitTol":      *flag_fitTol,
 		"metrics":     metricNames,
 		"times":       reqTimes,
+		"burnIn":      *flag_burnIn,
 		"fixedSwitches": map[string]any{
 			"particleSpreadOption": "celltocell",
 			"ifnSpreadOption":      "noIFN",
@@ -4556,6 +4734,76 @@ func generateComparisonPlots(outputFolder string) {
 }
 
 // Utility helpers for fitting
+
+// Function to order Nelder–Mead vertices from best (lowest SSE) to worst
+func sortSimplex(simplex [][]float64, fvals []float64) {
+	idx := make([]int, len(simplex))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(a, b int) bool { return fvals[idx[a]] < fvals[idx[b]] })
+	xs := make([][]float64, len(simplex))
+	fs := make([]float64, len(fvals))
+	for k, i := range idx {
+		xs[k], fs[k] = simplex[i], fvals[i]
+	}
+	copy(simplex, xs)
+	copy(fvals, fs)
+}
+
+// Function to run one Nelder–Mead iteration (reflect, expand, contract or shrink) on a sorted
+// simplex; the simplex is left sorted so simplex[0] is the best vertex
+func nelderMeadStep(simplex [][]float64, fvals []float64, f func([]float64) float64) {
+	n := len(simplex) - 1
+	worst := simplex[n]
+	// Centroid of every vertex but the worst
+	centroid := make([]float64, len(worst))
+	for _, x := range simplex[:n] {
+		for k := range x {
+			centroid[k] += x[k] / float64(n)
+		}
+	}
+	along := func(t float64) []float64 {
+		x := make([]float64, len(worst))
+		for k := range x {
+			x[k] = centroid[k] + t*(worst[k]-centroid[k])
+		}
+		return x
+	}
+
+	xr := along(-1)
+	fr := f(xr)
+	switch {
+	case fr < fvals[0]:
+		xe := along(-2)
+		if fe := f(xe); fe < fr {
+			simplex[n], fvals[n] = xe, fe
+		} else {
+			simplex[n], fvals[n] = xr, fr
+		}
+	case fr < fvals[n-1]:
+		simplex[n], fvals[n] = xr, fr
+	default:
+		// Outside contraction if the reflection beat the worst vertex, inside otherwise
+		t, fRef := 0.5, fvals[n]
+		if fr < fvals[n] {
+			t, fRef = -0.5, fr
+		}
+		xc := along(t)
+		if fc := f(xc); fc < fRef {
+			simplex[n], fvals[n] = xc, fc
+		} else {
+			// Shrink towards the best vertex
+			for i := 1; i <= n; i++ {
+				for k := range simplex[i] {
+					simplex[i][k] = simplex[0][k] + 0.5*(simplex[i][k]-simplex[0][k])
+				}
+				fvals[i] = f(simplex[i])
+			}
+		}
+	}
+	sortSimplex(simplex, fvals)
+}
 func clampInt(v, lo, hi int) int {
 	if v < lo {
 		return lo
@@ -4652,6 +4900,31 @@ func findLatestSimulationCSV(root string) (string, error) {
 }
 
 // Extract requested metrics at requested times from simulation_output.csv
+// Metrics that are time integrals of a sim CSV column: the value at time t is the trapezoidal
+// AUC from the previous requested time (the -burnIn for the first) to t, as for supernatant
+// collected over that window
+var aucMetricColumns = map[string]string{
+	"virion_auc": "Total Extracellular Virions",
+	"dip_auc":    "Total Extracellular DIPs",
+}
+
+// Function to integrate a metric column over [start, end] hours with the trapezoid rule,
+// between the rows at those times (rows holds time -> value)
+func windowAUC(rows map[int]float64, start, end int) float64 {
+	times := []int{}
+	for t := range rows {
+		if t >= start && t <= end {
+			times = append(times, t)
+		}
+	}
+	sort.Ints(times)
+	area := 0.0
+	for k := 1; k < len(times); k++ {
+		area += 0.5 * (rows[times[k-1]] + rows[times[k]]) * float64(times[k]-times[k-1])
+	}
+	return area
+}
+
 func extractMetricsFromSimCSV(csvPath string, times []int, metrics []string, headerMap func(string) string) (map[string]map[int]float64, error) {
 	f, err := os.Open(csvPath)
 	if err != nil {
@@ -4679,6 +4952,9 @@ func extractMetricsFromSimCSV(csvPath string, times []int, metrics []string, hea
 	mIdx := map[string]int{}
 	for _, m := range metrics {
 		h := headerMap(m)
+		if column, isAUC := aucMetricColumns[m]; isAUC {
+			h = column
+		}
 		col, ok := idx[h]
 		if !ok {
 			return nil, fmt.Errorf("sim CSV missing column %q (metric %s)", h, m)
@@ -4710,6 +4986,31 @@ func extractMetricsFromSimCSV(csvPath string, times []int, metrics []string, hea
 	for _, m := range metrics {
 		out[m] = map[int]float64{}
 	}
+	// AUC metrics: every row's value by time, integrated between consecutive requested times
+	sortedTimes := append([]int{}, times...)
+	sort.Ints(sortedTimes)
+	for _, m := range metrics {
+		if _, isAUC := aucMetricColumns[m]; !isAUC {
+			continue
+		}
+		rows := map[int]float64{}
+		for r := 1; r < len(recs); r++ {
+			tv, err := strconv.Atoi(strings.TrimSpace(recs[r][tIdx]))
+			if err != nil {
+				continue
+			}
+			fv, err := strconv.ParseFloat(strings.TrimSpace(recs[r][mIdx[m]]), 64)
+			if err != nil {
+				return nil, fmt.Errorf("parse metric %s at time %d: %v", m, tv, err)
+			}
+			rows[tv] = fv
+		}
+		start := *flag_burnIn
+		for _, t := range sortedTimes {
+			out[m][t] = windowAUC(rows, start, t)
+			start = t
+		}
+	}
 	for _, t := range times {
 		r := best[t]
 		if r < 0 {
@@ -4717,6 +5018,9 @@ func extractMetricsFromSimCSV(csvPath string, times []int, metrics []string, hea
 		}
 		row := recs[r]
 		for _, m := range metrics {
+			if _, isAUC := aucMetricColumns[m]; isAUC {
+				continue
+			}
 			col := mIdx[m]
 			fv, err := strconv.ParseFloat(strings.TrimSpace(row[col]), 64)
 			if err != nil {
@@ -4785,10 +5089,3 @@ func invertMatrix(a [][]float64) ([][]float64, bool) {
 	}
 	return inv, true
 }
-
-// Minimal stub for quickTest build
-func (g *Grid) gridToImage(videotype string) *image.RGBA {
-    w := GRID_SIZE * CELL_SIZE * 2
-    h := GRID_SIZE * CELL_SIZE * 2
-    return image.NewRGBA(image.Rect(0, 0, w, h))
-}
\ No newline at end of file
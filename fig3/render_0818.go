@@ -0,0 +1,153 @@
+//go:build !headless
+
+// Rendering for mdbk_small_vero_0818.go that needs the chart, font and video packages: the
+// infection graph, text labels and the MJPEG video. Build with -tags headless to leave it out
+// (see render_headless_0818.go).
+//
+//	go build -o sim mdbk_small_vero_0818.go render_0818.go
+//	go build -tags headless -o sim mdbk_small_vero_0818.go render_headless_0818.go
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"log"
+
+	"github.com/icza/mjpeg"
+	"github.com/wcharczuk/go-chart/v2" // Used for plotting the graph
+	"github.com/wcharczuk/go-chart/v2/drawing"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// Function to create the MJPEG AVI writer for the simulation video
+func newVideoWriter(path string, width, height, fps int) (videoWriter, error) {
+	return mjpeg.New(path, int32(width), int32(height), int32(fps))
+}
+
+// Function to generate ticks dynamically
+func generateTicks(xMax float64, interval float64) []chart.Tick {
+	var ticks []chart.Tick
+	for value := 0.0; value <= xMax; value += interval {
+		label := fmt.Sprintf("%.0f", value) // Format the label as an integer
+		ticks = append(ticks, chart.Tick{
+			Value: value,
+			Label: label,
+		})
+	}
+	return ticks
+}
+
+// Modified function definition
+func createInfectionGraph(frameNum int, virionOnly, dipOnly, both []float64, showLegend bool) *image.RGBA {
+	graphWidth := GRID_SIZE * CELL_SIZE * 2
+	graphHeight := 200
+
+	if frameNum < 1 {
+		log.Fatalf("Not enough data to render the graph: frameNum = %d", frameNum)
+	}
+
+	virionOnly = clampValues(virionOnly, 0.00, yMax)
+	dipOnly = clampValues(dipOnly, 0.00, yMax)
+	both = clampValues(both, 0.00, yMax)
+
+	// Dynamically set legend name
+	var series []chart.Series
+
+	series = []chart.Series{
+		chart.ContinuousSeries{
+			Name:    "Infected by Virion Only",
+			XValues: createTimeSeries(frameNum),
+			YValues: virionOnly,
+			Style:   chart.Style{StrokeColor: chart.ColorRed, StrokeWidth: 6.0},
+		},
+		chart.ContinuousSeries{
+			Name:    "Infected by DIP Only",
+			XValues: createTimeSeries(frameNum),
+			YValues: dipOnly,
+			Style:   chart.Style{StrokeColor: chart.ColorGreen, StrokeWidth: 6.0},
+		},
+		chart.ContinuousSeries{
+			Name:    "Infected by Both",
+			XValues: createTimeSeries(frameNum),
+			YValues: both,
+			Style:   chart.Style{StrokeColor: drawing.Color{R: 255, G: 165, B: 0, A: 255}, StrokeWidth: 8.0},
+		},
+	}
+
+	graph := chart.Chart{
+		Width:  459, // int(float64(GRID_SIZE*CELL_SIZE) * 1.51)
+		Height: 100,
+		XAxis: chart.XAxis{
+			Style: chart.Style{FontSize: 10.0},
+			ValueFormatter: func(v interface{}) string {
+				return fmt.Sprintf("%d", int(v.(float64)))
+			},
+			Ticks: generateTicks(xMax, ticksInterval),
+		},
+		YAxis: chart.YAxis{
+			Style: chart.Style{FontSize: 10.0},
+		},
+		Series: series,
+	}
+
+	buffer := bytes.NewBuffer([]byte{})
+	err := graph.Render(chart.PNG, buffer)
+	if err != nil {
+		log.Printf("Failed to render graph: %v", err)
+		// Return a simple colored rectangle instead of crashing
+		return image.NewRGBA(image.Rect(0, 0, 459, 100))
+	}
+
+	graphImg, _, err := image.Decode(buffer)
+	if err != nil {
+		log.Fatalf("Failed to decode graph image: %v", err)
+	}
+
+	rgbaImg := image.NewRGBA(image.Rect(0, 0, graphWidth, graphHeight))
+	draw.Draw(rgbaImg, rgbaImg.Bounds(), graphImg, image.Point{}, draw.Src)
+
+	return rgbaImg
+}
+
+func drawTextWithBackground(img *image.RGBA, x, y int, label string, textColor, borderColor, bgColor color.Color) {
+	face := basicfont.Face7x13
+	textWidth := len(label) * 7
+	textHeight := 13
+
+	// White background box
+	bgRect := image.Rect(x-4, y-4, x+textWidth+4, y+textHeight+4)
+	draw.Draw(img, bgRect, &image.Uniform{bgColor}, image.Point{}, draw.Src)
+
+	// Text starting point
+	point := fixed.Point26_6{
+		X: fixed.I(x),
+		Y: fixed.I(y + textHeight),
+	}
+	d := &font.Drawer{
+		Dst:  img,
+		Src:  image.NewUniform(textColor),
+		Face: face,
+		Dot:  point,
+	}
+	d.DrawString(label)
+}
+
+// addLabel draws a text label onto an image at the specified position.
+func addLabel(img *image.RGBA, x, y int, label string, col color.Color) {
+	point := fixed.Point26_6{
+		X: fixed.I(x),
+		Y: fixed.I(y),
+	}
+	d := &font.Drawer{
+		Dst:  img,
+		Src:  image.NewUniform(col),
+		Face: basicfont.Face7x13, // Basic font for rendering
+		Dot:  point,
+	}
+	d.DrawString(label)
+}
@@ -0,0 +1,48 @@
+// Package plotprofile holds the infection-graph y-axis limits of the figure setups, shared by
+// the fig2 and fig3 simulators so both scale their graphs the same way.
+package plotprofile
+
+import "fmt"
+
+// Profile keys the infection-graph y-axis limit. Tau 0 matches any TAU; JumpMode is
+// "random" for random jumping, otherwise "v<jumpRadiusV>d<jumpRadiusD>".
+type Profile struct {
+	IFNRadius int
+	Tau       int
+	JumpMode  string
+}
+
+// Y-axis maximum (fraction of cells) of the infection graph for each known figure setup.
+// This is the single place to add a new setup; the simulators' -yMax flag overrides it.
+var yMaxByProfile = map[Profile]float64{
+	{IFNRadius: 0, Tau: 12, JumpMode: "random"}:  0.2,
+	{IFNRadius: 10, Tau: 12, JumpMode: "random"}: 20.0,
+	{IFNRadius: 0, Tau: 12, JumpMode: "v0d0"}:    0.3,
+	{IFNRadius: 0, Tau: 12, JumpMode: "v5d0"}:    1.0,
+	{IFNRadius: 0, Tau: 12, JumpMode: "v0d5"}:    0.03,
+	{IFNRadius: 0, Tau: 12, JumpMode: "v5d5"}:    0.1,
+	{IFNRadius: 10, Tau: 12, JumpMode: "v5d5"}:   0.2,
+	{IFNRadius: 0, Tau: 24, JumpMode: "v0d0"}:    0.3,
+	{IFNRadius: 0, Tau: 24, JumpMode: "v5d5"}:    1.5,
+	{IFNRadius: 10, Tau: 24, JumpMode: "v5d5"}:   0.2,
+	{IFNRadius: 0, Tau: 0, JumpMode: "v0d0"}:     0.3,
+	{IFNRadius: 0, Tau: 0, JumpMode: "v5d5"}:     1.5,
+	{IFNRadius: 10, Tau: 0, JumpMode: "v5d5"}:    35.0,
+}
+
+// YMax looks up the infection-graph y-axis maximum, or -1 if no profile matches.
+// Random jumping falls back to the jump-radius entries, and an exact TAU to the any-TAU entry.
+func YMax(ifnRadius, tau int, jumpRandomly bool, jumpRadiusV, jumpRadiusD int) float64 {
+	modes := []string{fmt.Sprintf("v%dd%d", jumpRadiusV, jumpRadiusD)}
+	if jumpRandomly {
+		modes = append([]string{"random"}, modes...)
+	}
+	for _, mode := range modes {
+		for _, t := range []int{tau, 0} {
+			if y, ok := yMaxByProfile[Profile{IFNRadius: ifnRadius, Tau: t, JumpMode: mode}]; ok {
+				return y
+			}
+		}
+	}
+	return -1.0
+}
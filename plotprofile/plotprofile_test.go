@@ -0,0 +1,25 @@
+package plotprofile
+
+import "testing"
+
+// TestYMaxFallbacks covers an exact match, the random-jump and any-TAU fallbacks and no match
+func TestYMaxFallbacks(t *testing.T) {
+	cases := []struct {
+		name           string
+		ifnRadius, tau int
+		random         bool
+		jumpV, jumpD   int
+		want           float64
+	}{
+		{"exact", 0, 12, false, 5, 0, 1.0},
+		{"random", 10, 12, true, 0, 0, 20.0},
+		{"random falls back to the jump radii", 0, 24, true, 5, 5, 1.5},
+		{"any TAU", 10, 48, false, 5, 5, 35.0},
+		{"no match", 3, 12, false, 0, 0, -1},
+	}
+	for _, c := range cases {
+		if got := YMax(c.ifnRadius, c.tau, c.random, c.jumpV, c.jumpD); got != c.want {
+			t.Errorf("%s: YMax = %g, want %g", c.name, got, c.want)
+		}
+	}
+}